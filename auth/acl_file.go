@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrInvalidACLFile is returned by the ACLFile if the file contains a
+// malformed line.
+var ErrInvalidACLFile = errors.New("invalid acl file")
+
+type aclAccess int
+
+const (
+	aclRead aclAccess = 1 << iota
+	aclWrite
+	aclDeny
+)
+
+type aclRule struct {
+	access aclAccess
+	filter string
+}
+
+type aclRules struct {
+	anonymous []aclRule
+	users     map[string][]aclRule
+	patterns  []aclRule
+}
+
+// An ACLFile authorizes clients using an access control list in the format of
+// mosquitto. The file consists of the following lines:
+//
+//	user <username>
+//	topic [read|write|readwrite|deny] <filter>
+//	pattern [read|write|readwrite|deny] <filter>
+//
+// Topic lines before the first user line apply to anonymous clients, the
+// others to the preceding user. Pattern lines apply to all clients and may
+// use %u for the username and %c for the client id. The access defaults to
+// readwrite. Clients may publish to topics that are covered by a write rule
+// and subscribe to filters that are covered by a read rule, unless they are
+// covered by a deny rule. As the rules are checked when publishing and
+// subscribing, messages forwarded to broader subscriptions are not filtered.
+//
+// The username is taken from the subject of the client identity. The ACLFile
+// should therefore be used as the Authorizer of a broker.AuthBackend. The file
+// is reloaded when it has been modified.
+type ACLFile struct {
+	// The interval in which the file is checked for modifications.
+	//
+	// Will default to 5 seconds.
+	ReloadInterval time.Duration
+
+	// OnError may be set to receive errors of automatic reloads. The previous
+	// rules are kept if the file cannot be loaded.
+	OnError func(error)
+
+	file      watchedFile
+	rules     atomic.Pointer[aclRules]
+	fileMutex sync.Mutex
+}
+
+// NewACLFile returns a new ACLFile that loads the access control list at the
+// specified path.
+func NewACLFile(path string) (*ACLFile, error) {
+	// create file
+	acl := &ACLFile{
+		ReloadInterval: 5 * time.Second,
+		file:           watchedFile{path: path},
+	}
+
+	// load file
+	err := acl.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+// Reload will immediately reload the access control list. The previous rules
+// are kept if the file cannot be loaded.
+func (a *ACLFile) Reload() error {
+	// acquire mutex
+	a.fileMutex.Lock()
+	defer a.fileMutex.Unlock()
+
+	// read file
+	data, err := a.file.read()
+	if err != nil {
+		return err
+	}
+
+	// parse file
+	rules, err := parseACLFile(data)
+	if err != nil {
+		return err
+	}
+
+	// set rules
+	a.rules.Store(rules)
+
+	return nil
+}
+
+// ReloadOnSignal will reload the access control list whenever one of the
+// specified signals is received until the returned function is called.
+//
+// Will default to SIGHUP.
+func (a *ACLFile) ReloadOnSignal(signals ...os.Signal) func() {
+	// set default signal
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	// register channel
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	// reload on signals
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				a.reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// prepare stop function
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// AuthorizePublish implements the broker.Authorizer interface.
+func (a *ACLFile) AuthorizePublish(client *broker.Client, topic string) bool {
+	return a.check(client, topic, aclWrite)
+}
+
+// AuthorizeSubscribe implements the broker.Authorizer interface.
+func (a *ACLFile) AuthorizeSubscribe(client *broker.Client, filter string) bool {
+	return a.check(client, filter, aclRead)
+}
+
+func (a *ACLFile) check(client *broker.Client, name string, access aclAccess) bool {
+	// reload modified file, concurrent checks are skipped
+	if a.fileMutex.TryLock() {
+		interval := a.ReloadInterval
+		if interval == 0 {
+			interval = 5 * time.Second
+		}
+		changed := a.file.changed(interval)
+		a.fileMutex.Unlock()
+
+		if changed {
+			a.reload()
+		}
+	}
+
+	// get user and client id
+	var user, clientID string
+	if client != nil {
+		clientID = client.ID()
+		if identity := broker.ClientIdentity(client); identity != nil {
+			user = identity.Subject
+		}
+	}
+
+	return a.authorize(user, clientID, name, access)
+}
+
+func (a *ACLFile) authorize(user, clientID, name string, access aclAccess) bool {
+	// get rules
+	rules := a.rules.Load()
+	list := rules.anonymous
+	if user != "" {
+		list = rules.users[user]
+	}
+
+	// check rules
+	allowed := false
+	for _, rule := range list {
+		if topic.Covers(rule.filter, name) {
+			if rule.access == aclDeny {
+				return false
+			}
+
+			allowed = allowed || rule.access&access != 0
+		}
+	}
+
+	// check patterns
+	for _, rule := range rules.patterns {
+		// expand filter
+		filter, ok := expandACLPattern(rule.filter, user, clientID)
+		if !ok {
+			continue
+		}
+
+		if topic.Covers(filter, name) {
+			if rule.access == aclDeny {
+				return false
+			}
+
+			allowed = allowed || rule.access&access != 0
+		}
+	}
+
+	return allowed
+}
+
+func (a *ACLFile) reload() {
+	err := a.Reload()
+	if err != nil && a.OnError != nil {
+		a.OnError(err)
+	}
+}
+
+func expandACLPattern(filter, user, clientID string) (string, bool) {
+	// expand values that do not contain separators or wildcards
+	for placeholder, value := range map[string]string{"%u": user, "%c": clientID} {
+		if !strings.Contains(filter, placeholder) {
+			continue
+		}
+
+		if value == "" || strings.ContainsAny(value, "/+#") {
+			return "", false
+		}
+
+		filter = strings.ReplaceAll(filter, placeholder, value)
+	}
+
+	return filter, true
+}
+
+func parseACLFile(data []byte) (*aclRules, error) {
+	// prepare rules
+	rules := &aclRules{
+		users: make(map[string][]aclRule),
+	}
+
+	// parse lines
+	var user string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// skip empty lines and comments
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// split keyword
+		keyword, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil, ErrInvalidACLFile
+		}
+
+		// handle user
+		if keyword == "user" {
+			user = rest
+			continue
+		}
+
+		// parse rule
+		rule, err := parseACLRule(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		// add rule
+		switch keyword {
+		case "topic":
+			if user == "" {
+				rules.anonymous = append(rules.anonymous, rule)
+			} else {
+				rules.users[user] = append(rules.users[user], rule)
+			}
+		case "pattern":
+			rules.patterns = append(rules.patterns, rule)
+		default:
+			return nil, ErrInvalidACLFile
+		}
+	}
+
+	// check error
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func parseACLRule(str string) (aclRule, error) {
+	// get access
+	access := aclRead | aclWrite
+	first, rest, _ := strings.Cut(str, " ")
+	rest = strings.TrimSpace(rest)
+	if rest != "" {
+		switch first {
+		case "read":
+			access = aclRead
+			str = rest
+		case "write":
+			access = aclWrite
+			str = rest
+		case "readwrite":
+			str = rest
+		case "deny":
+			access = aclDeny
+			str = rest
+		}
+	}
+
+	// validate filter
+	_, err := topic.Parse(str, true)
+	if err != nil {
+		return aclRule{}, ErrInvalidACLFile
+	}
+
+	return aclRule{
+		access: access,
+		filter: str,
+	}, nil
+}
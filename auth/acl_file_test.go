@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthenticator struct {
+	identity *broker.Identity
+}
+
+func (a *testAuthenticator) Authenticate(*broker.Client, string, string) (*broker.Identity, error) {
+	return a.identity, nil
+}
+
+func TestACLFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl")
+
+	err = os.WriteFile(path, []byte(`# anonymous
+topic read public/#
+
+user alice
+topic foo/#
+topic deny foo/secret
+topic write bar
+
+pattern read clients/%c/#
+pattern write users/%u/#
+`), 0600)
+	require.NoError(t, err)
+
+	acl, err := NewACLFile(path)
+	require.NoError(t, err)
+	acl.ReloadInterval = time.Millisecond
+
+	anonymous := &broker.Client{}
+	alice := &broker.Client{Authorizer: &broker.Identity{Subject: "alice", Authorizer: acl}}
+
+	// anonymous
+	assert.True(t, acl.AuthorizeSubscribe(anonymous, "public/news"))
+	assert.False(t, acl.AuthorizePublish(anonymous, "public/news"))
+	assert.False(t, acl.AuthorizeSubscribe(anonymous, "foo/bar"))
+
+	// user
+	assert.True(t, acl.AuthorizePublish(alice, "foo/bar"))
+	assert.True(t, acl.AuthorizeSubscribe(alice, "foo/+"))
+	assert.False(t, acl.AuthorizePublish(alice, "foo/secret"))
+	assert.True(t, acl.AuthorizeSubscribe(alice, "foo/#"))
+	assert.True(t, acl.AuthorizePublish(alice, "bar"))
+	assert.False(t, acl.AuthorizeSubscribe(alice, "bar"))
+	assert.False(t, acl.AuthorizeSubscribe(alice, "public/news"))
+
+	// patterns
+	assert.True(t, acl.authorize("", "anon", "clients/anon/#", aclRead))
+	assert.True(t, acl.authorize("alice", "c1", "clients/c1/foo", aclRead))
+	assert.False(t, acl.authorize("alice", "c1", "clients/c2/foo", aclRead))
+	assert.True(t, acl.authorize("alice", "c1", "users/alice/foo", aclWrite))
+	assert.False(t, acl.authorize("alice", "c1", "users/alice/foo", aclRead))
+	assert.False(t, acl.authorize("", "anon", "users//foo", aclWrite))
+	assert.True(t, acl.authorize("bob", "c/2", "users/bob/foo", aclWrite))
+	assert.False(t, acl.authorize("bob", "c/2", "clients/c/2/foo", aclRead))
+
+	// identity
+	assert.True(t, alice.Authorizer.AuthorizePublish(alice, "foo/bar"))
+	assert.False(t, alice.Authorizer.AuthorizePublish(alice, "baz"))
+
+	// hot reload
+	err = os.WriteFile(path, []byte("user alice\ntopic read baz\n"), 0600)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+
+	assert.False(t, acl.AuthorizePublish(alice, "foo/bar"))
+	assert.True(t, acl.AuthorizeSubscribe(alice, "baz"))
+
+	// invalid file keeps rules
+	var errs []error
+	acl.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	err = os.WriteFile(path, []byte("user alice\ntopic read baz\nfoo bar\n"), 0600)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+
+	assert.True(t, acl.AuthorizeSubscribe(alice, "baz"))
+	assert.Equal(t, []error{ErrInvalidACLFile}, errs)
+
+	err = acl.Reload()
+	assert.Equal(t, ErrInvalidACLFile, err)
+
+	_, err = NewACLFile(path)
+	assert.Equal(t, ErrInvalidACLFile, err)
+}
+
+func TestACLFileReloadOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported")
+	}
+
+	dir, err := os.MkdirTemp("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl")
+
+	err = os.WriteFile(path, []byte("topic foo\n"), 0600)
+	require.NoError(t, err)
+
+	acl, err := NewACLFile(path)
+	require.NoError(t, err)
+	acl.ReloadInterval = time.Hour
+
+	stop := acl.ReloadOnSignal()
+	defer stop()
+
+	assert.True(t, acl.AuthorizePublish(nil, "foo"))
+	assert.False(t, acl.AuthorizePublish(nil, "bar"))
+
+	err = os.WriteFile(path, []byte("topic bar\n"), 0600)
+	require.NoError(t, err)
+
+	err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(time.Second)
+	for !acl.AuthorizePublish(nil, "bar") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.True(t, acl.AuthorizePublish(nil, "bar"))
+	assert.False(t, acl.AuthorizePublish(nil, "foo"))
+}
+
+func TestACLFileAuthBackend(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl")
+
+	err = os.WriteFile(path, []byte("user device\ntopic foo/#\n"), 0600)
+	require.NoError(t, err)
+
+	acl, err := NewACLFile(path)
+	require.NoError(t, err)
+
+	identity := &broker.Identity{Subject: "device"}
+	backend := broker.NewAuthBackend(broker.NewMemoryBackend(), &testAuthenticator{identity: identity})
+	backend.Authorizer = acl
+
+	client := &broker.Client{}
+	ok, err := backend.Authenticate(client, "device", "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.True(t, client.Authorizer.AuthorizePublish(client, "foo/bar"))
+	assert.False(t, client.Authorizer.AuthorizePublish(client, "bar"))
+	assert.Nil(t, identity.Authorizer)
+}
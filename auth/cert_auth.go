@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// CertField selects the value of a client certificate that identifies the
+// client.
+type CertField int
+
+const (
+	// CertCommonName selects the common name of the certificate subject.
+	CertCommonName CertField = iota
+
+	// CertURI selects the first URI subject alternative name.
+	CertURI
+
+	// CertFingerprint selects the hex encoded SHA-256 fingerprint of the
+	// certificate.
+	CertFingerprint
+)
+
+// Value returns the selected value of the certificate or an empty string if
+// it is not present.
+func (f CertField) Value(cert *x509.Certificate) string {
+	switch f {
+	case CertCommonName:
+		return cert.Subject.CommonName
+	case CertURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case CertFingerprint:
+		sum := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+
+	return ""
+}
+
+// A CertAuthenticator authenticates clients using their verified TLS client
+// certificate. The selected certificate value is mapped to the identity of the
+// client. Clients without a verified certificate are rejected.
+type CertAuthenticator struct {
+	// The certificate value that identifies the client.
+	//
+	// Will default to the common name.
+	Field CertField
+
+	// If set, clients that supply a username in the Connect packet that does
+	// not match the certificate value are rejected.
+	MatchUsername bool
+
+	// The Lookup callback may be set to map the certificate value to an
+	// identity. Returning nil rejects the client.
+	//
+	// Will default to an unrestricted identity with the value as subject.
+	Lookup func(value string) (*broker.Identity, error)
+}
+
+// Authenticate implements the broker.Authenticator interface.
+func (a *CertAuthenticator) Authenticate(client *broker.Client, user, _ string) (*broker.Identity, error) {
+	// get certificate
+	cert := ClientCertificate(client)
+	if cert == nil {
+		return nil, nil
+	}
+
+	// get value
+	value := a.Field.Value(cert)
+	if value == "" {
+		return nil, nil
+	}
+
+	// check username
+	if a.MatchUsername && user != "" && user != value {
+		return nil, nil
+	}
+
+	// lookup identity
+	if a.Lookup != nil {
+		return a.Lookup(value)
+	}
+
+	return &broker.Identity{
+		Subject: value,
+	}, nil
+}
+
+// ClientCertificate returns the verified TLS certificate of the client or nil
+// if the client did not present a verified certificate.
+func ClientCertificate(client *broker.Client) *x509.Certificate {
+	// get connection state
+	state, ok := transport.ConnectionState(client.Conn())
+	if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueCert(parent *tls.Certificate, name string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/" + name}},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	// self sign without parent
+	parentCert, parentKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+func TestCertField(t *testing.T) {
+	cert := issueCert(nil, "device1").Leaf
+
+	assert.Equal(t, "device1", CertCommonName.Value(cert))
+	assert.Equal(t, "spiffe://example.org/device1", CertURI.Value(cert))
+	assert.Len(t, CertFingerprint.Value(cert), 64)
+}
+
+func TestCertAuthenticator(t *testing.T) {
+	ca := issueCert(nil, "ca")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	launcher := transport.NewLauncher()
+	launcher.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{*issueCert(ca, "localhost")},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	server, err := launcher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	authenticator := &CertAuthenticator{
+		MatchUsername: true,
+	}
+
+	engine := broker.NewEngine(broker.NewAuthBackend(broker.NewMemoryBackend(), authenticator))
+	engine.Accept(server)
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	dialer := transport.NewDialer()
+	dialer.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{*issueCert(ca, "device1")},
+		RootCAs:      pool,
+		ServerName:   "localhost",
+	}
+
+	// matching username
+	conn, err := dialer.Dial("tls://localhost:" + port)
+	require.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "device1"
+
+	f := flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(packet.NewDisconnect()).
+		End()
+
+	assert.NoError(t, f.Test(conn))
+
+	// mismatching username
+	conn, err = dialer.Dial("tls://localhost:" + port)
+	require.NoError(t, err)
+
+	connect.Username = "device2"
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.NotAuthorized
+
+	f = flow.New().
+		Send(connect).
+		Receive(connack).
+		End()
+
+	assert.NoError(t, f.Test(conn))
+
+	_ = server.Close()
+	engine.Close()
+}
+
+func TestCertAuthenticatorMissingCertificate(t *testing.T) {
+	authenticator := &CertAuthenticator{}
+
+	port, quit, done := broker.Run(broker.NewEngine(broker.NewAuthBackend(broker.NewMemoryBackend(), authenticator)), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.NotAuthorized
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(connack).
+		End()
+
+	assert.NoError(t, f.Test(conn))
+
+	close(quit)
+	safeReceive(done)
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInvalidKeySet is returned if a key set cannot be decoded.
+var ErrInvalidKeySet = errors.New("invalid key set")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// A KeySet fetches and caches the keys of a JSON Web Key Set. The keys are
+// refreshed periodically and when a token references an unknown key ID.
+type KeySet struct {
+	// The URL of the key set.
+	URL string
+
+	// The HTTP client used to fetch the key set.
+	//
+	// Will default to a client with a ten second timeout.
+	Client *http.Client
+
+	// The interval after which the keys are refreshed.
+	//
+	// Will default to one hour.
+	RefreshInterval time.Duration
+
+	// The minimum interval between refreshes triggered by unknown key IDs or
+	// failed attempts.
+	//
+	// Will default to one minute.
+	MinRefreshInterval time.Duration
+
+	keys    map[string][]interface{}
+	fetched time.Time
+	tried   time.Time
+	mutex   sync.Mutex
+}
+
+// NewKeySet returns a new KeySet that fetches the keys from the specified URL.
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		URL: url,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: time.Minute,
+	}
+}
+
+// Keys returns the keys with the specified key ID or all keys if the key ID
+// is empty. Cached keys are used if a refresh fails. An error is only returned
+// if no keys have been fetched yet.
+func (s *KeySet) Keys(kid string) ([]interface{}, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check if a refresh is needed
+	now := time.Now()
+	stale := now.Sub(s.fetched) > s.RefreshInterval
+	unknown := kid != "" && s.keys[kid] == nil
+	throttled := now.Sub(s.tried) < s.MinRefreshInterval
+
+	// refresh keys
+	if s.keys == nil || ((stale || unknown) && !throttled) {
+		s.tried = now
+		err := s.refresh()
+		if err != nil && s.keys == nil {
+			return nil, err
+		} else if err == nil {
+			s.fetched = now
+		}
+	}
+
+	// return all keys
+	if kid == "" {
+		var list []interface{}
+		for _, keys := range s.keys {
+			list = append(list, keys...)
+		}
+		return list, nil
+	}
+
+	return s.keys[kid], nil
+}
+
+func (s *KeySet) refresh() error {
+	// fetch key set
+	res, err := s.Client.Get(s.URL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// check status
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("key set %s responded with status %d", s.URL, res.StatusCode)
+	}
+
+	// read body
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	// parse keys
+	keys, err := ParseKeySet(data)
+	if err != nil {
+		return err
+	}
+
+	// set keys
+	s.keys = keys
+
+	return nil
+}
+
+// ParseKeySet will parse a JSON Web Key Set and return the contained
+// signature verification keys by key ID. Keys of unsupported types are
+// ignored.
+func ParseKeySet(data []byte) (map[string][]interface{}, error) {
+	// decode key set
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(data, &set)
+	if err != nil || set.Keys == nil {
+		return nil, ErrInvalidKeySet
+	}
+
+	// parse keys
+	keys := make(map[string][]interface{})
+	for _, k := range set.Keys {
+		// skip encryption keys
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// parse key
+		key, err := parseKey(k)
+		if err != nil {
+			return nil, err
+		} else if key != nil {
+			keys[k.Kid] = append(keys[k.Kid], key)
+		}
+	}
+
+	return keys, nil
+}
+
+func parseKey(k jwk) (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		// decode parameters
+		n, err1 := decodeInt(k.N)
+		e, err2 := decodeInt(k.E)
+		if err1 != nil || err2 != nil || !e.IsInt64() {
+			return nil, ErrInvalidKeySet
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		// get curve
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+
+		// decode parameters
+		x, err1 := decodeInt(k.X)
+		y, err2 := decodeInt(k.Y)
+		if err1 != nil || err2 != nil || !curve.IsOnCurve(x, y) {
+			return nil, ErrInvalidKeySet
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		// decode key
+		key, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, ErrInvalidKeySet
+		}
+
+		return key, nil
+	}
+
+	return nil, nil
+}
+
+func decodeInt(str string) (*big.Int, error) {
+	// decode bytes
+	data, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, err
+	} else if len(data) == 0 {
+		return nil, ErrInvalidKeySet
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
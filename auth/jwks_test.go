@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestParseKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "r", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "e", "crv": "P-384", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y)},
+			{"kty": "oct", "kid": "o", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "", "e": ""},
+			{"kty": "OKP", "kid": "x"},
+		},
+	})
+	assert.NoError(t, err)
+
+	keys, err := ParseKeySet(data)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]interface{}{
+		"r": {&rsaKey.PublicKey},
+		"e": {&ecKey.PublicKey},
+		"o": {[]byte("secret")},
+	}, keys)
+
+	_, err = ParseKeySet([]byte(`{}`))
+	assert.Equal(t, ErrInvalidKeySet, err)
+
+	_, err = ParseKeySet([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.Equal(t, ErrInvalidKeySet, err)
+}
+
+func TestKeySet(t *testing.T) {
+	var requests int32
+	set := []byte(`{"keys":[{"kty":"oct","kid":"a","k":"YQ"}]}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write(set)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+
+	keys, err := keySet.Keys("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("a")}, keys)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// unknown keys are throttled
+	set = []byte(`{"keys":[{"kty":"oct","kid":"b","k":"Yg"}]}`)
+	keys, err = keySet.Keys("b")
+	assert.NoError(t, err)
+	assert.Nil(t, keys)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// unknown keys trigger a refresh
+	keySet.MinRefreshInterval = 0
+	keys, err = keySet.Keys("b")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("b")}, keys)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// failed refreshes keep cached keys
+	keySet.RefreshInterval = 0
+	keySet.URL = server.URL + "/invalid\x00"
+	time.Sleep(time.Millisecond)
+	keys, err = keySet.Keys("")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("b")}, keys)
+}
+
+func TestKeySetError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+
+	_, err := keySet.Keys("a")
+	assert.Error(t, err)
+}
+
+func TestJWTAuthenticatorKeySet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"oct","kid":"a","k":"YQ"}]}`))
+	}))
+	defer server.Close()
+
+	authenticator := NewJWTAuthenticator()
+	authenticator.KeySet = NewKeySet(server.URL)
+
+	claims := Claims{"exp": numericDate(time.Now().Add(time.Hour))}
+
+	_, err := authenticator.Verify("", sign("HS256", "a", []byte("a"), claims))
+	assert.NoError(t, err)
+
+	_, err = authenticator.Verify("", sign("HS256", "b", []byte("a"), claims))
+	assert.Equal(t, ErrInvalidSignature, err)
+}
@@ -0,0 +1,485 @@
+// Package auth implements authenticators that can be used with the broker's
+// AuthBackend.
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	// register hash functions
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/256dpi/gomqtt/broker"
+)
+
+// ErrMalformedToken is returned if a token cannot be decoded.
+var ErrMalformedToken = errors.New("malformed token")
+
+// ErrUnsupportedAlgorithm is returned if a token uses an unsupported signing
+// algorithm.
+var ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+
+// ErrInvalidSignature is returned if a token could not be verified with any
+// of the available keys.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrExpiredToken is returned if a token has expired or is not yet valid.
+var ErrExpiredToken = errors.New("expired token")
+
+// ErrInvalidClaims is returned if a token is missing required claims or if
+// the claims do not match the configured expectations.
+var ErrInvalidClaims = errors.New("invalid claims")
+
+// Claims are the decoded claims of a token.
+type Claims map[string]interface{}
+
+// String returns the named claim if it is a string.
+func (c Claims) String(name string) string {
+	str, _ := c[name].(string)
+	return str
+}
+
+// Strings returns the named claim as a list if it is a string or a list of
+// strings.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
+
+// Time returns the named claim as a time if it is a numeric date.
+func (c Claims) Time(name string) (time.Time, bool) {
+	value, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(value*float64(time.Second))), true
+}
+
+// A JWTAuthenticator authenticates clients that provide a JSON Web Token as
+// their password. The username is ignored. Like with Google Cloud IoT, tokens
+// may be signed with keys registered for the individual client IDs.
+//
+// The identity of a client is derived from the token's claims. Topic filters
+// may contain placeholders of the form "{name}" that are replaced with the
+// string value of the named claim, or the client ID for "{clientid}". Filters
+// are omitted if a value is missing or contains a slash or wildcard.
+type JWTAuthenticator struct {
+	// The keys used to verify tokens by key ID. Keys are []byte for HMAC,
+	// *rsa.PublicKey for RSA and *ecdsa.PublicKey for ECDSA algorithms. Tokens
+	// without a key ID are verified against all keys.
+	Keys map[string]interface{}
+
+	// The remote key set used to verify tokens.
+	KeySet *KeySet
+
+	// The function called to look up the keys registered for a client ID.
+	ClientKeys func(clientID string) ([]interface{}, error)
+
+	// The required audience if set.
+	Audience string
+
+	// The required issuer if set.
+	Issuer string
+
+	// The claim that must match the client ID if set.
+	ClientIDClaim string
+
+	// The maximum allowed difference between the expiration and issue time
+	// of a token. Google Cloud IoT for example requires 24 hours.
+	//
+	// Will default to no limit.
+	MaxLifetime time.Duration
+
+	// The allowed clock skew when validating times.
+	//
+	// Will default to one minute.
+	Leeway time.Duration
+
+	// The claim used as the identity subject.
+	//
+	// Will default to "sub".
+	SubjectClaim string
+
+	// The claim that lists the groups of the subject if set.
+	GroupsClaim string
+
+	// The claim that lists the filters a client may publish to if set.
+	PublishClaim string
+
+	// The claim that lists the filters a client may subscribe to if set.
+	SubscribeClaim string
+
+	// The filters a client may publish to in addition to the ones provided
+	// by the publish claim. Publishing is not restricted if neither the
+	// filters nor the claim are configured.
+	Publish []string
+
+	// The filters a client may subscribe to in addition to the ones provided
+	// by the subscribe claim. Subscribing is not restricted if neither the
+	// filters nor the claim are configured.
+	Subscribe []string
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+}
+
+// NewJWTAuthenticator returns a new JWTAuthenticator.
+func NewJWTAuthenticator() *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Leeway:       time.Minute,
+		SubjectClaim: "sub",
+		Now:          time.Now,
+	}
+}
+
+// Authenticate implements the broker.Authenticator interface. Invalid tokens
+// are denied while failures to look up keys are returned as errors.
+func (a *JWTAuthenticator) Authenticate(client *broker.Client, _, password string) (*broker.Identity, error) {
+	// verify token
+	claims, err := a.Verify(client.ID(), password)
+	if err == ErrMalformedToken || err == ErrUnsupportedAlgorithm || err == ErrInvalidSignature ||
+		err == ErrExpiredToken || err == ErrInvalidClaims {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// prepare identity
+	identity := &broker.Identity{
+		Subject:    claims.String(a.SubjectClaim),
+		Attributes: claims,
+	}
+
+	// set groups
+	if a.GroupsClaim != "" {
+		identity.Groups = claims.Strings(a.GroupsClaim)
+	}
+
+	// set filters
+	identity.Publish = a.filters(client.ID(), claims, a.Publish, a.PublishClaim)
+	identity.Subscribe = a.filters(client.ID(), claims, a.Subscribe, a.SubscribeClaim)
+
+	return identity, nil
+}
+
+// Verify will verify the token for the specified client ID and return its
+// claims.
+func (a *JWTAuthenticator) Verify(clientID, token string) (Claims, error) {
+	// split token
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	// decode header
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	// decode claims
+	var claims Claims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil || claims == nil {
+		return nil, ErrMalformedToken
+	}
+
+	// decode signature
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	// get hash
+	hash, ok := algorithmHashes[header.Alg]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	// get keys
+	keys, err := a.keys(clientID, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify signature
+	input := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if verify(header.Alg, hash, key, input, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	// validate claims
+	err = a.validate(clientID, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) keys(clientID, kid string) ([]interface{}, error) {
+	var keys []interface{}
+
+	// add static keys
+	for id, key := range a.Keys {
+		if kid == "" || id == kid {
+			keys = append(keys, key)
+		}
+	}
+
+	// add remote keys
+	if a.KeySet != nil {
+		list, err := a.KeySet.Keys(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, list...)
+	}
+
+	// add client keys
+	if a.ClientKeys != nil {
+		list, err := a.ClientKeys(clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, list...)
+	}
+
+	return keys, nil
+}
+
+func (a *JWTAuthenticator) validate(clientID string, claims Claims) error {
+	// get now
+	now := a.Now()
+
+	// check expiration
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return ErrInvalidClaims
+	} else if now.After(exp.Add(a.Leeway)) {
+		return ErrExpiredToken
+	}
+
+	// check not before
+	nbf, ok := claims.Time("nbf")
+	if ok && now.Add(a.Leeway).Before(nbf) {
+		return ErrExpiredToken
+	}
+
+	// check issued at
+	iat, ok := claims.Time("iat")
+	if ok && now.Add(a.Leeway).Before(iat) {
+		return ErrExpiredToken
+	}
+
+	// check lifetime
+	if a.MaxLifetime > 0 && (!ok || exp.Sub(iat) > a.MaxLifetime) {
+		return ErrInvalidClaims
+	}
+
+	// check audience
+	if a.Audience != "" && !contains(claims.Strings("aud"), a.Audience) {
+		return ErrInvalidClaims
+	}
+
+	// check issuer
+	if a.Issuer != "" && claims.String("iss") != a.Issuer {
+		return ErrInvalidClaims
+	}
+
+	// check client id
+	if a.ClientIDClaim != "" && claims.String(a.ClientIDClaim) != clientID {
+		return ErrInvalidClaims
+	}
+
+	return nil
+}
+
+func (a *JWTAuthenticator) filters(clientID string, claims Claims, templates []string, claim string) []string {
+	// check configuration
+	if templates == nil && claim == "" {
+		return nil
+	}
+
+	// prepare list
+	list := make([]string, 0, len(templates))
+
+	// expand templates
+	for _, template := range templates {
+		filter, ok := expand(template, clientID, claims)
+		if ok {
+			list = append(list, filter)
+		}
+	}
+
+	// add claimed filters
+	if claim != "" {
+		list = append(list, claims.Strings(claim)...)
+	}
+
+	return list
+}
+
+func expand(template, clientID string, claims Claims) (string, bool) {
+	var buf bytes.Buffer
+
+	for {
+		// find placeholder
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		// get value
+		name := template[start+1 : end]
+		value := claims.String(name)
+		if name == "clientid" {
+			value = clientID
+		}
+
+		// check value
+		if value == "" || strings.ContainsAny(value, "/+#") {
+			return "", false
+		}
+
+		// write value
+		buf.WriteString(template[:start])
+		buf.WriteString(value)
+		template = template[end+1:]
+	}
+
+	buf.WriteString(template)
+
+	return buf.String(), true
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+var curveSizes = map[string]int{
+	"ES256": 256,
+	"ES384": 384,
+	"ES512": 521,
+}
+
+func verify(alg string, hash crypto.Hash, key interface{}, input, signature []byte) bool {
+	// compute digest
+	hasher := hash.New()
+	hasher.Write(input)
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case []byte:
+		if alg[0] != 'H' {
+			return false
+		}
+
+		mac := hmac.New(hash.New, key)
+		mac.Write(input)
+
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		if alg[0] == 'R' {
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		} else if alg[0] == 'P' {
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+			}) == nil
+		}
+
+		return false
+	case *ecdsa.PublicKey:
+		// check curve
+		if curveSizes[alg] != key.Curve.Params().BitSize {
+			return false
+		}
+
+		// check signature
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		return ecdsa.Verify(key, digest, r, s)
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	// decode base64
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func contains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(alg, kid string, key interface{}, claims Claims) string {
+	// encode header and claims
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	// check key
+	if key == nil {
+		return input + "."
+	}
+
+	// compute digest
+	hash := algorithmHashes[alg]
+	hasher := hash.New()
+	hasher.Write([]byte(input))
+	digest := hasher.Sum(nil)
+
+	// sign input
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, key)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if alg[0] == 'P' {
+			signature, _ = rsa.SignPSS(rand.Reader, key, hash, digest, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+			})
+		} else {
+			signature, _ = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest)
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		copy(signature[size-len(r.Bytes()):size], r.Bytes())
+		copy(signature[2*size-len(s.Bytes()):], s.Bytes())
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func numericDate(t time.Time) float64 {
+	return float64(t.Unix())
+}
+
+func TestJWTAuthenticatorVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	hmacKey := []byte("secret")
+
+	now := time.Now()
+
+	authenticator := NewJWTAuthenticator()
+	authenticator.Keys = map[string]interface{}{
+		"rsa":  &rsaKey.PublicKey,
+		"ec":   &ecKey.PublicKey,
+		"hmac": hmacKey,
+	}
+	authenticator.Audience = "project"
+	authenticator.Now = func() time.Time {
+		return now
+	}
+
+	claims := Claims{
+		"aud": "project",
+		"iat": numericDate(now),
+		"exp": numericDate(now.Add(time.Hour)),
+	}
+
+	for _, item := range []struct {
+		alg string
+		kid string
+		key interface{}
+	}{
+		{"RS256", "rsa", rsaKey},
+		{"RS512", "", rsaKey},
+		{"PS256", "rsa", rsaKey},
+		{"ES256", "ec", ecKey},
+		{"ES256", "", ecKey},
+		{"HS256", "hmac", hmacKey},
+	} {
+		verified, err := authenticator.Verify("", sign(item.alg, item.kid, item.key, claims))
+		assert.NoError(t, err, item.alg)
+		assert.Equal(t, "project", verified.String("aud"))
+	}
+
+	// wrong key
+	_, err = authenticator.Verify("", sign("RS256", "ec", rsaKey, claims))
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	// wrong curve
+	_, err = authenticator.Verify("", sign("ES384", "ec", ecKey, claims))
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	// unsigned
+	_, err = authenticator.Verify("", sign("none", "", nil, claims))
+	assert.Equal(t, ErrUnsupportedAlgorithm, err)
+
+	// malformed
+	_, err = authenticator.Verify("", "foo.bar")
+	assert.Equal(t, ErrMalformedToken, err)
+
+	// expired
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, Claims{
+		"aud": "project",
+		"exp": numericDate(now.Add(-2 * time.Minute)),
+	}))
+	assert.Equal(t, ErrExpiredToken, err)
+
+	// expired within leeway
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, Claims{
+		"aud": "project",
+		"exp": numericDate(now.Add(-30 * time.Second)),
+	}))
+	assert.NoError(t, err)
+
+	// not yet valid
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, Claims{
+		"aud": "project",
+		"nbf": numericDate(now.Add(time.Hour)),
+		"exp": numericDate(now.Add(2 * time.Hour)),
+	}))
+	assert.Equal(t, ErrExpiredToken, err)
+
+	// missing expiration
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, Claims{
+		"aud": "project",
+	}))
+	assert.Equal(t, ErrInvalidClaims, err)
+
+	// wrong audience
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, Claims{
+		"aud": []string{"other"},
+		"exp": numericDate(now.Add(time.Hour)),
+	}))
+	assert.Equal(t, ErrInvalidClaims, err)
+
+	// lifetime too long
+	authenticator.MaxLifetime = 30 * time.Minute
+	_, err = authenticator.Verify("", sign("HS256", "hmac", hmacKey, claims))
+	assert.Equal(t, ErrInvalidClaims, err)
+}
+
+func TestJWTAuthenticatorClientKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	authenticator := NewJWTAuthenticator()
+	authenticator.ClientKeys = func(clientID string) ([]interface{}, error) {
+		if clientID == "device1" {
+			return []interface{}{&key.PublicKey}, nil
+		}
+
+		return nil, nil
+	}
+	authenticator.ClientIDClaim = "device"
+	authenticator.PublishClaim = "pub"
+	authenticator.Publish = []string{"devices/{clientid}/events", "groups/{group}/events"}
+	authenticator.Subscribe = []string{"devices/{clientid}/#"}
+
+	b := testutil.NewBroker(broker.NewAuthBackend(broker.NewMemoryBackend(), authenticator), nil)
+	defer b.Close()
+
+	token := sign("ES256", "", key, Claims{
+		"sub":    "sensor",
+		"device": "device1",
+		"group":  "hall",
+		"pub":    []string{"shared/#"},
+		"exp":    numericDate(time.Now().Add(time.Hour)),
+	})
+
+	// other client
+	config := b.Config("device2")
+	config.BrokerURL = "tcp://device:" + token + "@testutil"
+	_, err = b.Connect(config)
+	assert.Error(t, err)
+
+	// authorized client
+	received := make(chan *packet.Message, 1)
+
+	config = b.Config("device1")
+	config.BrokerURL = "tcp://device:" + token + "@testutil"
+	c, err := b.Connect(config)
+	assert.NoError(t, err)
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		if err == nil {
+			received <- msg
+		}
+
+		return nil
+	}
+
+	sf, err := c.Subscribe("devices/device1/#", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
+
+	for _, topic := range []string{"devices/device1/state", "devices/device1/events"} {
+		pf, err := c.Publish(topic, nil, 0, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(time.Second))
+	}
+
+	// only the publish to the own topic is forwarded
+	msg := <-received
+	assert.Equal(t, "devices/device1/events", msg.Topic)
+
+	select {
+	case <-received:
+		t.Fatal("unexpected message")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// subscriptions outside the scope are rejected
+	sf, err = c.Subscribe("#", 0)
+	assert.NoError(t, err)
+	assert.Error(t, sf.Wait(time.Second))
+}
+
+func TestJWTAuthenticatorFilters(t *testing.T) {
+	authenticator := NewJWTAuthenticator()
+
+	claims := Claims{
+		"sub":   "user",
+		"group": "a/b",
+		"pub":   []interface{}{"foo/#", 1},
+	}
+
+	assert.Nil(t, authenticator.filters("c1", claims, nil, ""))
+	assert.Equal(t, []string{}, authenticator.filters("c1", claims, []string{"groups/{group}"}, ""))
+	assert.Equal(t, []string{"users/user/c1", "foo/#"}, authenticator.filters("c1", claims, []string{
+		"users/{sub}/{clientid}",
+		"groups/{group}",
+		"missing/{missing}",
+	}, "pub"))
+	assert.Equal(t, []string{}, authenticator.filters("+", claims, []string{"{clientid}"}, ""))
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims{
+		"str":  "foo",
+		"list": []interface{}{"foo", 1.0, "bar"},
+		"num":  1.5,
+	}
+
+	assert.Equal(t, "foo", claims.String("str"))
+	assert.Equal(t, "", claims.String("num"))
+	assert.Equal(t, []string{"foo"}, claims.Strings("str"))
+	assert.Equal(t, []string{"foo", "bar"}, claims.Strings("list"))
+	assert.Nil(t, claims.Strings("num"))
+
+	tm, ok := claims.Time("num")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1, 500000000), tm)
+
+	_, ok = claims.Time("str")
+	assert.False(t, ok)
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+)
+
+// ErrInvalidCredentials should be returned by LDAPConn.Bind if the server
+// rejected the credentials.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// An LDAPConn is a connection to an LDAP server or Active Directory. It is
+// typically implemented using an LDAP client library.
+type LDAPConn interface {
+	// Bind should authenticate the connection using the specified DN and
+	// password. ErrInvalidCredentials should be returned if the server
+	// rejected the credentials.
+	Bind(dn, password string) error
+
+	// Search should perform a subtree search below the base and return the
+	// values of the attribute of all matching entries.
+	Search(base, filter, attribute string) ([]string, error)
+
+	// Close should close the connection.
+	Close() error
+}
+
+type ldapEntry struct {
+	hash     [sha256.Size]byte
+	identity *broker.Identity
+	expires  time.Time
+}
+
+// An LDAPAuthenticator authenticates clients by binding to an LDAP server with
+// the username and password and looking up the groups of the user. The
+// connections are pooled and successful authentications are cached.
+//
+// The templates may contain the placeholders "{user}" and "{dn}", that are
+// replaced with the escaped username and user DN. Filters in scopes may contain
+// the placeholders "{user}" and "{clientid}", and are omitted if a value
+// contains a slash or wildcard.
+type LDAPAuthenticator struct {
+	// The function used to open new connections.
+	Dial func() (LDAPConn, error)
+
+	// The template for the DN used to bind, e.g. "uid={user},ou=people,
+	// dc=example,dc=com" or "{user}@example.com" for Active Directory.
+	UserDN string
+
+	// The base DN used to search groups.
+	GroupBase string
+
+	// The template for the filter used to search groups, e.g.
+	// "(&(objectClass=groupOfNames)(member={dn}))". Groups are not looked up
+	// if the filter is empty.
+	GroupFilter string
+
+	// The attribute that holds the group name.
+	//
+	// Will default to "cn".
+	GroupAttribute string
+
+	// The groups of which a user must be a member of at least one if set.
+	RequiredGroups []string
+
+	// The scopes granted to the members of the groups. Publishing and
+	// subscribing is not restricted if no scopes are configured.
+	Scopes map[string]Scope
+
+	// The maximum number of idle connections kept in the pool.
+	//
+	// Will default to 4.
+	PoolSize int
+
+	// The duration successful authentications are cached. Caching is
+	// disabled if the duration is negative.
+	//
+	// Will default to five minutes.
+	CacheTTL time.Duration
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+
+	pool  chan LDAPConn
+	cache map[string]ldapEntry
+	once  sync.Once
+	mutex sync.Mutex
+}
+
+// NewLDAPAuthenticator returns a new LDAPAuthenticator that uses the specified
+// function to open connections.
+func NewLDAPAuthenticator(dial func() (LDAPConn, error), userDN string) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		Dial:           dial,
+		UserDN:         userDN,
+		GroupAttribute: "cn",
+		PoolSize:       4,
+		CacheTTL:       5 * time.Minute,
+		Now:            time.Now,
+	}
+}
+
+// Authenticate implements the broker.Authenticator interface. Rejected
+// credentials are denied while connection and search failures are returned as
+// errors.
+func (a *LDAPAuthenticator) Authenticate(client *broker.Client, user, password string) (*broker.Identity, error) {
+	// prepare pool and cache
+	a.once.Do(a.prepare)
+
+	// deny anonymous and unauthenticated binds
+	if user == "" || password == "" {
+		return nil, nil
+	}
+
+	// check cache
+	hash := sha256.Sum256([]byte(user + "\x00" + password))
+	identity := a.cached(user, hash)
+
+	// perform lookup
+	if identity == nil {
+		var err error
+		identity, err = a.lookup(user, password)
+		if err != nil || identity == nil {
+			return nil, err
+		}
+
+		a.store(user, hash, identity)
+	}
+
+	// apply scopes
+	applyScopes(identity, a.Scopes, identity.Groups, client.ID(), user)
+
+	return identity, nil
+}
+
+func (a *LDAPAuthenticator) prepare() {
+	a.pool = make(chan LDAPConn, a.PoolSize)
+	a.cache = make(map[string]ldapEntry)
+}
+
+func (a *LDAPAuthenticator) lookup(user, password string) (*broker.Identity, error) {
+	// get connection
+	conn, err := a.get()
+	if err != nil {
+		return nil, err
+	}
+
+	// bind user
+	dn := strings.Replace(a.UserDN, "{user}", EscapeDN(user), -1)
+	err = conn.Bind(dn, password)
+	if err == ErrInvalidCredentials {
+		a.put(conn)
+		return nil, nil
+	} else if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	// prepare identity
+	identity := &broker.Identity{
+		Subject: user,
+		Attributes: map[string]interface{}{
+			"dn": dn,
+		},
+	}
+
+	// search groups
+	if a.GroupFilter != "" {
+		filter := strings.NewReplacer("{user}", EscapeFilter(user), "{dn}", EscapeFilter(dn)).Replace(a.GroupFilter)
+		identity.Groups, err = conn.Search(a.GroupBase, filter, a.GroupAttribute)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	// return connection
+	a.put(conn)
+
+	// check required groups
+	if len(a.RequiredGroups) > 0 {
+		member := false
+		for _, group := range a.RequiredGroups {
+			if contains(identity.Groups, group) {
+				member = true
+				break
+			}
+		}
+		if !member {
+			return nil, nil
+		}
+	}
+
+	return identity, nil
+}
+
+func (a *LDAPAuthenticator) cached(user string, hash [sha256.Size]byte) *broker.Identity {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// get entry
+	entry, ok := a.cache[user]
+	if !ok || entry.hash != hash {
+		return nil
+	}
+
+	// check expiry
+	if a.Now().After(entry.expires) {
+		delete(a.cache, user)
+		return nil
+	}
+
+	// copy identity as the scope depends on the client
+	identity := *entry.identity
+
+	return &identity
+}
+
+func (a *LDAPAuthenticator) store(user string, hash [sha256.Size]byte, identity *broker.Identity) {
+	// check ttl
+	if a.CacheTTL < 0 {
+		return
+	}
+
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// remove expired entries
+	now := a.Now()
+	for key, entry := range a.cache {
+		if now.After(entry.expires) {
+			delete(a.cache, key)
+		}
+	}
+
+	// copy identity
+	copied := *identity
+
+	// store entry
+	a.cache[user] = ldapEntry{
+		hash:     hash,
+		identity: &copied,
+		expires:  now.Add(a.CacheTTL),
+	}
+}
+
+func (a *LDAPAuthenticator) get() (LDAPConn, error) {
+	// get idle connection
+	select {
+	case conn := <-a.pool:
+		return conn, nil
+	default:
+	}
+
+	// open connection
+	conn, err := a.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %s", err)
+	}
+
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) put(conn LDAPConn) {
+	// return connection or close it if the pool is full
+	select {
+	case a.pool <- conn:
+	default:
+		_ = conn.Close()
+	}
+}
+
+// Close will close all idle connections.
+func (a *LDAPAuthenticator) Close() {
+	// prepare pool
+	a.once.Do(a.prepare)
+
+	// close idle connections
+	for {
+		select {
+		case conn := <-a.pool:
+			_ = conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// EscapeDN will escape the value for use as an attribute value in a
+// distinguished name as described in RFC 4514.
+func EscapeDN(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';' || c == '=':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case (c == ' ' || c == '#') && i == 0, c == ' ' && i == len(value)-1:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == 0:
+			buf.WriteString(`\00`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
+
+// EscapeFilter will escape the value for use in a search filter as described
+// in RFC 4515.
+func EscapeFilter(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&buf, `\%02x`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
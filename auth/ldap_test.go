@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDirectory struct {
+	users   map[string]string
+	groups  map[string][]string
+	dials   int
+	binds   int
+	closed  int
+	filters []string
+	err     error
+}
+
+type testLDAPConn struct {
+	dir *testDirectory
+	dn  string
+}
+
+func (c *testLDAPConn) Bind(dn, password string) error {
+	c.dir.binds++
+
+	if c.dir.err != nil {
+		return c.dir.err
+	}
+
+	if pw, ok := c.dir.users[dn]; !ok || pw != password {
+		return ErrInvalidCredentials
+	}
+
+	c.dn = dn
+
+	return nil
+}
+
+func (c *testLDAPConn) Search(base, filter, attribute string) ([]string, error) {
+	c.dir.filters = append(c.dir.filters, base+" "+filter+" "+attribute)
+	return c.dir.groups[c.dn], nil
+}
+
+func (c *testLDAPConn) Close() error {
+	c.dir.closed++
+	return nil
+}
+
+func (d *testDirectory) dial() (LDAPConn, error) {
+	d.dials++
+	return &testLDAPConn{dir: d}, nil
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	dir := &testDirectory{
+		users: map[string]string{
+			"uid=alice,ou=people": "secret",
+			"uid=bob,ou=people":   "secret",
+		},
+		groups: map[string][]string{
+			"uid=alice,ou=people": {"operators"},
+			"uid=bob,ou=people":   {"guests"},
+		},
+	}
+
+	now := time.Now()
+
+	authenticator := NewLDAPAuthenticator(dir.dial, "uid={user},ou=people")
+	authenticator.GroupBase = "ou=groups"
+	authenticator.GroupFilter = "(member={dn})"
+	authenticator.RequiredGroups = []string{"operators", "devices"}
+	authenticator.Scopes = map[string]Scope{
+		"operators": {
+			Publish:   []string{"plants/+/commands", "users/{user}/#"},
+			Subscribe: []string{"plants/#"},
+		},
+	}
+	authenticator.Now = func() time.Time {
+		return now
+	}
+
+	client := &broker.Client{}
+
+	// successful authentication
+	identity, err := authenticator.Authenticate(client, "alice", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, &broker.Identity{
+		Subject:    "alice",
+		Groups:     []string{"operators"},
+		Attributes: map[string]interface{}{"dn": "uid=alice,ou=people"},
+		Publish:    []string{"plants/+/commands", "users/alice/#"},
+		Subscribe:  []string{"plants/#"},
+	}, identity)
+	assert.Equal(t, []string{"ou=groups (member=uid=alice,ou=people) cn"}, dir.filters)
+	assert.Equal(t, 1, dir.dials)
+	assert.Equal(t, 1, dir.binds)
+
+	// cached authentication
+	identity2, err := authenticator.Authenticate(client, "alice", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, identity, identity2)
+	assert.Equal(t, 1, dir.binds)
+
+	// cache is bypassed for other passwords
+	identity, err = authenticator.Authenticate(client, "alice", "wrong")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+	assert.Equal(t, 2, dir.binds)
+
+	// cache expires
+	now = now.Add(10 * time.Minute)
+	identity, err = authenticator.Authenticate(client, "alice", "secret")
+	assert.NoError(t, err)
+	assert.NotNil(t, identity)
+	assert.Equal(t, 3, dir.binds)
+
+	// connections are reused
+	assert.Equal(t, 1, dir.dials)
+
+	// missing group
+	identity, err = authenticator.Authenticate(client, "bob", "secret")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// unauthenticated bind
+	identity, err = authenticator.Authenticate(client, "alice", "")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+	assert.Equal(t, 4, dir.binds)
+
+	// server failure
+	dir.err = errors.New("failed")
+	identity, err = authenticator.Authenticate(client, "bob", "other")
+	assert.Equal(t, dir.err, err)
+	assert.Nil(t, identity)
+	assert.Equal(t, 1, dir.closed)
+
+	authenticator.Close()
+}
+
+func TestEscapeDN(t *testing.T) {
+	assert.Equal(t, "alice", EscapeDN("alice"))
+	assert.Equal(t, `a\,b\=c\+d\"e\\f\<g\>h\;i`, EscapeDN(`a,b=c+d"e\f<g>h;i`))
+	assert.Equal(t, `\#a b\ `, EscapeDN("#a b "))
+	assert.Equal(t, `\ a\00`, EscapeDN(" a\x00"))
+}
+
+func TestEscapeFilter(t *testing.T) {
+	assert.Equal(t, "alice", EscapeFilter("alice"))
+	assert.Equal(t, `\2a\28\29\5c\00`, EscapeFilter("*()\\\x00"))
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+)
+
+type introspectionEntry struct {
+	claims  Claims
+	expires time.Time
+}
+
+// An IntrospectionAuthenticator authenticates clients that provide an OAuth2
+// bearer token as their password by querying a token introspection endpoint
+// as described in RFC 7662. The username is ignored. Active tokens are cached
+// until they expire or the cache duration is reached.
+//
+// The subject of the identity is the "sub" or "username" of the token and the
+// attributes are set to the introspection response.
+type IntrospectionAuthenticator struct {
+	// The URL of the introspection endpoint.
+	URL string
+
+	// The client credentials used to authenticate with the endpoint.
+	ClientID     string
+	ClientSecret string
+
+	// The HTTP client used to perform the requests.
+	//
+	// Will default to a client with a ten second timeout.
+	Client *http.Client
+
+	// The audience a token must be issued for if set.
+	Audience string
+
+	// The OAuth2 scopes a token must include if set.
+	RequiredScopes []string
+
+	// The topic scopes granted for the OAuth2 scopes of a token. Publishing
+	// and subscribing is not restricted if no scopes are configured.
+	Scopes map[string]Scope
+
+	// The maximum duration an introspection result is cached. Caching is
+	// disabled if the duration is negative.
+	//
+	// Will default to one minute.
+	CacheTTL time.Duration
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+
+	cache map[[sha256.Size]byte]introspectionEntry
+	mutex sync.Mutex
+}
+
+// NewIntrospectionAuthenticator returns a new IntrospectionAuthenticator that
+// uses the specified endpoint and client credentials.
+func NewIntrospectionAuthenticator(url, clientID, clientSecret string) *IntrospectionAuthenticator {
+	return &IntrospectionAuthenticator{
+		URL:          url,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		CacheTTL: time.Minute,
+		Now:      time.Now,
+	}
+}
+
+// Authenticate implements the broker.Authenticator interface. Inactive tokens
+// are denied while failed introspection requests are returned as errors.
+func (a *IntrospectionAuthenticator) Authenticate(client *broker.Client, _, password string) (*broker.Identity, error) {
+	// check token
+	if password == "" {
+		return nil, nil
+	}
+
+	// get claims
+	claims, err := a.Introspect(password)
+	if err != nil || claims == nil {
+		return nil, err
+	}
+
+	// check audience
+	if a.Audience != "" && !contains(claims.Strings("aud"), a.Audience) {
+		return nil, nil
+	}
+
+	// check required scopes
+	scopes := strings.Fields(claims.String("scope"))
+	for _, scope := range a.RequiredScopes {
+		if !contains(scopes, scope) {
+			return nil, nil
+		}
+	}
+
+	// get subject
+	subject := claims.String("sub")
+	if subject == "" {
+		subject = claims.String("username")
+	}
+
+	// prepare identity
+	identity := &broker.Identity{
+		Subject:    subject,
+		Attributes: claims,
+	}
+
+	// apply scopes
+	applyScopes(identity, a.Scopes, scopes, client.ID(), subject)
+
+	return identity, nil
+}
+
+// Introspect will return the introspection response for the token or nil if
+// the token is not active.
+func (a *IntrospectionAuthenticator) Introspect(token string) (Claims, error) {
+	// check cache
+	hash := sha256.Sum256([]byte(token))
+	claims := a.cached(hash)
+	if claims != nil {
+		return claims, nil
+	}
+
+	// prepare request
+	form := url.Values{
+		"token":           []string{token},
+		"token_type_hint": []string{"access_token"},
+	}
+	req, err := http.NewRequest("POST", a.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	// set headers
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+
+	// perform request
+	res, err := a.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// check status
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection %s responded with status %d", a.URL, res.StatusCode)
+	}
+
+	// decode response
+	err = json.NewDecoder(res.Body).Decode(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// check activity
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+
+	// check expiration
+	exp, ok := claims.Time("exp")
+	if ok && !a.Now().Before(exp) {
+		return nil, nil
+	}
+
+	// cache claims
+	a.store(hash, claims, exp)
+
+	return claims, nil
+}
+
+func (a *IntrospectionAuthenticator) cached(hash [sha256.Size]byte) Claims {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// get entry
+	entry, ok := a.cache[hash]
+	if !ok {
+		return nil
+	}
+
+	// check expiry
+	if !a.Now().Before(entry.expires) {
+		delete(a.cache, hash)
+		return nil
+	}
+
+	return entry.claims
+}
+
+func (a *IntrospectionAuthenticator) store(hash [sha256.Size]byte, claims Claims, exp time.Time) {
+	// check ttl
+	if a.CacheTTL < 0 {
+		return
+	}
+
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// prepare cache
+	if a.cache == nil {
+		a.cache = make(map[[sha256.Size]byte]introspectionEntry)
+	}
+
+	// remove expired entries
+	now := a.Now()
+	for key, entry := range a.cache {
+		if !now.Before(entry.expires) {
+			delete(a.cache, key)
+		}
+	}
+
+	// get expiry
+	expires := now.Add(a.CacheTTL)
+	if !exp.IsZero() && exp.Before(expires) {
+		expires = exp
+	}
+
+	// store entry
+	a.cache[hash] = introspectionEntry{
+		claims:  claims,
+		expires: expires,
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntrospectionAuthenticator(t *testing.T) {
+	var requests int32
+
+	now := time.Now()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		id, secret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "broker", id)
+		assert.Equal(t, "secret", secret)
+		assert.Equal(t, "access_token", r.FormValue("token_type_hint"))
+
+		var res map[string]interface{}
+		switch r.FormValue("token") {
+		case "valid":
+			res = map[string]interface{}{
+				"active":   true,
+				"scope":    "mqtt telemetry:write",
+				"username": "device1",
+				"aud":      []string{"broker", "other"},
+				"exp":      now.Add(time.Hour).Unix(),
+			}
+		case "scopeless":
+			res = map[string]interface{}{
+				"active": true,
+				"sub":    "device2",
+				"aud":    "broker",
+			}
+		case "expired":
+			res = map[string]interface{}{
+				"active": true,
+				"aud":    "broker",
+				"scope":  "mqtt",
+				"exp":    now.Add(-time.Second).Unix(),
+			}
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		default:
+			res = map[string]interface{}{
+				"active": false,
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	authenticator := NewIntrospectionAuthenticator(server.URL, "broker", "secret")
+	authenticator.Audience = "broker"
+	authenticator.RequiredScopes = []string{"mqtt"}
+	authenticator.Scopes = map[string]Scope{
+		"telemetry:write": {
+			Publish: []string{"telemetry/{user}/#"},
+		},
+	}
+	authenticator.Now = func() time.Time {
+		return now
+	}
+
+	client := &broker.Client{}
+
+	identity, err := authenticator.Authenticate(client, "", "valid")
+	assert.NoError(t, err)
+	assert.Equal(t, "device1", identity.Subject)
+	assert.Equal(t, []string{"telemetry/device1/#"}, identity.Publish)
+	assert.Equal(t, []string{}, identity.Subscribe)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// cached result
+	identity, err = authenticator.Authenticate(client, "", "valid")
+	assert.NoError(t, err)
+	assert.NotNil(t, identity)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// missing scope
+	identity, err = authenticator.Authenticate(client, "", "scopeless")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// expired token
+	identity, err = authenticator.Authenticate(client, "", "expired")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// inactive token
+	identity, err = authenticator.Authenticate(client, "", "invalid")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// missing token
+	identity, err = authenticator.Authenticate(client, "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// failed request
+	identity, err = authenticator.Authenticate(client, "", "error")
+	assert.Error(t, err)
+	assert.Nil(t, identity)
+
+	// cache expires
+	now = now.Add(2 * time.Minute)
+	atomic.StoreInt32(&requests, 0)
+	identity, err = authenticator.Authenticate(client, "", "valid")
+	assert.NoError(t, err)
+	assert.NotNil(t, identity)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// without required scopes
+	authenticator.RequiredScopes = nil
+	identity, err = authenticator.Authenticate(client, "", "scopeless")
+	assert.NoError(t, err)
+	assert.Equal(t, "device2", identity.Subject)
+	assert.Equal(t, []string{}, identity.Publish)
+}
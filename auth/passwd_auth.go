@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+)
+
+// ErrInvalidPasswordFile is returned by the PasswordFileAuthenticator if the
+// password file contains a malformed line or an unsupported hash.
+var ErrInvalidPasswordFile = errors.New("invalid password file")
+
+// passwordIterations is the number of PBKDF2 iterations used by HashPassword,
+// which matches the default of mosquitto_passwd.
+const passwordIterations = 101
+
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	hash       []byte
+}
+
+func (h passwordHash) verify(password string) bool {
+	// compute hash
+	var sum []byte
+	if h.iterations == 0 {
+		digest := sha512.New()
+		digest.Write([]byte(password))
+		digest.Write(h.salt)
+		sum = digest.Sum(nil)
+	} else {
+		sum = pbkdf2([]byte(password), h.salt, h.iterations, len(h.hash))
+	}
+
+	return subtle.ConstantTimeCompare(sum, h.hash) == 1
+}
+
+// A PasswordFileAuthenticator authenticates clients using a password file in
+// the format of mosquitto_passwd. Each line holds a username and a hash
+// separated by a colon. Hashes of type 6 (salted SHA-512) and type 7
+// (PBKDF2-SHA512) are supported. Empty lines and lines starting with a hash
+// sign are ignored. The file is reloaded when it has been modified.
+type PasswordFileAuthenticator struct {
+	// The interval in which the file is checked for modifications.
+	//
+	// Will default to 5 seconds.
+	ReloadInterval time.Duration
+
+	// The Lookup callback may be set to map an authenticated user to an
+	// identity. Returning nil rejects the client.
+	//
+	// Will default to an unrestricted identity with the user as subject.
+	Lookup func(user string) (*broker.Identity, error)
+
+	file   watchedFile
+	hashes map[string]passwordHash
+	mutex  sync.Mutex
+}
+
+// NewPasswordFileAuthenticator returns a new PasswordFileAuthenticator that
+// loads the password file at the specified path.
+func NewPasswordFileAuthenticator(path string) (*PasswordFileAuthenticator, error) {
+	// create authenticator
+	authenticator := &PasswordFileAuthenticator{
+		ReloadInterval: 5 * time.Second,
+		file:           watchedFile{path: path},
+	}
+
+	// load file
+	err := authenticator.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return authenticator, nil
+}
+
+// Reload will immediately reload the password file. The previously loaded
+// hashes are kept if the file cannot be loaded.
+func (a *PasswordFileAuthenticator) Reload() error {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.load()
+}
+
+// Authenticate implements the broker.Authenticator interface.
+func (a *PasswordFileAuthenticator) Authenticate(_ *broker.Client, user, password string) (*broker.Identity, error) {
+	// acquire mutex
+	a.mutex.Lock()
+
+	// reload modified file, errors are ignored to keep the loaded hashes
+	interval := a.ReloadInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	if a.file.changed(interval) {
+		_ = a.load()
+	}
+
+	// get hash
+	hash, ok := a.hashes[user]
+
+	// release mutex
+	a.mutex.Unlock()
+
+	// verify password
+	if !ok || !hash.verify(password) {
+		return nil, nil
+	}
+
+	// lookup identity
+	if a.Lookup != nil {
+		return a.Lookup(user)
+	}
+
+	return &broker.Identity{
+		Subject: user,
+	}, nil
+}
+
+func (a *PasswordFileAuthenticator) load() error {
+	// read file
+	data, err := a.file.read()
+	if err != nil {
+		return err
+	}
+
+	// parse file
+	hashes, err := parsePasswordFile(data)
+	if err != nil {
+		return err
+	}
+
+	// set hashes
+	a.hashes = hashes
+
+	return nil
+}
+
+func parsePasswordFile(data []byte) (map[string]passwordHash, error) {
+	// prepare hashes
+	hashes := make(map[string]passwordHash)
+
+	// parse lines
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// skip empty lines and comments
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// split user and hash
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, ErrInvalidPasswordFile
+		}
+
+		// parse hash
+		hash, err := parsePasswordHash(line[i+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[line[:i]] = hash
+	}
+
+	// check error
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+func parsePasswordHash(str string) (passwordHash, error) {
+	// split hash
+	parts := strings.Split(str, "$")
+
+	// get iterations
+	var hash passwordHash
+	var salt, sum string
+	switch {
+	case len(parts) == 4 && parts[0] == "" && parts[1] == "6":
+		salt, sum = parts[2], parts[3]
+	case len(parts) == 5 && parts[0] == "" && parts[1] == "7":
+		iterations, err := strconv.Atoi(parts[2])
+		if err != nil || iterations <= 0 {
+			return hash, ErrInvalidPasswordFile
+		}
+		hash.iterations = iterations
+		salt, sum = parts[3], parts[4]
+	default:
+		return hash, ErrInvalidPasswordFile
+	}
+
+	// decode salt and hash
+	var err error
+	hash.salt, err = base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return hash, ErrInvalidPasswordFile
+	}
+	hash.hash, err = base64.StdEncoding.DecodeString(sum)
+	if err != nil || len(hash.hash) == 0 {
+		return hash, ErrInvalidPasswordFile
+	}
+
+	return hash, nil
+}
+
+// HashPassword returns a type 7 hash of the password that can be used in a
+// password file, e.g. by writing a line like "user:" + hash.
+func HashPassword(password string) (string, error) {
+	// generate salt
+	salt := make([]byte, 12)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	// derive key
+	sum := pbkdf2([]byte(password), salt, passwordIterations, sha512.Size)
+
+	return "$7$" + strconv.Itoa(passwordIterations) + "$" + base64.StdEncoding.EncodeToString(salt) + "$" + base64.StdEncoding.EncodeToString(sum), nil
+}
+
+// pbkdf2 derives a key of the specified length from the password using
+// PBKDF2 with HMAC-SHA512 as defined in RFC 8018.
+func pbkdf2(password, salt []byte, iterations, length int) []byte {
+	// prepare mac
+	mac := hmac.New(sha512.New, password)
+
+	// derive blocks
+	key := make([]byte, 0, length+sha512.Size)
+	block := make([]byte, sha512.Size)
+	for i := uint32(1); len(key) < length; i++ {
+		// compute first round
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+		sum := mac.Sum(block[:0])
+
+		// xor remaining rounds
+		result := append([]byte(nil), sum...)
+		for j := 1; j < iterations; j++ {
+			mac.Reset()
+			mac.Write(sum)
+			sum = mac.Sum(block[:0])
+			for k := range result {
+				result[k] ^= sum[k]
+			}
+		}
+
+		key = append(key, result...)
+	}
+
+	return key[:length]
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordFileAuthenticator(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "passwd")
+
+	// type 7 hash
+	hash7, err := HashPassword("secret1")
+	require.NoError(t, err)
+
+	// type 6 hash
+	salt := []byte("salt")
+	sum := sha512.Sum512(append([]byte("secret2"), salt...))
+	hash6 := "$6$" + base64.StdEncoding.EncodeToString(salt) + "$" + base64.StdEncoding.EncodeToString(sum[:])
+
+	err = os.WriteFile(path, []byte("# users\nalice:"+hash7+"\n\nbob:"+hash6+"\n"), 0600)
+	require.NoError(t, err)
+
+	authenticator, err := NewPasswordFileAuthenticator(path)
+	require.NoError(t, err)
+	authenticator.ReloadInterval = time.Millisecond
+
+	identity, err := authenticator.Authenticate(nil, "alice", "secret1")
+	assert.NoError(t, err)
+	assert.Equal(t, &broker.Identity{Subject: "alice"}, identity)
+
+	identity, err = authenticator.Authenticate(nil, "bob", "secret2")
+	assert.NoError(t, err)
+	assert.Equal(t, &broker.Identity{Subject: "bob"}, identity)
+
+	identity, err = authenticator.Authenticate(nil, "alice", "secret2")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	identity, err = authenticator.Authenticate(nil, "carol", "secret1")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// hot reload
+	err = os.WriteFile(path, []byte("carol:"+hash7+"\n"), 0600)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+
+	identity, err = authenticator.Authenticate(nil, "carol", "secret1")
+	assert.NoError(t, err)
+	assert.Equal(t, &broker.Identity{Subject: "carol"}, identity)
+
+	identity, err = authenticator.Authenticate(nil, "alice", "secret1")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	// invalid file keeps hashes
+	err = os.WriteFile(path, []byte("dave:secret\n"), 0600)
+	require.NoError(t, err)
+
+	err = authenticator.Reload()
+	assert.Equal(t, ErrInvalidPasswordFile, err)
+
+	identity, err = authenticator.Authenticate(nil, "carol", "secret1")
+	assert.NoError(t, err)
+	assert.Equal(t, &broker.Identity{Subject: "carol"}, identity)
+
+	_, err = NewPasswordFileAuthenticator(path)
+	assert.Equal(t, ErrInvalidPasswordFile, err)
+}
+
+func TestPBKDF2(t *testing.T) {
+	key := pbkdf2([]byte("password"), []byte("salt"), 1, 64)
+	assert.Equal(t, "867f70cf1ade02cff3752599a3a53dc4af34c7a669815ae5d513554e1c8cf252c02d470a285a0501bad999bfe943c08f050235d7d68b1da55e63f73b60a57fce", hex.EncodeToString(key))
+
+	key = pbkdf2([]byte("passwordPASSWORDpassword"), []byte("saltSALTsaltSALTsaltSALTsaltSALTsalt"), 4096, 100)
+	assert.Equal(t, "8c0511f4c6e597c6ac6315d8f0362e225f3c501495ba23b868c005174dc4ee71115b59f9e60cd9532fa33e0f75aefe30225c583a186cd82bd4daea9724a3d3b804f75bdd41494fa324cab24bcc680fb3b96a30cf5d21fac3c2875913919f3399b1d9ce7e", hex.EncodeToString(key))
+}
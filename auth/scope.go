@@ -0,0 +1,39 @@
+package auth
+
+import "github.com/256dpi/gomqtt/broker"
+
+// A Scope lists the filters a client may publish and subscribe to.
+type Scope struct {
+	Publish   []string
+	Subscribe []string
+}
+
+// applyScopes sets the filters of the identity to the union of the scopes
+// with the specified names. The identity is not restricted if no scopes are
+// configured.
+func applyScopes(identity *broker.Identity, scopes map[string]Scope, names []string, clientID, user string) {
+	// check scopes
+	if len(scopes) == 0 {
+		return
+	}
+
+	// prepare values
+	values := Claims{"user": user}
+
+	// collect filters
+	identity.Publish = []string{}
+	identity.Subscribe = []string{}
+	for _, name := range names {
+		scope := scopes[name]
+		for _, template := range scope.Publish {
+			if filter, ok := expand(template, clientID, values); ok {
+				identity.Publish = append(identity.Publish, filter)
+			}
+		}
+		for _, template := range scope.Subscribe {
+			if filter, ok := expand(template, clientID, values); ok {
+				identity.Subscribe = append(identity.Subscribe, filter)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"os"
+	"time"
+)
+
+// watchedFile tracks the modifications of a file that is checked at most once
+// per interval.
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// read will read the file and remember its modification time and size.
+func (f *watchedFile) read() ([]byte, error) {
+	// get info
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// read file
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// set state
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.checked = time.Now()
+
+	return data, nil
+}
+
+// changed will return whether the file has been modified since the last read.
+// The file is only checked if the interval has passed since the last check.
+func (f *watchedFile) changed(interval time.Duration) bool {
+	// check interval
+	if time.Since(f.checked) < interval {
+		return false
+	}
+
+	// get info
+	f.checked = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// An AMQPMessage is a message sent to an AMQP 1.0 endpoint.
+type AMQPMessage struct {
+	// The subject property, set to the MQTT topic.
+	Subject string
+
+	// The message body as a single data section.
+	Body []byte
+
+	// The durable header, set for messages with QOS 1 and 2.
+	Durable bool
+}
+
+// An AMQPSender sends messages to AMQP 1.0 addresses.
+type AMQPSender interface {
+	// Send should send the message to the specified address. If settled is
+	// true the message should be sent pre-settled and Send may return without
+	// waiting for a disposition. Otherwise Send should only return once the
+	// message has been accepted and return an error if it has been rejected,
+	// released or modified.
+	Send(address string, msg *AMQPMessage, settled bool) error
+}
+
+// An AMQPRoute forwards MQTT messages matching a filter to an AMQP address.
+type AMQPRoute struct {
+	// The MQTT topic filter.
+	Filter string
+
+	// The QOS level used to subscribe the filter.
+	QOS packet.QOS
+
+	// The AMQP address (e.g. a queue or topic name).
+	Address string
+}
+
+// An AMQPBridge forwards MQTT messages to an AMQP 1.0 endpoint like Azure
+// Service Bus or ActiveMQ.
+//
+// Messages received with QOS 0 are sent pre-settled and dropped on errors.
+// Messages received with QOS 1 and 2 are sent unsettled and only acknowledged
+// to the broker once the endpoint has accepted them.
+type AMQPBridge struct {
+	// The routes from MQTT to AMQP.
+	Routes []AMQPRoute
+
+	// The callback that is called with errors from the MQTT connection and
+	// the sender.
+	ErrorCallback func(error)
+
+	sender AMQPSender
+	routes *topic.Tree
+	link   *link
+	mutex  sync.Mutex
+}
+
+// NewAMQPBridge returns a new AMQPBridge that uses the specified sender.
+func NewAMQPBridge(sender AMQPSender) *AMQPBridge {
+	return &AMQPBridge{
+		sender: sender,
+	}
+}
+
+// Start will connect to the broker using the specified config and start
+// forwarding messages.
+func (b *AMQPBridge) Start(config *client.Config) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if already started
+	if b.link != nil {
+		return
+	}
+
+	// prepare routes and subscriptions
+	b.routes = topic.NewTree()
+	subs := make([]packet.Subscription, 0, len(b.Routes))
+	for i := range b.Routes {
+		route := &b.Routes[i]
+		b.routes.Add(route.Filter, route)
+		subs = append(subs, packet.Subscription{Topic: route.Filter, QOS: route.QOS})
+	}
+
+	// start link
+	b.link = newLink(subs, b.forward, b.ErrorCallback)
+	b.link.start(config)
+}
+
+// Stop will disconnect from the broker.
+func (b *AMQPBridge) Stop() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if not started
+	if b.link == nil {
+		return
+	}
+
+	// stop link
+	b.link.stop()
+	b.link = nil
+}
+
+func (b *AMQPBridge) forward(msg *packet.Message) error {
+	// prepare message
+	settled := msg.QOS == 0
+	amqpMsg := &AMQPMessage{
+		Subject: msg.Topic,
+		Body:    msg.Payload,
+		Durable: !settled,
+	}
+
+	// send message for every matching route
+	for _, value := range b.routes.Match(msg.Topic) {
+		route := value.(*AMQPRoute)
+
+		// send message
+		err := b.sender.Send(route.Address, amqpMsg, settled)
+		if err != nil && settled {
+			// drop message
+			if b.ErrorCallback != nil {
+				b.ErrorCallback(err)
+			}
+		} else if err != nil {
+			// the message is not acknowledged and will be redelivered
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type amqpDelivery struct {
+	address string
+	msg     AMQPMessage
+	settled bool
+}
+
+type fakeAMQP struct {
+	deliveries chan amqpDelivery
+	err        error
+}
+
+func (s *fakeAMQP) Send(address string, msg *AMQPMessage, settled bool) error {
+	s.deliveries <- amqpDelivery{address, *msg, settled}
+	return s.err
+}
+
+func TestAMQPBridge(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	sender := &fakeAMQP{deliveries: make(chan amqpDelivery, 10)}
+
+	bridge := NewAMQPBridge(sender)
+	bridge.Routes = []AMQPRoute{
+		{Filter: "telemetry/#", QOS: 0, Address: "telemetry"},
+		{Filter: "alarms/#", QOS: 1, Address: "alarms"},
+	}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+	bridge.Start(broker.Config("bridge"))
+	defer bridge.Stop()
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "telemetry/1", []byte("foo"))
+	assert.Equal(t, amqpDelivery{
+		address: "telemetry",
+		msg:     AMQPMessage{Subject: "telemetry/1", Body: []byte("foo")},
+		settled: true,
+	}, <-sender.deliveries)
+
+	publish(t, broker, "alarms/1", []byte("bar"))
+	assert.Equal(t, amqpDelivery{
+		address: "alarms",
+		msg:     AMQPMessage{Subject: "alarms/1", Body: []byte("bar"), Durable: true},
+		settled: false,
+	}, <-sender.deliveries)
+}
+
+func TestAMQPBridgeSettledError(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	sender := &fakeAMQP{
+		deliveries: make(chan amqpDelivery, 10),
+		err:        errors.New("failed"),
+	}
+
+	errs := make(chan error, 1)
+
+	bridge := NewAMQPBridge(sender)
+	bridge.Routes = []AMQPRoute{
+		{Filter: "foo", QOS: 0, Address: "foo"},
+	}
+	bridge.ErrorCallback = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	bridge.Start(broker.Config("bridge"))
+	defer bridge.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "foo", []byte("bar"))
+	<-sender.deliveries
+	assert.Equal(t, sender.err, <-errs)
+
+	// connection should stay online
+	publish(t, broker, "foo", []byte("baz"))
+	delivery := <-sender.deliveries
+	assert.Equal(t, []byte("baz"), delivery.msg.Body)
+}
@@ -0,0 +1,77 @@
+// Package bridge connects an MQTT broker to other brokers and messaging systems.
+//
+// Bridges connect to the broker like any other client using a client.Service
+// and therefore work with this and any other broker. The external systems are
+// accessed through small interfaces that can be implemented using the client
+// library of choice.
+package bridge
+
+import (
+	"strings"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A link maintains the MQTT side of a bridge.
+type link struct {
+	service *client.Service
+	timeout time.Duration
+}
+
+func newLink(subs []packet.Subscription, handler func(*packet.Message) error, errorCallback func(error)) *link {
+	// create service
+	service := client.NewService()
+	service.MessageCallback = handler
+	service.ErrorCallback = errorCallback
+
+	// queue subscriptions
+	if len(subs) > 0 {
+		service.SubscribeMultiple(subs)
+	}
+
+	return &link{
+		service: service,
+		timeout: 10 * time.Second,
+	}
+}
+
+func (l *link) start(config *client.Config) {
+	l.service.Start(config)
+}
+
+// publish will publish the message and wait until it has been acknowledged.
+func (l *link) publish(msg *packet.Message) error {
+	return l.service.PublishMessage(msg).Wait(l.timeout)
+}
+
+func (l *link) stop() {
+	l.service.Stop(true)
+}
+
+// expand replaces the "{key}" placeholder in the template with the key.
+func expand(template, key string) string {
+	return strings.Replace(template, "{key}", key, -1)
+}
+
+// level returns the topic level at the specified index. Negative indexes
+// count from the end. An empty string is returned if the level does not
+// exist.
+func level(topic string, index int) string {
+	segments := strings.Split(topic, "/")
+
+	// resolve negative index
+	if index < 0 {
+		index = len(segments) + index
+	} else {
+		index--
+	}
+
+	// check range
+	if index < 0 || index >= len(segments) {
+		return ""
+	}
+
+	return segments[index]
+}
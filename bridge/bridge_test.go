@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevel(t *testing.T) {
+	assert.Equal(t, "foo", level("foo/bar/baz", 1))
+	assert.Equal(t, "bar", level("foo/bar/baz", 2))
+	assert.Equal(t, "baz", level("foo/bar/baz", -1))
+	assert.Equal(t, "foo", level("foo/bar/baz", -3))
+	assert.Equal(t, "", level("foo/bar/baz", 4))
+	assert.Equal(t, "", level("foo/bar/baz", -4))
+}
+
+func TestExpand(t *testing.T) {
+	assert.Equal(t, "foo/bar/baz", expand("foo/{key}/baz", "bar"))
+	assert.Equal(t, "foo", expand("foo", "bar"))
+}
+
+func subscribe(t *testing.T, broker *testutil.Broker, filter string) chan *packet.Message {
+	messages := make(chan *packet.Message, 10)
+
+	c, err := broker.Connect(broker.Config("subscriber"))
+	assert.NoError(t, err)
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		if msg != nil {
+			messages <- msg
+		}
+		return nil
+	}
+
+	sf, err := c.Subscribe(filter, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+
+	return messages
+}
+
+func publish(t *testing.T, broker *testutil.Broker, topic string, payload []byte) {
+	c, err := broker.Connect(broker.Config("publisher"))
+	assert.NoError(t, err)
+
+	pf, err := c.Publish(topic, payload, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(time.Second))
+
+	assert.NoError(t, c.Disconnect())
+}
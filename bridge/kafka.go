@@ -0,0 +1,202 @@
+package bridge
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// A KafkaProducer writes messages to Kafka topics. Produce should only return
+// once the message has been acknowledged by Kafka.
+type KafkaProducer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// A KafkaConsumer reads messages from Kafka topics.
+type KafkaConsumer interface {
+	// Consume should call the handler for every message read from the
+	// specified topics until Close is called or an error occurs. A message
+	// should only be committed if the handler returns no error.
+	Consume(topics []string, handler func(topic string, key, value []byte) error) error
+
+	// Close should stop a running Consume call.
+	Close() error
+}
+
+// A KafkaRoute forwards MQTT messages matching a filter to a Kafka topic.
+type KafkaRoute struct {
+	// The MQTT topic filter.
+	Filter string
+
+	// The QOS level used to subscribe the filter.
+	QOS packet.QOS
+
+	// The Kafka topic.
+	Topic string
+
+	// The MQTT topic level (starting at 1) used as the message key. Negative
+	// values count from the end of the topic. If zero, the full MQTT topic is
+	// used as the key.
+	KeyLevel int
+}
+
+// A KafkaInboundRoute forwards messages from a Kafka topic to MQTT.
+type KafkaInboundRoute struct {
+	// The Kafka topic.
+	Topic string
+
+	// The MQTT topic. Any "{key}" placeholder is replaced with the key of the
+	// Kafka message.
+	Target string
+
+	// The QOS level and retain flag of the published messages.
+	QOS    packet.QOS
+	Retain bool
+}
+
+// A KafkaBridge forwards MQTT messages to Kafka and optionally Kafka messages
+// back to MQTT.
+//
+// Note: Routes should not overlap in both directions as messages would be
+// forwarded in a loop.
+type KafkaBridge struct {
+	// The routes from MQTT to Kafka.
+	Routes []KafkaRoute
+
+	// The routes from Kafka to MQTT. The inbound routes require a consumer.
+	InboundRoutes []KafkaInboundRoute
+
+	// The callback that is called with errors from the MQTT connection or the
+	// consumer.
+	ErrorCallback func(error)
+
+	producer KafkaProducer
+	consumer KafkaConsumer
+	routes   *topic.Tree
+	link     *link
+	done     chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewKafkaBridge returns a new KafkaBridge that uses the specified producer
+// and consumer. The consumer is only needed for inbound routes.
+func NewKafkaBridge(producer KafkaProducer, consumer KafkaConsumer) *KafkaBridge {
+	return &KafkaBridge{
+		producer: producer,
+		consumer: consumer,
+	}
+}
+
+// Start will connect to the broker using the specified config and start
+// forwarding messages.
+func (b *KafkaBridge) Start(config *client.Config) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if already started
+	if b.link != nil {
+		return
+	}
+
+	// prepare routes and subscriptions
+	b.routes = topic.NewTree()
+	subs := make([]packet.Subscription, 0, len(b.Routes))
+	for i := range b.Routes {
+		route := &b.Routes[i]
+		b.routes.Add(route.Filter, route)
+		subs = append(subs, packet.Subscription{Topic: route.Filter, QOS: route.QOS})
+	}
+
+	// start link
+	b.link = newLink(subs, b.forward, b.ErrorCallback)
+	b.link.start(config)
+
+	// start consumer
+	if b.consumer != nil && len(b.InboundRoutes) > 0 {
+		b.done = make(chan struct{})
+		go b.consume()
+	}
+}
+
+// Stop will stop the consumer and disconnect from the broker.
+func (b *KafkaBridge) Stop() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if not started
+	if b.link == nil {
+		return
+	}
+
+	// stop consumer
+	if b.done != nil {
+		_ = b.consumer.Close()
+		<-b.done
+		b.done = nil
+	}
+
+	// stop link
+	b.link.stop()
+	b.link = nil
+}
+
+func (b *KafkaBridge) forward(msg *packet.Message) error {
+	// produce message for every matching route
+	for _, value := range b.routes.Match(msg.Topic) {
+		route := value.(*KafkaRoute)
+
+		// get key
+		key := msg.Topic
+		if route.KeyLevel != 0 {
+			key = level(msg.Topic, route.KeyLevel)
+		}
+
+		// produce message, the message is not acknowledged on errors and
+		// will be redelivered by the broker
+		err := b.producer.Produce(route.Topic, []byte(key), msg.Payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *KafkaBridge) consume() {
+	defer close(b.done)
+
+	// index routes
+	index := make(map[string][]KafkaInboundRoute)
+	var topics []string
+	for _, route := range b.InboundRoutes {
+		if _, ok := index[route.Topic]; !ok {
+			topics = append(topics, route.Topic)
+		}
+
+		index[route.Topic] = append(index[route.Topic], route)
+	}
+
+	// consume messages
+	err := b.consumer.Consume(topics, func(topic string, key, value []byte) error {
+		for _, route := range index[topic] {
+			err := b.link.publish(&packet.Message{
+				Topic:   expand(route.Target, string(key)),
+				Payload: value,
+				QOS:     route.QOS,
+				Retain:  route.Retain,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil && b.ErrorCallback != nil {
+		b.ErrorCallback(err)
+	}
+}
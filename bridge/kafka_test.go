@@ -0,0 +1,134 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type kafkaMessage struct {
+	topic string
+	key   string
+	value string
+}
+
+type fakeKafka struct {
+	produced chan kafkaMessage
+	incoming chan kafkaMessage
+	closed   chan struct{}
+}
+
+func newFakeKafka() *fakeKafka {
+	return &fakeKafka{
+		produced: make(chan kafkaMessage, 10),
+		incoming: make(chan kafkaMessage, 10),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (k *fakeKafka) Produce(topic string, key, value []byte) error {
+	k.produced <- kafkaMessage{topic, string(key), string(value)}
+	return nil
+}
+
+func (k *fakeKafka) Consume(topics []string, handler func(topic string, key, value []byte) error) error {
+	for {
+		select {
+		case msg := <-k.incoming:
+			err := handler(msg.topic, []byte(msg.key), []byte(msg.value))
+			if err != nil {
+				return err
+			}
+		case <-k.closed:
+			return nil
+		}
+	}
+}
+
+func (k *fakeKafka) Close() error {
+	close(k.closed)
+	return nil
+}
+
+func TestKafkaBridge(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	kafka := newFakeKafka()
+
+	bridge := NewKafkaBridge(kafka, kafka)
+	bridge.Routes = []KafkaRoute{
+		{Filter: "devices/+/data", QOS: 1, Topic: "data", KeyLevel: 2},
+		{Filter: "events/#", Topic: "events"},
+	}
+	bridge.InboundRoutes = []KafkaInboundRoute{
+		{Topic: "commands", Target: "devices/{key}/commands", QOS: 1},
+	}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+	bridge.Start(broker.Config("bridge"))
+	defer bridge.Stop()
+
+	messages := subscribe(t, broker, "devices/+/commands")
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "devices/1/data", []byte("foo"))
+	assert.Equal(t, kafkaMessage{"data", "1", "foo"}, <-kafka.produced)
+
+	publish(t, broker, "events/a/b", []byte("bar"))
+	assert.Equal(t, kafkaMessage{"events", "events/a/b", "bar"}, <-kafka.produced)
+
+	kafka.incoming <- kafkaMessage{"commands", "2", "baz"}
+	msg := <-messages
+	assert.Equal(t, "devices/2/commands", msg.Topic)
+	assert.Equal(t, []byte("baz"), msg.Payload)
+}
+
+type failingProducer struct {
+	calls chan struct{}
+}
+
+func (p *failingProducer) Produce(topic string, key, value []byte) error {
+	select {
+	case p.calls <- struct{}{}:
+	default:
+	}
+
+	return errors.New("failed")
+}
+
+func TestKafkaBridgeProduceError(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	producer := &failingProducer{calls: make(chan struct{}, 10)}
+
+	errs := make(chan error, 10)
+
+	bridge := NewKafkaBridge(producer, nil)
+	bridge.Routes = []KafkaRoute{
+		{Filter: "foo", QOS: 1, Topic: "foo"},
+	}
+	bridge.ErrorCallback = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	bridge.Start(broker.Config("bridge"))
+	defer bridge.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "foo", []byte("bar"))
+
+	<-producer.calls
+	assert.Error(t, <-errs)
+}
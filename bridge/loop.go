@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A LoopGuard prevents messages from being forwarded in a loop. Bridges mark
+// every message they publish to a broker and drop messages with the same topic
+// and payload that they receive from that broker within the window. A guard
+// may be shared by several bridges to prevent loops between bridges that
+// forward the same filters.
+type LoopGuard struct {
+	// The time a marked message is remembered.
+	//
+	// Will default to one second.
+	Window time.Duration
+
+	marks map[string]time.Time
+	mutex sync.Mutex
+}
+
+// NewLoopGuard returns a new LoopGuard.
+func NewLoopGuard() *LoopGuard {
+	return &LoopGuard{
+		Window: time.Second,
+		marks:  make(map[string]time.Time),
+	}
+}
+
+// Mark will remember that the message has been published to the broker.
+func (g *LoopGuard) Mark(broker string, msg *packet.Message) {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// get time
+	now := time.Now()
+
+	// remove expired marks
+	for key, expiry := range g.marks {
+		if now.After(expiry) {
+			delete(g.marks, key)
+		}
+	}
+
+	// add mark
+	g.marks[loopKey(broker, msg)] = now.Add(g.Window)
+}
+
+// Check will return whether the message received from the broker has been
+// published to it within the window.
+func (g *LoopGuard) Check(broker string, msg *packet.Message) bool {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// check mark
+	expiry, ok := g.marks[loopKey(broker, msg)]
+
+	return ok && !time.Now().After(expiry)
+}
+
+func loopKey(broker string, msg *packet.Message) string {
+	// hash payload
+	hash := fnv.New64a()
+	_, _ = hash.Write(msg.Payload)
+
+	return broker + "\x00" + msg.Topic + "\x00" + strconv.FormatUint(hash.Sum64(), 16)
+}
@@ -0,0 +1,28 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopGuard(t *testing.T) {
+	guard := NewLoopGuard()
+	guard.Window = 50 * time.Millisecond
+
+	msg := &packet.Message{Topic: "foo", Payload: []byte("bar")}
+
+	assert.False(t, guard.Check("a", msg))
+
+	guard.Mark("a", msg)
+	assert.False(t, guard.Check("b", msg))
+	assert.False(t, guard.Check("a", &packet.Message{Topic: "foo", Payload: []byte("baz")}))
+	assert.True(t, guard.Check("a", msg))
+	assert.True(t, guard.Check("a", msg))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, guard.Check("a", msg))
+}
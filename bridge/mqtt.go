@@ -0,0 +1,332 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrInvalidMapping is returned if the local and remote filter of a route do
+// not contain the same wildcards in the same order.
+var ErrInvalidMapping = errors.New("invalid mapping")
+
+// MapTopic maps a topic that matches the from filter to the to filter. The
+// levels matched by the wildcards of the from filter replace the wildcards of
+// the to filter in the same order. False is returned if the topic does not
+// match the from filter or the filters do not contain the same wildcards.
+//
+// For example, mapping "local/sensors/1/temp" from "local/sensors/#" to
+// "site-42/sensors/#" yields "site-42/sensors/1/temp".
+func MapTopic(name, from, to string) (string, bool) {
+	// check filters
+	if !compatible(from, to) {
+		return "", false
+	}
+
+	// capture wildcards
+	var captures []string
+	levels := strings.Split(name, "/")
+	filter := strings.Split(from, "/")
+	for i, level := range filter {
+		// capture remaining levels
+		if level == "#" {
+			captures = append(captures, strings.Join(levels[i:], "/"))
+			levels = levels[:i]
+			filter = filter[:i]
+			break
+		}
+
+		// match level
+		if i >= len(levels) || (level != "+" && level != levels[i]) {
+			return "", false
+		} else if level == "+" {
+			captures = append(captures, levels[i])
+		}
+	}
+
+	// check length
+	if len(levels) != len(filter) {
+		return "", false
+	}
+
+	// replace wildcards
+	var result []string
+	for _, level := range strings.Split(to, "/") {
+		switch level {
+		case "+":
+			result = append(result, captures[0])
+			captures = captures[1:]
+		case "#":
+			// omit empty multi level capture
+			if captures[0] != "" {
+				result = append(result, captures[0])
+			}
+			captures = captures[1:]
+		default:
+			result = append(result, level)
+		}
+	}
+
+	return strings.Join(result, "/"), true
+}
+
+// compatible returns whether the filters contain the same wildcards in the
+// same order.
+func compatible(a, b string) bool {
+	return wildcards(a) == wildcards(b)
+}
+
+func wildcards(filter string) string {
+	var list []string
+	for _, level := range strings.Split(filter, "/") {
+		if level == "+" || level == "#" {
+			list = append(list, level)
+		}
+	}
+
+	return strings.Join(list, "/")
+}
+
+// QOSPolicy defines how the QOS level of forwarded messages is mapped.
+type QOSPolicy int
+
+const (
+	// KeepQOS forwards messages with their QOS level.
+	KeepQOS QOSPolicy = iota
+
+	// CapQOS downgrades messages with a higher QOS level than the configured
+	// level.
+	CapQOS
+
+	// FixedQOS forwards all messages with the configured QOS level, which
+	// downgrades or upgrades them.
+	FixedQOS
+)
+
+// MQTTForwarding configures how messages are forwarded to a broker.
+type MQTTForwarding struct {
+	// The policy applied to the QOS level of forwarded messages.
+	//
+	// Will default to keep the QOS level.
+	QOSPolicy QOSPolicy
+
+	// The QOS level used by the policy.
+	QOS packet.QOS
+
+	// Whether the retained flag of forwarded messages is cleared.
+	ClearRetain bool
+}
+
+func (f MQTTForwarding) apply(msg *packet.Message) {
+	// map qos level
+	switch f.QOSPolicy {
+	case CapQOS:
+		if msg.QOS > f.QOS {
+			msg.QOS = f.QOS
+		}
+	case FixedQOS:
+		msg.QOS = f.QOS
+	}
+
+	// clear retain flag
+	if f.ClearRetain {
+		msg.Retain = false
+	}
+}
+
+// An MQTTRoute defines a topic filter that is forwarded by an MQTTBridge and
+// how it is mapped between the local and remote topic space.
+type MQTTRoute struct {
+	// The local topic filter.
+	Local string
+
+	// The remote topic filter. It must contain the same wildcards in the same
+	// order as the local filter.
+	//
+	// Will default to the local filter.
+	Remote string
+
+	// The QOS level used to subscribe the filter.
+	QOS packet.QOS
+}
+
+func (r MQTTRoute) remote() string {
+	if r.Remote == "" {
+		return r.Local
+	}
+
+	return r.Remote
+}
+
+// An MQTTBridge forwards messages between a local and a remote broker. Topics
+// are remapped according to the routes, e.g. the local filter
+// "local/sensors/#" can appear remotely as "site-42/sensors/#".
+//
+// Messages that are received back from the broker they have been forwarded to
+// are dropped by the loop guard. Routes may therefore overlap in both
+// directions.
+type MQTTBridge struct {
+	// The routes from the local to the remote broker.
+	Outbound []MQTTRoute
+
+	// The routes from the remote to the local broker.
+	Inbound []MQTTRoute
+
+	// The configuration of messages forwarded to the remote broker.
+	ToRemote MQTTForwarding
+
+	// The configuration of messages forwarded to the local broker.
+	ToLocal MQTTForwarding
+
+	// The names that identify the brokers in the loop guard.
+	//
+	// Will default to the broker URLs of the configs.
+	LocalName  string
+	RemoteName string
+
+	// The guard used to prevent forwarding loops. A guard may be shared with
+	// other bridges.
+	//
+	// Will default to a new guard.
+	LoopGuard *LoopGuard
+
+	// The callback that is called with errors from the MQTT connections and
+	// messages that could not be forwarded.
+	ErrorCallback func(error)
+
+	local  *link
+	remote *link
+	mutex  sync.Mutex
+}
+
+// NewMQTTBridge returns a new MQTTBridge.
+func NewMQTTBridge() *MQTTBridge {
+	return &MQTTBridge{}
+}
+
+// Start will connect to the local and remote broker using the specified configs
+// and start forwarding messages. An error is returned if a route is invalid.
+func (b *MQTTBridge) Start(local, remote *client.Config) error {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if already started
+	if b.local != nil {
+		return nil
+	}
+
+	// prepare subscriptions
+	localSubs := make([]packet.Subscription, 0, len(b.Outbound))
+	for _, route := range b.Outbound {
+		if !validRoute(route) {
+			return ErrInvalidMapping
+		}
+
+		localSubs = append(localSubs, packet.Subscription{Topic: route.Local, QOS: route.QOS})
+	}
+	remoteSubs := make([]packet.Subscription, 0, len(b.Inbound))
+	for _, route := range b.Inbound {
+		if !validRoute(route) {
+			return ErrInvalidMapping
+		}
+
+		remoteSubs = append(remoteSubs, packet.Subscription{Topic: route.remote(), QOS: route.QOS})
+	}
+
+	// get names
+	localName, remoteName := b.LocalName, b.RemoteName
+	if localName == "" {
+		localName = local.BrokerURL
+	}
+	if remoteName == "" {
+		remoteName = remote.BrokerURL
+	}
+
+	// create guard
+	if b.LoopGuard == nil {
+		b.LoopGuard = NewLoopGuard()
+	}
+
+	// create links
+	b.local = newLink(localSubs, nil, b.ErrorCallback)
+	b.remote = newLink(remoteSubs, nil, b.ErrorCallback)
+
+	// set handlers
+	b.local.service.MessageCallback = b.forwarder(b.Outbound, true, b.ToRemote, localName, remoteName, b.remote)
+	b.remote.service.MessageCallback = b.forwarder(b.Inbound, false, b.ToLocal, remoteName, localName, b.local)
+
+	// start links
+	b.local.start(local)
+	b.remote.start(remote)
+
+	return nil
+}
+
+// Stop will disconnect from both brokers.
+func (b *MQTTBridge) Stop() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if not started
+	if b.local == nil {
+		return
+	}
+
+	// stop links
+	b.local.stop()
+	b.remote.stop()
+	b.local = nil
+	b.remote = nil
+}
+
+func validRoute(route MQTTRoute) bool {
+	return topic.ValidateFilter(route.Local) == nil &&
+		topic.ValidateFilter(route.remote()) == nil &&
+		compatible(route.Local, route.remote())
+}
+
+func (b *MQTTBridge) forwarder(routes []MQTTRoute, outbound bool, forwarding MQTTForwarding, source, target string, link *link) func(*packet.Message) error {
+	// get guard
+	guard := b.LoopGuard
+
+	return func(msg *packet.Message) error {
+		// drop messages that have been forwarded to the source
+		if guard.Check(source, msg) {
+			return nil
+		}
+
+		// map topic using the first matching route
+		for _, route := range routes {
+			from, to := route.Local, route.remote()
+			if !outbound {
+				from, to = to, from
+			}
+
+			name, ok := MapTopic(msg.Topic, from, to)
+			if !ok {
+				continue
+			}
+
+			// publish message, the message is not acknowledged on errors and
+			// will be redelivered by the broker
+			forward := *msg
+			forward.Topic = name
+			forwarding.apply(&forward)
+
+			// mark message before publishing as it may be received back
+			// before the publish has been acknowledged
+			guard.Mark(target, &forward)
+
+			return link.publish(&forward)
+		}
+
+		// messages without a matching route are dropped
+		return nil
+	}
+}
@@ -0,0 +1,204 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapTopic(t *testing.T) {
+	matrix := []struct {
+		topic, from, to, result string
+	}{
+		{"local/sensors/1/temp", "local/sensors/#", "site-42/sensors/#", "site-42/sensors/1/temp"},
+		{"local/sensors", "local/sensors/#", "site-42/sensors/#", "site-42/sensors"},
+		{"site-42/sensors/1", "site-42/#", "#", "sensors/1"},
+		{"foo/1/bar/2", "foo/+/bar/#", "a/+/b/c/#", "a/1/b/c/2"},
+		{"foo/1", "foo/+", "bar", ""},
+		{"foo/1/2", "foo/+", "bar/+", ""},
+		{"bar/1", "foo/+", "bar/+", ""},
+		{"foo", "foo/+", "bar/+", ""},
+		{"foo", "foo", "bar", "bar"},
+	}
+
+	for _, item := range matrix {
+		res, ok := MapTopic(item.topic, item.from, item.to)
+		assert.Equal(t, item.result != "", ok, item.topic)
+		assert.Equal(t, item.result, res, item.topic)
+	}
+}
+
+func TestMQTTBridge(t *testing.T) {
+	local := testutil.NewBroker(nil, nil)
+	defer local.Close()
+
+	remote := testutil.NewBroker(nil, nil)
+	defer remote.Close()
+
+	bridge := NewMQTTBridge()
+	bridge.Outbound = []MQTTRoute{
+		{Local: "local/sensors/#", Remote: "site-42/sensors/#", QOS: 1},
+	}
+	bridge.Inbound = []MQTTRoute{
+		{Local: "local/commands/+", Remote: "site-42/commands/+", QOS: 1},
+	}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, bridge.Start(local.Config("bridge"), remote.Config("bridge")))
+
+	remoteMessages := subscribe(t, remote, "site-42/#")
+	localMessages := subscribe(t, local, "local/commands/#")
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, local, "local/sensors/1/temp", []byte("foo"))
+	msg := <-remoteMessages
+	assert.Equal(t, "site-42/sensors/1/temp", msg.Topic)
+	assert.Equal(t, []byte("foo"), msg.Payload)
+
+	publish(t, remote, "site-42/commands/reboot", []byte("bar"))
+	msg = <-localMessages
+	assert.Equal(t, "local/commands/reboot", msg.Topic)
+	assert.Equal(t, []byte("bar"), msg.Payload)
+
+	bridge.Stop()
+}
+
+func TestMQTTBridgeInvalidMapping(t *testing.T) {
+	bridge := NewMQTTBridge()
+	bridge.Outbound = []MQTTRoute{
+		{Local: "local/+/#", Remote: "remote/#"},
+	}
+
+	err := bridge.Start(nil, nil)
+	assert.Equal(t, ErrInvalidMapping, err)
+}
+
+func TestMQTTBridgeLoopPrevention(t *testing.T) {
+	local := testutil.NewBroker(nil, nil)
+	defer local.Close()
+
+	remote := testutil.NewBroker(nil, nil)
+	defer remote.Close()
+
+	guard := NewLoopGuard()
+
+	// two bridges forwarding the same filters in both directions
+	var bridges []*MQTTBridge
+	for i := 0; i < 2; i++ {
+		bridge := NewMQTTBridge()
+		bridge.Outbound = []MQTTRoute{{Local: "sensors/#", QOS: 1}}
+		bridge.Inbound = []MQTTRoute{{Local: "sensors/#", QOS: 1}}
+		bridge.LocalName = "local"
+		bridge.RemoteName = "remote"
+		bridge.LoopGuard = guard
+		bridge.ErrorCallback = func(err error) {
+			assert.NoError(t, err)
+		}
+
+		id := "bridge" + string(rune('1'+i))
+		assert.NoError(t, bridge.Start(local.Config(id), remote.Config(id)))
+
+		bridges = append(bridges, bridge)
+	}
+
+	localMessages := subscribe(t, local, "sensors/#")
+	remoteMessages := subscribe(t, remote, "sensors/#")
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, local, "sensors/1", []byte("foo"))
+
+	// the message arrives once per bridge remotely and only once locally
+	for i := 0; i < 2; i++ {
+		msg := <-remoteMessages
+		assert.Equal(t, "sensors/1", msg.Topic)
+	}
+	msg := <-localMessages
+	assert.Equal(t, "sensors/1", msg.Topic)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, localMessages)
+	assert.Empty(t, remoteMessages)
+
+	for _, bridge := range bridges {
+		bridge.Stop()
+	}
+}
+
+func TestMQTTForwarding(t *testing.T) {
+	matrix := []struct {
+		forwarding MQTTForwarding
+		in, out    packet.Message
+	}{
+		{MQTTForwarding{}, packet.Message{QOS: 2, Retain: true}, packet.Message{QOS: 2, Retain: true}},
+		{MQTTForwarding{QOSPolicy: CapQOS, QOS: 1}, packet.Message{QOS: 2}, packet.Message{QOS: 1}},
+		{MQTTForwarding{QOSPolicy: CapQOS, QOS: 1}, packet.Message{QOS: 0}, packet.Message{QOS: 0}},
+		{MQTTForwarding{QOSPolicy: FixedQOS, QOS: 1}, packet.Message{QOS: 0}, packet.Message{QOS: 1}},
+		{MQTTForwarding{QOSPolicy: FixedQOS, QOS: 1}, packet.Message{QOS: 2}, packet.Message{QOS: 1}},
+		{MQTTForwarding{ClearRetain: true}, packet.Message{Retain: true}, packet.Message{}},
+	}
+
+	for i, item := range matrix {
+		msg := item.in
+		item.forwarding.apply(&msg)
+		assert.Equal(t, item.out, msg, i)
+	}
+}
+
+func TestMQTTBridgeForwarding(t *testing.T) {
+	local := testutil.NewBroker(nil, nil)
+	defer local.Close()
+
+	remote := testutil.NewBroker(nil, nil)
+	defer remote.Close()
+
+	// retain message before the bridge subscribes
+	c, err := local.Connect(local.Config("retainer"))
+	assert.NoError(t, err)
+	pf, err := c.Publish("sensors/1", []byte("foo"), 1, true)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(time.Second))
+	assert.NoError(t, c.Disconnect())
+
+	bridge := NewMQTTBridge()
+	bridge.Outbound = []MQTTRoute{{Local: "sensors/#", QOS: 1}}
+	bridge.ToRemote = MQTTForwarding{QOSPolicy: FixedQOS, QOS: 0, ClearRetain: true}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+
+	remoteMessages := subscribe(t, remote, "sensors/#")
+
+	assert.NoError(t, bridge.Start(local.Config("bridge"), remote.Config("bridge")))
+
+	msg := <-remoteMessages
+	assert.Equal(t, "sensors/1", msg.Topic)
+	assert.Equal(t, packet.QOS(0), msg.QOS)
+
+	// the retained flag has not been propagated
+	s, err := remote.Connect(remote.Config("checker"))
+	assert.NoError(t, err)
+	received := make(chan *packet.Message, 1)
+	s.Callback = func(msg *packet.Message, err error) error {
+		if msg != nil {
+			received <- msg
+		}
+		return nil
+	}
+	sf, err := s.Subscribe("sensors/#", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, received)
+	assert.NoError(t, s.Disconnect())
+
+	bridge.Stop()
+}
@@ -0,0 +1,224 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrUntranslatable is returned if a topic or subject cannot be translated.
+var ErrUntranslatable = errors.New("untranslatable topic or subject")
+
+// A NATSConn publishes and subscribes NATS subjects.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(subject string, data []byte)) (NATSSubscription, error)
+}
+
+// A NATSSubscription is an active NATS subscription.
+type NATSSubscription interface {
+	Unsubscribe() error
+}
+
+// TopicToSubject translates an MQTT topic or topic filter to a NATS subject.
+// Levels are separated by dots and the wildcards "+" and "#" are translated to
+// "*" and ">". Empty levels and levels that contain dots, spaces or the NATS
+// wildcards cannot be translated.
+func TopicToSubject(topic string) (string, error) {
+	levels := strings.Split(topic, "/")
+
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			levels[i] = "*"
+		case level == "#":
+			levels[i] = ">"
+		case level == "" || level == "*" || level == ">" || strings.ContainsAny(level, ". \t\r\n"):
+			return "", ErrUntranslatable
+		}
+	}
+
+	return strings.Join(levels, "."), nil
+}
+
+// SubjectToTopic translates a NATS subject to an MQTT topic or topic filter.
+// Tokens that contain slashes or the MQTT wildcards cannot be translated.
+func SubjectToTopic(subject string) (string, error) {
+	tokens := strings.Split(subject, ".")
+
+	for i, token := range tokens {
+		switch {
+		case token == "*":
+			tokens[i] = "+"
+		case token == ">":
+			tokens[i] = "#"
+		case token == "" || strings.ContainsAny(token, "/+#"):
+			return "", ErrUntranslatable
+		}
+	}
+
+	return strings.Join(tokens, "/"), nil
+}
+
+// A NATSRoute defines a topic filter that is forwarded by a NATSBridge.
+type NATSRoute struct {
+	// The MQTT topic filter.
+	Filter string
+
+	// The QOS level used to subscribe the filter or publish the messages.
+	QOS packet.QOS
+
+	// Whether messages forwarded to MQTT are retained.
+	Retain bool
+}
+
+// A NATSBridge forwards messages between MQTT topics and NATS subjects.
+//
+// Note: Routes should not overlap in both directions as messages would be
+// forwarded in a loop.
+type NATSBridge struct {
+	// The routes from MQTT to NATS.
+	Outbound []NATSRoute
+
+	// The routes from NATS to MQTT.
+	Inbound []NATSRoute
+
+	// The callback that is called with errors from the MQTT connection and
+	// messages that could not be forwarded.
+	ErrorCallback func(error)
+
+	conn  NATSConn
+	subs  []NATSSubscription
+	link  *link
+	mutex sync.Mutex
+}
+
+// NewNATSBridge returns a new NATSBridge that uses the specified connection.
+func NewNATSBridge(conn NATSConn) *NATSBridge {
+	return &NATSBridge{
+		conn: conn,
+	}
+}
+
+// Start will connect to the broker using the specified config and start
+// forwarding messages. An error is returned if a route cannot be translated
+// or subscribed.
+func (b *NATSBridge) Start(config *client.Config) error {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if already started
+	if b.link != nil {
+		return nil
+	}
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(b.Outbound))
+	for _, route := range b.Outbound {
+		subs = append(subs, packet.Subscription{Topic: route.Filter, QOS: route.QOS})
+	}
+
+	// start link
+	b.link = newLink(subs, b.forward, b.ErrorCallback)
+	b.link.start(config)
+
+	// subscribe subjects
+	for _, route := range b.Inbound {
+		err := b.subscribe(route)
+		if err != nil {
+			b.stop()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop will unsubscribe all subjects and disconnect from the broker.
+func (b *NATSBridge) Stop() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if not started
+	if b.link == nil {
+		return
+	}
+
+	b.stop()
+}
+
+func (b *NATSBridge) stop() {
+	// unsubscribe subjects
+	for _, sub := range b.subs {
+		_ = sub.Unsubscribe()
+	}
+	b.subs = nil
+
+	// stop link
+	b.link.stop()
+	b.link = nil
+}
+
+func (b *NATSBridge) subscribe(route NATSRoute) error {
+	// translate filter
+	subject, err := TopicToSubject(route.Filter)
+	if err != nil {
+		return err
+	}
+
+	// get link
+	link := b.link
+
+	// subscribe subject
+	sub, err := b.conn.Subscribe(subject, func(subject string, data []byte) {
+		// translate subject
+		topic, err := SubjectToTopic(subject)
+		if err != nil {
+			b.error(err)
+			return
+		}
+
+		// publish message
+		err = link.publish(&packet.Message{
+			Topic:   topic,
+			Payload: data,
+			QOS:     route.QOS,
+			Retain:  route.Retain,
+		})
+		if err != nil {
+			b.error(err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// add subscription
+	b.subs = append(b.subs, sub)
+
+	return nil
+}
+
+func (b *NATSBridge) forward(msg *packet.Message) error {
+	// translate topic, untranslatable messages are dropped
+	subject, err := TopicToSubject(msg.Topic)
+	if err != nil {
+		b.error(err)
+		return nil
+	}
+
+	// publish message, the message is not acknowledged on errors and will be
+	// redelivered by the broker
+	return b.conn.Publish(subject, msg.Payload)
+}
+
+func (b *NATSBridge) error(err error) {
+	if b.ErrorCallback != nil {
+		b.ErrorCallback(err)
+	}
+}
@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicToSubject(t *testing.T) {
+	matrix := map[string]string{
+		"foo":       "foo",
+		"foo/bar":   "foo.bar",
+		"foo/+/baz": "foo.*.baz",
+		"foo/#":     "foo.>",
+		"foo/b.r":   "",
+		"foo//bar":  "",
+		"/foo":      "",
+		"foo/*":     "",
+	}
+
+	for topic, subject := range matrix {
+		res, err := TopicToSubject(topic)
+		if subject == "" {
+			assert.Equal(t, ErrUntranslatable, err, topic)
+		} else {
+			assert.NoError(t, err, topic)
+			assert.Equal(t, subject, res, topic)
+		}
+	}
+}
+
+func TestSubjectToTopic(t *testing.T) {
+	matrix := map[string]string{
+		"foo":       "foo",
+		"foo.bar":   "foo/bar",
+		"foo.*.baz": "foo/+/baz",
+		"foo.>":     "foo/#",
+		"foo.b/r":   "",
+		"foo.+":     "",
+		"foo..bar":  "",
+	}
+
+	for subject, topic := range matrix {
+		res, err := SubjectToTopic(subject)
+		if topic == "" {
+			assert.Equal(t, ErrUntranslatable, err, subject)
+		} else {
+			assert.NoError(t, err, subject)
+			assert.Equal(t, topic, res, subject)
+		}
+	}
+}
+
+type natsMessage struct {
+	subject string
+	data    string
+}
+
+type fakeNATS struct {
+	published chan natsMessage
+	handlers  map[string]func(string, []byte)
+	mutex     sync.Mutex
+}
+
+type fakeNATSSubscription struct {
+	nats    *fakeNATS
+	subject string
+}
+
+func (s *fakeNATSSubscription) Unsubscribe() error {
+	s.nats.mutex.Lock()
+	defer s.nats.mutex.Unlock()
+
+	delete(s.nats.handlers, s.subject)
+
+	return nil
+}
+
+func (n *fakeNATS) Publish(subject string, data []byte) error {
+	n.published <- natsMessage{subject, string(data)}
+	return nil
+}
+
+func (n *fakeNATS) Subscribe(subject string, handler func(string, []byte)) (NATSSubscription, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.handlers[subject] = handler
+
+	return &fakeNATSSubscription{nats: n, subject: subject}, nil
+}
+
+func (n *fakeNATS) deliver(filter, subject, data string) {
+	n.mutex.Lock()
+	handler := n.handlers[filter]
+	n.mutex.Unlock()
+
+	handler(subject, []byte(data))
+}
+
+func TestNATSBridge(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	nats := &fakeNATS{
+		published: make(chan natsMessage, 10),
+		handlers:  make(map[string]func(string, []byte)),
+	}
+
+	bridge := NewNATSBridge(nats)
+	bridge.Outbound = []NATSRoute{
+		{Filter: "devices/+/data", QOS: 1},
+	}
+	bridge.Inbound = []NATSRoute{
+		{Filter: "commands/#", QOS: 1},
+	}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, bridge.Start(broker.Config("bridge")))
+
+	messages := subscribe(t, broker, "commands/#")
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "devices/1/data", []byte("foo"))
+	assert.Equal(t, natsMessage{"devices.1.data", "foo"}, <-nats.published)
+
+	nats.deliver("commands.>", "commands.1.reboot", "bar")
+	msg := <-messages
+	assert.Equal(t, "commands/1/reboot", msg.Topic)
+	assert.Equal(t, []byte("bar"), msg.Payload)
+
+	bridge.Stop()
+	assert.Empty(t, nats.handlers)
+}
+
+func TestNATSBridgeUntranslatableRoute(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	bridge := NewNATSBridge(&fakeNATS{
+		handlers: make(map[string]func(string, []byte)),
+	})
+	bridge.Inbound = []NATSRoute{
+		{Filter: "foo/b.r"},
+	}
+
+	err := bridge.Start(broker.Config("bridge"))
+	assert.Equal(t, ErrUntranslatable, err)
+}
@@ -0,0 +1,215 @@
+package bridge
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// A RedisConn publishes and subscribes Redis pub/sub channels.
+type RedisConn interface {
+	// Publish should publish the message to the channel.
+	Publish(channel string, message []byte) error
+
+	// PSubscribe should call the handler for every message published to a
+	// channel that matches one of the patterns until Close is called or an
+	// error occurs.
+	PSubscribe(patterns []string, handler func(channel string, message []byte)) error
+
+	// Close should stop a running PSubscribe call.
+	Close() error
+}
+
+// A RedisRoute defines a topic filter that is forwarded by a RedisBridge.
+type RedisRoute struct {
+	// The MQTT topic filter.
+	Filter string
+
+	// The QOS level used to subscribe the filter or publish the messages.
+	QOS packet.QOS
+
+	// Whether messages forwarded to MQTT are retained.
+	Retain bool
+}
+
+// A RedisBridge forwards messages between MQTT topics and Redis pub/sub
+// channels. The channel of a message is the MQTT topic with an optional
+// prefix.
+//
+// Note: Routes should not overlap in both directions as messages would be
+// forwarded in a loop.
+type RedisBridge struct {
+	// The prefix added to the channels (e.g. "mqtt:").
+	Prefix string
+
+	// The routes from MQTT to Redis.
+	Outbound []RedisRoute
+
+	// The routes from Redis to MQTT.
+	Inbound []RedisRoute
+
+	// The callback that is called with errors from the MQTT connection and
+	// messages that could not be forwarded.
+	ErrorCallback func(error)
+
+	conn    RedisConn
+	inbound *topic.Tree
+	link    *link
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+// NewRedisBridge returns a new RedisBridge that uses the specified
+// connection.
+func NewRedisBridge(conn RedisConn) *RedisBridge {
+	return &RedisBridge{
+		conn: conn,
+	}
+}
+
+// Start will connect to the broker using the specified config and start
+// forwarding messages.
+func (b *RedisBridge) Start(config *client.Config) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if already started
+	if b.link != nil {
+		return
+	}
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(b.Outbound))
+	for _, route := range b.Outbound {
+		subs = append(subs, packet.Subscription{Topic: route.Filter, QOS: route.QOS})
+	}
+
+	// start link
+	b.link = newLink(subs, b.forward, b.ErrorCallback)
+	b.link.start(config)
+
+	// return if there are no inbound routes
+	if len(b.Inbound) == 0 {
+		return
+	}
+
+	// prepare inbound routes and patterns
+	b.inbound = topic.NewTree()
+	patterns := make([]string, 0, len(b.Inbound))
+	for i := range b.Inbound {
+		route := &b.Inbound[i]
+		b.inbound.Add(route.Filter, route)
+		patterns = append(patterns, b.Prefix+FilterToPattern(route.Filter))
+	}
+
+	// start subscriber
+	b.done = make(chan struct{})
+	go b.subscribe(patterns)
+}
+
+// Stop will stop the subscriber and disconnect from the broker.
+func (b *RedisBridge) Stop() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// return if not started
+	if b.link == nil {
+		return
+	}
+
+	// stop subscriber
+	if b.done != nil {
+		_ = b.conn.Close()
+		<-b.done
+		b.done = nil
+	}
+
+	// stop link
+	b.link.stop()
+	b.link = nil
+}
+
+func (b *RedisBridge) forward(msg *packet.Message) error {
+	// publish message, the message is not acknowledged on errors and will be
+	// redelivered by the broker
+	return b.conn.Publish(b.Prefix+msg.Topic, msg.Payload)
+}
+
+func (b *RedisBridge) subscribe(patterns []string) {
+	defer close(b.done)
+
+	// subscribe patterns
+	err := b.conn.PSubscribe(patterns, func(channel string, message []byte) {
+		// get topic
+		if !strings.HasPrefix(channel, b.Prefix) {
+			return
+		}
+		name := strings.TrimPrefix(channel, b.Prefix)
+
+		// patterns may match more channels than the filters
+		routes := b.inbound.Match(name)
+		if len(routes) == 0 {
+			return
+		}
+		route := routes[0].(*RedisRoute)
+
+		// publish message
+		err := b.link.publish(&packet.Message{
+			Topic:   name,
+			Payload: message,
+			QOS:     route.QOS,
+			Retain:  route.Retain,
+		})
+		if err != nil && b.ErrorCallback != nil {
+			b.ErrorCallback(err)
+		}
+	})
+	if err != nil && b.ErrorCallback != nil {
+		b.ErrorCallback(err)
+	}
+}
+
+// FilterToPattern translates an MQTT topic filter to a Redis glob pattern.
+// The pattern may match more channels than the filter as "*" also matches
+// slashes.
+func FilterToPattern(filter string) string {
+	levels := strings.Split(filter, "/")
+
+	for i, level := range levels {
+		switch level {
+		case "+":
+			levels[i] = "*"
+		case "#":
+			// "foo/#" also matches "foo"
+			if i > 0 {
+				levels[i-1] += "*"
+				return strings.Join(levels[:i], "/")
+			}
+
+			return "*"
+		default:
+			levels[i] = escapeGlob(level)
+		}
+	}
+
+	return strings.Join(levels, "/")
+}
+
+func escapeGlob(str string) string {
+	var b strings.Builder
+
+	for _, r := range str {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterToPattern(t *testing.T) {
+	assert.Equal(t, "foo/bar", FilterToPattern("foo/bar"))
+	assert.Equal(t, "foo/*/bar", FilterToPattern("foo/+/bar"))
+	assert.Equal(t, "foo*", FilterToPattern("foo/#"))
+	assert.Equal(t, "*", FilterToPattern("#"))
+	assert.Equal(t, `foo/\*\?/\[x\]`, FilterToPattern("foo/*?/[x]"))
+}
+
+type redisMessage struct {
+	channel string
+	message string
+}
+
+type fakeRedis struct {
+	published chan redisMessage
+	incoming  chan redisMessage
+	patterns  chan []string
+	closed    chan struct{}
+}
+
+func (r *fakeRedis) Publish(channel string, message []byte) error {
+	r.published <- redisMessage{channel, string(message)}
+	return nil
+}
+
+func (r *fakeRedis) PSubscribe(patterns []string, handler func(string, []byte)) error {
+	r.patterns <- patterns
+
+	for {
+		select {
+		case msg := <-r.incoming:
+			handler(msg.channel, []byte(msg.message))
+		case <-r.closed:
+			return nil
+		}
+	}
+}
+
+func (r *fakeRedis) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestRedisBridge(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	redis := &fakeRedis{
+		published: make(chan redisMessage, 10),
+		incoming:  make(chan redisMessage, 10),
+		patterns:  make(chan []string, 1),
+		closed:    make(chan struct{}),
+	}
+
+	bridge := NewRedisBridge(redis)
+	bridge.Prefix = "mqtt:"
+	bridge.Outbound = []RedisRoute{
+		{Filter: "devices/+/data", QOS: 1},
+	}
+	bridge.Inbound = []RedisRoute{
+		{Filter: "commands/+", QOS: 1},
+	}
+	bridge.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+	bridge.Start(broker.Config("bridge"))
+	defer bridge.Stop()
+
+	assert.Equal(t, []string{"mqtt:commands/*"}, <-redis.patterns)
+
+	messages := subscribe(t, broker, "commands/#")
+
+	// wait for bridge subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	publish(t, broker, "devices/1/data", []byte("foo"))
+	assert.Equal(t, redisMessage{"mqtt:devices/1/data", "foo"}, <-redis.published)
+
+	// not matched by the filter
+	redis.incoming <- redisMessage{"mqtt:commands/1/x", "bar"}
+
+	redis.incoming <- redisMessage{"mqtt:commands/1", "baz"}
+	msg := <-messages
+	assert.Equal(t, "commands/1", msg.Topic)
+	assert.Equal(t, []byte("baz"), msg.Payload)
+}
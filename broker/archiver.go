@@ -0,0 +1,247 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrArchiveQueueFull is emitted if a message is dropped because the archive
+// queue is full.
+var ErrArchiveQueueFull = errors.New("archive queue full")
+
+// An ArchivedMessage is a published message passed to an Archiver.
+type ArchivedMessage struct {
+	Topic    string
+	Payload  []byte
+	QOS      packet.QOS
+	Retain   bool
+	ClientID string
+	Time     time.Time
+}
+
+// An Archiver stores batches of published messages.
+type Archiver interface {
+	Archive(msgs []ArchivedMessage) error
+}
+
+// DropPolicy defines which message is dropped if the archive queue is full.
+type DropPolicy int
+
+// The available drop policies.
+const (
+	// DropNewest drops the message that is being published.
+	DropNewest DropPolicy = iota
+
+	// DropOldest drops the oldest queued message.
+	DropOldest
+)
+
+// An ArchiveBackend wraps another backend and passes all successfully
+// published messages in batches to an Archiver. The archiver is called from a
+// single goroutine and never blocks publishing clients. Messages are dropped
+// according to the drop policy if the queue is full.
+type ArchiveBackend struct {
+	Backend
+
+	// The maximum number of messages passed to the archiver at once.
+	//
+	// Will default to 100.
+	BatchSize int
+
+	// The maximum time a message is queued before the batch is archived.
+	//
+	// Will default to one second.
+	FlushInterval time.Duration
+
+	// The maximum number of queued messages.
+	//
+	// Will default to 10000.
+	QueueSize int
+
+	// The policy used if the queue is full.
+	DropPolicy DropPolicy
+
+	// The callback that is called with dropped messages and archiver errors.
+	ErrorCallback func(error)
+
+	archiver Archiver
+	queue    chan ArchivedMessage
+	done     chan struct{}
+	once     sync.Once
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// NewArchiveBackend returns a new ArchiveBackend that wraps the specified
+// backend and uses the specified archiver.
+func NewArchiveBackend(backend Backend, archiver Archiver) *ArchiveBackend {
+	return &ArchiveBackend{
+		Backend:       backend,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		QueueSize:     10000,
+		archiver:      archiver,
+	}
+}
+
+// Publish will publish the message using the wrapped backend and queue it
+// for archiving.
+func (a *ArchiveBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// the wrapped backend may modify the message
+	archived := ArchivedMessage{
+		Topic:    msg.Topic,
+		Payload:  msg.Payload,
+		QOS:      msg.QOS,
+		Retain:   msg.Retain,
+		ClientID: client.ID(),
+		Time:     time.Now(),
+	}
+
+	// publish message
+	err := a.Backend.Publish(client, msg, ack)
+	if err != nil {
+		return err
+	}
+
+	// start worker
+	a.once.Do(a.start)
+
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// check if closed
+	if a.closed {
+		return nil
+	}
+
+	// queue message
+	select {
+	case a.queue <- archived:
+		return nil
+	default:
+	}
+
+	// drop newest
+	if a.DropPolicy == DropNewest {
+		a.error(ErrArchiveQueueFull)
+		return nil
+	}
+
+	// drop oldest
+	select {
+	case <-a.queue:
+		a.error(ErrArchiveQueueFull)
+	default:
+	}
+
+	// queue message, the mutex guarantees that there is space
+	select {
+	case a.queue <- archived:
+	default:
+		a.error(ErrArchiveQueueFull)
+	}
+
+	return nil
+}
+
+// Close implements the Closer interface. After the wrapped backend has been
+// closed, it waits until the queued messages have been archived.
+func (a *ArchiveBackend) Close(timeout time.Duration) bool {
+	// get deadline
+	deadline := time.Now().Add(timeout)
+
+	// close wrapped backend
+	if !closeBackend(a.Backend, timeout) {
+		return false
+	}
+
+	// make sure worker is started
+	a.once.Do(a.start)
+
+	// stop queueing
+	a.mutex.Lock()
+	if !a.closed {
+		close(a.queue)
+		a.closed = true
+	}
+	a.mutex.Unlock()
+
+	// wait for worker
+	select {
+	case <-a.done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
+
+func (a *ArchiveBackend) start() {
+	a.queue = make(chan ArchivedMessage, a.QueueSize)
+	a.done = make(chan struct{})
+
+	go a.worker()
+}
+
+func (a *ArchiveBackend) worker() {
+	defer close(a.done)
+
+	// prepare batch and timer
+	batch := make([]ArchivedMessage, 0, a.BatchSize)
+	timer := time.NewTimer(a.FlushInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case msg, ok := <-a.queue:
+			// archive remaining messages if closed
+			if !ok {
+				a.archive(batch)
+				return
+			}
+
+			// add message
+			batch = append(batch, msg)
+			if len(batch) < a.BatchSize {
+				continue
+			}
+		case <-timer.C:
+		}
+
+		// archive batch
+		batch = a.archive(batch)
+
+		// reset timer
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(a.FlushInterval)
+	}
+}
+
+func (a *ArchiveBackend) archive(batch []ArchivedMessage) []ArchivedMessage {
+	// check batch
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// archive batch
+	err := a.archiver.Archive(batch)
+	if err != nil {
+		a.error(err)
+	}
+
+	return make([]ArchivedMessage, 0, a.BatchSize)
+}
+
+func (a *ArchiveBackend) error(err error) {
+	if a.ErrorCallback != nil {
+		a.ErrorCallback(err)
+	}
+}
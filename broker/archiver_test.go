@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testArchiver struct {
+	batches [][]ArchivedMessage
+	block   chan struct{}
+	err     error
+	mutex   sync.Mutex
+}
+
+func (a *testArchiver) Archive(msgs []ArchivedMessage) error {
+	if a.block != nil {
+		<-a.block
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.batches = append(a.batches, msgs)
+
+	return a.err
+}
+
+func (a *testArchiver) topics() [][]string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var list [][]string
+	for _, batch := range a.batches {
+		var topics []string
+		for _, msg := range batch {
+			topics = append(topics, msg.Topic)
+		}
+		list = append(list, topics)
+	}
+
+	return list
+}
+
+func publishN(t *testing.T, port string, topics ...string) {
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfigWithClientID("tcp://localhost:"+port, "publisher"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for _, topic := range topics {
+		pf, err := publisher.Publish(topic, []byte("bar"), 1, true)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	assert.NoError(t, publisher.Disconnect())
+}
+
+func TestArchiveBackend(t *testing.T) {
+	archiver := &testArchiver{}
+
+	backend := NewArchiveBackend(NewMemoryBackend(), archiver)
+	backend.BatchSize = 2
+	backend.FlushInterval = time.Hour
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	publishN(t, port, "a", "b", "c")
+
+	close(quit)
+	safeReceive(done)
+
+	assert.True(t, backend.Close(time.Second))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, archiver.topics())
+
+	msg := archiver.batches[0][0]
+	assert.Equal(t, []byte("bar"), msg.Payload)
+	assert.Equal(t, 1, int(msg.QOS))
+	assert.True(t, msg.Retain)
+	assert.Equal(t, "publisher", msg.ClientID)
+	assert.False(t, msg.Time.IsZero())
+}
+
+func TestArchiveBackendFlushInterval(t *testing.T) {
+	archiver := &testArchiver{}
+
+	backend := NewArchiveBackend(NewMemoryBackend(), archiver)
+	backend.FlushInterval = 10 * time.Millisecond
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	publishN(t, port, "a")
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, [][]string{{"a"}}, archiver.topics())
+
+	close(quit)
+	safeReceive(done)
+
+	assert.True(t, backend.Close(time.Second))
+}
+
+func TestArchiveBackendDropPolicy(t *testing.T) {
+	for _, policy := range []DropPolicy{DropNewest, DropOldest} {
+		archiver := &testArchiver{
+			block: make(chan struct{}),
+			err:   errors.New("failed"),
+		}
+
+		var errs []error
+
+		backend := NewArchiveBackend(NewMemoryBackend(), archiver)
+		backend.BatchSize = 1
+		backend.QueueSize = 1
+		backend.DropPolicy = policy
+		backend.ErrorCallback = func(err error) {
+			errs = append(errs, err)
+		}
+
+		port, quit, done := Run(NewEngine(backend), "tcp")
+
+		// the first message blocks the archiver
+		publishN(t, port, "a")
+		time.Sleep(10 * time.Millisecond)
+		publishN(t, port, "b", "c")
+
+		close(quit)
+		safeReceive(done)
+
+		close(archiver.block)
+		assert.True(t, backend.Close(time.Second))
+
+		if policy == DropNewest {
+			assert.Equal(t, [][]string{{"a"}, {"b"}}, archiver.topics())
+		} else {
+			assert.Equal(t, [][]string{{"a"}, {"c"}}, archiver.topics())
+		}
+
+		assert.Equal(t, []error{ErrArchiveQueueFull, archiver.err, archiver.err}, errs)
+	}
+}
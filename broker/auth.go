@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// An Authorizer decides which topics a client may publish to and which
+// filters it may subscribe to.
+type Authorizer interface {
+	// AuthorizePublish should return whether the client may publish to the
+	// specified topic.
+	AuthorizePublish(client *Client, topic string) bool
+
+	// AuthorizeSubscribe should return whether the client may subscribe to the
+	// specified filter.
+	AuthorizeSubscribe(client *Client, filter string) bool
+}
+
+// An Identity describes an authenticated client and the topics it may use.
+type Identity struct {
+	// The name of the authenticated user or device.
+	Subject string
+
+	// The groups the subject is a member of.
+	Groups []string
+
+	// Additional attributes provided by the authenticator.
+	Attributes map[string]interface{}
+
+	// The filters that cover the topics the client may publish to. A nil
+	// list does not restrict publishing.
+	Publish []string
+
+	// The filters that cover the filters the client may subscribe to. A nil
+	// list does not restrict subscribing.
+	Subscribe []string
+
+	// The policy that restricts the wildcards the client may use in the
+	// filters it subscribes to. A nil policy allows all wildcards.
+	Wildcards *WildcardPolicy
+
+	// An additional authorizer that must also permit the topics and filters,
+	// e.g. an auth.ACLFile.
+	Authorizer Authorizer
+}
+
+// AuthorizePublish implements the Authorizer interface.
+func (i *Identity) AuthorizePublish(client *Client, topic string) bool {
+	return covered(i.Publish, topic) && (i.Authorizer == nil || i.Authorizer.AuthorizePublish(client, topic))
+}
+
+// AuthorizeSubscribe implements the Authorizer interface.
+func (i *Identity) AuthorizeSubscribe(client *Client, filter string) bool {
+	return covered(i.Subscribe, filter) && (i.Wildcards == nil || i.Wildcards.Allows(filter)) && (i.Authorizer == nil || i.Authorizer.AuthorizeSubscribe(client, filter))
+}
+
+func covered(filters []string, filter string) bool {
+	// check list
+	if filters == nil {
+		return true
+	}
+
+	// check filters
+	for _, f := range filters {
+		if topic.Covers(f, filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// An Authenticator verifies the credentials of a client.
+type Authenticator interface {
+	// Authenticate should return the identity of the client or nil if the
+	// credentials are invalid. Errors should only be returned if the
+	// credentials could not be verified.
+	Authenticate(client *Client, user, password string) (*Identity, error)
+}
+
+// An AuthBackend wraps another backend and authenticates clients using an
+// Authenticator. The returned identity is set as the authorizer of the client
+// and can be retrieved using ClientIdentity.
+type AuthBackend struct {
+	Backend
+
+	// Authorizer may be set to add an authorizer to the identities of all
+	// authenticated clients that do not already have one, e.g. an
+	// auth.ACLFile.
+	Authorizer Authorizer
+
+	authenticator Authenticator
+}
+
+// NewAuthBackend returns a new AuthBackend that wraps the specified backend
+// and uses the specified authenticator.
+func NewAuthBackend(backend Backend, authenticator Authenticator) *AuthBackend {
+	return &AuthBackend{
+		Backend:       backend,
+		authenticator: authenticator,
+	}
+}
+
+// Authenticate will authenticate the client using the authenticator.
+func (a *AuthBackend) Authenticate(client *Client, user, password string) (bool, error) {
+	return authenticate(client, user, password, a.authenticator, a.Authorizer)
+}
+
+// Close implements the Closer interface for the wrapped backend.
+func (a *AuthBackend) Close(timeout time.Duration) bool {
+	return closeBackend(a.Backend, timeout)
+}
+
+// authenticate will authenticate the client using the authenticator and set
+// the returned identity as the authorizer of the client. The authorizer is
+// added to identities that do not already have one.
+func authenticate(client *Client, user, password string, authenticator Authenticator, authorizer Authorizer) (bool, error) {
+	// authenticate client
+	identity, err := authenticator.Authenticate(client, user, password)
+	if err != nil || identity == nil {
+		return false, err
+	}
+
+	// add authorizer to a copy of the identity
+	if authorizer != nil && identity.Authorizer == nil {
+		copied := *identity
+		copied.Authorizer = authorizer
+		identity = &copied
+	}
+
+	// set authorizer
+	client.Authorizer = identity
+
+	return true, nil
+}
+
+// ClientIdentity returns the identity of a client that has been authenticated
+// using an AuthBackend or nil.
+func ClientIdentity(client *Client) *Identity {
+	identity, _ := client.Authorizer.(*Identity)
+	return identity
+}
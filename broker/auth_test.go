@@ -0,0 +1,168 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testAuthenticator struct {
+	identity *Identity
+	client   *Client
+}
+
+func (a *testAuthenticator) Authenticate(client *Client, user, password string) (*Identity, error) {
+	if user != "device" || password != "secret" {
+		return nil, nil
+	}
+
+	a.client = client
+
+	return a.identity, nil
+}
+
+func TestIdentity(t *testing.T) {
+	identity := &Identity{
+		Publish:   []string{"devices/d1/#"},
+		Subscribe: []string{"devices/d1/+"},
+	}
+
+	assert.True(t, identity.AuthorizePublish(nil, "devices/d1"))
+	assert.True(t, identity.AuthorizePublish(nil, "devices/d1/foo/bar"))
+	assert.False(t, identity.AuthorizePublish(nil, "devices/d2/foo"))
+	assert.True(t, identity.AuthorizeSubscribe(nil, "devices/d1/+"))
+	assert.False(t, identity.AuthorizeSubscribe(nil, "devices/d1/#"))
+
+	identity.Subscribe = nil
+	identity.Wildcards = &WildcardPolicy{ForbidMultiLevel: true}
+	assert.True(t, identity.AuthorizeSubscribe(nil, "devices/+/foo"))
+	assert.False(t, identity.AuthorizeSubscribe(nil, "devices/#"))
+	identity.Wildcards = nil
+
+	identity.Publish = nil
+	identity.Subscribe = []string{}
+	assert.True(t, identity.AuthorizePublish(nil, "foo"))
+	assert.False(t, identity.AuthorizeSubscribe(nil, "foo"))
+}
+
+func TestAuthBackendDenied(t *testing.T) {
+	backend := NewAuthBackend(NewMemoryBackend(), &testAuthenticator{})
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "device"
+	connect.Password = "invalid"
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.NotAuthorized
+
+	err = flow.New().
+		Send(connect).
+		Receive(connack).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.True(t, backend.Close(5*time.Second))
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestAuthBackendSubscribe(t *testing.T) {
+	authenticator := &testAuthenticator{
+		identity: &Identity{
+			Subject:   "d1",
+			Subscribe: []string{"devices/d1/+"},
+		},
+	}
+
+	backend := NewAuthBackend(NewMemoryBackend(), authenticator)
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "device"
+	connect.Password = "secret"
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "devices/d1/cmd", QOS: 1},
+			{Topic: "devices/#", QOS: 1},
+		}}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{1, packet.QOSFailure}}).
+		Send(&packet.Subscribe{ID: 2, Subscriptions: []packet.Subscription{
+			{Topic: "devices/d2/cmd", QOS: 1},
+		}}).
+		Receive(&packet.Suback{ID: 2, ReturnCodes: []packet.QOS{packet.QOSFailure}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "d1", ClientIdentity(authenticator.client).Subject)
+
+	assert.True(t, backend.Close(5*time.Second))
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestAuthBackendPublish(t *testing.T) {
+	authenticator := &testAuthenticator{
+		identity: &Identity{
+			Publish: []string{"devices/d1/#"},
+		},
+	}
+
+	backend := NewAuthBackend(NewMemoryBackend(), authenticator)
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "device"
+	connect.Password = "secret"
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "#", QOS: 0},
+		}}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "other", Payload: []byte("0")}}).
+		Send(&packet.Publish{ID: 2, Message: packet.Message{Topic: "other", Payload: []byte("1"), QOS: 1}}).
+		Receive(&packet.Puback{ID: 2}).
+		Send(&packet.Publish{ID: 3, Message: packet.Message{Topic: "other", Payload: []byte("2"), QOS: 2}}).
+		Receive(&packet.Pubrec{ID: 3}).
+		Send(&packet.Pubrel{ID: 3}).
+		Receive(&packet.Pubcomp{ID: 3}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "devices/d1/state", Payload: []byte("ok")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "devices/d1/state", Payload: []byte("ok")}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.True(t, backend.Close(5*time.Second))
+
+	close(quit)
+	safeReceive(done)
+}
@@ -2,7 +2,11 @@ package broker
 
 import (
 	"errors"
+	"hash/fnv"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
@@ -17,7 +21,58 @@ type memorySession struct {
 	stored        chan *packet.Message
 	temporary     chan *packet.Message
 
+	priorityStored    chan *packet.Message
+	priorityTemporary chan *packet.Message
+
 	owner *Client
+	shard *memoryShard
+	mutex sync.Mutex
+
+	storedTimes            queueTimes
+	temporaryTimes         queueTimes
+	priorityStoredTimes    queueTimes
+	priorityTemporaryTimes queueTimes
+	lag                    time.Duration
+}
+
+// queueTimes tracks the enqueue times of the messages in a queue. As messages
+// are added to the queue before their time is tracked, a dequeue may happen
+// before the time has been pushed, in which case the time is skipped.
+type queueTimes struct {
+	times []time.Time
+	skip  int
+}
+
+func (q *queueTimes) push(t time.Time) {
+	// skip time of already dequeued message
+	if q.skip > 0 {
+		q.skip--
+		return
+	}
+
+	q.times = append(q.times, t)
+}
+
+func (q *queueTimes) pop() (time.Time, bool) {
+	// skip next time if not yet pushed
+	if len(q.times) == 0 {
+		q.skip++
+		return time.Time{}, false
+	}
+
+	// get and remove time
+	t := q.times[0]
+	q.times = q.times[1:]
+
+	return t, true
+}
+
+func (q *queueTimes) oldest() (time.Time, bool) {
+	if len(q.times) == 0 {
+		return time.Time{}, false
+	}
+
+	return q.times[0], true
 }
 
 func newMemorySession(backlog int) *memorySession {
@@ -26,6 +81,9 @@ func newMemorySession(backlog int) *memorySession {
 		subscriptions: topic.NewTree(),
 		stored:        make(chan *packet.Message, backlog),
 		temporary:     make(chan *packet.Message, backlog),
+
+		priorityStored:    make(chan *packet.Message, backlog),
+		priorityTemporary: make(chan *packet.Message, backlog),
 	}
 }
 
@@ -54,8 +112,289 @@ func (s *memorySession) applyQOS(msg *packet.Message) *packet.Message {
 	return msg
 }
 
-func (s *memorySession) reuse() {
+func (s *memorySession) reuse(owner *Client) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// replace temporary queues
 	s.temporary = make(chan *packet.Message, cap(s.temporary))
+	s.temporaryTimes = queueTimes{}
+	s.priorityTemporary = make(chan *packet.Message, cap(s.priorityTemporary))
+	s.priorityTemporaryTimes = queueTimes{}
+	s.owner = owner
+}
+
+func (s *memorySession) getOwner() *Client {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.owner
+}
+
+func (s *memorySession) setOwner(owner *Client) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.owner = owner
+}
+
+// target returns the owner and the queue used for messages with the
+// specified QOS level and priority.
+func (s *memorySession) target(qos packet.QOS, priority bool) (*Client, chan *packet.Message) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// use stored queue if qos > 0
+	if qos > 0 {
+		if priority {
+			return s.owner, s.priorityStored
+		}
+
+		return s.owner, s.stored
+	}
+
+	if priority {
+		return s.owner, s.priorityTemporary
+	}
+
+	return s.owner, s.temporary
+}
+
+// times returns the tracked times of the queue.
+func (s *memorySession) times(queue chan *packet.Message) *queueTimes {
+	switch queue {
+	case s.stored:
+		return &s.storedTimes
+	case s.temporary:
+		return &s.temporaryTimes
+	case s.priorityStored:
+		return &s.priorityStoredTimes
+	case s.priorityTemporary:
+		return &s.priorityTemporaryTimes
+	}
+
+	return nil
+}
+
+// enqueued tracks a message that has been added to the queue.
+func (s *memorySession) enqueued(queue chan *packet.Message) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// push time
+	if times := s.times(queue); times != nil {
+		times.push(time.Now())
+	}
+}
+
+// dequeued tracks a message that has been removed from the queue, updates
+// the delivery lag and returns the time the message has been queued.
+func (s *memorySession) dequeued(queue chan *packet.Message) time.Duration {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// pop time
+	if times := s.times(queue); times != nil {
+		if t, ok := times.pop(); ok {
+			s.lag = time.Since(t)
+			return s.lag
+		}
+	}
+
+	return 0
+}
+
+// stats returns the queue statistics of the session.
+func (s *memorySession) stats() SessionStats {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// prepare stats
+	stats := SessionStats{
+		Connected: s.owner != nil,
+		Queued:    s.queued(),
+		Lag:       s.lag,
+	}
+
+	// get oldest time
+	var oldest time.Time
+	for _, times := range []*queueTimes{&s.storedTimes, &s.temporaryTimes, &s.priorityStoredTimes, &s.priorityTemporaryTimes} {
+		if t, ok := times.oldest(); ok && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+
+	// set age
+	if !oldest.IsZero() && stats.Queued > 0 {
+		stats.OldestAge = time.Since(oldest)
+	}
+
+	return stats
+}
+
+// inflight returns the number of queued messages.
+func (s *memorySession) inflight() int {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.queued()
+}
+
+// queued returns the number of messages in all queues. The mutex must be held.
+func (s *memorySession) queued() int {
+	return len(s.stored) + len(s.temporary) + len(s.priorityStored) + len(s.priorityTemporary)
+}
+
+// memoryShards is the number of shards used by the MemoryBackend.
+const memoryShards = 16
+
+// A memoryShard holds the clients and sessions of a subset of client IDs.
+type memoryShard struct {
+	activeClients     map[string]*Client
+	storedSessions    map[string]*memorySession
+	temporarySessions map[*Client]*memorySession
+
+	mutex      sync.Mutex
+	setupMutex sync.Mutex
+}
+
+func newMemoryShard() *memoryShard {
+	return &memoryShard{
+		activeClients:     make(map[string]*Client),
+		storedSessions:    make(map[string]*memorySession),
+		temporarySessions: make(map[*Client]*memorySession),
+	}
+}
+
+// sessions returns all sessions that have a subscription matching the topic.
+func (s *memoryShard) sessions(topic string) []*memorySession {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// collect temporary sessions
+	var list []*memorySession
+	for _, sess := range s.temporarySessions {
+		if sub := sess.lookupSubscription(topic); sub != nil {
+			list = append(list, sess)
+		}
+	}
+
+	// collect stored sessions
+	for _, sess := range s.storedSessions {
+		if sub := sess.lookupSubscription(topic); sub != nil {
+			list = append(list, sess)
+		}
+	}
+
+	return list
+}
+
+// collect adds the subscriptions of all sessions to the tree using the client
+// ids as values.
+func (s *memoryShard) collect(tree *topic.Tree) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// add subscriptions of temporary sessions
+	for client, sess := range s.temporarySessions {
+		for _, value := range sess.subscriptions.All() {
+			tree.Add(value.(packet.Subscription).Topic, client.ID())
+		}
+	}
+
+	// add subscriptions of stored sessions
+	for id, sess := range s.storedSessions {
+		for _, value := range sess.subscriptions.All() {
+			tree.Add(value.(packet.Subscription).Topic, id)
+		}
+	}
+}
+
+// owners returns the owners of all sessions.
+func (s *memoryShard) owners() []*Client {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// collect owners
+	var list []*Client
+	for _, sess := range s.temporarySessions {
+		if owner := sess.getOwner(); owner != nil {
+			list = append(list, owner)
+		}
+	}
+	for _, sess := range s.storedSessions {
+		if owner := sess.getOwner(); owner != nil {
+			list = append(list, owner)
+		}
+	}
+
+	return list
+}
+
+type sharedMember struct {
+	id   string
+	sess *memorySession
+	sub  packet.Subscription
+}
+
+type sharedGroup struct {
+	name    string
+	filter  string
+	members []*sharedMember
+}
+
+func (g *sharedGroup) join(id string, sess *memorySession, sub packet.Subscription) {
+	// update existing member
+	for _, member := range g.members {
+		if member.sess == sess {
+			member.sub = sub
+			return
+		}
+	}
+
+	// add member
+	g.members = append(g.members, &sharedMember{
+		id:   id,
+		sess: sess,
+		sub:  sub,
+	})
+}
+
+func (g *sharedGroup) leave(sess *memorySession) {
+	for i, member := range g.members {
+		if member.sess == sess {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// parseShared will split a shared subscription topic in the form of
+// "$share/group/filter" in its group name and filter.
+func parseShared(topic string) (string, string, bool) {
+	// check prefix
+	if !strings.HasPrefix(topic, "$share/") {
+		return "", "", false
+	}
+
+	// split group and filter
+	segments := strings.SplitN(strings.TrimPrefix(topic, "$share/"), "/", 2)
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return "", "", false
+	}
+
+	return segments[0], segments[1], true
 }
 
 // ErrQueueFull is returned to a client that attempts two write to its own full
@@ -69,7 +408,9 @@ var ErrClosing = errors.New("closing")
 // in time.
 var ErrKillTimeout = errors.New("kill timeout")
 
-// A MemoryBackend stores everything in memory.
+// A MemoryBackend stores everything in memory. Clients and sessions are
+// sharded by their hashed client ID to allow concurrent connects and
+// publishes.
 type MemoryBackend struct {
 	// The maximal size of the session queue.
 	//
@@ -88,43 +429,109 @@ type MemoryBackend struct {
 	ClientParallelSubscribes int
 	ClientInflightMessages   int
 	ClientTokenTimeout       time.Duration
+	ClientMaximumTopicLevels int
+	ClientMaximumTopicLength int
+
+	// The strategy used to pick the receiving member of a shared subscription
+	// group in the form of "$share/group/filter".
+	//
+	// Will default to a round-robin strategy.
+	SharedStrategy Strategy
+
+	// Strategies that are used instead of SharedStrategy for groups whose name
+	// begins with the key. The longest matching prefix wins.
+	SharedStrategies map[string]Strategy
 
 	// A map of username and passwords that grant read and write access.
 	Credentials map[string]string
 
+	// The limits that cap the retained messages. A limit with an empty prefix
+	// applies to all messages. The limits should not be changed once messages
+	// have been retained.
+	//
+	// Will default to no limits.
+	RetainedLimits []RetainedLimit
+
+	// The durations after which retained messages expire, keyed by topic
+	// filters. If several filters match a topic, the shortest duration is
+	// used.
+	//
+	// Will default to retaining messages until they are cleared.
+	RetainedTTLs map[string]time.Duration
+
+	// The filters that cover the topics of priority messages, e.g. commands.
+	// Queued priority messages are dequeued before other messages, which lets
+	// them overtake bulk messages like telemetry if the connection of a
+	// subscriber is congested. The order of priority messages relative to
+	// other messages is not retained.
+	//
+	// Will default to no priority topics.
+	PriorityTopics []string
+
+	// The duration after which queued messages are discarded instead of being
+	// delivered, e.g. to not deliver week-old commands to devices that finally
+	// reconnect. As the messages of connected clients are usually dequeued
+	// immediately, the TTL mainly applies to messages queued for offline
+	// sessions. Discarded messages are logged using the MessageExpired event.
+	//
+	// Will default to no expiry.
+	OfflineMessageTTL time.Duration
+
 	// The Logger callback handles incoming log events.
 	Logger func(LogEvent, *Client, packet.Generic, *packet.Message, error)
 
-	activeClients     map[string]*Client
-	storedSessions    map[string]*memorySession
-	temporarySessions map[*Client]*memorySession
-	retainedMessages  *topic.Tree
+	shards           []*memoryShard
+	anonymous        uint32
+	retainedMessages *retainedStore
+	sharedGroups     map[string]*sharedGroup
+	sharedFilters    *topic.Tree
 
-	globalMutex sync.Mutex
-	setupMutex  sync.Mutex
-	closing     bool
+	groupMutex sync.Mutex
+	closing    uint32
 }
 
 // NewMemoryBackend returns a new MemoryBackend.
 func NewMemoryBackend() *MemoryBackend {
+	// prepare shards
+	shards := make([]*memoryShard, memoryShards)
+	for i := range shards {
+		shards[i] = newMemoryShard()
+	}
+
 	return &MemoryBackend{
-		SessionQueueSize:  100,
-		KillTimeout:       5 * time.Second,
-		activeClients:     make(map[string]*Client),
-		storedSessions:    make(map[string]*memorySession),
-		temporarySessions: make(map[*Client]*memorySession),
-		retainedMessages:  topic.NewTree(),
+		SessionQueueSize: 100,
+		KillTimeout:      5 * time.Second,
+		SharedStrategy:   NewRoundRobinStrategy(),
+		shards:           shards,
+		retainedMessages: newRetainedStore(),
+		sharedGroups:     make(map[string]*sharedGroup),
+		sharedFilters:    topic.NewTree(),
 	}
 }
 
+// shard returns the shard for the client ID. Clients without an ID are
+// distributed over all shards.
+func (m *MemoryBackend) shard(id string) *memoryShard {
+	// distribute anonymous clients
+	if len(id) == 0 {
+		return m.shards[atomic.AddUint32(&m.anonymous, 1)%uint32(len(m.shards))]
+	}
+
+	// hash id
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(id))
+
+	return m.shards[hash.Sum32()%uint32(len(m.shards))]
+}
+
+func (m *MemoryBackend) isClosing() bool {
+	return atomic.LoadUint32(&m.closing) == 1
+}
+
 // Authenticate will authenticates a clients credentials.
 func (m *MemoryBackend) Authenticate(client *Client, user, password string) (bool, error) {
-	// acquire global mutex
-	m.globalMutex.Lock()
-	defer m.globalMutex.Unlock()
-
 	// return error if closing
-	if m.closing {
+	if m.isClosing() {
 		return false, ErrClosing
 	}
 
@@ -143,16 +550,19 @@ func (m *MemoryBackend) Authenticate(client *Client, user, password string) (boo
 
 // Setup will close existing clients and return an appropriate session.
 func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, bool, error) {
+	// get shard
+	shard := m.shard(id)
+
 	// acquire setup mutex
-	m.setupMutex.Lock()
-	defer m.setupMutex.Unlock()
+	shard.setupMutex.Lock()
+	defer shard.setupMutex.Unlock()
 
-	// acquire global mutex
-	m.globalMutex.Lock()
-	defer m.globalMutex.Unlock()
+	// acquire shard mutex
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
 	// return error if closing
-	if m.closing {
+	if m.isClosing() {
 		return nil, false, ErrClosing
 	}
 
@@ -162,84 +572,61 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 	client.ParallelSubscribes = m.ClientParallelSubscribes
 	client.InflightMessages = m.ClientInflightMessages
 	client.TokenTimeout = m.ClientTokenTimeout
+	client.MaximumTopicLevels = m.ClientMaximumTopicLevels
+	client.MaximumTopicLength = m.ClientMaximumTopicLength
 
 	// return a new temporary session if id is zero
 	if len(id) == 0 {
 		// create session
 		sess := newMemorySession(m.SessionQueueSize)
 		sess.owner = client
+		sess.shard = shard
 
 		// save session
-		m.temporarySessions[client] = sess
+		shard.temporarySessions[client] = sess
 
 		return sess, false, nil
 	}
 
 	// client id is available
 
-	// retrieve existing client
-	existingSession, ok := m.storedSessions[id]
-	if !ok {
-		if existingClient, ok2 := m.activeClients[id]; ok2 {
-			existingSession, ok = m.temporarySessions[existingClient]
-		}
-	}
-
-	// kill existing client if session is taken
-	if ok && existingSession.owner != nil {
-		// close client
-		existingSession.owner.Close()
-
-		// release global mutex to allow publish and termination, but leave the
-		// setup mutex to prevent setups
-		m.globalMutex.Unlock()
-
-		// wait for client to close
-		var err error
-		select {
-		case <-existingSession.owner.Closed():
-			// continue
-		case <-time.After(m.KillTimeout):
-			err = ErrKillTimeout
-		}
-
-		// acquire mutex again
-		m.globalMutex.Lock()
-
-		// return err if set
-		if err != nil {
-			return nil, false, err
-		}
+	// kill existing client
+	err := m.kill(shard, id)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// delete any stored session and return a temporary session if a clean
 	// session is requested
 	if clean {
 		// delete any stored session
-		delete(m.storedSessions, id)
+		if storedSession, ok := shard.storedSessions[id]; ok {
+			m.leaveGroups(storedSession)
+			delete(shard.storedSessions, id)
+		}
 
 		// create new session
 		sess := newMemorySession(m.SessionQueueSize)
 		sess.owner = client
+		sess.shard = shard
 
 		// save session
-		m.temporarySessions[client] = sess
+		shard.temporarySessions[client] = sess
 
 		// save client
-		m.activeClients[id] = client
+		shard.activeClients[id] = client
 
 		return sess, false, nil
 	}
 
 	// attempt to reuse a stored session
-	storedSession, ok := m.storedSessions[id]
+	storedSession, ok := shard.storedSessions[id]
 	if ok {
 		// reuse session
-		storedSession.reuse()
-		storedSession.owner = client
+		storedSession.reuse(client)
 
 		// save client
-		m.activeClients[id] = client
+		shard.activeClients[id] = client
 
 		return storedSession, true, nil
 	}
@@ -247,16 +634,200 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 	// otherwise create fresh session
 	storedSession = newMemorySession(m.SessionQueueSize)
 	storedSession.owner = client
+	storedSession.shard = shard
 
 	// save session
-	m.storedSessions[id] = storedSession
+	shard.storedSessions[id] = storedSession
 
 	// save client
-	m.activeClients[id] = client
+	shard.activeClients[id] = client
 
 	return storedSession, false, nil
 }
 
+// kill will close the client that uses the session with the specified id and
+// wait for it to exit. The setup and shard mutex must be held.
+func (m *MemoryBackend) kill(shard *memoryShard, id string) error {
+	// retrieve existing client
+	existingSession, ok := shard.storedSessions[id]
+	if !ok {
+		if existingClient, ok2 := shard.activeClients[id]; ok2 {
+			existingSession, ok = shard.temporarySessions[existingClient]
+		}
+	}
+
+	// get owner
+	var owner *Client
+	if ok {
+		owner = existingSession.getOwner()
+	}
+	if owner == nil {
+		return nil
+	}
+
+	// close client
+	owner.Close()
+
+	// release shard mutex to allow termination, but leave the setup mutex
+	// to prevent setups
+	shard.mutex.Unlock()
+
+	// wait for client to close
+	var err error
+	select {
+	case <-owner.Closed():
+		// continue
+	case <-time.After(m.KillTimeout):
+		err = ErrKillTimeout
+	}
+
+	// acquire mutex again
+	shard.mutex.Lock()
+
+	return err
+}
+
+// ExportSession will close the client that uses the session with the specified
+// id and remove and return the stored session. Shared subscriptions and
+// inflight packets are not exported. Nil is returned if no session is stored.
+func (m *MemoryBackend) ExportSession(id string) (*SessionState, error) {
+	// get shard
+	shard := m.shard(id)
+
+	// acquire setup mutex
+	shard.setupMutex.Lock()
+	defer shard.setupMutex.Unlock()
+
+	// acquire shard mutex
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	// kill existing client
+	err := m.kill(shard, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// get stored session
+	sess, ok := shard.storedSessions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	// remove session
+	m.leaveGroups(sess)
+	delete(shard.storedSessions, id)
+
+	// prepare state
+	state := &SessionState{
+		ID: id,
+	}
+
+	// collect subscriptions
+	for _, value := range sess.subscriptions.All() {
+		state.Subscriptions = append(state.Subscriptions, value.(packet.Subscription))
+	}
+
+	// drain queues
+	for _, queue := range []chan *packet.Message{sess.priorityStored, sess.stored} {
+		for len(queue) > 0 {
+			state.Messages = append(state.Messages, <-queue)
+		}
+	}
+
+	return state, nil
+}
+
+// SubscriptionTree returns a tree of the subscriptions of all sessions. The
+// values of the tree are the ids of the subscribing clients. Shared
+// subscriptions are added with their group prefix.
+func (m *MemoryBackend) SubscriptionTree() *topic.Tree {
+	// prepare tree
+	tree := topic.NewTree()
+
+	// add subscriptions of sessions
+	for _, shard := range m.shards {
+		shard.collect(tree)
+	}
+
+	// acquire group mutex
+	m.groupMutex.Lock()
+	defer m.groupMutex.Unlock()
+
+	// add shared subscriptions
+	for _, group := range m.sharedGroups {
+		for _, member := range group.members {
+			tree.Add("$share/"+group.name+"/"+group.filter, member.id)
+		}
+	}
+
+	return tree
+}
+
+// ExportSessions will close the clients that use stored sessions and remove
+// and return all stored sessions. See ExportSession for details.
+func (m *MemoryBackend) ExportSessions() ([]*SessionState, error) {
+	// collect ids
+	var ids []string
+	for _, shard := range m.shards {
+		shard.mutex.Lock()
+		for id := range shard.storedSessions {
+			ids = append(ids, id)
+		}
+		shard.mutex.Unlock()
+	}
+
+	// export sessions
+	var states []*SessionState
+	for _, id := range ids {
+		state, err := m.ExportSession(id)
+		if err != nil {
+			return nil, err
+		} else if state != nil {
+			states = append(states, state)
+		}
+	}
+
+	return states, nil
+}
+
+// ImportSession will store the session so that it is resumed by the next
+// client that connects with the same id. Messages that do not fit into the
+// queue are dropped.
+func (m *MemoryBackend) ImportSession(state *SessionState) error {
+	// get shard
+	shard := m.shard(state.ID)
+
+	// acquire shard mutex
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	// get or create stored session
+	sess, ok := shard.storedSessions[state.ID]
+	if !ok {
+		sess = newMemorySession(m.SessionQueueSize)
+		sess.shard = shard
+		shard.storedSessions[state.ID] = sess
+	}
+
+	// add subscriptions
+	for _, sub := range state.Subscriptions {
+		sess.subscriptions.Set(sub.Topic, sub)
+	}
+
+	// add messages
+	for _, msg := range state.Messages {
+		_, queue := sess.target(1, m.isPriority(msg.Topic))
+		select {
+		case queue <- msg:
+			sess.enqueued(queue)
+		default:
+		}
+	}
+
+	return nil
+}
+
 // Restore is not needed at the moment.
 func (m *MemoryBackend) Restore(client *Client) error {
 	return nil
@@ -264,13 +835,18 @@ func (m *MemoryBackend) Restore(client *Client) error {
 
 // Subscribe will store the subscription and queue retained messages.
 func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ack Ack) error {
-	// acquire global mutex
-	m.globalMutex.Lock()
-	defer m.globalMutex.Unlock()
+	// get session
+	sess := client.Session().(*memorySession)
 
 	// save subscription
 	for _, sub := range subs {
-		client.Session().(*memorySession).subscriptions.Set(sub.Topic, sub)
+		// join shared subscription group
+		if name, filter, ok := parseShared(sub.Topic); ok {
+			m.joinGroup(name, filter, client.ID(), sess, sub)
+			continue
+		}
+
+		sess.subscriptions.Set(sub.Topic, sub)
 	}
 
 	// call ack if provided
@@ -278,19 +854,25 @@ func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ac
 		ack()
 	}
 
-	// get session
-	sess := client.Session().(*memorySession)
-
 	// handle all subscriptions
 	for _, sub := range subs {
+		// shared subscriptions do not receive retained messages
+		if _, _, ok := parseShared(sub.Topic); ok {
+			continue
+		}
+
 		// get retained messages
-		values := m.retainedMessages.Search(sub.Topic)
+		msgs, _ := m.MatchRetained(client, sub.Topic)
 
 		// publish messages
-		for _, value := range values {
+		for _, msg := range msgs {
+			// get temporary queue
+			_, queue := sess.target(0, m.isPriority(msg.Topic))
+
 			// add to temporary queue or return error if queue is full
 			select {
-			case sess.temporary <- value.(*packet.Message):
+			case queue <- msg:
+				sess.enqueued(queue)
 			default:
 				return ErrQueueFull
 			}
@@ -302,9 +884,20 @@ func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ac
 
 // Unsubscribe will delete the subscription.
 func (m *MemoryBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	// get session
+	sess := client.Session().(*memorySession)
+
 	// delete subscriptions
 	for _, t := range topics {
-		client.Session().(*memorySession).subscriptions.Empty(t)
+		// leave shared subscription group
+		if name, filter, ok := parseShared(t); ok {
+			m.groupMutex.Lock()
+			m.leaveGroup(name, filter, sess)
+			m.groupMutex.Unlock()
+			continue
+		}
+
+		sess.subscriptions.Empty(t)
 	}
 
 	// call ack if provided
@@ -317,85 +910,46 @@ func (m *MemoryBackend) Unsubscribe(client *Client, topics []string, ack Ack) er
 
 // Publish will handle retained messages and add the message to the session queues.
 func (m *MemoryBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
-	// acquire global mutex
-	m.globalMutex.Lock()
-	defer m.globalMutex.Unlock()
-
-	// this implementation is very basic and will block the backend on every
-	// publish. clients that stay connected but won't drain their queue will
-	// eventually deadlock the broker
+	// this implementation is very basic and will block the publishing client
+	// until the message has been added to all queues. clients that stay
+	// connected but won't drain their queue will eventually block all
+	// publishing clients
 
 	// check retain flag
 	if msg.Retain {
 		if len(msg.Payload) > 0 {
-			// retain message
-			m.retainedMessages.Set(msg.Topic, msg.Copy())
+			_ = m.StoreRetained(client, msg)
 		} else {
-			// clear already retained message
-			m.retainedMessages.Empty(msg.Topic)
-		}
-	}
-
-	// use temporary queue by default
-	queue := func(s *memorySession) chan *packet.Message {
-		return s.temporary
-	}
-
-	// use stored queue if qos > 0
-	if msg.QOS > 0 {
-		queue = func(s *memorySession) chan *packet.Message {
-			return s.stored
+			_ = m.ClearRetained(client, msg.Topic)
 		}
 	}
 
 	// reset retained flag
 	msg.Retain = false
 
-	// add message to temporary sessions
-	for _, sess := range m.temporarySessions {
-		if sub := sess.lookupSubscription(msg.Topic); sub != nil {
-			if sess.owner == client {
-				// detect deadlock when adding to own queue
-				select {
-				case queue(sess) <- msg:
-				default:
-					return ErrQueueFull
-				}
-			} else {
-				// wait for room since client is online
-				select {
-				case queue(sess) <- msg:
-				case <-sess.owner.Closed():
-				case <-client.Closed():
-				}
+	// add message to sessions of all shards
+	for _, shard := range m.shards {
+		for _, sess := range shard.sessions(msg.Topic) {
+			err := m.enqueue(client, sess, msg)
+			if err != nil {
+				return err
 			}
 		}
 	}
 
-	// add message to stored sessions
-	for _, sess := range m.storedSessions {
-		if sub := sess.lookupSubscription(msg.Topic); sub != nil {
-			if sess.owner == client {
-				// detect deadlock when adding to own queue
-				select {
-				case queue(sess) <- msg:
-				default:
-					return ErrQueueFull
-				}
-			} else if sess.owner != nil {
-				// wait for room if client is online
-				select {
-				case queue(sess) <- msg:
-				case <-sess.owner.Closed():
-				case <-client.Closed():
-				}
-			} else {
-				// ignore message if stored queue is full
-				select {
-				case queue(sess) <- msg:
-				default:
-				}
-			}
+	// add message to one member of every matching shared subscription group
+	for _, member := range m.pickMembers(client, msg) {
+		// respect maximum qos
+		shared := msg
+		if shared.QOS > member.sub.QOS {
+			shared = msg.Copy()
+			shared.QOS = member.sub.QOS
+		}
+
+		// add message to queue
+		err := m.enqueue(client, member.sess, shared)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -407,6 +961,263 @@ func (m *MemoryBackend) Publish(client *Client, msg *packet.Message, ack Ack) er
 	return nil
 }
 
+// StoreRetained will retain a copy of the message. Messages that are rejected or
+// evicted due to the retained limits are logged.
+func (m *MemoryBackend) StoreRetained(client *Client, msg *packet.Message) error {
+	// retain message
+	evicted, ok := m.retainedMessages.set(msg.Copy(), m.RetainedLimits, m.retainedTTL(msg.Topic))
+	if !ok {
+		m.Log(RetainedRejected, client, nil, msg, nil)
+	}
+
+	// log evicted messages
+	for _, e := range evicted {
+		m.Log(RetainedEvicted, client, nil, e, nil)
+	}
+
+	return nil
+}
+
+// ClearRetained will remove the retained message of the topic.
+func (m *MemoryBackend) ClearRetained(_ *Client, topic string) error {
+	m.retainedMessages.remove(topic)
+	return nil
+}
+
+// MatchRetained will return the retained messages that match the filter.
+func (m *MemoryBackend) MatchRetained(_ *Client, filter string) ([]*packet.Message, error) {
+	return m.retainedMessages.search(filter), nil
+}
+
+// Enqueue will add the message to the queue of the session with the specified
+// client id. Messages for connected clients are added to the queue once there
+// is room. Messages for offline sessions are dropped if the queue is full.
+func (m *MemoryBackend) Enqueue(id string, msg *packet.Message) error {
+	// get shard
+	shard := m.shard(id)
+
+	// get session
+	shard.mutex.Lock()
+	sess, ok := shard.storedSessions[id]
+	if !ok {
+		sess = shard.temporarySessions[shard.activeClients[id]]
+	}
+	shard.mutex.Unlock()
+
+	// check session
+	if sess == nil {
+		return ErrMissingSession
+	}
+
+	// get owner and queue
+	owner, queue := sess.target(msg.QOS, m.isPriority(msg.Topic))
+
+	// wait for room if the client is online
+	if owner != nil {
+		select {
+		case queue <- msg:
+			sess.enqueued(queue)
+		case <-owner.Closed():
+		}
+
+		return nil
+	}
+
+	// ignore message if stored queue is full
+	select {
+	case queue <- msg:
+		sess.enqueued(queue)
+	default:
+	}
+
+	return nil
+}
+
+// EnqueueClient will add the message to the queue of the session of the
+// specified connected client. As the method is called from the client itself,
+// it returns ErrQueueFull instead of waiting for room.
+func (m *MemoryBackend) EnqueueClient(client *Client, msg *packet.Message) error {
+	// get session
+	sess, ok := client.Session().(*memorySession)
+	if !ok {
+		return ErrMissingSession
+	}
+
+	// get queue
+	_, queue := sess.target(msg.QOS, m.isPriority(msg.Topic))
+
+	// add to queue or return error if queue is full
+	select {
+	case queue <- msg:
+		sess.enqueued(queue)
+	default:
+		return ErrQueueFull
+	}
+
+	return nil
+}
+
+func (m *MemoryBackend) enqueue(client *Client, sess *memorySession, msg *packet.Message) error {
+	// get owner and queue
+	owner, queue := sess.target(msg.QOS, m.isPriority(msg.Topic))
+
+	if owner == client {
+		// detect deadlock when adding to own queue
+		select {
+		case queue <- msg:
+			sess.enqueued(queue)
+		default:
+			return ErrQueueFull
+		}
+	} else if owner != nil {
+		// get publisher channel, forwarded messages have no publisher
+		var closed <-chan struct{}
+		if client != nil {
+			closed = client.Closed()
+		}
+
+		// wait for room if client is online
+		select {
+		case queue <- msg:
+			sess.enqueued(queue)
+		case <-owner.Closed():
+		case <-closed:
+		}
+	} else {
+		// ignore message if stored queue is full
+		select {
+		case queue <- msg:
+			sess.enqueued(queue)
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryBackend) joinGroup(name, filter, id string, sess *memorySession, sub packet.Subscription) {
+	// acquire group mutex
+	m.groupMutex.Lock()
+	defer m.groupMutex.Unlock()
+
+	// get or create group
+	key := name + "/" + filter
+	group, ok := m.sharedGroups[key]
+	if !ok {
+		group = &sharedGroup{
+			name:   name,
+			filter: filter,
+		}
+
+		m.sharedGroups[key] = group
+		m.sharedFilters.Add(filter, group)
+	}
+
+	// add member
+	group.join(id, sess, sub)
+}
+
+func (m *MemoryBackend) leaveGroup(name, filter string, sess *memorySession) {
+	// get group
+	key := name + "/" + filter
+	group, ok := m.sharedGroups[key]
+	if !ok {
+		return
+	}
+
+	// remove member
+	group.leave(sess)
+
+	// remove empty group
+	if len(group.members) == 0 {
+		delete(m.sharedGroups, key)
+		m.sharedFilters.Remove(filter, group)
+	}
+}
+
+func (m *MemoryBackend) leaveGroups(sess *memorySession) {
+	// acquire group mutex
+	m.groupMutex.Lock()
+	defer m.groupMutex.Unlock()
+
+	for _, group := range m.sharedGroups {
+		m.leaveGroup(group.name, group.filter, sess)
+	}
+}
+
+func (m *MemoryBackend) pickMembers(publisher *Client, msg *packet.Message) []sharedMember {
+	// acquire group mutex
+	m.groupMutex.Lock()
+	defer m.groupMutex.Unlock()
+
+	// pick one member of every matching group
+	var list []sharedMember
+	for _, value := range m.sharedFilters.Match(msg.Topic) {
+		member := m.pickMember(value.(*sharedGroup), publisher, msg)
+		if member != nil {
+			list = append(list, *member)
+		}
+	}
+
+	return list
+}
+
+func (m *MemoryBackend) pickMember(group *sharedGroup, publisher *Client, msg *packet.Message) *sharedMember {
+	// collect online members
+	var candidates []*sharedMember
+	var owners []*Client
+	for _, member := range group.members {
+		if owner := member.sess.getOwner(); owner != nil {
+			candidates = append(candidates, member)
+			owners = append(owners, owner)
+		}
+	}
+
+	// fallback to offline members
+	if len(candidates) == 0 {
+		candidates = group.members
+		owners = make([]*Client, len(candidates))
+	}
+
+	// check candidates
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// prepare members
+	members := make([]Member, 0, len(candidates))
+	for i, candidate := range candidates {
+		members = append(members, Member{
+			ID:       candidate.id,
+			Client:   owners[i],
+			Inflight: candidate.sess.inflight(),
+		})
+	}
+
+	// get strategy
+	strategy := m.SharedStrategy
+	prefix := -1
+	for p, s := range m.SharedStrategies {
+		if strings.HasPrefix(group.name, p) && len(p) > prefix {
+			strategy = s
+			prefix = len(p)
+		}
+	}
+
+	// pick member
+	i := 0
+	if strategy != nil {
+		i = strategy.Pick(group.name, publisher, msg, members)
+	}
+
+	// check index
+	if i < 0 || i >= len(candidates) {
+		i = 0
+	}
+
+	return candidates[i]
+}
+
 // Dequeue will get the next message from the temporary or stored queue.
 func (m *MemoryBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
 	// mutex locking not needed
@@ -414,41 +1225,160 @@ func (m *MemoryBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
 	// get session
 	sess := client.Session().(*memorySession)
 
+	// get temporary queues
+	_, temporary := sess.target(0, false)
+	_, priorityTemporary := sess.target(0, true)
+
 	// this implementation is very basic and will dequeue messages immediately
 	// and not return no ack. messages are lost if the client fails to handle them
 
-	// get next message from queue
-	select {
-	case msg := <-sess.temporary:
-		return sess.applyQOS(msg), nil, nil
-	case msg := <-sess.stored:
+	for {
+		// get next priority message from queue
+		var msg *packet.Message
+		var age time.Duration
+		select {
+		case msg = <-priorityTemporary:
+			age = sess.dequeued(priorityTemporary)
+		case msg = <-sess.priorityStored:
+			age = sess.dequeued(sess.priorityStored)
+		default:
+			// get next message from queue
+			select {
+			case msg = <-priorityTemporary:
+				age = sess.dequeued(priorityTemporary)
+			case msg = <-sess.priorityStored:
+				age = sess.dequeued(sess.priorityStored)
+			case msg = <-temporary:
+				age = sess.dequeued(temporary)
+			case msg = <-sess.stored:
+				age = sess.dequeued(sess.stored)
+			case <-client.Closing():
+				return nil, nil, nil
+			}
+		}
+
+		// discard expired message
+		if m.OfflineMessageTTL > 0 && age > m.OfflineMessageTTL {
+			m.Log(MessageExpired, client, nil, msg, nil)
+			continue
+		}
+
 		return sess.applyQOS(msg), nil, nil
-	case <-client.Closing():
-		return nil, nil, nil
 	}
 }
 
 // Terminate will disassociate the session from the client.
 func (m *MemoryBackend) Terminate(client *Client) error {
-	// acquire global mutex
-	m.globalMutex.Lock()
-	defer m.globalMutex.Unlock()
+	// get session
+	sess, ok := client.Session().(*memorySession)
+	ok = ok && sess != nil
+
+	// get shard
+	var shard *memoryShard
+	if ok {
+		shard = sess.shard
+	} else if len(client.ID()) > 0 {
+		shard = m.shard(client.ID())
+	} else {
+		return nil
+	}
+
+	// acquire shard mutex
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
 	// release session if available
-	sess, ok := client.Session().(*memorySession)
-	if ok && sess != nil {
-		sess.owner = nil
+	if ok {
+		sess.setOwner(nil)
 	}
 
 	// remove any temporary session
-	delete(m.temporarySessions, client)
+	if sess, ok := shard.temporarySessions[client]; ok {
+		m.leaveGroups(sess)
+		delete(shard.temporarySessions, client)
+	}
 
 	// remove any saved client
-	delete(m.activeClients, client.ID())
+	delete(shard.activeClients, client.ID())
 
 	return nil
 }
 
+// isPriority returns whether the topic is covered by a priority topic.
+func (m *MemoryBackend) isPriority(name string) bool {
+	for _, filter := range m.PriorityTopics {
+		if topic.Covers(filter, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retainedTTL returns the shortest duration of the retained TTLs whose filter
+// matches the topic.
+func (m *MemoryBackend) retainedTTL(name string) time.Duration {
+	var ttl time.Duration
+	for filter, d := range m.RetainedTTLs {
+		if d > 0 && (ttl == 0 || d < ttl) && topic.Covers(filter, name) {
+			ttl = d
+		}
+	}
+
+	return ttl
+}
+
+// Stats will return a snapshot of the backend statistics.
+func (m *MemoryBackend) Stats() BackendStats {
+	// count retained messages
+	retained, _ := m.retainedMessages.count()
+
+	// count sessions
+	var sessions int
+	for _, shard := range m.shards {
+		shard.mutex.Lock()
+		sessions += len(shard.storedSessions) + len(shard.temporarySessions)
+		shard.mutex.Unlock()
+	}
+
+	return BackendStats{
+		RetainedMessages: retained,
+		Sessions:         sessions,
+	}
+}
+
+// SessionStats will return the queue statistics of all sessions.
+func (m *MemoryBackend) SessionStats() []SessionStats {
+	// collect stats
+	var list []SessionStats
+	for _, shard := range m.shards {
+		// get sessions
+		shard.mutex.Lock()
+		sessions := make(map[*memorySession]string, len(shard.storedSessions)+len(shard.temporarySessions))
+		for id, sess := range shard.storedSessions {
+			sessions[sess] = id
+		}
+		for client, sess := range shard.temporarySessions {
+			sessions[sess] = client.ID()
+		}
+		shard.mutex.Unlock()
+
+		// get stats
+		for sess, id := range sessions {
+			stats := sess.stats()
+			stats.ClientID = id
+			list = append(list, stats)
+		}
+	}
+
+	// sort stats
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ClientID < list[j].ClientID
+	})
+
+	return list
+}
+
 // Log will call the associated logger.
 func (m *MemoryBackend) Log(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error) {
 	// call logger if available
@@ -460,32 +1390,20 @@ func (m *MemoryBackend) Log(event LogEvent, client *Client, pkt packet.Generic,
 // Close will close all active clients and close the backend. The return value
 // denotes if the timeout has been reached.
 func (m *MemoryBackend) Close(timeout time.Duration) bool {
-	// acquire global mutex
-	m.globalMutex.Lock()
-
 	// set closing
-	m.closing = true
+	atomic.StoreUint32(&m.closing, 1)
 
 	// prepare list
 	var clients []*Client
 
-	// close temporary sessions
-	for _, sess := range m.temporarySessions {
-		sess.owner.Close()
-		clients = append(clients, sess.owner)
-	}
-
-	// closed owned stored sessions
-	for _, sess := range m.storedSessions {
-		if sess.owner != nil {
-			sess.owner.Close()
-			clients = append(clients, sess.owner)
+	// close clients of all shards
+	for _, shard := range m.shards {
+		for _, client := range shard.owners() {
+			client.Close()
+			clients = append(clients, client)
 		}
 	}
 
-	// release mutex to allow termination
-	m.globalMutex.Unlock()
-
 	// return early if empty
 	if len(clients) == 0 {
 		return true
@@ -0,0 +1,226 @@
+package broker
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// Set GOMQTT_PROFILE to a directory to write heap and goroutine profiles after
+// every benchmark.
+func profileBenchmark(b *testing.B) {
+	// get directory
+	dir := os.Getenv("GOMQTT_PROFILE")
+	if dir == "" {
+		return
+	}
+
+	// capture profiles
+	profiler := NewProfiler(dir)
+	for _, name := range []string{"heap", "goroutine"} {
+		path, err := profiler.Capture(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Logf("%s: %s", b.Name(), path)
+	}
+}
+
+func benchmarkClient(b *testing.B, url, id string, callback func(*packet.Message, error) error) *client.Client {
+	c := client.New()
+	c.Callback = callback
+
+	cf, err := c.Connect(client.NewConfigWithClientID(url, id))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	err = cf.Wait(10 * time.Second)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return c
+}
+
+func BenchmarkConnectStorm(b *testing.B) {
+	port, quit, done := Run(NewEngine(NewMemoryBackend()), "tcp")
+
+	var counter uint64
+
+	b.ReportAllocs()
+	b.SetParallelism(8)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			conn, err := transport.Dial("tcp://localhost:" + port)
+			if err != nil {
+				panic(err)
+			}
+
+			connect := packet.NewConnect()
+			connect.ClientID = fmt.Sprintf("storm%d", atomic.AddUint64(&counter, 1))
+			connect.CleanSession = true
+
+			err = conn.Send(connect, false)
+			if err != nil {
+				panic(err)
+			}
+
+			pkt, err := conn.Receive()
+			if err != nil {
+				panic(err)
+			}
+
+			if pkt.(*packet.Connack).ReturnCode != packet.ConnectionAccepted {
+				panic("connection denied")
+			}
+
+			err = conn.Send(packet.NewDisconnect(), false)
+			if err != nil {
+				panic(err)
+			}
+
+			_ = conn.Close()
+		}
+	})
+
+	b.StopTimer()
+
+	profileBenchmark(b)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func BenchmarkFanout(b *testing.B) {
+	for _, subscribers := range []int{1, 10, 100} {
+		for _, qos := range []packet.QOS{0, 1} {
+			b.Run(fmt.Sprintf("1:%d/QOS%d", subscribers, qos), func(b *testing.B) {
+				benchmarkFanout(b, subscribers, qos)
+			})
+		}
+	}
+}
+
+func benchmarkFanout(b *testing.B, subscribers int, qos packet.QOS) {
+	port, quit, done := Run(NewEngine(NewMemoryBackend()), "tcp")
+	url := "tcp://localhost:" + port
+
+	var wg sync.WaitGroup
+	wg.Add(subscribers * b.N)
+
+	var clients []*client.Client
+	for i := 0; i < subscribers; i++ {
+		c := benchmarkClient(b, url, fmt.Sprintf("sub%d", i), func(msg *packet.Message, err error) error {
+			if err == nil {
+				wg.Done()
+			}
+
+			return nil
+		})
+
+		sf, err := c.Subscribe("fanout", qos)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = sf.Wait(10 * time.Second)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		clients = append(clients, c)
+	}
+
+	publisher := benchmarkClient(b, url, "pub", nil)
+	payload := make([]byte, 256)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload) * subscribers))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		pf, err := publisher.Publish("fanout", payload, qos, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if qos > 0 {
+			err = pf.Wait(10 * time.Second)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	wg.Wait()
+
+	b.StopTimer()
+
+	profileBenchmark(b)
+
+	for _, c := range append(clients, publisher) {
+		_ = c.Disconnect()
+	}
+
+	close(quit)
+	safeReceive(done)
+}
+
+func BenchmarkRetainedLookup(b *testing.B) {
+	for _, filter := range []string{"retained/50/5", "retained/50/+", "retained/#"} {
+		b.Run(filter, func(b *testing.B) {
+			benchmarkRetainedLookup(b, filter)
+		})
+	}
+}
+
+func benchmarkRetainedLookup(b *testing.B, filter string) {
+	backend := NewMemoryBackend()
+	backend.SessionQueueSize = 1000
+
+	// publish retained messages
+	publisher := &Client{session: newMemorySession(0)}
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			err := backend.Publish(publisher, &packet.Message{
+				Topic:   fmt.Sprintf("retained/%d/%d", i, j),
+				Payload: []byte("payload"),
+				Retain:  true,
+			}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	subs := []packet.Subscription{{Topic: filter}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		subscriber := &Client{session: newMemorySession(backend.SessionQueueSize)}
+		b.StartTimer()
+
+		err := backend.Subscribe(subscriber, subs, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+
+	profileBenchmark(b)
+}
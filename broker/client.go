@@ -2,6 +2,9 @@ package broker
 
 import (
 	"errors"
+	"math/rand"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,6 +37,22 @@ const (
 	// MessageForwarded is emitted after a message has been forwarded.
 	MessageForwarded LogEvent = "message forwarded"
 
+	// MessageDropped is emitted when a message is dropped because the client
+	// is not authorized to publish it.
+	MessageDropped LogEvent = "message dropped"
+
+	// MessageExpired is emitted when a queued message is discarded because it
+	// exceeded the offline message TTL of the backend.
+	MessageExpired LogEvent = "message expired"
+
+	// RetainedRejected is emitted when a message is not retained because a
+	// retained limit has been reached.
+	RetainedRejected LogEvent = "retained rejected"
+
+	// RetainedEvicted is emitted when a retained message is evicted to make
+	// room for a new retained message.
+	RetainedEvicted LogEvent = "retained evicted"
+
 	// PacketSent is emitted when a packet has been sent.
 	PacketSent LogEvent = "packet sent"
 
@@ -52,13 +71,22 @@ const (
 	// ClientError is emitted when the client violates the protocol.
 	ClientError LogEvent = "client error"
 
+	// ServerDisconnected is emitted when the broker disconnects a client. The
+	// error is the DisconnectReason.
+	ServerDisconnected LogEvent = "server disconnected"
+
+	// ProtocolViolation is emitted when a client violates the protocol and
+	// the violation is tolerated.
+	ProtocolViolation LogEvent = "protocol violation"
+
 	// LostConnection is emitted when the connection has been terminated.
 	LostConnection LogEvent = "lost connection"
 )
 
 // A Session is used to get packet ids and persist incoming/outgoing packets.
 type Session interface {
-	// NextID should return the next id for outgoing packets.
+	// NextID should return the next id for outgoing packets. Zero should be
+	// returned if all ids are in use.
 	NextID() packet.ID
 
 	// SavePacket should store a packet in the session. An eventual existing
@@ -72,7 +100,8 @@ type Session interface {
 	// not return an error if no packet with the specified id does exists.
 	DeletePacket(session.Direction, packet.ID) error
 
-	// AllPackets should return all packets currently saved in the session.
+	// AllPackets should return all packets currently saved in the session in
+	// the order they have been saved first to redeliver them in order.
 	AllPackets(session.Direction) ([]packet.Generic, error)
 }
 
@@ -81,13 +110,8 @@ type Session interface {
 // from either queue or the successful handling of subscriptions.
 type Ack func()
 
-// A Backend provides the effective brokering functionality to its clients.
-type Backend interface {
-	// Authenticate should authenticate the client using the user and password
-	// values and return true if the client is eligible to continue or false
-	// when the broker should terminate the connection.
-	Authenticate(client *Client, user, password string) (ok bool, err error)
-
+// A SessionStore manages the sessions of clients.
+type SessionStore interface {
 	// Setup is called when a new client comes online and is successfully
 	// authenticated. Setup should return the already stored session for the
 	// supplied id or create and return a new one if it is missing or a clean
@@ -109,6 +133,19 @@ type Backend interface {
 	// may not be required as Dequeue will already pick up offline messages.
 	Restore(client *Client) error
 
+	// Terminate is called when the client goes offline. Terminate should
+	// unsubscribe the passed client from all previously subscribed topics. The
+	// backend may also convert a clients subscriptions to offline subscriptions.
+	//
+	// Note: The Backend may also cleanup previously allocated resources for
+	// that client as the broker will close the connection when the call
+	// returns.
+	Terminate(client *Client) error
+}
+
+// A Router manages subscriptions and routes published messages to the queues
+// of the matching sessions.
+type Router interface {
 	// Subscribe should subscribe the passed client to the specified topics and
 	// store the subscription in the session. If an Ack is provided, the
 	// subscription will be acknowledged when called during or after the call to
@@ -140,7 +177,10 @@ type Backend interface {
 	// should be removed. The flag should be cleared before publishing the
 	// message to other subscribed clients.
 	Publish(client *Client, msg *packet.Message, ack Ack) error
+}
 
+// A Queuer hands out the queued messages of a session.
+type Queuer interface {
 	// Dequeue is called by the Client to obtain the next message from the queue
 	// and must return either a message or an error. The backend must only return
 	// no message and no error if the client's Closing channel has been closed.
@@ -152,24 +192,54 @@ type Backend interface {
 	// The returned message must have a QOS set that respects the QOS set by
 	// the matching subscription.
 	Dequeue(client *Client) (*packet.Message, Ack, error)
+}
 
-	// Terminate is called when the client goes offline. Terminate should
-	// unsubscribe the passed client from all previously subscribed topics. The
-	// backend may also convert a clients subscriptions to offline subscriptions.
-	//
-	// Note: The Backend may also cleanup previously allocated resources for
-	// that client as the broker will close the connection when the call
-	// returns.
-	Terminate(client *Client) error
-
+// An EventLogger handles the log events of clients.
+type EventLogger interface {
 	// Log is called multiple times during the lifecycle of a client see LogEvent
-	// for a list of all events.
+	// for a list of all events. Packets must not be retained after the call
+	// returns as they may be recycled.
 	Log(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error)
 }
 
+// A Backend provides the effective brokering functionality to its clients. It
+// is composed of several smaller interfaces that may be implemented separately
+// and combined using a ComposedBackend.
+type Backend interface {
+	// Authenticate should authenticate the client using the user and password
+	// values and return true if the client is eligible to continue or false
+	// when the broker should terminate the connection.
+	Authenticate(client *Client, user, password string) (ok bool, err error)
+
+	SessionStore
+	Router
+	Queuer
+	EventLogger
+}
+
+// A Closer is a backend or part of a backend that holds resources that should
+// be released when the broker shuts down. Close should return false if the
+// timeout has been reached before the backend has been closed.
+type Closer interface {
+	Close(timeout time.Duration) bool
+}
+
+// closeBackend will close the backend if it implements the Closer interface.
+// Backends that do not support closing are considered closed.
+func closeBackend(backend Backend, timeout time.Duration) bool {
+	if closer, ok := backend.(Closer); ok {
+		return closer.Close(timeout)
+	}
+
+	return true
+}
+
 // ErrUnexpectedPacket is returned when an unexpected packet is received.
 var ErrUnexpectedPacket = errors.New("unexpected packet")
 
+// ErrInvalidClientID is returned when a client supplies an invalid client id.
+var ErrInvalidClientID = errors.New("invalid client id")
+
 // ErrNotAuthorized is returned when a client is not authorized.
 var ErrNotAuthorized = errors.New("not authorized")
 
@@ -179,12 +249,79 @@ var ErrMissingSession = errors.New("missing session")
 // ErrTokenTimeout is returned if the client reaches the token timeout.
 var ErrTokenTimeout = errors.New("token timeout")
 
+// ErrTopicLimit is returned if a client publishes to a topic that exceeds the
+// configured topic limits.
+var ErrTopicLimit = errors.New("topic limit exceeded")
+
 // ErrClientDisconnected is returned if a client disconnects cleanly.
 var ErrClientDisconnected = errors.New("client disconnected")
 
 // ErrClientClosed is returned if a client is being closed by the broker.
 var ErrClientClosed = errors.New("client closed")
 
+// DisconnectReason describes why the broker disconnects a client. The values
+// correspond to the reason codes of MQTT 5.
+type DisconnectReason byte
+
+const (
+	// DisconnectNormal disconnects the client without publishing its will.
+	DisconnectNormal DisconnectReason = 0x00
+
+	// DisconnectUnspecified is used if no other reason applies.
+	DisconnectUnspecified DisconnectReason = 0x80
+
+	// DisconnectNotAuthorized is used if the client is no longer authorized.
+	DisconnectNotAuthorized DisconnectReason = 0x87
+
+	// DisconnectServerShuttingDown is used if the broker is shutting down.
+	DisconnectServerShuttingDown DisconnectReason = 0x8B
+
+	// DisconnectSessionTakenOver is used if another client uses the same id.
+	DisconnectSessionTakenOver DisconnectReason = 0x8E
+
+	// DisconnectQuotaExceeded is used if the client exceeded a quota.
+	DisconnectQuotaExceeded DisconnectReason = 0x97
+
+	// DisconnectAdministrativeAction is used if an administrator or policy
+	// disconnects the client.
+	DisconnectAdministrativeAction DisconnectReason = 0x98
+
+	// DisconnectMaximumConnectTime is used if the connection reached its
+	// maximum age. The will is not published as the client is expected to
+	// reconnect.
+	DisconnectMaximumConnectTime DisconnectReason = 0xA0
+)
+
+// PublishWill returns whether the will of the client should be published when
+// it is disconnected for the reason.
+func (r DisconnectReason) PublishWill() bool {
+	return r != DisconnectNormal && r != DisconnectMaximumConnectTime
+}
+
+// Error implements the error interface.
+func (r DisconnectReason) Error() string {
+	switch r {
+	case DisconnectNormal:
+		return "normal disconnection"
+	case DisconnectUnspecified:
+		return "unspecified error"
+	case DisconnectNotAuthorized:
+		return "not authorized"
+	case DisconnectServerShuttingDown:
+		return "server shutting down"
+	case DisconnectSessionTakenOver:
+		return "session taken over"
+	case DisconnectQuotaExceeded:
+		return "quota exceeded"
+	case DisconnectAdministrativeAction:
+		return "administrative action"
+	case DisconnectMaximumConnectTime:
+		return "maximum connect time"
+	}
+
+	return "unknown disconnect reason"
+}
+
 const (
 	clientConnecting uint32 = iota
 	clientConnected
@@ -215,9 +352,11 @@ type Client struct {
 
 	// InflightMessages may be set during Setup to control the number of
 	// inflight messages from the broker to the client. This also defines how
-	// many outgoing packets are stored in the clients session.
+	// many outgoing packets are stored in the clients session. The delivery
+	// of further messages is paused until the client acknowledges inflight
+	// messages, which makes the setting the receive maximum of the client.
 	//
-	// Will default to 10.
+	// Will default to the DefaultInflightMessages of the engine or 10.
 	InflightMessages int
 
 	// TokenTimeout sets the timeout after which the client should fail when
@@ -227,11 +366,33 @@ type Client struct {
 	// Will default to 30 seconds.
 	TokenTimeout time.Duration
 
+	// MaximumTopicLevels may be set during Setup to limit the number of levels
+	// of the topics and filters a client may use. Subscriptions that exceed the
+	// limit are rejected with a failure return code and clients that publish to
+	// such topics are disconnected.
+	//
+	// Will default to no limit.
+	MaximumTopicLevels int
+
+	// MaximumTopicLength may be set during Setup to limit the length in bytes
+	// of the topics and filters a client may use. Violations are handled like
+	// with MaximumTopicLevels.
+	//
+	// Will default to no limit.
+	MaximumTopicLength int
+
 	// PacketCallback can be set to inspect packets before processing and
 	// apply rate limits. To guarantee the connection lifecycle, Connect and
-	// Disconnect packets are not provided to the callback.
+	// Disconnect packets are not provided to the callback. Packets must not
+	// be retained after the call returns as they may be recycled.
 	PacketCallback func(packet.Generic) error
 
+	// Authorizer may be set during Authenticate or Setup to restrict the
+	// topics and filters a client may use. Unauthorized subscriptions are
+	// rejected with a failure return code. Unauthorized messages, including
+	// the will message, are acknowledged but dropped.
+	Authorizer Authorizer
+
 	// Ref can be used by the backend to attach a custom object to the client.
 	Ref interface{}
 
@@ -249,12 +410,33 @@ type Client struct {
 	subscribeTokens chan struct{}
 	dequeueTokens   chan struct{}
 
+	pool      *Pool
+	fanout    *Fanout
+	tolerant  bool
+	lifetime  time.Duration
+	inflight  int
+	limiter   *ConnectLimiter
+	ipLimiter *IPLimiter
+	qosLimits QOSLimits
+	borrowing bool
+	stats     *engineStats
+	inbox     chan packet.Generic
+	scheduled uint32
+	pending   sync.WaitGroup
+
+	meta      map[string]interface{}
+	metaMutex sync.RWMutex
+
 	tomb tomb.Tomb
 	done chan struct{}
 }
 
 // NewClient takes over a connection and returns a Client.
 func NewClient(backend Backend, conn transport.Conn) *Client {
+	return newClient(backend, conn, nil)
+}
+
+func newClient(backend Backend, conn transport.Conn, engine *Engine) *Client {
 	// create client
 	c := &Client{
 		state:   clientConnecting,
@@ -263,6 +445,36 @@ func NewClient(backend Backend, conn transport.Conn) *Client {
 		done:    make(chan struct{}),
 	}
 
+	// apply engine settings
+	if engine != nil {
+		c.pool = engine.Pool
+		c.fanout = engine.Fanout
+		c.tolerant = engine.Tolerant
+		c.stats = engine.stats
+		c.lifetime = engine.MaximumConnectionAge
+		c.inflight = engine.DefaultInflightMessages
+		c.limiter = engine.ConnectLimiter
+		c.ipLimiter = engine.IPLimiter
+		c.qosLimits = engine.QOSLimits
+		c.borrowing = engine.borrowing()
+
+		// apply jitter
+		if c.lifetime > 0 && engine.ConnectionAgeJitter > 0 {
+			jitter := time.Duration(rand.Int63n(int64(engine.ConnectionAgeJitter)))
+			if jitter < c.lifetime {
+				c.lifetime -= jitter
+			}
+		}
+	}
+
+	// prepare inbox
+	if c.pool != nil {
+		c.inbox = c.pool.inbox()
+	}
+
+	// count connection
+	c.stats.connect()
+
 	// start processor
 	c.tomb.Go(c.processor)
 
@@ -290,7 +502,8 @@ func (c *Client) ID() string {
 }
 
 // Conn returns the client's underlying connection. Calls to SetReadLimit,
-// LocalAddr and RemoteAddr are safe.
+// LocalAddr and RemoteAddr are safe, as are calls to SetReceiveRate if the
+// connection implements transport.RateLimitedConn.
 func (c *Client) Conn() transport.Conn {
 	return c.conn
 }
@@ -301,6 +514,59 @@ func (c *Client) Close() {
 	c.tomb.Kill(ErrClientClosed)
 }
 
+// Disconnect will close the client on behalf of the broker. The will of the
+// client is only published if required by the reason. As version 3.1 and 3.1.1
+// clients cannot receive Disconnect packets, pending packets are flushed and
+// the connection is closed. The reason is logged using the ServerDisconnected
+// event.
+func (c *Client) Disconnect(reason DisconnectReason) {
+	// suppress will
+	if !reason.PublishWill() {
+		atomic.CompareAndSwapUint32(&c.state, clientConnected, clientDisconnected)
+	}
+
+	_ = c.die(ServerDisconnected, reason)
+}
+
+// Set will store the value under the specified key in the metadata of the
+// client. Metadata may be set by the backend, e.g. during authentication, to
+// pass information like tenants or rate limit buckets to later hooks. It is
+// safe to call Set and Get concurrently.
+func (c *Client) Set(key string, value interface{}) {
+	// acquire mutex
+	c.metaMutex.Lock()
+	defer c.metaMutex.Unlock()
+
+	// create map
+	if c.meta == nil {
+		c.meta = make(map[string]interface{})
+	}
+
+	c.meta[key] = value
+}
+
+// Get will return the value stored under the specified key in the metadata of
+// the client.
+func (c *Client) Get(key string) (interface{}, bool) {
+	// acquire mutex
+	c.metaMutex.RLock()
+	defer c.metaMutex.RUnlock()
+
+	value, ok := c.meta[key]
+
+	return value, ok
+}
+
+// Unset will remove the value stored under the specified key from the metadata
+// of the client.
+func (c *Client) Unset(key string) {
+	// acquire mutex
+	c.metaMutex.Lock()
+	defer c.metaMutex.Unlock()
+
+	delete(c.meta, key)
+}
+
 // Closing returns a channel that is closed when the client is closing.
 func (c *Client) Closing() <-chan struct{} {
 	return c.tomb.Dying()
@@ -323,6 +589,7 @@ func (c *Client) processor() error {
 		return c.die(TransportError, err)
 	}
 
+	c.stats.received(pkt)
 	c.backend.Log(PacketReceived, c, pkt, nil, nil)
 
 	// get connect
@@ -341,6 +608,14 @@ func (c *Client) processor() error {
 	c.tomb.Go(c.dequeuer)
 	c.tomb.Go(c.acker)
 
+	// start expirer if required
+	if c.lifetime > 0 {
+		c.tomb.Go(c.expirer)
+	}
+
+	// wait for pooled packets before returning
+	defer c.pending.Wait()
+
 	for {
 		// check if still alive
 		if !c.tomb.Alive() {
@@ -350,9 +625,13 @@ func (c *Client) processor() error {
 		// receive next packet
 		pkt, err := c.conn.Receive()
 		if err != nil {
+			// process queued packets first
+			c.pending.Wait()
+
 			return c.die(TransportError, err)
 		}
 
+		c.stats.received(pkt)
 		c.backend.Log(PacketReceived, c, pkt, nil, nil)
 
 		// call callback
@@ -363,14 +642,62 @@ func (c *Client) processor() error {
 			}
 		}
 
-		// process packet
-		err = c.processPacket(pkt)
+		// process packet directly or queue it, disconnects are processed after
+		// all queued packets to retain the order
+		if c.pool == nil {
+			err = c.processPacket(pkt)
+		} else if pkt.Type() == packet.DISCONNECT {
+			c.pending.Wait()
+			err = c.processPacket(pkt)
+		} else {
+			err = c.enqueue(pkt)
+		}
 		if err != nil {
 			return err // error has already been handled
 		}
 	}
 }
 
+// queue a packet for processing by the pool
+func (c *Client) enqueue(pkt packet.Generic) error {
+	// queue packet
+	c.pending.Add(1)
+	select {
+	case c.inbox <- pkt:
+	case <-c.tomb.Dying():
+		c.pending.Done()
+		return tomb.ErrDying
+	}
+
+	// schedule client if not already scheduled
+	if atomic.CompareAndSwapUint32(&c.scheduled, 0, 1) {
+		c.pool.schedule(c)
+	}
+
+	return nil
+}
+
+// process up to max queued packets using a pool worker and return whether
+// the client must be scheduled again
+func (c *Client) work(max int) bool {
+	// process packets, only one worker at a time processes the packets
+	for i := 0; i < max && len(c.inbox) > 0; i++ {
+		pkt := <-c.inbox
+
+		// skip packets if dying
+		if c.tomb.Alive() {
+			_ = c.processPacket(pkt) // error has already been handled
+		}
+
+		c.pending.Done()
+	}
+
+	// clear flag and reclaim it if packets have been queued in the meantime
+	atomic.StoreUint32(&c.scheduled, 0)
+
+	return len(c.inbox) > 0 && atomic.CompareAndSwapUint32(&c.scheduled, 0, 1)
+}
+
 // message dequeuer
 func (c *Client) dequeuer() error {
 	for {
@@ -395,12 +722,20 @@ func (c *Client) dequeuer() error {
 		c.backend.Log(MessageDequeued, c, nil, msg, nil)
 
 		// prepare publish packet
-		publish := packet.NewPublish()
+		publish := acquire(packet.PUBLISH).(*packet.Publish)
 		publish.Message = *msg
 
+		// share encoding
+		if c.fanout != nil {
+			publish.Encoding = c.fanout.Encoding(msg)
+		}
+
 		// set packet id
 		if publish.Message.QOS > 0 {
 			publish.ID = c.session.NextID()
+			if publish.ID == 0 {
+				return c.die(SessionError, session.ErrNoFreeID)
+			}
 		}
 
 		// store packet if at least qos 1
@@ -424,19 +759,37 @@ func (c *Client) dequeuer() error {
 			return c.die(TransportError, err)
 		}
 
-		// immediately put back dequeue token for qos 0 messages
+		// immediately put back dequeue token for qos 0 messages and recycle
+		// the packet as it has not been stored
 		if publish.Message.QOS == 0 {
 			select {
 			case c.dequeueTokens <- struct{}{}:
 			default:
 				// continue if full for some reason
 			}
+
+			packet.Recycle(publish)
 		}
 
 		c.backend.Log(MessageForwarded, c, nil, msg, nil)
 	}
 }
 
+// connection expirer
+func (c *Client) expirer() error {
+	// create timer
+	timer := time.NewTimer(c.lifetime)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		c.Disconnect(DisconnectMaximumConnectTime)
+		return DisconnectMaximumConnectTime
+	case <-c.tomb.Dying():
+		return tomb.ErrDying
+	}
+}
+
 // packet acker
 func (c *Client) acker() error {
 	for {
@@ -450,7 +803,7 @@ func (c *Client) acker() error {
 
 			// remove publish from session if pubcomp
 			if pubcomp, ok := pkt.(*packet.Pubcomp); ok {
-				err = c.session.DeletePacket(session.Incoming, pubcomp.ID)
+				err = c.removeIncoming(pubcomp.ID)
 				if err != nil {
 					return c.die(SessionError, err)
 				}
@@ -471,6 +824,9 @@ func (c *Client) acker() error {
 					// continue if full for some reason
 				}
 			}
+
+			// recycle packet
+			packet.Recycle(pkt)
 		case <-c.tomb.Dying():
 			return tomb.ErrDying
 		}
@@ -484,6 +840,27 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 	// save id
 	c.id = pkt.ClientID
 
+	// check client id, version 3.1 requires ids between 1 and 23 characters
+	if pkt.Version == packet.Version31 && (len(pkt.ClientID) == 0 || len(pkt.ClientID) > 23) {
+		// log violation if tolerant
+		if c.tolerant {
+			c.backend.Log(ProtocolViolation, c, pkt, nil, ErrInvalidClientID)
+		} else {
+			// prepare connack
+			connack := packet.NewConnack()
+			connack.ReturnCode = packet.IdentifierRejected
+
+			// send connack
+			err := c.send(connack, false)
+			if err != nil {
+				return c.die(TransportError, err)
+			}
+
+			// close client
+			return c.die(ClientError, ErrInvalidClientID)
+		}
+	}
+
 	// authenticate
 	ok, err := c.backend.Authenticate(c, pkt.Username, pkt.Password)
 	if err != nil {
@@ -495,6 +872,15 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 	connack.ReturnCode = packet.ConnectionAccepted
 	connack.SessionPresent = false
 
+	// track authentication
+	if c.limiter != nil {
+		if ok {
+			c.limiter.Success(c.conn.RemoteAddr())
+		} else {
+			c.limiter.Failure(c.conn.RemoteAddr())
+		}
+	}
+
 	// check authentication
 	if !ok {
 		// set return code
@@ -554,6 +940,9 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 	}
 
 	// set default parallel dequeues
+	if c.InflightMessages <= 0 {
+		c.InflightMessages = c.inflight
+	}
 	if c.InflightMessages <= 0 {
 		c.InflightMessages = 10
 	}
@@ -601,7 +990,8 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 		return c.die(SessionError, err)
 	}
 
-	// resend stored packets
+	// resend stored packets in their original order before new messages are
+	// dequeued
 	for _, pkt := range packets {
 		// consume a dequeue token (will be replaced once the flow is complete)
 		select {
@@ -658,7 +1048,13 @@ func (c *Client) processPacket(pkt packet.Generic) error {
 	case *packet.Disconnect:
 		err = c.processDisconnect()
 	default:
-		err = c.die(ClientError, ErrUnexpectedPacket)
+		err = c.violate(pkt, ErrUnexpectedPacket)
+	}
+
+	// recycle packet unless it is a publish packet whose message has been
+	// handed over to the backend or session
+	if pkt.Type() != packet.PUBLISH {
+		packet.Recycle(pkt)
 	}
 
 	// return eventual error
@@ -693,22 +1089,45 @@ func (c *Client) processSubscribe(pkt *packet.Subscribe) error {
 	}
 
 	// prepare suback packet
-	suback := packet.NewSuback()
+	suback := acquire(packet.SUBACK).(*packet.Suback)
 	suback.ReturnCodes = make([]packet.QOS, len(pkt.Subscriptions))
 	suback.ID = pkt.ID
 
-	// set granted qos
+	// prepare accepted subscriptions
+	subscriptions := make([]packet.Subscription, 0, len(pkt.Subscriptions))
+
+	// set granted qos or reject subscriptions that exceed the topic limits
 	for i, subscription := range pkt.Subscriptions {
+		if c.exceedsTopicLimits(subscription.Topic) || !c.authorizeSubscribe(subscription.Topic) {
+			suback.ReturnCodes[i] = packet.QOSFailure
+			continue
+		}
+
+		// cap granted qos
+		if max := c.qosLimits.Maximum(subscription.Topic); subscription.QOS > max {
+			subscription.QOS = max
+		}
+
 		suback.ReturnCodes[i] = subscription.QOS
+		subscriptions = append(subscriptions, subscription)
 	}
 
-	// subscribe client to queue
-	err := c.backend.Subscribe(c, pkt.Subscriptions, func() {
+	// prepare ack
+	ack := func() {
 		select {
 		case c.ackQueue <- suback:
 		case <-c.tomb.Dying():
 		}
-	})
+	}
+
+	// acknowledge directly if all subscriptions have been rejected
+	if len(subscriptions) == 0 {
+		ack()
+		return nil
+	}
+
+	// subscribe client to queue
+	err := c.backend.Subscribe(c, subscriptions, ack)
 	if err != nil {
 		return c.die(BackendError, err)
 	}
@@ -729,7 +1148,7 @@ func (c *Client) processUnsubscribe(pkt *packet.Unsubscribe) error {
 	}
 
 	// prepare unsuback packet
-	unsuback := packet.NewUnsuback()
+	unsuback := acquire(packet.UNSUBACK).(*packet.Unsuback)
 	unsuback.ID = pkt.ID
 
 	// unsubscribe topics
@@ -746,8 +1165,45 @@ func (c *Client) processUnsubscribe(pkt *packet.Unsubscribe) error {
 	return nil
 }
 
+// remove the incoming publish from the session and release its borrowed
+// payload as it is no longer needed to complete the flow
+func (c *Client) removeIncoming(id packet.ID) error {
+	// get stored publish if payloads are borrowed
+	var stored packet.Generic
+	if c.borrowing {
+		var err error
+		stored, err = c.session.LookupPacket(session.Incoming, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// remove publish
+	err := c.session.DeletePacket(session.Incoming, id)
+	if err != nil {
+		return err
+	}
+
+	// release borrowed payload
+	if publish, ok := stored.(*packet.Publish); ok {
+		publish.Release()
+	}
+
+	return nil
+}
+
 // handle an incoming publish packet
 func (c *Client) processPublish(publish *packet.Publish) error {
+	// check topic limits
+	if c.exceedsTopicLimits(publish.Message.Topic) {
+		return c.die(ClientError, ErrTopicLimit)
+	}
+
+	// drop unauthorized messages
+	if !c.authorizePublish(publish.Message.Topic) {
+		return c.dropPublish(publish)
+	}
+
 	// handle qos 0 flow
 	if publish.Message.QOS == 0 {
 		// publish message
@@ -758,6 +1214,9 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 
 		c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
 
+		// release borrowed payload
+		publish.Release()
+
 		return nil
 	}
 
@@ -774,12 +1233,25 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 	// handle qos 1 flow
 	if publish.Message.QOS == 1 {
 		// prepare puback
-		puback := packet.NewPuback()
+		puback := acquire(packet.PUBACK).(*packet.Puback)
 		puback.ID = publish.ID
 
+		// limit qos
+		msg := c.limitQOS(&publish.Message)
+
+		// release borrowed payload once the message has been published and
+		// acknowledged
+		var pending int32 = 2
+		release := func() {
+			if atomic.AddInt32(&pending, -1) == 0 {
+				publish.Release()
+			}
+		}
+
 		// publish message and queue puback if ack is called
-		err := c.backend.Publish(c, &publish.Message, func() {
-			c.backend.Log(MessageAcknowledged, c, nil, &publish.Message, nil)
+		err := c.backend.Publish(c, msg, func() {
+			c.backend.Log(MessageAcknowledged, c, nil, msg, nil)
+			release()
 
 			select {
 			case c.ackQueue <- puback:
@@ -787,10 +1259,14 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 			}
 		})
 		if err != nil {
+			// the ack is not called if publishing failed
+			publish.Release()
+
 			return c.die(BackendError, err)
 		}
 
-		c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
+		c.backend.Log(MessagePublished, c, nil, msg, nil)
+		release()
 	}
 
 	// handle qos 2 flow
@@ -802,7 +1278,7 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 		}
 
 		// prepare pubrec packet
-		pubrec := packet.NewPubrec()
+		pubrec := acquire(packet.PUBREC).(*packet.Pubrec)
 		pubrec.ID = publish.ID
 
 		// signal qos 2 pubrec
@@ -810,6 +1286,9 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 		if err != nil {
 			return c.die(TransportError, err)
 		}
+
+		// recycle packet
+		packet.Recycle(pubrec)
 	}
 
 	return nil
@@ -863,7 +1342,7 @@ func (c *Client) processPubrel(id packet.ID) error {
 	}
 
 	// prepare pubcomp packet
-	pubcomp := packet.NewPubcomp()
+	pubcomp := acquire(packet.PUBCOMP).(*packet.Pubcomp)
 	pubcomp.ID = id
 
 	// get packet from store
@@ -875,12 +1354,18 @@ func (c *Client) processPubrel(id packet.ID) error {
 			return c.die(TransportError, err)
 		}
 
+		// recycle packet
+		packet.Recycle(pubcomp)
+
 		return nil
 	}
 
+	// limit qos
+	msg := c.limitQOS(&publish.Message)
+
 	// publish message and queue pubcomp if ack is called
-	err = c.backend.Publish(c, &publish.Message, func() {
-		c.backend.Log(MessageAcknowledged, c, nil, &publish.Message, nil)
+	err = c.backend.Publish(c, msg, func() {
+		c.backend.Log(MessageAcknowledged, c, nil, msg, nil)
 
 		select {
 		case c.ackQueue <- pubcomp:
@@ -891,7 +1376,7 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return c.die(BackendError, err)
 	}
 
-	c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
+	c.backend.Log(MessagePublished, c, nil, msg, nil)
 
 	return nil
 }
@@ -917,6 +1402,19 @@ func (c *Client) processDisconnect() error {
 
 /* helpers */
 
+// handle a protocol violation by closing the client or by logging and
+// ignoring it if the client is tolerant
+func (c *Client) violate(pkt packet.Generic, err error) error {
+	// close client if strict
+	if !c.tolerant {
+		return c.die(ClientError, err)
+	}
+
+	c.backend.Log(ProtocolViolation, c, pkt, nil, err)
+
+	return nil
+}
+
 // send a packet
 func (c *Client) send(pkt packet.Generic, async bool) error {
 	// send packet
@@ -925,11 +1423,91 @@ func (c *Client) send(pkt packet.Generic, async bool) error {
 		return err
 	}
 
+	c.stats.sent(pkt)
 	c.backend.Log(PacketSent, c, pkt, nil, nil)
 
 	return nil
 }
 
+// acquire a packet from the pool
+func acquire(t packet.Type) packet.Generic {
+	pkt, _ := packet.Acquire(t)
+	return pkt
+}
+
+// check whether a topic or filter exceeds the configured limits
+func (c *Client) exceedsTopicLimits(topic string) bool {
+	// check length
+	if c.MaximumTopicLength > 0 && len(topic) > c.MaximumTopicLength {
+		return true
+	}
+
+	// check levels
+	if c.MaximumTopicLevels > 0 && strings.Count(topic, "/")+1 > c.MaximumTopicLevels {
+		return true
+	}
+
+	return false
+}
+
+// check whether the client may publish to the topic
+func (c *Client) authorizePublish(topic string) bool {
+	return c.Authorizer == nil || c.Authorizer.AuthorizePublish(c, topic)
+}
+
+// check whether the client may subscribe to the filter
+func (c *Client) authorizeSubscribe(filter string) bool {
+	return c.Authorizer == nil || c.Authorizer.AuthorizeSubscribe(c, filter)
+}
+
+// return a copy of the message with the qos capped by the qos limits
+func (c *Client) limitQOS(msg *packet.Message) *packet.Message {
+	// check limit
+	max := c.qosLimits.Maximum(msg.Topic)
+	if msg.QOS <= max {
+		return msg
+	}
+
+	// downgrade copy
+	msg = msg.Copy()
+	msg.QOS = max
+
+	return msg
+}
+
+// acknowledge an unauthorized publish without forwarding the message
+func (c *Client) dropPublish(publish *packet.Publish) error {
+	c.stats.drop()
+	c.backend.Log(MessageDropped, c, nil, &publish.Message, nil)
+
+	// release borrowed payload
+	publish.Release()
+
+	// prepare acknowledgement, the qos 2 flow is completed by processPubrel as
+	// no packet is stored in the session
+	var ack packet.Generic
+	switch publish.Message.QOS {
+	case 1:
+		puback := packet.NewPuback()
+		puback.ID = publish.ID
+		ack = puback
+	case 2:
+		pubrec := packet.NewPubrec()
+		pubrec.ID = publish.ID
+		ack = pubrec
+	default:
+		return nil
+	}
+
+	// send acknowledgement
+	err := c.send(ack, true)
+	if err != nil {
+		return c.die(TransportError, err)
+	}
+
+	return nil
+}
+
 /* error handling and logging */
 
 // used for closing and cleaning up from internal goroutines
@@ -950,13 +1528,19 @@ func (c *Client) die(event LogEvent, err error) error {
 func (c *Client) cleanup() {
 	// check if not cleanly connected and will is present
 	if atomic.LoadUint32(&c.state) == clientConnected && c.will != nil {
-		// publish message
-		err := c.backend.Publish(c, c.will, nil)
-		if err != nil {
-			c.backend.Log(BackendError, c, nil, nil, err)
-		}
+		if c.authorizePublish(c.will.Topic) {
+			// publish message
+			will := c.limitQOS(c.will)
+			err := c.backend.Publish(c, will, nil)
+			if err != nil {
+				c.backend.Log(BackendError, c, nil, nil, err)
+			}
 
-		c.backend.Log(MessagePublished, c, nil, c.will, nil)
+			c.backend.Log(MessagePublished, c, nil, will, nil)
+		} else {
+			c.stats.drop()
+			c.backend.Log(MessageDropped, c, nil, c.will, nil)
+		}
 	}
 
 	// remove client from the queue
@@ -967,5 +1551,13 @@ func (c *Client) cleanup() {
 		}
 	}
 
+	// release connection
+	if c.ipLimiter != nil {
+		c.ipLimiter.Release(c.conn.RemoteAddr())
+	}
+
+	// count disconnection
+	c.stats.disconnect()
+
 	c.backend.Log(LostConnection, c, nil, nil, nil)
 }
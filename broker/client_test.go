@@ -176,3 +176,299 @@ func TestClientTokenTimeoutDequeue(t *testing.T) {
 
 	safeReceive(done)
 }
+
+func TestClientTopicLimits(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.ClientMaximumTopicLevels = 2
+	backend.ClientMaximumTopicLength = 10
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "foo/bar", QOS: 1},
+		{Topic: "foo/bar/baz", QOS: 1},
+		{Topic: "foo/barbazqux", QOS: 1},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{1, packet.QOSFailure, packet.QOSFailure}
+
+	rejected := packet.NewSubscribe()
+	rejected.ID = 2
+	rejected.Subscriptions = []packet.Subscription{
+		{Topic: "foo/bar/baz", QOS: 0},
+	}
+
+	rejectedSuback := packet.NewSuback()
+	rejectedSuback.ID = 2
+	rejectedSuback.ReturnCodes = []packet.QOS{packet.QOSFailure}
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "foo/bar/baz"
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Send(rejected).
+		Receive(rejectedSuback).
+		Send(publish).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientDuplicateQOS2Publish(t *testing.T) {
+	port, quit, done := Run(NewEngine(NewMemoryBackend()), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test", QOS: 0},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	publish := packet.NewPublish()
+	publish.ID = 2
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 2
+
+	pubrec := packet.NewPubrec()
+	pubrec.ID = 2
+
+	pubrel := packet.NewPubrel()
+	pubrel.ID = 2
+
+	pubcomp := packet.NewPubcomp()
+	pubcomp.ID = 2
+
+	delivered := packet.NewPublish()
+	delivered.Message.Topic = "test"
+	delivered.Message.Payload = []byte("test")
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Duplicate(publish).
+		Receive(pubrec, pubrec).
+		Delay(10*time.Millisecond).
+		Send(pubrel).
+		Receive(pubcomp, delivered).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientMalformedPacket(t *testing.T) {
+	port, quit, done := Run(NewEngine(NewMemoryBackend()), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		SendRaw([]byte{0x30, 0x02, 0xFF, 0xFF}).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientStrictMode(t *testing.T) {
+	port, quit, done := Run(NewEngine(NewMemoryBackend()), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Version = packet.Version31
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.IdentifierRejected
+
+	f := flow.New().
+		Send(connect).
+		Receive(connack).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	conn, err = transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(packet.NewConnack()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientTolerantMode(t *testing.T) {
+	backend := NewMemoryBackend()
+
+	var violations []error
+	backend.Logger = func(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error) {
+		if event == ProtocolViolation {
+			violations = append(violations, err)
+		}
+	}
+
+	engine := NewEngine(backend)
+	engine.Tolerant = true
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Version = packet.Version31
+
+	f := flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(packet.NewConnack()).
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+
+	assert.Equal(t, []error{ErrInvalidClientID, ErrUnexpectedPacket}, violations)
+}
+
+func TestClientMetadata(t *testing.T) {
+	c := &Client{}
+
+	value, ok := c.Get("foo")
+	assert.False(t, ok)
+	assert.Nil(t, value)
+
+	c.Set("foo", 42)
+
+	value, ok = c.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, 42, value)
+
+	c.Unset("foo")
+
+	_, ok = c.Get("foo")
+	assert.False(t, ok)
+}
+
+func TestClientDisconnect(t *testing.T) {
+	for _, reason := range []DisconnectReason{DisconnectNormal, DisconnectAdministrativeAction, DisconnectMaximumConnectTime} {
+		t.Run(reason.Error(), func(t *testing.T) {
+			backend := NewMemoryBackend()
+
+			clients := make(chan *Client, 1)
+			backend.Logger = func(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error) {
+				if connect, ok := pkt.(*packet.Connect); ok && connect.ClientID == "target" {
+					clients <- client
+				}
+			}
+
+			port, quit, done := Run(NewEngine(backend), "tcp")
+
+			conn1, err := transport.Dial("tcp://localhost:" + port)
+			assert.NoError(t, err)
+
+			err = flow.New().
+				Send(packet.NewConnect()).
+				Receive(packet.NewConnack()).
+				Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+					{Topic: "#", QOS: 0},
+				}}).
+				Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+				Test(conn1)
+			assert.NoError(t, err)
+
+			conn2, err := transport.Dial("tcp://localhost:" + port)
+			assert.NoError(t, err)
+
+			connect := packet.NewConnect()
+			connect.ClientID = "target"
+			connect.Will = &packet.Message{Topic: "will", Payload: []byte("will")}
+
+			err = flow.New().
+				Send(connect).
+				Receive(packet.NewConnack()).
+				Test(conn2)
+			assert.NoError(t, err)
+
+			client := <-clients
+			client.Disconnect(reason)
+			select {
+			case <-client.Closed():
+			case <-time.After(10 * time.Second):
+				t.Fatal("client not closed")
+			}
+
+			_, err = conn2.Receive()
+			assert.Error(t, err)
+
+			receive := flow.New()
+			if reason.PublishWill() {
+				receive.Receive(&packet.Publish{Message: packet.Message{Topic: "will", Payload: []byte("will")}})
+			}
+
+			err = receive.
+				Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("test")}}).
+				Receive(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("test")}}).
+				Send(packet.NewDisconnect()).
+				End().
+				Test(conn1)
+			assert.NoError(t, err)
+
+			close(quit)
+
+			safeReceive(done)
+		})
+	}
+}
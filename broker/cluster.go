@@ -0,0 +1,410 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/cluster"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrMigrationUnsupported is returned if a session should be migrated, but the
+// backend does not implement the SessionMigrator interface.
+var ErrMigrationUnsupported = errors.New("migration unsupported")
+
+// SessionState is the portable state of a stored session.
+type SessionState struct {
+	// The client id of the session.
+	ID string
+
+	// The subscriptions of the session.
+	Subscriptions []packet.Subscription
+
+	// The queued messages of the session.
+	Messages []*packet.Message
+}
+
+// A SessionMigrator is a backend that can move stored sessions to another
+// backend.
+type SessionMigrator interface {
+	// ExportSession should close the client that uses the session with the
+	// specified id and remove and return the stored session. If no session is
+	// stored, nil should be returned.
+	ExportSession(id string) (*SessionState, error)
+
+	// ImportSession should store the session so that it is resumed by the
+	// next client that connects with the same id.
+	ImportSession(state *SessionState) error
+}
+
+// A ClusterTransport is used by a ClusterBackend to reach the other nodes of
+// the cluster.
+type ClusterTransport interface {
+	// Claim should call HandleClaim on the specified node and return its
+	// result.
+	Claim(node cluster.Node, id, host string) (string, error)
+
+	// Evict should call HandleEvict on the specified node and return its
+	// result.
+	Evict(node cluster.Node, id string) (*SessionState, error)
+
+	// Forward should call HandleForward on the specified node and return its
+	// result.
+	Forward(node cluster.Node, msg *packet.Message) error
+}
+
+// A ClusterBackend wraps another backend and coordinates the sessions of the
+// cluster. Every client id is owned by a node of the ring, which records the
+// node that currently hosts the session. When a client connects, the owner is
+// asked to record the local node as the new host. If the session has been
+// hosted by another node, that node closes its client and the session is
+// migrated to the local node. This ensures that a client id is only connected
+// once across the cluster.
+//
+// The records of the owner are kept in memory. If the owner of a client id
+// changes due to a change of the ring, a session hosted on another node is not
+// migrated until the client connects to that node again.
+//
+// If a replicated state is set, the filters of the local subscriptions are
+// added as routes to the state and published messages are forwarded to all
+// other nodes with matching routes. Shared subscriptions are not routed.
+type ClusterBackend struct {
+	Backend
+
+	// The local node.
+	Node cluster.Node
+
+	// The ring of all nodes including the local node.
+	Ring *cluster.Ring
+
+	// The transport used to reach other nodes.
+	Transport ClusterTransport
+
+	// The replicated state used to route messages between nodes.
+	State *ReplicatedState
+
+	hosts  map[string]string
+	cleans map[*Client]bool
+	routes map[string]map[string]bool
+	mutex  sync.Mutex
+}
+
+// NewClusterBackend returns a new ClusterBackend that wraps the specified
+// backend.
+func NewClusterBackend(backend Backend, node cluster.Node, ring *cluster.Ring, transport ClusterTransport) *ClusterBackend {
+	return &ClusterBackend{
+		Backend:   backend,
+		Node:      node,
+		Ring:      ring,
+		Transport: transport,
+		hosts:     make(map[string]string),
+		cleans:    make(map[*Client]bool),
+		routes:    make(map[string]map[string]bool),
+	}
+}
+
+// Setup will claim the client id, migrate the session from the previous host
+// and setup the client using the wrapped backend.
+func (c *ClusterBackend) Setup(client *Client, id string, clean bool) (Session, bool, error) {
+	// save clean flag
+	c.mutex.Lock()
+	c.cleans[client] = clean || id == ""
+	c.mutex.Unlock()
+
+	// temporary sessions are not coordinated
+	if id == "" {
+		return c.Backend.Setup(client, id, clean)
+	}
+
+	// remove routes of a stored session that is discarded
+	if clean && c.State != nil {
+		err := c.removeRoutes(id, nil)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// get owner
+	owner, ok := c.Ring.Owner(id)
+	if !ok {
+		owner = c.Node
+	}
+
+	// claim id
+	var previous string
+	var err error
+	if owner.Name == c.Node.Name {
+		previous = c.HandleClaim(id, c.Node.Name)
+	} else {
+		previous, err = c.Transport.Claim(owner, id, c.Node.Name)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// migrate session from previous host if it is still available
+	if previous != "" && previous != c.Node.Name {
+		if node, ok := c.Ring.Get(previous); ok {
+			err = c.migrate(node, id, clean)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return c.Backend.Setup(client, id, clean)
+}
+
+func (c *ClusterBackend) migrate(node cluster.Node, id string, clean bool) error {
+	// get migrator
+	migrator, ok := c.Backend.(SessionMigrator)
+	if !ok {
+		return ErrMigrationUnsupported
+	}
+
+	// evict session
+	state, err := c.Transport.Evict(node, id)
+	if err != nil {
+		return err
+	}
+
+	// discard session if clean
+	if state == nil || clean {
+		return nil
+	}
+
+	// import session
+	err = migrator.ImportSession(state)
+	if err != nil || c.State == nil {
+		return err
+	}
+
+	return c.addRoutes(id, state.Subscriptions)
+}
+
+// Subscribe will subscribe the client using the wrapped backend and add the
+// routes of the filters.
+func (c *ClusterBackend) Subscribe(client *Client, subs []packet.Subscription, ack Ack) error {
+	// subscribe client
+	err := c.Backend.Subscribe(client, subs, ack)
+	if err != nil || c.State == nil {
+		return err
+	}
+
+	return c.addRoutes(c.routeKey(client), subs)
+}
+
+// Unsubscribe will unsubscribe the client using the wrapped backend and remove
+// the routes of the filters.
+func (c *ClusterBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	// unsubscribe client
+	err := c.Backend.Unsubscribe(client, topics, ack)
+	if err != nil || c.State == nil {
+		return err
+	}
+
+	return c.removeRoutes(c.routeKey(client), topics)
+}
+
+// Publish will publish the message using the wrapped backend and forward it to
+// all other nodes with matching routes.
+func (c *ClusterBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// publish message
+	err := c.Backend.Publish(client, msg, ack)
+	if err != nil || c.State == nil {
+		return err
+	}
+
+	// prepare copy as retained messages are not forwarded
+	forward := *msg
+	forward.Retain = false
+
+	// forward message
+	for _, name := range c.State.Route(msg.Topic) {
+		if name == c.Node.Name {
+			continue
+		}
+
+		// errors are ignored as the node may have failed, its routes are
+		// removed once the failure has been detected
+		if node, ok := c.Ring.Get(name); ok {
+			_ = c.Transport.Forward(node, &forward)
+		}
+	}
+
+	return nil
+}
+
+// Terminate will terminate the client using the wrapped backend and remove the
+// routes of clean sessions.
+func (c *ClusterBackend) Terminate(client *Client) error {
+	// terminate client
+	err := c.Backend.Terminate(client)
+
+	// get key
+	key := c.routeKey(client)
+
+	// remove clean flag
+	c.mutex.Lock()
+	clean := c.cleans[client]
+	delete(c.cleans, client)
+	c.mutex.Unlock()
+
+	// remove routes of clean sessions
+	if err == nil && clean && c.State != nil {
+		err = c.removeRoutes(key, nil)
+	}
+
+	return err
+}
+
+// HandleClaim records the host of the client id and returns the previous host.
+// It should be called by the transport when another node claims a client id.
+func (c *ClusterBackend) HandleClaim(id, host string) string {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// swap host
+	previous := c.hosts[id]
+	c.hosts[id] = host
+
+	return previous
+}
+
+// HandleEvict closes the local client and returns the stored session. It
+// should be called by the transport when another node takes over a session.
+func (c *ClusterBackend) HandleEvict(id string) (*SessionState, error) {
+	// get migrator
+	migrator, ok := c.Backend.(SessionMigrator)
+	if !ok {
+		return nil, ErrMigrationUnsupported
+	}
+
+	// export session
+	state, err := migrator.ExportSession(id)
+	if err != nil || c.State == nil {
+		return state, err
+	}
+
+	// remove routes
+	err = c.removeRoutes(id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// HandleForward publishes a message forwarded by another node using the
+// wrapped backend. It should be called by the transport.
+func (c *ClusterBackend) HandleForward(msg *packet.Message) error {
+	return c.Backend.Publish(nil, msg, nil)
+}
+
+// HandleEvent updates the ring with the membership event. It may be set as the
+// handler of a cluster.Gossip to track the nodes of the cluster.
+func (c *ClusterBackend) HandleEvent(evt cluster.Event) {
+	switch evt.Type {
+	case cluster.NodeJoined:
+		c.Ring.Add(evt.Node)
+	case cluster.NodeLeft, cluster.NodeFailed:
+		c.Ring.Remove(evt.Node.Name)
+
+		// remove routes of node
+		if c.State != nil {
+			_ = c.State.RemoveNode(evt.Node.Name)
+		}
+	}
+}
+
+// routeKey returns the key of the routes of the client. Stored sessions are
+// keyed by their id as their routes outlive the client.
+func (c *ClusterBackend) routeKey(client *Client) string {
+	// acquire mutex
+	c.mutex.Lock()
+	clean := c.cleans[client]
+	c.mutex.Unlock()
+
+	// use id of stored sessions
+	if !clean {
+		return client.ID()
+	}
+
+	return fmt.Sprintf("%p", client)
+}
+
+func (c *ClusterBackend) addRoutes(key string, subs []packet.Subscription) error {
+	for _, sub := range subs {
+		// shared subscriptions are not routed
+		if _, _, ok := parseShared(sub.Topic); ok {
+			continue
+		}
+
+		// mark route
+		c.mutex.Lock()
+		filters, ok := c.routes[key]
+		if !ok {
+			filters = make(map[string]bool)
+			c.routes[key] = filters
+		}
+		added := !filters[sub.Topic]
+		filters[sub.Topic] = true
+		c.mutex.Unlock()
+
+		// add route
+		if added {
+			err := c.State.AddRoute(c.Node.Name, sub.Topic)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *ClusterBackend) removeRoutes(key string, topics []string) error {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// get all filters if missing
+	filters := c.routes[key]
+	if topics == nil {
+		for filter := range filters {
+			topics = append(topics, filter)
+		}
+	}
+
+	// unmark routes
+	var removed []string
+	for _, filter := range topics {
+		if filters[filter] {
+			delete(filters, filter)
+			removed = append(removed, filter)
+		}
+	}
+	if len(filters) == 0 {
+		delete(c.routes, key)
+	}
+
+	c.mutex.Unlock()
+
+	// remove routes
+	for _, filter := range removed {
+		err := c.State.RemoveRoute(c.Node.Name, filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close implements the Closer interface. The transport and the replicated
+// state are owned by the caller and stay open.
+func (c *ClusterBackend) Close(timeout time.Duration) bool {
+	return closeBackend(c.Backend, timeout)
+}
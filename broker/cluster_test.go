@@ -0,0 +1,224 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/cluster"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type localTransport map[string]*ClusterBackend
+
+func (t localTransport) Claim(node cluster.Node, id, host string) (string, error) {
+	return t[node.Name].HandleClaim(id, host), nil
+}
+
+func (t localTransport) Evict(node cluster.Node, id string) (*SessionState, error) {
+	return t[node.Name].HandleEvict(id)
+}
+
+func (t localTransport) Forward(node cluster.Node, msg *packet.Message) error {
+	return t[node.Name].HandleForward(msg)
+}
+
+func TestClusterBackendTakeover(t *testing.T) {
+	a := cluster.Node{Name: "a"}
+	b := cluster.Node{Name: "b"}
+	ring := cluster.NewRing(a, b)
+
+	lt := localTransport{}
+	lt["a"] = NewClusterBackend(NewMemoryBackend(), a, ring, lt)
+	lt["b"] = NewClusterBackend(NewMemoryBackend(), b, ring, lt)
+
+	portA, quitA, doneA := Run(NewEngine(lt["a"]), "tcp")
+	portB, quitB, doneB := Run(NewEngine(lt["b"]), "tcp")
+
+	connect := packet.NewConnect()
+	connect.ClientID = "client"
+	connect.CleanSession = false
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "foo", QOS: 1}}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{1}
+
+	// connect to node a
+	connA, err := transport.Dial("tcp://localhost:" + portA)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Test(connA)
+	assert.NoError(t, err)
+
+	// take over session on node b
+	connB, err := transport.Dial("tcp://localhost:" + portB)
+	assert.NoError(t, err)
+
+	connack := packet.NewConnack()
+	connack.SessionPresent = true
+
+	publish := packet.NewPublish()
+	publish.ID = 2
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+
+	err = flow.New().
+		Send(connect).
+		Receive(connack).
+		Send(publish).
+		Test(connB)
+	assert.NoError(t, err)
+
+	// the puback and the message may arrive in any order
+	var types []packet.Type
+	for i := 0; i < 2; i++ {
+		pkt, err := connB.Receive()
+		assert.NoError(t, err)
+		types = append(types, pkt.Type())
+
+		if p, ok := pkt.(*packet.Publish); ok {
+			assert.Equal(t, publish.Message, p.Message)
+		}
+	}
+	assert.Contains(t, types, packet.PUBACK)
+	assert.Contains(t, types, packet.PUBLISH)
+
+	err = flow.New().
+		Send(&packet.Puback{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(connB)
+	assert.NoError(t, err)
+
+	// client on node a has been closed
+	err = flow.New().
+		End().
+		Test(connA)
+	assert.NoError(t, err)
+
+	close(quitA)
+	close(quitB)
+
+	safeReceive(doneA)
+	safeReceive(doneB)
+}
+
+func TestMemoryBackendExportImportSession(t *testing.T) {
+	backend := NewMemoryBackend()
+
+	state, err := backend.ExportSession("foo")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	err = backend.ImportSession(&SessionState{
+		ID:            "foo",
+		Subscriptions: []packet.Subscription{{Topic: "bar", QOS: 1}},
+		Messages:      []*packet.Message{{Topic: "bar", Payload: []byte("baz"), QOS: 1}},
+	})
+	assert.NoError(t, err)
+
+	state, err = backend.ExportSession("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, &SessionState{
+		ID:            "foo",
+		Subscriptions: []packet.Subscription{{Topic: "bar", QOS: 1}},
+		Messages:      []*packet.Message{{Topic: "bar", Payload: []byte("baz"), QOS: 1}},
+	}, state)
+
+	assert.True(t, backend.Close(time.Second))
+}
+
+func TestClusterBackendHandleEvent(t *testing.T) {
+	a := cluster.Node{Name: "a"}
+	b := cluster.Node{Name: "b"}
+	ring := cluster.NewRing(a)
+
+	backend := NewClusterBackend(NewMemoryBackend(), a, ring, localTransport{})
+
+	backend.HandleEvent(cluster.Event{Type: cluster.NodeJoined, Node: b})
+	assert.Equal(t, []cluster.Node{a, b}, ring.Nodes())
+
+	backend.HandleEvent(cluster.Event{Type: cluster.NodeFailed, Node: b})
+	assert.Equal(t, []cluster.Node{a}, ring.Nodes())
+}
+
+func TestClusterBackendRouting(t *testing.T) {
+	a := cluster.Node{Name: "a"}
+	b := cluster.Node{Name: "b"}
+	ring := cluster.NewRing(a, b)
+
+	// replicate synchronously
+	var states []*ReplicatedState
+	propose := func(data []byte) error {
+		for _, state := range states {
+			state.Apply(data)
+		}
+		return nil
+	}
+	states = append(states, NewReplicatedState(propose), NewReplicatedState(propose))
+
+	lt := localTransport{}
+	lt["a"] = NewClusterBackend(NewMemoryBackend(), a, ring, lt)
+	lt["a"].State = states[0]
+	lt["b"] = NewClusterBackend(NewMemoryBackend(), b, ring, lt)
+	lt["b"].State = states[1]
+
+	portA, quitA, doneA := Run(NewEngine(lt["a"]), "tcp")
+	portB, quitB, doneB := Run(NewEngine(lt["b"]), "tcp")
+
+	// subscribe on node a
+	connA, err := transport.Dial("tcp://localhost:" + portA)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{{Topic: "foo/+"}}}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+		Test(connA)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"a"}, states[1].Route("foo/bar"))
+
+	// publish on node b
+	connB, err := transport.Dial("tcp://localhost:" + portB)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "foo/bar", Payload: []byte("baz")}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(connB)
+	assert.NoError(t, err)
+
+	// receive on node a
+	err = flow.New().
+		Receive(&packet.Publish{Message: packet.Message{Topic: "foo/bar", Payload: []byte("baz")}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(connA)
+	assert.NoError(t, err)
+
+	// routes of clean sessions are removed
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, states[1].Route("foo/bar"))
+
+	close(quitA)
+	close(quitB)
+
+	safeReceive(doneA)
+	safeReceive(doneB)
+}
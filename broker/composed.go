@@ -0,0 +1,246 @@
+package broker
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrMissingEnqueuer is returned if retained messages cannot be queued as the
+// composed backend has no Enqueuer.
+var ErrMissingEnqueuer = errors.New("missing enqueuer")
+
+// A RetainedStore stores the retained messages.
+type RetainedStore interface {
+	// StoreRetained should replace the currently retained message of the
+	// messages topic with the message. The message must not be modified.
+	StoreRetained(client *Client, msg *packet.Message) error
+
+	// ClearRetained should remove the currently retained message of the topic.
+	ClearRetained(client *Client, topic string) error
+
+	// MatchRetained should return all retained messages that match the filter.
+	MatchRetained(client *Client, filter string) ([]*packet.Message, error)
+}
+
+// A ComposedBackend implements the Backend interface by delegating to its
+// parts. This allows replacing a single part of a backend, e.g. the
+// authentication or the storage of retained messages, while keeping the rest.
+type ComposedBackend struct {
+	// The authenticator used to authenticate clients. The returned identity is
+	// set as the authorizer of the client and can be retrieved using
+	// ClientIdentity.
+	//
+	// Will default to the authentication of the backend passed to
+	// NewComposedBackend or allowing all clients if missing.
+	Authenticator Authenticator
+
+	// The store that manages the sessions.
+	Sessions SessionStore
+
+	// The router that manages subscriptions and routes messages.
+	Router Router
+
+	// The queuer that hands out queued messages.
+	Queuer Queuer
+
+	// The store used to retain messages. If set, retained messages are stored
+	// using the store instead of the router and queued using the Enqueuer
+	// when clients subscribe.
+	Retained RetainedStore
+
+	// The enqueuer used to queue retained messages.
+	Enqueuer Enqueuer
+
+	// The logger that handles log events.
+	//
+	// Will default to ignoring events if missing.
+	Logger EventLogger
+
+	backend Backend
+}
+
+// NewComposedBackend returns a new ComposedBackend that uses the specified
+// backend for all parts. Single parts may be replaced afterwards.
+func NewComposedBackend(backend Backend) *ComposedBackend {
+	// get enqueuer
+	enqueuer, _ := backend.(Enqueuer)
+
+	return &ComposedBackend{
+		Sessions: backend,
+		Router:   backend,
+		Queuer:   backend,
+		Enqueuer: enqueuer,
+		Logger:   backend,
+		backend:  backend,
+	}
+}
+
+// Authenticate will authenticate the client using the authenticator or the
+// backend passed to NewComposedBackend.
+func (c *ComposedBackend) Authenticate(client *Client, user, password string) (bool, error) {
+	// use authenticator if available
+	if c.Authenticator != nil {
+		return authenticate(client, user, password, c.Authenticator, nil)
+	}
+
+	// use backend if available
+	if c.backend != nil {
+		return c.backend.Authenticate(client, user, password)
+	}
+
+	return true, nil
+}
+
+// Setup will setup the client using the session store.
+func (c *ComposedBackend) Setup(client *Client, id string, clean bool) (Session, bool, error) {
+	return c.Sessions.Setup(client, id, clean)
+}
+
+// Restore will restore the client using the session store.
+func (c *ComposedBackend) Restore(client *Client) error {
+	return c.Sessions.Restore(client)
+}
+
+// Subscribe will subscribe the client using the router and queue the matching
+// retained messages if a retained store is set.
+func (c *ComposedBackend) Subscribe(client *Client, subs []packet.Subscription, ack Ack) error {
+	// subscribe client
+	err := c.Router.Subscribe(client, subs, ack)
+	if err != nil || c.Retained == nil {
+		return err
+	}
+
+	// check enqueuer
+	if c.Enqueuer == nil {
+		return ErrMissingEnqueuer
+	}
+
+	// handle all subscriptions
+	for _, sub := range subs {
+		// shared subscriptions do not receive retained messages
+		if _, _, ok := parseShared(sub.Topic); ok {
+			continue
+		}
+
+		// get retained messages
+		msgs, err := c.Retained.MatchRetained(client, sub.Topic)
+		if err != nil {
+			return err
+		}
+
+		// queue messages
+		for _, msg := range msgs {
+			// set retain flag and respect maximum qos on a copy
+			msg = msg.Copy()
+			msg.Retain = true
+			if msg.QOS > sub.QOS {
+				msg.QOS = sub.QOS
+			}
+
+			// add message
+			err = c.Enqueuer.EnqueueClient(client, msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Unsubscribe will unsubscribe the client using the router.
+func (c *ComposedBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	return c.Router.Unsubscribe(client, topics, ack)
+}
+
+// Publish will store retained messages using the retained store if set and
+// publish the message using the router.
+func (c *ComposedBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// check retained store and flag
+	if c.Retained != nil && msg.Retain {
+		// store or clear retained message
+		var err error
+		if len(msg.Payload) > 0 {
+			err = c.Retained.StoreRetained(client, msg)
+		} else {
+			err = c.Retained.ClearRetained(client, msg.Topic)
+		}
+		if err != nil {
+			return err
+		}
+
+		// reset retained flag
+		msg.Retain = false
+	}
+
+	return c.Router.Publish(client, msg, ack)
+}
+
+// Dequeue will dequeue the next message using the queuer.
+func (c *ComposedBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
+	return c.Queuer.Dequeue(client)
+}
+
+// Terminate will terminate the client using the session store.
+func (c *ComposedBackend) Terminate(client *Client) error {
+	return c.Sessions.Terminate(client)
+}
+
+// Log will log the event using the logger.
+func (c *ComposedBackend) Log(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error) {
+	// log event if there is a logger
+	if c.Logger != nil {
+		c.Logger.Log(event, client, pkt, msg, err)
+	}
+}
+
+// Close will close all parts that support closing. Parts that are shared by
+// pointer are closed once. The return value denotes if the timeout has been reached.
+func (c *ComposedBackend) Close(timeout time.Duration) bool {
+	// prepare list
+	parts := []interface{}{c.Authenticator, c.Sessions, c.Router, c.Queuer, c.Retained, c.Enqueuer, c.Logger}
+
+	// close parts
+	ok := true
+	closed := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		// get closer
+		closer, isCloser := part.(Closer)
+		if !isCloser || contains(closed, part) {
+			continue
+		}
+
+		// close part
+		closed = append(closed, part)
+		if !closer.Close(timeout) {
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func contains(list []interface{}, value interface{}) bool {
+	// get value
+	v := reflect.ValueOf(value)
+
+	// only reference types have an identity
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func:
+	default:
+		return false
+	}
+
+	// compare identities
+	for _, item := range list {
+		i := reflect.ValueOf(item)
+		if i.Type() == v.Type() && i.Pointer() == v.Pointer() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,218 @@
+package broker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type userAuthenticator struct{}
+
+func (userAuthenticator) Authenticate(_ *Client, user, _ string) (*Identity, error) {
+	if user != "allow" {
+		return nil, nil
+	}
+
+	return &Identity{Subject: user}, nil
+}
+
+type testRetainedStore struct {
+	tree  *topic.Tree
+	mutex sync.Mutex
+}
+
+func (s *testRetainedStore) StoreRetained(_ *Client, msg *packet.Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tree.Set(msg.Topic, msg.Copy())
+
+	return nil
+}
+
+func (s *testRetainedStore) ClearRetained(_ *Client, topic string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tree.Empty(topic)
+
+	return nil
+}
+
+func (s *testRetainedStore) MatchRetained(_ *Client, filter string) ([]*packet.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var msgs []*packet.Message
+	for _, value := range s.tree.Search(filter) {
+		msgs = append(msgs, value.(*packet.Message))
+	}
+
+	return msgs, nil
+}
+
+func TestComposedBackend(t *testing.T) {
+	memory := NewMemoryBackend()
+	store := &testRetainedStore{tree: topic.NewTree()}
+
+	backend := NewComposedBackend(memory)
+	backend.Authenticator = userAuthenticator{}
+	backend.Retained = store
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	// denied
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "deny"
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.NotAuthorized
+
+	f := flow.New().
+		Send(connect).
+		Receive(connack).
+		End()
+
+	assert.NoError(t, f.Test(conn))
+
+	// retain
+	conn, err = transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect.Username = "allow"
+
+	publish := packet.NewPublish()
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), Retain: true}
+
+	f = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(publish).
+		Send(packet.NewDisconnect()).
+		End()
+
+	assert.NoError(t, f.Test(conn))
+
+	msgs, err := store.MatchRetained(nil, "foo")
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 0, memory.Stats().RetainedMessages)
+
+	// receive
+	conn, err = transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "foo"}}
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Test(conn)
+	assert.NoError(t, err)
+
+	// the suback and the retained message may arrive in any order
+	var types []packet.Type
+	for i := 0; i < 2; i++ {
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		types = append(types, pkt.Type())
+
+		if publish, ok := pkt.(*packet.Publish); ok {
+			assert.Equal(t, publish.Message, packet.Message{Topic: "foo", Payload: []byte("bar"), Retain: true})
+		}
+	}
+	assert.Contains(t, types, packet.SUBACK)
+	assert.Contains(t, types, packet.PUBLISH)
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestComposedBackendAuthenticate(t *testing.T) {
+	memory := NewMemoryBackend()
+	memory.Credentials = map[string]string{
+		"allow": "allow",
+	}
+
+	backend := NewComposedBackend(memory)
+
+	ok, err := backend.Authenticate(&Client{}, "allow", "allow")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = backend.Authenticate(&Client{}, "deny", "deny")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	backend.Authenticator = userAuthenticator{}
+
+	client := &Client{}
+	ok, err = backend.Authenticate(client, "allow", "")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &Identity{Subject: "allow"}, ClientIdentity(client))
+
+	ok, err = backend.Authenticate(&Client{}, "deny", "")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+type closingStore struct {
+	testRetainedStore
+	closed int
+}
+
+func (*closingStore) Log(LogEvent, *Client, packet.Generic, *packet.Message, error) {}
+
+func (s *closingStore) Close(time.Duration) bool {
+	s.closed++
+	return true
+}
+
+type valueLogger struct {
+	data []byte
+}
+
+func (valueLogger) Log(LogEvent, *Client, packet.Generic, *packet.Message, error) {}
+
+func (valueLogger) Close(time.Duration) bool {
+	return true
+}
+
+func TestComposedBackendClose(t *testing.T) {
+	store := &closingStore{}
+
+	backend := NewComposedBackend(NewMemoryBackend())
+	backend.Retained = store
+	backend.Logger = store
+
+	assert.True(t, backend.Close(time.Second))
+	assert.Equal(t, 1, store.closed)
+
+	backend.Logger = valueLogger{data: []byte("foo")}
+
+	assert.NotPanics(t, func() {
+		assert.True(t, backend.Close(time.Second))
+	})
+	assert.Equal(t, 2, store.closed)
+}
@@ -0,0 +1,196 @@
+package broker
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type connectSource struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// A ConnectLimiter tracks failed authentications per source IP and bans
+// sources that exceed the threshold for exponentially growing periods. This
+// mitigates credential stuffing attacks against the broker. Connections from
+// banned sources are closed by the Engine before their CONNECT packet is read.
+type ConnectLimiter struct {
+	// The number of failures that are tolerated before a source is banned.
+	//
+	// Will default to 3.
+	Threshold int
+
+	// The ban applied to a source when it exceeds the threshold. The ban is
+	// doubled with every further failure.
+	//
+	// Will default to 1 second.
+	Penalty time.Duration
+
+	// The maximum ban applied to a source.
+	//
+	// Will default to 5 minutes.
+	MaximumPenalty time.Duration
+
+	// The duration after which the failures of a source are forgotten if no
+	// further failures occurred.
+	//
+	// Will default to 10 minutes.
+	Expiry time.Duration
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+
+	sources map[string]*connectSource
+	swept   time.Time
+	mutex   sync.Mutex
+}
+
+// NewConnectLimiter returns a new ConnectLimiter.
+func NewConnectLimiter() *ConnectLimiter {
+	return &ConnectLimiter{
+		Threshold:      3,
+		Penalty:        time.Second,
+		MaximumPenalty: 5 * time.Minute,
+		Expiry:         10 * time.Minute,
+		Now:            time.Now,
+	}
+}
+
+// Allow returns whether connections from the source of the specified address
+// are currently allowed.
+func (l *ConnectLimiter) Allow(addr net.Addr) bool {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// get source
+	source := l.sources[sourceIP(addr)]
+	if source == nil {
+		return true
+	}
+
+	return !l.now().Before(source.until)
+}
+
+// Failure will record a failed authentication from the source of the
+// specified address and ban the source if it exceeds the threshold.
+func (l *ConnectLimiter) Failure(addr net.Addr) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// get time
+	now := l.now()
+
+	// remove expired sources
+	l.sweep(now)
+
+	// get source
+	ip := sourceIP(addr)
+	source := l.sources[ip]
+	if source == nil || (now.Sub(source.last) >= l.expiry() && !now.Before(source.until)) {
+		source = &connectSource{}
+		l.sources[ip] = source
+	}
+
+	// count failure
+	source.failures++
+	source.last = now
+
+	// check threshold
+	threshold := l.Threshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if source.failures <= threshold {
+		return
+	}
+
+	// get settings
+	penalty := l.Penalty
+	if penalty <= 0 {
+		penalty = time.Second
+	}
+	maximum := l.MaximumPenalty
+	if maximum <= 0 {
+		maximum = 5 * time.Minute
+	}
+
+	// double penalty for every further failure
+	for i := threshold + 1; i < source.failures && penalty < maximum; i++ {
+		penalty *= 2
+	}
+	if penalty > maximum {
+		penalty = maximum
+	}
+
+	// ban source
+	source.until = now.Add(penalty)
+}
+
+// Success will forget the failures of the source of the specified address.
+func (l *ConnectLimiter) Success(addr net.Addr) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.sources, sourceIP(addr))
+}
+
+func (l *ConnectLimiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+
+	return time.Now()
+}
+
+func (l *ConnectLimiter) expiry() time.Duration {
+	if l.Expiry > 0 {
+		return l.Expiry
+	}
+
+	return 10 * time.Minute
+}
+
+func (l *ConnectLimiter) sweep(now time.Time) {
+	// prepare map
+	if l.sources == nil {
+		l.sources = make(map[string]*connectSource)
+	}
+
+	// check last sweep
+	expiry := l.expiry()
+	if now.Sub(l.swept) < expiry {
+		return
+	}
+
+	// remove sources that are neither banned nor recently failed
+	for ip, source := range l.sources {
+		if now.Sub(source.last) >= expiry && !now.Before(source.until) {
+			delete(l.sources, ip)
+		}
+	}
+
+	l.swept = now
+}
+
+func sourceIP(addr net.Addr) string {
+	// check address
+	if addr == nil {
+		return ""
+	}
+
+	// strip port
+	str := addr.String()
+	host, _, err := net.SplitHostPort(str)
+	if err != nil {
+		return str
+	}
+
+	return host
+}
@@ -0,0 +1,63 @@
+package broker
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectLimiter(t *testing.T) {
+	now := time.Now()
+
+	limiter := NewConnectLimiter()
+	limiter.Threshold = 2
+	limiter.Penalty = time.Second
+	limiter.MaximumPenalty = 3 * time.Second
+	limiter.Expiry = time.Minute
+	limiter.Now = func() time.Time {
+		return now
+	}
+
+	addr1 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	addr2 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2000}
+	other := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1000}
+
+	// tolerated failures
+	limiter.Failure(addr1)
+	limiter.Failure(addr2)
+	assert.True(t, limiter.Allow(addr1))
+
+	// first penalty
+	limiter.Failure(addr1)
+	assert.False(t, limiter.Allow(addr2))
+	assert.True(t, limiter.Allow(other))
+
+	now = now.Add(time.Second)
+	assert.True(t, limiter.Allow(addr1))
+
+	// doubled penalty
+	limiter.Failure(addr1)
+	now = now.Add(time.Second)
+	assert.False(t, limiter.Allow(addr1))
+	now = now.Add(time.Second)
+	assert.True(t, limiter.Allow(addr1))
+
+	// maximum penalty
+	limiter.Failure(addr1)
+	now = now.Add(3 * time.Second)
+	assert.True(t, limiter.Allow(addr1))
+
+	// success resets failures
+	limiter.Success(addr1)
+	limiter.Failure(addr1)
+	assert.True(t, limiter.Allow(addr1))
+
+	// failures expire
+	limiter.Failure(addr1)
+	now = now.Add(time.Minute)
+	limiter.Failure(addr1)
+	assert.True(t, limiter.Allow(addr1))
+	assert.Len(t, limiter.sources, 1)
+}
@@ -2,7 +2,9 @@
 package broker
 
 import (
+	"errors"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -11,6 +13,19 @@ import (
 	"gopkg.in/tomb.v2"
 )
 
+// A BorrowingBackend is a backend that does not keep the messages passed to
+// Publish. The payloads of published messages may therefore be borrowed from
+// the connection if Engine.ZeroCopy is set.
+type BorrowingBackend interface {
+	Backend
+
+	// BorrowPayloads should return whether the backend drops all references
+	// to a published message and its payload once Publish returned for QOS 0
+	// messages or the ack has been called for QOS 1 and 2 messages. The ack
+	// must not be called if Publish returns an error.
+	BorrowPayloads() bool
+}
+
 // The Engine handles incoming connections and connects them to the backend.
 type Engine struct {
 	// The Backend that will be passed to accepted clients.
@@ -22,10 +37,83 @@ type Engine struct {
 	// The DefaultReadLimit defines the initial read limit.
 	DefaultReadLimit int64
 
+	// The DefaultReceiveRate and DefaultReceiveBurst define the initial
+	// number of packets per second that can be received from a client. The
+	// backend may adjust the rate of individual clients using the connection.
+	DefaultReceiveRate  float64
+	DefaultReceiveBurst int
+
+	// ZeroCopy may be set to decode the payloads of published messages
+	// without copying them if the connection supports it. The buffers backing
+	// the payloads are reused once the backend returned from Publish for QOS 0
+	// messages or called the ack for QOS 1 and 2 messages. It only takes
+	// effect if the backend implements the BorrowingBackend interface and
+	// agrees to borrow payloads. Other backends like the MemoryBackend keep
+	// messages in queues and always receive owned payloads.
+	ZeroCopy bool
+
+	// The DefaultInflightMessages defines the number of QOS 1 and 2 messages
+	// that may be inflight to a client if the backend does not set the
+	// InflightMessages of the client during Setup. Further messages are
+	// delivered once the client acknowledges inflight messages.
+	//
+	// Will default to 10.
+	DefaultInflightMessages int
+
+	// The Pool may be set to process the packets of all clients using a fixed
+	// number of workers.
+	Pool *Pool
+
+	// The Fanout may be set to encode messages that are forwarded to many
+	// clients only once.
+	Fanout *Fanout
+
+	// Tolerant may be set to cope with minor protocol violations of clients,
+	// like invalid client ids of version 3.1 clients or unexpected packets,
+	// instead of disconnecting them. Tolerated violations are logged using the
+	// ProtocolViolation event.
+	Tolerant bool
+
+	// QOSLimits may be set to cap the QOS of messages and subscriptions on
+	// specific topics, e.g. to accept telemetry only with QOS 0. Published
+	// messages are downgraded before they are passed to the backend while the
+	// flow with the publishing client retains the original QOS. The granted
+	// QOS of subscriptions is capped if a limit covers the whole filter.
+	QOSLimits QOSLimits
+
+	// AcceptTimeout may be set to wake the accept loops periodically to check
+	// whether the engine has been closed. If set, the servers passed to Accept
+	// do not need to be closed before calling Close. Servers that do not
+	// support deadlines block until they are closed.
+	AcceptTimeout time.Duration
+
+	// MaximumConnectionAge may be set to disconnect clients once their
+	// connection reaches the specified age, forcing them to reconnect and
+	// authenticate again. This is useful if clients authenticate using short
+	// lived certificates or tokens. The disconnect is logged using the
+	// ServerDisconnected event with the DisconnectMaximumConnectTime reason.
+	MaximumConnectionAge time.Duration
+
+	// ConnectionAgeJitter may be set to shorten the maximum connection age of
+	// each client by a random duration up to the specified value. This spreads
+	// the reconnects of clients that connected at the same time.
+	ConnectionAgeJitter time.Duration
+
+	// The ConnectLimiter may be set to ban source IPs whose clients repeatedly
+	// fail to authenticate. Connections from banned sources are closed
+	// immediately and counted as rejected connections.
+	ConnectLimiter *ConnectLimiter
+
+	// The IPLimiter may be set to limit the number of concurrent connections
+	// per source IP. Connections that exceed the limit are closed immediately
+	// and counted as rejected connections.
+	IPLimiter *IPLimiter
+
 	// OnError can be used to receive errors from engine. If an error is received
 	// the server should be restarted.
 	OnError func(error)
 
+	stats *engineStats
 	mutex sync.Mutex
 	tomb  tomb.Tomb
 }
@@ -35,21 +123,45 @@ func NewEngine(backend Backend) *Engine {
 	return &Engine{
 		Backend:        backend,
 		ConnectTimeout: 10 * time.Second,
+		Fanout:         NewFanout(64),
+		stats:          newEngineStats(),
 	}
 }
 
 // Accept begins accepting connections from the passed server.
 func (e *Engine) Accept(server transport.Server) {
+	// prepare stats
+	e.mutex.Lock()
+	if e.stats == nil {
+		e.stats = newEngineStats()
+	}
+	stats := e.stats
+	e.mutex.Unlock()
+
 	e.tomb.Go(func() error {
+		// track listener
+		stats.listen(1)
+		defer stats.listen(-1)
+
 		for {
 			// return if dying
 			if !e.tomb.Alive() {
 				return tomb.ErrDying
 			}
 
+			// set deadline, unsupported deadlines are ignored
+			if e.AcceptTimeout > 0 {
+				_ = server.SetDeadline(time.Now().Add(e.AcceptTimeout))
+			}
+
 			// accept next connection
 			conn, err := server.Accept()
 			if err != nil {
+				// check again if the deadline has been reached
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					continue
+				}
+
 				// call error callback if available
 				if e.OnError != nil {
 					e.OnError(err)
@@ -84,27 +196,104 @@ func (e *Engine) Handle(conn transport.Conn) bool {
 		return false
 	}
 
+	// prepare stats
+	if e.stats == nil {
+		e.stats = newEngineStats()
+	}
+
+	// close conn immediately if the source is banned
+	if e.ConnectLimiter != nil && !e.ConnectLimiter.Allow(conn.RemoteAddr()) {
+		_ = conn.Close()
+		e.stats.reject()
+		return true
+	}
+
+	// close conn immediately if the source has too many connections
+	if e.IPLimiter != nil && !e.IPLimiter.Acquire(conn.RemoteAddr()) {
+		_ = conn.Close()
+		e.stats.reject()
+		return true
+	}
+
 	// set default read limit
 	conn.SetReadLimit(e.DefaultReadLimit)
 
+	// set default receive rate
+	if rc, ok := conn.(transport.RateLimitedConn); ok && e.DefaultReceiveRate > 0 {
+		rc.SetReceiveRate(e.DefaultReceiveRate, e.DefaultReceiveBurst)
+	}
+
+	// enable zero copy decoding
+	if zc, ok := conn.(transport.ZeroCopyConn); ok && e.borrowing() {
+		zc.SetZeroCopy(true)
+	}
+
 	// set initial read timeout
 	conn.SetReadTimeout(e.ConnectTimeout)
 
 	// handle client
-	NewClient(e.Backend, conn)
+	newClient(e.Backend, conn, e)
 
 	return true
 }
 
+// borrowing returns whether payloads may be borrowed from connections.
+func (e *Engine) borrowing() bool {
+	// check setting
+	if !e.ZeroCopy {
+		return false
+	}
+
+	// check backend
+	backend, ok := e.Backend.(BorrowingBackend)
+
+	return ok && backend.BorrowPayloads()
+}
+
+// Stats returns a snapshot of the engine statistics. The backend statistics
+// are only set if the backend implements the StatsBackend interface.
+func (e *Engine) Stats() Stats {
+	// acquire mutex
+	e.mutex.Lock()
+
+	// prepare stats
+	if e.stats == nil {
+		e.stats = newEngineStats()
+	}
+
+	// get engine stats
+	stats := e.stats.snapshot()
+
+	// release mutex
+	e.mutex.Unlock()
+
+	// get backend stats
+	if backend, ok := e.Backend.(StatsBackend); ok {
+		stats.BackendStats = backend.Stats()
+	}
+
+	return stats
+}
+
 // Close will stop handling incoming connections and close all acceptors. The
 // call will block until all acceptors returned.
 //
-// Note: All passed servers to Accept must be closed before calling this method.
+// Note: All passed servers to Accept must be closed before calling this method
+// unless an AcceptTimeout is set.
 func (e *Engine) Close() {
 	// acquire mutex
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
+	// track at least one goroutine as the tomb never dies otherwise if no
+	// server has been accepted
+	if e.tomb.Alive() {
+		e.tomb.Go(func() error {
+			<-e.tomb.Dying()
+			return nil
+		})
+	}
+
 	// stop acceptors
 	e.tomb.Kill(nil)
 	_ = e.tomb.Wait()
@@ -1,12 +1,16 @@
 package broker
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/256dpi/gomqtt/client"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -51,3 +55,576 @@ func TestDefaultReadLimit(t *testing.T) {
 	close(quit)
 	safeReceive(done)
 }
+
+func TestDefaultReceiveRate(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.DefaultReceiveRate = 100
+	engine.DefaultReceiveBurst = 1
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	start := time.Now()
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack())
+	for i := 0; i < 5; i++ {
+		f.Send(packet.NewPingreq()).Receive(packet.NewPingresp())
+	}
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 45*time.Millisecond)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestMaximumConnectionAge(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.MaximumConnectionAge = 100 * time.Millisecond
+	engine.ConnectionAgeJitter = 50 * time.Millisecond
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	start := time.Now()
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.True(t, time.Since(start) > 50*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineConnectLimiter(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.Credentials = map[string]string{
+		"user": "secret",
+	}
+
+	engine := NewEngine(backend)
+	engine.ConnectLimiter = NewConnectLimiter()
+	engine.ConnectLimiter.Threshold = 1
+	engine.ConnectLimiter.Penalty = time.Hour
+
+	port, quit, done := Run(engine, "tcp")
+
+	connect := packet.NewConnect()
+	connect.Username = "user"
+	connect.Password = "invalid"
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.NotAuthorized
+
+	for i := 0; i < 2; i++ {
+		conn, err := transport.Dial("tcp://localhost:" + port)
+		assert.NoError(t, err)
+
+		err = flow.New().
+			Send(connect).
+			Receive(connack).
+			End().
+			Test(conn)
+		assert.NoError(t, err)
+	}
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	assert.Equal(t, int64(1), engine.Stats().RejectedConnections)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineIPLimiter(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.IPLimiter = NewIPLimiter(1)
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn1, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Test(conn1)
+	assert.NoError(t, err)
+
+	conn2, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	pkt, err := conn2.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	assert.Equal(t, int64(1), engine.Stats().RejectedConnections)
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn1)
+	assert.NoError(t, err)
+
+	for i := 0; i < 100 && engine.Stats().CurrentConnections > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn3, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn3)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineQOSLimits(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.QOSLimits = QOSLimits{
+		{Filter: "telemetry/#", QOS: 0},
+	}
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "telemetry/#", QOS: 1},
+		{Topic: "#", QOS: 1},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0, 1}
+
+	publish := packet.NewPublish()
+	publish.ID = 2
+	publish.Message.Topic = "telemetry/temp"
+	publish.Message.Payload = []byte("42")
+	publish.Message.QOS = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 2
+
+	delivered := packet.NewPublish()
+	delivered.Message.Topic = "telemetry/temp"
+	delivered.Message.Payload = []byte("42")
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Send(publish).
+		Receive(puback, delivered).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestDefaultInflightMessages(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.DefaultInflightMessages = 1
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test", QOS: 1},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{1}
+
+	publish1 := packet.NewPublish()
+	publish1.ID = 2
+	publish1.Message.Topic = "test"
+	publish1.Message.Payload = []byte("1")
+	publish1.Message.QOS = 1
+
+	puback1 := packet.NewPuback()
+	puback1.ID = 2
+
+	publish2 := packet.NewPublish()
+	publish2.ID = 3
+	publish2.Message.Topic = "test"
+	publish2.Message.Payload = []byte("2")
+	publish2.Message.QOS = 1
+
+	puback2 := packet.NewPuback()
+	puback2.ID = 3
+
+	delivered1 := packet.NewPublish()
+	delivered1.ID = 1
+	delivered1.Message.Topic = "test"
+	delivered1.Message.Payload = []byte("1")
+	delivered1.Message.QOS = 1
+
+	acked1 := packet.NewPuback()
+	acked1.ID = 1
+
+	delivered2 := packet.NewPublish()
+	delivered2.ID = 2
+	delivered2.Message.Topic = "test"
+	delivered2.Message.Payload = []byte("2")
+	delivered2.Message.QOS = 1
+
+	acked2 := packet.NewPuback()
+	acked2.ID = 2
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Send(publish1).
+		Receive(puback1, delivered1).
+		Send(publish2).
+		Receive(puback2).
+		Delay(50 * time.Millisecond).
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Send(acked1).
+		Receive(delivered2).
+		Send(acked2).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+type forwardBackend struct {
+	*MemoryBackend
+}
+
+func (b *forwardBackend) BorrowPayloads() bool {
+	return true
+}
+
+func (b *forwardBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// forward a copy as the payload is only borrowed
+	return b.MemoryBackend.Publish(client, msg.DeepCopy(), ack)
+}
+
+func TestEngineZeroCopy(t *testing.T) {
+	engine := NewEngine(&forwardBackend{MemoryBackend: NewMemoryBackend()})
+	engine.ZeroCopy = true
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test", QOS: 0},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Test(conn)
+	assert.NoError(t, err)
+
+	// publish messages with different payloads that reuse the same buffers
+	for i := 0; i < 100; i++ {
+		publish := packet.NewPublish()
+		publish.Message.Topic = "test"
+		publish.Message.Payload = []byte(strings.Repeat(strconv.Itoa(i), i%7+1))
+		publish.Message.QOS = packet.QOS(i % 2)
+		if publish.Message.QOS > 0 {
+			publish.ID = packet.ID(i)
+		}
+
+		err = conn.Send(publish, false)
+		assert.NoError(t, err)
+	}
+
+	// collect forwarded payloads and acknowledgements, the order of QOS 0 and
+	// 1 messages may differ
+	var payloads []string
+	var pubacks int
+	for len(payloads) < 100 || pubacks < 50 {
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+
+		switch pkt := pkt.(type) {
+		case *packet.Publish:
+			payloads = append(payloads, string(pkt.Message.Payload))
+		case *packet.Puback:
+			pubacks++
+		}
+	}
+
+	// check payloads
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, payloads, strings.Repeat(strconv.Itoa(i), i%7+1))
+	}
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+type borrowBackend struct {
+	*MemoryBackend
+	err        error
+	msgs       chan *packet.Message
+	terminated chan struct{}
+}
+
+func (b *borrowBackend) BorrowPayloads() bool {
+	return true
+}
+
+func (b *borrowBackend) Publish(_ *Client, msg *packet.Message, ack Ack) error {
+	b.msgs <- msg
+
+	if b.err != nil {
+		return b.err
+	}
+
+	if ack != nil {
+		ack()
+	}
+
+	return nil
+}
+
+func (b *borrowBackend) Terminate(client *Client) error {
+	err := b.MemoryBackend.Terminate(client)
+	close(b.terminated)
+	return err
+}
+
+func TestEngineZeroCopyBackend(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.ZeroCopy = true
+	assert.False(t, engine.borrowing())
+
+	engine.Backend = &forwardBackend{MemoryBackend: NewMemoryBackend()}
+	assert.True(t, engine.borrowing())
+
+	engine.ZeroCopy = false
+	assert.False(t, engine.borrowing())
+}
+
+func TestEngineZeroCopyReleaseQOS2(t *testing.T) {
+	backend := &borrowBackend{
+		MemoryBackend: NewMemoryBackend(),
+		msgs:          make(chan *packet.Message, 1),
+		terminated:    make(chan struct{}),
+	}
+
+	engine := NewEngine(backend)
+	engine.ZeroCopy = true
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message = packet.Message{Topic: "test", Payload: []byte("test"), QOS: 2}
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(publish).
+		Receive(&packet.Pubrec{ID: 1}).
+		Send(&packet.Pubrel{ID: 1}).
+		Receive(&packet.Pubcomp{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	safeReceive(backend.terminated)
+
+	// the payload has been released after the flow completed
+	msg := <-backend.msgs
+	assert.Equal(t, "test", msg.Topic)
+	assert.Nil(t, msg.Payload)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineZeroCopyReleaseQOS1Error(t *testing.T) {
+	backend := &borrowBackend{
+		MemoryBackend: NewMemoryBackend(),
+		err:           errors.New("failed"),
+		msgs:          make(chan *packet.Message, 1),
+		terminated:    make(chan struct{}),
+	}
+
+	engine := NewEngine(backend)
+	engine.ZeroCopy = true
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message = packet.Message{Topic: "test", Payload: []byte("test"), QOS: 1}
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(publish).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	safeReceive(backend.terminated)
+
+	// the payload has been released although the ack has not been called
+	msg := <-backend.msgs
+	assert.Equal(t, "test", msg.Topic)
+	assert.Nil(t, msg.Payload)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineCloseWithoutAccept(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+
+	done := make(chan struct{})
+	go func() {
+		engine.Close()
+		engine.Close()
+		close(done)
+	}()
+
+	safeReceive(done)
+}
+
+func TestEngineAcceptTimeout(t *testing.T) {
+	server, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	engine := NewEngine(NewMemoryBackend())
+	engine.AcceptTimeout = 10 * time.Millisecond
+	engine.Accept(server)
+
+	done := make(chan struct{})
+	go func() {
+		engine.Close()
+		close(done)
+	}()
+
+	safeReceive(done)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestEngineStats(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "foo", Payload: []byte("bar"), Retain: true}}).
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Test(conn)
+	assert.NoError(t, err)
+
+	stats := engine.Stats()
+	assert.True(t, stats.Uptime > 0)
+	assert.Equal(t, int64(1), stats.CurrentConnections)
+	assert.Equal(t, int64(1), stats.TotalConnections)
+	assert.Equal(t, map[packet.Type]int64{
+		packet.CONNECT: 1,
+		packet.PUBLISH: 1,
+		packet.PINGREQ: 1,
+	}, stats.PacketsReceived)
+	assert.Equal(t, map[packet.Type]int64{
+		packet.CONNACK:  1,
+		packet.PINGRESP: 1,
+	}, stats.PacketsSent)
+	assert.Equal(t, 1, stats.RetainedMessages)
+	assert.Equal(t, 1, stats.Sessions)
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+
+	for i := 0; i < 100 && engine.Stats().CurrentConnections > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats = engine.Stats()
+	assert.Equal(t, int64(0), stats.CurrentConnections)
+	assert.Equal(t, 0, stats.Sessions)
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Fanout shares the encoding of messages that are forwarded to many clients
+// so that every message is only encoded once. It remembers the encodings of
+// the most recently dequeued messages by their pointer. Messages are therefore
+// only shared if the backend returns the same message to all subscribers, as
+// the MemoryBackend does for subscriptions with the same QOS level.
+type Fanout struct {
+	// The number of recently dequeued messages for which the encoding is
+	// remembered.
+	//
+	// Will default to 64.
+	Size int
+
+	encodings map[*packet.Message]*packet.Encoding
+	ring      []*packet.Message
+	next      int
+	mutex     sync.Mutex
+}
+
+// NewFanout returns a new Fanout that remembers the specified number of
+// encodings.
+func NewFanout(size int) *Fanout {
+	return &Fanout{
+		Size: size,
+	}
+}
+
+// Encoding returns the shared encoding for the specified message.
+func (f *Fanout) Encoding(msg *packet.Message) *packet.Encoding {
+	// acquire mutex
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// prepare ring
+	if f.ring == nil {
+		if f.Size <= 0 {
+			f.Size = 64
+		}
+
+		f.encodings = make(map[*packet.Message]*packet.Encoding, f.Size)
+		f.ring = make([]*packet.Message, f.Size)
+	}
+
+	// get existing encoding
+	encoding, ok := f.encodings[msg]
+	if ok {
+		return encoding
+	}
+
+	// evict oldest encoding
+	if f.ring[f.next] != nil {
+		delete(f.encodings, f.ring[f.next])
+	}
+
+	// add encoding
+	encoding = packet.NewEncoding(*msg)
+	f.encodings[msg] = encoding
+	f.ring[f.next] = msg
+	f.next = (f.next + 1) % len(f.ring)
+
+	return encoding
+}
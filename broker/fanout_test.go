@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanout(t *testing.T) {
+	fanout := NewFanout(2)
+
+	msg1 := &packet.Message{Topic: "foo", Payload: []byte("1"), QOS: 1}
+	msg2 := &packet.Message{Topic: "foo", Payload: []byte("2"), QOS: 1}
+	msg3 := &packet.Message{Topic: "foo", Payload: []byte("3"), QOS: 1}
+
+	enc1 := fanout.Encoding(msg1)
+	assert.NotNil(t, enc1)
+	assert.True(t, enc1 == fanout.Encoding(msg1))
+
+	enc2 := fanout.Encoding(msg2)
+	assert.True(t, enc1 != enc2)
+	assert.True(t, enc2 == fanout.Encoding(msg2))
+
+	fanout.Encoding(msg3)
+	assert.True(t, enc1 != fanout.Encoding(msg1))
+	assert.Len(t, fanout.encodings, 2)
+
+	pkt := packet.NewPublish()
+	pkt.Message = *msg2
+	pkt.ID = 42
+	pkt.Encoding = enc2
+
+	buf, err := pkt.EncodeTo(nil)
+	assert.NoError(t, err)
+
+	out := packet.NewPublish()
+	_, err = out.Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.ID(42), out.ID)
+	assert.Equal(t, *msg2, out.Message)
+}
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// WriteSessions will encode the session states to the writer. Together with
+// ExportSessions, ReadSessions and ImportSession of the MemoryBackend this can
+// be used to pass the stored sessions to a replacement process that inherits
+// the listeners of the broker, e.g. using a pipe passed as an extra file.
+func WriteSessions(w io.Writer, states []*SessionState) error {
+	// prepare encoder
+	enc := json.NewEncoder(w)
+
+	// encode states
+	for _, state := range states {
+		err := enc.Encode(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadSessions will decode session states from the reader until it is closed.
+func ReadSessions(r io.Reader) ([]*SessionState, error) {
+	// prepare decoder
+	dec := json.NewDecoder(r)
+
+	// decode states
+	var states []*SessionState
+	for {
+		var state SessionState
+		err := dec.Decode(&state)
+		if errors.Is(err, io.EOF) {
+			return states, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		states = append(states, &state)
+	}
+}
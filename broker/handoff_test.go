@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionHandoff(t *testing.T) {
+	backend1 := NewMemoryBackend()
+
+	for _, id := range []string{"foo", "bar"} {
+		err := backend1.ImportSession(&SessionState{
+			ID:            id,
+			Subscriptions: []packet.Subscription{{Topic: "baz", QOS: 1}},
+			Messages:      []*packet.Message{{Topic: "baz", Payload: []byte(id), QOS: 1}},
+		})
+		assert.NoError(t, err)
+	}
+
+	states, err := backend1.ExportSessions()
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+
+	states, err = backend1.ExportSessions()
+	assert.NoError(t, err)
+	assert.Empty(t, states)
+
+	assert.NoError(t, backend1.ImportSession(&SessionState{ID: "foo"}))
+	assert.NoError(t, backend1.ImportSession(&SessionState{
+		ID:            "bar",
+		Subscriptions: []packet.Subscription{{Topic: "baz", QOS: 1}},
+		Messages:      []*packet.Message{{Topic: "baz", Payload: []byte("bar"), QOS: 1}},
+	}))
+
+	states, err = backend1.ExportSessions()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = WriteSessions(&buf, states)
+	assert.NoError(t, err)
+
+	decoded, err := ReadSessions(&buf)
+	assert.NoError(t, err)
+	sort.Slice(decoded, func(i, j int) bool {
+		return decoded[i].ID < decoded[j].ID
+	})
+	assert.Equal(t, []*SessionState{
+		{
+			ID:            "bar",
+			Subscriptions: []packet.Subscription{{Topic: "baz", QOS: 1}},
+			Messages:      []*packet.Message{{Topic: "baz", Payload: []byte("bar"), QOS: 1}},
+		},
+		{
+			ID: "foo",
+		},
+	}, decoded)
+
+	_, err = ReadSessions(bytes.NewBufferString("{"))
+	assert.Error(t, err)
+
+	backend2 := NewMemoryBackend()
+	for _, state := range decoded {
+		assert.NoError(t, backend2.ImportSession(state))
+	}
+
+	state, err := backend2.ExportSession("bar")
+	assert.NoError(t, err)
+	assert.Equal(t, decoded[0], state)
+
+	assert.True(t, backend1.Close(time.Second))
+	assert.True(t, backend2.Close(time.Second))
+}
@@ -0,0 +1,154 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBackendTimeout is reported by Health if the backend did not respond to a
+// ping in time.
+var ErrBackendTimeout = errors.New("backend timeout")
+
+// A HealthBackend is a backend that can report whether the systems it depends
+// on, like databases or other nodes, are reachable.
+type HealthBackend interface {
+	Backend
+
+	// Ping should return an error if the backend is currently unable to serve
+	// clients.
+	Ping() error
+}
+
+// HealthStatus describes the health of an Engine.
+type HealthStatus struct {
+	// Whether the engine has not been closed.
+	Live bool `json:"live"`
+
+	// Whether the engine is live, accepting connections, not draining and the
+	// backend is reachable.
+	Ready bool `json:"ready"`
+
+	// Whether the engine is draining.
+	Draining bool `json:"draining"`
+
+	// The number of servers the engine is accepting connections from.
+	Listeners int64 `json:"listeners"`
+
+	// The error returned by the backend, if any.
+	BackendError string `json:"backendError,omitempty"`
+}
+
+// Health reports the liveness and readiness of an Engine. It can be mounted as
+// a http.Handler to serve probes for orchestrators like Kubernetes. Requests
+// to a path ending in "/livez" report the liveness and all other requests
+// report the readiness. The status is encoded as JSON and the status code is
+// 200 if the probe succeeded and 503 otherwise.
+type Health struct {
+	// The engine to check.
+	Engine *Engine
+
+	// The timeout for pinging the backend. A backend that does not respond
+	// in time is treated as unreachable.
+	//
+	// Will default to 5 seconds.
+	PingTimeout time.Duration
+
+	draining atomic.Bool
+}
+
+// NewHealth returns a new Health for the specified engine.
+func NewHealth(engine *Engine) *Health {
+	return &Health{
+		Engine:      engine,
+		PingTimeout: 5 * time.Second,
+	}
+}
+
+// Drain will mark the engine as draining to fail readiness probes. This can be
+// used to stop the routing of new clients before the engine is closed.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Resume will clear the draining mark.
+func (h *Health) Resume() {
+	h.draining.Store(false)
+}
+
+// Live returns whether the engine has not been closed.
+func (h *Health) Live() bool {
+	return h.Engine.tomb.Alive()
+}
+
+// Status returns the current status of the engine.
+func (h *Health) Status() HealthStatus {
+	// prepare status
+	status := HealthStatus{
+		Live:      h.Live(),
+		Draining:  h.draining.Load(),
+		Listeners: h.Engine.Stats().Listeners,
+	}
+
+	// ping backend
+	if err := h.ping(); err != nil {
+		status.BackendError = err.Error()
+	}
+
+	// check readiness
+	status.Ready = status.Live && !status.Draining && status.Listeners > 0 && status.BackendError == ""
+
+	return status
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// get status
+	status := h.Status()
+
+	// check probe
+	ok := status.Ready
+	if strings.HasSuffix(r.URL.Path, "/livez") {
+		ok = status.Live
+	}
+
+	// write status
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (h *Health) ping() error {
+	// check backend
+	backend, ok := h.Engine.Backend.(HealthBackend)
+	if !ok {
+		return nil
+	}
+
+	// get timeout
+	timeout := h.PingTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	// ping backend
+	result := make(chan error, 1)
+	go func() {
+		result <- backend.Ping()
+	}()
+
+	// await result
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return ErrBackendTimeout
+	}
+}
@@ -0,0 +1,108 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/transport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pingBackend struct {
+	*MemoryBackend
+	err   error
+	delay time.Duration
+	mutex sync.Mutex
+}
+
+func (b *pingBackend) set(err error, delay time.Duration) {
+	b.mutex.Lock()
+	b.err, b.delay = err, delay
+	b.mutex.Unlock()
+}
+
+func (b *pingBackend) Ping() error {
+	b.mutex.Lock()
+	err, delay := b.err, b.delay
+	b.mutex.Unlock()
+
+	time.Sleep(delay)
+
+	return err
+}
+
+func probe(t *testing.T, health *Health, path string) (int, HealthStatus) {
+	rec := httptest.NewRecorder()
+	health.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	var status HealthStatus
+	err := json.Unmarshal(rec.Body.Bytes(), &status)
+	assert.NoError(t, err)
+
+	return rec.Code, status
+}
+
+func TestHealth(t *testing.T) {
+	backend := &pingBackend{MemoryBackend: NewMemoryBackend()}
+	engine := NewEngine(backend)
+	health := NewHealth(engine)
+
+	code, status := probe(t, health, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthStatus{Live: true}, status)
+
+	code, _ = probe(t, health, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	server, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+	engine.Accept(server)
+
+	for i := 0; i < 100 && engine.Stats().Listeners == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	code, status = probe(t, health, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthStatus{Live: true, Ready: true, Listeners: 1}, status)
+
+	backend.set(errors.New("unreachable"), 0)
+
+	code, status = probe(t, health, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthStatus{Live: true, Listeners: 1, BackendError: "unreachable"}, status)
+
+	backend.set(nil, 20*time.Millisecond)
+	health.PingTimeout = time.Millisecond
+
+	assert.Equal(t, ErrBackendTimeout.Error(), health.Status().BackendError)
+
+	backend.set(nil, 0)
+
+	health.Drain()
+
+	code, status = probe(t, health, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthStatus{Live: true, Draining: true, Listeners: 1}, status)
+
+	code, _ = probe(t, health, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+
+	health.Resume()
+	assert.True(t, health.Status().Ready)
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	code, status = probe(t, health, "/livez")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthStatus{}, status)
+}
@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// An InfluxSink is a Sink that writes points using the InfluxDB line protocol
+// over HTTP. The value of each point is written as the "value" field with
+// nanosecond precision.
+type InfluxSink struct {
+	// The write endpoint, e.g. "http://localhost:8086/api/v2/write?org=o&bucket=b"
+	// or "http://localhost:8086/write?db=d".
+	URL string
+
+	// The token sent in the authorization header if set.
+	Token string
+
+	// The HTTP client used to send the requests.
+	//
+	// Will default to a client with a ten second timeout.
+	Client *http.Client
+}
+
+// NewInfluxSink returns a new InfluxSink that writes to the specified URL.
+func NewInfluxSink(url string) *InfluxSink {
+	return &InfluxSink{
+		URL: url,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Write implements the Sink interface.
+func (s *InfluxSink) Write(points []Point) error {
+	// encode points
+	var buf bytes.Buffer
+	for _, point := range points {
+		WriteLineProtocol(&buf, point)
+	}
+
+	// prepare request
+	req, err := http.NewRequest("POST", s.URL, &buf)
+	if err != nil {
+		return err
+	}
+
+	// set headers
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+
+	// perform request
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// drain and close body to allow connection reuse
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+
+	// check status
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("influx %s responded with status %d", s.URL, res.StatusCode)
+	}
+
+	return nil
+}
+
+// WriteLineProtocol will write the point as a single line using the InfluxDB
+// line protocol. Tags are sorted by key and tags with empty keys or values are
+// omitted.
+func WriteLineProtocol(buf *bytes.Buffer, point Point) {
+	// write measurement
+	buf.WriteString(influxMeasurementEscaper.Replace(point.Measurement))
+
+	// sort tags
+	keys := make([]string, 0, len(point.Tags))
+	for key := range point.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// write tags
+	for _, key := range keys {
+		value := point.Tags[key]
+		if key == "" || value == "" {
+			continue
+		}
+
+		buf.WriteByte(',')
+		buf.WriteString(influxTagEscaper.Replace(key))
+		buf.WriteByte('=')
+		buf.WriteString(influxTagEscaper.Replace(value))
+	}
+
+	// write field
+	buf.WriteString(" value=")
+	buf.WriteString(strconv.FormatFloat(point.Value, 'f', -1, 64))
+
+	// write timestamp
+	if !point.Time.IsZero() {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(point.Time.UnixNano(), 10))
+	}
+
+	buf.WriteByte('\n')
+}
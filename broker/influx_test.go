@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLineProtocol(t *testing.T) {
+	var buf bytes.Buffer
+
+	WriteLineProtocol(&buf, Point{
+		Measurement: "cpu load,total",
+		Tags: map[string]string{
+			"host":  "server 1",
+			"empty": "",
+			"a=b":   "c,d",
+		},
+		Value: 0.25,
+		Time:  time.Unix(1, 500),
+	})
+
+	WriteLineProtocol(&buf, Point{
+		Measurement: "count",
+		Value:       1e21,
+	})
+
+	assert.Equal(t, "cpu\\ load\\,total,a\\=b=c\\,d,host=server\\ 1 value=0.25 1000000500\n"+
+		"count value=1000000000000000000000\n", buf.String())
+}
+
+func TestInfluxSink(t *testing.T) {
+	var body []byte
+	var auth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		auth = r.Header.Get("Authorization")
+
+		if r.URL.Query().Get("bucket") != "telemetry" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxSink(server.URL + "/api/v2/write?bucket=telemetry")
+	sink.Token = "secret"
+
+	err := sink.Write([]Point{
+		{Measurement: "foo", Value: 1, Time: time.Unix(0, 1)},
+		{Measurement: "bar", Value: 2, Time: time.Unix(0, 2)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo value=1 1\nbar value=2 2\n", string(body))
+	assert.Equal(t, "Token secret", auth)
+
+	sink.URL = server.URL + "/api/v2/write?bucket=other"
+	err = sink.Write([]Point{{Measurement: "foo", Value: 1}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"net"
+	"sync"
+)
+
+type ipLimit struct {
+	network *net.IPNet
+	maximum int
+}
+
+// An IPLimiter limits the number of concurrent connections per source IP.
+// Networks may be configured with their own limit, e.g. to allow more
+// connections from sites that connect many clients through a NAT, or may be
+// exempted from limits altogether. The limit of the most specific matching
+// network applies. Connections that exceed the limit are closed by the Engine
+// before their CONNECT packet is read.
+type IPLimiter struct {
+	// The maximum number of concurrent connections per source IP that does
+	// not belong to a configured network. Zero means unlimited.
+	Maximum int
+
+	limits []ipLimit
+	counts map[string]int
+	mutex  sync.Mutex
+}
+
+// NewIPLimiter returns a new IPLimiter with the specified default maximum.
+func NewIPLimiter(maximum int) *IPLimiter {
+	return &IPLimiter{
+		Maximum: maximum,
+	}
+}
+
+// Limit will set the maximum number of concurrent connections per source IP
+// for the network specified in CIDR notation. Zero means unlimited.
+func (l *IPLimiter) Limit(cidr string, maximum int) error {
+	// parse network
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// replace existing limit
+	for i, limit := range l.limits {
+		if limit.network.String() == network.String() {
+			l.limits[i].maximum = maximum
+			return nil
+		}
+	}
+
+	// add limit
+	l.limits = append(l.limits, ipLimit{
+		network: network,
+		maximum: maximum,
+	})
+
+	return nil
+}
+
+// Exempt will exempt the network specified in CIDR notation from limits.
+func (l *IPLimiter) Exempt(cidr string) error {
+	return l.Limit(cidr, 0)
+}
+
+// Acquire will count a connection from the source of the specified address
+// and return true if the limit has not been exceeded. Successful calls must
+// be followed by a call to Release once the connection has been closed.
+func (l *IPLimiter) Acquire(addr net.Addr) bool {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// prepare map
+	if l.counts == nil {
+		l.counts = make(map[string]int)
+	}
+
+	// check limit
+	ip := sourceIP(addr)
+	maximum := l.maximum(ip)
+	if maximum > 0 && l.counts[ip] >= maximum {
+		return false
+	}
+
+	// count connection
+	l.counts[ip]++
+
+	return true
+}
+
+// Release will forget a connection from the source of the specified address.
+func (l *IPLimiter) Release(addr net.Addr) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// uncount connection
+	ip := sourceIP(addr)
+	if l.counts[ip] <= 1 {
+		delete(l.counts, ip)
+	} else {
+		l.counts[ip]--
+	}
+}
+
+// Connections returns the number of current connections from the source of
+// the specified address.
+func (l *IPLimiter) Connections(addr net.Addr) int {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.counts[sourceIP(addr)]
+}
+
+func (l *IPLimiter) maximum(ip string) int {
+	// parse ip
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return l.Maximum
+	}
+
+	// find most specific network
+	maximum, size := l.Maximum, -1
+	for _, limit := range l.limits {
+		if ones, _ := limit.network.Mask.Size(); ones > size && limit.network.Contains(parsed) {
+			maximum, size = limit.maximum, ones
+		}
+	}
+
+	return maximum
+}
@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPLimiter(t *testing.T) {
+	limiter := NewIPLimiter(1)
+	assert.NoError(t, limiter.Limit("10.0.0.0/8", 2))
+	assert.NoError(t, limiter.Limit("10.1.0.0/16", 3))
+	assert.NoError(t, limiter.Exempt("192.168.0.0/16"))
+	assert.Error(t, limiter.Limit("foo", 1))
+
+	host := &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1000}
+	nat := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	site := &net.TCPAddr{IP: net.ParseIP("10.1.0.1"), Port: 1000}
+	local := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 1000}
+
+	// default limit
+	assert.True(t, limiter.Acquire(host))
+	assert.False(t, limiter.Acquire(host))
+	assert.Equal(t, 1, limiter.Connections(host))
+	limiter.Release(host)
+	assert.Equal(t, 0, limiter.Connections(host))
+	assert.True(t, limiter.Acquire(host))
+
+	// network limits
+	for i := 0; i < 2; i++ {
+		assert.True(t, limiter.Acquire(nat))
+	}
+	assert.False(t, limiter.Acquire(nat))
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Acquire(site))
+	}
+	assert.False(t, limiter.Acquire(site))
+
+	// exemption
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.Acquire(local))
+	}
+
+	// replaced limit
+	assert.NoError(t, limiter.Limit("10.0.0.0/8", 3))
+	assert.True(t, limiter.Acquire(nat))
+}
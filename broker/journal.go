@@ -0,0 +1,1038 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrJournalClosed is returned when using a closed journal.
+var ErrJournalClosed = errors.New("journal closed")
+
+// ErrCorruptJournal is returned by OpenJournal if a record in the middle of a
+// segment is corrupt.
+var ErrCorruptJournal = errors.New("corrupt journal")
+
+// ErrReplayUnsupported is returned by JournalBackend.Replay if the wrapped
+// backend does not implement the Enqueuer interface.
+var ErrReplayUnsupported = errors.New("replay unsupported")
+
+// journalHeaderLen is the length of the record header that holds the length
+// and checksum of the record.
+const journalHeaderLen = 8
+
+// journalExt is the file extension of journal segments.
+const journalExt = ".journal"
+
+// A JournalEntry is a message read from a Journal.
+type JournalEntry struct {
+	// The sequence of the entry in the journal.
+	Seq uint64
+
+	// The time the message has been appended.
+	Time time.Time
+
+	// The journaled message.
+	Message *packet.Message
+}
+
+type journalSegment struct {
+	path  string
+	first uint64
+	start time.Time
+	size  int64
+}
+
+// A Journal is an append-only log of messages that is split into segment
+// files. Old segments are removed according to the retention policy. Appended
+// messages are written to the operating system immediately, but only synced
+// to disk when Sync is called.
+type Journal struct {
+	// The size in bytes after which a new segment is started.
+	//
+	// Will default to 64 MiB.
+	SegmentSize int64
+
+	// The maximum age of messages after which their segment is removed.
+	//
+	// Will default to no limit.
+	MaxAge time.Duration
+
+	// The maximum total size in bytes of all segments.
+	//
+	// Will default to no limit.
+	MaxSize int64
+
+	dir      string
+	segments []*journalSegment
+	file     *os.File
+	seq      uint64
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// OpenJournal opens or creates the journal in the specified directory. An
+// incomplete record at the end of the last segment, that has been left by an
+// interrupted write, is discarded.
+func OpenJournal(dir string) (*Journal, error) {
+	// create directory
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// list files
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare journal
+	j := &Journal{
+		SegmentSize: 64 << 20,
+		dir:         dir,
+	}
+
+	// collect segments
+	for _, file := range files {
+		// check name
+		name := file.Name()
+		if !strings.HasSuffix(name, journalExt) {
+			continue
+		}
+
+		// parse first sequence
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, journalExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		j.segments = append(j.segments, &journalSegment{
+			path:  filepath.Join(dir, name),
+			first: first,
+		})
+	}
+
+	// sort segments
+	sort.Slice(j.segments, func(a, b int) bool {
+		return j.segments[a].first < j.segments[b].first
+	})
+
+	// scan segments
+	for i, segment := range j.segments {
+		last := i == len(j.segments)-1
+		err = j.scan(segment, last)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// open last segment
+	if len(j.segments) > 0 {
+		segment := j.segments[len(j.segments)-1]
+		j.file, err = os.OpenFile(segment.path, os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return j, nil
+}
+
+func (j *Journal) scan(segment *journalSegment, last bool) error {
+	// open file
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return err
+	}
+
+	// get size
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// read records
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		seq, t, _, n, err := readJournalRecord(reader, info.Size()-offset)
+		if err == io.EOF {
+			break
+		} else if err == ErrCorruptJournal && last {
+			// discard incomplete record at the end of the journal
+			break
+		} else if err != nil {
+			_ = file.Close()
+			return err
+		}
+
+		// set start
+		if offset == 0 {
+			segment.start = t
+		}
+
+		// set sequence
+		j.seq = seq
+		offset += n
+	}
+
+	// close file
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	// truncate incomplete record
+	if offset < info.Size() {
+		err = os.Truncate(segment.path, offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	// set size
+	segment.size = offset
+
+	// use modification time as start of empty segments
+	if offset == 0 {
+		segment.start = info.ModTime()
+	}
+
+	return nil
+}
+
+// Append will append the message to the journal and return its sequence.
+func (j *Journal) Append(msg *packet.Message) (uint64, error) {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// check if closed
+	if j.closed {
+		return 0, ErrJournalClosed
+	}
+
+	// encode record
+	now := time.Now()
+	record, err := encodeJournalRecord(j.seq+1, now, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	// start new segment if missing or full
+	if j.file == nil || j.segments[len(j.segments)-1].size >= j.segmentSize() {
+		err = j.rotate(j.seq+1, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// write record
+	_, err = j.file.Write(record)
+	if err != nil {
+		return 0, err
+	}
+
+	// update state
+	j.seq++
+	j.segments[len(j.segments)-1].size += int64(len(record))
+
+	return j.seq, nil
+}
+
+// Replay will call the callback with all journaled messages that match the
+// filter and have been appended in the specified time range. A zero until time
+// does not limit the range. Replaying stops at the first error returned by the
+// callback.
+func (j *Journal) Replay(filter string, since, until time.Time, fn func(JournalEntry) error) error {
+	// open cursor
+	cursor, err := j.cursor(filter, since, until)
+	if err != nil {
+		return err
+	}
+
+	// ensure cursor is closed
+	defer cursor.close()
+
+	// read entries
+	for {
+		entry, err := cursor.next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// yield entry
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cursor returns a cursor that reads the journaled messages that match the
+// filter and have been appended in the specified time range.
+func (j *Journal) cursor(filter string, since, until time.Time) (*journalCursor, error) {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// check if closed
+	if j.closed {
+		return nil, ErrJournalClosed
+	}
+
+	// copy segments, the size limits reading to the records written so far
+	segments := make([]journalSegment, 0, len(j.segments))
+	for i, segment := range j.segments {
+		// skip segments that end before the range
+		if i < len(j.segments)-1 && j.segments[i+1].start.Before(since) {
+			continue
+		}
+
+		segments = append(segments, *segment)
+	}
+
+	return &journalCursor{
+		filter:   filter,
+		since:    since,
+		until:    until,
+		segments: segments,
+	}, nil
+}
+
+// Sync will sync the current segment to disk.
+func (j *Journal) Sync() error {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// check file
+	if j.file == nil {
+		return nil
+	}
+
+	return j.file.Sync()
+}
+
+// Trim will remove segments according to the retention policy. It is called
+// automatically when a new segment is started.
+func (j *Journal) Trim() error {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.trim(time.Now())
+}
+
+// Close will sync and close the journal.
+func (j *Journal) Close() error {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// check if closed
+	if j.closed {
+		return nil
+	}
+
+	// set flag
+	j.closed = true
+
+	// check file
+	if j.file == nil {
+		return nil
+	}
+
+	// sync file
+	err := j.file.Sync()
+	if err != nil {
+		_ = j.file.Close()
+		return err
+	}
+
+	return j.file.Close()
+}
+
+func (j *Journal) segmentSize() int64 {
+	if j.SegmentSize <= 0 {
+		return 64 << 20
+	}
+
+	return j.SegmentSize
+}
+
+func (j *Journal) rotate(first uint64, now time.Time) error {
+	// close current file
+	if j.file != nil {
+		err := j.file.Close()
+		if err != nil {
+			return err
+		}
+
+		j.file = nil
+	}
+
+	// create file
+	path := filepath.Join(j.dir, fmt.Sprintf("%020d%s", first, journalExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// add segment
+	j.file = file
+	j.segments = append(j.segments, &journalSegment{
+		path:  path,
+		first: first,
+		start: now,
+	})
+
+	return j.trim(now)
+}
+
+func (j *Journal) trim(now time.Time) error {
+	// get total size
+	var total int64
+	for _, segment := range j.segments {
+		total += segment.size
+	}
+
+	// remove old segments, the last segment is never removed
+	for len(j.segments) > 1 {
+		// get oldest segment and its end
+		segment := j.segments[0]
+		end := j.segments[1].start
+
+		// check limits
+		tooOld := j.MaxAge > 0 && now.Sub(end) > j.MaxAge
+		tooLarge := j.MaxSize > 0 && total > j.MaxSize
+		if !tooOld && !tooLarge {
+			break
+		}
+
+		// remove segment
+		err := os.Remove(segment.path)
+		if err != nil {
+			return err
+		}
+
+		total -= segment.size
+		j.segments = j.segments[1:]
+	}
+
+	return nil
+}
+
+// A journalCursor reads the journaled messages of a time range one by one.
+// Only the currently read segment is kept open.
+type journalCursor struct {
+	filter   string
+	since    time.Time
+	until    time.Time
+	segments []journalSegment
+	file     *os.File
+	reader   *bufio.Reader
+	offset   int64
+}
+
+// next returns the next matching entry or io.EOF if all entries have been
+// read.
+func (c *journalCursor) next() (JournalEntry, error) {
+	for {
+		// check segments
+		if len(c.segments) == 0 {
+			return JournalEntry{}, io.EOF
+		}
+
+		// get segment
+		segment := c.segments[0]
+
+		// open segment if not yet opened
+		if c.file == nil {
+			// stop at segments that begin after the range
+			if !c.until.IsZero() && segment.start.After(c.until) {
+				c.segments = nil
+				return JournalEntry{}, io.EOF
+			}
+
+			// open file
+			file, err := os.Open(segment.path)
+			if os.IsNotExist(err) {
+				// segment has been removed in the meantime
+				c.segments = c.segments[1:]
+				continue
+			} else if err != nil {
+				return JournalEntry{}, err
+			}
+
+			// read records up to the known size
+			c.file = file
+			c.reader = bufio.NewReader(io.LimitReader(file, segment.size))
+			c.offset = 0
+		}
+
+		// read record
+		var seq uint64
+		var t time.Time
+		var msg *packet.Message
+		err := io.EOF
+		if c.offset < segment.size {
+			var n int64
+			seq, t, msg, n, err = readJournalRecord(c.reader, segment.size-c.offset)
+			c.offset += n
+		}
+
+		// continue with next segment if done
+		if err == io.EOF {
+			c.release()
+			c.segments = c.segments[1:]
+			continue
+		} else if err != nil {
+			return JournalEntry{}, err
+		}
+
+		// check range
+		if t.Before(c.since) {
+			continue
+		} else if !c.until.IsZero() && t.After(c.until) {
+			c.close()
+			return JournalEntry{}, io.EOF
+		}
+
+		// check filter
+		if !topic.Covers(c.filter, msg.Topic) {
+			continue
+		}
+
+		return JournalEntry{
+			Seq:     seq,
+			Time:    t,
+			Message: msg,
+		}, nil
+	}
+}
+
+// close will close the cursor.
+func (c *journalCursor) close() {
+	c.release()
+	c.segments = nil
+}
+
+func (c *journalCursor) release() {
+	// close file
+	if c.file != nil {
+		_ = c.file.Close()
+	}
+
+	c.file = nil
+	c.reader = nil
+}
+
+func encodeJournalRecord(seq uint64, t time.Time, msg *packet.Message) ([]byte, error) {
+	// prepare publish
+	publish := packet.NewPublish()
+	publish.Message = *msg
+	if msg.QOS > 0 {
+		publish.ID = 1
+	}
+
+	// prepare buffer
+	buf := make([]byte, journalHeaderLen+16, journalHeaderLen+16+publish.Len())
+	binary.BigEndian.PutUint64(buf[journalHeaderLen:], seq)
+	binary.BigEndian.PutUint64(buf[journalHeaderLen+8:], uint64(t.UnixNano()))
+
+	// encode publish
+	buf, err := publish.EncodeTo(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// write header
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-journalHeaderLen))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(buf[journalHeaderLen:]))
+
+	return buf, nil
+}
+
+func readJournalRecord(reader io.Reader, remaining int64) (uint64, time.Time, *packet.Message, int64, error) {
+	// read header
+	var header [journalHeaderLen]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err == io.EOF {
+		return 0, time.Time{}, nil, 0, io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return 0, time.Time{}, nil, 0, ErrCorruptJournal
+	} else if err != nil {
+		return 0, time.Time{}, nil, 0, err
+	}
+
+	// check length
+	length := int64(binary.BigEndian.Uint32(header[:]))
+	if length < 16 || journalHeaderLen+length > remaining {
+		return 0, time.Time{}, nil, 0, ErrCorruptJournal
+	}
+
+	// read record
+	record := make([]byte, length)
+	_, err = io.ReadFull(reader, record)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, time.Time{}, nil, 0, ErrCorruptJournal
+	} else if err != nil {
+		return 0, time.Time{}, nil, 0, err
+	}
+
+	// verify checksum
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, time.Time{}, nil, 0, ErrCorruptJournal
+	}
+
+	// decode sequence and time
+	seq := binary.BigEndian.Uint64(record)
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(record[8:])))
+
+	// decode publish
+	publish := packet.NewPublish()
+	_, err = publish.Decode(record[16:])
+	if err != nil {
+		return 0, time.Time{}, nil, 0, ErrCorruptJournal
+	}
+
+	return seq, t, &publish.Message, journalHeaderLen + length, nil
+}
+
+// A JournalBackend wraps another backend and appends all successfully
+// published messages to a Journal. Journaled messages can be replayed into
+// the sessions of clients if the wrapped backend implements the Enqueuer
+// interface.
+//
+// Clients may subscribe to filters in the form "$replay/{duration}/{filter}",
+// e.g. "$replay/10m/sensors/#", to receive the journaled messages of the
+// specified duration before receiving live messages. The replayed messages
+// are read from the journal by Dequeue and delivered ahead of the messages of
+// the wrapped backend. They are not added to the session and are dropped if
+// the client disconnects before they have been delivered.
+type JournalBackend struct {
+	Backend
+
+	// The journal the messages are appended to.
+	Journal *Journal
+
+	// The maximum duration of a replay subscription. Longer durations are
+	// reduced to the maximum.
+	//
+	// Will default to 24 hours.
+	MaxReplayDuration time.Duration
+
+	// The maximum number of messages replayed for a replay subscription.
+	// Replaying stops after the oldest messages up to the maximum have been
+	// delivered.
+	//
+	// Will default to 10000.
+	MaxReplayMessages int
+
+	replays map[*Client]*journalReplay
+	mutex   sync.Mutex
+}
+
+// A journalReplay holds the journal streams of the replay subscriptions of a
+// client and the outstanding dequeue of the wrapped backend.
+type journalReplay struct {
+	streams []*journalStream
+	wake    chan struct{}
+	result  chan journalDequeued
+	waiting bool
+	mutex   sync.Mutex
+}
+
+// A journalStream reads the replayed messages of a replay subscription.
+type journalStream struct {
+	filter    string
+	qos       packet.QOS
+	cursor    *journalCursor
+	remaining int
+}
+
+type journalDequeued struct {
+	msg *packet.Message
+	ack Ack
+	err error
+}
+
+// An Enqueuer is a backend that can add messages to the queue of a session.
+type Enqueuer interface {
+	// Enqueue should add the message to the queue of the session with the
+	// specified client id.
+	Enqueue(id string, msg *packet.Message) error
+
+	// EnqueueClient should add the message to the queue of the session of the
+	// specified connected client. It is called from the client itself and
+	// should return ErrQueueFull instead of waiting for room.
+	EnqueueClient(client *Client, msg *packet.Message) error
+}
+
+// NewJournalBackend returns a new JournalBackend that wraps the specified
+// backend and appends messages to the specified journal.
+func NewJournalBackend(backend Backend, journal *Journal) *JournalBackend {
+	return &JournalBackend{
+		Backend: backend,
+		Journal: journal,
+	}
+}
+
+// Publish will publish the message using the wrapped backend and append it to
+// the journal.
+func (j *JournalBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// the wrapped backend may modify the message
+	journaled := *msg
+
+	// publish message
+	err := j.Backend.Publish(client, msg, ack)
+	if err != nil {
+		return err
+	}
+
+	// append message
+	_, err = j.Journal.Append(&journaled)
+
+	return err
+}
+
+// Subscribe will subscribe the client using the wrapped backend and replay the
+// journaled messages of replay subscriptions.
+func (j *JournalBackend) Subscribe(client *Client, subs []packet.Subscription, ack Ack) error {
+	// rewrite replay subscriptions
+	var replays []packet.Subscription
+	var durations []time.Duration
+	list := make([]packet.Subscription, len(subs))
+	for i, sub := range subs {
+		list[i] = sub
+		if duration, filter, ok := parseReplay(sub.Topic); ok {
+			list[i].Topic = filter
+			replays = append(replays, list[i])
+			durations = append(durations, duration)
+		}
+	}
+
+	// subscribe client
+	err := j.Backend.Subscribe(client, list, ack)
+	if err != nil || len(replays) == 0 {
+		return err
+	}
+
+	// open streams for messages that have been published before the
+	// subscription, messages published in the meantime may be delivered twice
+	now := time.Now()
+	streams := make([]*journalStream, 0, len(replays))
+	for i, sub := range replays {
+		// limit duration
+		duration := durations[i]
+		if max := j.maxReplayDuration(); duration > max {
+			duration = max
+		}
+
+		// open cursor
+		cursor, err := j.Journal.cursor(sub.Topic, now.Add(-duration), now)
+		if err != nil {
+			for _, stream := range streams {
+				stream.cursor.close()
+			}
+
+			return err
+		}
+
+		streams = append(streams, &journalStream{
+			filter:    sub.Topic,
+			qos:       sub.QOS,
+			cursor:    cursor,
+			remaining: j.maxReplayMessages(),
+		})
+	}
+
+	// get replay
+	replay := j.replay(client)
+
+	// add streams
+	replay.mutex.Lock()
+	replay.streams = append(replay.streams, streams...)
+	replay.mutex.Unlock()
+
+	// wake up dequeue
+	select {
+	case replay.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Unsubscribe will unsubscribe the client using the wrapped backend and stop
+// replaying the journaled messages of the topics.
+func (j *JournalBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	// rewrite replay subscriptions
+	list := make([]string, len(topics))
+	for i, t := range topics {
+		list[i] = t
+		if _, filter, ok := parseReplay(t); ok {
+			list[i] = filter
+		}
+	}
+
+	// get replay
+	j.mutex.Lock()
+	replay, ok := j.replays[client]
+	j.mutex.Unlock()
+
+	// close streams
+	if ok {
+		replay.mutex.Lock()
+		var streams []*journalStream
+		for _, stream := range replay.streams {
+			keep := true
+			for _, filter := range list {
+				if stream.filter == filter {
+					keep = false
+					break
+				}
+			}
+
+			if keep {
+				streams = append(streams, stream)
+			} else {
+				stream.cursor.close()
+			}
+		}
+
+		replay.streams = streams
+		replay.mutex.Unlock()
+	}
+
+	return j.Backend.Unsubscribe(client, list, ack)
+}
+
+// Dequeue will return the replayed messages of the client before returning
+// messages from the wrapped backend.
+func (j *JournalBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
+	// get replay
+	replay := j.replay(client)
+
+	// return next replayed message
+	msg, err := replay.next()
+	if msg != nil || err != nil {
+		return msg, nil, err
+	}
+
+	// dequeue from the wrapped backend in the background if not already
+	// waiting for a previous dequeue
+	replay.mutex.Lock()
+	if !replay.waiting {
+		replay.waiting = true
+		go func() {
+			msg, ack, err := j.Backend.Dequeue(client)
+			replay.result <- journalDequeued{msg: msg, ack: ack, err: err}
+		}()
+	}
+	replay.mutex.Unlock()
+
+	for {
+		// wait for a message or new replay streams
+		select {
+		case res := <-replay.result:
+			replay.mutex.Lock()
+			replay.waiting = false
+			replay.mutex.Unlock()
+			return res.msg, res.ack, res.err
+		case <-replay.wake:
+			msg, err := replay.next()
+			if msg != nil || err != nil {
+				return msg, nil, err
+			}
+		}
+	}
+}
+
+// Terminate will stop replaying journaled messages and terminate the client
+// using the wrapped backend.
+func (j *JournalBackend) Terminate(client *Client) error {
+	// remove replay
+	j.mutex.Lock()
+	replay, ok := j.replays[client]
+	delete(j.replays, client)
+	j.mutex.Unlock()
+
+	// close streams
+	if ok {
+		replay.mutex.Lock()
+		for _, stream := range replay.streams {
+			stream.cursor.close()
+		}
+		replay.streams = nil
+		replay.mutex.Unlock()
+	}
+
+	return j.Backend.Terminate(client)
+}
+
+// replay returns the replay of the client.
+func (j *JournalBackend) replay(client *Client) *journalReplay {
+	// acquire mutex
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// get existing replay
+	replay, ok := j.replays[client]
+	if ok {
+		return replay
+	}
+
+	// create map
+	if j.replays == nil {
+		j.replays = make(map[*Client]*journalReplay)
+	}
+
+	// create replay
+	replay = &journalReplay{
+		wake:   make(chan struct{}, 1),
+		result: make(chan journalDequeued, 1),
+	}
+	j.replays[client] = replay
+
+	return replay
+}
+
+func (j *JournalBackend) maxReplayDuration() time.Duration {
+	if j.MaxReplayDuration <= 0 {
+		return 24 * time.Hour
+	}
+
+	return j.MaxReplayDuration
+}
+
+func (j *JournalBackend) maxReplayMessages() int {
+	if j.MaxReplayMessages <= 0 {
+		return 10000
+	}
+
+	return j.MaxReplayMessages
+}
+
+// next returns the next replayed message or nil if all streams have been read.
+func (r *journalReplay) next() (*packet.Message, error) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for len(r.streams) > 0 {
+		// get stream
+		stream := r.streams[0]
+
+		// read entry if messages remain
+		err := io.EOF
+		var entry JournalEntry
+		if stream.remaining > 0 {
+			entry, err = stream.cursor.next()
+		}
+
+		// remove stream if done
+		if err == io.EOF {
+			stream.cursor.close()
+			r.streams = r.streams[1:]
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		stream.remaining--
+
+		// prepare message
+		msg := entry.Message
+		msg.Retain = false
+		if msg.QOS > stream.qos {
+			msg.QOS = stream.qos
+		}
+
+		return msg, nil
+	}
+
+	return nil, nil
+}
+
+// Replay will add the journaled messages that match the filter and have been
+// published since the specified time to the session with the specified client
+// id. It returns the number of replayed messages.
+func (j *JournalBackend) Replay(id, filter string, since time.Time) (int, error) {
+	// get enqueuer
+	enqueuer, ok := j.Backend.(Enqueuer)
+	if !ok {
+		return 0, ErrReplayUnsupported
+	}
+
+	// replay messages
+	var n int
+	err := j.Journal.Replay(filter, since, time.Time{}, func(entry JournalEntry) error {
+		// clear retain flag
+		entry.Message.Retain = false
+
+		// enqueue message
+		err := enqueuer.Enqueue(id, entry.Message)
+		if err != nil {
+			return err
+		}
+
+		n++
+
+		return nil
+	})
+
+	return n, err
+}
+
+// Close implements the Closer interface. The journal is closed after the
+// wrapped backend, even if the timeout has been reached.
+func (j *JournalBackend) Close(timeout time.Duration) bool {
+	// close wrapped backend
+	ok := closeBackend(j.Backend, timeout)
+
+	// close journal
+	_ = j.Journal.Close()
+
+	return ok
+}
+
+func parseReplay(filter string) (time.Duration, string, bool) {
+	// check prefix
+	if !strings.HasPrefix(filter, "$replay/") {
+		return 0, "", false
+	}
+
+	// split duration and filter
+	segments := strings.SplitN(strings.TrimPrefix(filter, "$replay/"), "/", 2)
+	if len(segments) != 2 || segments[1] == "" {
+		return 0, "", false
+	}
+
+	// parse duration
+	duration, err := time.ParseDuration(segments[0])
+	if err != nil || duration <= 0 {
+		return 0, "", false
+	}
+
+	return duration, segments[1], true
+}
@@ -0,0 +1,375 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempJournal(t *testing.T) (*Journal, string) {
+	dir, err := ioutil.TempDir("", "journal")
+	require.NoError(t, err)
+
+	journal, err := OpenJournal(dir)
+	require.NoError(t, err)
+
+	return journal, dir
+}
+
+func replayTopics(t *testing.T, journal *Journal, filter string, since time.Time) []string {
+	var topics []string
+	err := journal.Replay(filter, since, time.Time{}, func(entry JournalEntry) error {
+		topics = append(topics, entry.Message.Topic)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return topics
+}
+
+func TestJournal(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	seq, err := journal.Append(&packet.Message{Topic: "a/1", Payload: []byte("1")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), seq)
+
+	seq, err = journal.Append(&packet.Message{Topic: "b/1", Payload: []byte("2"), QOS: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+
+	since := time.Now()
+
+	seq, err = journal.Append(&packet.Message{Topic: "a/2", Payload: []byte("3")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+
+	assert.Equal(t, []string{"a/1", "b/1", "a/2"}, replayTopics(t, journal, "#", time.Time{}))
+	assert.Equal(t, []string{"a/1", "a/2"}, replayTopics(t, journal, "a/+", time.Time{}))
+	assert.Equal(t, []string{"a/2"}, replayTopics(t, journal, "#", since))
+
+	assert.NoError(t, journal.Close())
+
+	_, err = journal.Append(&packet.Message{Topic: "a/3"})
+	assert.Equal(t, ErrJournalClosed, err)
+
+	// append torn record
+	files, err := filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	file, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 42, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	journal, err = OpenJournal(dir)
+	assert.NoError(t, err)
+
+	seq, err = journal.Append(&packet.Message{Topic: "a/3"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), seq)
+
+	assert.Equal(t, []string{"a/1", "a/2", "a/3"}, replayTopics(t, journal, "a/#", time.Time{}))
+	assert.NoError(t, journal.Close())
+}
+
+func TestJournalRetention(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	journal.SegmentSize = 1
+	journal.MaxSize = 100
+
+	for i := 0; i < 10; i++ {
+		_, err := journal.Append(&packet.Message{Topic: "foo", Payload: make([]byte, 20)})
+		assert.NoError(t, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Len(t, replayTopics(t, journal, "#", time.Time{}), 2)
+
+	journal.MaxSize = 0
+	journal.MaxAge = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = journal.Append(&packet.Message{Topic: "foo"})
+	assert.NoError(t, err)
+
+	files, err = filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	assert.NoError(t, journal.Close())
+}
+
+func TestJournalBackend(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	backend := NewJournalBackend(NewMemoryBackend(), journal)
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.ClientID = "consumer"
+	connect.CleanSession = false
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "foo", Payload: []byte("1")}}).
+		Send(&packet.Publish{ID: 1, Message: packet.Message{Topic: "bar", Payload: []byte("2"), QOS: 1}}).
+		Receive(&packet.Puback{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	n, err := backend.Replay("consumer", "#", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = backend.Replay("unknown", "#", time.Time{})
+	assert.Equal(t, ErrMissingSession, err)
+
+	conn, err = transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connack := packet.NewConnack()
+	connack.SessionPresent = true
+
+	err = flow.New().
+		Send(connect).
+		Receive(connack).
+		Receive(&packet.Publish{ID: 1, Message: packet.Message{Topic: "bar", Payload: []byte("2"), QOS: 1}}).
+		Send(&packet.Puback{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestJournalBackendReplaySubscription(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	_, err := journal.Append(&packet.Message{Topic: "sensors/1", Payload: []byte("1")})
+	assert.NoError(t, err)
+
+	_, err = journal.Append(&packet.Message{Topic: "other", Payload: []byte("2")})
+	assert.NoError(t, err)
+
+	port, quit, done := Run(NewEngine(NewJournalBackend(NewMemoryBackend(), journal)), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "$replay/1h/sensors/#", QOS: 0},
+		}}).
+		Test(conn)
+	assert.NoError(t, err)
+
+	// the suback and the replayed message may arrive in any order
+	var types []packet.Type
+	for i := 0; i < 2; i++ {
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		types = append(types, pkt.Type())
+
+		if publish, ok := pkt.(*packet.Publish); ok {
+			assert.Equal(t, "sensors/1", publish.Message.Topic)
+		}
+	}
+	assert.Contains(t, types, packet.SUBACK)
+	assert.Contains(t, types, packet.PUBLISH)
+
+	err = flow.New().
+		Send(&packet.Publish{Message: packet.Message{Topic: "sensors/2", Payload: []byte("3")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "sensors/2", Payload: []byte("3")}}).
+		Send(&packet.Unsubscribe{ID: 2, Topics: []string{"$replay/1h/sensors/#"}}).
+		Receive(&packet.Unsuback{ID: 2}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "sensors/3", Payload: []byte("4")}}).
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestJournalBackendReplaySubscriptionBacklog(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	// more messages than fit into the queue and inflight window
+	for i := 0; i < 50; i++ {
+		_, err := journal.Append(&packet.Message{Topic: "sensors/" + strconv.Itoa(i), Payload: []byte("1"), QOS: 1})
+		assert.NoError(t, err)
+	}
+
+	backend := NewMemoryBackend()
+	backend.SessionQueueSize = 10
+	backend.ClientInflightMessages = 5
+
+	port, quit, done := Run(NewEngine(NewJournalBackend(backend, journal)), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "$replay/1h/sensors/#", QOS: 1},
+		}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "sensors/live", Payload: []byte("2")}}).
+		Test(conn)
+	assert.NoError(t, err)
+
+	// the journaled messages must be delivered before the live message
+	var topics []string
+	for len(topics) < 51 {
+		pkt, err := conn.Receive()
+		require.NoError(t, err)
+
+		if publish, ok := pkt.(*packet.Publish); ok {
+			topics = append(topics, publish.Message.Topic)
+
+			if publish.Message.QOS > 0 {
+				err = conn.Send(&packet.Puback{ID: publish.ID}, false)
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, "sensors/"+strconv.Itoa(i), topics[i])
+	}
+	assert.Equal(t, "sensors/live", topics[50])
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestJournalBackendReplayLimits(t *testing.T) {
+	journal, dir := tempJournal(t)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 20; i++ {
+		_, err := journal.Append(&packet.Message{Topic: "sensors/" + strconv.Itoa(i), Payload: []byte("1")})
+		assert.NoError(t, err)
+	}
+
+	backend := NewJournalBackend(NewMemoryBackend(), journal)
+	backend.MaxReplayMessages = 5
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "$replay/1h/sensors/#", QOS: 0},
+		}}).
+		Send(packet.NewPingreq()).
+		Test(conn)
+	assert.NoError(t, err)
+
+	// only the oldest messages up to the limit are replayed, the suback and
+	// pingresp may arrive in between
+	var topics []string
+	for i := 0; i < 7; i++ {
+		pkt, err := conn.Receive()
+		require.NoError(t, err)
+
+		if publish, ok := pkt.(*packet.Publish); ok {
+			topics = append(topics, publish.Message.Topic)
+		}
+	}
+	assert.Equal(t, []string{"sensors/0", "sensors/1", "sensors/2", "sensors/3", "sensors/4"}, topics)
+
+	err = flow.New().
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	// durations are reduced to the limit
+	backend.MaxReplayDuration = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+
+	conn, err = transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "$replay/1h/sensors/#", QOS: 0},
+		}}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+		Send(packet.NewPingreq()).
+		Receive(packet.NewPingresp()).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestParseReplay(t *testing.T) {
+	duration, filter, ok := parseReplay("$replay/10m/sensors/#")
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Minute, duration)
+	assert.Equal(t, "sensors/#", filter)
+
+	_, _, ok = parseReplay("$replay/foo/bar")
+	assert.False(t, ok)
+
+	_, _, ok = parseReplay("$replay/10m")
+	assert.False(t, ok)
+
+	_, _, ok = parseReplay("sensors/#")
+	assert.False(t, ok)
+}
@@ -0,0 +1,218 @@
+package broker
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Pool processes the packets received by many clients using a fixed number
+// of workers. Every client buffers its received packets in a bounded queue
+// and stops reading from its connection if the queue is full. The packets of
+// a single client are always processed in order by one worker at a time.
+//
+// The processing of a packet may block a worker, e.g. if the backend waits for
+// room in the queue of a congested subscriber. As the subscriber may only free
+// up room once a worker processes its acknowledgements, the pool starts an
+// additional worker if no worker made progress within the stall timeout while
+// clients are waiting to be processed. Additional workers are stopped once
+// they become idle.
+type Pool struct {
+	// The number of workers.
+	//
+	// Will default to the number of CPUs.
+	Workers int
+
+	// The number of packets a client may buffer. This is also the maximum
+	// number of packets a worker processes for a client before processing
+	// the next client.
+	//
+	// Will default to 10.
+	QueueSize int
+
+	// The time after which an additional worker is started if no worker made
+	// progress while clients are waiting to be processed.
+	//
+	// Will default to 100ms.
+	StallTimeout time.Duration
+
+	clients  []*Client
+	closed   bool
+	running  int
+	idle     int
+	progress uint64
+	last     uint64
+	timer    *time.Timer
+	cond     *sync.Cond
+	mutex    sync.Mutex
+	workers  sync.WaitGroup
+	once     sync.Once
+}
+
+// NewPool returns a new Pool with the specified number of workers.
+func NewPool(workers int) *Pool {
+	return &Pool{
+		Workers:      workers,
+		QueueSize:    10,
+		StallTimeout: 100 * time.Millisecond,
+	}
+}
+
+// Close will stop all workers once all scheduled clients have been processed.
+// Clients that use the pool should be closed beforehand.
+func (p *Pool) Close() {
+	// make sure workers are started
+	p.once.Do(p.start)
+
+	// set flag
+	p.mutex.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mutex.Unlock()
+
+	// wait for workers
+	p.workers.Wait()
+}
+
+func (p *Pool) inbox() chan packet.Generic {
+	// make sure workers are started
+	p.once.Do(p.start)
+
+	return make(chan packet.Generic, p.QueueSize)
+}
+
+func (p *Pool) start() {
+	// set default workers
+	if p.Workers <= 0 {
+		p.Workers = runtime.NumCPU()
+	}
+
+	// set default queue size
+	if p.QueueSize <= 0 {
+		p.QueueSize = 10
+	}
+
+	// set default stall timeout
+	if p.StallTimeout <= 0 {
+		p.StallTimeout = 100 * time.Millisecond
+	}
+
+	// prepare condition
+	p.cond = sync.NewCond(&p.mutex)
+
+	// run workers
+	p.mutex.Lock()
+	for i := 0; i < p.Workers; i++ {
+		p.spawn()
+	}
+	p.mutex.Unlock()
+}
+
+func (p *Pool) schedule(client *Client) {
+	// make sure workers are started
+	p.once.Do(p.start)
+
+	// acquire mutex
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// add client, the queue is bounded by the number of clients as every
+	// client is scheduled at most once
+	p.clients = append(p.clients, client)
+	p.cond.Signal()
+
+	// watch for stalled workers if none is idle
+	if p.idle == 0 {
+		p.watch()
+	}
+}
+
+// watch arms the stall timer. The mutex must be held.
+func (p *Pool) watch() {
+	if p.timer == nil && !p.closed {
+		p.last = p.progress
+		p.timer = time.AfterFunc(p.StallTimeout, p.check)
+	}
+}
+
+func (p *Pool) check() {
+	// acquire mutex
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// clear timer
+	p.timer = nil
+
+	// check if clients are still waiting
+	if len(p.clients) == 0 || p.idle > 0 || p.closed {
+		return
+	}
+
+	// start an additional worker if no worker made progress
+	if p.progress == p.last {
+		p.spawn()
+	}
+
+	// continue watching
+	p.watch()
+}
+
+// spawn starts a worker. The mutex must be held.
+func (p *Pool) spawn() {
+	p.running++
+	p.workers.Add(1)
+	go p.worker()
+}
+
+func (p *Pool) worker() {
+	defer p.workers.Done()
+
+	for {
+		// acquire mutex
+		p.mutex.Lock()
+
+		// wait for clients
+		for len(p.clients) == 0 && !p.closed {
+			// stop additional workers once idle
+			if p.running > p.Workers {
+				p.running--
+				p.mutex.Unlock()
+				return
+			}
+
+			p.idle++
+			p.cond.Wait()
+			p.idle--
+		}
+
+		// return if closed and idle
+		if len(p.clients) == 0 {
+			p.running--
+			p.mutex.Unlock()
+			return
+		}
+
+		// get next client
+		client := p.clients[0]
+		p.clients[0] = nil
+		p.clients = p.clients[1:]
+
+		// release mutex
+		p.mutex.Unlock()
+
+		// process packets
+		again := client.work(p.QueueSize)
+
+		// track progress
+		p.mutex.Lock()
+		p.progress++
+		p.mutex.Unlock()
+
+		// schedule client again if required
+		if again {
+			p.schedule(client)
+		}
+	}
+}
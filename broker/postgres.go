@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// PostgresSchema is the schema of the table used by the PostgresArchiver.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS messages (
+	id BIGSERIAL PRIMARY KEY,
+	topic TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	qos SMALLINT NOT NULL,
+	retain BOOLEAN NOT NULL,
+	client_id TEXT NOT NULL,
+	time TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_topic_time ON messages (topic, time);`
+
+// postgresMaxRows is the number of messages that can be inserted with a single
+// statement without exceeding the limit of 65535 bind parameters.
+const postgresMaxRows = 65535 / 6
+
+// A PostgresArchiver stores messages in a PostgreSQL table that uses the
+// PostgresSchema. The database must be opened with a PostgreSQL driver like
+// github.com/lib/pq or github.com/jackc/pgx/v4/stdlib.
+type PostgresArchiver struct {
+	// The database handle.
+	DB *sql.DB
+
+	// The table name, which may be qualified with a schema. The name is quoted
+	// and therefore case sensitive.
+	//
+	// Will default to "messages".
+	Table string
+}
+
+// NewPostgresArchiver returns a new PostgresArchiver that uses the specified
+// database.
+func NewPostgresArchiver(db *sql.DB) *PostgresArchiver {
+	return &PostgresArchiver{
+		DB:    db,
+		Table: "messages",
+	}
+}
+
+// Archive will insert the messages using a single statement. Larger batches
+// are split into multiple statements as PostgreSQL limits the number of bind
+// parameters. Messages of earlier statements stay inserted if a later one
+// fails.
+func (a *PostgresArchiver) Archive(msgs []ArchivedMessage) error {
+	// insert chunks
+	for len(msgs) > 0 {
+		n := len(msgs)
+		if n > postgresMaxRows {
+			n = postgresMaxRows
+		}
+
+		err := a.insert(msgs[:n])
+		if err != nil {
+			return err
+		}
+
+		msgs = msgs[n:]
+	}
+
+	return nil
+}
+
+func (a *PostgresArchiver) insert(msgs []ArchivedMessage) error {
+	// prepare query
+	var query strings.Builder
+	query.WriteString("INSERT INTO " + quoteIdentifier(a.Table) + " (topic, payload, qos, retain, client_id, time) VALUES ")
+
+	// add values
+	args := make([]interface{}, 0, len(msgs)*6)
+	for i, msg := range msgs {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		// add placeholders
+		query.WriteString("(")
+		for j := 1; j <= 6; j++ {
+			if j > 1 {
+				query.WriteString(", ")
+			}
+			query.WriteString("$" + strconv.Itoa(i*6+j))
+		}
+		query.WriteString(")")
+
+		// add arguments
+		payload := msg.Payload
+		if payload == nil {
+			payload = []byte{}
+		}
+		args = append(args, msg.Topic, payload, int64(msg.QOS), msg.Retain, msg.ClientID, msg.Time)
+	}
+
+	// execute query
+	_, err := a.DB.Exec(query.String(), args...)
+
+	return err
+}
+
+// quoteIdentifier will quote each part of a possibly schema qualified name.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+var recordedExecs = make(chan recordedExec, 10)
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(string) (driver.Conn, error) {
+	return recordingConn{}, nil
+}
+
+type recordingConn struct{}
+
+func (recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{query: query}, nil
+}
+
+func (recordingConn) Close() error {
+	return nil
+}
+
+func (recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type recordingStmt struct {
+	query string
+}
+
+func (recordingStmt) Close() error {
+	return nil
+}
+
+func (recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	recordedExecs <- recordedExec{query: s.query, args: args}
+	return driver.RowsAffected(len(args) / 6), nil
+}
+
+func (recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func init() {
+	sql.Register("recording", recordingDriver{})
+}
+
+func TestPostgresArchiver(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	assert.NoError(t, err)
+
+	now := time.Now()
+
+	archiver := NewPostgresArchiver(db)
+	err = archiver.Archive([]ArchivedMessage{
+		{Topic: "foo", Payload: []byte("bar"), QOS: 1, Retain: true, ClientID: "c1", Time: now},
+		{Topic: "baz", ClientID: "c2", Time: now},
+	})
+	assert.NoError(t, err)
+
+	exec := <-recordedExecs
+	assert.Equal(t, "INSERT INTO \"messages\" (topic, payload, qos, retain, client_id, time) VALUES "+
+		"($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12)", exec.query)
+	assert.Equal(t, []driver.Value{
+		"foo", []byte("bar"), int64(1), true, "c1", now,
+		"baz", []byte{}, int64(0), false, "c2", now,
+	}, exec.args)
+}
+
+func TestPostgresArchiverLargeBatch(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	assert.NoError(t, err)
+
+	msgs := make([]ArchivedMessage, postgresMaxRows+1)
+	for i := range msgs {
+		msgs[i] = ArchivedMessage{Topic: "foo", ClientID: "c1", Time: time.Now()}
+	}
+
+	archiver := NewPostgresArchiver(db)
+	archiver.Table = `public.my"messages`
+	err = archiver.Archive(msgs)
+	assert.NoError(t, err)
+
+	exec := <-recordedExecs
+	assert.True(t, strings.HasPrefix(exec.query, `INSERT INTO "public"."my""messages" (topic`))
+	assert.Len(t, exec.args, postgresMaxRows*6)
+
+	exec = <-recordedExecs
+	assert.Equal(t, `INSERT INTO "public"."my""messages" (topic, payload, qos, retain, client_id, time) VALUES `+
+		"($1, $2, $3, $4, $5, $6)", exec.query)
+	assert.Len(t, exec.args, 6)
+}
@@ -0,0 +1,198 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProfile is returned by the Profiler if a profile does not exist.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// A Profiler writes runtime profiles of the process to a directory. Profiles
+// can be captured directly or triggered by a condition that is evaluated
+// periodically, e.g. when the number of goroutines or the queue lengths of a
+// backend exceed a threshold.
+type Profiler struct {
+	// The directory the profiles are written to.
+	Dir string
+
+	// The duration of CPU profiles.
+	//
+	// Will default to 10 seconds.
+	CPUDuration time.Duration
+
+	// The minimum interval between triggered captures.
+	//
+	// Will default to one minute.
+	MinInterval time.Duration
+
+	last  time.Time
+	cpu   sync.Mutex
+	mutex sync.Mutex
+}
+
+// NewProfiler returns a new Profiler that writes profiles to the specified
+// directory.
+func NewProfiler(dir string) *Profiler {
+	return &Profiler{
+		Dir:         dir,
+		CPUDuration: 10 * time.Second,
+		MinInterval: time.Minute,
+	}
+}
+
+// Capture will write the named profile and return the path of the file. The
+// name is either "cpu" or the name of a runtime/pprof profile like "heap",
+// "goroutine", "block" or "mutex". CPU profiles block for the configured
+// duration.
+func (p *Profiler) Capture(name string) (string, error) {
+	// prepare path
+	path := filepath.Join(p.Dir, fmt.Sprintf("%s-%d.pprof", name, time.Now().UnixNano()))
+
+	// capture cpu profile
+	if name == "cpu" {
+		return path, p.captureCPU(path)
+	}
+
+	// get profile
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		return "", ErrUnknownProfile
+	}
+
+	// create file
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	// write profile
+	err = profile.WriteTo(file, 0)
+	if err != nil {
+		_ = file.Close()
+		return "", err
+	}
+
+	return path, file.Close()
+}
+
+func (p *Profiler) captureCPU(path string) error {
+	// only one cpu profile may run at a time
+	p.cpu.Lock()
+	defer p.cpu.Unlock()
+
+	// get duration
+	duration := p.CPUDuration
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+
+	// create file
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// start profile
+	err = pprof.StartCPUProfile(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// stop profile after duration
+	time.Sleep(duration)
+	pprof.StopCPUProfile()
+
+	return file.Close()
+}
+
+// Trigger will capture the named profiles unless the last triggered capture
+// happened less than the minimum interval ago. It returns the paths of the
+// written files.
+func (p *Profiler) Trigger(names ...string) ([]string, error) {
+	// acquire mutex
+	p.mutex.Lock()
+
+	// get interval
+	interval := p.MinInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	// check interval
+	now := time.Now()
+	if !p.last.IsZero() && now.Sub(p.last) < interval {
+		p.mutex.Unlock()
+		return nil, nil
+	}
+
+	// set time
+	p.last = now
+
+	// release mutex
+	p.mutex.Unlock()
+
+	// capture profiles
+	var paths []string
+	for _, name := range names {
+		path, err := p.Capture(name)
+		if err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// Watch will evaluate the condition in the specified interval and trigger the
+// named profiles when it returns true. Errors are passed to the optional
+// callback. The returned function stops the watch.
+func (p *Profiler) Watch(interval time.Duration, condition func() bool, callback func([]string, error), names ...string) func() {
+	// prepare channels
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	// run watcher
+	go func() {
+		defer close(done)
+
+		// prepare ticker
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// check condition
+				if !condition() {
+					continue
+				}
+
+				// trigger profiles
+				paths, err := p.Trigger(names...)
+				if callback != nil && (paths != nil || err != nil) {
+					callback(paths, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	// prepare stopper
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profiler := NewProfiler(dir)
+	profiler.CPUDuration = 10 * time.Millisecond
+
+	path, err := profiler.Capture("heap")
+	assert.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.True(t, strings.HasPrefix(filepath.Base(path), "heap-"))
+
+	_, err = profiler.Capture("foo")
+	assert.Equal(t, ErrUnknownProfile, err)
+
+	paths, err := profiler.Trigger("cpu", "goroutine")
+	assert.NoError(t, err)
+	assert.Len(t, paths, 2)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.True(t, info.Size() > 0)
+	}
+
+	paths, err = profiler.Trigger("heap")
+	assert.NoError(t, err)
+	assert.Nil(t, paths)
+}
+
+func TestProfilerWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profiler := NewProfiler(dir)
+
+	triggered := make(chan []string, 1)
+	stop := profiler.Watch(time.Millisecond, func() bool {
+		return true
+	}, func(paths []string, err error) {
+		assert.NoError(t, err)
+		triggered <- paths
+	}, "goroutine")
+
+	select {
+	case paths := <-triggered:
+		assert.Len(t, paths, 1)
+	case <-time.After(10 * time.Second):
+		t.Fatal("not triggered")
+	}
+
+	stop()
+	stop()
+}
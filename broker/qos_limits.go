@@ -0,0 +1,33 @@
+package broker
+
+import (
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// A QOSLimit caps the QOS of messages and subscriptions that are covered by
+// the filter.
+type QOSLimit struct {
+	// The filter that covers the limited topics and filters.
+	Filter string
+
+	// The maximum QOS.
+	QOS packet.QOS
+}
+
+// QOSLimits is a list of limits of which the lowest applicable limit applies.
+type QOSLimits []QOSLimit
+
+// Maximum returns the maximum QOS for the specified topic or filter. Filters
+// are only limited by limits that cover the whole filter.
+func (l QOSLimits) Maximum(name string) packet.QOS {
+	// find lowest limit
+	max := packet.QOS(2)
+	for _, limit := range l {
+		if limit.QOS < max && topic.Covers(limit.Filter, name) {
+			max = limit.QOS
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,24 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQOSLimits(t *testing.T) {
+	limits := QOSLimits{
+		{Filter: "telemetry/#", QOS: 0},
+		{Filter: "events/+", QOS: 1},
+		{Filter: "events/alarm", QOS: 2},
+	}
+
+	assert.Equal(t, packet.QOS(0), limits.Maximum("telemetry/temp"))
+	assert.Equal(t, packet.QOS(0), limits.Maximum("telemetry/+"))
+	assert.Equal(t, packet.QOS(1), limits.Maximum("events/alarm"))
+	assert.Equal(t, packet.QOS(2), limits.Maximum("events/foo/bar"))
+	assert.Equal(t, packet.QOS(2), limits.Maximum("#"))
+	assert.Equal(t, packet.QOS(2), QOSLimits(nil).Maximum("foo"))
+}
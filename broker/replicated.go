@@ -0,0 +1,229 @@
+package broker
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+type replicatedSnapshot struct {
+	Retained []*packet.Message         `json:"retained,omitempty"`
+	Counts   map[string]map[string]int `json:"counts,omitempty"`
+}
+
+type replicatedCommand struct {
+	Op      string          `json:"op"`
+	Node    string          `json:"node,omitempty"`
+	Filter  string          `json:"filter,omitempty"`
+	Message *packet.Message `json:"message,omitempty"`
+}
+
+// A ReplicatedState holds the retained messages and the subscription routes of
+// all nodes of a cluster. Changes are proposed to a replicated log, e.g. a
+// cluster.Raft, and applied on every node once committed. Reads are served from
+// the local copy, which allows any node to serve retained messages and route
+// publishes after the failure of another node.
+//
+// The state implements the RetainedStore interface and can be used as the
+// retained store of a ComposedBackend. The Snapshot and Restore methods can be
+// used to compact the replicated log.
+type ReplicatedState struct {
+	propose  func(data []byte) error
+	retained *topic.Tree
+	routes   *topic.Tree
+	counts   map[string]map[string]int
+	mutex    sync.Mutex
+}
+
+// NewReplicatedState returns a new ReplicatedState that proposes changes using
+// the specified function. The Apply method must be called with the data of all
+// committed proposals.
+func NewReplicatedState(propose func(data []byte) error) *ReplicatedState {
+	return &ReplicatedState{
+		propose:  propose,
+		retained: topic.NewTree(),
+		routes:   topic.NewTree(),
+		counts:   make(map[string]map[string]int),
+	}
+}
+
+// StoreRetained will propose to retain the message.
+func (s *ReplicatedState) StoreRetained(_ *Client, msg *packet.Message) error {
+	return s.submit(replicatedCommand{Op: "retain", Message: msg})
+}
+
+// ClearRetained will propose to clear the retained message of the topic.
+func (s *ReplicatedState) ClearRetained(_ *Client, topic string) error {
+	return s.submit(replicatedCommand{Op: "clear", Filter: topic})
+}
+
+// MatchRetained will return the retained messages that match the filter.
+func (s *ReplicatedState) MatchRetained(_ *Client, filter string) ([]*packet.Message, error) {
+	// search messages
+	values := s.retained.Search(filter)
+
+	// convert values
+	msgs := make([]*packet.Message, 0, len(values))
+	for _, value := range values {
+		msgs = append(msgs, value.(*packet.Message))
+	}
+
+	return msgs, nil
+}
+
+// AddRoute will propose to route messages that match the filter to the node.
+// Routes are counted and removed once they have been removed as often as they
+// have been added.
+func (s *ReplicatedState) AddRoute(node, filter string) error {
+	return s.submit(replicatedCommand{Op: "add", Node: node, Filter: filter})
+}
+
+// RemoveRoute will propose to remove the route of the filter to the node.
+func (s *ReplicatedState) RemoveRoute(node, filter string) error {
+	return s.submit(replicatedCommand{Op: "remove", Node: node, Filter: filter})
+}
+
+// RemoveNode will propose to remove all routes to the node.
+func (s *ReplicatedState) RemoveNode(node string) error {
+	return s.submit(replicatedCommand{Op: "purge", Node: node})
+}
+
+// Route will return the sorted names of the nodes that have subscriptions that
+// match the topic.
+func (s *ReplicatedState) Route(topic string) []string {
+	// match nodes
+	values := s.routes.Match(topic)
+
+	// convert values
+	nodes := make([]string, 0, len(values))
+	for _, value := range values {
+		nodes = append(nodes, value.(string))
+	}
+
+	// sort nodes
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+// Apply will apply the data of a committed proposal.
+func (s *ReplicatedState) Apply(data []byte) {
+	// decode command
+	var cmd replicatedCommand
+	if json.Unmarshal(data, &cmd) != nil {
+		return
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// apply command
+	switch cmd.Op {
+	case "retain":
+		if cmd.Message != nil {
+			cmd.Message.Retain = true
+			s.retained.Set(cmd.Message.Topic, cmd.Message)
+		}
+	case "clear":
+		s.retained.Empty(cmd.Filter)
+	case "add":
+		// get counts
+		counts, ok := s.counts[cmd.Node]
+		if !ok {
+			counts = make(map[string]int)
+			s.counts[cmd.Node] = counts
+		}
+
+		// add route
+		counts[cmd.Filter]++
+		if counts[cmd.Filter] == 1 {
+			s.routes.Add(cmd.Filter, cmd.Node)
+		}
+	case "remove":
+		// get counts
+		counts := s.counts[cmd.Node]
+		if counts[cmd.Filter] == 0 {
+			return
+		}
+
+		// remove route
+		counts[cmd.Filter]--
+		if counts[cmd.Filter] == 0 {
+			delete(counts, cmd.Filter)
+			s.routes.Remove(cmd.Filter, cmd.Node)
+		}
+	case "purge":
+		// remove routes
+		for filter := range s.counts[cmd.Node] {
+			s.routes.Remove(filter, cmd.Node)
+		}
+		delete(s.counts, cmd.Node)
+	}
+}
+
+// Snapshot will return the encoded state of all applied proposals.
+func (s *ReplicatedState) Snapshot() []byte {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// collect retained messages
+	var snapshot replicatedSnapshot
+	for _, value := range s.retained.All() {
+		snapshot.Retained = append(snapshot.Retained, value.(*packet.Message))
+	}
+
+	// set counts
+	snapshot.Counts = s.counts
+
+	// encode snapshot
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// Restore will replace the state with the snapshot returned by Snapshot.
+func (s *ReplicatedState) Restore(data []byte) {
+	// decode snapshot
+	var snapshot replicatedSnapshot
+	if json.Unmarshal(data, &snapshot) != nil {
+		return
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// restore retained messages
+	s.retained.Reset()
+	for _, msg := range snapshot.Retained {
+		s.retained.Set(msg.Topic, msg)
+	}
+
+	// restore routes
+	s.routes.Reset()
+	s.counts = make(map[string]map[string]int)
+	for node, counts := range snapshot.Counts {
+		s.counts[node] = counts
+		for filter := range counts {
+			s.routes.Add(filter, node)
+		}
+	}
+}
+
+func (s *ReplicatedState) submit(cmd replicatedCommand) error {
+	// encode command
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return s.propose(data)
+}
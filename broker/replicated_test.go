@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicatedState(t *testing.T) {
+	var state *ReplicatedState
+	state = NewReplicatedState(func(data []byte) error {
+		state.Apply(data)
+		return nil
+	})
+
+	// retained messages
+	assert.NoError(t, state.StoreRetained(nil, &packet.Message{Topic: "foo", Payload: []byte("bar")}))
+	msgs, err := state.MatchRetained(nil, "#")
+	assert.NoError(t, err)
+	assert.Equal(t, []*packet.Message{{Topic: "foo", Payload: []byte("bar"), Retain: true}}, msgs)
+
+	assert.NoError(t, state.ClearRetained(nil, "foo"))
+	msgs, err = state.MatchRetained(nil, "#")
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	// routes
+	assert.NoError(t, state.AddRoute("a", "foo/#"))
+	assert.NoError(t, state.AddRoute("a", "foo/#"))
+	assert.NoError(t, state.AddRoute("b", "foo/+"))
+	assert.Equal(t, []string{"a", "b"}, state.Route("foo/bar"))
+
+	assert.NoError(t, state.RemoveRoute("a", "foo/#"))
+	assert.Equal(t, []string{"a", "b"}, state.Route("foo/bar"))
+
+	assert.NoError(t, state.RemoveRoute("a", "foo/#"))
+	assert.Equal(t, []string{"b"}, state.Route("foo/bar"))
+
+	assert.NoError(t, state.RemoveNode("b"))
+	assert.Empty(t, state.Route("foo/bar"))
+}
+
+func TestReplicatedStateSnapshot(t *testing.T) {
+	var state *ReplicatedState
+	state = NewReplicatedState(func(data []byte) error {
+		state.Apply(data)
+		return nil
+	})
+
+	assert.NoError(t, state.StoreRetained(nil, &packet.Message{Topic: "foo", Payload: []byte("bar")}))
+	assert.NoError(t, state.AddRoute("a", "foo/#"))
+	assert.NoError(t, state.AddRoute("a", "foo/#"))
+
+	restored := NewReplicatedState(nil)
+	restored.Restore(state.Snapshot())
+
+	msgs, err := restored.MatchRetained(nil, "#")
+	assert.NoError(t, err)
+	assert.Equal(t, []*packet.Message{{Topic: "foo", Payload: []byte("bar"), Retain: true}}, msgs)
+	assert.Equal(t, []string{"a"}, restored.Route("foo/bar"))
+
+	// routes keep their count
+	restored.propose = func(data []byte) error {
+		restored.Apply(data)
+		return nil
+	}
+
+	assert.NoError(t, restored.RemoveRoute("a", "foo/#"))
+	assert.Equal(t, []string{"a"}, restored.Route("foo/bar"))
+	assert.NoError(t, restored.RemoveRoute("a", "foo/#"))
+	assert.Empty(t, restored.Route("foo/bar"))
+}
@@ -0,0 +1,300 @@
+package broker
+
+import (
+	"container/heap"
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// RetainedPolicy defines how a RetainedLimit is enforced.
+type RetainedPolicy int
+
+const (
+	// RetainedEvict evicts the least recently used retained messages until the
+	// new message fits.
+	RetainedEvict RetainedPolicy = iota
+
+	// RetainedReject keeps the already retained messages and does not retain
+	// the new message.
+	RetainedReject
+)
+
+// A RetainedLimit caps the number and size of the retained messages whose
+// topic begins with the prefix. An empty prefix applies to all messages.
+type RetainedLimit struct {
+	// The topic prefix the limit applies to.
+	Prefix string
+
+	// The maximum number of retained messages. Zero means no limit.
+	MaxCount int
+
+	// The maximum total size of the retained messages in bytes, measured as
+	// the length of the topic and payload. Zero means no limit.
+	MaxBytes int64
+
+	// The policy applied when the limit is reached.
+	Policy RetainedPolicy
+}
+
+func (l RetainedLimit) exceeded(count int, bytes int64) bool {
+	return (l.MaxCount > 0 && count > l.MaxCount) || (l.MaxBytes > 0 && bytes > l.MaxBytes)
+}
+
+type retainedEntry struct {
+	msg     *packet.Message
+	size    int64
+	expires time.Time
+	element *list.Element
+	index   int
+}
+
+// retainedExpiries is a heap of entries ordered by their expiry.
+type retainedExpiries []*retainedEntry
+
+func (e retainedExpiries) Len() int {
+	return len(e)
+}
+
+func (e retainedExpiries) Less(i, j int) bool {
+	return e[i].expires.Before(e[j].expires)
+}
+
+func (e retainedExpiries) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+	e[i].index = i
+	e[j].index = j
+}
+
+func (e *retainedExpiries) Push(x interface{}) {
+	entry := x.(*retainedEntry)
+	entry.index = len(*e)
+	*e = append(*e, entry)
+}
+
+func (e *retainedExpiries) Pop() interface{} {
+	old := *e
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*e = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+type retainedUsage struct {
+	count int
+	bytes int64
+}
+
+// retainedStore manages retained messages and enforces retained limits.
+type retainedStore struct {
+	tree     *topic.Tree
+	entries  map[string]*retainedEntry
+	lru      *list.List
+	expiries retainedExpiries
+	limits   []RetainedLimit
+	usage    []retainedUsage
+	mutex    sync.Mutex
+}
+
+func newRetainedStore() *retainedStore {
+	return &retainedStore{
+		tree:    topic.NewTree(),
+		entries: make(map[string]*retainedEntry),
+		lru:     list.New(),
+	}
+}
+
+// set will retain the message if the limits permit it. A positive TTL causes
+// the message to expire after the duration. It returns the evicted messages and
+// whether the message has been retained.
+func (s *retainedStore) set(msg *packet.Message, limits []RetainedLimit, ttl time.Duration) ([]*packet.Message, bool) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove expired messages
+	now := time.Now()
+	s.expire(now)
+
+	// set limits, the usage is tracked per limit and therefore the limits
+	// must not change once messages have been retained
+	s.limits = limits
+	if len(s.usage) != len(limits) {
+		s.usage = make([]retainedUsage, len(limits))
+	}
+
+	// get size and existing entry
+	size := int64(len(msg.Topic) + len(msg.Payload))
+	old := s.entries[msg.Topic]
+
+	// check limits
+	var evicting []int
+	for i, limit := range limits {
+		// check prefix
+		if !strings.HasPrefix(msg.Topic, limit.Prefix) {
+			continue
+		}
+
+		// the message can never fit
+		if limit.MaxBytes > 0 && size > limit.MaxBytes {
+			return nil, false
+		}
+
+		// calculate usage with message
+		usage := s.usage[i]
+		count, bytes := usage.count+1, usage.bytes+size
+		if old != nil {
+			count--
+			bytes -= old.size
+		}
+
+		// check usage
+		if !limit.exceeded(count, bytes) {
+			continue
+		}
+
+		// reject message
+		if limit.Policy == RetainedReject {
+			return nil, false
+		}
+
+		evicting = append(evicting, i)
+	}
+
+	// remove existing entry
+	if old != nil {
+		s.delete(old)
+	}
+
+	// evict least recently used messages
+	var evicted []*packet.Message
+	for _, i := range evicting {
+		limit := limits[i]
+		for {
+			// check usage
+			usage := s.usage[i]
+			if !limit.exceeded(usage.count+1, usage.bytes+size) {
+				break
+			}
+
+			// get oldest entry
+			entry := s.oldest(limit.Prefix)
+			if entry == nil {
+				break
+			}
+
+			// evict entry
+			s.delete(entry)
+			evicted = append(evicted, entry.msg)
+		}
+	}
+
+	// add entry
+	entry := &retainedEntry{
+		msg:  msg,
+		size: size,
+	}
+	entry.element = s.lru.PushFront(entry)
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+		heap.Push(&s.expiries, entry)
+	}
+	s.entries[msg.Topic] = entry
+	s.tree.Set(msg.Topic, msg)
+	s.account(msg.Topic, 1, size)
+
+	return evicted, true
+}
+
+// remove will clear the retained message for the topic.
+func (s *retainedStore) remove(topic string) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// delete entry
+	if entry, ok := s.entries[topic]; ok {
+		s.delete(entry)
+	}
+}
+
+// search will return the retained messages that match the filter and mark
+// them as recently used.
+func (s *retainedStore) search(filter string) []*packet.Message {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove expired messages
+	s.expire(time.Now())
+
+	// find messages
+	values := s.tree.Search(filter)
+	msgs := make([]*packet.Message, 0, len(values))
+	for _, value := range values {
+		msg := value.(*packet.Message)
+		s.lru.MoveToFront(s.entries[msg.Topic].element)
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+// count will return the number and total size of all retained messages.
+func (s *retainedStore) count() (int, int64) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove expired messages
+	s.expire(time.Now())
+
+	// sum sizes
+	var bytes int64
+	for _, entry := range s.entries {
+		bytes += entry.size
+	}
+
+	return len(s.entries), bytes
+}
+
+func (s *retainedStore) expire(now time.Time) {
+	for len(s.expiries) > 0 && !s.expiries[0].expires.After(now) {
+		s.delete(s.expiries[0])
+	}
+}
+
+func (s *retainedStore) delete(entry *retainedEntry) {
+	if !entry.expires.IsZero() {
+		heap.Remove(&s.expiries, entry.index)
+	}
+	s.lru.Remove(entry.element)
+	delete(s.entries, entry.msg.Topic)
+	s.tree.Empty(entry.msg.Topic)
+	s.account(entry.msg.Topic, -1, -entry.size)
+}
+
+func (s *retainedStore) oldest(prefix string) *retainedEntry {
+	for e := s.lru.Back(); e != nil; e = e.Prev() {
+		entry := e.Value.(*retainedEntry)
+		if strings.HasPrefix(entry.msg.Topic, prefix) {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func (s *retainedStore) account(topic string, count int, bytes int64) {
+	for i, limit := range s.limits {
+		if strings.HasPrefix(topic, limit.Prefix) {
+			s.usage[i].count += count
+			s.usage[i].bytes += bytes
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func retained(topic, payload string) *packet.Message {
+	return &packet.Message{Topic: topic, Payload: []byte(payload), Retain: true}
+}
+
+func TestRetainedStoreEvict(t *testing.T) {
+	store := newRetainedStore()
+	limits := []RetainedLimit{{MaxCount: 2}}
+
+	evicted, ok := store.set(retained("a", "1"), limits, 0)
+	assert.True(t, ok)
+	assert.Empty(t, evicted)
+
+	evicted, ok = store.set(retained("b", "1"), limits, 0)
+	assert.True(t, ok)
+	assert.Empty(t, evicted)
+
+	// mark "a" as used
+	assert.Len(t, store.search("a"), 1)
+
+	evicted, ok = store.set(retained("c", "1"), limits, 0)
+	assert.True(t, ok)
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "b", evicted[0].Topic)
+
+	// replacing does not evict
+	evicted, ok = store.set(retained("c", "2"), limits, 0)
+	assert.True(t, ok)
+	assert.Empty(t, evicted)
+
+	count, bytes := store.count()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(4), bytes)
+	assert.Len(t, store.search("#"), 2)
+}
+
+func TestRetainedStoreReject(t *testing.T) {
+	store := newRetainedStore()
+	limits := []RetainedLimit{{MaxBytes: 10, Policy: RetainedReject}}
+
+	_, ok := store.set(retained("a", "1234"), limits, 0)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("b", "1234"), limits, 0)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("c", "1234"), limits, 0)
+	assert.False(t, ok)
+
+	// message larger than the limit
+	_, ok = store.set(retained("d", "12345678901"), limits, 0)
+	assert.False(t, ok)
+
+	// replacing with a smaller message is allowed
+	_, ok = store.set(retained("a", "1"), limits, 0)
+	assert.True(t, ok)
+
+	store.remove("b")
+
+	_, ok = store.set(retained("c", "1234"), limits, 0)
+	assert.True(t, ok)
+
+	count, bytes := store.count()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(7), bytes)
+}
+
+func TestRetainedStorePrefix(t *testing.T) {
+	store := newRetainedStore()
+	limits := []RetainedLimit{
+		{Prefix: "dev/", MaxCount: 1},
+		{Prefix: "sys/", MaxCount: 1, Policy: RetainedReject},
+	}
+
+	_, ok := store.set(retained("dev/a", "1"), limits, 0)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("sys/a", "1"), limits, 0)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("foo", "1"), limits, 0)
+	assert.True(t, ok)
+
+	evicted, ok := store.set(retained("dev/b", "1"), limits, 0)
+	assert.True(t, ok)
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "dev/a", evicted[0].Topic)
+
+	_, ok = store.set(retained("sys/b", "1"), limits, 0)
+	assert.False(t, ok)
+
+	var topics []string
+	for _, msg := range store.search("#") {
+		topics = append(topics, msg.Topic)
+	}
+	sort.Strings(topics)
+	assert.Equal(t, []string{"dev/b", "foo", "sys/a"}, topics)
+}
+
+func TestRetainedStoreTTL(t *testing.T) {
+	store := newRetainedStore()
+
+	_, ok := store.set(retained("a", "1"), nil, 10*time.Millisecond)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("b", "1"), nil, 0)
+	assert.True(t, ok)
+
+	_, ok = store.set(retained("c", "1"), nil, time.Hour)
+	assert.True(t, ok)
+
+	assert.Len(t, store.search("#"), 3)
+
+	time.Sleep(20 * time.Millisecond)
+
+	var topics []string
+	for _, msg := range store.search("#") {
+		topics = append(topics, msg.Topic)
+	}
+	sort.Strings(topics)
+	assert.Equal(t, []string{"b", "c"}, topics)
+
+	// clearing removes expiry
+	store.remove("c")
+	assert.Empty(t, store.expiries)
+}
+
+func TestMemoryBackendRetainedTTL(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.RetainedTTLs = map[string]time.Duration{
+		"sensors/#":   time.Hour,
+		"sensors/+/t": time.Minute,
+	}
+
+	assert.Equal(t, time.Hour, backend.retainedTTL("sensors/a/h"))
+	assert.Equal(t, time.Minute, backend.retainedTTL("sensors/a/t"))
+	assert.Equal(t, time.Duration(0), backend.retainedTTL("other"))
+}
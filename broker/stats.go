@@ -0,0 +1,168 @@
+package broker
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// BackendStats describes the state managed by a backend.
+type BackendStats struct {
+	// The number of retained messages.
+	RetainedMessages int
+
+	// The number of stored and temporary sessions.
+	Sessions int
+}
+
+// SessionStats describes the queue of a session.
+type SessionStats struct {
+	// The client id of the session.
+	ClientID string
+
+	// Whether a client is connected to the session.
+	Connected bool
+
+	// The number of queued messages.
+	Queued int
+
+	// The time the oldest queued message is waiting for delivery.
+	OldestAge time.Duration
+
+	// The time the last dequeued message has been waiting for delivery.
+	Lag time.Duration
+}
+
+// A StatsBackend is a backend that reports statistics about its state.
+type StatsBackend interface {
+	Backend
+
+	// Stats should return a snapshot of the backend statistics.
+	Stats() BackendStats
+}
+
+// Stats is a snapshot of the statistics of an Engine.
+type Stats struct {
+	BackendStats
+
+	// The time since the engine has been created.
+	Uptime time.Duration
+
+	// The number of servers the engine is currently accepting connections
+	// from.
+	Listeners int64
+
+	// The number of currently connected clients.
+	CurrentConnections int64
+
+	// The number of clients connected since the engine has been created.
+	TotalConnections int64
+
+	// The number of connections that have been rejected as their source has
+	// been banned by the ConnectLimiter or exceeded the IPLimiter.
+	RejectedConnections int64
+
+	// The number of received packets by type.
+	PacketsReceived map[packet.Type]int64
+
+	// The number of sent packets by type.
+	PacketsSent map[packet.Type]int64
+
+	// The number of messages that have been dropped as the client was not
+	// authorized to publish them.
+	DroppedMessages int64
+}
+
+// the counters are placed first to ensure the 64-bit alignment required for
+// atomic operations on 32-bit platforms
+type engineStats struct {
+	current   int64
+	total     int64
+	incoming  [16]int64
+	outgoing  [16]int64
+	dropped   int64
+	rejected  int64
+	listeners int64
+	started   time.Time
+}
+
+func newEngineStats() *engineStats {
+	return &engineStats{
+		started: time.Now(),
+	}
+}
+
+func (s *engineStats) connect() {
+	if s != nil {
+		atomic.AddInt64(&s.current, 1)
+		atomic.AddInt64(&s.total, 1)
+	}
+}
+
+func (s *engineStats) disconnect() {
+	if s != nil {
+		atomic.AddInt64(&s.current, -1)
+	}
+}
+
+func (s *engineStats) received(pkt packet.Generic) {
+	if s != nil {
+		atomic.AddInt64(&s.incoming[pkt.Type()&0xF], 1)
+	}
+}
+
+func (s *engineStats) sent(pkt packet.Generic) {
+	if s != nil {
+		atomic.AddInt64(&s.outgoing[pkt.Type()&0xF], 1)
+	}
+}
+
+func (s *engineStats) drop() {
+	if s != nil {
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+func (s *engineStats) reject() {
+	if s != nil {
+		atomic.AddInt64(&s.rejected, 1)
+	}
+}
+
+func (s *engineStats) listen(delta int64) {
+	if s != nil {
+		atomic.AddInt64(&s.listeners, delta)
+	}
+}
+
+func (s *engineStats) snapshot() Stats {
+	// prepare stats
+	stats := Stats{
+		CurrentConnections:  atomic.LoadInt64(&s.current),
+		TotalConnections:    atomic.LoadInt64(&s.total),
+		RejectedConnections: atomic.LoadInt64(&s.rejected),
+		Listeners:           atomic.LoadInt64(&s.listeners),
+		PacketsReceived:     make(map[packet.Type]int64),
+		PacketsSent:         make(map[packet.Type]int64),
+		DroppedMessages:     atomic.LoadInt64(&s.dropped),
+	}
+
+	// set uptime
+	if !s.started.IsZero() {
+		stats.Uptime = time.Since(s.started)
+	}
+
+	// collect packet counters
+	for i := range s.incoming {
+		if n := atomic.LoadInt64(&s.incoming[i]); n > 0 {
+			stats.PacketsReceived[packet.Type(i)] = n
+		}
+
+		if n := atomic.LoadInt64(&s.outgoing[i]); n > 0 {
+			stats.PacketsSent[packet.Type(i)] = n
+		}
+	}
+
+	return stats
+}
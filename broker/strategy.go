@@ -0,0 +1,141 @@
+package broker
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Member is a candidate that may receive a message of a shared subscription
+// group.
+type Member struct {
+	// The client id of the member.
+	ID string
+
+	// The connected client or nil if the member is offline.
+	Client *Client
+
+	// The number of messages queued for the member that have not yet been
+	// dequeued.
+	Inflight int
+}
+
+// A Strategy picks the receiving member of a shared subscription group.
+type Strategy interface {
+	// Pick should return the index of the member that should receive the
+	// message published by the specified client. The list of members is
+	// never empty.
+	Pick(group string, publisher *Client, msg *packet.Message, members []Member) int
+}
+
+// RoundRobinStrategy distributes messages in turn to all members of a group.
+type RoundRobinStrategy struct {
+	counters map[string]int
+	mutex    sync.Mutex
+}
+
+// NewRoundRobinStrategy returns a new RoundRobinStrategy.
+func NewRoundRobinStrategy() *RoundRobinStrategy {
+	return &RoundRobinStrategy{
+		counters: make(map[string]int),
+	}
+}
+
+// Pick implements the Strategy interface.
+func (s *RoundRobinStrategy) Pick(group string, _ *Client, _ *packet.Message, members []Member) int {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// get and advance counter
+	i := s.counters[group] % len(members)
+	s.counters[group] = i + 1
+
+	return i
+}
+
+// RandomStrategy distributes messages randomly to all members of a group.
+type RandomStrategy struct {
+	rand  *rand.Rand
+	mutex sync.Mutex
+}
+
+// NewRandomStrategy returns a new RandomStrategy.
+func NewRandomStrategy() *RandomStrategy {
+	return &RandomStrategy{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Pick implements the Strategy interface.
+func (s *RandomStrategy) Pick(_ string, _ *Client, _ *packet.Message, members []Member) int {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rand.Intn(len(members))
+}
+
+// StickyStrategy delivers all messages of a publishing client to the same
+// member of a group. Rendezvous hashing is used to pick the member, which only
+// moves the publishers of a member that leaves the group.
+type StickyStrategy struct{}
+
+// NewStickyStrategy returns a new StickyStrategy.
+func NewStickyStrategy() *StickyStrategy {
+	return &StickyStrategy{}
+}
+
+// Pick implements the Strategy interface.
+func (s *StickyStrategy) Pick(group string, publisher *Client, _ *packet.Message, members []Member) int {
+	// get publisher id
+	var id string
+	if publisher != nil {
+		id = publisher.ID()
+	}
+
+	// find member with highest weight
+	var best int
+	var max uint64
+	for i, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(group))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(id))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(member.ID))
+
+		if w := h.Sum64(); i == 0 || w > max {
+			best = i
+			max = w
+		}
+	}
+
+	return best
+}
+
+// LeastInflightStrategy delivers messages to the member with the fewest
+// inflight messages. Ties are resolved in favour of the member that joined the
+// group first.
+type LeastInflightStrategy struct{}
+
+// NewLeastInflightStrategy returns a new LeastInflightStrategy.
+func NewLeastInflightStrategy() *LeastInflightStrategy {
+	return &LeastInflightStrategy{}
+}
+
+// Pick implements the Strategy interface.
+func (s *LeastInflightStrategy) Pick(_ string, _ *Client, _ *packet.Message, members []Member) int {
+	// find member with least inflight messages
+	var best int
+	for i, member := range members {
+		if member.Inflight < members[best].Inflight {
+			best = i
+		}
+	}
+
+	return best
+}
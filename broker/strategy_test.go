@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRobinStrategy(t *testing.T) {
+	strategy := NewRoundRobinStrategy()
+	members := []Member{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	var picks []int
+	for i := 0; i < 4; i++ {
+		picks = append(picks, strategy.Pick("foo", nil, nil, members))
+	}
+
+	assert.Equal(t, []int{0, 1, 2, 0}, picks)
+	assert.Equal(t, 0, strategy.Pick("bar", nil, nil, members))
+	assert.Equal(t, 0, strategy.Pick("foo", nil, nil, members[:1]))
+}
+
+func TestRandomStrategy(t *testing.T) {
+	strategy := NewRandomStrategy()
+	members := []Member{{ID: "a"}, {ID: "b"}}
+
+	for i := 0; i < 10; i++ {
+		i := strategy.Pick("foo", nil, nil, members)
+		assert.True(t, i >= 0 && i < len(members))
+	}
+}
+
+func TestStickyStrategy(t *testing.T) {
+	strategy := NewStickyStrategy()
+	members := []Member{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	i := strategy.Pick("foo", nil, nil, members)
+	for j := 0; j < 10; j++ {
+		assert.Equal(t, i, strategy.Pick("foo", nil, nil, members))
+	}
+
+	// removing another member keeps the pick
+	var rest []Member
+	for j, member := range members {
+		if j != (i+1)%len(members) {
+			rest = append(rest, member)
+		}
+	}
+
+	assert.Equal(t, members[i].ID, rest[strategy.Pick("foo", nil, nil, rest)].ID)
+}
+
+func TestLeastInflightStrategy(t *testing.T) {
+	strategy := NewLeastInflightStrategy()
+
+	assert.Equal(t, 1, strategy.Pick("foo", nil, nil, []Member{
+		{ID: "a", Inflight: 2},
+		{ID: "b", Inflight: 1},
+		{ID: "c", Inflight: 1},
+	}))
+}
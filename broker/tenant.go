@@ -0,0 +1,179 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInvalidTenant is returned if the tenant of a client is missing or
+// contains separators or wildcards.
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// A TenantBackend wraps another backend and confines every client to the topic
+// namespace of its tenant. Topics and filters of the client are prefixed before
+// they are passed to the wrapped backend and the prefix is stripped from the
+// messages delivered to the client. This isolates tenants that share a broker.
+type TenantBackend struct {
+	Backend
+
+	// The prefix of the tenant namespace. The placeholder "{id}" is replaced
+	// with the tenant of the client.
+	//
+	// Will default to "tenants/{id}/".
+	Prefix string
+
+	// The Tenant callback returns the tenant of the client.
+	//
+	// Will default to the subject of the identity set by an AuthBackend.
+	Tenant func(client *Client) string
+
+	prefixes map[*Client]string
+	mutex    sync.RWMutex
+}
+
+// NewTenantBackend returns a new TenantBackend that wraps the specified
+// backend.
+func NewTenantBackend(backend Backend) *TenantBackend {
+	return &TenantBackend{
+		Backend:  backend,
+		Prefix:   "tenants/{id}/",
+		prefixes: make(map[*Client]string),
+	}
+}
+
+// Setup will determine the tenant of the client and setup the client using the
+// wrapped backend. The client id is prefixed as well, so that clients of
+// different tenants may use the same id.
+func (t *TenantBackend) Setup(client *Client, id string, clean bool) (Session, bool, error) {
+	// get tenant
+	var tenant string
+	if t.Tenant != nil {
+		tenant = t.Tenant(client)
+	} else if identity := ClientIdentity(client); identity != nil {
+		tenant = identity.Subject
+	}
+
+	// check tenant
+	if tenant == "" || strings.ContainsAny(tenant, "/+#") {
+		return nil, false, ErrInvalidTenant
+	}
+
+	// get prefix
+	prefix := t.Prefix
+	if prefix == "" {
+		prefix = "tenants/{id}/"
+	}
+
+	// save prefix
+	prefix = strings.Replace(prefix, "{id}", tenant, -1)
+	t.mutex.Lock()
+	t.prefixes[client] = prefix
+	t.mutex.Unlock()
+
+	// prefix id to separate the sessions of tenants
+	if id != "" {
+		id = prefix + id
+	}
+
+	return t.Backend.Setup(client, id, clean)
+}
+
+// Subscribe will prefix the filters and subscribe the client using the wrapped
+// backend.
+func (t *TenantBackend) Subscribe(client *Client, subs []packet.Subscription, ack Ack) error {
+	// get prefix
+	prefix := t.prefix(client)
+
+	// prefix filters
+	list := make([]packet.Subscription, len(subs))
+	for i, sub := range subs {
+		list[i] = sub
+		list[i].Topic = prefixFilter(prefix, sub.Topic)
+	}
+
+	return t.Backend.Subscribe(client, list, ack)
+}
+
+// Unsubscribe will prefix the filters and unsubscribe the client using the
+// wrapped backend.
+func (t *TenantBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	// get prefix
+	prefix := t.prefix(client)
+
+	// prefix filters
+	list := make([]string, len(topics))
+	for i, filter := range topics {
+		list[i] = prefixFilter(prefix, filter)
+	}
+
+	return t.Backend.Unsubscribe(client, list, ack)
+}
+
+// Publish will prefix the topic and publish the message using the wrapped
+// backend.
+func (t *TenantBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// prefix topic of a copy as the message may be stored in the session
+	prefixed := *msg
+	prefixed.Topic = t.prefix(client) + msg.Topic
+
+	return t.Backend.Publish(client, &prefixed, ack)
+}
+
+// Dequeue will dequeue the next message using the wrapped backend and strip the
+// prefix from its topic.
+func (t *TenantBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
+	// dequeue message
+	msg, ack, err := t.Backend.Dequeue(client)
+	if err != nil || msg == nil {
+		return msg, ack, err
+	}
+
+	// strip prefix from a copy as the message may be shared
+	prefix := t.prefix(client)
+	if strings.HasPrefix(msg.Topic, prefix) {
+		stripped := *msg
+		stripped.Topic = msg.Topic[len(prefix):]
+		msg = &stripped
+	}
+
+	return msg, ack, nil
+}
+
+// Terminate will terminate the client using the wrapped backend.
+func (t *TenantBackend) Terminate(client *Client) error {
+	// terminate client
+	err := t.Backend.Terminate(client)
+
+	// remove prefix
+	t.mutex.Lock()
+	delete(t.prefixes, client)
+	t.mutex.Unlock()
+
+	return err
+}
+
+// Close forwards to the wrapped backend, see Closer.
+func (t *TenantBackend) Close(timeout time.Duration) bool {
+	return closeBackend(t.Backend, timeout)
+}
+
+func (t *TenantBackend) prefix(client *Client) string {
+	// acquire mutex
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.prefixes[client]
+}
+
+func prefixFilter(prefix, filter string) string {
+	// prefix the filter of shared subscriptions
+	if name, f, ok := parseShared(filter); ok {
+		return "$share/" + name + "/" + prefix + f
+	}
+
+	return prefix + filter
+}
@@ -0,0 +1,94 @@
+package broker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantBackend(t *testing.T) {
+	backend := NewTenantBackend(NewMemoryBackend())
+	backend.Tenant = func(client *Client) string {
+		return strings.Split(client.ID(), "-")[0]
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	connect1 := packet.NewConnect()
+	connect1.ClientID = "a-1"
+
+	connect2 := packet.NewConnect()
+	connect2.ClientID = "b-1"
+
+	conn1, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	conn2, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(connect1).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{ID: 1, Subscriptions: []packet.Subscription{
+			{Topic: "#", QOS: 0},
+		}}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+		Test(conn1)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(connect2).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "foo", Payload: []byte("b")}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn2)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(&packet.Publish{Message: packet.Message{Topic: "foo", Payload: []byte("a")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "foo", Payload: []byte("a")}}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn1)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestTenantBackendInvalidTenant(t *testing.T) {
+	backend := NewTenantBackend(NewMemoryBackend())
+	backend.Tenant = func(client *Client) string {
+		return client.ID()
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.ClientID = "a/+"
+
+	err = flow.New().
+		Send(connect).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestPrefixFilter(t *testing.T) {
+	assert.Equal(t, "tenants/a/foo/#", prefixFilter("tenants/a/", "foo/#"))
+	assert.Equal(t, "$share/g/tenants/a/foo", prefixFilter("tenants/a/", "$share/g/foo"))
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// A Point is a single numeric sample of a time series.
+type Point struct {
+	// The name of the measurement.
+	Measurement string
+
+	// The tags that identify the series.
+	Tags map[string]string
+
+	// The sampled value.
+	Value float64
+
+	// The time of the sample.
+	Time time.Time
+}
+
+// A Sink writes batches of points to a time-series database.
+type Sink interface {
+	Write(points []Point) error
+}
+
+// A SeriesRoute defines how messages matching a filter are turned into points.
+type SeriesRoute struct {
+	// The filter that selects the messages.
+	Filter string
+
+	// The measurement name of the points. The placeholder "{n}" is replaced
+	// with the n-th topic level, starting from one.
+	//
+	// Will default to the message topic.
+	Measurement string
+
+	// The tags added to the points. The values may contain the same
+	// placeholders as the measurement.
+	Tags map[string]string
+}
+
+// A SinkArchiver is an Archiver that extracts numeric payloads from messages
+// that match one of its routes and writes them as points to a Sink. Messages
+// with payloads that cannot be parsed as a number are ignored. If a message
+// matches multiple routes, the first configured route is used.
+//
+// Use it with an ArchiveBackend to batch and queue the writes.
+type SinkArchiver struct {
+	// The configured routes.
+	//
+	// Note: The value must be set before the first batch is archived.
+	Routes []SeriesRoute
+
+	sink   Sink
+	routes *topic.Tree
+	once   sync.Once
+}
+
+// NewSinkArchiver returns a new SinkArchiver that writes to the specified sink.
+func NewSinkArchiver(sink Sink, routes ...SeriesRoute) *SinkArchiver {
+	return &SinkArchiver{
+		Routes: routes,
+		sink:   sink,
+	}
+}
+
+// Archive implements the Archiver interface.
+func (a *SinkArchiver) Archive(msgs []ArchivedMessage) error {
+	// prepare routes
+	a.once.Do(func() {
+		a.routes = topic.NewTree()
+		for i := range a.Routes {
+			a.routes.Add(a.Routes[i].Filter, i)
+		}
+	})
+
+	// convert messages
+	points := make([]Point, 0, len(msgs))
+	for _, msg := range msgs {
+		// find first route
+		index := -1
+		for _, value := range a.routes.Match(msg.Topic) {
+			if index < 0 || value.(int) < index {
+				index = value.(int)
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		route := a.Routes[index]
+
+		// parse value
+		value, err := strconv.ParseFloat(strings.TrimSpace(string(msg.Payload)), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		// prepare point
+		point := Point{
+			Measurement: msg.Topic,
+			Value:       value,
+			Time:        msg.Time,
+		}
+
+		// set measurement
+		if route.Measurement != "" {
+			point.Measurement = expandLevels(route.Measurement, msg.Topic)
+		}
+
+		// set tags
+		if len(route.Tags) > 0 {
+			point.Tags = make(map[string]string, len(route.Tags))
+			for key, value := range route.Tags {
+				point.Tags[key] = expandLevels(value, msg.Topic)
+			}
+		}
+
+		points = append(points, point)
+	}
+
+	// check points
+	if len(points) == 0 {
+		return nil
+	}
+
+	return a.sink.Write(points)
+}
+
+func expandLevels(template, topic string) string {
+	// check template
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	// replace levels in reverse to handle multi digit indexes
+	levels := strings.Split(topic, "/")
+	for i := len(levels); i > 0; i-- {
+		template = strings.Replace(template, "{"+strconv.Itoa(i)+"}", levels[i-1], -1)
+	}
+
+	return template
+}
@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	points []Point
+	err    error
+}
+
+func (s *testSink) Write(points []Point) error {
+	s.points = append(s.points, points...)
+	return s.err
+}
+
+func TestSinkArchiver(t *testing.T) {
+	sink := &testSink{}
+
+	archiver := NewSinkArchiver(sink, SeriesRoute{
+		Filter:      "sensors/+/temperature",
+		Measurement: "{3}",
+		Tags: map[string]string{
+			"sensor": "{2}",
+			"site":   "home",
+		},
+	}, SeriesRoute{
+		Filter: "sensors/#",
+	})
+
+	now := time.Now()
+
+	err := archiver.Archive([]ArchivedMessage{
+		{Topic: "sensors/s1/temperature", Payload: []byte(" 21.5\n"), Time: now},
+		{Topic: "sensors/s1/humidity", Payload: []byte("40"), Time: now},
+		{Topic: "sensors/s1/status", Payload: []byte("online"), Time: now},
+		{Topic: "sensors/s1/broken", Payload: []byte("NaN"), Time: now},
+		{Topic: "other", Payload: []byte("1"), Time: now},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Point{
+		{
+			Measurement: "temperature",
+			Tags:        map[string]string{"sensor": "s1", "site": "home"},
+			Value:       21.5,
+			Time:        now,
+		},
+		{
+			Measurement: "sensors/s1/humidity",
+			Value:       40,
+			Time:        now,
+		},
+	}, sink.points)
+}
+
+func TestSinkArchiverError(t *testing.T) {
+	sink := &testSink{err: errors.New("failed")}
+
+	archiver := NewSinkArchiver(sink, SeriesRoute{Filter: "#"})
+
+	err := archiver.Archive([]ArchivedMessage{
+		{Topic: "foo", Payload: []byte("bar")},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, sink.points)
+
+	err = archiver.Archive([]ArchivedMessage{
+		{Topic: "foo", Payload: []byte("1")},
+	})
+	assert.Equal(t, sink.err, err)
+}
+
+func TestExpandLevels(t *testing.T) {
+	topic := "a/b/c/d/e/f/g/h/i/j/k/l"
+
+	assert.Equal(t, "foo", expandLevels("foo", topic))
+	assert.Equal(t, "a-c", expandLevels("{1}-{3}", topic))
+	assert.Equal(t, "l-k", expandLevels("{12}-{11}", topic))
+	assert.Equal(t, "{13}", expandLevels("{13}", topic))
+}
@@ -0,0 +1,31 @@
+package broker
+
+import (
+	"net/http"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// TreeHandler returns a handler that renders the tree returned by the function,
+// e.g. the SubscriptionTree of a MemoryBackend. The "prefix" query parameter
+// limits the output to the subtree of a topic and the "format" query parameter
+// may be set to "dot" to render a Graphviz graph instead of indented text.
+func TreeHandler(tree func() *topic.Tree) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// get parameters
+		prefix := r.URL.Query().Get("prefix")
+		format := r.URL.Query().Get("format")
+
+		// render tree
+		switch format {
+		case "", "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_ = tree().Render(w, prefix)
+		case "dot":
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			_ = tree().RenderDOT(w, prefix)
+		default:
+			http.Error(w, "unknown format", http.StatusBadRequest)
+		}
+	})
+}
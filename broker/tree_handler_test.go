@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeHandler(t *testing.T) {
+	backend := NewMemoryBackend()
+	engine := NewEngine(backend)
+
+	port, quit, done := Run(engine, "tcp")
+
+	var conns []transport.Conn
+	for i, id := range []string{"a", "b"} {
+		conn, err := transport.Dial("tcp://localhost:" + port)
+		assert.NoError(t, err)
+
+		connect := packet.NewConnect()
+		connect.ClientID = id
+		connect.CleanSession = i == 0
+
+		subscribe := packet.NewSubscribe()
+		subscribe.ID = 1
+		subscribe.Subscriptions = []packet.Subscription{
+			{Topic: "foo/bar"},
+			{Topic: "$share/g/foo/#"},
+		}
+
+		suback := packet.NewSuback()
+		suback.ID = 1
+		suback.ReturnCodes = []packet.QOS{0, 0}
+
+		err = flow.New().
+			Send(connect).
+			Receive(packet.NewConnack()).
+			Send(subscribe).
+			Receive(suback).
+			Test(conn)
+		assert.NoError(t, err)
+
+		conns = append(conns, conn)
+	}
+
+	handler := TreeHandler(backend.SubscriptionTree)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "$share [0/2]\n"+
+		"  g [0/2]\n"+
+		"    foo [0/2]\n"+
+		"      # [2/2]\n"+
+		"foo [0/2]\n"+
+		"  bar [2/2]\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?prefix=foo&format=dot", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "digraph topics {\n"+
+		"  n0 [label=\"foo [0/2]\"];\n"+
+		"  n1 [label=\"bar [2/2]\"];\n"+
+		"  n0 -> n1;\n"+
+		"}\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=foo", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	for _, conn := range conns {
+		err := flow.New().
+			Send(packet.NewDisconnect()).
+			End().
+			Test(conn)
+		assert.NoError(t, err)
+	}
+
+	close(quit)
+	safeReceive(done)
+}
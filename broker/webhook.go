@@ -0,0 +1,282 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrWebhookQueueFull is emitted if a message is dropped because the webhook
+// queue is full.
+var ErrWebhookQueueFull = errors.New("webhook queue full")
+
+// A WebhookEndpoint receives published messages that match one of its
+// filters.
+type WebhookEndpoint struct {
+	// The URL that receives the POST requests.
+	URL string
+
+	// The topic filters of the forwarded messages.
+	Filters []string
+
+	// Additional request headers (e.g. for authentication).
+	Headers map[string]string
+}
+
+// A WebhookMessage is the JSON body of a webhook request.
+type WebhookMessage struct {
+	Topic    string     `json:"topic"`
+	Payload  []byte     `json:"payload"`
+	QOS      packet.QOS `json:"qos"`
+	Retain   bool       `json:"retain"`
+	ClientID string     `json:"client_id"`
+	Time     time.Time  `json:"time"`
+}
+
+type webhookJob struct {
+	endpoint *WebhookEndpoint
+	body     []byte
+}
+
+// A WebhookBackend wraps another backend and POSTs all successfully published
+// messages that match the filters of an endpoint as JSON. Requests are sent
+// asynchronously and are retried with an exponential backoff if they fail or
+// the endpoint does not respond with a 2xx status code. Messages are dropped
+// if the queue is full.
+type WebhookBackend struct {
+	Backend
+
+	// The configured endpoints.
+	//
+	// Note: The value must be set before the first message is published.
+	Endpoints []WebhookEndpoint
+
+	// The HTTP client used to send the requests.
+	//
+	// Will default to a client with a 10 second timeout.
+	Client *http.Client
+
+	// The maximum number of concurrent requests.
+	//
+	// Will default to 10.
+	Concurrency int
+
+	// The maximum number of queued requests.
+	//
+	// Will default to 1000.
+	QueueSize int
+
+	// The number of retries after a failed request.
+	//
+	// Will default to 3.
+	MaxRetries int
+
+	// The delay before the first retry that is doubled for every further
+	// retry.
+	//
+	// Will default to one second.
+	RetryDelay time.Duration
+
+	// The callback that is called with dropped messages and failed requests.
+	ErrorCallback func(error)
+
+	endpoints *topic.Tree
+	queue     chan webhookJob
+	closed    bool
+	workers   sync.WaitGroup
+	once      sync.Once
+	mutex     sync.Mutex
+}
+
+// NewWebhookBackend returns a new WebhookBackend that wraps the specified
+// backend.
+func NewWebhookBackend(backend Backend) *WebhookBackend {
+	return &WebhookBackend{
+		Backend:     backend,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Concurrency: 10,
+		QueueSize:   1000,
+		MaxRetries:  3,
+		RetryDelay:  time.Second,
+	}
+}
+
+// Publish will publish the message using the wrapped backend and queue a
+// request for every matching endpoint.
+func (w *WebhookBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// the wrapped backend may modify the message
+	webhookMsg := WebhookMessage{
+		Topic:    msg.Topic,
+		Payload:  msg.Payload,
+		QOS:      msg.QOS,
+		Retain:   msg.Retain,
+		ClientID: client.ID(),
+		Time:     time.Now(),
+	}
+
+	// publish message
+	err := w.Backend.Publish(client, msg, ack)
+	if err != nil {
+		return err
+	}
+
+	// start workers
+	w.once.Do(w.start)
+
+	// get endpoints
+	endpoints := w.endpoints.Match(webhookMsg.Topic)
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	// encode message
+	body, err := json.Marshal(webhookMsg)
+	if err != nil {
+		return err
+	}
+
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// queue jobs
+	for _, endpoint := range endpoints {
+		if w.closed {
+			return nil
+		}
+
+		select {
+		case w.queue <- webhookJob{endpoint: endpoint.(*WebhookEndpoint), body: body}:
+		default:
+			w.error(ErrWebhookQueueFull)
+		}
+	}
+
+	return nil
+}
+
+// Close implements the Closer interface. Once the wrapped backend has been
+// closed, the queue is drained and the workers are awaited, so the events of
+// the last clients are still delivered.
+func (w *WebhookBackend) Close(timeout time.Duration) bool {
+	// get deadline
+	deadline := time.Now().Add(timeout)
+
+	// close wrapped backend
+	if !closeBackend(w.Backend, timeout) {
+		return false
+	}
+
+	// make sure workers are started
+	w.once.Do(w.start)
+
+	// stop queueing
+	w.mutex.Lock()
+	if !w.closed {
+		close(w.queue)
+		w.closed = true
+	}
+	w.mutex.Unlock()
+
+	// wait for workers
+	done := make(chan struct{})
+	go func() {
+		w.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
+
+func (w *WebhookBackend) start() {
+	// prepare endpoints
+	w.endpoints = topic.NewTree()
+	for i := range w.Endpoints {
+		for _, filter := range w.Endpoints[i].Filters {
+			w.endpoints.Add(filter, &w.Endpoints[i])
+		}
+	}
+
+	// prepare queue
+	w.queue = make(chan webhookJob, w.QueueSize)
+
+	// start workers
+	for i := 0; i < w.Concurrency; i++ {
+		w.workers.Add(1)
+		go w.worker()
+	}
+}
+
+func (w *WebhookBackend) worker() {
+	defer w.workers.Done()
+
+	for job := range w.queue {
+		delay := w.RetryDelay
+
+		for i := 0; ; i++ {
+			// send request
+			err := w.send(job)
+			if err == nil {
+				break
+			}
+
+			// check retries
+			if i >= w.MaxRetries {
+				w.error(err)
+				break
+			}
+
+			// wait and backoff
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func (w *WebhookBackend) send(job webhookJob) error {
+	// prepare request
+	req, err := http.NewRequest("POST", job.endpoint.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+
+	// set headers
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range job.endpoint.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// send request
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// close body
+	_ = res.Body.Close()
+
+	// check status
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", job.endpoint.URL, res.StatusCode)
+	}
+
+	return nil
+}
+
+func (w *WebhookBackend) error(err error) {
+	if w.ErrorCallback != nil {
+		w.ErrorCallback(err)
+	}
+}
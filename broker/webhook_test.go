@@ -0,0 +1,128 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookBackend(t *testing.T) {
+	var attempts int32
+	received := make(chan WebhookMessage, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+
+		// fail first attempt
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var msg WebhookMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		received <- msg
+	}))
+	defer server.Close()
+
+	backend := NewWebhookBackend(NewMemoryBackend())
+	backend.RetryDelay = 10 * time.Millisecond
+	backend.Endpoints = []WebhookEndpoint{
+		{
+			URL:     server.URL,
+			Filters: []string{"foo/+", "foo/bar"},
+			Headers: map[string]string{"Authorization": "secret"},
+		},
+	}
+	backend.ErrorCallback = func(err error) {
+		assert.NoError(t, err)
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfigWithClientID("tcp://localhost:"+port, "publisher"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err := publisher.Publish("baz", []byte("qux"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	pf, err = publisher.Publish("foo/bar", []byte("baz"), 1, true)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg := <-received
+	assert.Equal(t, "foo/bar", msg.Topic)
+	assert.Equal(t, []byte("baz"), msg.Payload)
+	assert.Equal(t, 1, int(msg.QOS))
+	assert.True(t, msg.Retain)
+	assert.Equal(t, "publisher", msg.ClientID)
+
+	assert.NoError(t, publisher.Disconnect())
+
+	close(quit)
+	safeReceive(done)
+
+	assert.True(t, backend.Close(time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhookBackendQueueFull(t *testing.T) {
+	block := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+
+	errs := make(chan error, 10)
+
+	backend := NewWebhookBackend(NewMemoryBackend())
+	backend.Concurrency = 1
+	backend.QueueSize = 1
+	backend.Endpoints = []WebhookEndpoint{
+		{URL: server.URL, Filters: []string{"#"}},
+	}
+	backend.ErrorCallback = func(err error) {
+		errs <- err
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for i := 0; i < 3; i++ {
+		pf, err := publisher.Publish("foo", []byte("bar"), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+
+		// let the worker pick up the first request
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, ErrWebhookQueueFull, <-errs)
+
+	assert.NoError(t, publisher.Disconnect())
+
+	close(quit)
+	safeReceive(done)
+
+	close(block)
+	assert.True(t, backend.Close(time.Second))
+}
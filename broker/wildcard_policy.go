@@ -0,0 +1,54 @@
+package broker
+
+import "strings"
+
+// A WildcardPolicy restricts the wildcards clients may use in subscriptions
+// to prevent broad subscriptions from receiving all messages of the broker.
+// The filter of shared subscriptions is checked without the group prefix. The
+// policy may be set on identities or used as an authorizer for all clients.
+type WildcardPolicy struct {
+	// ForbidMultiLevel may be set to forbid the multi-level wildcard "#".
+	ForbidMultiLevel bool
+
+	// ForbidSingleLevel may be set to forbid the single-level wildcard "+".
+	ForbidSingleLevel bool
+
+	// MinimumLevels may be set to require the specified number of levels
+	// without wildcards before the first wildcard. A value of one forbids
+	// "#" and "+/foo" but allows "foo/#".
+	MinimumLevels int
+}
+
+// Allows returns whether the policy allows the specified filter.
+func (p *WildcardPolicy) Allows(filter string) bool {
+	// get filter of shared subscriptions
+	if _, f, ok := parseShared(filter); ok {
+		filter = f
+	}
+
+	// check levels
+	for i, level := range strings.Split(filter, "/") {
+		// check wildcards
+		multi, single := level == "#", level == "+"
+		if !multi && !single {
+			continue
+		}
+
+		// check policy
+		if multi && p.ForbidMultiLevel || single && p.ForbidSingleLevel || i < p.MinimumLevels {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AuthorizePublish implements the Authorizer interface.
+func (p *WildcardPolicy) AuthorizePublish(*Client, string) bool {
+	return true
+}
+
+// AuthorizeSubscribe implements the Authorizer interface.
+func (p *WildcardPolicy) AuthorizeSubscribe(_ *Client, filter string) bool {
+	return p.Allows(filter)
+}
@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWildcardPolicy(t *testing.T) {
+	table := []struct {
+		policy WildcardPolicy
+		filter string
+		result bool
+	}{
+		{WildcardPolicy{}, "#", true},
+		{WildcardPolicy{ForbidMultiLevel: true}, "#", false},
+		{WildcardPolicy{ForbidMultiLevel: true}, "foo/#", false},
+		{WildcardPolicy{ForbidMultiLevel: true}, "foo/+/bar", true},
+		{WildcardPolicy{ForbidSingleLevel: true}, "foo/+/bar", false},
+		{WildcardPolicy{ForbidSingleLevel: true}, "foo/#", true},
+		{WildcardPolicy{ForbidSingleLevel: true}, "foo/bar", true},
+		{WildcardPolicy{MinimumLevels: 1}, "#", false},
+		{WildcardPolicy{MinimumLevels: 1}, "+/foo", false},
+		{WildcardPolicy{MinimumLevels: 1}, "foo/#", true},
+		{WildcardPolicy{MinimumLevels: 2}, "foo/+/bar", false},
+		{WildcardPolicy{MinimumLevels: 2}, "foo/bar/#", true},
+		{WildcardPolicy{MinimumLevels: 2}, "foo", true},
+		{WildcardPolicy{MinimumLevels: 1}, "$share/group/#", false},
+		{WildcardPolicy{MinimumLevels: 1}, "$share/group/foo/#", true},
+	}
+
+	for _, item := range table {
+		assert.Equal(t, item.result, item.policy.Allows(item.filter), item.filter)
+	}
+}
+
+func TestWildcardPolicyAuthorizer(t *testing.T) {
+	backend := NewAuthBackend(NewMemoryBackend(), &testAuthenticator{
+		identity: &Identity{
+			Subject: "device",
+		},
+	})
+	backend.Authorizer = &WildcardPolicy{
+		MinimumLevels: 1,
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "device"
+	connect.Password = "secret"
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "#", QOS: 0},
+		{Topic: "foo/#", QOS: 0},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{packet.QOSFailure, 0}
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
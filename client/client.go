@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/256dpi/gomqtt/client/future"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/session"
+	"github.com/256dpi/gomqtt/topic"
 	"github.com/256dpi/gomqtt/transport"
 
 	"gopkg.in/tomb.v2"
@@ -46,6 +48,10 @@ var ErrClientExpectedConnack = errors.New("client expected connack")
 // failed when Config.ValidateSubs must be set to true.
 var ErrFailedSubscription = errors.New("failed subscription")
 
+// ErrUnsupportedOption is returned when a subscription sets an option that is
+// not supported by the protocol version.
+var ErrUnsupportedOption = errors.New("unsupported subscription option")
+
 // A Callback is a function called by the client upon received messages or
 // internal errors. An error can be returned if the callback is not already
 // called with an error to instantly close the client and prevent it from
@@ -70,7 +76,8 @@ const (
 
 // A Session is used to persist incoming and outgoing packets.
 type Session interface {
-	// NextID will return the next id for outgoing packets.
+	// NextID will return the next id for outgoing packets. Zero should be
+	// returned if all ids are in use.
 	NextID() packet.ID
 
 	// SavePacket will store a packet in the session. An eventual existing
@@ -91,6 +98,21 @@ type Session interface {
 	Reset() error
 }
 
+// An InspectableSession is a Session that can be inspected without copying
+// its packets, e.g. for diagnostics. The MemorySession and WALSession of the
+// session package implement this interface.
+type InspectableSession interface {
+	Session
+
+	// CountPackets will return the number of packets currently saved in the
+	// session.
+	CountPackets(session.Direction) (int, error)
+
+	// IteratePackets will call the function with all packets currently saved
+	// in the session until it returns false.
+	IteratePackets(session.Direction, func(packet.Generic) bool) error
+}
+
 // A Client connects to a broker and handles the transmission of packets. It will
 // automatically send PingreqPackets to keep the connection alive. Outgoing
 // publish related packets will be stored in session and resent when the
@@ -125,6 +147,8 @@ type Client struct {
 	tracker       *Tracker
 	futureStore   *future.Store
 	connectFuture *future.Future
+	subscriptions *topic.Tree
+	streams       *streams
 
 	tomb   tomb.Tomb
 	mutex  sync.Mutex
@@ -134,9 +158,11 @@ type Client struct {
 // New returns a new client that by default uses a fresh MemorySession.
 func New() *Client {
 	return &Client{
-		state:       clientInitialized,
-		Session:     session.NewMemorySession(),
-		futureStore: future.NewStore(),
+		state:         clientInitialized,
+		Session:       session.NewMemorySession(),
+		futureStore:   future.NewStore(),
+		subscriptions: topic.NewTree(),
+		streams:       newStreams(),
 	}
 }
 
@@ -206,6 +232,7 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 	if c.clean {
 		err = c.Session.Reset()
 		if err != nil {
+			c.streams.close()
 			return nil, c.cleanup(err, true, false)
 		}
 	}
@@ -231,6 +258,7 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 	// send connect packet
 	err = c.send(connect, false)
 	if err != nil {
+		c.streams.close()
 		return nil, c.cleanup(err, false, false)
 	}
 
@@ -259,7 +287,8 @@ func (c *Client) Publish(topic string, payload []byte, qos packet.QOS, retain bo
 
 // PublishMessage will send a Publish containing the passed message. It will
 // return a PublishFuture that gets completed once the quality of service flow
-// has been completed.
+// has been completed. session.ErrNoFreeID is returned if all packet ids are in
+// use. The call may be retried once inflight packets have been acknowledged.
 func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -276,6 +305,9 @@ func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 	// set packet id
 	if msg.QOS > 0 {
 		publish.ID = c.Session.NextID()
+		if publish.ID == 0 {
+			return nil, session.ErrNoFreeID
+		}
 	}
 
 	// create future
@@ -316,9 +348,25 @@ func (c *Client) Subscribe(topic string, qos packet.QOS) (SubscribeFuture, error
 	})
 }
 
+// SubscribeWith will send a Subscribe packet containing the subscription. It
+// will return a SubscribeFuture that gets completed once a Suback packet has
+// been received. ErrUnsupportedOption is returned if the subscription sets an
+// MQTT 5 option.
+func (c *Client) SubscribeWith(subscription Subscription) (SubscribeFuture, error) {
+	// convert subscription
+	sub, err := subscription.convert()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SubscribeMultiple([]packet.Subscription{sub})
+}
+
 // SubscribeMultiple will send a Subscribe packet containing multiple topics to
-// subscribe. It will return a SubscribeFuture that gets completed once a
-// Suback packet has been received.
+// subscribe. It will return a SubscribeFuture that gets completed once a Suback
+// packet has been received. session.ErrNoFreeID is returned if all packet ids
+// are in use. The call may be retried once inflight packets have been
+// acknowledged.
 func (c *Client) SubscribeMultiple(subscriptions []packet.Subscription) (SubscribeFuture, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -333,8 +381,14 @@ func (c *Client) SubscribeMultiple(subscriptions []packet.Subscription) (Subscri
 	subscribe.ID = c.Session.NextID()
 	subscribe.Subscriptions = subscriptions
 
+	// check packet id
+	if subscribe.ID == 0 {
+		return nil, session.ErrNoFreeID
+	}
+
 	// create future
 	subFuture := future.New()
+	subFuture.Data.Store(subscriptionsKey, subscriptions)
 
 	// store future
 	c.futureStore.Put(subscribe.ID, subFuture)
@@ -358,9 +412,11 @@ func (c *Client) Unsubscribe(topic string) (GenericFuture, error) {
 	return c.UnsubscribeMultiple([]string{topic})
 }
 
-// UnsubscribeMultiple will send a Unsubscribe packet containing multiple
-// topics to unsubscribe. It will return a UnsubscribeFuture that gets completed
-// once an Unsuback packet has been received.
+// UnsubscribeMultiple will send a Unsubscribe packet containing multiple topics
+// to unsubscribe. It will return a UnsubscribeFuture that gets completed once
+// an Unsuback packet has been received. session.ErrNoFreeID is returned if all
+// packet ids are in use. The call may be retried once inflight packets have
+// been acknowledged.
 func (c *Client) UnsubscribeMultiple(topics []string) (GenericFuture, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -375,8 +431,14 @@ func (c *Client) UnsubscribeMultiple(topics []string) (GenericFuture, error) {
 	unsubscribe.Topics = topics
 	unsubscribe.ID = c.Session.NextID()
 
+	// check packet id
+	if unsubscribe.ID == 0 {
+		return nil, session.ErrNoFreeID
+	}
+
 	// create future
 	unsubscribeFuture := future.New()
+	unsubscribeFuture.Data.Store(topicsKey, topics)
 
 	// store future
 	c.futureStore.Put(unsubscribe.ID, unsubscribeFuture)
@@ -390,6 +452,68 @@ func (c *Client) UnsubscribeMultiple(topics []string) (GenericFuture, error) {
 	return unsubscribeFuture, nil
 }
 
+// Messages will return a channel that receives the incoming messages that match
+// the filter. The optional parameter size specifies the capacity of the channel,
+// which defaults to 100. Incoming packets are not processed while the channel
+// is full. The channel is closed once the client has been disconnected.
+//
+// Note: The filter does not subscribe the client. Messages are received in
+// addition to the Callback and must not be modified.
+func (c *Client) Messages(filter string, size ...int) <-chan *packet.Message {
+	return c.streams.add(filter, size)
+}
+
+// ListSubscriptions will return the subscriptions that have been acknowledged
+// by the broker sorted by their topic. The QOS level of the subscriptions is
+// the level granted by the broker.
+func (c *Client) ListSubscriptions() []packet.Subscription {
+	// get all subscriptions
+	items := c.subscriptions.All()
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(items))
+	for _, v := range items {
+		subs = append(subs, v.(packet.Subscription))
+	}
+
+	// sort subscriptions
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Topic < subs[j].Topic
+	})
+
+	return subs
+}
+
+// UnsubscribeAll will send a Unsubscribe packet containing the topics of all
+// acknowledged subscriptions. It will return a GenericFuture that gets
+// completed once an Unsuback packet has been received or immediately if there
+// are no subscriptions.
+func (c *Client) UnsubscribeAll() (GenericFuture, error) {
+	// get subscriptions
+	subs := c.ListSubscriptions()
+
+	// return completed future if empty
+	if len(subs) == 0 {
+		// check if connected
+		if atomic.LoadUint32(&c.state) != clientConnected {
+			return nil, ErrClientNotConnected
+		}
+
+		f := future.New()
+		f.Complete()
+
+		return f, nil
+	}
+
+	// prepare topics
+	topics := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		topics = append(topics, sub.Topic)
+	}
+
+	return c.UnsubscribeMultiple(topics)
+}
+
 // Disconnect will send a Disconnect packet and close the connection.
 //
 // If a timeout is specified, the client will wait the specified amount of time
@@ -436,6 +560,9 @@ func (c *Client) Close() error {
 
 // processes incoming packets
 func (c *Client) processor() error {
+	// close streams once done
+	defer c.streams.close()
+
 	first := true
 
 	// start keep alive if greater than zero
@@ -582,6 +709,16 @@ func (c *Client) processSuback(suback *packet.Suback) error {
 		}
 	}
 
+	// save granted subscriptions
+	if value, ok := subscribeFuture.Data.Load(subscriptionsKey); ok {
+		for i, sub := range value.([]packet.Subscription) {
+			if i < len(suback.ReturnCodes) && suback.ReturnCodes[i] != packet.QOSFailure {
+				sub.QOS = suback.ReturnCodes[i]
+				c.subscriptions.Set(sub.Topic, sub)
+			}
+		}
+	}
+
 	// complete future
 	subscribeFuture.Data.Store(returnCodesKey, suback.ReturnCodes)
 	subscribeFuture.Complete()
@@ -603,6 +740,13 @@ func (c *Client) processUnsuback(unsuback *packet.Unsuback) error {
 		return nil // ignore a wrongly sent Unsuback packet
 	}
 
+	// remove subscriptions
+	if value, ok := unsubscribeFuture.Data.Load(topicsKey); ok {
+		for _, name := range value.([]string) {
+			c.subscriptions.Empty(name)
+		}
+	}
+
 	// complete future
 	unsubscribeFuture.Complete()
 
@@ -616,6 +760,12 @@ func (c *Client) processUnsuback(unsuback *packet.Unsuback) error {
 func (c *Client) processPublish(publish *packet.Publish) error {
 	// call callback for unacknowledged and directly acknowledged messages
 	if publish.Message.QOS <= 1 {
+		// dispatch message, the message is not acknowledged if the client
+		// is closed in the meantime
+		if !c.streams.dispatch(&publish.Message, c.tomb.Dying()) {
+			return nil
+		}
+
 		if c.Callback != nil {
 			err := c.Callback(&publish.Message, nil)
 			if err != nil {
@@ -717,6 +867,12 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return nil // ignore a wrongly sent Pubrel packet
 	}
 
+	// dispatch message, the message is not acknowledged if the client is
+	// closed in the meantime
+	if !c.streams.dispatch(&publish.Message, c.tomb.Dying()) {
+		return nil
+	}
+
 	// call callback
 	if c.Callback != nil {
 		err = c.Callback(&publish.Message, nil)
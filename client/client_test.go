@@ -3,6 +3,7 @@ package client
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -172,6 +173,11 @@ func TestClientConnectWithCredentials(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestInspectableSession(t *testing.T) {
+	var _ InspectableSession = session.NewMemorySession()
+	var _ InspectableSession = &session.WALSession{}
+}
+
 func TestClientNotConnected(t *testing.T) {
 	c := New()
 	c.Callback = errorCallback(t)
@@ -195,6 +201,72 @@ func TestClientNotConnected(t *testing.T) {
 	assert.Equal(t, ErrClientNotConnected, err)
 }
 
+func TestClientSubscribeWithUnsupportedOption(t *testing.T) {
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = errorCallback(t)
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	subscribeFuture, err := c.SubscribeWith(Subscription{Topic: "test", NoLocal: true})
+	assert.Nil(t, subscribeFuture)
+	assert.Equal(t, ErrUnsupportedOption, err)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestClientNoFreeID(t *testing.T) {
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = errorCallback(t)
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	// use all ids
+	sess := c.Session.(*session.MemorySession)
+	for i := 0; i < math.MaxUint16; i++ {
+		sess.NextID()
+	}
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.Nil(t, publishFuture)
+	assert.Equal(t, session.ErrNoFreeID, err)
+
+	subscribeFuture, err := c.Subscribe("test", 0)
+	assert.Nil(t, subscribeFuture)
+	assert.Equal(t, session.ErrNoFreeID, err)
+
+	unsubscribeFuture, err := c.Unsubscribe("test")
+	assert.Nil(t, unsubscribeFuture)
+	assert.Equal(t, session.ErrNoFreeID, err)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
 func TestClientConnectionDenied(t *testing.T) {
 	connack := connackPacket()
 	connack.ReturnCode = packet.NotAuthorized
@@ -573,6 +645,86 @@ func TestClientPublishSubscribeQOS2(t *testing.T) {
 	assert.Equal(t, 0, len(out))
 }
 
+func TestClientMessages(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "#", QOS: 1}}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{1}
+	suback.ID = 1
+
+	publish1 := packet.NewPublish()
+	publish1.Message.Topic = "foo/bar"
+	publish1.Message.Payload = []byte("foo")
+
+	publish2 := packet.NewPublish()
+	publish2.Message.Topic = "bar"
+	publish2.Message.Payload = []byte("bar")
+	publish2.Message.QOS = 1
+	publish2.ID = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(publish1).
+		Send(publish2).
+		Receive(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		return nil
+	}
+
+	foo := c.Messages("foo/+")
+	all := c.Messages("#", 1)
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	subscribeFuture, err := c.Subscribe("#", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, subscribeFuture.Wait(1*time.Second))
+
+	msg := <-foo
+	assert.Equal(t, "foo/bar", msg.Topic)
+	assert.Equal(t, []byte("foo"), msg.Payload)
+
+	msg = <-all
+	assert.Equal(t, "foo/bar", msg.Topic)
+
+	msg = <-all
+	assert.Equal(t, "bar", msg.Topic)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	time.Sleep(50 * time.Millisecond)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	_, ok := <-foo
+	assert.False(t, ok)
+
+	_, ok = <-all
+	assert.False(t, ok)
+
+	_, ok = <-c.Messages("#")
+	assert.False(t, ok)
+}
+
 func TestClientUnsubscribe(t *testing.T) {
 	unsubscribe := packet.NewUnsubscribe()
 	unsubscribe.Topics = []string{"test"}
@@ -610,6 +762,72 @@ func TestClientUnsubscribe(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestClientUnsubscribeAll(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "foo", QOS: 2},
+		{Topic: "bar", QOS: 1},
+		{Topic: "baz", QOS: 0},
+	}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{1, packet.QOSFailure, 0}
+	suback.ID = 1
+
+	unsubscribe := packet.NewUnsubscribe()
+	unsubscribe.Topics = []string{"baz", "foo"}
+	unsubscribe.ID = 2
+
+	unsuback := packet.NewUnsuback()
+	unsuback.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(unsubscribe).
+		Send(unsuback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = errorCallback(t)
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.ValidateSubs = false
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+	assert.Empty(t, c.ListSubscriptions())
+
+	subscribeFuture, err := c.SubscribeMultiple(subscribe.Subscriptions)
+	assert.NoError(t, err)
+	assert.NoError(t, subscribeFuture.Wait(1*time.Second))
+	assert.Equal(t, []packet.Subscription{
+		{Topic: "baz", QOS: 0},
+		{Topic: "foo", QOS: 1},
+	}, c.ListSubscriptions())
+
+	unsubscribeFuture, err := c.UnsubscribeAll()
+	assert.NoError(t, err)
+	assert.NoError(t, unsubscribeFuture.Wait(1*time.Second))
+	assert.Empty(t, c.ListSubscriptions())
+
+	unsubscribeFuture, err = c.UnsubscribeAll()
+	assert.NoError(t, err)
+	assert.NoError(t, unsubscribeFuture.Wait(1*time.Second))
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
 func TestClientHardDisconnect(t *testing.T) {
 	connect := connectPacket()
 	connect.ClientID = "test"
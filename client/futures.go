@@ -42,6 +42,8 @@ const (
 	sessionPresentKey futureKey = iota
 	returnCodeKey
 	returnCodesKey
+	subscriptionsKey
+	topicsKey
 )
 
 type connectFuture struct {
@@ -0,0 +1,674 @@
+// Package paho implements an adapter that provides the client API of the
+// eclipse/paho.mqtt.golang package on top of the gomqtt client. Existing
+// applications can be migrated by replacing the import of the paho package:
+//
+//	import mqtt "github.com/256dpi/gomqtt/client/paho"
+//
+// The adapter is based on a client.Service, which handles reconnects and
+// resubscribes the subscriptions after reconnecting.
+package paho
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrNotConnected is returned by tokens if the client is not connected.
+var ErrNotConnected = errors.New("not connected")
+
+// ErrMissingBroker is returned by the connect token if no broker has been
+// added to the options.
+var ErrMissingBroker = errors.New("missing broker")
+
+// ErrInvalidPayload is returned by the publish token if the payload is not a
+// string, byte slice or bytes buffer.
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// A Message is a message received from the broker.
+type Message interface {
+	Duplicate() bool
+	Qos() byte
+	Retained() bool
+	Topic() string
+	MessageID() uint16
+	Payload() []byte
+	Ack()
+}
+
+type message struct {
+	msg *packet.Message
+}
+
+func (m *message) Duplicate() bool {
+	return false
+}
+
+func (m *message) Qos() byte {
+	return byte(m.msg.QOS)
+}
+
+func (m *message) Retained() bool {
+	return m.msg.Retain
+}
+
+func (m *message) Topic() string {
+	return m.msg.Topic
+}
+
+func (m *message) MessageID() uint16 {
+	return 0
+}
+
+func (m *message) Payload() []byte {
+	return m.msg.Payload
+}
+
+// Ack is a no-op as messages are acknowledged once the handler returns.
+func (m *message) Ack() {}
+
+// A MessageHandler is called with messages received from the broker.
+type MessageHandler func(Client, Message)
+
+// An OnConnectHandler is called when the client has connected.
+type OnConnectHandler func(Client)
+
+// A ConnectionLostHandler is called when the connection has been lost.
+type ConnectionLostHandler func(Client, error)
+
+// A Token tracks the completion of an action.
+type Token interface {
+	// Wait will wait until the action has completed and returns true.
+	Wait() bool
+
+	// WaitTimeout will wait until the action has completed or the timeout has
+	// been reached and returns whether the action has completed.
+	WaitTimeout(time.Duration) bool
+
+	// Done returns a channel that is closed once the action has completed.
+	Done() <-chan struct{}
+
+	// Error returns the error of a completed action.
+	Error() error
+}
+
+type token struct {
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+func newToken() *token {
+	return &token{
+		done: make(chan struct{}),
+	}
+}
+
+func errorToken(err error) *token {
+	t := newToken()
+	t.complete(err)
+	return t
+}
+
+func futureToken(future client.GenericFuture) *token {
+	// create token
+	t := newToken()
+
+	// complete token with future
+	go func() {
+		t.complete(future.Wait(math.MaxInt64))
+	}()
+
+	return t
+}
+
+func (t *token) complete(err error) {
+	t.once.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *token) WaitTimeout(timeout time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (t *token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// ClientOptions configures a client.
+type ClientOptions struct {
+	Servers               []*url.URL
+	ClientID              string
+	Username              string
+	Password              string
+	CleanSession          bool
+	KeepAlive             time.Duration
+	ConnectTimeout        time.Duration
+	AutoReconnect         bool
+	MaxReconnectInterval  time.Duration
+	WillEnabled           bool
+	WillTopic             string
+	WillPayload           []byte
+	WillQos               byte
+	WillRetained          bool
+	DefaultPublishHandler MessageHandler
+	OnConnect             OnConnectHandler
+	OnConnectionLost      ConnectionLostHandler
+
+	// The dialer used to connect to the broker. This option is not available
+	// in the paho package.
+	Dialer client.Dialer
+}
+
+// NewClientOptions returns new options with the defaults of the paho package.
+func NewClientOptions() *ClientOptions {
+	return &ClientOptions{
+		CleanSession:         true,
+		KeepAlive:            30 * time.Second,
+		ConnectTimeout:       30 * time.Second,
+		AutoReconnect:        true,
+		MaxReconnectInterval: 10 * time.Minute,
+	}
+}
+
+// AddBroker will add a broker URL. The "ssl" scheme is mapped to "tls".
+//
+// Note: Only the first broker is used.
+func (o *ClientOptions) AddBroker(server string) *ClientOptions {
+	if u, err := url.Parse(server); err == nil {
+		o.Servers = append(o.Servers, u)
+	}
+
+	return o
+}
+
+// SetClientID will set the client id.
+func (o *ClientOptions) SetClientID(id string) *ClientOptions {
+	o.ClientID = id
+	return o
+}
+
+// SetUsername will set the username.
+func (o *ClientOptions) SetUsername(username string) *ClientOptions {
+	o.Username = username
+	return o
+}
+
+// SetPassword will set the password.
+func (o *ClientOptions) SetPassword(password string) *ClientOptions {
+	o.Password = password
+	return o
+}
+
+// SetCleanSession will set whether a clean session is requested.
+func (o *ClientOptions) SetCleanSession(clean bool) *ClientOptions {
+	o.CleanSession = clean
+	return o
+}
+
+// SetKeepAlive will set the keep alive interval.
+func (o *ClientOptions) SetKeepAlive(keepAlive time.Duration) *ClientOptions {
+	o.KeepAlive = keepAlive
+	return o
+}
+
+// SetConnectTimeout will set the timeout of connection attempts.
+func (o *ClientOptions) SetConnectTimeout(timeout time.Duration) *ClientOptions {
+	o.ConnectTimeout = timeout
+	return o
+}
+
+// SetAutoReconnect will set whether the client reconnects after the connection
+// has been lost.
+func (o *ClientOptions) SetAutoReconnect(reconnect bool) *ClientOptions {
+	o.AutoReconnect = reconnect
+	return o
+}
+
+// SetMaxReconnectInterval will set the maximum delay between reconnects.
+func (o *ClientOptions) SetMaxReconnectInterval(interval time.Duration) *ClientOptions {
+	o.MaxReconnectInterval = interval
+	return o
+}
+
+// SetWill will set the last will of the client.
+func (o *ClientOptions) SetWill(topic, payload string, qos byte, retained bool) *ClientOptions {
+	return o.SetBinaryWill(topic, []byte(payload), qos, retained)
+}
+
+// SetBinaryWill will set the last will of the client.
+func (o *ClientOptions) SetBinaryWill(topic string, payload []byte, qos byte, retained bool) *ClientOptions {
+	o.WillEnabled = true
+	o.WillTopic = topic
+	o.WillPayload = payload
+	o.WillQos = qos
+	o.WillRetained = retained
+	return o
+}
+
+// SetDefaultPublishHandler will set the handler that is called with messages
+// that do not match a route.
+func (o *ClientOptions) SetDefaultPublishHandler(handler MessageHandler) *ClientOptions {
+	o.DefaultPublishHandler = handler
+	return o
+}
+
+// SetOnConnectHandler will set the handler that is called when the client has
+// connected.
+func (o *ClientOptions) SetOnConnectHandler(handler OnConnectHandler) *ClientOptions {
+	o.OnConnect = handler
+	return o
+}
+
+// SetConnectionLostHandler will set the handler that is called when the
+// connection has been lost.
+func (o *ClientOptions) SetConnectionLostHandler(handler ConnectionLostHandler) *ClientOptions {
+	o.OnConnectionLost = handler
+	return o
+}
+
+// SetDialer will set the dialer used to connect to the broker.
+func (o *ClientOptions) SetDialer(dialer client.Dialer) *ClientOptions {
+	o.Dialer = dialer
+	return o
+}
+
+// ClientOptionsReader provides read access to the options of a client.
+type ClientOptionsReader struct {
+	options *ClientOptions
+}
+
+// Servers returns the broker URLs.
+func (r ClientOptionsReader) Servers() []*url.URL {
+	return r.options.Servers
+}
+
+// ClientID returns the client id.
+func (r ClientOptionsReader) ClientID() string {
+	return r.options.ClientID
+}
+
+// Username returns the username.
+func (r ClientOptionsReader) Username() string {
+	return r.options.Username
+}
+
+// Password returns the password.
+func (r ClientOptionsReader) Password() string {
+	return r.options.Password
+}
+
+// CleanSession returns whether a clean session is requested.
+func (r ClientOptionsReader) CleanSession() bool {
+	return r.options.CleanSession
+}
+
+// KeepAlive returns the keep alive interval.
+func (r ClientOptionsReader) KeepAlive() time.Duration {
+	return r.options.KeepAlive
+}
+
+// AutoReconnect returns whether the client reconnects.
+func (r ClientOptionsReader) AutoReconnect() bool {
+	return r.options.AutoReconnect
+}
+
+// Client is the client interface of the paho package.
+type Client interface {
+	IsConnected() bool
+	IsConnectionOpen() bool
+	Connect() Token
+	Disconnect(quiesce uint)
+	Publish(topic string, qos byte, retained bool, payload interface{}) Token
+	Subscribe(topic string, qos byte, callback MessageHandler) Token
+	SubscribeMultiple(filters map[string]byte, callback MessageHandler) Token
+	Unsubscribe(topics ...string) Token
+	AddRoute(topic string, callback MessageHandler)
+	OptionsReader() ClientOptionsReader
+}
+
+type route struct {
+	handler MessageHandler
+}
+
+type adapter struct {
+	options ClientOptions
+	routes  *topic.Tree
+
+	service *client.Service
+	connect *token
+	online  bool
+	err     error
+	mutex   sync.Mutex
+}
+
+// NewClient returns a new client that uses the specified options.
+func NewClient(o *ClientOptions) Client {
+	return &adapter{
+		options: *o,
+		routes:  topic.NewTree(),
+	}
+}
+
+// IsConnected returns whether the client is connected or reconnecting.
+func (a *adapter) IsConnected() bool {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.online || (a.service != nil && a.options.AutoReconnect && a.connect.Error() == nil)
+}
+
+// IsConnectionOpen returns whether the client is connected.
+func (a *adapter) IsConnectionOpen() bool {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.online
+}
+
+// Connect will start connecting to the first broker. The returned token fails
+// if the first connection attempt fails.
+func (a *adapter) Connect() Token {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// return current token if already started
+	if a.service != nil {
+		return a.connect
+	}
+
+	// prepare config
+	config, err := a.config()
+	if err != nil {
+		return errorToken(err)
+	}
+
+	// create service
+	s := client.NewService()
+	s.ConnectTimeout = a.options.ConnectTimeout
+	s.MaxReconnectDelay = a.options.MaxReconnectInterval
+	s.OnlineCallback = a.onOnline
+	s.OfflineCallback = a.onOffline
+	s.ErrorCallback = a.onError
+	s.MessageCallback = a.onMessage
+
+	// set state
+	a.service = s
+	a.connect = newToken()
+	a.err = nil
+
+	// start service
+	s.Start(config)
+
+	return a.connect
+}
+
+// Disconnect will disconnect from the broker and wait up to the specified
+// amount of milliseconds for pending actions to complete.
+func (a *adapter) Disconnect(quiesce uint) {
+	// acquire mutex
+	a.mutex.Lock()
+	s := a.service
+	a.service = nil
+	a.online = false
+	a.mutex.Unlock()
+
+	// stop service
+	if s != nil {
+		s.DisconnectTimeout = time.Duration(quiesce) * time.Millisecond
+		s.Stop(true)
+	}
+}
+
+// Publish will publish a message. The payload must be a string, byte slice or
+// bytes buffer.
+func (a *adapter) Publish(topic string, qos byte, retained bool, payload interface{}) Token {
+	// get payload
+	var data []byte
+	switch p := payload.(type) {
+	case string:
+		data = []byte(p)
+	case []byte:
+		data = p
+	case bytes.Buffer:
+		data = p.Bytes()
+	case *bytes.Buffer:
+		data = p.Bytes()
+	default:
+		return errorToken(ErrInvalidPayload)
+	}
+
+	// get service
+	s := a.get()
+	if s == nil {
+		return errorToken(ErrNotConnected)
+	}
+
+	return futureToken(s.Publish(topic, data, packet.QOS(qos), retained))
+}
+
+// Subscribe will subscribe the topic and add a route if a callback is set.
+func (a *adapter) Subscribe(topic string, qos byte, callback MessageHandler) Token {
+	return a.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+// SubscribeMultiple will subscribe the topics and add routes if a callback is
+// set.
+func (a *adapter) SubscribeMultiple(filters map[string]byte, callback MessageHandler) Token {
+	// get service
+	s := a.get()
+	if s == nil {
+		return errorToken(ErrNotConnected)
+	}
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(filters))
+	for filter, qos := range filters {
+		subs = append(subs, packet.Subscription{Topic: filter, QOS: packet.QOS(qos)})
+
+		// add route
+		if callback != nil {
+			a.routes.Set(filter, &route{handler: callback})
+		}
+	}
+
+	return futureToken(s.SubscribeMultiple(subs))
+}
+
+// Unsubscribe will unsubscribe the topics and remove their routes.
+func (a *adapter) Unsubscribe(topics ...string) Token {
+	// get service
+	s := a.get()
+	if s == nil {
+		return errorToken(ErrNotConnected)
+	}
+
+	// remove routes
+	for _, filter := range topics {
+		a.routes.Empty(filter)
+	}
+
+	return futureToken(s.UnsubscribeMultiple(topics))
+}
+
+// AddRoute will add a route without subscribing the topic.
+func (a *adapter) AddRoute(topic string, callback MessageHandler) {
+	a.routes.Set(topic, &route{handler: callback})
+}
+
+// OptionsReader returns a reader for the options of the client.
+func (a *adapter) OptionsReader() ClientOptionsReader {
+	return ClientOptionsReader{options: &a.options}
+}
+
+func (a *adapter) get() *client.Service {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.service
+}
+
+func (a *adapter) config() (*client.Config, error) {
+	// check servers
+	if len(a.options.Servers) == 0 {
+		return nil, ErrMissingBroker
+	}
+
+	// copy url
+	u := *a.options.Servers[0]
+
+	// map scheme
+	if u.Scheme == "ssl" {
+		u.Scheme = "tls"
+	}
+
+	// set credentials
+	if a.options.Username != "" {
+		u.User = url.UserPassword(a.options.Username, a.options.Password)
+	}
+
+	// prepare config
+	config := client.NewConfigWithClientID(u.String(), a.options.ClientID)
+	config.CleanSession = a.options.CleanSession
+	config.KeepAlive = a.options.KeepAlive.String()
+	config.ValidateSubs = false
+	config.Dialer = a.options.Dialer
+
+	// set will
+	if a.options.WillEnabled {
+		config.WillMessage = &packet.Message{
+			Topic:   a.options.WillTopic,
+			Payload: a.options.WillPayload,
+			QOS:     packet.QOS(a.options.WillQos),
+			Retain:  a.options.WillRetained,
+		}
+	}
+
+	return config, nil
+}
+
+func (a *adapter) onOnline(_ bool) {
+	// set state
+	a.mutex.Lock()
+	a.online = true
+	connect := a.connect
+	a.mutex.Unlock()
+
+	// complete token
+	connect.complete(nil)
+
+	// call handler asynchronously as it may wait on tokens
+	if a.options.OnConnect != nil {
+		go a.options.OnConnect(a)
+	}
+}
+
+func (a *adapter) onOffline() {
+	// set state
+	a.mutex.Lock()
+	wasOnline := a.online
+	a.online = false
+	err := a.err
+	s := a.service
+	a.mutex.Unlock()
+
+	// ignore if not connected before or disconnected
+	if !wasOnline || s == nil {
+		return
+	}
+
+	// stop service if reconnects are disabled
+	if !a.options.AutoReconnect {
+		a.stop(s)
+	}
+
+	// call handler asynchronously as it may wait on tokens
+	if a.options.OnConnectionLost != nil {
+		go a.options.OnConnectionLost(a, err)
+	}
+}
+
+func (a *adapter) onError(err error) {
+	// save error
+	a.mutex.Lock()
+	a.err = err
+	online := a.online
+	connect := a.connect
+	s := a.service
+	a.mutex.Unlock()
+
+	// fail connect token and stop service if the first attempt failed
+	if !online && s != nil && connect.Error() == nil {
+		select {
+		case <-connect.Done():
+		default:
+			connect.complete(err)
+			a.stop(s)
+		}
+	}
+}
+
+func (a *adapter) onMessage(msg *packet.Message) error {
+	// get handlers
+	values := a.routes.Match(msg.Topic)
+
+	// call default handler if no route matches
+	if len(values) == 0 {
+		if a.options.DefaultPublishHandler != nil {
+			a.options.DefaultPublishHandler(a, &message{msg: msg})
+		}
+
+		return nil
+	}
+
+	// call handlers
+	for _, value := range values {
+		value.(*route).handler(a, &message{msg: msg})
+	}
+
+	return nil
+}
+
+func (a *adapter) stop(s *client.Service) {
+	// clear service
+	a.mutex.Lock()
+	if a.service == s {
+		a.service = nil
+	}
+	a.mutex.Unlock()
+
+	// stop service asynchronously as callbacks are called by the service
+	go s.Stop(true)
+}
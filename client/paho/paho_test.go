@@ -0,0 +1,109 @@
+package paho
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPublishSubscribe(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	defer broker.Close()
+
+	connected := make(chan struct{})
+	received := make(chan Message, 2)
+	fallback := make(chan Message, 1)
+
+	o := NewClientOptions().
+		AddBroker("tcp://testutil").
+		SetClientID("paho").
+		SetDialer(broker).
+		SetOnConnectHandler(func(c Client) {
+			close(connected)
+		}).
+		SetDefaultPublishHandler(func(c Client, msg Message) {
+			fallback <- msg
+		})
+
+	c := NewClient(o)
+	assert.False(t, c.IsConnected())
+	assert.Equal(t, ErrNotConnected, c.Publish("foo", 0, false, "bar").Error())
+
+	token := c.Connect()
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+	assert.True(t, c.IsConnected())
+	assert.True(t, c.IsConnectionOpen())
+	assert.Equal(t, "paho", c.OptionsReader().ClientID())
+
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("missing connect")
+	}
+
+	token = c.Subscribe("foo/+", 1, func(c Client, msg Message) {
+		received <- msg
+	})
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+
+	token = c.Subscribe("baz", 0, nil)
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+
+	token = c.Publish("foo/1", 1, false, []byte("hello"))
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "foo/1", msg.Topic())
+		assert.Equal(t, []byte("hello"), msg.Payload())
+		assert.Equal(t, byte(1), msg.Qos())
+		assert.False(t, msg.Retained())
+	case <-time.After(time.Second):
+		t.Fatal("missing message")
+	}
+
+	token = c.Publish("baz", 0, false, "world")
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+
+	select {
+	case msg := <-fallback:
+		assert.Equal(t, "baz", msg.Topic())
+		assert.Equal(t, []byte("world"), msg.Payload())
+	case <-time.After(time.Second):
+		t.Fatal("missing message")
+	}
+
+	assert.Equal(t, ErrInvalidPayload, c.Publish("foo/1", 0, false, 42).Error())
+
+	token = c.Unsubscribe("foo/+")
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.NoError(t, token.Error())
+
+	c.Disconnect(100)
+	assert.False(t, c.IsConnected())
+	assert.False(t, c.IsConnectionOpen())
+}
+
+func TestClientConnectError(t *testing.T) {
+	broker := testutil.NewBroker(nil, nil)
+	broker.Close()
+
+	c := NewClient(NewClientOptions().AddBroker("tcp://testutil").SetDialer(broker))
+
+	token := c.Connect()
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.Equal(t, testutil.ErrBrokerClosed, token.Error())
+	assert.False(t, c.IsConnected())
+
+	token = NewClient(NewClientOptions()).Connect()
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.Equal(t, ErrMissingBroker, token.Error())
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -16,6 +17,10 @@ import (
 	"gopkg.in/tomb.v2"
 )
 
+// ErrReconnectLimitReached is passed to the TerminalCallback if the service
+// gives up reconnecting.
+var ErrReconnectLimitReached = errors.New("reconnect limit reached")
+
 type command struct {
 	publish     bool
 	subscribe   bool
@@ -53,6 +58,14 @@ type ErrorCallback func(error)
 // means that waiting on a future inside the callback will deadlock the service.
 type OfflineCallback func()
 
+// A QueueFullCallback is a function that is called when a message is dropped
+// because the command queue is full.
+type QueueFullCallback func(*packet.Message)
+
+// A TerminalCallback is a function that is called when the service has given up
+// reconnecting and stopped itself.
+type TerminalCallback func(error)
+
 const (
 	serviceStarted uint32 = iota
 	serviceStopped
@@ -86,6 +99,12 @@ type Service struct {
 	// The callback that is used to notify that the service is offline.
 	OfflineCallback OfflineCallback
 
+	// The callback that is called when a published message is dropped because
+	// the command queue is full. If set, messages are dropped instead of
+	// blocking Publish until the queue has space again. The futures of
+	// dropped messages are canceled.
+	QueueFullCallback QueueFullCallback
+
 	// The logger that is used to log write low level information like packets
 	// that have ben successfully sent and received, details about the
 	// automatic keep alive handler, reconnection and occurring errors.
@@ -101,6 +120,19 @@ type Service struct {
 	// Note: The value must be changed before calling Start.
 	MaxReconnectDelay time.Duration
 
+	// The maximum number of consecutive failed connection attempts after which
+	// the service gives up and stops. Zero means no limit.
+	MaxReconnectAttempts int
+
+	// The maximum duration since the first of consecutive failed connection
+	// attempts after which the service gives up and stops. Zero means no
+	// limit.
+	MaxReconnectDuration time.Duration
+
+	// The callback that is called when the service has given up reconnecting.
+	// All futures are canceled and the service can be started again.
+	TerminalCallback TerminalCallback
+
 	// The allowed timeout until a connection attempt is canceled.
 	ConnectTimeout time.Duration
 
@@ -118,6 +150,7 @@ type Service struct {
 
 	backoff       *backoff.Backoff
 	subscriptions *topic.Tree
+	streams       *streams
 	commandQueue  chan *command
 	futureStore   *future.Store
 
@@ -144,6 +177,7 @@ func NewService(queueSize ...int) *Service {
 		ResubscribeTimeout:          5 * time.Second,
 		ResubscribeAllSubscriptions: true,
 		subscriptions:               topic.NewTree(),
+		streams:                     newStreams(),
 		commandQueue:                make(chan *command, qs),
 		futureStore:                 future.NewStore(),
 	}
@@ -180,6 +214,9 @@ func (s *Service) Start(config *Config) {
 	// mark future store as protected
 	s.futureStore.Protect(true)
 
+	// open streams
+	s.streams.open()
+
 	// create new tomb
 	s.tomb = new(tomb.Tomb)
 
@@ -206,21 +243,52 @@ func (s *Service) Publish(topic string, payload []byte, qos packet.QOS, retain b
 // has been completed.
 func (s *Service) PublishMessage(msg *packet.Message) GenericFuture {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 
 	// allocate future
 	f := future.New()
 
-	// queue publish
-	s.commandQueue <- &command{
+	// prepare command
+	cmd := &command{
 		publish: true,
 		future:  f,
 		message: msg,
 	}
 
+	// queue publish and return if the queue may block
+	if s.QueueFullCallback == nil {
+		s.commandQueue <- cmd
+		s.mutex.Unlock()
+		return f
+	}
+
+	// queue publish or drop message if the queue is full
+	select {
+	case s.commandQueue <- cmd:
+		s.mutex.Unlock()
+	default:
+		s.mutex.Unlock()
+
+		// cancel future
+		f.Cancel()
+
+		// run callback
+		s.QueueFullCallback(msg)
+	}
+
 	return f
 }
 
+// QueueLength returns the number of commands that are queued up to be sent.
+func (s *Service) QueueLength() int {
+	return len(s.commandQueue)
+}
+
+// QueueCapacity returns the number of commands that can be queued up before
+// Publish blocks or drops messages.
+func (s *Service) QueueCapacity() int {
+	return cap(s.commandQueue)
+}
+
 // Subscribe will send a Subscribe packet containing one topic to subscribe. It
 // will return a SubscribeFuture that gets completed once the acknowledgements
 // have been received.
@@ -230,6 +298,20 @@ func (s *Service) Subscribe(topic string, qos packet.QOS) SubscribeFuture {
 	})
 }
 
+// SubscribeWith will send a Subscribe packet containing the subscription. It
+// will return a SubscribeFuture that gets completed once the acknowledgements
+// have been received. ErrUnsupportedOption is returned if the subscription
+// sets an MQTT 5 option.
+func (s *Service) SubscribeWith(subscription Subscription) (SubscribeFuture, error) {
+	// convert subscription
+	sub, err := subscription.convert()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.SubscribeMultiple([]packet.Subscription{sub}), nil
+}
+
 // SubscribeMultiple will send a Subscribe packet containing multiple topics to
 // subscribe. It will return a SubscribeFuture that gets completed once the
 // acknowledgements have been received.
@@ -287,6 +369,62 @@ func (s *Service) UnsubscribeMultiple(topics []string) GenericFuture {
 	return f
 }
 
+// Messages will return a channel that receives the incoming messages that match
+// the filter. The optional parameter size specifies the capacity of the channel,
+// which defaults to 100. Incoming packets are not processed while the channel
+// is full. The channel is closed once the service has been stopped.
+//
+// Note: The filter does not subscribe the service. Messages are received in
+// addition to the MessageCallback and must not be modified.
+func (s *Service) Messages(filter string, size ...int) <-chan *packet.Message {
+	return s.streams.add(filter, size)
+}
+
+// ListSubscriptions will return the subscriptions of the service sorted by their
+// topic. These are the subscriptions that are resubscribed after reconnecting.
+func (s *Service) ListSubscriptions() []packet.Subscription {
+	// get all subscriptions
+	items := s.subscriptions.All()
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(items))
+	for _, v := range items {
+		subs = append(subs, v.(packet.Subscription))
+	}
+
+	// sort subscriptions
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Topic < subs[j].Topic
+	})
+
+	return subs
+}
+
+// UnsubscribeAll will send a Unsubscribe packet containing the topics of all
+// subscriptions. It will return a GenericFuture that gets completed once the
+// acknowledgements have been received or immediately if there are no
+// subscriptions.
+func (s *Service) UnsubscribeAll() GenericFuture {
+	// get subscriptions
+	subs := s.ListSubscriptions()
+
+	// return completed future if empty
+	if len(subs) == 0 {
+		f := future.New()
+		f.Complete()
+
+		return f
+	}
+
+	// prepare topics
+	topics := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		topics = append(topics, sub.Topic)
+	}
+
+	return s.UnsubscribeMultiple(topics)
+}
+
 // Stop will disconnect the client if online and cancel all futures if requested.
 // After the service is stopped in can be started again.
 //
@@ -305,6 +443,9 @@ func (s *Service) Stop(clearFutures bool) {
 	s.tomb.Kill(nil)
 	s.tomb.Wait()
 
+	// close streams
+	s.streams.close()
+
 	// clear futures if requested
 	if clearFutures {
 		s.futureStore.Protect(false)
@@ -319,6 +460,10 @@ func (s *Service) Stop(clearFutures bool) {
 func (s *Service) supervisor() error {
 	first := true
 
+	// prepare failure tracking
+	var attempts int
+	var since time.Time
+
 	for {
 		if first {
 			// no delay on first attempt
@@ -343,17 +488,35 @@ func (s *Service) supervisor() error {
 
 		// try once to get a client
 		client, resumed := s.connect(fail)
-		if client == nil {
-			continue
-		}
+		ok := client != nil
 
 		// resubscribe
-		if s.ResubscribeAllSubscriptions {
-			if !s.resubscribe(client) {
-				continue
+		if ok && s.ResubscribeAllSubscriptions {
+			ok = s.resubscribe(client)
+		}
+
+		// handle failed attempt
+		if !ok {
+			// track failure
+			attempts++
+			if since.IsZero() {
+				since = time.Now()
 			}
+
+			// give up if a limit has been reached
+			if (s.MaxReconnectAttempts > 0 && attempts >= s.MaxReconnectAttempts) ||
+				(s.MaxReconnectDuration > 0 && time.Since(since) >= s.MaxReconnectDuration) {
+				s.terminate()
+				return nil
+			}
+
+			continue
 		}
 
+		// reset failure tracking
+		attempts = 0
+		since = time.Time{}
+
 		// run callback
 		if s.OnlineCallback != nil {
 			s.OnlineCallback(resumed)
@@ -382,17 +545,38 @@ func (s *Service) connect(fail chan struct{}) (*Client, bool) {
 	client.Logger = s.Logger
 	client.futureStore = s.futureStore
 
+	// the fail channel may be closed by a message error and a concurrent
+	// client error
+	var failOnce sync.Once
+	failed := func() {
+		failOnce.Do(func() {
+			close(fail)
+		})
+	}
+
 	// set callback
 	client.Callback = func(msg *packet.Message, err error) error {
 		if err != nil {
 			s.err("Client", err)
-			close(fail)
+			failed()
 			return nil
 		}
 
+		// dispatch message, the message is not acknowledged if the service
+		// is stopped in the meantime
+		if !s.streams.dispatch(msg, s.tomb.Dying()) {
+			return errDispatchCanceled
+		}
+
 		// call the handler
 		if s.MessageCallback != nil {
-			return s.MessageCallback(msg)
+			err = s.MessageCallback(msg)
+			if err != nil {
+				// the client closes without calling the callback again
+				s.err("Message", err)
+				failed()
+				return err
+			}
 		}
 
 		return nil
@@ -427,22 +611,11 @@ func (s *Service) connect(fail chan struct{}) (*Client, bool) {
 
 func (s *Service) resubscribe(client *Client) bool {
 	// get all subscriptions and return if empty
-	items := s.subscriptions.All()
-	if len(items) == 0 {
+	subs := s.ListSubscriptions()
+	if len(subs) == 0 {
 		return true
 	}
 
-	// prepare subscriptions
-	subs := make([]packet.Subscription, 0, len(items))
-	for _, v := range items {
-		subs = append(subs, v.(packet.Subscription))
-	}
-
-	// sort subscriptions
-	sort.Slice(subs, func(i, j int) bool {
-		return subs[i].Topic < subs[j].Topic
-	})
-
 	// resubscribe all subscriptions
 	subscribeFuture, err := client.SubscribeMultiple(subs)
 	if err != nil {
@@ -470,6 +643,26 @@ func (s *Service) resubscribe(client *Client) bool {
 	return true
 }
 
+// stops the service from within the supervisor
+func (s *Service) terminate() {
+	s.log("Reconnect Limit Reached")
+
+	// set state
+	atomic.StoreUint32(&s.state, serviceStopped)
+
+	// cancel futures
+	s.futureStore.Protect(false)
+	s.futureStore.Clear()
+
+	// close streams
+	s.streams.close()
+
+	// run callback
+	if s.TerminalCallback != nil {
+		s.TerminalCallback(ErrReconnectLimitReached)
+	}
+}
+
 // reads from the queues and calls the current client
 func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
 	for {
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/256dpi/gomqtt/client/future"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/transport/flow"
 
@@ -172,6 +174,14 @@ func TestStartStopVariations(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestServiceSubscribeWithUnsupportedOption(t *testing.T) {
+	s := NewService(1)
+
+	subscribeFuture, err := s.SubscribeWith(Subscription{Topic: "test", RetainHandling: DontSendRetained})
+	assert.Nil(t, subscribeFuture)
+	assert.Equal(t, ErrUnsupportedOption, err)
+}
+
 func TestServiceUnsubscribe(t *testing.T) {
 	unsubscribe := packet.NewUnsubscribe()
 	unsubscribe.Topics = []string{"test"}
@@ -217,6 +227,129 @@ func TestServiceUnsubscribe(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestServiceUnsubscribeAll(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "foo", QOS: 1},
+		{Topic: "bar", QOS: 0},
+	}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{1, 0}
+	suback.ID = 1
+
+	unsubscribe := packet.NewUnsubscribe()
+	unsubscribe.Topics = []string{"bar", "foo"}
+	unsubscribe.ID = 2
+
+	unsuback := packet.NewUnsuback()
+	unsuback.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(unsubscribe).
+		Send(unsuback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+
+	s.OnlineCallback = func(resumed bool) {
+		assert.False(t, resumed)
+
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+
+	assert.NoError(t, s.SubscribeMultiple(subscribe.Subscriptions).Wait(1*time.Second))
+	assert.Equal(t, []packet.Subscription{
+		{Topic: "bar", QOS: 0},
+		{Topic: "foo", QOS: 1},
+	}, s.ListSubscriptions())
+
+	assert.NoError(t, s.UnsubscribeAll().Wait(1*time.Second))
+	assert.Empty(t, s.ListSubscriptions())
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceMessages(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "test"}}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{0}
+	suback.ID = 1
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(publish).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	messages := s.Messages("test")
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+
+	assert.NoError(t, s.Subscribe("test", 0).Wait(1*time.Second))
+
+	msg := <-messages
+	assert.Equal(t, "test", msg.Topic)
+	assert.Equal(t, []byte("test"), msg.Payload)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+
+	_, ok := <-messages
+	assert.False(t, ok)
+}
+
 func TestServiceReconnect(t *testing.T) {
 	delay := flow.New().
 		Receive(connectPacket()).
@@ -268,6 +401,144 @@ func TestServiceReconnect(t *testing.T) {
 	assert.Equal(t, 4, i)
 }
 
+func TestServiceMaxReconnectAttempts(t *testing.T) {
+	done, port := fakeBroker(t)
+	safeReceive(done)
+
+	terminal := make(chan struct{})
+
+	s := NewService()
+	s.MinReconnectDelay = time.Millisecond
+	s.MaxReconnectDelay = 10 * time.Millisecond
+	s.MaxReconnectAttempts = 3
+
+	var errs int
+	s.ErrorCallback = func(err error) {
+		errs++
+	}
+
+	s.TerminalCallback = func(err error) {
+		assert.Equal(t, ErrReconnectLimitReached, err)
+		close(terminal)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(terminal)
+	assert.Equal(t, 3, errs)
+
+	s.Stop(true)
+}
+
+func TestServiceMaxReconnectDuration(t *testing.T) {
+	done, port := fakeBroker(t)
+	safeReceive(done)
+
+	terminal := make(chan struct{})
+
+	s := NewService()
+	s.MinReconnectDelay = 10 * time.Millisecond
+	s.MaxReconnectDelay = 10 * time.Millisecond
+	s.MaxReconnectDuration = 50 * time.Millisecond
+
+	s.TerminalCallback = func(err error) {
+		assert.Equal(t, ErrReconnectLimitReached, err)
+		close(terminal)
+	}
+
+	start := time.Now()
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(terminal)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	s.Stop(true)
+}
+
+func TestServiceQueueFull(t *testing.T) {
+	s := NewService(2)
+	assert.Equal(t, 0, s.QueueLength())
+	assert.Equal(t, 2, s.QueueCapacity())
+
+	var dropped []string
+	s.QueueFullCallback = func(msg *packet.Message) {
+		dropped = append(dropped, msg.Topic)
+	}
+
+	f1 := s.Publish("foo", nil, 0, false)
+	f2 := s.Publish("bar", nil, 0, false)
+	f3 := s.Publish("baz", nil, 0, false)
+	assert.Equal(t, 2, s.QueueLength())
+	assert.Equal(t, []string{"baz"}, dropped)
+
+	assert.Equal(t, future.ErrTimeout, f1.Wait(10*time.Millisecond))
+	assert.Equal(t, future.ErrTimeout, f2.Wait(10*time.Millisecond))
+	assert.Equal(t, future.ErrCanceled, f3.Wait(10*time.Millisecond))
+}
+
+func TestServiceMessageCallbackError(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.ID = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	fail := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(publish).
+		End()
+
+	redeliver := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(publish).
+		Receive(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, fail, redeliver)
+
+	errs := make(chan error, 1)
+	message := make(chan struct{})
+
+	s := NewService()
+
+	i := 0
+	s.MessageCallback = func(msg *packet.Message) error {
+		i++
+		if i == 1 {
+			return errors.New("failed")
+		}
+
+		close(message)
+		return nil
+	}
+
+	s.ErrorCallback = func(err error) {
+		if i == 1 {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	assert.Equal(t, "failed", (<-errs).Error())
+	safeReceive(message)
+
+	s.Stop(true)
+
+	safeReceive(done)
+
+	assert.Equal(t, 2, i)
+}
+
 func TestServiceResubscribe(t *testing.T) {
 	subscribe1 := packet.NewSubscribe()
 	subscribe1.Subscriptions = []packet.Subscription{{Topic: "overlap/#", QOS: 0}}
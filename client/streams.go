@@ -0,0 +1,103 @@
+package client
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// errDispatchCanceled is returned by the service message callback to prevent
+// the acknowledgment of a message that could not be dispatched.
+var errDispatchCanceled = errors.New("dispatch canceled")
+
+type stream struct {
+	messages chan *packet.Message
+}
+
+// streams dispatches messages to the channels returned by Messages. Messages
+// are only dispatched and the channels only closed by the goroutine that
+// processes incoming packets.
+type streams struct {
+	tree   *topic.Tree
+	closed bool
+	mutex  sync.Mutex
+}
+
+func newStreams() *streams {
+	return &streams{
+		tree: topic.NewTree(),
+	}
+}
+
+func (s *streams) add(filter string, size []int) <-chan *packet.Message {
+	// get size
+	n := 100
+	if len(size) > 0 {
+		n = size[0]
+	}
+
+	// create stream
+	st := &stream{
+		messages: make(chan *packet.Message, n),
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// close stream if closed
+	if s.closed {
+		close(st.messages)
+		return st.messages
+	}
+
+	// add stream
+	s.tree.Add(filter, st)
+
+	return st.messages
+}
+
+// dispatch will send the message to all matching streams. It will block if a
+// stream is full and return false if canceled in the meantime.
+func (s *streams) dispatch(msg *packet.Message, cancel <-chan struct{}) bool {
+	for _, value := range s.tree.Match(msg.Topic) {
+		select {
+		case value.(*stream).messages <- msg:
+		case <-cancel:
+			return false
+		}
+	}
+
+	return true
+}
+
+// open will allow adding streams after the streams have been closed.
+func (s *streams) open() {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// set flag
+	s.closed = false
+}
+
+// close will close and remove all streams. Added streams are closed
+// immediately until the streams are opened again.
+func (s *streams) close() {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// close streams
+	for _, value := range s.tree.All() {
+		close(value.(*stream).messages)
+	}
+
+	// reset tree
+	s.tree.Reset()
+
+	// set flag
+	s.closed = true
+}
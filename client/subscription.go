@@ -0,0 +1,51 @@
+package client
+
+import "github.com/256dpi/gomqtt/packet"
+
+// RetainHandling defines when retained messages are sent for a subscription.
+type RetainHandling byte
+
+const (
+	// SendRetained sends retained messages on every subscribe.
+	SendRetained RetainHandling = iota
+
+	// SendRetainedIfNew sends retained messages only if the subscription did
+	// not exist before.
+	SendRetainedIfNew
+
+	// DontSendRetained does not send retained messages.
+	DontSendRetained
+)
+
+// A Subscription describes a subscription together with its options.
+//
+// Note: The NoLocal, RetainAsPublished and RetainHandling options are defined
+// by MQTT 5. As the client implements MQTT 3.1.1, they cannot be encoded and
+// must be left unset.
+type Subscription struct {
+	// The topic to subscribe.
+	Topic string
+
+	// The requested maximum QOS level.
+	QOS packet.QOS
+
+	// Whether messages published by the client itself are not delivered.
+	NoLocal bool
+
+	// Whether the retain flag of forwarded messages is kept.
+	RetainAsPublished bool
+
+	// When retained messages are sent for the subscription.
+	RetainHandling RetainHandling
+}
+
+// convert returns the subscription that is sent on the wire. It returns
+// ErrUnsupportedOption if an MQTT 5 option is set.
+func (s Subscription) convert() (packet.Subscription, error) {
+	// check options
+	if s.NoLocal || s.RetainAsPublished || s.RetainHandling != SendRetained {
+		return packet.Subscription{}, ErrUnsupportedOption
+	}
+
+	return packet.Subscription{Topic: s.Topic, QOS: s.QOS}, nil
+}
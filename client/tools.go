@@ -1,8 +1,13 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/256dpi/gomqtt/client/future"
 	"github.com/256dpi/gomqtt/packet"
 )
 
@@ -86,59 +91,193 @@ func ClearRetainedMessage(config *Config, topic string, timeout time.Duration) e
 }
 
 // ReceiveMessage will connect to the specified broker and issue a subscription
-// for the specified topic and return the first message received.
+// for the specified topic and return the first message received. If no message
+// is received within the timeout, nil is returned.
 func ReceiveMessage(config *Config, topic string, qos packet.QOS, timeout time.Duration) (*packet.Message, error) {
-	// create client
-	client := New()
+	// prepare context
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// connect to broker
-	future, err := client.Connect(config)
-	if err != nil {
+	// receive message
+	msgs, err := ReceiveMessages(ctx, config, topic, qos, 1)
+	if err == context.DeadlineExceeded {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 
-	// wait for future
-	err = future.Wait(timeout)
+	return msgs[0], nil
+}
+
+// GetRetainedMessage will connect to the specified broker, issue a subscription
+// for the specified topic and return the retained message of the topic. If no
+// retained message is received within the timeout, nil is returned.
+func GetRetainedMessage(config *Config, topic string, timeout time.Duration) (*packet.Message, error) {
+	// receive message
+	msg, err := ReceiveMessage(config, topic, 0, timeout)
 	if err != nil {
 		return nil, err
 	}
 
-	// create channel
-	msgCh := make(chan *packet.Message)
-	errCh := make(chan error)
+	// ignore live messages, which are only received first if the topic has no
+	// retained message
+	if msg != nil && !msg.Retain {
+		return nil, nil
+	}
+
+	return msg, nil
+}
+
+// ReceiveMessages will connect to the specified broker, issue a subscription for
+// the specified topic and return once the specified count of messages has been
+// received. If the context is done before, the messages received so far are
+// returned together with the context error. A future.ErrTimeout is returned if
+// the context is done while connecting.
+func ReceiveMessages(ctx context.Context, config *Config, topic string, qos packet.QOS, count int) ([]*packet.Message, error) {
+	// create client
+	client := New()
 
 	// set callback
-	client.Callback = func(msg *packet.Message, err error) error {
+	errCh := make(chan error, 1)
+	client.Callback = func(_ *packet.Message, err error) error {
 		if err != nil {
 			errCh <- err
-			return nil
 		}
 
-		msgCh <- msg
 		return nil
 	}
 
-	// make subscription
-	subscribeFuture, err := client.Subscribe(topic, qos)
+	// get messages
+	messages := client.Messages(topic, count)
+
+	// connect to broker
+	connectFuture, err := client.Connect(config)
 	if err != nil {
 		return nil, err
 	}
 
 	// wait for future
-	err = subscribeFuture.Wait(timeout)
+	err = await(ctx, connectFuture)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	// make subscription, the acknowledgement is not awaited as it may be
+	// received after more retained messages than fit into the channel
+	_, err = client.Subscribe(topic, qos)
 	if err != nil {
 		return nil, err
 	}
 
-	// prepare message
-	var msg *packet.Message
+	// collect messages
+	msgs := make([]*packet.Message, 0, count)
+	for len(msgs) < count {
+		select {
+		case msg, ok := <-messages:
+			// return error if the client has been closed
+			if !ok {
+				select {
+				case err = <-errCh:
+				default:
+					err = ErrClientNotConnected
+				}
 
-	// wait for error, message or timeout
-	select {
-	case err = <-errCh:
+				return msgs, err
+			}
+
+			msgs = append(msgs, msg)
+		case <-ctx.Done():
+			_ = client.Disconnect()
+			return msgs, ctx.Err()
+		}
+	}
+
+	// disconnect
+	err = client.Disconnect()
+	if err != nil {
+		return msgs, err
+	}
+
+	return msgs, nil
+}
+
+// Drain will connect to the specified broker, issue a subscription for the
+// specified filter and collect up to the specified count of messages until the
+// timeout is reached.
+func Drain(config *Config, filter string, qos packet.QOS, count int, timeout time.Duration) ([]*packet.Message, error) {
+	// prepare context
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// receive messages
+	msgs, err := ReceiveMessages(ctx, config, filter, qos, count)
+	if err == context.DeadlineExceeded {
+		return msgs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// A ProbeResult contains the latencies measured by ProbeBroker.
+type ProbeResult struct {
+	// The time until the connection has been acknowledged.
+	Connect time.Duration
+
+	// The time until a published message has been received back. It is zero
+	// if no round-trip has been requested.
+	RoundTrip time.Duration
+}
+
+// ProbeBroker will connect to the specified broker and measure the time until
+// the connection has been acknowledged. If a topic is specified, a message is
+// published to the topic and the time until it is received back is measured.
+// The probe can be used as a readiness check for brokers.
+func ProbeBroker(config *Config, topic string, timeout time.Duration) (*ProbeResult, error) {
+	// create client
+	client := New()
+
+	// prepare result
+	result := &ProbeResult{}
+
+	// get messages
+	var messages <-chan *packet.Message
+	if topic != "" {
+		messages = client.Messages(topic)
+	}
+
+	// connect to broker
+	start := time.Now()
+	connectFuture, err := client.Connect(config)
+	if err != nil {
 		return nil, err
-	case msg = <-msgCh:
-	case <-time.After(timeout):
+	}
+
+	// wait for future
+	err = connectFuture.Wait(timeout)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	// check return code
+	if connectFuture.ReturnCode() != packet.ConnectionAccepted {
+		_ = client.Close()
+		return nil, ErrClientConnectionDenied
+	}
+
+	// set connect latency
+	result.Connect = time.Since(start)
+
+	// perform round-trip if requested
+	if topic != "" {
+		err = roundTrip(client, messages, topic, timeout, result)
+		if err != nil {
+			_ = client.Close()
+			return nil, err
+		}
 	}
 
 	// disconnect
@@ -147,5 +286,74 @@ func ReceiveMessage(config *Config, topic string, qos packet.QOS, timeout time.D
 		return nil, err
 	}
 
-	return msg, nil
+	return result, nil
+}
+
+func roundTrip(client *Client, messages <-chan *packet.Message, topic string, timeout time.Duration, result *ProbeResult) error {
+	// make subscription
+	subscribeFuture, err := client.Subscribe(topic, 0)
+	if err != nil {
+		return err
+	}
+
+	// wait for future
+	err = subscribeFuture.Wait(timeout)
+	if err != nil {
+		return err
+	}
+
+	// prepare payload to identify the message
+	payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	// publish message
+	start := time.Now()
+	_, err = client.Publish(topic, payload, 0, false)
+	if err != nil {
+		return err
+	}
+
+	// wait for message
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return ErrClientNotConnected
+			}
+
+			// ignore other messages
+			if !bytes.Equal(msg.Payload, payload) {
+				continue
+			}
+
+			// set round-trip latency
+			result.RoundTrip = time.Since(start)
+
+			// remove subscription
+			unsubscribeFuture, err := client.Unsubscribe(topic)
+			if err != nil {
+				return err
+			}
+
+			return unsubscribeFuture.Wait(timeout)
+		case <-deadline:
+			return future.ErrTimeout
+		}
+	}
+}
+
+// await will wait until the future has been completed or the context is done.
+func await(ctx context.Context, f GenericFuture) error {
+	// wait for future
+	done := make(chan error, 1)
+	go func() {
+		done <- f.Wait(math.MaxInt64)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return future.ErrTimeout
+	}
 }
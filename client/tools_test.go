@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/256dpi/gomqtt/broker"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/transport/flow"
 
@@ -107,3 +109,213 @@ func TestReceiveMessage(t *testing.T) {
 
 	safeReceive(done)
 }
+
+func TestReceiveMessageTimeout(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test"},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	msg, err := ReceiveMessage(NewConfig("tcp://localhost:"+port), "test", 0, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Nil(t, msg)
+
+	safeReceive(done)
+}
+
+func TestReceiveMessages(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test/#"},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	publish1 := packet.NewPublish()
+	publish1.Message = packet.Message{
+		Topic:   "test/1",
+		Payload: []byte("1"),
+	}
+
+	publish2 := packet.NewPublish()
+	publish2.Message = packet.Message{
+		Topic:   "test/2",
+		Payload: []byte("2"),
+	}
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(publish1).
+		Send(publish2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	msgs, err := ReceiveMessages(context.Background(), NewConfig("tcp://localhost:"+port), "test/#", 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []*packet.Message{&publish1.Message, &publish2.Message}, msgs)
+
+	safeReceive(done)
+}
+
+func TestReceiveMessagesDeadline(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test"},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	publish := packet.NewPublish()
+	publish.Message = packet.Message{
+		Topic:   "test",
+		Payload: []byte("test"),
+	}
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(publish).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	msgs, err := ReceiveMessages(ctx, NewConfig("tcp://localhost:"+port), "test", 0, 2)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []*packet.Message{&publish.Message}, msgs)
+
+	safeReceive(done)
+}
+
+func TestGetRetainedMessage(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: "test"},
+	}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	retained := packet.NewPublish()
+	retained.Message = packet.Message{
+		Topic:   "test",
+		Payload: []byte("test"),
+		Retain:  true,
+	}
+
+	live := packet.NewPublish()
+	live.Message = packet.Message{
+		Topic:   "test",
+		Payload: []byte("test"),
+	}
+
+	broker1 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(retained).
+		Receive(disconnectPacket()).
+		End()
+
+	broker2 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(live).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker1, broker2)
+
+	msg, err := GetRetainedMessage(NewConfig("tcp://localhost:"+port), "test", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, retained.Message.String(), msg.String())
+
+	msg, err = GetRetainedMessage(NewConfig("tcp://localhost:"+port), "test", time.Second)
+	assert.NoError(t, err)
+	assert.Nil(t, msg)
+
+	safeReceive(done)
+}
+
+func TestProbeBroker(t *testing.T) {
+	port, quit, done := broker.Run(broker.NewEngine(broker.NewMemoryBackend()), "tcp")
+
+	result, err := ProbeBroker(NewConfig("tcp://localhost:"+port), "", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, result.Connect > 0)
+	assert.Zero(t, result.RoundTrip)
+
+	result, err = ProbeBroker(NewConfig("tcp://localhost:"+port), "probe", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, result.Connect > 0)
+	assert.True(t, result.RoundTrip > 0)
+
+	close(quit)
+	safeReceive(done)
+
+	result, err = ProbeBroker(NewConfig("tcp://localhost:"+port), "", time.Second)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestDrain(t *testing.T) {
+	port, quit, done := broker.Run(broker.NewEngine(broker.NewMemoryBackend()), "tcp")
+
+	config := NewConfig("tcp://localhost:" + port)
+
+	for _, topic := range []string{"drain/1", "drain/2", "drain/3"} {
+		err := PublishMessage(config, &packet.Message{
+			Topic:   topic,
+			Payload: []byte(topic),
+			Retain:  true,
+		}, time.Second)
+		assert.NoError(t, err)
+	}
+
+	msgs, err := Drain(config, "drain/#", 0, 2, time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	msgs, err = Drain(config, "drain/#", 0, 5, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	close(quit)
+	safeReceive(done)
+}
@@ -0,0 +1,428 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrGossipClosed is returned if the gossip has been closed.
+var ErrGossipClosed = errors.New("gossip closed")
+
+// EventType denotes the type of a membership event.
+type EventType int
+
+const (
+	// NodeJoined is emitted when a node has joined the cluster or recovered
+	// from a failure.
+	NodeJoined EventType = iota
+
+	// NodeLeft is emitted when a node has left the cluster gracefully.
+	NodeLeft
+
+	// NodeFailed is emitted when a node has not been heard of within the
+	// failure timeout.
+	NodeFailed
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case NodeJoined:
+		return "joined"
+	case NodeLeft:
+		return "left"
+	case NodeFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
+
+// An Event describes a change of the cluster membership.
+type Event struct {
+	// The type of the event.
+	Type EventType
+
+	// The node the event refers to.
+	Node Node
+}
+
+type memberState struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Heartbeat uint64 `json:"heartbeat"`
+	Left      bool   `json:"left,omitempty"`
+}
+
+type member struct {
+	state   memberState
+	updated time.Time
+	alive   bool
+}
+
+// Gossip discovers the nodes of a cluster and detects their failure using a
+// heartbeat based gossip protocol over UDP. Every node periodically increments
+// its heartbeat and sends its view of the cluster to a few random nodes. A node
+// whose heartbeat has not increased within the failure timeout is considered
+// failed.
+type Gossip struct {
+	// The local node. The address is used to listen for gossip and is updated
+	// with the actual address once started.
+	Node Node
+
+	// The interval in which the view is gossiped.
+	//
+	// Will default to 200 milliseconds.
+	Interval time.Duration
+
+	// The timeout after which a silent node is considered failed.
+	//
+	// Will default to 5 seconds.
+	FailureTimeout time.Duration
+
+	// The number of nodes the view is sent to per interval.
+	//
+	// Will default to 3.
+	Fanout int
+
+	// The Handler callback is called sequentially with membership events.
+	Handler func(Event)
+
+	heartbeat uint64
+	members   map[string]*member
+	conn      net.PacketConn
+	pending   []Event
+	notify    chan struct{}
+	closing   chan struct{}
+	group     sync.WaitGroup
+	mutex     sync.Mutex
+}
+
+// NewGossip returns a new gossip for the specified local node.
+func NewGossip(node Node) *Gossip {
+	return &Gossip{
+		Node:           node,
+		Interval:       200 * time.Millisecond,
+		FailureTimeout: 5 * time.Second,
+		Fanout:         3,
+		members:        make(map[string]*member),
+		notify:         make(chan struct{}, 1),
+		closing:        make(chan struct{}),
+	}
+}
+
+// Start will listen on the address of the local node and begin gossiping.
+func (g *Gossip) Start() error {
+	// listen
+	conn, err := net.ListenPacket("udp", g.Node.Addr)
+	if err != nil {
+		return err
+	}
+
+	// update address
+	g.mutex.Lock()
+	g.conn = conn
+	g.Node.Addr = conn.LocalAddr().String()
+	g.mutex.Unlock()
+
+	// run goroutines
+	g.group.Add(3)
+	go g.receiver()
+	go g.ticker()
+	go g.dispatcher()
+
+	return nil
+}
+
+// Join will send the local view to the nodes with the specified addresses. The
+// gossip must have been started.
+func (g *Gossip) Join(addrs ...string) error {
+	for _, addr := range addrs {
+		err := g.send(addr, g.view(false))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Members will return the alive nodes including the local node sorted by
+// their name.
+func (g *Gossip) Members() []Node {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// collect nodes
+	list := []Node{g.Node}
+	for _, m := range g.members {
+		if m.alive {
+			list = append(list, Node{Name: m.state.Name, Addr: m.state.Addr})
+		}
+	}
+
+	// sort nodes
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// Leave will announce to all alive nodes that the local node leaves the
+// cluster. The gossip should be closed afterwards.
+func (g *Gossip) Leave() error {
+	// get view
+	view := g.view(true)
+
+	// send view to all alive nodes
+	for _, node := range g.Members() {
+		if node.Name != g.Node.Name {
+			err := g.send(node.Addr, view)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close will stop gossiping. Pending events are not dispatched anymore.
+func (g *Gossip) Close() error {
+	// check if closed
+	select {
+	case <-g.closing:
+		return ErrGossipClosed
+	default:
+	}
+
+	// close
+	close(g.closing)
+	err := g.conn.Close()
+
+	// wait for goroutines
+	g.group.Wait()
+
+	return err
+}
+
+func (g *Gossip) view(leave bool) []memberState {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// add local node
+	g.heartbeat++
+	view := []memberState{{
+		Name:      g.Node.Name,
+		Addr:      g.Node.Addr,
+		Heartbeat: g.heartbeat,
+		Left:      leave,
+	}}
+
+	// add known nodes
+	for _, m := range g.members {
+		view = append(view, m.state)
+	}
+
+	return view
+}
+
+func (g *Gossip) send(addr string, view []memberState) error {
+	// resolve address
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	// encode view
+	data, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+
+	// send view
+	_, err = g.conn.WriteTo(data, udpAddr)
+
+	return err
+}
+
+func (g *Gossip) receiver() {
+	defer g.group.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		// read message
+		n, _, err := g.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		// decode view
+		var view []memberState
+		if json.Unmarshal(buf[:n], &view) != nil {
+			continue
+		}
+
+		// merge view
+		g.merge(view)
+	}
+}
+
+func (g *Gossip) merge(view []memberState) {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// get time
+	now := time.Now()
+
+	for _, state := range view {
+		// skip local node
+		if state.Name == g.Node.Name {
+			continue
+		}
+
+		// add unknown nodes
+		m, ok := g.members[state.Name]
+		if !ok {
+			m = &member{}
+			g.members[state.Name] = m
+		} else if state.Heartbeat <= m.state.Heartbeat {
+			continue
+		}
+
+		// update member
+		m.state = state
+		m.updated = now
+
+		// handle leave
+		if state.Left {
+			if m.alive {
+				m.alive = false
+				g.emit(NodeLeft, state)
+			}
+
+			continue
+		}
+
+		// handle join
+		if !m.alive {
+			m.alive = true
+			g.emit(NodeJoined, state)
+		}
+	}
+}
+
+func (g *Gossip) ticker() {
+	defer g.group.Done()
+
+	for {
+		select {
+		case <-time.After(g.Interval):
+		case <-g.closing:
+			return
+		}
+
+		// detect failures
+		g.detect()
+
+		// get view
+		view := g.view(false)
+
+		// send view to random alive nodes
+		for _, addr := range g.targets() {
+			_ = g.send(addr, view)
+		}
+	}
+}
+
+func (g *Gossip) detect() {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// get time
+	now := time.Now()
+
+	for name, m := range g.members {
+		// mark failed nodes
+		if m.alive && now.Sub(m.updated) > g.FailureTimeout {
+			m.alive = false
+			g.emit(NodeFailed, m.state)
+		}
+
+		// forget nodes that have been gone for a while, the heartbeat is kept
+		// until then to prevent a resurrection by outdated views
+		if !m.alive && now.Sub(m.updated) > 2*g.FailureTimeout {
+			delete(g.members, name)
+		}
+	}
+}
+
+func (g *Gossip) targets() []string {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// collect alive nodes
+	var addrs []string
+	for _, m := range g.members {
+		if m.alive {
+			addrs = append(addrs, m.state.Addr)
+		}
+	}
+
+	// pick random nodes
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > g.Fanout {
+		addrs = addrs[:g.Fanout]
+	}
+
+	return addrs
+}
+
+func (g *Gossip) emit(typ EventType, state memberState) {
+	// queue event, the mutex must be held
+	g.pending = append(g.pending, Event{Type: typ, Node: Node{Name: state.Name, Addr: state.Addr}})
+
+	// notify dispatcher
+	select {
+	case g.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (g *Gossip) dispatcher() {
+	defer g.group.Done()
+
+	for {
+		select {
+		case <-g.notify:
+		case <-g.closing:
+			return
+		}
+
+		// get pending events
+		g.mutex.Lock()
+		events := g.pending
+		g.pending = nil
+		g.mutex.Unlock()
+
+		// call handler
+		for _, evt := range events {
+			if g.Handler != nil {
+				g.Handler(evt)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startGossip(t *testing.T, name string, events chan Event) *Gossip {
+	g := NewGossip(Node{Name: name, Addr: "127.0.0.1:0"})
+	g.Interval = 10 * time.Millisecond
+	g.FailureTimeout = 200 * time.Millisecond
+	g.Handler = func(evt Event) {
+		if events != nil {
+			events <- evt
+		}
+	}
+
+	require.NoError(t, g.Start())
+
+	return g
+}
+
+func waitEvent(t *testing.T, events chan Event, typ EventType, name string) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case evt := <-events:
+			if evt.Type == typ && evt.Node.Name == name {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("missing %s event for %s", typ, name)
+		}
+	}
+}
+
+func TestGossip(t *testing.T) {
+	events := make(chan Event, 100)
+
+	a := startGossip(t, "a", events)
+	b := startGossip(t, "b", nil)
+	c := startGossip(t, "c", nil)
+
+	// join via a
+	assert.NoError(t, b.Join(a.Node.Addr))
+	assert.NoError(t, c.Join(a.Node.Addr))
+
+	waitEvent(t, events, NodeJoined, "b")
+	waitEvent(t, events, NodeJoined, "c")
+
+	// b learns about c through gossip
+	for i := 0; len(b.Members()) < 3; i++ {
+		require.True(t, i < 500, "c not discovered")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// graceful leave
+	assert.NoError(t, b.Leave())
+	assert.NoError(t, b.Close())
+	waitEvent(t, events, NodeLeft, "b")
+
+	// failure
+	assert.NoError(t, c.Close())
+	waitEvent(t, events, NodeFailed, "c")
+	assert.Equal(t, []Node{a.Node}, a.Members())
+
+	assert.NoError(t, a.Close())
+	assert.Equal(t, ErrGossipClosed, a.Close())
+}
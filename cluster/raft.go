@@ -0,0 +1,948 @@
+package cluster
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrNoLeader is returned if a proposal cannot be forwarded as no leader is
+// known.
+var ErrNoLeader = errors.New("no leader")
+
+// ErrProposalTimeout is returned if a proposal has not been applied within the
+// proposal timeout.
+var ErrProposalTimeout = errors.New("proposal timeout")
+
+// ErrProposalDropped is returned if a proposal has been replaced by an entry of
+// another leader.
+var ErrProposalDropped = errors.New("proposal dropped")
+
+// ErrRaftClosed is returned if the raft has been closed.
+var ErrRaftClosed = errors.New("raft closed")
+
+// RaftState is the state of a raft member.
+type RaftState int
+
+const (
+	// Follower replicates the log of the leader.
+	Follower RaftState = iota
+
+	// Candidate requests votes to become the leader.
+	Candidate
+
+	// Leader accepts proposals and replicates the log.
+	Leader
+)
+
+// A LogEntry is an entry of the replicated log.
+type LogEntry struct {
+	// The term the entry has been created in.
+	Term uint64
+
+	// The proposed data.
+	Data []byte
+}
+
+// A VoteRequest is sent by candidates to gather votes.
+type VoteRequest struct {
+	Term         uint64
+	Candidate    string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+// A VoteResponse is the answer to a VoteRequest.
+type VoteResponse struct {
+	Term    uint64
+	Granted bool
+}
+
+// An AppendRequest is sent by the leader to replicate the log and as a
+// heartbeat.
+type AppendRequest struct {
+	Term         uint64
+	Leader       string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []LogEntry
+	LeaderCommit uint64
+}
+
+// An AppendResponse is the answer to an AppendRequest.
+type AppendResponse struct {
+	Term    uint64
+	Success bool
+}
+
+// A SnapshotRequest is sent by the leader to members that lag behind the
+// compacted log.
+type SnapshotRequest struct {
+	Term     uint64
+	Leader   string
+	Snapshot RaftSnapshot
+}
+
+// A SnapshotResponse is the answer to a SnapshotRequest.
+type SnapshotResponse struct {
+	Term    uint64
+	Success bool
+}
+
+// A RaftTransport is used by a Raft to reach the other members.
+type RaftTransport interface {
+	// RequestVote should call HandleRequestVote on the specified member.
+	RequestVote(member string, req VoteRequest) (VoteResponse, error)
+
+	// AppendEntries should call HandleAppendEntries on the specified member.
+	AppendEntries(member string, req AppendRequest) (AppendResponse, error)
+
+	// InstallSnapshot should call HandleInstallSnapshot on the specified
+	// member.
+	InstallSnapshot(member string, req SnapshotRequest) (SnapshotResponse, error)
+
+	// Forward should call Propose on the specified member.
+	Forward(member string, data []byte) error
+}
+
+type proposal struct {
+	term uint64
+	done chan error
+}
+
+// Raft replicates a log between the members of a cluster using the Raft
+// consensus algorithm. Committed entries are applied in the same order on all
+// members. The term, vote and log are persisted using the storage before
+// requests are answered, members that restart resume from the stored state.
+// The log is compacted by taking snapshots of the applied state.
+type Raft struct {
+	// The name of the local member.
+	ID string
+
+	// The names of the other members.
+	Peers []string
+
+	// The transport used to reach the other members.
+	Transport RaftTransport
+
+	// The storage used to persist the term, vote, log and snapshots.
+	Storage RaftStorage
+
+	// The Apply callback is called sequentially with the data of committed
+	// entries. Entries without data are not applied.
+	Apply func(data []byte)
+
+	// The Snapshot callback is called from the same goroutine as Apply and
+	// should return the state of all applied entries. The log is compacted
+	// up to the last applied entry afterwards. Snapshots are disabled if
+	// missing.
+	Snapshot func() []byte
+
+	// The Restore callback is called from the same goroutine as Apply with
+	// the data of a snapshot and should replace the state of all applied
+	// entries.
+	Restore func(data []byte)
+
+	// The number of applied entries after which a snapshot is taken.
+	//
+	// Will default to 1024.
+	SnapshotThreshold int
+
+	// The minimum time without contact to the leader after which an election
+	// is started. The actual timeout is randomized up to twice the value.
+	//
+	// Will default to 300 milliseconds.
+	ElectionTimeout time.Duration
+
+	// The interval in which the leader sends heartbeats.
+	//
+	// Will default to 50 milliseconds.
+	HeartbeatInterval time.Duration
+
+	// The time after which a proposal fails if it has not been applied.
+	//
+	// Will default to 5 seconds.
+	ProposalTimeout time.Duration
+
+	state       RaftState
+	term        uint64
+	votedFor    string
+	savedTerm   uint64
+	savedVote   string
+	leader      string
+	log         []LogEntry
+	snapshot    RaftSnapshot
+	restore     *RaftSnapshot
+	commitIndex uint64
+	lastApplied uint64
+	nextIndex   map[string]uint64
+	matchIndex  map[string]uint64
+	replicating map[string]bool
+	proposals   map[uint64]*proposal
+	deadline    time.Time
+	heartbeat   time.Time
+
+	notify  chan struct{}
+	closing chan struct{}
+	group   sync.WaitGroup
+	mutex   sync.Mutex
+}
+
+// NewRaft returns a new raft for the local member and its peers that persists
+// its state using the specified storage.
+func NewRaft(id string, peers []string, transport RaftTransport, storage RaftStorage) *Raft {
+	return &Raft{
+		ID:                id,
+		Peers:             peers,
+		Transport:         transport,
+		Storage:           storage,
+		SnapshotThreshold: 1024,
+		ElectionTimeout:   300 * time.Millisecond,
+		HeartbeatInterval: 50 * time.Millisecond,
+		ProposalTimeout:   5 * time.Second,
+		replicating:       make(map[string]bool),
+		proposals:         make(map[uint64]*proposal),
+		notify:            make(chan struct{}, 1),
+		closing:           make(chan struct{}),
+	}
+}
+
+// Start will load the stored state and begin participating in the cluster.
+func (r *Raft) Start() error {
+	// load state
+	stored, err := r.Storage.Load()
+	if err != nil {
+		return err
+	}
+
+	// restore snapshot
+	if stored.Snapshot.Index > 0 && r.Restore != nil {
+		r.Restore(stored.Snapshot.Data)
+	}
+
+	// set state and initial deadline
+	r.mutex.Lock()
+	r.term = stored.Term
+	r.votedFor = stored.VotedFor
+	r.savedTerm = stored.Term
+	r.savedVote = stored.VotedFor
+	r.snapshot = stored.Snapshot
+	r.log = stored.Entries
+	r.commitIndex = stored.Snapshot.Index
+	r.lastApplied = stored.Snapshot.Index
+	r.resetDeadline()
+	r.mutex.Unlock()
+
+	// run goroutines
+	r.group.Add(2)
+	go r.ticker()
+	go r.applier()
+
+	return nil
+}
+
+// State returns the current state, term and the known leader.
+func (r *Raft) State() (RaftState, uint64, string) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.state, r.term, r.leader
+}
+
+// Propose will append the data to the log and wait until it has been applied
+// locally. Proposals of followers are forwarded to the leader.
+func (r *Raft) Propose(data []byte) error {
+	// acquire mutex
+	r.mutex.Lock()
+
+	// forward to leader if not leader
+	if r.state != Leader {
+		leader := r.leader
+		r.mutex.Unlock()
+
+		// check leader
+		if leader == "" || leader == r.ID {
+			return ErrNoLeader
+		}
+
+		return r.Transport.Forward(leader, data)
+	}
+
+	// persist entry
+	entry := LogEntry{Term: r.term, Data: data}
+	index, _ := r.lastLog()
+	index++
+	err := r.Storage.SaveEntries(index, []LogEntry{entry})
+	if err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+
+	// append entry
+	r.log = append(r.log, entry)
+
+	// register proposal
+	p := &proposal{term: r.term, done: make(chan error, 1)}
+	r.proposals[index] = p
+
+	// commit entry directly if alone
+	r.advanceCommit()
+
+	r.mutex.Unlock()
+
+	// replicate entry
+	r.broadcast()
+
+	// await result
+	select {
+	case err := <-p.done:
+		return err
+	case <-time.After(r.ProposalTimeout):
+		r.mutex.Lock()
+		delete(r.proposals, index)
+		r.mutex.Unlock()
+		return ErrProposalTimeout
+	case <-r.closing:
+		return ErrRaftClosed
+	}
+}
+
+// HandleRequestVote handles a vote request of a candidate. It should be called
+// by the transport.
+func (r *Raft) HandleRequestVote(req VoteRequest) VoteResponse {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// step down if term is newer
+	if req.Term > r.term {
+		r.stepDown(req.Term)
+	}
+
+	// check term, previous vote and if the log of the candidate is up to date
+	lastIndex, lastTerm := r.lastLog()
+	granted := req.Term == r.term &&
+		(r.votedFor == "" || r.votedFor == req.Candidate) &&
+		(req.LastLogTerm > lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex >= lastIndex))
+
+	// grant vote
+	if granted {
+		r.votedFor = req.Candidate
+		r.resetDeadline()
+	}
+
+	// persist term and vote
+	err := r.persist()
+	if err != nil {
+		return VoteResponse{Term: r.term}
+	}
+
+	return VoteResponse{Term: r.term, Granted: granted}
+}
+
+// HandleAppendEntries handles an append request of the leader. It should be
+// called by the transport.
+func (r *Raft) HandleAppendEntries(req AppendRequest) AppendResponse {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// check term
+	if req.Term < r.term {
+		return AppendResponse{Term: r.term}
+	}
+
+	// follow leader
+	if req.Term > r.term || r.state != Follower {
+		r.stepDown(req.Term)
+	}
+	r.leader = req.Leader
+	r.resetDeadline()
+
+	// persist term
+	err := r.persist()
+	if err != nil {
+		return AppendResponse{Term: r.term}
+	}
+
+	// skip entries that are included in the snapshot
+	entries := req.Entries
+	prevIndex, prevTerm := req.PrevLogIndex, req.PrevLogTerm
+	if prevIndex < r.snapshot.Index {
+		skip := r.snapshot.Index - prevIndex
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+
+		entries = entries[skip:]
+		prevIndex, prevTerm = r.snapshot.Index, r.snapshot.Term
+	}
+
+	// check previous entry
+	if term, ok := r.termAt(prevIndex); !ok || term != prevTerm {
+		return AppendResponse{Term: r.term}
+	}
+
+	// find first new or conflicting entry
+	for i, entry := range entries {
+		index := prevIndex + uint64(i) + 1
+		if term, ok := r.termAt(index); ok && term == entry.Term {
+			continue
+		}
+
+		// persist entries and drop conflicting entries
+		err = r.Storage.SaveEntries(index, entries[i:])
+		if err != nil {
+			return AppendResponse{Term: r.term}
+		}
+
+		// append entries
+		r.log = append(r.log[:index-r.snapshot.Index-1], entries[i:]...)
+
+		break
+	}
+
+	// update commit index
+	if req.LeaderCommit > r.commitIndex {
+		r.commitIndex = req.LeaderCommit
+		if last := prevIndex + uint64(len(entries)); last < r.commitIndex {
+			r.commitIndex = last
+		}
+
+		r.signal()
+	}
+
+	return AppendResponse{Term: r.term, Success: true}
+}
+
+// HandleInstallSnapshot handles a snapshot request of the leader. It should be
+// called by the transport.
+func (r *Raft) HandleInstallSnapshot(req SnapshotRequest) SnapshotResponse {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// check term
+	if req.Term < r.term {
+		return SnapshotResponse{Term: r.term}
+	}
+
+	// follow leader
+	if req.Term > r.term || r.state != Follower {
+		r.stepDown(req.Term)
+	}
+	r.leader = req.Leader
+	r.resetDeadline()
+
+	// persist term
+	err := r.persist()
+	if err != nil {
+		return SnapshotResponse{Term: r.term}
+	}
+
+	// ignore snapshot if the entries have already been committed
+	snapshot := req.Snapshot
+	if snapshot.Index <= r.commitIndex {
+		return SnapshotResponse{Term: r.term, Success: true}
+	}
+
+	// persist snapshot
+	err = r.Storage.SaveSnapshot(snapshot)
+	if err != nil {
+		return SnapshotResponse{Term: r.term}
+	}
+
+	// keep the following entries if the log contains the last entry of the
+	// snapshot, otherwise drop the log
+	if term, ok := r.termAt(snapshot.Index); ok && term == snapshot.Term {
+		r.log = append([]LogEntry(nil), r.log[snapshot.Index-r.snapshot.Index:]...)
+	} else {
+		err = r.Storage.SaveEntries(snapshot.Index+1, nil)
+		if err != nil {
+			return SnapshotResponse{Term: r.term}
+		}
+
+		r.log = nil
+	}
+
+	// set snapshot and restore it
+	r.snapshot = snapshot
+	r.restore = &snapshot
+	r.commitIndex = snapshot.Index
+	r.signal()
+
+	return SnapshotResponse{Term: r.term, Success: true}
+}
+
+// Close will stop participating in the cluster.
+func (r *Raft) Close() {
+	// close
+	close(r.closing)
+
+	// wait for goroutines
+	r.group.Wait()
+}
+
+func (r *Raft) ticker() {
+	defer r.group.Done()
+
+	for {
+		select {
+		case <-time.After(r.HeartbeatInterval / 5):
+		case <-r.closing:
+			return
+		}
+
+		// get state
+		r.mutex.Lock()
+		state := r.state
+		now := time.Now()
+		elect := state != Leader && now.After(r.deadline)
+		beat := state == Leader && now.Sub(r.heartbeat) >= r.HeartbeatInterval
+		r.mutex.Unlock()
+
+		// start election or send heartbeats
+		if elect {
+			r.elect()
+		} else if beat {
+			r.broadcast()
+		}
+	}
+}
+
+func (r *Raft) elect() {
+	// acquire mutex
+	r.mutex.Lock()
+
+	// become candidate
+	r.state = Candidate
+	r.term++
+	r.votedFor = r.ID
+	r.leader = ""
+	r.resetDeadline()
+
+	// persist term and vote, the election is retried after the timeout
+	err := r.persist()
+	if err != nil {
+		r.mutex.Unlock()
+		return
+	}
+
+	// prepare request
+	lastIndex, lastTerm := r.lastLog()
+	req := VoteRequest{
+		Term:         r.term,
+		Candidate:    r.ID,
+		LastLogIndex: lastIndex,
+		LastLogTerm:  lastTerm,
+	}
+
+	// win directly if alone
+	if len(r.Peers) == 0 {
+		r.becomeLeader()
+		r.mutex.Unlock()
+		return
+	}
+
+	r.mutex.Unlock()
+
+	// request votes
+	votes := 1
+	for _, peer := range r.Peers {
+		go func(peer string) {
+			// request vote
+			res, err := r.Transport.RequestVote(peer, req)
+			if err != nil {
+				return
+			}
+
+			// acquire mutex
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+
+			// step down if term is newer
+			if res.Term > r.term {
+				r.stepDown(res.Term)
+				return
+			}
+
+			// check state and vote
+			if r.state != Candidate || r.term != req.Term || !res.Granted {
+				return
+			}
+
+			// become leader on majority
+			votes++
+			if votes > (len(r.Peers)+1)/2 {
+				r.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+func (r *Raft) becomeLeader() {
+	// persist an empty entry to commit the entries of previous terms
+	entry := LogEntry{Term: r.term}
+	lastIndex, _ := r.lastLog()
+	err := r.Storage.SaveEntries(lastIndex+1, []LogEntry{entry})
+	if err != nil {
+		r.stepDown(r.term)
+		return
+	}
+
+	// set state
+	r.state = Leader
+	r.leader = r.ID
+
+	// reset indexes
+	r.nextIndex = make(map[string]uint64)
+	r.matchIndex = make(map[string]uint64)
+	for _, peer := range r.Peers {
+		r.nextIndex[peer] = lastIndex + 1
+	}
+
+	// append entry
+	r.log = append(r.log, entry)
+	r.advanceCommit()
+
+	// send heartbeats immediately
+	r.heartbeat = time.Time{}
+}
+
+func (r *Raft) broadcast() {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// check state
+	if r.state != Leader {
+		return
+	}
+
+	// replicate to all peers
+	r.heartbeat = time.Now()
+	for _, peer := range r.Peers {
+		if !r.replicating[peer] {
+			r.replicating[peer] = true
+			go r.replicate(peer)
+		}
+	}
+}
+
+func (r *Raft) replicate(peer string) {
+	// acquire mutex
+	r.mutex.Lock()
+
+	// check state
+	if r.state != Leader {
+		r.replicating[peer] = false
+		r.mutex.Unlock()
+		return
+	}
+
+	// send snapshot if the entries have been compacted
+	prevIndex := r.nextIndex[peer] - 1
+	if prevIndex < r.snapshot.Index {
+		req := SnapshotRequest{
+			Term:     r.term,
+			Leader:   r.ID,
+			Snapshot: r.snapshot,
+		}
+
+		r.mutex.Unlock()
+
+		r.installSnapshot(peer, req)
+
+		return
+	}
+
+	// prepare request
+	prevTerm, _ := r.termAt(prevIndex)
+	req := AppendRequest{
+		Term:         r.term,
+		Leader:       r.ID,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  prevTerm,
+		Entries:      append([]LogEntry(nil), r.log[prevIndex-r.snapshot.Index:]...),
+		LeaderCommit: r.commitIndex,
+	}
+
+	r.mutex.Unlock()
+
+	// send request
+	res, err := r.Transport.AppendEntries(peer, req)
+
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// clear flag
+	r.replicating[peer] = false
+
+	// check error
+	if err != nil {
+		return
+	}
+
+	// step down if term is newer
+	if res.Term > r.term {
+		r.stepDown(res.Term)
+		return
+	}
+
+	// check state
+	if r.state != Leader || r.term != req.Term {
+		return
+	}
+
+	// go back on failure
+	if !res.Success {
+		if r.nextIndex[peer] > 1 {
+			r.nextIndex[peer]--
+		}
+
+		return
+	}
+
+	// update indexes
+	match := prevIndex + uint64(len(req.Entries))
+	if match > r.matchIndex[peer] {
+		r.matchIndex[peer] = match
+		r.nextIndex[peer] = match + 1
+	}
+
+	// advance commit index
+	r.advanceCommit()
+}
+
+func (r *Raft) installSnapshot(peer string, req SnapshotRequest) {
+	// send request
+	res, err := r.Transport.InstallSnapshot(peer, req)
+
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// clear flag
+	r.replicating[peer] = false
+
+	// check error
+	if err != nil {
+		return
+	}
+
+	// step down if term is newer
+	if res.Term > r.term {
+		r.stepDown(res.Term)
+		return
+	}
+
+	// check state and result
+	if r.state != Leader || r.term != req.Term || !res.Success {
+		return
+	}
+
+	// update indexes
+	if match := req.Snapshot.Index; match > r.matchIndex[peer] {
+		r.matchIndex[peer] = match
+		r.nextIndex[peer] = match + 1
+	}
+
+	// advance commit index
+	r.advanceCommit()
+}
+
+func (r *Raft) advanceCommit() {
+	// find highest index replicated on a majority, only entries of the
+	// current term may be committed by counting replicas
+	lastIndex, _ := r.lastLog()
+	for index := lastIndex; index > r.commitIndex; index-- {
+		if term, _ := r.termAt(index); term != r.term {
+			break
+		}
+
+		// count replicas
+		count := 1
+		for _, match := range r.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+
+		// commit on majority
+		if count > (len(r.Peers)+1)/2 {
+			r.commitIndex = index
+			r.signal()
+			return
+		}
+	}
+}
+
+func (r *Raft) applier() {
+	defer r.group.Done()
+
+	for {
+		select {
+		case <-r.notify:
+		case <-r.closing:
+			return
+		}
+
+		// get installed snapshot
+		r.mutex.Lock()
+		restore := r.restore
+		r.restore = nil
+		if restore != nil {
+			r.lastApplied = restore.Index
+		}
+		r.mutex.Unlock()
+
+		// restore snapshot
+		if restore != nil && r.Restore != nil {
+			r.Restore(restore.Data)
+		}
+
+		// get committed entries, a snapshot installed in the meantime is
+		// restored first
+		r.mutex.Lock()
+		if r.lastApplied < r.snapshot.Index {
+			r.mutex.Unlock()
+			continue
+		}
+		first := r.lastApplied + 1
+		entries := append([]LogEntry(nil), r.log[r.lastApplied-r.snapshot.Index:r.commitIndex-r.snapshot.Index]...)
+		r.lastApplied = r.commitIndex
+		r.mutex.Unlock()
+
+		// apply entries
+		for i, entry := range entries {
+			if r.Apply != nil && len(entry.Data) > 0 {
+				r.Apply(entry.Data)
+			}
+
+			// resolve proposal
+			index := first + uint64(i)
+			r.mutex.Lock()
+			if p, ok := r.proposals[index]; ok {
+				delete(r.proposals, index)
+				if p.term == entry.Term {
+					p.done <- nil
+				} else {
+					p.done <- ErrProposalDropped
+				}
+			}
+			r.mutex.Unlock()
+		}
+
+		// check if a snapshot is due
+		r.mutex.Lock()
+		index := r.lastApplied
+		due := r.Snapshot != nil && r.restore == nil && index > r.snapshot.Index && index-r.snapshot.Index >= uint64(r.snapshotThreshold())
+		r.mutex.Unlock()
+
+		// take snapshot
+		if due {
+			r.compact(index, r.Snapshot())
+		}
+	}
+}
+
+func (r *Raft) compact(index uint64, data []byte) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// check if a newer snapshot has been installed
+	if index <= r.snapshot.Index {
+		return
+	}
+
+	// persist snapshot, compaction is retried after the next entries have
+	// been applied
+	term, _ := r.termAt(index)
+	snapshot := RaftSnapshot{Index: index, Term: term, Data: data}
+	err := r.Storage.SaveSnapshot(snapshot)
+	if err != nil {
+		return
+	}
+
+	// drop compacted entries
+	r.log = append([]LogEntry(nil), r.log[index-r.snapshot.Index:]...)
+	r.snapshot = snapshot
+}
+
+func (r *Raft) stepDown(term uint64) {
+	// become follower
+	if term > r.term {
+		r.term = term
+		r.votedFor = ""
+	}
+	r.state = Follower
+	r.resetDeadline()
+}
+
+func (r *Raft) lastLog() (uint64, uint64) {
+	// check log
+	if len(r.log) == 0 {
+		return r.snapshot.Index, r.snapshot.Term
+	}
+
+	return r.snapshot.Index + uint64(len(r.log)), r.log[len(r.log)-1].Term
+}
+
+func (r *Raft) termAt(index uint64) (uint64, bool) {
+	// check snapshot
+	if index == r.snapshot.Index {
+		return r.snapshot.Term, true
+	}
+
+	// check log
+	if index < r.snapshot.Index || index > r.snapshot.Index+uint64(len(r.log)) {
+		return 0, false
+	}
+
+	return r.log[index-r.snapshot.Index-1].Term, true
+}
+
+func (r *Raft) persist() error {
+	// check if changed
+	if r.term == r.savedTerm && r.votedFor == r.savedVote {
+		return nil
+	}
+
+	// save state
+	err := r.Storage.SaveState(r.term, r.votedFor)
+	if err != nil {
+		return err
+	}
+
+	// update saved state
+	r.savedTerm = r.term
+	r.savedVote = r.votedFor
+
+	return nil
+}
+
+func (r *Raft) snapshotThreshold() int {
+	if r.SnapshotThreshold <= 0 {
+		return 1024
+	}
+
+	return r.SnapshotThreshold
+}
+
+func (r *Raft) resetDeadline() {
+	// randomize timeout to prevent split votes
+	timeout := r.ElectionTimeout + time.Duration(rand.Int63n(int64(r.ElectionTimeout)))
+	r.deadline = time.Now().Add(timeout)
+}
+
+func (r *Raft) signal() {
+	// notify applier
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
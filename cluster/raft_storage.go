@@ -0,0 +1,533 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrCorruptRaftStorage is returned by FileRaftStorage.Load if the stored state
+// or snapshot is corrupt.
+var ErrCorruptRaftStorage = errors.New("corrupt raft storage")
+
+// raftRecordHeaderLen is the length of the log record header that holds the
+// length and checksum of the record.
+const raftRecordHeaderLen = 8
+
+// A RaftSnapshot is the state of all applied entries up to and including an
+// index of the log.
+type RaftSnapshot struct {
+	// The index of the last entry included in the snapshot.
+	Index uint64
+
+	// The term of the last entry included in the snapshot.
+	Term uint64
+
+	// The data returned by the Snapshot callback.
+	Data []byte
+}
+
+// A RaftStoredState is the state loaded from a RaftStorage.
+type RaftStoredState struct {
+	// The current term.
+	Term uint64
+
+	// The member voted for in the current term.
+	VotedFor string
+
+	// The latest snapshot.
+	Snapshot RaftSnapshot
+
+	// The entries that follow the snapshot.
+	Entries []LogEntry
+}
+
+// A RaftStorage persists the state of a Raft. All methods must only return
+// after the changes have been stored durably.
+type RaftStorage interface {
+	// Load should return the stored state.
+	Load() (RaftStoredState, error)
+
+	// SaveState should store the current term and vote.
+	SaveState(term uint64, votedFor string) error
+
+	// SaveEntries should store the entries starting at the specified index
+	// and drop all stored entries from that index on.
+	SaveEntries(index uint64, entries []LogEntry) error
+
+	// SaveSnapshot should store the snapshot and drop all stored entries up
+	// to and including the index of the snapshot.
+	SaveSnapshot(snapshot RaftSnapshot) error
+}
+
+// MemoryRaftStorage is a RaftStorage that keeps the state in memory. The state
+// is lost when the process exits, members using it must not rejoin a cluster
+// after a restart. It should only be used for testing.
+type MemoryRaftStorage struct {
+	state RaftStoredState
+	mutex sync.Mutex
+}
+
+// NewMemoryRaftStorage returns a new MemoryRaftStorage.
+func NewMemoryRaftStorage() *MemoryRaftStorage {
+	return &MemoryRaftStorage{}
+}
+
+// Load implements the RaftStorage interface.
+func (s *MemoryRaftStorage) Load() (RaftStoredState, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// copy state
+	state := s.state
+	state.Entries = append([]LogEntry(nil), s.state.Entries...)
+
+	return state, nil
+}
+
+// SaveState implements the RaftStorage interface.
+func (s *MemoryRaftStorage) SaveState(term uint64, votedFor string) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// set state
+	s.state.Term = term
+	s.state.VotedFor = votedFor
+
+	return nil
+}
+
+// SaveEntries implements the RaftStorage interface.
+func (s *MemoryRaftStorage) SaveEntries(index uint64, entries []LogEntry) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// drop entries from index on
+	if n := index - s.state.Snapshot.Index - 1; n < uint64(len(s.state.Entries)) {
+		s.state.Entries = s.state.Entries[:n]
+	}
+
+	// append entries
+	s.state.Entries = append(s.state.Entries, entries...)
+
+	return nil
+}
+
+// SaveSnapshot implements the RaftStorage interface.
+func (s *MemoryRaftStorage) SaveSnapshot(snapshot RaftSnapshot) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// drop entries up to the snapshot
+	n := snapshot.Index - s.state.Snapshot.Index
+	if n < uint64(len(s.state.Entries)) {
+		s.state.Entries = append([]LogEntry(nil), s.state.Entries[n:]...)
+	} else {
+		s.state.Entries = nil
+	}
+
+	// set snapshot
+	s.state.Snapshot = snapshot
+
+	return nil
+}
+
+// FileRaftStorage is a RaftStorage that stores the state in a directory. The
+// term, vote and snapshot are replaced atomically, the entries are appended to
+// a log file.
+type FileRaftStorage struct {
+	dir     string
+	file    *os.File
+	first   uint64
+	offsets []int64
+	size    int64
+	mutex   sync.Mutex
+}
+
+// OpenFileRaftStorage opens or creates the storage in the specified directory.
+func OpenFileRaftStorage(dir string) (*FileRaftStorage, error) {
+	// create directory
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// open log
+	file, err := os.OpenFile(filepath.Join(dir, "log"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileRaftStorage{
+		dir:  dir,
+		file: file,
+	}, nil
+}
+
+// Load implements the RaftStorage interface. An incomplete record at the end of
+// the log, that has been left by an interrupted write, is discarded.
+func (s *FileRaftStorage) Load() (RaftStoredState, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var state RaftStoredState
+
+	// read state
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "state"))
+	if err != nil && !os.IsNotExist(err) {
+		return state, err
+	} else if err == nil {
+		if len(data) < 8 {
+			return state, ErrCorruptRaftStorage
+		}
+
+		state.Term = binary.BigEndian.Uint64(data)
+		state.VotedFor = string(data[8:])
+	}
+
+	// read snapshot
+	data, err = ioutil.ReadFile(filepath.Join(s.dir, "snapshot"))
+	if err != nil && !os.IsNotExist(err) {
+		return state, err
+	} else if err == nil {
+		if len(data) < 16 {
+			return state, ErrCorruptRaftStorage
+		}
+
+		state.Snapshot = RaftSnapshot{
+			Index: binary.BigEndian.Uint64(data),
+			Term:  binary.BigEndian.Uint64(data[8:]),
+			Data:  data[16:],
+		}
+	}
+
+	// get log size
+	info, err := s.file.Stat()
+	if err != nil {
+		return state, err
+	}
+
+	// read log
+	_, err = s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return state, err
+	}
+
+	// read records
+	s.first = 0
+	s.offsets = nil
+	s.size = 0
+	reader := bufio.NewReader(s.file)
+	for {
+		index, entry, n, err := readRaftRecord(reader, info.Size()-s.size)
+		if err == io.EOF || err == ErrCorruptRaftStorage {
+			break
+		} else if err != nil {
+			return state, err
+		}
+
+		// stop at gaps
+		if s.first == 0 {
+			s.first = index
+		} else if index != s.first+uint64(len(s.offsets)) {
+			break
+		}
+
+		// add record
+		s.offsets = append(s.offsets, s.size)
+		s.size += n
+
+		// add entries that follow the snapshot
+		if index > state.Snapshot.Index {
+			state.Entries = append(state.Entries, entry)
+		}
+	}
+
+	// discard incomplete record
+	err = s.file.Truncate(s.size)
+	if err != nil {
+		return state, err
+	}
+
+	// check that the entries follow the snapshot
+	if len(state.Entries) > 0 && s.first+uint64(len(s.offsets))-uint64(len(state.Entries)) != state.Snapshot.Index+1 {
+		return state, ErrCorruptRaftStorage
+	}
+
+	return state, nil
+}
+
+// SaveState implements the RaftStorage interface.
+func (s *FileRaftStorage) SaveState(term uint64, votedFor string) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// encode state
+	data := make([]byte, 8, 8+len(votedFor))
+	binary.BigEndian.PutUint64(data, term)
+	data = append(data, votedFor...)
+
+	return s.replace("state", data)
+}
+
+// SaveEntries implements the RaftStorage interface.
+func (s *FileRaftStorage) SaveEntries(index uint64, entries []LogEntry) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// drop records from index on
+	if len(s.offsets) > 0 && index < s.first+uint64(len(s.offsets)) {
+		n := uint64(0)
+		if index > s.first {
+			n = index - s.first
+		}
+
+		err := s.truncate(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check entries
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// set first index of empty logs
+	if len(s.offsets) == 0 {
+		s.first = index
+	}
+
+	// encode records
+	var buf []byte
+	offsets := make([]int64, 0, len(entries))
+	for i, entry := range entries {
+		offsets = append(offsets, s.size+int64(len(buf)))
+		buf = appendRaftRecord(buf, index+uint64(i), entry)
+	}
+
+	// write records
+	_, err := s.file.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	// sync file
+	err = s.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	// update state
+	s.offsets = append(s.offsets, offsets...)
+	s.size += int64(len(buf))
+
+	return nil
+}
+
+// SaveSnapshot implements the RaftStorage interface.
+func (s *FileRaftStorage) SaveSnapshot(snapshot RaftSnapshot) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// encode snapshot
+	data := make([]byte, 16, 16+len(snapshot.Data))
+	binary.BigEndian.PutUint64(data, snapshot.Index)
+	binary.BigEndian.PutUint64(data[8:], snapshot.Term)
+	data = append(data, snapshot.Data...)
+
+	// write snapshot
+	err := s.replace("snapshot", data)
+	if err != nil {
+		return err
+	}
+
+	// check records
+	if len(s.offsets) == 0 || snapshot.Index < s.first {
+		return nil
+	}
+
+	// drop all records if the snapshot covers them
+	n := snapshot.Index - s.first + 1
+	if n >= uint64(len(s.offsets)) {
+		return s.truncate(0)
+	}
+
+	return s.compact(n)
+}
+
+// Close will close the storage.
+func (s *FileRaftStorage) Close() error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.file.Close()
+}
+
+// truncate will drop all records from the specified position on.
+func (s *FileRaftStorage) truncate(n uint64) error {
+	// get offset
+	offset := s.offsets[n]
+
+	// truncate file
+	err := s.file.Truncate(offset)
+	if err != nil {
+		return err
+	}
+
+	// sync file
+	err = s.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	// update state
+	s.offsets = s.offsets[:n]
+	s.size = offset
+
+	return nil
+}
+
+// compact will rewrite the log without the records before the specified
+// position.
+func (s *FileRaftStorage) compact(n uint64) error {
+	// read remaining records
+	offset := s.offsets[n]
+	data := make([]byte, s.size-offset)
+	_, err := s.file.ReadAt(data, offset)
+	if err != nil {
+		return err
+	}
+
+	// replace log
+	err = s.replace("log", data)
+	if err != nil {
+		return err
+	}
+
+	// reopen log
+	file, err := os.OpenFile(filepath.Join(s.dir, "log"), os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// close old log
+	_ = s.file.Close()
+
+	// update state
+	s.file = file
+	s.first += n
+	offsets := make([]int64, 0, len(s.offsets)-int(n))
+	for _, o := range s.offsets[n:] {
+		offsets = append(offsets, o-offset)
+	}
+	s.offsets = offsets
+	s.size -= offset
+
+	return nil
+}
+
+// replace will atomically replace the named file with the data.
+func (s *FileRaftStorage) replace(name string, data []byte) error {
+	// create temporary file
+	path := filepath.Join(s.dir, name)
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// write data
+	_, err = file.Write(data)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// sync file
+	err = file.Sync()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// close file
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func appendRaftRecord(buf []byte, index uint64, entry LogEntry) []byte {
+	// prepare record
+	start := len(buf)
+	buf = append(buf, make([]byte, raftRecordHeaderLen+16)...)
+	binary.BigEndian.PutUint64(buf[start+raftRecordHeaderLen:], index)
+	binary.BigEndian.PutUint64(buf[start+raftRecordHeaderLen+8:], entry.Term)
+	buf = append(buf, entry.Data...)
+
+	// write header
+	record := buf[start+raftRecordHeaderLen:]
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[start+4:], crc32.ChecksumIEEE(record))
+
+	return buf
+}
+
+func readRaftRecord(reader io.Reader, remaining int64) (uint64, LogEntry, int64, error) {
+	// read header
+	var header [raftRecordHeaderLen]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err == io.EOF {
+		return 0, LogEntry{}, 0, io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return 0, LogEntry{}, 0, ErrCorruptRaftStorage
+	} else if err != nil {
+		return 0, LogEntry{}, 0, err
+	}
+
+	// check length
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 16 || raftRecordHeaderLen+int64(length) > remaining {
+		return 0, LogEntry{}, 0, ErrCorruptRaftStorage
+	}
+
+	// read record
+	record := make([]byte, length)
+	_, err = io.ReadFull(reader, record)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, LogEntry{}, 0, ErrCorruptRaftStorage
+	} else if err != nil {
+		return 0, LogEntry{}, 0, err
+	}
+
+	// verify checksum
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, LogEntry{}, 0, ErrCorruptRaftStorage
+	}
+
+	// decode record
+	index := binary.BigEndian.Uint64(record)
+	entry := LogEntry{Term: binary.BigEndian.Uint64(record[8:])}
+	if len(record) > 16 {
+		entry.Data = record[16:]
+	}
+
+	return index, entry, raftRecordHeaderLen + int64(length), nil
+}
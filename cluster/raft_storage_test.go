@@ -0,0 +1,136 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func raftEntries(term uint64, data ...string) []LogEntry {
+	var entries []LogEntry
+	for _, d := range data {
+		entries = append(entries, LogEntry{Term: term, Data: []byte(d)})
+	}
+
+	return entries
+}
+
+func testRaftStorage(t *testing.T, storage RaftStorage, reopen func() RaftStorage) {
+	state, err := storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, RaftStoredState{}, state)
+
+	// state
+	assert.NoError(t, storage.SaveState(2, "a"))
+
+	// entries
+	assert.NoError(t, storage.SaveEntries(1, raftEntries(1, "1", "2", "3")))
+	assert.NoError(t, storage.SaveEntries(4, raftEntries(2, "4", "5")))
+
+	// conflicting entries
+	assert.NoError(t, storage.SaveEntries(3, raftEntries(2, "3'")))
+
+	state, err = storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, RaftStoredState{
+		Term:     2,
+		VotedFor: "a",
+		Entries:  append(raftEntries(1, "1", "2"), raftEntries(2, "3'")...),
+	}, state)
+
+	// snapshot
+	assert.NoError(t, storage.SaveSnapshot(RaftSnapshot{Index: 2, Term: 1, Data: []byte("12")}))
+	assert.NoError(t, storage.SaveEntries(4, raftEntries(2, "4")))
+
+	storage = reopen()
+
+	state, err = storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, RaftStoredState{
+		Term:     2,
+		VotedFor: "a",
+		Snapshot: RaftSnapshot{Index: 2, Term: 1, Data: []byte("12")},
+		Entries:  raftEntries(2, "3'", "4"),
+	}, state)
+
+	// snapshot beyond log
+	assert.NoError(t, storage.SaveSnapshot(RaftSnapshot{Index: 10, Term: 3, Data: []byte("all")}))
+	assert.NoError(t, storage.SaveEntries(11, raftEntries(3, "11")))
+
+	storage = reopen()
+
+	state, err = storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, RaftStoredState{
+		Term:     2,
+		VotedFor: "a",
+		Snapshot: RaftSnapshot{Index: 10, Term: 3, Data: []byte("all")},
+		Entries:  raftEntries(3, "11"),
+	}, state)
+}
+
+func TestMemoryRaftStorage(t *testing.T) {
+	storage := NewMemoryRaftStorage()
+
+	testRaftStorage(t, storage, func() RaftStorage {
+		return storage
+	})
+}
+
+func TestFileRaftStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := OpenFileRaftStorage(dir)
+	require.NoError(t, err)
+
+	testRaftStorage(t, storage, func() RaftStorage {
+		assert.NoError(t, storage.Close())
+
+		storage, err = OpenFileRaftStorage(dir)
+		require.NoError(t, err)
+
+		return storage
+	})
+
+	assert.NoError(t, storage.Close())
+}
+
+func TestFileRaftStorageIncompleteRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := OpenFileRaftStorage(dir)
+	require.NoError(t, err)
+
+	assert.NoError(t, storage.SaveEntries(1, raftEntries(1, "1", "2")))
+	assert.NoError(t, storage.Close())
+
+	// append partial record
+	file, err := os.OpenFile(filepath.Join(dir, "log"), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 42, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	storage, err = OpenFileRaftStorage(dir)
+	require.NoError(t, err)
+
+	state, err := storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, raftEntries(1, "1", "2"), state.Entries)
+
+	assert.NoError(t, storage.SaveEntries(3, raftEntries(1, "3")))
+
+	state, err = storage.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, raftEntries(1, "1", "2", "3"), state.Entries)
+
+	assert.NoError(t, storage.Close())
+}
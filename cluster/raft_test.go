@@ -0,0 +1,364 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnreachable = errors.New("unreachable")
+
+type raftNetwork struct {
+	members map[string]*Raft
+	down    map[string]bool
+	mutex   sync.Mutex
+}
+
+func (n *raftNetwork) get(from, to string) (*Raft, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.down[from] || n.down[to] {
+		return nil, errUnreachable
+	}
+
+	return n.members[to], nil
+}
+
+func (n *raftNetwork) transport(from string) RaftTransport {
+	return &raftTransport{network: n, from: from}
+}
+
+type raftTransport struct {
+	network *raftNetwork
+	from    string
+}
+
+func (t *raftTransport) RequestVote(member string, req VoteRequest) (VoteResponse, error) {
+	r, err := t.network.get(t.from, member)
+	if err != nil {
+		return VoteResponse{}, err
+	}
+
+	return r.HandleRequestVote(req), nil
+}
+
+func (t *raftTransport) AppendEntries(member string, req AppendRequest) (AppendResponse, error) {
+	r, err := t.network.get(t.from, member)
+	if err != nil {
+		return AppendResponse{}, err
+	}
+
+	return r.HandleAppendEntries(req), nil
+}
+
+func (t *raftTransport) InstallSnapshot(member string, req SnapshotRequest) (SnapshotResponse, error) {
+	r, err := t.network.get(t.from, member)
+	if err != nil {
+		return SnapshotResponse{}, err
+	}
+
+	return r.HandleInstallSnapshot(req), nil
+}
+
+func (t *raftTransport) Forward(member string, data []byte) error {
+	r, err := t.network.get(t.from, member)
+	if err != nil {
+		return err
+	}
+
+	return r.Propose(data)
+}
+
+type raftLog struct {
+	entries []string
+	mutex   sync.Mutex
+}
+
+func (l *raftLog) apply(data []byte) {
+	l.mutex.Lock()
+	l.entries = append(l.entries, string(data))
+	l.mutex.Unlock()
+}
+
+func (l *raftLog) snapshot() []byte {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return []byte(strings.Join(l.entries, ","))
+}
+
+func (l *raftLog) restore(data []byte) {
+	l.mutex.Lock()
+	l.entries = strings.Split(string(data), ",")
+	l.mutex.Unlock()
+}
+
+func (l *raftLog) get() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]string(nil), l.entries...)
+}
+
+func waitLeader(t *testing.T, members map[string]*Raft, exclude string) string {
+	for i := 0; i < 500; i++ {
+		// collect known leaders
+		leaders := make(map[string]bool)
+		for name, r := range members {
+			if name != exclude {
+				_, _, leader := r.State()
+				leaders[leader] = true
+			}
+		}
+
+		// check agreement
+		if len(leaders) == 1 {
+			for leader := range leaders {
+				if leader != "" && leader != exclude {
+					if state, _, _ := members[leader].State(); state == Leader {
+						return leader
+					}
+				}
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("no leader elected")
+
+	return ""
+}
+
+func waitLog(t *testing.T, log *raftLog, expected []string) {
+	for i := 0; i < 500 && len(log.get()) < len(expected); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, expected, log.get())
+}
+
+func TestRaft(t *testing.T) {
+	network := &raftNetwork{
+		members: make(map[string]*Raft),
+		down:    make(map[string]bool),
+	}
+
+	names := []string{"a", "b", "c"}
+	logs := make(map[string]*raftLog)
+	for _, name := range names {
+		var peers []string
+		for _, peer := range names {
+			if peer != name {
+				peers = append(peers, peer)
+			}
+		}
+
+		r := NewRaft(name, peers, network.transport(name), NewMemoryRaftStorage())
+		r.ElectionTimeout = 50 * time.Millisecond
+		r.HeartbeatInterval = 10 * time.Millisecond
+
+		logs[name] = &raftLog{}
+		r.Apply = logs[name].apply
+
+		network.members[name] = r
+	}
+
+	for _, r := range network.members {
+		require.NoError(t, r.Start())
+	}
+
+	leader := waitLeader(t, network.members, "")
+
+	// propose on leader and followers
+	var expected []string
+	for i, name := range names {
+		data := fmt.Sprintf("entry%d", i)
+		require.NoError(t, network.members[name].Propose([]byte(data)))
+		expected = append(expected, data)
+	}
+
+	for _, name := range names {
+		waitLog(t, logs[name], expected)
+	}
+
+	// fail leader
+	network.mutex.Lock()
+	network.down[leader] = true
+	network.mutex.Unlock()
+
+	newLeader := waitLeader(t, network.members, leader)
+	assert.NotEqual(t, leader, newLeader)
+
+	require.NoError(t, network.members[newLeader].Propose([]byte("entry3")))
+	expected = append(expected, "entry3")
+
+	for _, name := range names {
+		if name != leader {
+			waitLog(t, logs[name], expected)
+		}
+	}
+
+	// recover old leader
+	network.mutex.Lock()
+	network.down[leader] = false
+	network.mutex.Unlock()
+
+	waitLog(t, logs[leader], expected)
+
+	for _, r := range network.members {
+		r.Close()
+	}
+}
+
+func TestRaftSingle(t *testing.T) {
+	log := &raftLog{}
+
+	r := NewRaft("a", nil, nil, NewMemoryRaftStorage())
+	r.ElectionTimeout = 10 * time.Millisecond
+	r.Apply = log.apply
+	require.NoError(t, r.Start())
+
+	assert.Equal(t, ErrNoLeader, r.Propose([]byte("foo")))
+
+	waitLeader(t, map[string]*Raft{"a": r}, "")
+
+	require.NoError(t, r.Propose([]byte("foo")))
+	assert.Equal(t, []string{"foo"}, log.get())
+
+	r.Close()
+}
+
+func TestRaftSnapshot(t *testing.T) {
+	network := &raftNetwork{
+		members: make(map[string]*Raft),
+		down:    make(map[string]bool),
+	}
+
+	names := []string{"a", "b", "c"}
+	logs := make(map[string]*raftLog)
+	for _, name := range names {
+		var peers []string
+		for _, peer := range names {
+			if peer != name {
+				peers = append(peers, peer)
+			}
+		}
+
+		r := NewRaft(name, peers, network.transport(name), NewMemoryRaftStorage())
+		r.ElectionTimeout = 50 * time.Millisecond
+		r.HeartbeatInterval = 10 * time.Millisecond
+		r.SnapshotThreshold = 2
+
+		logs[name] = &raftLog{}
+		r.Apply = logs[name].apply
+		r.Snapshot = logs[name].snapshot
+		r.Restore = logs[name].restore
+
+		network.members[name] = r
+	}
+
+	for _, r := range network.members {
+		require.NoError(t, r.Start())
+	}
+
+	leader := waitLeader(t, network.members, "")
+
+	// fail a follower
+	var follower string
+	for _, name := range names {
+		if name != leader {
+			follower = name
+			break
+		}
+	}
+
+	network.mutex.Lock()
+	network.down[follower] = true
+	network.mutex.Unlock()
+
+	// propose entries that are compacted on the leader
+	var expected []string
+	for i := 0; i < 10; i++ {
+		data := fmt.Sprintf("entry%d", i)
+		require.NoError(t, network.members[leader].Propose([]byte(data)))
+		expected = append(expected, data)
+	}
+
+	network.members[leader].mutex.Lock()
+	assert.True(t, network.members[leader].snapshot.Index > 0)
+	network.members[leader].mutex.Unlock()
+
+	// recover follower from snapshot
+	network.mutex.Lock()
+	network.down[follower] = false
+	network.mutex.Unlock()
+
+	for _, name := range names {
+		waitLog(t, logs[name], expected)
+	}
+
+	for _, r := range network.members {
+		r.Close()
+	}
+}
+
+func TestRaftRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := OpenFileRaftStorage(dir)
+	require.NoError(t, err)
+
+	log := &raftLog{}
+
+	r := NewRaft("a", nil, nil, storage)
+	r.ElectionTimeout = 10 * time.Millisecond
+	r.SnapshotThreshold = 2
+	r.Apply = log.apply
+	r.Snapshot = log.snapshot
+	r.Restore = log.restore
+	require.NoError(t, r.Start())
+
+	waitLeader(t, map[string]*Raft{"a": r}, "")
+
+	require.NoError(t, r.Propose([]byte("foo")))
+	require.NoError(t, r.Propose([]byte("bar")))
+	require.NoError(t, r.Propose([]byte("baz")))
+
+	_, term, _ := r.State()
+
+	r.Close()
+	require.NoError(t, storage.Close())
+
+	// restart with the stored state
+	storage, err = OpenFileRaftStorage(dir)
+	require.NoError(t, err)
+
+	log = &raftLog{}
+
+	r = NewRaft("a", nil, nil, storage)
+	r.ElectionTimeout = 10 * time.Millisecond
+	r.Apply = log.apply
+	r.Restore = log.restore
+	require.NoError(t, r.Start())
+
+	_, restarted, _ := r.State()
+	assert.Equal(t, term, restarted)
+
+	waitLeader(t, map[string]*Raft{"a": r}, "")
+	waitLog(t, log, []string{"foo", "bar", "baz"})
+
+	r.Close()
+	require.NoError(t, storage.Close())
+}
@@ -0,0 +1,130 @@
+// Package cluster implements the building blocks to run several brokers as a
+// cluster.
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// A Node is a member of the cluster.
+type Node struct {
+	// The unique name of the node.
+	Name string
+
+	// The address other nodes use to reach the node.
+	Addr string
+}
+
+// A Ring maps keys to nodes using rendezvous hashing. Every key is owned by
+// the node with the highest score for the key. When a node is added or
+// removed, only the keys owned by that node change their owner.
+type Ring struct {
+	nodes map[string]Node
+	mutex sync.RWMutex
+}
+
+// NewRing returns a new ring with the specified nodes.
+func NewRing(nodes ...Node) *Ring {
+	// create ring
+	r := &Ring{
+		nodes: make(map[string]Node),
+	}
+
+	// add nodes
+	for _, node := range nodes {
+		r.nodes[node.Name] = node
+	}
+
+	return r
+}
+
+// Add will add the node to the ring. An existing node with the same name is
+// replaced.
+func (r *Ring) Add(node Node) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.nodes[node.Name] = node
+}
+
+// Remove will remove the node with the specified name from the ring.
+func (r *Ring) Remove(name string) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.nodes, name)
+}
+
+// Get will return the node with the specified name.
+func (r *Ring) Get(name string) (Node, bool) {
+	// acquire mutex
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	node, ok := r.nodes[name]
+
+	return node, ok
+}
+
+// Nodes will return all nodes sorted by their name.
+func (r *Ring) Nodes() []Node {
+	// acquire mutex
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	// collect nodes
+	list := make([]Node, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		list = append(list, node)
+	}
+
+	// sort nodes
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// Owner will return the node that owns the key. False is returned if the ring
+// is empty.
+func (r *Ring) Owner(key string) (Node, bool) {
+	// acquire mutex
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	// find node with highest score
+	var owner Node
+	var best uint64
+	found := false
+	for name, node := range r.nodes {
+		s := score(name, key)
+		if !found || s > best || (s == best && name < owner.Name) {
+			owner, best, found = node, s, true
+		}
+	}
+
+	return owner, found
+}
+
+func score(node, key string) uint64 {
+	// hash node and key
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(node))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(key))
+
+	// mix bits as fnv distributes similar inputs poorly
+	x := hash.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
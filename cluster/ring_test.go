@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing()
+
+	_, ok := ring.Owner("foo")
+	assert.False(t, ok)
+
+	ring.Add(Node{Name: "a"})
+	ring.Add(Node{Name: "b"})
+	ring.Add(Node{Name: "c"})
+	assert.Len(t, ring.Nodes(), 3)
+
+	// count keys per node
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("client%d", i)
+		owner, ok := ring.Owner(key)
+		assert.True(t, ok)
+		owners[key] = owner.Name
+		counts[owner.Name]++
+	}
+	for _, count := range counts {
+		assert.True(t, count > 800, count)
+	}
+
+	// only the keys of the removed node move
+	ring.Remove("b")
+	for key, name := range owners {
+		owner, _ := ring.Owner(key)
+		if name != "b" {
+			assert.Equal(t, name, owner.Name)
+		} else {
+			assert.NotEqual(t, "b", owner.Name)
+		}
+	}
+}
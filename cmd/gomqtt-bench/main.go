@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/beorn7/perks/quantile"
+	"github.com/juju/ratelimit"
+)
+
+var broker = flag.String("broker", "tcp://0.0.0.0:1883", "broker url")
+var prefix = flag.String("prefix", "gomqtt-bench", "topic prefix")
+var publishers = flag.Int("publishers", 1, "number of publishers")
+var subscribers = flag.Int("subscribers", 1, "number of subscribers")
+var duration = flag.Duration("duration", 10*time.Second, "benchmark duration")
+var publishRate = flag.Int("rate", 0, "messages per second per publisher (0 = unlimited)")
+var payloadSize = flag.Int("payload", 16, "message payload size (at least 8 bytes)")
+var qos = flag.Int("qos", 0, "message qos")
+var inflight = flag.Int("inflight", 10, "number of inflight messages per publisher")
+
+var published int64
+var received int64
+
+var latencies = quantile.NewTargeted(map[float64]float64{
+	0.50: 0.005,
+	0.90: 0.001,
+	0.99: 0.0001,
+})
+var maxLatency time.Duration
+var latencyMutex sync.Mutex
+
+var done = make(chan struct{})
+
+func main() {
+	flag.Parse()
+
+	// check payload size
+	if *payloadSize < 8 {
+		*payloadSize = 8
+	}
+
+	fmt.Printf("Start benchmark of %s with %d publishers and %d subscribers for %s...\n", *broker, *publishers, *subscribers, *duration)
+
+	// connect subscribers first to not miss messages
+	var clients []*client.Client
+	for i := 0; i < *subscribers; i++ {
+		clients = append(clients, subscriber(strconv.Itoa(i)))
+	}
+
+	// start publishers
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *publishers; i++ {
+		wg.Add(1)
+		go publisher(strconv.Itoa(i), &wg)
+	}
+
+	// run reporter
+	go reporter()
+
+	// wait for duration or signal
+	finish := make(chan os.Signal, 1)
+	signal.Notify(finish, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-time.After(*duration):
+	case <-finish:
+	}
+
+	// stop publishers
+	close(done)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// allow subscribers to drain
+	time.Sleep(time.Second)
+
+	// disconnect subscribers
+	for _, cl := range clients {
+		_ = cl.Disconnect()
+	}
+
+	// print summary
+	summary(elapsed)
+}
+
+func connect(id string) *client.Client {
+	cl := client.New()
+
+	cfg := client.NewConfig(*broker)
+	cfg.ClientID = "gomqtt-bench/" + id
+
+	cf, err := cl.Connect(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	err = cf.Wait(5 * time.Second)
+	if err != nil {
+		panic(err)
+	}
+
+	return cl
+}
+
+func subscriber(id string) *client.Client {
+	cl := client.New()
+
+	cl.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			panic(err)
+		}
+
+		// calculate latency
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(msg.Payload)))
+		latency := time.Since(sent)
+
+		// record latency
+		latencyMutex.Lock()
+		latencies.Insert(float64(latency))
+		if latency > maxLatency {
+			maxLatency = latency
+		}
+		latencyMutex.Unlock()
+
+		atomic.AddInt64(&received, 1)
+
+		return nil
+	}
+
+	cfg := client.NewConfig(*broker)
+	cfg.ClientID = "gomqtt-bench/subscriber/" + id
+
+	cf, err := cl.Connect(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	err = cf.Wait(5 * time.Second)
+	if err != nil {
+		panic(err)
+	}
+
+	sf, err := cl.Subscribe(*prefix+"/#", packet.QOS(*qos))
+	if err != nil {
+		panic(err)
+	}
+
+	err = sf.Wait(5 * time.Second)
+	if err != nil {
+		panic(err)
+	}
+
+	return cl
+}
+
+func publisher(id string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	cl := connect("publisher/" + id)
+	topic := *prefix + "/" + id
+
+	var bucket *ratelimit.Bucket
+	if *publishRate > 0 {
+		bucket = ratelimit.NewBucketWithRate(float64(*publishRate), int64(*publishRate))
+	}
+
+	futures := make(chan client.GenericFuture, *inflight)
+
+	go func() {
+		defer close(futures)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if bucket != nil {
+				bucket.Wait(1)
+			}
+
+			// stamp payload with the current time
+			payload := make([]byte, *payloadSize)
+			binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+
+			pf, err := cl.Publish(topic, payload, packet.QOS(*qos), false)
+			if err != nil {
+				panic(err)
+			}
+
+			futures <- pf
+		}
+	}()
+
+	for pf := range futures {
+		err := pf.Wait(5 * time.Second)
+		if err != nil {
+			panic(err)
+		}
+
+		atomic.AddInt64(&published, 1)
+	}
+
+	_ = cl.Disconnect()
+}
+
+func reporter() {
+	var lastPublished, lastReceived int64
+
+	for {
+		select {
+		case <-time.After(time.Second):
+		case <-done:
+			return
+		}
+
+		curPublished := atomic.LoadInt64(&published)
+		curReceived := atomic.LoadInt64(&received)
+
+		fmt.Printf("Published: %d msg/s - Received: %d msg/s\n", curPublished-lastPublished, curReceived-lastReceived)
+
+		lastPublished = curPublished
+		lastReceived = curReceived
+	}
+}
+
+func summary(elapsed time.Duration) {
+	totalPublished := atomic.LoadInt64(&published)
+	totalReceived := atomic.LoadInt64(&received)
+	expected := totalPublished * int64(*subscribers)
+
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+
+	fmt.Println("Summary:")
+	fmt.Printf("  Duration:   %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("  Published:  %d msgs (%.0f msg/s)\n", totalPublished, float64(totalPublished)/elapsed.Seconds())
+	fmt.Printf("  Received:   %d msgs (%.0f msg/s)\n", totalReceived, float64(totalReceived)/elapsed.Seconds())
+	fmt.Printf("  Missing:    %d msgs\n", expected-totalReceived)
+	fmt.Printf("  Latency:    p50: %s, p90: %s, p99: %s, max: %s\n",
+		time.Duration(latencies.Query(0.50)), time.Duration(latencies.Query(0.90)),
+		time.Duration(latencies.Query(0.99)), maxLatency)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+var broker = flag.String("broker", "tcp://0.0.0.0:1883", "broker url")
+var prefix = flag.String("prefix", "gomqtt-loadgen", "client id and topic prefix")
+var stages = flag.String("stages", "10s:10,20s:10,10s:0", "comma separated ramp stages (duration:connections)")
+var interval = flag.Duration("interval", time.Second, "publish interval per device")
+var payloadSize = flag.Int("payload", 16, "message payload size")
+var qos = flag.Uint("qos", 0, "message qos")
+var silent = flag.Float64("silent", 0, "fraction of devices that connect but never publish")
+var storm = flag.Duration("storm", 0, "interval of reconnect storms (0 = disabled)")
+var report = flag.String("report", "", "file to write the json report to (- for stdout)")
+var seed = flag.Int64("seed", 1, "random seed")
+
+type stage struct {
+	duration time.Duration
+	target   int
+}
+
+type sample struct {
+	Time          float64 `json:"time"`
+	Target        int     `json:"target"`
+	Connected     int64   `json:"connected"`
+	Published     int64   `json:"published"`
+	Connects      int64   `json:"connects"`
+	ConnectErrors int64   `json:"connect_errors"`
+	PublishErrors int64   `json:"publish_errors"`
+	Disconnects   int64   `json:"disconnects"`
+}
+
+type result struct {
+	Broker   string   `json:"broker"`
+	Started  string   `json:"started"`
+	Duration float64  `json:"duration"`
+	Storms   int      `json:"storms"`
+	Totals   sample   `json:"totals"`
+	Samples  []sample `json:"samples"`
+}
+
+var connected int64
+var published int64
+var connects int64
+var connectErrors int64
+var publishErrors int64
+var disconnects int64
+
+type device struct {
+	id     string
+	silent bool
+	stop   chan struct{}
+	reset  chan struct{}
+	done   chan struct{}
+}
+
+func main() {
+	flag.Parse()
+
+	// parse stages
+	profile, err := parseStages(*stages)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+
+	// get total duration
+	var total time.Duration
+	for _, s := range profile {
+		total += s.duration
+	}
+
+	fmt.Printf("Start load generation against %s for %s...\n", *broker, total)
+
+	// prepare signal
+	finish := make(chan os.Signal, 1)
+	signal.Notify(finish, syscall.SIGINT, syscall.SIGTERM)
+
+	// prepare state
+	rnd := rand.New(rand.NewSource(*seed))
+	var devices []*device
+	var retired []*device
+	var samples []sample
+	var storms int
+	counter := 0
+	start := time.Now()
+	lastSample := start
+	lastStorm := start
+
+	// run control loop
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+		case <-finish:
+			break loop
+		}
+
+		// get elapsed time
+		elapsed := time.Since(start)
+		if elapsed >= total {
+			break loop
+		}
+
+		// get target
+		target := targetAt(profile, elapsed)
+
+		// add devices
+		for len(devices) < target {
+			counter++
+			d := &device{
+				id:     *prefix + "/" + strconv.Itoa(counter),
+				silent: rnd.Float64() < *silent,
+				stop:   make(chan struct{}),
+				reset:  make(chan struct{}, 1),
+				done:   make(chan struct{}),
+			}
+
+			go d.run()
+			devices = append(devices, d)
+		}
+
+		// remove devices
+		for len(devices) > target {
+			d := devices[len(devices)-1]
+			devices = devices[:len(devices)-1]
+			retired = append(retired, d)
+			close(d.stop)
+		}
+
+		// trigger reconnect storm
+		if *storm > 0 && time.Since(lastStorm) >= *storm {
+			lastStorm = time.Now()
+			storms++
+
+			for _, d := range devices {
+				select {
+				case d.reset <- struct{}{}:
+				default:
+				}
+			}
+		}
+
+		// record sample
+		if time.Since(lastSample) >= time.Second {
+			lastSample = time.Now()
+			s := snapshot(elapsed, target)
+			samples = append(samples, s)
+
+			fmt.Printf("[%3.0fs] target: %d, connected: %d, published: %d, errors: %d/%d\n",
+				s.Time, s.Target, s.Connected, s.Published, s.ConnectErrors, s.PublishErrors)
+		}
+	}
+
+	// stop all devices
+	for _, d := range devices {
+		close(d.stop)
+	}
+	for _, d := range append(devices, retired...) {
+		<-d.done
+	}
+
+	// write report
+	if *report != "" {
+		err = writeReport(result{
+			Broker:   *broker,
+			Started:  start.UTC().Format(time.RFC3339),
+			Duration: time.Since(start).Seconds(),
+			Storms:   storms,
+			Totals:   snapshot(time.Since(start), 0),
+			Samples:  samples,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func parseStages(str string) ([]stage, error) {
+	var list []stage
+
+	for _, item := range strings.Split(str, ",") {
+		// split item
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, errors.New("invalid stage " + item)
+		}
+
+		// parse duration
+		d, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		// parse target
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid connections in stage " + item)
+		}
+
+		list = append(list, stage{duration: d, target: n})
+	}
+
+	return list, nil
+}
+
+// targetAt linearly interpolates the number of connections between the end
+// of the previous stage and the target of the current stage.
+func targetAt(profile []stage, elapsed time.Duration) int {
+	from := 0
+
+	for _, s := range profile {
+		if elapsed < s.duration {
+			progress := float64(elapsed) / float64(s.duration)
+			return from + int(float64(s.target-from)*progress)
+		}
+
+		elapsed -= s.duration
+		from = s.target
+	}
+
+	return from
+}
+
+func snapshot(elapsed time.Duration, target int) sample {
+	return sample{
+		Time:          elapsed.Seconds(),
+		Target:        target,
+		Connected:     atomic.LoadInt64(&connected),
+		Published:     atomic.LoadInt64(&published),
+		Connects:      atomic.LoadInt64(&connects),
+		ConnectErrors: atomic.LoadInt64(&connectErrors),
+		PublishErrors: atomic.LoadInt64(&publishErrors),
+		Disconnects:   atomic.LoadInt64(&disconnects),
+	}
+}
+
+func writeReport(r result) error {
+	// encode report
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to stdout
+	if *report == "-" {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	return ioutil.WriteFile(*report, data, 0644)
+}
+
+func (d *device) run() {
+	defer close(d.done)
+
+	for {
+		// connect
+		cl, err := d.connect()
+		if err != nil {
+			atomic.AddInt64(&connectErrors, 1)
+
+			// retry after a second
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-d.stop:
+				return
+			}
+		}
+
+		atomic.AddInt64(&connects, 1)
+		atomic.AddInt64(&connected, 1)
+
+		// publish until stopped or reset
+		reset := d.publish(cl)
+
+		// disconnect
+		_ = cl.Disconnect()
+		atomic.AddInt64(&connected, -1)
+		atomic.AddInt64(&disconnects, 1)
+
+		if !reset {
+			return
+		}
+	}
+}
+
+func (d *device) connect() (*client.Client, error) {
+	cl := client.New()
+
+	cf, err := cl.Connect(client.NewConfigWithClientID(*broker, d.id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cf.Wait(10 * time.Second)
+	if err != nil {
+		_ = cl.Close()
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+// publish returns true if the device should reconnect.
+func (d *device) publish(cl *client.Client) bool {
+	payload := make([]byte, *payloadSize)
+	topic := d.id
+
+	// prepare ticker with a random offset to avoid synchronized publishes
+	offset := time.Duration(rand.Int63n(int64(*interval) + 1))
+	timer := time.NewTimer(offset)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(*interval)
+		case <-d.reset:
+			return true
+		case <-d.stop:
+			return false
+		}
+
+		// silent devices only keep the connection
+		if d.silent {
+			continue
+		}
+
+		pf, err := cl.Publish(topic, payload, packet.QOS(*qos), false)
+		if err == nil {
+			err = pf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			atomic.AddInt64(&publishErrors, 1)
+			return true
+		}
+
+		atomic.AddInt64(&published, 1)
+	}
+}
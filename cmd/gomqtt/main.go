@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+const usage = `Usage: gomqtt <command> [options]
+
+Commands:
+  pub              publish a message
+  sub              subscribe to topics and print received messages
+  clear-retained   clear a retained message
+  clear-session    clear the stored session of a client
+  tree             print the subscription tree served by a broker
+  decode           decode hex, base64 or raw packet frames
+
+Run "gomqtt <command> -h" to list the options of a command.
+`
+
+type options struct {
+	broker   string
+	clientID string
+	timeout  time.Duration
+	caFile   string
+	certFile string
+	keyFile  string
+	insecure bool
+	headers  string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.broker, "broker", "tcp://0.0.0.0:1883", "the broker url (tcp, tls, ws or wss)")
+	fs.StringVar(&o.clientID, "id", "", "the client id")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "the operation timeout")
+	fs.StringVar(&o.caFile, "cafile", "", "the PEM encoded CA certificates to trust")
+	fs.StringVar(&o.certFile, "cert", "", "the PEM encoded client certificate")
+	fs.StringVar(&o.keyFile, "key", "", "the PEM encoded client key")
+	fs.BoolVar(&o.insecure, "insecure", false, "skip server certificate verification")
+	fs.StringVar(&o.headers, "header", "", "comma separated WebSocket request headers (key:value)")
+}
+
+func (o *options) config() (*client.Config, error) {
+	// prepare dialer
+	dialer := transport.NewDialer()
+
+	// prepare tls config
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.insecure,
+	}
+
+	// load ca certificates
+	if o.caFile != "" {
+		data, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in " + o.caFile)
+		}
+	}
+
+	// load client certificate
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dialer.TLSConfig = tlsConfig
+
+	// parse headers
+	if o.headers != "" {
+		dialer.RequestHeader = http.Header{}
+		for _, header := range strings.Split(o.headers, ",") {
+			kv := strings.SplitN(header, ":", 2)
+			if len(kv) != 2 {
+				return nil, errors.New("invalid header " + header)
+			}
+
+			dialer.RequestHeader.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+
+	// prepare config
+	config := client.NewConfigWithClientID(o.broker, o.clientID)
+	config.Dialer = dialer
+
+	return config, nil
+}
+
+func main() {
+	// check command
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// run command
+	var err error
+	switch os.Args[1] {
+	case "pub":
+		err = pub(os.Args[2:])
+	case "sub":
+		err = sub(os.Args[2:])
+	case "clear-retained":
+		err = clearRetained(os.Args[2:])
+	case "clear-session":
+		err = clearSession(os.Args[2:])
+	case "tree":
+		err = tree(os.Args[2:])
+	case "decode":
+		err = decode(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	// handle error
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func pub(args []string) error {
+	// parse flags
+	var opts options
+	fs := flag.NewFlagSet("pub", flag.ExitOnError)
+	opts.register(fs)
+	topic := fs.String("topic", "", "the topic to publish to")
+	payload := fs.String("payload", "", "the payload to publish")
+	file := fs.String("file", "", "read the payload from a file (- for stdin)")
+	qos := fs.Uint("qos", 0, "the qos level")
+	retain := fs.Bool("retain", false, "retain the message")
+	_ = fs.Parse(args)
+
+	// check topic
+	if *topic == "" {
+		return errors.New("missing topic")
+	}
+
+	// prepare message
+	msg := &packet.Message{
+		Topic:   *topic,
+		Payload: []byte(*payload),
+		QOS:     packet.QOS(*qos),
+		Retain:  *retain,
+	}
+
+	// read payload
+	if *file == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		msg.Payload = data
+	} else if *file != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+
+		msg.Payload = data
+	}
+
+	// validate message
+	err := msg.Validate()
+	if err != nil {
+		return err
+	}
+
+	// get config
+	config, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	return client.PublishMessage(config, msg, opts.timeout)
+}
+
+func sub(args []string) error {
+	// parse flags
+	var opts options
+	fs := flag.NewFlagSet("sub", flag.ExitOnError)
+	opts.register(fs)
+	topics := fs.String("topic", "#", "comma separated topic filters to subscribe")
+	qos := fs.Uint("qos", 0, "the qos level")
+	count := fs.Int("count", 0, "exit after receiving the number of messages")
+	verbose := fs.Bool("verbose", false, "print qos and retain flags")
+	_ = fs.Parse(args)
+
+	// get config
+	config, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	// prepare channels
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+
+	// prepare client
+	received := 0
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			errs <- err
+			return nil
+		}
+
+		// print message
+		if *verbose {
+			fmt.Printf("%s (qos: %d, retain: %t) %s\n", msg.Topic, msg.QOS, msg.Retain, msg.Payload)
+		} else {
+			fmt.Printf("%s %s\n", msg.Topic, msg.Payload)
+		}
+
+		// check count
+		received++
+		if *count > 0 && received == *count {
+			close(done)
+		}
+
+		return nil
+	}
+
+	// connect
+	cf, err := c.Connect(config)
+	if err != nil {
+		return err
+	}
+
+	err = cf.Wait(opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	// prepare subscriptions
+	var subs []packet.Subscription
+	for _, topic := range strings.Split(*topics, ",") {
+		subs = append(subs, packet.Subscription{
+			Topic: strings.TrimSpace(topic),
+			QOS:   packet.QOS(*qos),
+		})
+	}
+
+	// subscribe
+	sf, err := c.SubscribeMultiple(subs)
+	if err != nil {
+		return err
+	}
+
+	err = sf.Wait(opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	// wait for signal, count or error
+	finish := make(chan os.Signal, 1)
+	signal.Notify(finish, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-finish:
+	case <-done:
+	case err = <-errs:
+		return err
+	}
+
+	return c.Disconnect()
+}
+
+func clearRetained(args []string) error {
+	// parse flags
+	var opts options
+	fs := flag.NewFlagSet("clear-retained", flag.ExitOnError)
+	opts.register(fs)
+	topic := fs.String("topic", "", "the topic of the retained message")
+	_ = fs.Parse(args)
+
+	// check topic
+	if *topic == "" {
+		return errors.New("missing topic")
+	}
+
+	// get config
+	config, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	return client.ClearRetainedMessage(config, *topic, opts.timeout)
+}
+
+func clearSession(args []string) error {
+	// parse flags
+	var opts options
+	fs := flag.NewFlagSet("clear-session", flag.ExitOnError)
+	opts.register(fs)
+	_ = fs.Parse(args)
+
+	// check id
+	if opts.clientID == "" {
+		return errors.New("missing client id")
+	}
+
+	// get config
+	config, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	return client.ClearSession(config, opts.timeout)
+}
+
+func tree(args []string) error {
+	// parse flags
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	endpoint := fs.String("url", "http://localhost:6060/debug/tree", "the url of the tree handler")
+	prefix := fs.String("prefix", "", "only print the subtree of the topic")
+	dot := fs.Bool("dot", false, "print a graphviz graph")
+	timeout := fs.Duration("timeout", 10*time.Second, "the request timeout")
+	_ = fs.Parse(args)
+
+	// prepare url
+	u, err := url.Parse(*endpoint)
+	if err != nil {
+		return err
+	}
+
+	// set query
+	query := u.Query()
+	if *prefix != "" {
+		query.Set("prefix", *prefix)
+	}
+	if *dot {
+		query.Set("format", "dot")
+	}
+	u.RawQuery = query.Encode()
+
+	// get tree
+	res, err := (&http.Client{Timeout: *timeout}).Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// check status
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status " + res.Status)
+	}
+
+	// print tree
+	_, err = io.Copy(os.Stdout, res.Body)
+
+	return err
+}
+
+func decode(args []string) error {
+	// parse flags
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	file := fs.String("file", "", "read frames or a raw capture from a file (- for stdin)")
+	format := fs.String("format", "auto", "the frame format (auto, hex, base64 or raw)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: gomqtt decode [options] [frames...]\n\n"+
+			"Frames are read from the arguments, the file or stdin. Text input holds\n"+
+			"one frame per line, raw input is decoded as a single stream.\n\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	// check format
+	switch *format {
+	case "auto", "hex", "base64", "raw":
+	default:
+		return errors.New("unknown format " + *format)
+	}
+
+	// get input
+	var input []byte
+	var frames []string
+	if fs.NArg() > 0 {
+		frames = fs.Args()
+	} else {
+		// read input
+		var err error
+		if *file == "" || *file == "-" {
+			input, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			input, err = ioutil.ReadFile(*file)
+		}
+		if err != nil {
+			return err
+		}
+
+		// check raw input
+		if *format == "raw" || (*format == "auto" && !isText(input)) {
+			return decodeFrame("stream", input)
+		}
+
+		// split lines
+		for _, line := range strings.Split(string(input), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				frames = append(frames, line)
+			}
+		}
+	}
+
+	// decode frames
+	failed := 0
+	for i, frame := range frames {
+		// parse frame
+		data, err := parseFrame(frame, *format)
+		if err == nil {
+			err = decodeFrame(fmt.Sprintf("frame %d", i+1), data)
+		}
+
+		// handle error
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "frame %d: error: %s\n", i+1, err)
+			failed++
+		}
+	}
+
+	// check failures
+	if failed > 0 {
+		return fmt.Errorf("failed to decode %d of %d frames", failed, len(frames))
+	}
+
+	return nil
+}
+
+func parseFrame(frame, format string) ([]byte, error) {
+	// raw frames are taken as is
+	if format == "raw" {
+		return []byte(frame), nil
+	}
+
+	// try hex with optional separators
+	if format == "auto" || format == "hex" {
+		str := strings.NewReplacer(" ", "", ":", "", "0x", "").Replace(frame)
+		data, err := hex.DecodeString(str)
+		if err == nil || format == "hex" {
+			return data, err
+		}
+	}
+
+	// try standard and url encoding with and without padding
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		data, err := enc.DecodeString(frame)
+		if err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, errors.New("invalid hex or base64 frame")
+}
+
+func decodeFrame(name string, data []byte) error {
+	// prepare decoder
+	dec := packet.NewDecoder(bytes.NewReader(data))
+
+	// decode packets
+	for i := 1; ; i++ {
+		pkt, err := dec.Read()
+		if err == io.EOF {
+			return nil
+		} else if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("packet %d is incomplete", i)
+		} else if err != nil {
+			return fmt.Errorf("packet %d: %w", i, err)
+		}
+
+		// print packet
+		fmt.Printf("%s packet %d: %s\n", name, i, pkt.String())
+
+		// print payload as text if printable
+		if publish, ok := pkt.(*packet.Publish); ok && len(publish.Message.Payload) > 0 && isText(publish.Message.Payload) {
+			fmt.Printf("  payload: %s\n", publish.Message.Payload)
+		}
+	}
+}
+
+func isText(data []byte) bool {
+	// check runes
+	for _, r := range string(data) {
+		if r == unicode.ReplacementChar || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,394 @@
+// Package coap implements a gateway that translates CoAP requests into MQTT
+// publishes and subscriptions on a broker.
+//
+// PUT and POST requests publish their payload to the topic formed by the
+// Uri-Path options. The Uri-Query options "qos=0|1|2" and "retain" may be used
+// to configure the message. GET requests with an Observe option of 0 register
+// an observer for the topic filter formed by the Uri-Path options, which then
+// receives every matching message as a non-confirmable notification. An
+// Observe option of 1 or a reset message in response to a notification
+// removes the observer.
+//
+// All requests are handled using a single connection to the broker. Duplicate
+// confirmable requests are not detected and may be published more than once.
+package coap
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+type observer struct {
+	key       string
+	addr      net.Addr
+	token     []byte
+	filter    string
+	seq       uint32
+	messageID uint16
+}
+
+// A Gateway forwards CoAP requests to a broker.
+type Gateway struct {
+	// The URL of the broker.
+	BrokerURL string
+
+	// The dialer used to connect to the broker.
+	Dialer client.Dialer
+
+	// The client id used to connect to the broker.
+	ClientID string
+
+	// The QOS level used to subscribe topic filters of observers.
+	QOS packet.QOS
+
+	// The timeout for acknowledgements from the broker.
+	//
+	// Will default to 10 seconds.
+	Timeout time.Duration
+
+	conn      net.PacketConn
+	service   *client.Service
+	observers map[string]*observer
+	filters   *topic.Tree
+	messageID uint16
+	closed    bool
+	mutex     sync.Mutex
+}
+
+// NewGateway returns a new Gateway that forwards requests to the specified
+// broker.
+func NewGateway(brokerURL string) *Gateway {
+	return &Gateway{
+		BrokerURL: brokerURL,
+		Timeout:   10 * time.Second,
+		observers: make(map[string]*observer),
+		filters:   topic.NewTree(),
+	}
+}
+
+// Serve will connect to the broker and read and handle requests from the
+// connection until the gateway is closed or an error occurs.
+func (g *Gateway) Serve(conn net.PacketConn) error {
+	// prepare config
+	config := client.NewConfigWithClientID(g.BrokerURL, g.ClientID)
+	config.Dialer = g.Dialer
+
+	// start service
+	g.mutex.Lock()
+	g.conn = conn
+	g.service = client.NewService()
+	g.service.MessageCallback = g.notify
+	g.service.Start(config)
+	g.mutex.Unlock()
+
+	buf := make([]byte, 65536)
+
+	for {
+		// read datagram
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			// acquire mutex
+			g.mutex.Lock()
+			defer g.mutex.Unlock()
+
+			// ignore error if closed
+			if g.closed {
+				return nil
+			}
+
+			return err
+		}
+
+		// decode message, invalid messages are ignored
+		msg, err := Decode(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+
+		// handle message
+		g.handle(addr, msg)
+	}
+}
+
+// Close will close the connection and disconnect from the broker.
+func (g *Gateway) Close() error {
+	// acquire mutex
+	g.mutex.Lock()
+	g.closed = true
+	conn := g.conn
+	service := g.service
+	g.mutex.Unlock()
+
+	// stop service
+	if service != nil {
+		service.Stop(true)
+	}
+
+	// close connection
+	if conn != nil {
+		return conn.Close()
+	}
+
+	return nil
+}
+
+func (g *Gateway) handle(addr net.Addr, msg *Message) {
+	// handle resets
+	if msg.Type == Reset {
+		g.reset(addr, msg.MessageID)
+		return
+	}
+
+	// ignore acknowledgements and other responses
+	if msg.Type == Acknowledgement || msg.Code == Empty || msg.Code > DELETE {
+		return
+	}
+
+	switch msg.Code {
+	case PUT, POST:
+		g.publish(addr, msg)
+	case GET:
+		g.observe(addr, msg)
+	default:
+		g.respond(addr, msg, &Message{Code: MethodNotAllowed})
+	}
+}
+
+func (g *Gateway) publish(addr net.Addr, req *Message) {
+	// prepare message
+	msg := &packet.Message{
+		Topic:   req.Path(),
+		Payload: req.Payload,
+	}
+
+	// parse queries
+	for _, query := range req.Queries() {
+		switch query {
+		case "qos=0", "qos=1", "qos=2":
+			msg.QOS = packet.QOS(query[4] - '0')
+		case "retain":
+			msg.Retain = true
+		default:
+			g.respond(addr, req, &Message{Code: BadRequest})
+			return
+		}
+	}
+
+	// check topic
+	if msg.Topic == "" || strings.ContainsAny(msg.Topic, "+#") {
+		g.respond(addr, req, &Message{Code: BadRequest})
+		return
+	}
+
+	// publish message
+	pf := g.service.PublishMessage(msg)
+
+	// respond once acknowledged
+	go func() {
+		code := Changed
+		if pf.Wait(g.Timeout) != nil {
+			code = GatewayTimeout
+		}
+
+		g.respond(addr, req, &Message{Code: code})
+	}()
+}
+
+func (g *Gateway) observe(addr net.Addr, req *Message) {
+	// get observe option
+	value, ok := req.Option(ObserveOption)
+	if !ok {
+		g.respond(addr, req, &Message{Code: MethodNotAllowed})
+		return
+	}
+
+	// check filter
+	filter := req.Path()
+	if filter == "" {
+		g.respond(addr, req, &Message{Code: BadRequest})
+		return
+	}
+
+	// get key
+	key := addr.String() + "/" + string(req.Token)
+
+	// handle deregistration
+	if decodeUint(value) != 0 {
+		g.remove(key)
+		g.respond(addr, req, &Message{Code: Content})
+		return
+	}
+
+	// acquire mutex
+	g.mutex.Lock()
+
+	// remove existing observer
+	if existing, ok := g.observers[key]; ok {
+		g.removeObserver(existing)
+	}
+
+	// add observer
+	obs := &observer{
+		key:    key,
+		addr:   addr,
+		token:  append([]byte(nil), req.Token...),
+		filter: filter,
+	}
+	g.observers[key] = obs
+	subscribe := len(g.filters.Get(filter)) == 0
+	g.filters.Add(filter, obs)
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// confirm if already subscribed
+	if !subscribe {
+		g.respond(addr, req, &Message{Code: Content, Options: []Option{{Number: ObserveOption}}})
+		return
+	}
+
+	// subscribe filter
+	sf := g.service.Subscribe(filter, g.QOS)
+
+	// respond once acknowledged
+	go func() {
+		if sf.Wait(g.Timeout) != nil {
+			g.remove(key)
+			g.respond(addr, req, &Message{Code: GatewayTimeout})
+			return
+		}
+
+		g.respond(addr, req, &Message{Code: Content, Options: []Option{{Number: ObserveOption}}})
+	}()
+}
+
+func (g *Gateway) notify(msg *packet.Message) error {
+	// acquire mutex
+	g.mutex.Lock()
+
+	// prepare notifications
+	var notifications []*Message
+	var addrs []net.Addr
+	for _, value := range g.filters.Match(msg.Topic) {
+		obs := value.(*observer)
+		obs.seq = (obs.seq + 1) & 0xFFFFFF
+		obs.messageID = g.nextMessageID()
+
+		notifications = append(notifications, &Message{
+			Type:      NonConfirmable,
+			Code:      Content,
+			MessageID: obs.messageID,
+			Token:     obs.token,
+			Options:   []Option{{Number: ObserveOption, Value: encodeUint(obs.seq)}},
+			Payload:   msg.Payload,
+		})
+		addrs = append(addrs, obs.addr)
+	}
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// send notifications
+	for i, n := range notifications {
+		g.send(addrs[i], n)
+	}
+
+	return nil
+}
+
+func (g *Gateway) reset(addr net.Addr, messageID uint16) {
+	// acquire mutex
+	g.mutex.Lock()
+
+	// find observer
+	var key string
+	for _, obs := range g.observers {
+		if obs.messageID == messageID && obs.addr.String() == addr.String() {
+			key = obs.key
+			break
+		}
+	}
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// remove observer
+	if key != "" {
+		g.remove(key)
+	}
+}
+
+func (g *Gateway) remove(key string) {
+	// acquire mutex
+	g.mutex.Lock()
+
+	// get observer
+	obs, ok := g.observers[key]
+	if !ok {
+		g.mutex.Unlock()
+		return
+	}
+
+	// remove observer
+	unsubscribe := g.removeObserver(obs)
+	service := g.service
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// unsubscribe filter
+	if unsubscribe {
+		service.Unsubscribe(obs.filter)
+	}
+}
+
+// removeObserver removes the observer and returns whether it was the last
+// observer of its filter. The mutex must be held by the caller.
+func (g *Gateway) removeObserver(obs *observer) bool {
+	delete(g.observers, obs.key)
+	g.filters.Remove(obs.filter, obs)
+
+	return len(g.filters.Get(obs.filter)) == 0
+}
+
+func (g *Gateway) respond(addr net.Addr, req *Message, res *Message) {
+	// set token
+	res.Token = req.Token
+
+	// piggyback response on acknowledgement if confirmable
+	if req.Type == Confirmable {
+		res.Type = Acknowledgement
+		res.MessageID = req.MessageID
+	} else {
+		g.mutex.Lock()
+		res.Type = NonConfirmable
+		res.MessageID = g.nextMessageID()
+		g.mutex.Unlock()
+	}
+
+	g.send(addr, res)
+}
+
+func (g *Gateway) send(addr net.Addr, msg *Message) {
+	// encode message
+	data, err := msg.Encode()
+	if err != nil {
+		return
+	}
+
+	// write message, errors are ignored as datagrams may get lost anyway
+	_, _ = g.conn.WriteTo(data, addr)
+}
+
+// nextMessageID returns the next message id. The mutex must be held by the
+// caller.
+func (g *Gateway) nextMessageID() uint16 {
+	g.messageID++
+	return g.messageID
+}
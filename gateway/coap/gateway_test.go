@@ -0,0 +1,171 @@
+package coap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (c *testClient) send(msg *Message) {
+	data, err := msg.Encode()
+	assert.NoError(c.t, err)
+
+	_, err = c.conn.Write(data)
+	assert.NoError(c.t, err)
+}
+
+func (c *testClient) receive() *Message {
+	buf := make([]byte, 1024)
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := c.conn.Read(buf)
+	if !assert.NoError(c.t, err) {
+		return &Message{}
+	}
+
+	msg, err := Decode(buf[:n])
+	assert.NoError(c.t, err)
+
+	return msg
+}
+
+func runGateway(t *testing.T) (*Gateway, *testutil.Broker, *testClient) {
+	broker := testutil.NewBroker(nil, nil)
+
+	gateway := NewGateway("tcp://testutil")
+	gateway.Dialer = broker
+	gateway.ClientID = "coap"
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		assert.NoError(t, gateway.Serve(conn))
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	return gateway, broker, &testClient{t: t, conn: client}
+}
+
+func request(code Code, path string, id uint16, options ...Option) *Message {
+	msg := &Message{
+		Type:      Confirmable,
+		Code:      code,
+		MessageID: id,
+		Token:     []byte{byte(id)},
+		Options:   options,
+	}
+	msg.SetPath(path)
+
+	return msg
+}
+
+func TestGatewayPublish(t *testing.T) {
+	gateway, broker, c := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	received := make(chan *packet.Message, 1)
+
+	subscriber, err := broker.Connect(broker.Config("subscriber"))
+	assert.NoError(t, err)
+
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		if msg != nil {
+			received <- msg
+		}
+		return nil
+	}
+
+	sf, err := subscriber.Subscribe("sensors/#", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+
+	req := request(PUT, "sensors/1/temp", 1, Option{Number: URIQueryOption, Value: []byte("qos=1")})
+	req.Payload = []byte("21.5")
+	c.send(req)
+
+	res := c.receive()
+	assert.Equal(t, Acknowledgement, res.Type)
+	assert.Equal(t, Changed, res.Code)
+	assert.Equal(t, uint16(1), res.MessageID)
+	assert.Equal(t, []byte{1}, res.Token)
+
+	msg := <-received
+	assert.Equal(t, "sensors/1/temp", msg.Topic)
+	assert.Equal(t, []byte("21.5"), msg.Payload)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	c.send(request(PUT, "sensors/+", 2))
+	assert.Equal(t, BadRequest, c.receive().Code)
+
+	c.send(request(PUT, "sensors/1", 3, Option{Number: URIQueryOption, Value: []byte("foo")}))
+	assert.Equal(t, BadRequest, c.receive().Code)
+
+	c.send(request(DELETE, "sensors/1", 4))
+	assert.Equal(t, MethodNotAllowed, c.receive().Code)
+}
+
+func TestGatewayObserve(t *testing.T) {
+	gateway, broker, c := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	publisher, err := broker.Connect(broker.Config("publisher"))
+	assert.NoError(t, err)
+
+	publish := func(topic, payload string) {
+		pf, err := publisher.Publish(topic, []byte(payload), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(time.Second))
+	}
+
+	c.send(request(GET, "actuators/+/set", 1, Option{Number: ObserveOption}))
+
+	res := c.receive()
+	assert.Equal(t, Content, res.Code)
+	_, ok := res.Option(ObserveOption)
+	assert.True(t, ok)
+
+	publish("actuators/1/set", "on")
+
+	n := c.receive()
+	assert.Equal(t, NonConfirmable, n.Type)
+	assert.Equal(t, Content, n.Code)
+	assert.Equal(t, []byte{1}, n.Token)
+	assert.Equal(t, []byte("on"), n.Payload)
+	value, _ := n.Option(ObserveOption)
+	assert.Equal(t, uint32(1), decodeUint(value))
+
+	// cancel with reset
+	c.send(&Message{Type: Reset, MessageID: n.MessageID})
+
+	time.Sleep(50 * time.Millisecond)
+
+	publish("actuators/1/set", "off")
+
+	// observe again and cancel with deregistration
+	c.send(request(GET, "actuators/+/set", 2, Option{Number: ObserveOption}))
+	assert.Equal(t, Content, c.receive().Code)
+
+	c.send(request(GET, "actuators/+/set", 2, Option{Number: ObserveOption, Value: encodeUint(1)}))
+	assert.Equal(t, Content, c.receive().Code)
+
+	publish("actuators/1/set", "on")
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = c.conn.Read(make([]byte, 1024))
+	assert.Error(t, err)
+}
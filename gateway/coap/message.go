@@ -0,0 +1,284 @@
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrMalformedMessage is returned if a message cannot be decoded.
+var ErrMalformedMessage = errors.New("malformed message")
+
+// Type represents the CoAP message types.
+type Type byte
+
+// All available message types.
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+// Code represents the CoAP request methods and response codes.
+type Code byte
+
+// All used request methods and response codes.
+const (
+	Empty              Code = 0x00
+	GET                Code = 0x01
+	POST               Code = 0x02
+	PUT                Code = 0x03
+	DELETE             Code = 0x04
+	Changed            Code = 0x44
+	Content            Code = 0x45
+	BadRequest         Code = 0x80
+	NotFound           Code = 0x84
+	MethodNotAllowed   Code = 0x85
+	ServiceUnavailable Code = 0xA3
+	GatewayTimeout     Code = 0xA4
+)
+
+// the marker that separates the options from the payload
+const optionPayloadMarker = 0xFF
+
+// String returns the code in the form of "c.dd".
+func (c Code) String() string {
+	return fmt.Sprintf("%d.%02d", c>>5, c&0x1F)
+}
+
+// All used option numbers.
+const (
+	ObserveOption       uint16 = 6
+	URIPathOption       uint16 = 11
+	ContentFormatOption uint16 = 12
+	URIQueryOption      uint16 = 15
+)
+
+// An Option is a single message option.
+type Option struct {
+	Number uint16
+	Value  []byte
+}
+
+// A Message is a single CoAP message.
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+// Option returns the value of the first option with the specified number.
+func (m *Message) Option(number uint16) ([]byte, bool) {
+	for _, o := range m.Options {
+		if o.Number == number {
+			return o.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Path returns the Uri-Path options joined by slashes.
+func (m *Message) Path() string {
+	var segments []string
+	for _, o := range m.Options {
+		if o.Number == URIPathOption {
+			segments = append(segments, string(o.Value))
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// Queries returns the values of all Uri-Query options.
+func (m *Message) Queries() []string {
+	var queries []string
+	for _, o := range m.Options {
+		if o.Number == URIQueryOption {
+			queries = append(queries, string(o.Value))
+		}
+	}
+
+	return queries
+}
+
+// SetPath will replace the Uri-Path options with the segments of the path.
+func (m *Message) SetPath(path string) {
+	// remove existing options
+	options := m.Options[:0]
+	for _, o := range m.Options {
+		if o.Number != URIPathOption {
+			options = append(options, o)
+		}
+	}
+	m.Options = options
+
+	// add segments
+	for _, segment := range strings.Split(path, "/") {
+		m.Options = append(m.Options, Option{Number: URIPathOption, Value: []byte(segment)})
+	}
+}
+
+// Encode will encode the message.
+func (m *Message) Encode() ([]byte, error) {
+	// check token
+	if len(m.Token) > 8 {
+		return nil, ErrMalformedMessage
+	}
+
+	// write header
+	buf := []byte{
+		0x40 | byte(m.Type)<<4 | byte(len(m.Token)),
+		byte(m.Code),
+		byte(m.MessageID >> 8),
+		byte(m.MessageID),
+	}
+	buf = append(buf, m.Token...)
+
+	// sort options
+	options := append([]Option(nil), m.Options...)
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Number < options[j].Number
+	})
+
+	// write options
+	var last uint16
+	for _, o := range options {
+		delta, deltaExt := optionNibble(int(o.Number - last))
+		length, lengthExt := optionNibble(len(o.Value))
+		buf = append(buf, delta<<4|length)
+		buf = append(buf, deltaExt...)
+		buf = append(buf, lengthExt...)
+		buf = append(buf, o.Value...)
+		last = o.Number
+	}
+
+	// write payload
+	if len(m.Payload) > 0 {
+		buf = append(buf, optionPayloadMarker)
+		buf = append(buf, m.Payload...)
+	}
+
+	return buf, nil
+}
+
+func optionNibble(v int) (byte, []byte) {
+	if v < 13 {
+		return byte(v), nil
+	} else if v < 269 {
+		return 13, []byte{byte(v - 13)}
+	}
+
+	v -= 269
+	return 14, []byte{byte(v >> 8), byte(v)}
+}
+
+// Decode will decode a message from the datagram.
+func Decode(data []byte) (*Message, error) {
+	// check header
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, ErrMalformedMessage
+	}
+
+	// read header
+	tkl := int(data[0] & 0x0F)
+	m := &Message{
+		Type:      Type(data[0] >> 4 & 0x03),
+		Code:      Code(data[1]),
+		MessageID: binary.BigEndian.Uint16(data[2:]),
+	}
+
+	// read token
+	if tkl > 8 || len(data) < 4+tkl {
+		return nil, ErrMalformedMessage
+	}
+	m.Token = data[4 : 4+tkl]
+	data = data[4+tkl:]
+
+	// read options
+	var number int
+	for len(data) > 0 {
+		// check payload marker
+		if data[0] == optionPayloadMarker {
+			if len(data) == 1 {
+				return nil, ErrMalformedMessage
+			}
+
+			m.Payload = data[1:]
+			break
+		}
+
+		// read nibbles
+		delta := int(data[0] >> 4)
+		length := int(data[0] & 0x0F)
+		data = data[1:]
+
+		// read extended values
+		var ok bool
+		delta, data, ok = readExtended(delta, data)
+		if !ok {
+			return nil, ErrMalformedMessage
+		}
+		length, data, ok = readExtended(length, data)
+		if !ok || len(data) < length {
+			return nil, ErrMalformedMessage
+		}
+
+		// add option
+		number += delta
+		m.Options = append(m.Options, Option{
+			Number: uint16(number),
+			Value:  data[:length],
+		})
+		data = data[length:]
+	}
+
+	return m, nil
+}
+
+func readExtended(v int, data []byte) (int, []byte, bool) {
+	switch v {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, false
+		}
+		return int(data[0]) + 13, data[1:], true
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, false
+		}
+		return int(binary.BigEndian.Uint16(data)) + 269, data[2:], true
+	case 15:
+		return 0, nil, false
+	}
+
+	return v, data, true
+}
+
+// encodeUint encodes an unsigned integer option value using the minimal
+// number of bytes.
+func encodeUint(v uint32) []byte {
+	var buf []byte
+	for v > 0 {
+		buf = append([]byte{byte(v)}, buf...)
+		v >>= 8
+	}
+
+	return buf
+}
+
+// decodeUint decodes an unsigned integer option value.
+func decodeUint(data []byte) uint32 {
+	var v uint32
+	for _, b := range data {
+		v = v<<8 | uint32(b)
+	}
+
+	return v
+}
@@ -0,0 +1,68 @@
+package coap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageEncodeDecode(t *testing.T) {
+	msg := &Message{
+		Type:      Confirmable,
+		Code:      PUT,
+		MessageID: 0x1234,
+		Token:     []byte{1, 2, 3},
+		Options: []Option{
+			{Number: URIQueryOption, Value: []byte("qos=1")},
+			{Number: ObserveOption, Value: encodeUint(300)},
+			{Number: 2000, Value: []byte(strings.Repeat("x", 300))},
+		},
+		Payload: []byte("foo"),
+	}
+	msg.SetPath("foo/bar")
+
+	data, err := msg.Encode()
+	assert.NoError(t, err)
+
+	decoded, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, msg.Type, decoded.Type)
+	assert.Equal(t, msg.Code, decoded.Code)
+	assert.Equal(t, msg.MessageID, decoded.MessageID)
+	assert.Equal(t, msg.Token, decoded.Token)
+	assert.Equal(t, msg.Payload, decoded.Payload)
+	assert.Equal(t, "foo/bar", decoded.Path())
+	assert.Equal(t, []string{"qos=1"}, decoded.Queries())
+
+	value, ok := decoded.Option(ObserveOption)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(300), decodeUint(value))
+
+	value, ok = decoded.Option(2000)
+	assert.True(t, ok)
+	assert.Len(t, value, 300)
+
+	_, ok = decoded.Option(ContentFormatOption)
+	assert.False(t, ok)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x40, 0x01, 0x00},
+		{0x80, 0x01, 0x00, 0x00},
+		{0x49, 0x01, 0x00, 0x00},
+		{0x41, 0x01, 0x00, 0x00},
+		{0x40, 0x01, 0x00, 0x00, 0xFF},
+		{0x40, 0x01, 0x00, 0x00, 0xF0},
+		{0x40, 0x01, 0x00, 0x00, 0x12, 0x01},
+	} {
+		_, err := Decode(data)
+		assert.Equal(t, ErrMalformedMessage, err, data)
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	assert.Equal(t, "2.05", Content.String())
+	assert.Equal(t, "4.04", NotFound.String())
+}
@@ -0,0 +1,693 @@
+// Package mqttsn implements an MQTT-SN 1.2 gateway that translates clients
+// connected over UDP into regular client connections on a broker.
+//
+// The gateway is transparent: every MQTT-SN client gets its own connection to
+// the broker that uses the same client id. The gateway supports topic id
+// registration, predefined topic ids, short topic names and sleeping clients.
+// It does not support will messages, QOS 2 and the gateway discovery
+// packets. Messages are delivered to MQTT-SN clients with at most QOS 1 and
+// are acknowledged to the broker once they have been sent or buffered for a
+// sleeping client.
+package mqttsn
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Gateway forwards MQTT-SN clients to a broker.
+type Gateway struct {
+	// The URL of the broker.
+	BrokerURL string
+
+	// The dialer used to connect to the broker.
+	Dialer client.Dialer
+
+	// The topic ids that are known to the clients in advance.
+	PredefinedTopics map[uint16]string
+
+	// The maximum number of messages buffered for a sleeping client. Older
+	// messages are dropped if the buffer is full.
+	//
+	// Will default to 100.
+	SleepBuffer int
+
+	// The timeout for connecting and acknowledgements from the broker.
+	//
+	// Will default to 10 seconds.
+	Timeout time.Duration
+
+	conn    net.PacketConn
+	clients map[string]*snClient
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// NewGateway returns a new Gateway that forwards clients to the specified
+// broker.
+func NewGateway(brokerURL string) *Gateway {
+	return &Gateway{
+		BrokerURL:   brokerURL,
+		SleepBuffer: 100,
+		Timeout:     10 * time.Second,
+		clients:     make(map[string]*snClient),
+	}
+}
+
+// Serve will read and handle packets from the connection until the gateway is
+// closed or an error occurs.
+func (g *Gateway) Serve(conn net.PacketConn) error {
+	// set connection
+	g.mutex.Lock()
+	g.conn = conn
+	g.mutex.Unlock()
+
+	buf := make([]byte, 65536)
+
+	for {
+		// read datagram
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			// acquire mutex
+			g.mutex.Lock()
+			defer g.mutex.Unlock()
+
+			// ignore error if closed
+			if g.closed {
+				return nil
+			}
+
+			return err
+		}
+
+		// decode packet, invalid packets are ignored
+		pkt, err := Decode(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+
+		// handle packet
+		g.handle(addr, pkt)
+	}
+}
+
+// Close will close the connection and disconnect all clients from the broker.
+func (g *Gateway) Close() error {
+	// acquire mutex
+	g.mutex.Lock()
+
+	// set flag
+	g.closed = true
+
+	// get clients
+	clients := make([]*snClient, 0, len(g.clients))
+	for _, c := range g.clients {
+		clients = append(clients, c)
+	}
+	g.clients = make(map[string]*snClient)
+
+	// get connection
+	conn := g.conn
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// disconnect clients
+	for _, c := range clients {
+		c.stop()
+		_ = c.mqtt.Disconnect()
+	}
+
+	// close connection
+	if conn != nil {
+		return conn.Close()
+	}
+
+	return nil
+}
+
+func (g *Gateway) handle(addr net.Addr, pkt *Packet) {
+	// handle connect
+	if pkt.Type == CONNECT {
+		go g.connect(addr, pkt)
+		return
+	}
+
+	// get client
+	c := g.lookup(addr, pkt)
+	if c == nil {
+		// confirm disconnect of unknown clients
+		if pkt.Type == DISCONNECT {
+			g.send(addr, &Packet{Type: DISCONNECT})
+		}
+
+		return
+	}
+
+	c.handle(pkt)
+}
+
+func (g *Gateway) lookup(addr net.Addr, pkt *Packet) *snClient {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// get client by address
+	c, ok := g.clients[addr.String()]
+	if ok || pkt.Type != PINGREQ || pkt.ClientID == "" {
+		return c
+	}
+
+	// a sleeping client may wake up with a new address
+	for key, c := range g.clients {
+		if c.id == pkt.ClientID {
+			delete(g.clients, key)
+			g.clients[addr.String()] = c
+			c.setAddr(addr)
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) connect(addr net.Addr, pkt *Packet) {
+	// will messages are not supported
+	if pkt.Will {
+		g.send(addr, &Packet{Type: CONNACK, ReturnCode: NotSupported})
+		return
+	}
+
+	// prepare client
+	c := &snClient{
+		gateway:  g,
+		addr:     addr,
+		id:       pkt.ClientID,
+		mqtt:     client.New(),
+		duration: time.Duration(pkt.Duration) * time.Second,
+		topics:   make(map[uint16]string),
+		ids:      make(map[string]uint16),
+	}
+
+	// set callback
+	c.mqtt.Callback = c.callback
+
+	// prepare config
+	config := client.NewConfigWithClientID(g.BrokerURL, pkt.ClientID)
+	config.Dialer = g.Dialer
+	config.CleanSession = pkt.CleanSession
+	config.ValidateSubs = false
+	if pkt.Duration > 0 {
+		config.KeepAlive = strconv.Itoa(int(pkt.Duration)) + "s"
+	}
+
+	// connect to broker
+	cf, err := c.mqtt.Connect(config)
+	if err == nil {
+		err = cf.Wait(g.Timeout)
+	}
+	if err != nil {
+		_ = c.mqtt.Close()
+		g.send(addr, &Packet{Type: CONNACK, ReturnCode: Congestion})
+		return
+	}
+
+	// check return code
+	if cf.ReturnCode() != packet.ConnectionAccepted {
+		g.send(addr, &Packet{Type: CONNACK, ReturnCode: NotSupported})
+		return
+	}
+
+	// acquire mutex
+	g.mutex.Lock()
+
+	// check if closed
+	if g.closed {
+		g.mutex.Unlock()
+		_ = c.mqtt.Disconnect()
+		return
+	}
+
+	// replace existing client
+	existing := g.clients[addr.String()]
+	g.clients[addr.String()] = c
+
+	// release mutex
+	g.mutex.Unlock()
+
+	// close existing client
+	if existing != nil {
+		existing.stop()
+		_ = existing.mqtt.Close()
+	}
+
+	// start keep alive timer
+	c.touch()
+
+	g.send(addr, &Packet{Type: CONNACK, ReturnCode: Accepted})
+}
+
+func (g *Gateway) remove(c *snClient) bool {
+	// acquire mutex
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// remove client
+	for key, cc := range g.clients {
+		if cc == c {
+			delete(g.clients, key)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *Gateway) predefined(topic string) (uint16, bool) {
+	for id, t := range g.PredefinedTopics {
+		if t == topic {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+func (g *Gateway) send(addr net.Addr, pkt *Packet) {
+	// get connection
+	g.mutex.Lock()
+	conn := g.conn
+	g.mutex.Unlock()
+
+	// write packet, errors are ignored as datagrams may get lost anyway
+	if conn != nil {
+		_, _ = conn.WriteTo(pkt.Encode(), addr)
+	}
+}
+
+type snClient struct {
+	gateway  *Gateway
+	addr     net.Addr
+	id       string
+	mqtt     *client.Client
+	duration time.Duration
+	timer    *time.Timer
+	stopped  bool
+	asleep   bool
+	buffer   []*packet.Message
+	topics   map[uint16]string
+	ids      map[string]uint16
+	topicID  uint16
+	msgID    uint16
+	mutex    sync.Mutex
+}
+
+func (c *snClient) handle(pkt *Packet) {
+	// reset timer
+	c.touch()
+
+	switch pkt.Type {
+	case REGISTER:
+		c.send(&Packet{Type: REGACK, TopicID: c.register(pkt.TopicName), MsgID: pkt.MsgID})
+	case PUBLISH:
+		c.wake()
+		c.publish(pkt)
+	case SUBSCRIBE:
+		c.wake()
+		c.subscribe(pkt)
+	case UNSUBSCRIBE:
+		c.wake()
+		c.unsubscribe(pkt)
+	case PINGREQ:
+		c.ping()
+	case DISCONNECT:
+		c.disconnect(pkt)
+	}
+}
+
+func (c *snClient) publish(pkt *Packet) {
+	// resolve topic
+	topic, ok := c.resolve(pkt)
+	if !ok {
+		c.send(&Packet{Type: PUBACK, TopicID: pkt.TopicID, MsgID: pkt.MsgID, ReturnCode: InvalidTopicID})
+		return
+	}
+
+	// check qos, QOS -1 is treated as 0 for connected clients
+	qos := pkt.QOS
+	if qos == 3 {
+		qos = 0
+	} else if qos == 2 {
+		c.send(&Packet{Type: PUBACK, TopicID: pkt.TopicID, MsgID: pkt.MsgID, ReturnCode: NotSupported})
+		return
+	}
+
+	// publish message
+	pf, err := c.mqtt.Publish(topic, pkt.Data, qos, pkt.Retain)
+	if err != nil || qos == 0 {
+		return
+	}
+
+	// acknowledge message
+	go func() {
+		rc := Accepted
+		if pf.Wait(c.gateway.Timeout) != nil {
+			rc = Congestion
+		}
+
+		c.send(&Packet{Type: PUBACK, TopicID: pkt.TopicID, MsgID: pkt.MsgID, ReturnCode: rc})
+	}()
+}
+
+func (c *snClient) subscribe(pkt *Packet) {
+	// prepare response
+	suback := &Packet{Type: SUBACK, MsgID: pkt.MsgID}
+
+	// resolve topic
+	filter, ok := c.resolve(pkt)
+	if !ok {
+		suback.ReturnCode = InvalidTopicID
+		c.send(suback)
+		return
+	}
+
+	// register topics without wildcards
+	if pkt.TopicIDType == NormalTopic && !strings.ContainsAny(filter, "+#") {
+		suback.TopicID = c.register(filter)
+	} else if pkt.TopicIDType == PredefinedTopic {
+		suback.TopicID = pkt.TopicID
+	}
+
+	// limit qos
+	qos := pkt.QOS
+	if qos > 1 {
+		qos = 1
+	}
+
+	// subscribe topic
+	sf, err := c.mqtt.Subscribe(filter, qos)
+	if err != nil {
+		return
+	}
+
+	// acknowledge subscription
+	go func() {
+		if sf.Wait(c.gateway.Timeout) != nil {
+			suback.ReturnCode = Congestion
+		} else if rc := sf.ReturnCodes()[0]; rc == packet.QOSFailure {
+			suback.ReturnCode = NotSupported
+		} else {
+			suback.QOS = rc
+		}
+
+		c.send(suback)
+	}()
+}
+
+func (c *snClient) unsubscribe(pkt *Packet) {
+	// resolve topic
+	filter, ok := c.resolve(pkt)
+	if !ok {
+		c.send(&Packet{Type: UNSUBACK, MsgID: pkt.MsgID})
+		return
+	}
+
+	// unsubscribe topic
+	uf, err := c.mqtt.Unsubscribe(filter)
+	if err != nil {
+		return
+	}
+
+	// acknowledge unsubscription
+	go func() {
+		if uf.Wait(c.gateway.Timeout) == nil {
+			c.send(&Packet{Type: UNSUBACK, MsgID: pkt.MsgID})
+		}
+	}()
+}
+
+func (c *snClient) ping() {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// get buffered messages of sleeping clients
+	var buffer []*packet.Message
+	if c.asleep {
+		buffer = c.buffer
+		c.buffer = nil
+	}
+
+	// release mutex
+	c.mutex.Unlock()
+
+	// send buffered messages
+	for _, msg := range buffer {
+		c.deliver(msg)
+	}
+
+	c.send(&Packet{Type: PINGRESP})
+}
+
+func (c *snClient) disconnect(pkt *Packet) {
+	// go to sleep if a duration is specified
+	if pkt.Duration > 0 {
+		c.mutex.Lock()
+		c.asleep = true
+		c.duration = time.Duration(pkt.Duration) * time.Second
+		c.mutex.Unlock()
+
+		c.touch()
+		c.send(&Packet{Type: DISCONNECT})
+		return
+	}
+
+	// remove and disconnect client
+	c.stop()
+	c.gateway.remove(c)
+	_ = c.mqtt.Disconnect()
+
+	c.send(&Packet{Type: DISCONNECT})
+}
+
+func (c *snClient) wake() {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// check state
+	if !c.asleep {
+		c.mutex.Unlock()
+		return
+	}
+
+	// get buffered messages
+	buffer := c.buffer
+	c.asleep = false
+	c.buffer = nil
+
+	// release mutex
+	c.mutex.Unlock()
+
+	// send buffered messages
+	for _, msg := range buffer {
+		c.deliver(msg)
+	}
+}
+
+func (c *snClient) callback(msg *packet.Message, err error) error {
+	// handle lost broker connections
+	if err != nil {
+		c.stop()
+		if c.gateway.remove(c) {
+			c.send(&Packet{Type: DISCONNECT})
+		}
+
+		return nil
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+
+	// buffer messages while asleep
+	if c.asleep {
+		c.buffer = append(c.buffer, msg)
+		if len(c.buffer) > c.gateway.SleepBuffer {
+			c.buffer = c.buffer[1:]
+		}
+
+		c.mutex.Unlock()
+		return nil
+	}
+
+	// release mutex
+	c.mutex.Unlock()
+
+	c.deliver(msg)
+
+	return nil
+}
+
+func (c *snClient) deliver(msg *packet.Message) {
+	// prepare packet
+	pkt := &Packet{
+		Type:   PUBLISH,
+		QOS:    msg.QOS,
+		Retain: msg.Retain,
+		Data:   msg.Payload,
+	}
+
+	// limit qos
+	if pkt.QOS > 1 {
+		pkt.QOS = 1
+	}
+
+	// set message id
+	if pkt.QOS > 0 {
+		pkt.MsgID = c.nextMsgID()
+	}
+
+	// set topic
+	if id, ok := c.gateway.predefined(msg.Topic); ok {
+		pkt.TopicIDType = PredefinedTopic
+		pkt.TopicID = id
+	} else if len(msg.Topic) == 2 {
+		pkt.TopicIDType = ShortTopic
+		pkt.TopicName = msg.Topic
+	} else {
+		// register unknown topics
+		id, registered := c.lookup(msg.Topic)
+		if !registered {
+			id = c.register(msg.Topic)
+			c.send(&Packet{Type: REGISTER, TopicID: id, MsgID: c.nextMsgID(), TopicName: msg.Topic})
+		}
+
+		pkt.TopicID = id
+	}
+
+	c.send(pkt)
+}
+
+func (c *snClient) resolve(pkt *Packet) (string, bool) {
+	switch pkt.TopicIDType {
+	case NormalTopic:
+		// subscribe and unsubscribe use topic names
+		if pkt.Type != PUBLISH {
+			return pkt.TopicName, pkt.TopicName != ""
+		}
+
+		// acquire mutex
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		topic, ok := c.topics[pkt.TopicID]
+		return topic, ok
+	case PredefinedTopic:
+		topic, ok := c.gateway.PredefinedTopics[pkt.TopicID]
+		return topic, ok
+	case ShortTopic:
+		return pkt.TopicName, len(pkt.TopicName) == 2
+	}
+
+	return "", false
+}
+
+func (c *snClient) lookup(topic string) (uint16, bool) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id, ok := c.ids[topic]
+	return id, ok
+}
+
+func (c *snClient) register(topic string) uint16 {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// return existing id
+	if id, ok := c.ids[topic]; ok {
+		return id
+	}
+
+	// allocate id
+	c.topicID++
+	c.topics[c.topicID] = topic
+	c.ids[topic] = c.topicID
+
+	return c.topicID
+}
+
+func (c *snClient) nextMsgID() uint16 {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// skip zero
+	c.msgID++
+	if c.msgID == 0 {
+		c.msgID++
+	}
+
+	return c.msgID
+}
+
+// touch will reset the timer that removes clients that did not send any
+// packet within 1.5 times their keep alive or sleep duration.
+func (c *snClient) touch() {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// stop existing timer
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	// check state and duration
+	if c.stopped || c.duration == 0 {
+		return
+	}
+
+	c.timer = time.AfterFunc(c.duration*3/2, func() {
+		if c.gateway.remove(c) {
+			_ = c.mqtt.Close()
+		}
+	})
+}
+
+func (c *snClient) stop() {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// set flag
+	c.stopped = true
+
+	// stop timer
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+func (c *snClient) setAddr(addr net.Addr) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.addr = addr
+}
+
+func (c *snClient) send(pkt *Packet) {
+	// get address
+	c.mutex.Lock()
+	addr := c.addr
+	c.mutex.Unlock()
+
+	c.gateway.send(addr, pkt)
+}
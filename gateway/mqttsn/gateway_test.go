@@ -0,0 +1,217 @@
+package mqttsn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (c *testClient) send(pkt *Packet) {
+	_, err := c.conn.Write(pkt.Encode())
+	assert.NoError(c.t, err)
+}
+
+func (c *testClient) receive() *Packet {
+	buf := make([]byte, 1024)
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := c.conn.Read(buf)
+	if !assert.NoError(c.t, err) {
+		return &Packet{}
+	}
+
+	pkt, err := Decode(buf[:n])
+	assert.NoError(c.t, err)
+
+	return pkt
+}
+
+func runGateway(t *testing.T) (*Gateway, *testutil.Broker, func() *testClient) {
+	broker := testutil.NewBroker(nil, nil)
+
+	gateway := NewGateway("tcp://testutil")
+	gateway.Dialer = broker
+	gateway.PredefinedTopics = map[uint16]string{
+		7: "predefined/topic",
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		assert.NoError(t, gateway.Serve(conn))
+	}()
+
+	dial := func() *testClient {
+		conn, err := net.Dial("udp", conn.LocalAddr().String())
+		assert.NoError(t, err)
+
+		return &testClient{t: t, conn: conn}
+	}
+
+	return gateway, broker, dial
+}
+
+func subscribe(t *testing.T, broker *testutil.Broker, filter string) chan *packet.Message {
+	messages := make(chan *packet.Message, 10)
+
+	c, err := broker.Connect(broker.Config("subscriber"))
+	assert.NoError(t, err)
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		if msg != nil {
+			messages <- msg
+		}
+		return nil
+	}
+
+	sf, err := c.Subscribe(filter, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+
+	return messages
+}
+
+func publish(t *testing.T, broker *testutil.Broker, topic string, payload []byte) {
+	c, err := broker.Connect(broker.Config("publisher"))
+	assert.NoError(t, err)
+
+	pf, err := c.Publish(topic, payload, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(time.Second))
+
+	assert.NoError(t, c.Disconnect())
+}
+
+func TestGatewayPublish(t *testing.T) {
+	gateway, broker, dial := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	messages := subscribe(t, broker, "#")
+
+	c := dial()
+
+	c.send(&Packet{Type: CONNECT, CleanSession: true, Duration: 30, ClientID: "sn"})
+	assert.Equal(t, &Packet{Type: CONNACK, ReturnCode: Accepted}, c.receive())
+
+	c.send(&Packet{Type: REGISTER, MsgID: 1, TopicName: "foo/bar"})
+	regack := c.receive()
+	assert.Equal(t, REGACK, regack.Type)
+	assert.Equal(t, uint16(1), regack.MsgID)
+	assert.Equal(t, Accepted, regack.ReturnCode)
+
+	c.send(&Packet{Type: PUBLISH, QOS: 1, TopicID: regack.TopicID, MsgID: 2, Data: []byte("foo")})
+	assert.Equal(t, &Packet{Type: PUBACK, TopicID: regack.TopicID, MsgID: 2, ReturnCode: Accepted}, c.receive())
+
+	msg := <-messages
+	assert.Equal(t, "foo/bar", msg.Topic)
+	assert.Equal(t, []byte("foo"), msg.Payload)
+
+	c.send(&Packet{Type: PUBLISH, TopicIDType: PredefinedTopic, TopicID: 7, Data: []byte("bar")})
+	msg = <-messages
+	assert.Equal(t, "predefined/topic", msg.Topic)
+
+	c.send(&Packet{Type: PUBLISH, TopicIDType: ShortTopic, TopicName: "ab", Data: []byte("baz")})
+	msg = <-messages
+	assert.Equal(t, "ab", msg.Topic)
+
+	c.send(&Packet{Type: PUBLISH, QOS: 1, TopicID: 42, MsgID: 3, Data: []byte("foo")})
+	assert.Equal(t, &Packet{Type: PUBACK, TopicID: 42, MsgID: 3, ReturnCode: InvalidTopicID}, c.receive())
+
+	c.send(&Packet{Type: DISCONNECT})
+	assert.Equal(t, &Packet{Type: DISCONNECT}, c.receive())
+}
+
+func TestGatewaySubscribe(t *testing.T) {
+	gateway, broker, dial := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	c := dial()
+
+	c.send(&Packet{Type: CONNECT, CleanSession: true, ClientID: "sn"})
+	assert.Equal(t, &Packet{Type: CONNACK, ReturnCode: Accepted}, c.receive())
+
+	c.send(&Packet{Type: SUBSCRIBE, QOS: 1, MsgID: 1, TopicName: "foo/bar"})
+	suback := c.receive()
+	assert.Equal(t, SUBACK, suback.Type)
+	assert.Equal(t, packet.QOS(1), suback.QOS)
+	assert.Equal(t, Accepted, suback.ReturnCode)
+	assert.NotZero(t, suback.TopicID)
+
+	c.send(&Packet{Type: SUBSCRIBE, MsgID: 2, TopicName: "baz/#"})
+	assert.Equal(t, &Packet{Type: SUBACK, MsgID: 2, ReturnCode: Accepted}, c.receive())
+
+	publish(t, broker, "foo/bar", []byte("foo"))
+	pkt := c.receive()
+	assert.Equal(t, PUBLISH, pkt.Type)
+	assert.Equal(t, suback.TopicID, pkt.TopicID)
+	assert.Equal(t, []byte("foo"), pkt.Data)
+
+	publish(t, broker, "baz/qux", []byte("bar"))
+	register := c.receive()
+	assert.Equal(t, REGISTER, register.Type)
+	assert.Equal(t, "baz/qux", register.TopicName)
+	pkt = c.receive()
+	assert.Equal(t, PUBLISH, pkt.Type)
+	assert.Equal(t, register.TopicID, pkt.TopicID)
+	assert.Equal(t, []byte("bar"), pkt.Data)
+
+	c.send(&Packet{Type: UNSUBSCRIBE, MsgID: 3, TopicName: "baz/#"})
+	assert.Equal(t, &Packet{Type: UNSUBACK, MsgID: 3}, c.receive())
+}
+
+func TestGatewaySleepingClient(t *testing.T) {
+	gateway, broker, dial := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	c := dial()
+
+	c.send(&Packet{Type: CONNECT, ClientID: "sn"})
+	assert.Equal(t, &Packet{Type: CONNACK, ReturnCode: Accepted}, c.receive())
+
+	c.send(&Packet{Type: SUBSCRIBE, MsgID: 1, TopicIDType: PredefinedTopic, TopicID: 7})
+	assert.Equal(t, &Packet{Type: SUBACK, TopicID: 7, MsgID: 1, ReturnCode: Accepted}, c.receive())
+
+	c.send(&Packet{Type: DISCONNECT, Duration: 60})
+	assert.Equal(t, &Packet{Type: DISCONNECT}, c.receive())
+
+	publish(t, broker, "predefined/topic", []byte("foo"))
+	publish(t, broker, "predefined/topic", []byte("bar"))
+
+	// wake up from a new address
+	c2 := dial()
+
+	c2.send(&Packet{Type: PINGREQ, ClientID: "sn"})
+	for _, payload := range []string{"foo", "bar"} {
+		pkt := c2.receive()
+		assert.Equal(t, PUBLISH, pkt.Type)
+		assert.Equal(t, PredefinedTopic, pkt.TopicIDType)
+		assert.Equal(t, uint16(7), pkt.TopicID)
+		assert.Equal(t, payload, string(pkt.Data))
+	}
+	assert.Equal(t, &Packet{Type: PINGRESP}, c2.receive())
+}
+
+func TestGatewayWillNotSupported(t *testing.T) {
+	gateway, broker, dial := runGateway(t)
+	defer broker.Close()
+	defer gateway.Close()
+
+	c := dial()
+
+	c.send(&Packet{Type: CONNECT, Will: true, ClientID: "sn"})
+	assert.Equal(t, &Packet{Type: CONNACK, ReturnCode: NotSupported}, c.receive())
+}
@@ -0,0 +1,364 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrMalformedPacket is returned if a packet cannot be decoded.
+var ErrMalformedPacket = errors.New("malformed packet")
+
+// Type represents the MQTT-SN packet types.
+type Type byte
+
+// All MQTT-SN packet types that are supported by the gateway.
+const (
+	CONNECT     Type = 0x04
+	CONNACK     Type = 0x05
+	REGISTER    Type = 0x0A
+	REGACK      Type = 0x0B
+	PUBLISH     Type = 0x0C
+	PUBACK      Type = 0x0D
+	SUBSCRIBE   Type = 0x12
+	SUBACK      Type = 0x13
+	UNSUBSCRIBE Type = 0x14
+	UNSUBACK    Type = 0x15
+	PINGREQ     Type = 0x16
+	PINGRESP    Type = 0x17
+	DISCONNECT  Type = 0x18
+)
+
+// String returns the type as a string.
+func (t Type) String() string {
+	switch t {
+	case CONNECT:
+		return "Connect"
+	case CONNACK:
+		return "Connack"
+	case REGISTER:
+		return "Register"
+	case REGACK:
+		return "Regack"
+	case PUBLISH:
+		return "Publish"
+	case PUBACK:
+		return "Puback"
+	case SUBSCRIBE:
+		return "Subscribe"
+	case SUBACK:
+		return "Suback"
+	case UNSUBSCRIBE:
+		return "Unsubscribe"
+	case UNSUBACK:
+		return "Unsuback"
+	case PINGREQ:
+		return "Pingreq"
+	case PINGRESP:
+		return "Pingresp"
+	case DISCONNECT:
+		return "Disconnect"
+	}
+
+	return fmt.Sprintf("Unknown(0x%02x)", byte(t))
+}
+
+// TopicIDType defines how the topic of a packet is specified.
+type TopicIDType byte
+
+// All available topic id types.
+const (
+	// The topic is specified by a registered topic id or a topic name in
+	// SUBSCRIBE and UNSUBSCRIBE packets.
+	NormalTopic TopicIDType = 0
+
+	// The topic is specified by a predefined topic id.
+	PredefinedTopic TopicIDType = 1
+
+	// The topic is specified by a two character short topic name.
+	ShortTopic TopicIDType = 2
+)
+
+// ReturnCode represents the MQTT-SN return codes.
+type ReturnCode byte
+
+// All available return codes.
+const (
+	Accepted       ReturnCode = 0x00
+	Congestion     ReturnCode = 0x01
+	InvalidTopicID ReturnCode = 0x02
+	NotSupported   ReturnCode = 0x03
+)
+
+// the only protocol id defined by MQTT-SN 1.2
+const protocolVersion = 0x01
+
+// A Packet is a single MQTT-SN packet. Which fields are used depends on the
+// packet type:
+//
+//	CONNECT:     Will, CleanSession, Duration, ClientID
+//	CONNACK:     ReturnCode
+//	REGISTER:    TopicID, MsgID, TopicName
+//	REGACK:      TopicID, MsgID, ReturnCode
+//	PUBLISH:     Dup, QOS, Retain, TopicIDType, TopicID or TopicName, MsgID, Data
+//	PUBACK:      TopicID, MsgID, ReturnCode
+//	SUBSCRIBE:   Dup, QOS, TopicIDType, MsgID, TopicID or TopicName
+//	SUBACK:      QOS, TopicID, MsgID, ReturnCode
+//	UNSUBSCRIBE: TopicIDType, MsgID, TopicID or TopicName
+//	UNSUBACK:    MsgID
+//	PINGREQ:     ClientID (optional)
+//	DISCONNECT:  Duration (optional)
+//
+// Short topic names are always stored in TopicName.
+type Packet struct {
+	Type         Type
+	Dup          bool
+	QOS          packet.QOS
+	Retain       bool
+	Will         bool
+	CleanSession bool
+	TopicIDType  TopicIDType
+	Duration     uint16
+	ClientID     string
+	TopicID      uint16
+	TopicName    string
+	MsgID        uint16
+	ReturnCode   ReturnCode
+	Data         []byte
+}
+
+// String returns a string representation of the packet.
+func (p *Packet) String() string {
+	return fmt.Sprintf("<%s TopicID=%d TopicName=%q MsgID=%d QOS=%d ReturnCode=%d>",
+		p.Type, p.TopicID, p.TopicName, p.MsgID, p.QOS, p.ReturnCode)
+}
+
+func (p *Packet) flags() byte {
+	var flags byte
+
+	if p.Dup {
+		flags |= 0x80
+	}
+
+	flags |= byte(p.QOS&0x03) << 5
+
+	if p.Retain {
+		flags |= 0x10
+	}
+
+	if p.Will {
+		flags |= 0x08
+	}
+
+	if p.CleanSession {
+		flags |= 0x04
+	}
+
+	return flags | byte(p.TopicIDType&0x03)
+}
+
+func (p *Packet) setFlags(flags byte) {
+	p.Dup = flags&0x80 != 0
+	p.QOS = packet.QOS(flags>>5) & 0x03
+	p.Retain = flags&0x10 != 0
+	p.Will = flags&0x08 != 0
+	p.CleanSession = flags&0x04 != 0
+	p.TopicIDType = TopicIDType(flags & 0x03)
+}
+
+// Encode will encode the packet.
+func (p *Packet) Encode() []byte {
+	// prepare body
+	var body []byte
+	u16 := func(v uint16) {
+		body = append(body, byte(v>>8), byte(v))
+	}
+
+	// the topic of publish, subscribe and unsubscribe packets
+	topic := func() {
+		if p.TopicIDType == ShortTopic {
+			body = append(body, (p.TopicName + "\x00\x00")[:2]...)
+		} else if p.TopicIDType == PredefinedTopic || p.Type == PUBLISH {
+			u16(p.TopicID)
+		} else {
+			body = append(body, p.TopicName...)
+		}
+	}
+
+	switch p.Type {
+	case CONNECT:
+		body = append(body, p.flags(), protocolVersion)
+		u16(p.Duration)
+		body = append(body, p.ClientID...)
+	case CONNACK:
+		body = append(body, byte(p.ReturnCode))
+	case REGISTER:
+		u16(p.TopicID)
+		u16(p.MsgID)
+		body = append(body, p.TopicName...)
+	case REGACK, PUBACK:
+		u16(p.TopicID)
+		u16(p.MsgID)
+		body = append(body, byte(p.ReturnCode))
+	case PUBLISH:
+		body = append(body, p.flags())
+		topic()
+		u16(p.MsgID)
+		body = append(body, p.Data...)
+	case SUBSCRIBE, UNSUBSCRIBE:
+		body = append(body, p.flags())
+		u16(p.MsgID)
+		topic()
+	case SUBACK:
+		body = append(body, p.flags())
+		u16(p.TopicID)
+		u16(p.MsgID)
+		body = append(body, byte(p.ReturnCode))
+	case UNSUBACK:
+		u16(p.MsgID)
+	case PINGREQ:
+		body = append(body, p.ClientID...)
+	case DISCONNECT:
+		if p.Duration > 0 {
+			u16(p.Duration)
+		}
+	}
+
+	// prepend header
+	if len(body)+2 <= 255 {
+		return append([]byte{byte(len(body) + 2), byte(p.Type)}, body...)
+	}
+
+	length := len(body) + 4
+	return append([]byte{0x01, byte(length >> 8), byte(length), byte(p.Type)}, body...)
+}
+
+// Decode will decode a single packet from the datagram.
+func Decode(data []byte) (*Packet, error) {
+	// check size
+	if len(data) < 2 {
+		return nil, ErrMalformedPacket
+	}
+
+	// read length
+	length := int(data[0])
+	offset := 1
+	if length == 0x01 {
+		if len(data) < 4 {
+			return nil, ErrMalformedPacket
+		}
+
+		length = int(binary.BigEndian.Uint16(data[1:]))
+		offset = 3
+	}
+
+	// check length
+	if length != len(data) || length < offset+1 {
+		return nil, ErrMalformedPacket
+	}
+
+	// read type
+	p := &Packet{Type: Type(data[offset])}
+	body := data[offset+1:]
+
+	// prepare readers
+	var err error
+	need := func(n int) bool {
+		if len(body) < n {
+			err = ErrMalformedPacket
+			return false
+		}
+		return true
+	}
+	u16 := func() uint16 {
+		v := binary.BigEndian.Uint16(body)
+		body = body[2:]
+		return v
+	}
+
+	// the topic of publish, subscribe and unsubscribe packets
+	topic := func(rest bool) {
+		if p.TopicIDType == ShortTopic && need(2) {
+			p.TopicName = string(body[:2])
+			body = body[2:]
+		} else if (p.TopicIDType == PredefinedTopic || !rest) && need(2) {
+			p.TopicID = u16()
+		} else if p.TopicIDType == NormalTopic && rest {
+			p.TopicName = string(body)
+			body = nil
+		}
+	}
+
+	switch p.Type {
+	case CONNECT:
+		if need(4) {
+			p.setFlags(body[0])
+			if body[1] != protocolVersion {
+				return nil, ErrMalformedPacket
+			}
+			body = body[2:]
+			p.Duration = u16()
+			p.ClientID = string(body)
+		}
+	case CONNACK:
+		if need(1) {
+			p.ReturnCode = ReturnCode(body[0])
+		}
+	case REGISTER:
+		if need(4) {
+			p.TopicID = u16()
+			p.MsgID = u16()
+			p.TopicName = string(body)
+		}
+	case REGACK, PUBACK:
+		if need(5) {
+			p.TopicID = u16()
+			p.MsgID = u16()
+			p.ReturnCode = ReturnCode(body[0])
+		}
+	case PUBLISH:
+		if need(5) {
+			p.setFlags(body[0])
+			body = body[1:]
+			topic(false)
+			p.MsgID = u16()
+			p.Data = body
+		}
+	case SUBSCRIBE, UNSUBSCRIBE:
+		if need(3) {
+			p.setFlags(body[0])
+			body = body[1:]
+			p.MsgID = u16()
+			topic(true)
+		}
+	case SUBACK:
+		if need(6) {
+			p.setFlags(body[0])
+			body = body[1:]
+			p.TopicID = u16()
+			p.MsgID = u16()
+			p.ReturnCode = ReturnCode(body[0])
+		}
+	case UNSUBACK:
+		if need(2) {
+			p.MsgID = u16()
+		}
+	case PINGREQ:
+		p.ClientID = string(body)
+	case PINGRESP:
+	case DISCONNECT:
+		if len(body) >= 2 {
+			p.Duration = u16()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported packet type %s", p.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
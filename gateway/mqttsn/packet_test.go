@@ -0,0 +1,69 @@
+package mqttsn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketEncodeDecode(t *testing.T) {
+	packets := []*Packet{
+		{Type: CONNECT, CleanSession: true, Duration: 30, ClientID: "foo"},
+		{Type: CONNACK, ReturnCode: NotSupported},
+		{Type: REGISTER, TopicID: 1, MsgID: 2, TopicName: "foo/bar"},
+		{Type: REGACK, TopicID: 1, MsgID: 2, ReturnCode: Accepted},
+		{Type: PUBLISH, QOS: 1, Retain: true, TopicID: 1, MsgID: 2, Data: []byte("foo")},
+		{Type: PUBLISH, Dup: true, TopicIDType: ShortTopic, TopicName: "ab", Data: []byte("foo")},
+		{Type: PUBLISH, TopicIDType: PredefinedTopic, TopicID: 7, Data: []byte{}},
+		{Type: PUBACK, TopicID: 1, MsgID: 2, ReturnCode: InvalidTopicID},
+		{Type: SUBSCRIBE, QOS: 1, MsgID: 3, TopicName: "foo/#"},
+		{Type: SUBSCRIBE, TopicIDType: PredefinedTopic, MsgID: 3, TopicID: 7},
+		{Type: SUBSCRIBE, TopicIDType: ShortTopic, MsgID: 3, TopicName: "ab"},
+		{Type: SUBACK, QOS: 1, TopicID: 1, MsgID: 3, ReturnCode: Accepted},
+		{Type: UNSUBSCRIBE, MsgID: 4, TopicName: "foo/#"},
+		{Type: UNSUBACK, MsgID: 4},
+		{Type: PINGREQ},
+		{Type: PINGREQ, ClientID: "foo"},
+		{Type: PINGRESP},
+		{Type: DISCONNECT},
+		{Type: DISCONNECT, Duration: 60},
+	}
+
+	for _, pkt := range packets {
+		data := pkt.Encode()
+		assert.Equal(t, len(data), int(data[0]), pkt.String())
+
+		decoded, err := Decode(data)
+		assert.NoError(t, err, pkt.String())
+		if pkt.Data != nil || decoded.Data != nil {
+			assert.Equal(t, string(pkt.Data), string(decoded.Data), pkt.String())
+			decoded.Data = pkt.Data
+		}
+		assert.Equal(t, pkt, decoded, pkt.String())
+	}
+}
+
+func TestPacketLongLength(t *testing.T) {
+	pkt := &Packet{Type: REGISTER, TopicID: 1, MsgID: 2, TopicName: strings.Repeat("a", 300)}
+
+	data := pkt.Encode()
+	assert.Equal(t, byte(0x01), data[0])
+	assert.Len(t, data, 308)
+
+	decoded, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, decoded)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	assert.Equal(t, ErrMalformedPacket, errOf(Decode(nil)))
+	assert.Equal(t, ErrMalformedPacket, errOf(Decode([]byte{3, byte(PUBACK)})))
+	assert.Equal(t, ErrMalformedPacket, errOf(Decode([]byte{3, byte(PUBACK), 0})))
+	assert.Equal(t, ErrMalformedPacket, errOf(Decode([]byte{4, byte(CONNECT), 0, 0})))
+	assert.Error(t, errOf(Decode([]byte{2, 0xFF})))
+}
+
+func errOf(_ *Packet, err error) error {
+	return err
+}
@@ -1,5 +1,7 @@
 module github.com/256dpi/gomqtt
 
+go 1.19
+
 require (
 	github.com/256dpi/mercury v0.1.0
 	github.com/abiosoft/ishell v2.0.0+incompatible
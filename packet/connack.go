@@ -146,3 +146,10 @@ func (cp *Connack) Encode(dst []byte) (int, error) {
 
 	return total, nil
 }
+
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (cp *Connack) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, cp)
+}
@@ -366,6 +366,13 @@ func (cp *Connect) Encode(dst []byte) (int, error) {
 	return total, nil
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (cp *Connect) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, cp)
+}
+
 // Returns the payload length.
 func (cp *Connect) len() int {
 	total := 0
@@ -0,0 +1,78 @@
+package packet
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// An Encoding holds the encoded publish packet of a message that is forwarded
+// to many connections with the same QOS level. Publish packets that reference
+// the encoding copy its bytes and only fix up the packet identifier instead of
+// encoding the message again.
+type Encoding struct {
+	message Message
+	once    sync.Once
+	data    []byte
+	err     error
+}
+
+// NewEncoding returns a new Encoding for the specified message. The message
+// must not be modified afterwards.
+func NewEncoding(msg Message) *Encoding {
+	return &Encoding{
+		message: msg,
+	}
+}
+
+// matches returns whether the encoding has been created for a message with
+// the same topic, payload, QOS level and retain flag.
+func (e *Encoding) matches(msg Message) bool {
+	return e.message.QOS == msg.QOS &&
+		e.message.Retain == msg.Retain &&
+		e.message.Topic == msg.Topic &&
+		len(e.message.Payload) == len(msg.Payload) &&
+		(len(msg.Payload) == 0 || &e.message.Payload[0] == &msg.Payload[0])
+}
+
+func (e *Encoding) bytes() ([]byte, error) {
+	// encode packet once with a placeholder id
+	e.once.Do(func() {
+		publish := Publish{Message: e.message}
+		if e.message.QOS > 0 {
+			publish.ID = 1
+		}
+
+		e.data = make([]byte, publish.Len())
+		_, e.err = publish.Encode(e.data)
+	})
+
+	return e.data, e.err
+}
+
+func (e *Encoding) encode(dst []byte, id ID) (int, error) {
+	// get data
+	data, err := e.bytes()
+	if err != nil {
+		return 0, err
+	}
+
+	// check buffer
+	if len(dst) < len(data) {
+		return 0, makeError(PUBLISH, "insufficient buffer size, expected %d, got %d", len(data), len(dst))
+	}
+
+	// check packet id
+	if e.message.QOS > 0 && !id.Valid() {
+		return 0, makeError(PUBLISH, "packet id must be grater than zero")
+	}
+
+	// copy data
+	total := copy(dst, data)
+
+	// fix up packet id that precedes the payload
+	if e.message.QOS > 0 {
+		binary.BigEndian.PutUint16(dst[total-len(e.message.Payload)-2:], uint16(id))
+	}
+
+	return total, nil
+}
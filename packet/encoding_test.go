@@ -0,0 +1,126 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoding(t *testing.T) {
+	msg := Message{
+		Topic:   "gomqtt",
+		Payload: []byte("send me home"),
+		QOS:     QOSAtLeastOnce,
+		Retain:  true,
+	}
+
+	encoding := NewEncoding(msg)
+
+	for _, id := range []ID{1, 7, 65535} {
+		pkt1 := NewPublish()
+		pkt1.Message = msg
+		pkt1.ID = id
+
+		pkt2 := NewPublish()
+		pkt2.Message = msg
+		pkt2.ID = id
+		pkt2.Encoding = encoding
+
+		buf1, err := pkt1.EncodeTo(nil)
+		assert.NoError(t, err)
+
+		buf2, err := pkt2.EncodeTo(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, buf1, buf2)
+	}
+
+	pkt := NewPublish()
+	pkt.Message = msg
+	pkt.Encoding = encoding
+
+	_, err := pkt.EncodeTo(nil)
+	assert.Error(t, err)
+
+	buf := make([]byte, 4)
+	pkt.ID = 1
+	_, err = pkt.Encode(buf)
+	assert.Error(t, err)
+}
+
+func TestEncodingQOS0(t *testing.T) {
+	msg := Message{
+		Topic:   "gomqtt",
+		Payload: []byte("send me home"),
+	}
+
+	pkt1 := NewPublish()
+	pkt1.Message = msg
+
+	pkt2 := NewPublish()
+	pkt2.Message = msg
+	pkt2.Encoding = NewEncoding(msg)
+
+	buf1, err := pkt1.EncodeTo(nil)
+	assert.NoError(t, err)
+
+	buf2, err := pkt2.EncodeTo(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, buf1, buf2)
+}
+
+func TestEncodingMismatch(t *testing.T) {
+	msg := Message{
+		Topic:   "gomqtt",
+		Payload: []byte("send me home"),
+		QOS:     QOSAtLeastOnce,
+	}
+
+	encoding := NewEncoding(msg)
+
+	other := msg
+	other.QOS = QOSExactlyOnce
+
+	pkt := NewPublish()
+	pkt.Message = other
+	pkt.ID = 1
+	pkt.Encoding = encoding
+
+	buf, err := pkt.EncodeTo(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(PUBLISH<<4)|4, buf[0])
+
+	other = msg
+	other.Payload = []byte("send me home")
+
+	pkt.Message = other
+	pkt.Dup = true
+
+	buf, err = pkt.EncodeTo(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(PUBLISH<<4)|10, buf[0])
+}
+
+func BenchmarkEncoding(b *testing.B) {
+	msg := Message{
+		Topic:   "foo/bar/baz",
+		Payload: make([]byte, 1024),
+		QOS:     QOSAtLeastOnce,
+	}
+
+	pkt := NewPublish()
+	pkt.Message = msg
+	pkt.ID = 7
+	pkt.Encoding = NewEncoding(msg)
+
+	buf := make([]byte, pkt.Len())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := pkt.Encode(buf)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
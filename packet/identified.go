@@ -97,6 +97,13 @@ func (pp *Puback) Encode(dst []byte) (int, error) {
 	return identifiedEncode(dst, pp.ID, PUBACK)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Puback) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Puback) String() string {
 	return fmt.Sprintf("<Puback ID=%d>", pp.ID)
@@ -141,6 +148,13 @@ func (pp *Pubcomp) Encode(dst []byte) (int, error) {
 	return identifiedEncode(dst, pp.ID, PUBCOMP)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Pubcomp) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Pubcomp) String() string {
 	return fmt.Sprintf("<Pubcomp ID=%d>", pp.ID)
@@ -183,6 +197,13 @@ func (pp *Pubrec) Encode(dst []byte) (int, error) {
 	return identifiedEncode(dst, pp.ID, PUBREC)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Pubrec) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Pubrec) String() string {
 	return fmt.Sprintf("<Pubrec ID=%d>", pp.ID)
@@ -227,6 +248,13 @@ func (pp *Pubrel) Encode(dst []byte) (int, error) {
 	return identifiedEncode(dst, pp.ID, PUBREL)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Pubrel) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Pubrel) String() string {
 	return fmt.Sprintf("<Pubrel ID=%d>", pp.ID)
@@ -269,6 +297,13 @@ func (up *Unsuback) Encode(dst []byte) (int, error) {
 	return identifiedEncode(dst, up.ID, UNSUBACK)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (up *Unsuback) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, up)
+}
+
 // String returns a string representation of the packet.
 func (up *Unsuback) String() string {
 	return fmt.Sprintf("<Unsuback ID=%d>", up.ID)
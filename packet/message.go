@@ -1,6 +1,26 @@
 package packet
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrEmptyTopic is returned by Validate if the message has no topic.
+var ErrEmptyTopic = errors.New("empty topic")
+
+// ErrTopicWildcards is returned by Validate if the message topic contains
+// wildcards.
+var ErrTopicWildcards = errors.New("topic contains wildcards")
+
+// ErrMalformedTopic is returned by Validate if the message topic is too long,
+// not valid UTF-8 or contains null characters.
+var ErrMalformedTopic = errors.New("malformed topic")
+
+// ErrInvalidQOS is returned by Validate if the message has an invalid QOS level.
+var ErrInvalidQOS = errors.New("invalid qos level")
 
 // A Message bundles data that is published between brokers and clients.
 type Message struct {
@@ -15,7 +35,8 @@ type Message struct {
 
 	// If the Retain flag is set to true, the server must store the message,
 	// so that it can be delivered to future subscribers whose subscriptions
-	// match its topic name.
+	// match its topic name. A retained message with an empty payload clears
+	// the currently retained message.
 	Retain bool
 }
 
@@ -29,3 +50,56 @@ func (m *Message) String() string {
 func (m Message) Copy() *Message {
 	return &m
 }
+
+// DeepCopy returns a copy of the message with a copy of the payload. The
+// payload of the copy does not share memory with the payload of the original.
+func (m Message) DeepCopy() *Message {
+	if m.Payload != nil {
+		m.Payload = append(make([]byte, 0, len(m.Payload)), m.Payload...)
+	}
+
+	return &m
+}
+
+// Equal returns whether the message is equal to the specified message. A nil
+// payload is considered equal to an empty payload.
+func (m *Message) Equal(msg *Message) bool {
+	if m == nil || msg == nil {
+		return m == msg
+	}
+
+	return m.Topic == msg.Topic &&
+		bytes.Equal(m.Payload, msg.Payload) &&
+		m.QOS == msg.QOS &&
+		m.Retain == msg.Retain
+}
+
+// Validate checks the message for protocol violations. It returns an error if
+// the topic is empty, malformed or contains wildcards or if the QOS level is
+// invalid. Retained messages with an empty payload are valid as they request
+// the removal of the currently retained message.
+func (m *Message) Validate() error {
+	// check topic length
+	if len(m.Topic) == 0 {
+		return ErrEmptyTopic
+	} else if len(m.Topic) > int(maxLPLength) {
+		return ErrMalformedTopic
+	}
+
+	// check topic encoding
+	if !utf8.ValidString(m.Topic) || strings.ContainsRune(m.Topic, 0) {
+		return ErrMalformedTopic
+	}
+
+	// check wildcards
+	if strings.ContainsAny(m.Topic, "+#") {
+		return ErrTopicWildcards
+	}
+
+	// check qos
+	if !m.QOS.Successful() {
+		return ErrInvalidQOS
+	}
+
+	return nil
+}
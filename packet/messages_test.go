@@ -29,3 +29,55 @@ func TestMessageCopy(t *testing.T) {
 	msg1.Retain = true
 	assert.False(t, msg2.Retain)
 }
+
+func TestMessageDeepCopy(t *testing.T) {
+	msg1 := &Message{
+		Topic:   "w",
+		Payload: []byte("m"),
+	}
+
+	msg2 := msg1.DeepCopy()
+	msg1.Payload[0] = 'n'
+	assert.Equal(t, []byte("m"), msg2.Payload)
+
+	msg3 := (&Message{Topic: "w"}).DeepCopy()
+	assert.Nil(t, msg3.Payload)
+}
+
+func TestMessageEqual(t *testing.T) {
+	msg := &Message{
+		Topic:   "w",
+		Payload: []byte("m"),
+		QOS:     QOSAtLeastOnce,
+		Retain:  true,
+	}
+
+	assert.True(t, msg.Equal(msg.Copy()))
+	assert.False(t, msg.Equal(&Message{Topic: "w", Payload: []byte("m")}))
+	assert.False(t, msg.Equal(nil))
+	assert.True(t, (&Message{Topic: "w"}).Equal(&Message{Topic: "w", Payload: []byte{}}))
+
+	var nilMsg *Message
+	assert.True(t, nilMsg.Equal(nil))
+}
+
+func TestMessageValidate(t *testing.T) {
+	matrix := []struct {
+		msg Message
+		err error
+	}{
+		{Message{Topic: "foo/bar"}, nil},
+		{Message{Topic: "foo", QOS: QOSExactlyOnce, Retain: true}, nil},
+		{Message{Topic: ""}, ErrEmptyTopic},
+		{Message{Topic: string(make([]byte, 65536))}, ErrMalformedTopic},
+		{Message{Topic: "foo\x00bar"}, ErrMalformedTopic},
+		{Message{Topic: "foo\xffbar"}, ErrMalformedTopic},
+		{Message{Topic: "foo/+"}, ErrTopicWildcards},
+		{Message{Topic: "foo/#"}, ErrTopicWildcards},
+		{Message{Topic: "foo", QOS: 3}, ErrInvalidQOS},
+	}
+
+	for _, item := range matrix {
+		assert.Equal(t, item.err, item.msg.Validate(), item.msg.String())
+	}
+}
@@ -56,6 +56,13 @@ func (dp *Disconnect) Encode(dst []byte) (int, error) {
 	return nakedEncode(dst, DISCONNECT)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (dp *Disconnect) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, dp)
+}
+
 // String returns a string representation of the packet.
 func (dp *Disconnect) String() string {
 	return "<Disconnect>"
@@ -92,6 +99,13 @@ func (pp *Pingreq) Encode(dst []byte) (int, error) {
 	return nakedEncode(dst, PINGREQ)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Pingreq) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Pingreq) String() string {
 	return "<Pingreq>"
@@ -131,6 +145,13 @@ func (pp *Pingresp) Encode(dst []byte) (int, error) {
 	return nakedEncode(dst, PINGRESP)
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Pingresp) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // String returns a string representation of the packet.
 func (pp *Pingresp) String() string {
 	return "<Pingresp>"
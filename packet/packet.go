@@ -1,7 +1,7 @@
 // Package packet implements functionality for encoding and decoding MQTT packets.
 package packet
 
-import "encoding/binary"
+import "errors"
 
 // QOS is the type used to store quality of service levels.
 type QOS byte
@@ -58,24 +58,97 @@ type Generic interface {
 	String() string
 }
 
-// DetectPacket tries to detect the next packet in a buffer. It returns a length
-// greater than zero if the packet has been detected as well as its Type.
-func DetectPacket(src []byte) (int, Type) {
+// appender is implemented by packets that can append their encoding to a
+// buffer.
+type appender interface {
+	EncodeTo(buf []byte) ([]byte, error)
+}
+
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged. Packets that
+// do not implement an EncodeTo method are encoded using Len and Encode.
+func EncodeTo(buf []byte, pkt Generic) ([]byte, error) {
+	// use packet method if available
+	if a, ok := pkt.(appender); ok {
+		return a.EncodeTo(buf)
+	}
+
+	return encodeTo(buf, pkt)
+}
+
+// encodeTo implements the EncodeTo method for all packets.
+func encodeTo(buf []byte, pkt Generic) ([]byte, error) {
+	// get lengths
+	length := len(buf)
+	packetLength := pkt.Len()
+
+	// grow buffer if necessary
+	if cap(buf)-length < packetLength {
+		newBuf := make([]byte, length, length+packetLength)
+		copy(newBuf, buf)
+		buf = newBuf
+	}
+
+	// encode packet
+	n, err := pkt.Encode(buf[length : length+packetLength])
+	if err != nil {
+		return buf[:length], err
+	}
+
+	return buf[:length+n], nil
+}
+
+// ErrNeedMoreData is returned by Detect if the buffer does not yet hold the
+// complete fixed header of the next packet.
+var ErrNeedMoreData = errors.New("need more data")
+
+// Detect tries to detect the next packet in a buffer that may only hold a part
+// of the fixed header. If the header is complete, it returns the total length
+// of the packet and its Type. If the header is incomplete, it returns the
+// minimum number of bytes the buffer must hold to continue the detection and
+// ErrNeedMoreData. ErrDetectionOverflow is returned if the remaining length
+// is encoded using more than four bytes.
+func Detect(src []byte) (int, Type, error) {
 	// check for minimum size
 	if len(src) < 2 {
-		return 0, 0
+		return 2, 0, ErrNeedMoreData
 	}
 
 	// get type
 	t := Type(src[0] >> 4)
 
-	// get remaining length
-	rl, n := binary.Uvarint(src[1:])
-	if n <= 0 {
+	// read remaining length
+	rl := 0
+	for i := 0; i < 4; i++ {
+		// check buffer
+		if len(src) < 2+i {
+			return 2 + i, 0, ErrNeedMoreData
+		}
+
+		// add byte
+		b := src[1+i]
+		rl |= int(b&0x7f) << (7 * uint(i))
+
+		// check for last byte
+		if b&0x80 == 0 {
+			return 2 + i + rl, t, nil
+		}
+	}
+
+	return 0, 0, ErrDetectionOverflow
+}
+
+// DetectPacket tries to detect the next packet in a buffer. It returns a length
+// greater than zero if the packet has been detected as well as its Type.
+func DetectPacket(src []byte) (int, Type) {
+	// detect packet
+	l, t, err := Detect(src)
+	if err != nil {
 		return 0, 0
 	}
 
-	return 1 + n + int(rl), t
+	return l, t
 }
 
 // GetID checks the packets type and returns its ID and true, or if it
@@ -144,3 +144,95 @@ func TestFuzz(t *testing.T) {
 	b3 := []byte{2 << 4, 0x02, 0x00, 0x01}
 	assert.Equal(t, 1, Fuzz(b3))
 }
+
+type plainPacket struct {
+	Generic
+}
+
+func TestEncodeTo(t *testing.T) {
+	publish := NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+	publish.Message.QOS = QOSAtLeastOnce
+
+	for _, pkt := range []Generic{
+		NewConnect(),
+		NewConnack(),
+		publish,
+		&Puback{ID: 1},
+		&Pubrec{ID: 1},
+		&Pubrel{ID: 1},
+		&Pubcomp{ID: 1},
+		&Subscribe{ID: 1, Subscriptions: []Subscription{{Topic: "foo"}}},
+		&Suback{ID: 1, ReturnCodes: []QOS{QOSAtMostOnce}},
+		&Unsubscribe{ID: 1, Topics: []string{"foo"}},
+		&Unsuback{ID: 1},
+		NewPingreq(),
+		NewPingresp(),
+		NewDisconnect(),
+	} {
+		expected := make([]byte, pkt.Len())
+		_, err := pkt.Encode(expected)
+		assert.NoError(t, err)
+
+		buf, err := EncodeTo(nil, pkt)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, buf)
+
+		buf, err = EncodeTo([]byte("prefix"), pkt)
+		assert.NoError(t, err)
+		assert.Equal(t, append([]byte("prefix"), expected...), buf)
+
+		// packets without an EncodeTo method
+		buf, err = EncodeTo([]byte("prefix"), plainPacket{pkt})
+		assert.NoError(t, err)
+		assert.Equal(t, append([]byte("prefix"), expected...), buf)
+	}
+}
+
+func TestEncodeToReuse(t *testing.T) {
+	buf := make([]byte, 0, 64)
+
+	out, err := NewPingreq().EncodeTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(out))
+	assert.Equal(t, &buf[:1][0], &out[0])
+
+	out, err = (&Puback{}).EncodeTo(out)
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(out))
+}
+
+func TestDetectIncremental(t *testing.T) {
+	buf := []byte{0x30, 0xff, 0xff, 0x7f}
+
+	l, tt, err := Detect(buf[:0])
+	assert.Equal(t, ErrNeedMoreData, err)
+	assert.Equal(t, 2, l)
+	assert.Equal(t, Type(0), tt)
+
+	l, _, err = Detect(buf[:1])
+	assert.Equal(t, ErrNeedMoreData, err)
+	assert.Equal(t, 2, l)
+
+	l, _, err = Detect(buf[:2])
+	assert.Equal(t, ErrNeedMoreData, err)
+	assert.Equal(t, 3, l)
+
+	l, _, err = Detect(buf[:3])
+	assert.Equal(t, ErrNeedMoreData, err)
+	assert.Equal(t, 4, l)
+
+	l, tt, err = Detect(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 4+2097151, l)
+	assert.Equal(t, PUBLISH, tt)
+}
+
+func TestDetectOverflow(t *testing.T) {
+	l, tt, err := Detect([]byte{0x10, 0xff, 0xff, 0xff, 0xff, 0x01})
+	assert.Equal(t, ErrDetectionOverflow, err)
+	assert.Equal(t, 0, l)
+	assert.Equal(t, Type(0), tt)
+}
@@ -0,0 +1,91 @@
+package packet
+
+import "sync"
+
+// The pools below allow reusing packets and messages on hot paths to reduce
+// allocations. A value obtained from a pool is owned by the caller. Ownership
+// may be handed over, e.g. by passing a packet to a function that stores it,
+// in which case the new owner is responsible for returning it. The owner may
+// return a value once no other code references it anymore. A returned value
+// must not be used afterwards.
+
+var packetPools = map[Type]*sync.Pool{
+	CONNECT:     {New: func() interface{} { return NewConnect() }},
+	CONNACK:     {New: func() interface{} { return NewConnack() }},
+	PUBLISH:     {New: func() interface{} { return NewPublish() }},
+	PUBACK:      {New: func() interface{} { return NewPuback() }},
+	PUBREC:      {New: func() interface{} { return NewPubrec() }},
+	PUBREL:      {New: func() interface{} { return NewPubrel() }},
+	PUBCOMP:     {New: func() interface{} { return NewPubcomp() }},
+	SUBSCRIBE:   {New: func() interface{} { return NewSubscribe() }},
+	SUBACK:      {New: func() interface{} { return NewSuback() }},
+	UNSUBSCRIBE: {New: func() interface{} { return NewUnsubscribe() }},
+	UNSUBACK:    {New: func() interface{} { return NewUnsuback() }},
+}
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return &Message{}
+	},
+}
+
+// Acquire returns an empty packet of the specified type from the pool. The
+// packet should be returned using Recycle once it is not used anymore.
+func Acquire(t Type) (Generic, error) {
+	// get pool
+	pool, ok := packetPools[t]
+	if !ok {
+		return t.New()
+	}
+
+	return pool.Get().(Generic), nil
+}
+
+// Recycle resets the packet and returns it to the pool. The borrowed payload
+// buffer of a Publish packet is released as well.
+func Recycle(pkt Generic) {
+	// reset packet
+	switch p := pkt.(type) {
+	case *Connect:
+		*p = Connect{}
+	case *Connack:
+		*p = Connack{}
+	case *Publish:
+		p.Release()
+		*p = Publish{}
+	case *Puback:
+		*p = Puback{}
+	case *Pubrec:
+		*p = Pubrec{}
+	case *Pubrel:
+		*p = Pubrel{}
+	case *Pubcomp:
+		*p = Pubcomp{}
+	case *Subscribe:
+		*p = Subscribe{}
+	case *Suback:
+		*p = Suback{}
+	case *Unsubscribe:
+		*p = Unsubscribe{}
+	case *Unsuback:
+		*p = Unsuback{}
+	default:
+		return
+	}
+
+	// return packet
+	packetPools[pkt.Type()].Put(pkt)
+}
+
+// AcquireMessage returns an empty message from the pool. The message should be
+// returned using RecycleMessage once it is not used anymore.
+func AcquireMessage() *Message {
+	return messagePool.Get().(*Message)
+}
+
+// RecycleMessage resets the message and returns it to the pool. The payload is
+// not reused.
+func RecycleMessage(msg *Message) {
+	*msg = Message{}
+	messagePool.Put(msg)
+}
@@ -0,0 +1,98 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireAndRecycle(t *testing.T) {
+	for _, typ := range []Type{CONNECT, CONNACK, PUBLISH, PUBACK, PUBREC, PUBREL, PUBCOMP, SUBSCRIBE, SUBACK, UNSUBSCRIBE, UNSUBACK, PINGREQ, PINGRESP, DISCONNECT} {
+		pkt, err := Acquire(typ)
+		assert.NoError(t, err)
+		assert.Equal(t, typ, pkt.Type())
+
+		Recycle(pkt)
+	}
+
+	_, err := Acquire(0)
+	assert.Equal(t, ErrInvalidPacketType, err)
+}
+
+func TestRecycleReset(t *testing.T) {
+	pkt, err := Acquire(PUBLISH)
+	assert.NoError(t, err)
+
+	publish := pkt.(*Publish)
+	publish.ID = 7
+	publish.Dup = true
+	publish.Message = Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+
+	Recycle(publish)
+	assert.Equal(t, Publish{}, *publish)
+
+	pkt, err = Acquire(SUBACK)
+	assert.NoError(t, err)
+
+	suback := pkt.(*Suback)
+	suback.ID = 1
+	suback.ReturnCodes = []QOS{0, 1}
+
+	Recycle(suback)
+	assert.Equal(t, Suback{}, *suback)
+}
+
+func TestRecycleBorrowed(t *testing.T) {
+	pub := NewPublish()
+	pub.Message = Message{Topic: "foo", Payload: []byte("bar")}
+
+	buf, err := pub.EncodeTo(nil)
+	assert.NoError(t, err)
+
+	dec := NewDecoder(bytes.NewReader(buf))
+	dec.ZeroCopy = true
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.True(t, pkt.(*Publish).Borrowed())
+
+	Recycle(pkt)
+	assert.False(t, pkt.(*Publish).Borrowed())
+}
+
+func TestMessagePool(t *testing.T) {
+	msg := AcquireMessage()
+	assert.Equal(t, Message{}, *msg)
+
+	msg.Topic = "foo"
+	msg.Payload = []byte("bar")
+
+	RecycleMessage(msg)
+	assert.Equal(t, Message{}, *msg)
+}
+
+func BenchmarkDecoderRecycle(b *testing.B) {
+	puback := NewPuback()
+	puback.ID = 7
+
+	buf, err := puback.EncodeTo(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	data := bytes.Repeat(buf, b.N)
+	dec := NewDecoder(bytes.NewReader(data))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		pkt, err := dec.Read()
+		if err != nil {
+			panic(err)
+		}
+
+		Recycle(pkt)
+	}
+}
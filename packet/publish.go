@@ -19,6 +19,14 @@ type Publish struct {
 
 	// The packet identifier.
 	ID ID
+
+	// The shared encoding of the message that is copied instead of encoding
+	// the message again. It is ignored if the Dup flag is set or if it has
+	// been created for a different message.
+	Encoding *Encoding
+
+	// the borrowed buffer backing the payload
+	buffer *[]byte
 }
 
 // NewPublish creates a new Publish packet.
@@ -46,6 +54,33 @@ func (pp *Publish) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Publish) Decode(src []byte) (int, error) {
+	return pp.decode(src, true)
+}
+
+// Release returns the buffer backing the payload of a packet that has been
+// read by a Decoder in zero copy mode. The payload must not be used after
+// calling Release. Calling Release on packets with an owned payload has no
+// effect.
+func (pp *Publish) Release() {
+	// check buffer
+	if pp.buffer == nil {
+		return
+	}
+
+	// return buffer
+	bufferPool.Put(pp.buffer)
+	pp.buffer = nil
+	pp.Message.Payload = nil
+}
+
+// Borrowed returns whether the payload references a buffer that must be
+// returned using Release. Borrowed payloads must be copied if they are used
+// after the packet has been released.
+func (pp *Publish) Borrowed() bool {
+	return pp.buffer != nil
+}
+
+func (pp *Publish) decode(src []byte, safe bool) (int, error) {
 	total := 0
 
 	// decode header
@@ -100,8 +135,13 @@ func (pp *Publish) Decode(src []byte) (int, error) {
 
 	// read payload
 	if l > 0 {
-		pp.Message.Payload = make([]byte, l)
-		copy(pp.Message.Payload, src[total:total+l])
+		if safe {
+			pp.Message.Payload = make([]byte, l)
+			copy(pp.Message.Payload, src[total:total+l])
+		} else {
+			pp.Message.Payload = src[total : total+l]
+		}
+
 		total += len(pp.Message.Payload)
 	}
 
@@ -112,6 +152,11 @@ func (pp *Publish) Decode(src []byte) (int, error) {
 // returns the number of bytes encoded and whether there's any errors along
 // the way. If there is an error, the byte slice should be considered invalid.
 func (pp *Publish) Encode(dst []byte) (int, error) {
+	// use shared encoding
+	if pp.Encoding != nil && !pp.Dup && pp.Encoding.matches(pp.Message) {
+		return pp.Encoding.encode(dst, pp.ID)
+	}
+
 	total := 0
 
 	// check topic length
@@ -175,6 +220,13 @@ func (pp *Publish) Encode(dst []byte) (int, error) {
 	return total, nil
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (pp *Publish) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, pp)
+}
+
 // Returns the payload length.
 func (pp *Publish) len() int {
 	total := 2 + len(pp.Message.Topic) + len(pp.Message.Payload)
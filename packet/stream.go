@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/256dpi/mercury"
@@ -21,7 +22,7 @@ var ErrReadLimitExceeded = errors.New("read limit exceeded")
 // An Encoder wraps a Writer and continuously encodes packets.
 type Encoder struct {
 	writer *mercury.Writer
-	buffer bytes.Buffer
+	buffer []byte
 }
 
 // NewEncoder creates a new Encoder.
@@ -33,18 +34,15 @@ func NewEncoder(writer io.Writer, maxWriteDelay time.Duration) *Encoder {
 
 // Write encodes and writes the passed packet to the write buffer.
 func (e *Encoder) Write(pkt Generic, async bool) error {
-	// reset and eventually grow buffer
-	packetLength := pkt.Len()
-	e.buffer.Reset()
-	e.buffer.Grow(packetLength)
-	buf := e.buffer.Bytes()[0:packetLength]
-
-	// encode packet
-	_, err := pkt.Encode(buf)
+	// encode packet into reused buffer
+	buf, err := EncodeTo(e.buffer[:0], pkt)
 	if err != nil {
 		return err
 	}
 
+	// keep eventually grown buffer
+	e.buffer = buf
+
 	// write buffer
 	if async {
 		_, err = e.writer.Write(buf)
@@ -63,10 +61,22 @@ func (e *Encoder) Flush() error {
 	return e.writer.Flush()
 }
 
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
 // A Decoder wraps a Reader and continuously decodes packets.
 type Decoder struct {
 	Limit int64
 
+	// If ZeroCopy is set, payloads of decoded Publish packets reference the
+	// read buffer instead of being copied. The buffer is owned by the packet
+	// until Release is called on it. Messages that are retained after the
+	// packet has been released must be copied beforehand.
+	ZeroCopy bool
+
 	reader *bufio.Reader
 	buffer bytes.Buffer
 }
@@ -78,17 +88,13 @@ func NewDecoder(reader io.Reader) *Decoder {
 	}
 }
 
-// Read reads the next packet from the buffered reader.
+// Read reads the next packet from the buffered reader. The packet is acquired
+// from the pool and may be returned using Recycle by its owner.
 func (d *Decoder) Read() (Generic, error) {
 	// initial detection length
 	detectionLength := 2
 
 	for {
-		// check length
-		if detectionLength > 5 {
-			return nil, ErrDetectionOverflow
-		}
-
 		// try read detection bytes
 		header, err := d.reader.Peek(detectionLength)
 		if err == io.EOF && len(header) != 0 {
@@ -99,13 +105,15 @@ func (d *Decoder) Read() (Generic, error) {
 		}
 
 		// detect packet
-		packetLength, packetType := DetectPacket(header)
+		packetLength, packetType, err := Detect(header)
 
-		// on zero packet length:
-		// increment detection length and try again
-		if packetLength <= 0 {
-			detectionLength++
+		// on missing data:
+		// increase detection length and try again
+		if err == ErrNeedMoreData {
+			detectionLength = packetLength
 			continue
+		} else if err != nil {
+			return nil, err
 		}
 
 		// check read limit
@@ -113,12 +121,17 @@ func (d *Decoder) Read() (Generic, error) {
 			return nil, ErrReadLimitExceeded
 		}
 
-		// create packet
-		pkt, err := packetType.New()
+		// acquire packet
+		pkt, err := Acquire(packetType)
 		if err != nil {
 			return nil, err
 		}
 
+		// decode publish packets into a borrowed buffer in zero copy mode
+		if publish, ok := pkt.(*Publish); ok && d.ZeroCopy {
+			return d.borrow(publish, packetLength)
+		}
+
 		// reset and eventually grow buffer
 		d.buffer.Reset()
 		d.buffer.Grow(packetLength)
@@ -127,12 +140,14 @@ func (d *Decoder) Read() (Generic, error) {
 		// read whole packet (will not return EOF)
 		_, err = io.ReadFull(d.reader, buf)
 		if err != nil {
+			Recycle(pkt)
 			return nil, err
 		}
 
 		// decode buffer
 		_, err = pkt.Decode(buf)
 		if err != nil {
+			Recycle(pkt)
 			return nil, err
 		}
 
@@ -140,6 +155,34 @@ func (d *Decoder) Read() (Generic, error) {
 	}
 }
 
+func (d *Decoder) borrow(publish *Publish, packetLength int) (Generic, error) {
+	// get buffer from pool and eventually grow it
+	buffer := bufferPool.Get().(*[]byte)
+	if cap(*buffer) < packetLength {
+		*buffer = make([]byte, packetLength)
+	}
+
+	// assign buffer
+	buf := (*buffer)[0:packetLength]
+	publish.buffer = buffer
+
+	// read whole packet (will not return EOF)
+	_, err := io.ReadFull(d.reader, buf)
+	if err != nil {
+		Recycle(publish)
+		return nil, err
+	}
+
+	// decode buffer without copying the payload
+	_, err = publish.decode(buf, false)
+	if err != nil {
+		Recycle(publish)
+		return nil, err
+	}
+
+	return publish, nil
+}
+
 // A Stream combines an Encoder and Decoder
 type Stream struct {
 	*Decoder
@@ -158,3 +158,63 @@ func TestStream(t *testing.T) {
 	assert.NotNil(t, pkt)
 	assert.NoError(t, err)
 }
+
+func TestDecoderZeroCopy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+	dec.ZeroCopy = true
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+	b := make([]byte, publish.Len())
+	publish.Encode(b)
+	buf.Write(b)
+	buf.Write(b)
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.True(t, pkt.(*Publish).Borrowed())
+	assert.Equal(t, []byte("bar"), pkt.(*Publish).Message.Payload)
+
+	pkt2, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), pkt.(*Publish).Message.Payload)
+	assert.Equal(t, []byte("bar"), pkt2.(*Publish).Message.Payload)
+
+	msg := pkt.(*Publish).Message.DeepCopy()
+	pkt.(*Publish).Release()
+	assert.False(t, pkt.(*Publish).Borrowed())
+	assert.Nil(t, pkt.(*Publish).Message.Payload)
+	assert.Equal(t, []byte("bar"), msg.Payload)
+
+	pkt2.(*Publish).Release()
+	pkt2.(*Publish).Release()
+}
+
+func TestDecoderZeroCopyOtherPackets(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+	dec.ZeroCopy = true
+
+	var pkt Generic = NewConnect()
+	b := make([]byte, pkt.Len())
+	pkt.Encode(b)
+	buf.Write(b)
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, CONNECT, pkt.Type())
+}
+
+func TestDecoderZeroCopyDecodeError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+	dec.ZeroCopy = true
+
+	buf.Write([]byte{0x32, 0x02, 0x00, 0x00})
+
+	pkt, err := dec.Read()
+	assert.Error(t, err)
+	assert.Nil(t, pkt)
+}
@@ -134,6 +134,13 @@ func (sp *Suback) Encode(dst []byte) (int, error) {
 	return total, nil
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (sp *Suback) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, sp)
+}
+
 // Returns the payload length.
 func (sp *Suback) len() int {
 	return 2 + len(sp.ReturnCodes)
@@ -132,6 +132,13 @@ func (up *Unsubscribe) Encode(dst []byte) (int, error) {
 	return total, nil
 }
 
+// EncodeTo appends the encoded packet to the specified buffer and returns the
+// extended buffer. The buffer is grown if its capacity is insufficient. If
+// there is an error, the original buffer is returned unchanged.
+func (up *Unsubscribe) EncodeTo(buf []byte) ([]byte, error) {
+	return encodeTo(buf, up)
+}
+
 // Returns the payload length.
 func (up *Unsubscribe) len() int {
 	// packet ID
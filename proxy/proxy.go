@@ -0,0 +1,339 @@
+// Package proxy implements an MQTT aware reverse proxy that routes client
+// connections to upstream brokers.
+//
+// The proxy reads the CONNECT packet of every client and asks a router for the
+// upstream broker based on the client id, username or TLS server name. The
+// packets are then relayed unchanged between the client and the broker. TLS is
+// terminated by launching the servers passed to the proxy with a secure URL.
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/cluster"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+
+	"gopkg.in/tomb.v2"
+)
+
+// ErrNoRoute is returned by routers if no upstream broker is available.
+var ErrNoRoute = errors.New("no route")
+
+// ErrExpectedConnect is reported if a client did not send a CONNECT packet
+// as its first packet.
+var ErrExpectedConnect = errors.New("expected a connect packet")
+
+// A Request describes a client connection that should be routed.
+type Request struct {
+	// The connection of the client.
+	Conn transport.Conn
+
+	// The CONNECT packet sent by the client.
+	Connect *packet.Connect
+
+	// The server name requested by the client using SNI. It is only set for
+	// connections secured using TLS.
+	ServerName string
+}
+
+// A Router returns the URL of the upstream broker for a request. Errors
+// reject the client with a ServerUnavailable return code.
+type Router func(req *Request) (string, error)
+
+// RingRouter returns a router that routes requests to the node of the ring
+// that owns the key returned by the specified function. The addresses of the
+// nodes must be broker URLs.
+func RingRouter(ring *cluster.Ring, key func(req *Request) string) Router {
+	return func(req *Request) (string, error) {
+		// get owner
+		node, ok := ring.Owner(key(req))
+		if !ok {
+			return "", ErrNoRoute
+		}
+
+		return node.Addr, nil
+	}
+}
+
+// ByClientID returns the client id of the request.
+func ByClientID(req *Request) string {
+	return req.Connect.ClientID
+}
+
+// ByUsername returns the username of the request.
+func ByUsername(req *Request) string {
+	return req.Connect.Username
+}
+
+// ByServerName returns the TLS server name of the request.
+func ByServerName(req *Request) string {
+	return req.ServerName
+}
+
+// A Proxy accepts client connections and relays them to upstream brokers.
+type Proxy struct {
+	// The router that selects the upstream broker.
+	Router Router
+
+	// The dialer used to connect to upstream brokers.
+	//
+	// Will default to transport.NewDialer().
+	Dialer *transport.Dialer
+
+	// ConnectTimeout defines the timeout to receive the CONNECT packet.
+	//
+	// Will default to 10 seconds.
+	ConnectTimeout time.Duration
+
+	// The DefaultReadLimit defines the maximum size of packets received from
+	// clients and upstream brokers.
+	DefaultReadLimit int64
+
+	// OnError can be used to receive errors from the proxy. Errors of accept
+	// loops require the proxy to be restarted while errors of individual
+	// connections are informational.
+	OnError func(error)
+
+	conns map[transport.Conn]struct{}
+	mutex sync.Mutex
+	tomb  tomb.Tomb
+}
+
+// NewProxy returns a new Proxy that uses the specified router.
+func NewProxy(router Router) *Proxy {
+	return &Proxy{
+		Router:         router,
+		Dialer:         transport.NewDialer(),
+		ConnectTimeout: 10 * time.Second,
+	}
+}
+
+// Accept begins accepting connections from the passed server.
+func (p *Proxy) Accept(server transport.Server) {
+	p.tomb.Go(func() error {
+		for {
+			// accept next connection
+			conn, err := server.Accept()
+			if err != nil {
+				// ignore error if dying
+				if !p.tomb.Alive() {
+					return tomb.ErrDying
+				}
+
+				// call error callback if available
+				if p.OnError != nil {
+					p.OnError(err)
+				}
+
+				return err
+			}
+
+			// handle connection
+			if !p.Handle(conn) {
+				return nil
+			}
+		}
+	})
+}
+
+// Handle takes over responsibility and relays a transport.Conn. It returns
+// false if the proxy is closing and the connection has been closed.
+func (p *Proxy) Handle(conn transport.Conn) bool {
+	// acquire mutex
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// close conn immediately when dying
+	if !p.tomb.Alive() {
+		_ = conn.Close()
+		return false
+	}
+
+	// track connection
+	if p.conns == nil {
+		p.conns = make(map[transport.Conn]struct{})
+	}
+	p.conns[conn] = struct{}{}
+
+	// relay connection
+	go p.relay(conn)
+
+	return true
+}
+
+// Close will stop accepting connections and close all relayed connections.
+// The call will block until all acceptors returned.
+//
+// Note: All passed servers to Accept must be closed before calling this
+// method.
+func (p *Proxy) Close() {
+	// acquire mutex
+	p.mutex.Lock()
+
+	// track at least one goroutine as the tomb never dies otherwise if no
+	// server has been accepted
+	if p.tomb.Alive() {
+		p.tomb.Go(func() error {
+			<-p.tomb.Dying()
+			return nil
+		})
+	}
+
+	// kill tomb
+	p.tomb.Kill(nil)
+
+	// close connections
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+
+	// release mutex
+	p.mutex.Unlock()
+
+	// wait for acceptors
+	_ = p.tomb.Wait()
+}
+
+func (p *Proxy) relay(conn transport.Conn) {
+	// untrack connection when done
+	defer func() {
+		p.mutex.Lock()
+		delete(p.conns, conn)
+		p.mutex.Unlock()
+	}()
+
+	// set read limit and timeout
+	conn.SetReadLimit(p.DefaultReadLimit)
+	conn.SetReadTimeout(p.connectTimeout())
+
+	// receive connect packet
+	pkt, err := conn.Receive()
+	if err != nil {
+		p.fail(conn, nil, err)
+		return
+	}
+
+	// check packet
+	connect, ok := pkt.(*packet.Connect)
+	if !ok {
+		p.fail(conn, nil, ErrExpectedConnect)
+		return
+	}
+
+	// prepare request
+	req := &Request{
+		Conn:    conn,
+		Connect: connect,
+	}
+
+	// get server name
+	if state, ok := transport.ConnectionState(conn); ok {
+		req.ServerName = state.ServerName
+	}
+
+	// route request
+	url, err := p.Router(req)
+	if err == nil && url == "" {
+		err = ErrNoRoute
+	}
+	if err != nil {
+		p.reject(conn, err)
+		return
+	}
+
+	// dial upstream
+	upstream, err := p.dialer().Dial(url)
+	if err != nil {
+		p.reject(conn, err)
+		return
+	}
+
+	// set upstream read limit
+	upstream.SetReadLimit(p.DefaultReadLimit)
+
+	// forward connect packet
+	err = upstream.Send(connect, false)
+	if err != nil {
+		p.fail(conn, upstream, err)
+		return
+	}
+
+	// the upstream broker enforces the keep alive
+	conn.SetReadTimeout(0)
+
+	// relay packets from the upstream broker
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		forward(upstream, conn)
+	}()
+
+	// relay packets from the client
+	forward(conn, upstream)
+
+	// wait for upstream relay
+	<-done
+}
+
+func (p *Proxy) reject(conn transport.Conn, err error) {
+	// send connack
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.ServerUnavailable
+	_ = conn.Send(connack, false)
+
+	p.fail(conn, nil, err)
+}
+
+func (p *Proxy) fail(conn, upstream transport.Conn, err error) {
+	// close connections
+	_ = conn.Close()
+	if upstream != nil {
+		_ = upstream.Close()
+	}
+
+	// call error callback if available
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+func (p *Proxy) connectTimeout() time.Duration {
+	if p.ConnectTimeout > 0 {
+		return p.ConnectTimeout
+	}
+
+	return 10 * time.Second
+}
+
+func (p *Proxy) dialer() *transport.Dialer {
+	if p.Dialer != nil {
+		return p.Dialer
+	}
+
+	return transport.NewDialer()
+}
+
+// forward will relay packets from the source to the destination until either
+// connection fails and then close both connections.
+func forward(src, dst transport.Conn) {
+	for {
+		// receive packet
+		pkt, err := src.Receive()
+		if err != nil {
+			break
+		}
+
+		// send packet
+		err = dst.Send(pkt, false)
+		if err != nil {
+			break
+		}
+	}
+
+	// close connections
+	_ = src.Close()
+	_ = dst.Close()
+}
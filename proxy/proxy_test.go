@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/cluster"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runProxy(t *testing.T, launcher *transport.Launcher, url string, router Router) (*Proxy, string, func()) {
+	server, err := launcher.Launch(url)
+	require.NoError(t, err)
+
+	proxy := NewProxy(router)
+	proxy.Accept(server)
+
+	return proxy, server.Addr().String(), func() {
+		_ = server.Close()
+		proxy.Close()
+	}
+}
+
+func TestProxy(t *testing.T) {
+	engine1 := broker.NewEngine(broker.NewMemoryBackend())
+	port1, quit1, done1 := broker.Run(engine1, "tcp")
+
+	engine2 := broker.NewEngine(broker.NewMemoryBackend())
+	port2, quit2, done2 := broker.Run(engine2, "tcp")
+
+	_, addr, stop := runProxy(t, transport.NewLauncher(), "tcp://localhost:0", func(req *Request) (string, error) {
+		if req.Connect.ClientID == "a" {
+			return "tcp://localhost:" + port1, nil
+		}
+
+		return "tcp://localhost:" + port2, nil
+	})
+	defer stop()
+
+	connect := packet.NewConnect()
+	connect.ClientID = "a"
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "test"}}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	publish := packet.NewPublish()
+	publish.Message = packet.Message{Topic: "test", Payload: []byte("test")}
+
+	conn, err := transport.Dial("tcp://" + addr)
+	require.NoError(t, err)
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(subscribe).
+		Receive(suback).
+		Send(publish).
+		Receive(publish).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), engine1.Stats().TotalConnections)
+	assert.Equal(t, int64(0), engine2.Stats().TotalConnections)
+
+	connect.ClientID = "b"
+
+	conn, err = transport.Dial("tcp://" + addr)
+	require.NoError(t, err)
+
+	err = flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), engine1.Stats().TotalConnections)
+	assert.Equal(t, int64(1), engine2.Stats().TotalConnections)
+
+	close(quit1)
+	close(quit2)
+
+	<-done1
+	<-done2
+}
+
+func TestProxyReject(t *testing.T) {
+	errs := make(chan error, 1)
+
+	proxy, addr, stop := runProxy(t, transport.NewLauncher(), "tcp://localhost:0", func(req *Request) (string, error) {
+		return "", nil
+	})
+	defer stop()
+	proxy.OnError = func(err error) {
+		errs <- err
+	}
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.ServerUnavailable
+
+	conn, err := transport.Dial("tcp://" + addr)
+	require.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(connack).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrNoRoute, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "missing error")
+	}
+}
+
+func TestProxyExpectedConnect(t *testing.T) {
+	errs := make(chan error, 1)
+
+	proxy, addr, stop := runProxy(t, transport.NewLauncher(), "tcp://localhost:0", func(req *Request) (string, error) {
+		return "", errors.New("unexpected")
+	})
+	defer stop()
+	proxy.OnError = func(err error) {
+		errs <- err
+	}
+
+	conn, err := transport.Dial("tcp://" + addr)
+	require.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewPingreq()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrExpectedConnect, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "missing error")
+	}
+}
+
+func TestProxyServerName(t *testing.T) {
+	crt, err := tls.LoadX509KeyPair("../example.com+2.pem", "../example.com+2-key.pem")
+	require.NoError(t, err)
+
+	launcher := transport.NewLauncher()
+	launcher.TLSConfig = &tls.Config{Certificates: []tls.Certificate{crt}}
+
+	names := make(chan string, 1)
+
+	_, addr, stop := runProxy(t, launcher, "tls://localhost:0", func(req *Request) (string, error) {
+		names <- req.ServerName
+		return "", ErrNoRoute
+	})
+	defer stop()
+
+	dialer := transport.NewDialer()
+	dialer.TLSConfig = &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}
+
+	conn, err := dialer.Dial("tls://" + addr)
+	require.NoError(t, err)
+
+	connack := packet.NewConnack()
+	connack.ReturnCode = packet.ServerUnavailable
+
+	err = flow.New().
+		Send(packet.NewConnect()).
+		Receive(connack).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "example.com", <-names)
+}
+
+func TestRingRouter(t *testing.T) {
+	ring := cluster.NewRing()
+	router := RingRouter(ring, ByUsername)
+
+	req := &Request{Connect: &packet.Connect{ClientID: "foo", Username: "tenant"}, ServerName: "example.com"}
+
+	url, err := router(req)
+	assert.Equal(t, ErrNoRoute, err)
+	assert.Empty(t, url)
+
+	ring.Add(cluster.Node{Name: "a", Addr: "tcp://a:1883"})
+	ring.Add(cluster.Node{Name: "b", Addr: "tcp://b:1883"})
+
+	owner, _ := ring.Owner("tenant")
+
+	url, err = router(req)
+	assert.NoError(t, err)
+	assert.Equal(t, owner.Addr, url)
+
+	assert.Equal(t, "foo", ByClientID(req))
+	assert.Equal(t, "tenant", ByUsername(req))
+	assert.Equal(t, "example.com", ByServerName(req))
+}
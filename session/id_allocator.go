@@ -0,0 +1,204 @@
+package session
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// IDStrategy defines how an IDAllocator chooses the first id.
+type IDStrategy int
+
+const (
+	// SequentialIDs starts counting ids at 1.
+	SequentialIDs IDStrategy = iota
+
+	// RandomizedIDs starts counting ids at a random id. Ids of different
+	// connections or runs are therefore unlikely to overlap, which makes
+	// interleaved retransmissions easier to tell apart.
+	RandomizedIDs
+)
+
+// An IDAllocator hands out packet ids and keeps track of the ids that are
+// currently in use. Released ids are reused only after the counter has rolled
+// over, which keeps ids of consecutive flows distinct.
+type IDAllocator struct {
+	strategy IDStrategy
+	next     packet.ID
+	seq      uint64
+	used     map[packet.ID]lease
+	mutex    sync.Mutex
+}
+
+type lease struct {
+	seq  uint64
+	time time.Time
+}
+
+// NewIDAllocator returns a new allocator that uses sequential ids.
+func NewIDAllocator() *IDAllocator {
+	return NewIDAllocatorWithStrategy(SequentialIDs)
+}
+
+// NewIDAllocatorWithStrategy returns a new allocator that uses the specified
+// strategy to choose the first id and the first id after a reset.
+func NewIDAllocatorWithStrategy(strategy IDStrategy) *IDAllocator {
+	return &IDAllocator{
+		strategy: strategy,
+		next:     firstID(strategy),
+		used:     make(map[packet.ID]lease),
+	}
+}
+
+// Acquire will return the next free id and mark it as being in use. Ids that
+// are still in use are skipped. If all ids are in use, false is returned and
+// the caller should wait until an id is released.
+func (a *IDAllocator) Acquire() (packet.ID, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// check if all ids are in use
+	if len(a.used) >= math.MaxUint16 {
+		return 0, false
+	}
+
+	// find next free id
+	for {
+		// ignore zeroes
+		if a.next == 0 {
+			a.next++
+		}
+
+		// get candidate
+		id := a.next
+		a.next++
+
+		// return id if free
+		if _, ok := a.used[id]; !ok {
+			a.take(id)
+			return id, true
+		}
+	}
+}
+
+// Claim will mark the specified id as being in use, e.g. when restoring the
+// outgoing packets of a session. The counter continues after the id.
+func (a *IDAllocator) Claim(id packet.ID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// ignore zeroes
+	if id == 0 {
+		return
+	}
+
+	a.take(id)
+	if id >= a.next {
+		a.next = id + 1
+	}
+}
+
+// Release will mark the specified id as free. Releasing an id that is not in
+// use has no effect.
+func (a *IDAllocator) Release(id packet.ID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	delete(a.used, id)
+}
+
+// InUse returns whether the specified id is currently in use.
+func (a *IDAllocator) InUse(id packet.ID) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, ok := a.used[id]
+	return ok
+}
+
+// Len returns the number of ids currently in use.
+func (a *IDAllocator) Len() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.used)
+}
+
+// Leaked returns all ids that have been in use for longer than the specified
+// duration, sorted from the oldest to the youngest. Ids that are never released
+// usually indicate flows that have been lost.
+func (a *IDAllocator) Leaked(age time.Duration) []packet.ID {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// get threshold
+	threshold := time.Now().Add(-age)
+
+	// collect ids
+	var list []packet.ID
+	for id, l := range a.used {
+		if l.time.Before(threshold) {
+			list = append(list, id)
+		}
+	}
+
+	// sort by acquisition
+	sort.Slice(list, func(i, j int) bool {
+		return a.used[list[i]].seq < a.used[list[j]].seq
+	})
+
+	return list
+}
+
+// Reset will release all ids and reset the counter according to the strategy.
+func (a *IDAllocator) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.next = firstID(a.strategy)
+	a.used = make(map[packet.ID]lease)
+}
+
+// state returns the next id and the ids in use in the order of acquisition.
+func (a *IDAllocator) state() (packet.ID, []packet.ID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// collect ids
+	list := make([]packet.ID, 0, len(a.used))
+	for id := range a.used {
+		list = append(list, id)
+	}
+
+	// sort by acquisition
+	sort.Slice(list, func(i, j int) bool {
+		return a.used[list[i]].seq < a.used[list[j]].seq
+	})
+
+	return a.next, list
+}
+
+// setNext will set the next id without checking whether it is in use.
+func (a *IDAllocator) setNext(id packet.ID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.next = id
+}
+
+func (a *IDAllocator) take(id packet.ID) {
+	a.seq++
+	a.used[id] = lease{seq: a.seq, time: time.Now()}
+}
+
+func firstID(strategy IDStrategy) packet.ID {
+	if strategy == RandomizedIDs {
+		return packet.ID(rand.Intn(math.MaxUint16) + 1)
+	}
+
+	return 1
+}
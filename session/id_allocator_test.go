@@ -0,0 +1,132 @@
+package session
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func acquire(allocator *IDAllocator) packet.ID {
+	id, ok := allocator.Acquire()
+	if !ok {
+		panic("no free id")
+	}
+
+	return id
+}
+
+func TestIDAllocator(t *testing.T) {
+	allocator := NewIDAllocator()
+
+	assert.Equal(t, packet.ID(1), acquire(allocator))
+	assert.Equal(t, packet.ID(2), acquire(allocator))
+	assert.True(t, allocator.InUse(1))
+	assert.Equal(t, 2, allocator.Len())
+
+	allocator.Release(1)
+	assert.False(t, allocator.InUse(1))
+	assert.Equal(t, 1, allocator.Len())
+
+	assert.Equal(t, packet.ID(3), acquire(allocator))
+
+	allocator.Reset()
+	assert.Equal(t, 0, allocator.Len())
+	assert.Equal(t, packet.ID(1), acquire(allocator))
+}
+
+func TestIDAllocatorRandomized(t *testing.T) {
+	starts := map[packet.ID]bool{}
+
+	for i := 0; i < 10; i++ {
+		allocator := NewIDAllocatorWithStrategy(RandomizedIDs)
+
+		id := acquire(allocator)
+		assert.NotEqual(t, packet.ID(0), id)
+		starts[id] = true
+
+		// the next id skips zero and ids in use
+		next := id + 1
+		if next == 0 {
+			next = 1
+		}
+		allocator.Claim(next)
+		next++
+		if next == 0 {
+			next = 1
+		}
+		assert.Equal(t, next, acquire(allocator))
+
+		allocator.Reset()
+		starts[acquire(allocator)] = true
+	}
+
+	assert.True(t, len(starts) > 1)
+}
+
+func TestIDAllocatorRollover(t *testing.T) {
+	allocator := NewIDAllocator()
+
+	for i := 0; i < math.MaxUint16; i++ {
+		allocator.Release(acquire(allocator))
+	}
+
+	assert.Equal(t, packet.ID(1), acquire(allocator))
+	assert.Equal(t, packet.ID(2), acquire(allocator))
+}
+
+func TestIDAllocatorSkipInUse(t *testing.T) {
+	allocator := NewIDAllocator()
+
+	assert.Equal(t, packet.ID(1), acquire(allocator))
+	assert.Equal(t, packet.ID(2), acquire(allocator))
+
+	for i := 3; i <= math.MaxUint16; i++ {
+		allocator.Release(acquire(allocator))
+	}
+
+	allocator.Release(1)
+
+	assert.Equal(t, packet.ID(1), acquire(allocator))
+	assert.Equal(t, packet.ID(3), acquire(allocator))
+}
+
+func TestIDAllocatorExhaustion(t *testing.T) {
+	allocator := NewIDAllocator()
+
+	for i := 0; i < math.MaxUint16; i++ {
+		acquire(allocator)
+	}
+
+	assert.Equal(t, math.MaxUint16, allocator.Len())
+
+	id, ok := allocator.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, packet.ID(0), id)
+
+	allocator.Release(7)
+	assert.Equal(t, packet.ID(7), acquire(allocator))
+
+	_, ok = allocator.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, math.MaxUint16, allocator.Len())
+}
+
+func TestIDAllocatorLeaked(t *testing.T) {
+	allocator := NewIDAllocator()
+
+	acquire(allocator)
+	acquire(allocator)
+	acquire(allocator)
+
+	time.Sleep(10 * time.Millisecond)
+
+	acquire(allocator)
+	allocator.Release(2)
+
+	assert.Equal(t, []packet.ID{1, 3}, allocator.Leaked(5*time.Millisecond))
+	assert.Empty(t, allocator.Leaked(time.Minute))
+}
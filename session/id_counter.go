@@ -1,53 +1,55 @@
 package session
 
 import (
-	"sync"
-
 	"github.com/256dpi/gomqtt/packet"
 )
 
 // An IDCounter continuously counts packet ids.
+//
+// Deprecated: Use an IDAllocator, which also tracks the ids in use. The
+// counter wraps an allocator and hands out its next free id without marking
+// it as being in use.
 type IDCounter struct {
-	next  packet.ID
-	mutex sync.Mutex
+	allocator *IDAllocator
 }
 
 // NewIDCounter returns a new counter.
+//
+// Deprecated: Use NewIDAllocator.
 func NewIDCounter() *IDCounter {
 	return NewIDCounterWithNext(1)
 }
 
 // NewIDCounterWithNext returns a new counter that will emit the specified if
 // id as the next id.
+//
+// Deprecated: Use NewIDAllocator.
 func NewIDCounterWithNext(next packet.ID) *IDCounter {
+	// create allocator
+	allocator := NewIDAllocator()
+	allocator.setNext(next)
+
 	return &IDCounter{
-		next: next,
+		allocator: allocator,
 	}
 }
 
-// NextID will return the next id.
+// NextID will return the next id. Zero is returned if all ids of the wrapped
+// allocator are in use.
 func (c *IDCounter) NextID() packet.ID {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	// ignore zeroes
-	if c.next == 0 {
-		c.next++
+	// get free id
+	id, ok := c.allocator.Acquire()
+	if !ok {
+		return 0
 	}
 
-	// cache next id
-	id := c.next
-
-	// increment id
-	c.next++
+	// keep id free
+	c.allocator.Release(id)
 
 	return id
 }
 
 // Reset will reset the counter.
 func (c *IDCounter) Reset() {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	c.next = 1
+	c.allocator.setNext(1)
 }
@@ -3,9 +3,16 @@
 package session
 
 import (
+	"encoding/binary"
+	"errors"
+
 	"github.com/256dpi/gomqtt/packet"
 )
 
+// ErrNoFreeID is returned by clients and brokers if a session does not provide
+// an id for an outgoing packet because all ids are in use.
+var ErrNoFreeID = errors.New("no free packet id")
+
 // Direction denotes a packets direction.
 type Direction int
 
@@ -19,23 +26,40 @@ const (
 
 // A MemorySession stores packets in memory.
 type MemorySession struct {
-	Counter  *IDCounter
-	Incoming *PacketStore
-	Outgoing *PacketStore
+	Allocator *IDAllocator
+	Incoming  *PacketStore
+	Outgoing  *PacketStore
+
+	// Deprecated: Use Allocator. The counter hands out the free ids of the
+	// allocator without marking them as being in use.
+	Counter *IDCounter
 }
 
-// NewMemorySession returns a new MemorySession.
+// NewMemorySession returns a new MemorySession that uses sequential ids.
 func NewMemorySession() *MemorySession {
+	return NewMemorySessionWithStrategy(SequentialIDs)
+}
+
+// NewMemorySessionWithStrategy returns a new MemorySession that allocates ids
+// using the specified strategy.
+func NewMemorySessionWithStrategy(strategy IDStrategy) *MemorySession {
+	// create allocator
+	allocator := NewIDAllocatorWithStrategy(strategy)
+
 	return &MemorySession{
-		Counter:  NewIDCounter(),
-		Incoming: NewPacketStore(),
-		Outgoing: NewPacketStore(),
+		Allocator: allocator,
+		Incoming:  NewPacketStore(),
+		Outgoing:  NewPacketStore(),
+		Counter:   &IDCounter{allocator: allocator},
 	}
 }
 
-// NextID will return the next id for outgoing packets.
+// NextID will return the next id for outgoing packets. The id is considered in
+// use until the outgoing packet with that id is deleted. Zero is returned if
+// all ids are in use.
 func (s *MemorySession) NextID() packet.ID {
-	return s.Counter.NextID()
+	id, _ := s.Allocator.Acquire()
+	return id
 }
 
 // SavePacket will store a packet in the session. An eventual existing
@@ -51,27 +75,170 @@ func (s *MemorySession) LookupPacket(dir Direction, id packet.ID) (packet.Generi
 }
 
 // DeletePacket will remove a packet from the session. The method must not
-// return an error if no packet with the specified id does exists.
+// return an error if no packet with the specified id does exists. Deleting an
+// outgoing packet will also release its id.
 func (s *MemorySession) DeletePacket(dir Direction, id packet.ID) error {
 	s.storeForDirection(dir).Delete(id)
+
+	// release outgoing ids
+	if dir == Outgoing {
+		s.Allocator.Release(id)
+	}
+
 	return nil
 }
 
-// AllPackets will return all packets currently saved in the session.
+// AllPackets will return all packets currently saved in the session in the
+// order they have been saved first.
 func (s *MemorySession) AllPackets(dir Direction) ([]packet.Generic, error) {
 	return s.storeForDirection(dir).All(), nil
 }
 
+// CountPackets will return the number of packets currently saved in the
+// session.
+func (s *MemorySession) CountPackets(dir Direction) (int, error) {
+	return s.storeForDirection(dir).Len(), nil
+}
+
+// IteratePackets will call fn with all packets currently saved in the session
+// in the order of their ids until fn returns false. The session must not be
+// modified by fn.
+func (s *MemorySession) IteratePackets(dir Direction, fn func(packet.Generic) bool) error {
+	s.storeForDirection(dir).Iterate(fn)
+	return nil
+}
+
 // Reset will completely reset the session.
 func (s *MemorySession) Reset() error {
-	// reset counter and stores
-	s.Counter.Reset()
+	// reset allocator and stores
+	s.Allocator.Reset()
 	s.Incoming.Reset()
 	s.Outgoing.Reset()
 
 	return nil
 }
 
+// Serialize will encode the packets and the state of the id allocator. The
+// data can be restored with Deserialize on another session, e.g. to migrate
+// the session to another broker or to inspect it while debugging.
+func (s *MemorySession) Serialize() ([]byte, error) {
+	// get records
+	records, err := s.records()
+	if err != nil {
+		return nil, err
+	}
+
+	return appendRecords(nil, records), nil
+}
+
+// Deserialize will replace the state of the session with the state encoded
+// by Serialize. Queued messages of a serialized WALSession are ignored.
+func (s *MemorySession) Deserialize(data []byte) error {
+	// split records
+	records, err := splitRecords(data)
+	if err != nil {
+		return err
+	}
+
+	// reset session
+	_ = s.Reset()
+
+	// apply records
+	for _, record := range records {
+		// decode record
+		op, _, data, err := decodeRecord(record)
+		if err != nil {
+			return err
+		}
+
+		// skip queued messages
+		if op == walEnqueue {
+			continue
+		}
+
+		// restore record
+		err = s.restore(op, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySession) records() ([][]byte, error) {
+	// encode packets
+	var records [][]byte
+	for _, dir := range []Direction{Incoming, Outgoing} {
+		for _, pkt := range s.storeForDirection(dir).All() {
+			data, err := packet.EncodeTo([]byte{byte(dir)}, pkt)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, encodeRecord(walSave, "", data))
+		}
+	}
+
+	// encode ids in use
+	next, used := s.Allocator.state()
+	for _, id := range used {
+		records = append(records, encodeRecord(walClaim, "", encodeID(id)))
+	}
+
+	// encode next id
+	records = append(records, encodeRecord(walNext, "", encodeID(next)))
+
+	return records, nil
+}
+
+func (s *MemorySession) restore(op byte, data []byte) error {
+	switch op {
+	case walSave:
+		// check data
+		if len(data) < 1 {
+			return ErrInvalidRecord
+		}
+
+		// decode packet
+		pkt, err := decodePacket(data[1:])
+		if err != nil {
+			return err
+		}
+
+		// save packet and claim id of outgoing packets
+		dir := Direction(data[0])
+		_ = s.SavePacket(dir, pkt)
+		if id, ok := packet.GetID(pkt); ok && dir == Outgoing {
+			s.Allocator.Claim(id)
+		}
+	case walClaim:
+		// check data
+		if len(data) != 2 {
+			return ErrInvalidRecord
+		}
+
+		s.Allocator.Claim(packet.ID(binary.BigEndian.Uint16(data)))
+	case walNext:
+		// check data
+		if len(data) != 2 {
+			return ErrInvalidRecord
+		}
+
+		s.Allocator.setNext(packet.ID(binary.BigEndian.Uint16(data)))
+	default:
+		return ErrInvalidRecord
+	}
+
+	return nil
+}
+
+func encodeID(id packet.ID) []byte {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, uint16(id))
+	return buf
+}
+
 func (s *MemorySession) storeForDirection(dir Direction) *PacketStore {
 	if dir == Incoming {
 		return s.Incoming
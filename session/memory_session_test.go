@@ -20,14 +20,28 @@ func TestMemorySessionNextID(t *testing.T) {
 	}
 
 	assert.Equal(t, packet.ID(math.MaxUint16), session.NextID())
+	assert.Equal(t, packet.ID(0), session.NextID())
+
+	err := session.DeletePacket(Outgoing, 1)
+	assert.NoError(t, err)
+
 	assert.Equal(t, packet.ID(1), session.NextID())
 
-	err := session.Reset()
+	err = session.Reset()
 	assert.NoError(t, err)
 
 	assert.Equal(t, packet.ID(1), session.NextID())
 }
 
+func TestMemorySessionCounter(t *testing.T) {
+	session := NewMemorySession()
+
+	assert.Equal(t, packet.ID(1), session.NextID())
+	assert.Equal(t, packet.ID(2), session.Counter.NextID())
+	assert.False(t, session.Allocator.InUse(2))
+	assert.Equal(t, packet.ID(3), session.NextID())
+}
+
 func TestMemorySessionPacketStore(t *testing.T) {
 	session := NewMemorySession()
 
@@ -74,3 +88,88 @@ func TestMemorySessionPacketStore(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(list))
 }
+
+func TestMemorySessionReleaseID(t *testing.T) {
+	session := NewMemorySession()
+
+	publish := packet.NewPublish()
+	publish.ID = session.NextID()
+
+	err := session.SavePacket(Outgoing, publish)
+	assert.NoError(t, err)
+	assert.True(t, session.Allocator.InUse(publish.ID))
+
+	err = session.DeletePacket(Incoming, publish.ID)
+	assert.NoError(t, err)
+	assert.True(t, session.Allocator.InUse(publish.ID))
+
+	err = session.DeletePacket(Outgoing, publish.ID)
+	assert.NoError(t, err)
+	assert.False(t, session.Allocator.InUse(publish.ID))
+}
+
+func TestMemorySessionInspection(t *testing.T) {
+	session := NewMemorySession()
+
+	assert.NoError(t, session.SavePacket(Incoming, &packet.Pubrec{ID: 1}))
+	assert.NoError(t, session.SavePacket(Outgoing, &packet.Puback{ID: 2}))
+	assert.NoError(t, session.SavePacket(Outgoing, &packet.Puback{ID: 1}))
+
+	n, err := session.CountPackets(Incoming)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = session.CountPackets(Outgoing)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	var pkts []packet.Generic
+	err = session.IteratePackets(Outgoing, func(pkt packet.Generic) bool {
+		pkts = append(pkts, pkt)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []packet.Generic{&packet.Puback{ID: 1}, &packet.Puback{ID: 2}}, pkts)
+}
+
+func TestMemorySessionSerialize(t *testing.T) {
+	session := NewMemorySession()
+
+	assert.Equal(t, packet.ID(1), session.NextID())
+	assert.Equal(t, packet.ID(2), session.NextID())
+	assert.Equal(t, packet.ID(3), session.NextID())
+
+	publish := packet.NewPublish()
+	publish.ID = 2
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+	assert.NoError(t, session.SavePacket(Outgoing, publish))
+
+	pubrel := packet.NewPubrel()
+	pubrel.ID = 7
+	assert.NoError(t, session.SavePacket(Incoming, pubrel))
+
+	assert.NoError(t, session.DeletePacket(Outgoing, 3))
+
+	data, err := session.Serialize()
+	assert.NoError(t, err)
+
+	restored := NewMemorySession()
+	restored.NextID()
+	assert.NoError(t, restored.Deserialize(data))
+
+	pkt, err := restored.LookupPacket(Outgoing, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, publish, pkt)
+
+	pkt, err = restored.LookupPacket(Incoming, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, pubrel, pkt)
+
+	assert.True(t, restored.Allocator.InUse(1))
+	assert.True(t, restored.Allocator.InUse(2))
+	assert.False(t, restored.Allocator.InUse(3))
+	assert.Equal(t, packet.ID(4), restored.NextID())
+
+	err = restored.Deserialize(data[:len(data)-1])
+	assert.Equal(t, ErrCorruptRecord, err)
+}
@@ -1,21 +1,29 @@
 package session
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/256dpi/gomqtt/packet"
 )
 
+// storedPacket is a packet with the sequence of its first save.
+type storedPacket struct {
+	pkt packet.Generic
+	seq uint64
+}
+
 // PacketStore is a goroutine safe packet store.
 type PacketStore struct {
-	packets map[packet.ID]packet.Generic
+	packets map[packet.ID]storedPacket
+	seq     uint64
 	mutex   sync.RWMutex
 }
 
 // NewPacketStore returns a new PacketStore.
 func NewPacketStore() *PacketStore {
 	return &PacketStore{
-		packets: make(map[packet.ID]packet.Generic),
+		packets: make(map[packet.ID]storedPacket),
 	}
 }
 
@@ -23,7 +31,7 @@ func NewPacketStore() *PacketStore {
 func NewPacketStoreWithPackets(packets []packet.Generic) *PacketStore {
 	// prepare store
 	store := &PacketStore{
-		packets: make(map[packet.ID]packet.Generic),
+		packets: make(map[packet.ID]storedPacket),
 	}
 
 	// add packets
@@ -35,14 +43,30 @@ func NewPacketStoreWithPackets(packets []packet.Generic) *PacketStore {
 }
 
 // Save will store a packet in the store. An eventual existing packet with the
-// same id gets quietly overwritten.
+// same id gets quietly overwritten and retains its position in the order of
+// saved packets.
 func (s *PacketStore) Save(pkt packet.Generic) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	// get id
 	id, ok := packet.GetID(pkt)
-	if ok {
-		s.packets[id] = pkt
+	if !ok {
+		return
+	}
+
+	// replace existing packet
+	if stored, ok := s.packets[id]; ok {
+		stored.pkt = pkt
+		s.packets[id] = stored
+		return
+	}
+
+	// add packet
+	s.seq++
+	s.packets[id] = storedPacket{
+		pkt: pkt,
+		seq: s.seq,
 	}
 }
 
@@ -51,7 +75,7 @@ func (s *PacketStore) Lookup(id packet.ID) packet.Generic {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	return s.packets[id]
+	return s.packets[id].pkt
 }
 
 // Delete will remove a packet from the store.
@@ -62,24 +86,66 @@ func (s *PacketStore) Delete(id packet.ID) {
 	delete(s.packets, id)
 }
 
-// All will return all packets currently saved in the store.
+// All will return all packets currently saved in the store in the order they
+// have been saved first.
 func (s *PacketStore) All() []packet.Generic {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	var all []packet.Generic
+	// sort packets
+	stored := make([]storedPacket, 0, len(s.packets))
+	for _, sp := range s.packets {
+		stored = append(stored, sp)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].seq < stored[j].seq
+	})
 
-	for _, pkt := range s.packets {
-		all = append(all, pkt)
+	// collect packets
+	var all []packet.Generic
+	for _, sp := range stored {
+		all = append(all, sp.pkt)
 	}
 
 	return all
 }
 
+// Len will return the number of packets currently saved in the store.
+func (s *PacketStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.packets)
+}
+
+// Iterate will call fn with all packets currently saved in the store in the
+// order of their ids until fn returns false. The store must not be modified
+// by fn.
+func (s *PacketStore) Iterate(fn func(packet.Generic) bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// sort ids
+	ids := make([]packet.ID, 0, len(s.packets))
+	for id := range s.packets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	// yield packets
+	for _, id := range ids {
+		if !fn(s.packets[id].pkt) {
+			return
+		}
+	}
+}
+
 // Reset will reset the store.
 func (s *PacketStore) Reset() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.packets = make(map[packet.ID]packet.Generic)
+	s.packets = make(map[packet.ID]storedPacket)
 }
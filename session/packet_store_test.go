@@ -36,3 +36,47 @@ func TestPacketStore(t *testing.T) {
 	store = NewPacketStoreWithPackets([]packet.Generic{&packet.Subscribe{ID: 7}})
 	assert.Equal(t, []packet.Generic{&packet.Subscribe{ID: 7}}, store.All())
 }
+
+func TestPacketStoreIterate(t *testing.T) {
+	store := NewPacketStoreWithPackets([]packet.Generic{
+		&packet.Puback{ID: 3},
+		&packet.Puback{ID: 1},
+		&packet.Puback{ID: 2},
+	})
+	assert.Equal(t, 3, store.Len())
+
+	var ids []packet.ID
+	store.Iterate(func(pkt packet.Generic) bool {
+		id, _ := packet.GetID(pkt)
+		ids = append(ids, id)
+		return true
+	})
+	assert.Equal(t, []packet.ID{1, 2, 3}, ids)
+
+	ids = nil
+	store.Iterate(func(pkt packet.Generic) bool {
+		id, _ := packet.GetID(pkt)
+		ids = append(ids, id)
+		return len(ids) < 2
+	})
+	assert.Equal(t, []packet.ID{1, 2}, ids)
+
+	store.Reset()
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestPacketStoreAllOrder(t *testing.T) {
+	store := NewPacketStore()
+	store.Save(&packet.Publish{ID: 65535})
+	store.Save(&packet.Publish{ID: 1})
+	store.Save(&packet.Publish{ID: 7})
+	store.Save(&packet.Pubrel{ID: 65535})
+	store.Delete(1)
+	store.Save(&packet.Publish{ID: 1})
+
+	assert.Equal(t, []packet.Generic{
+		&packet.Pubrel{ID: 65535},
+		&packet.Publish{ID: 7},
+		&packet.Publish{ID: 1},
+	}, store.All())
+}
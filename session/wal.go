@@ -0,0 +1,436 @@
+package session
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrWALClosed is returned when appending records to a closed WAL.
+var ErrWALClosed = errors.New("wal closed")
+
+// ErrCorruptRecord is returned by OpenWAL if a record in the middle of the log
+// is corrupt.
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// walHeaderLen is the length of the record header that holds the length and
+// checksum of the record.
+const walHeaderLen = 8
+
+type walRequest struct {
+	records  [][]byte
+	snapshot func() ([][]byte, error)
+	done     chan error
+}
+
+// A WAL is a write-ahead log that persists records in a file. Records that
+// are appended concurrently are written and synced together in group commits,
+// so that the throughput is not limited to one sync per record.
+type WAL struct {
+	// The maximum number of records written in one commit.
+	//
+	// Will default to 1000.
+	MaxBatch int
+
+	// The duration a commit is delayed to collect more records. By default,
+	// records that are appended while a commit is in progress are collected
+	// for the next commit.
+	MaxDelay time.Duration
+
+	path    string
+	file    *os.File
+	queue   []*walRequest
+	wake    chan struct{}
+	closed  bool
+	mutex   sync.Mutex
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// OpenWAL opens or creates the log at the specified path and calls the replay
+// function with every stored record. An incomplete record at the end of the
+// log, that has been left by an interrupted write, is discarded.
+func OpenWAL(path string, replay func([]byte) error) (*WAL, error) {
+	// open file
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// replay records
+	offset, err := replayWAL(file, replay)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// discard incomplete record
+	err = file.Truncate(offset)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &WAL{
+		MaxBatch: 1000,
+		path:     path,
+		file:     file,
+		wake:     make(chan struct{}, 1),
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+func replayWAL(file *os.File, replay func([]byte) error) (int64, error) {
+	// get size
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// prepare reader
+	reader := bufio.NewReader(file)
+
+	// read records
+	var offset int64
+	header := make([]byte, walHeaderLen)
+	for {
+		// read header
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		// check length
+		length := int64(binary.BigEndian.Uint32(header))
+		if offset+walHeaderLen+length > info.Size() {
+			return offset, nil
+		}
+
+		// read record
+		record := make([]byte, length)
+		_, err = io.ReadFull(reader, record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		// verify checksum, a mismatch is only tolerated for the last record
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+			_, err = reader.Peek(1)
+			if err == io.EOF {
+				return offset, nil
+			}
+
+			return 0, ErrCorruptRecord
+		}
+
+		// replay record
+		if replay != nil {
+			err = replay(record)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		offset += int64(walHeaderLen + len(record))
+	}
+}
+
+// Append will append the records to the log. It returns once the records have
+// been synced to disk.
+func (w *WAL) Append(records ...[]byte) error {
+	return <-w.Submit(records...)
+}
+
+// Submit will queue the records to be appended to the log and return a channel
+// that receives the result once the records have been synced to disk. Records
+// are written in the order they have been submitted, which allows callers to
+// submit records while holding a lock and wait for the commit after releasing
+// it.
+func (w *WAL) Submit(records ...[]byte) <-chan error {
+	return w.submit(&walRequest{
+		records: records,
+		done:    make(chan error, 1),
+	})
+}
+
+// Compact will replace the log with the records returned by the snapshot
+// function. Records that have been submitted before are written to the old
+// log before the snapshot is taken. The snapshot must therefore include the
+// effects of all records submitted before Compact is called. Records that are
+// submitted afterwards are written to the new log.
+func (w *WAL) Compact(snapshot func() ([][]byte, error)) error {
+	return <-w.submit(&walRequest{
+		snapshot: snapshot,
+		done:     make(chan error, 1),
+	})
+}
+
+// Close will write all queued records and close the log.
+func (w *WAL) Close() error {
+	// make sure committer is started
+	w.once.Do(w.start)
+
+	// set flag
+	w.mutex.Lock()
+	w.closed = true
+	w.mutex.Unlock()
+
+	// wake committer and wait for it to stop
+	w.signal()
+	<-w.stopped
+
+	return w.file.Close()
+}
+
+func (w *WAL) submit(req *walRequest) <-chan error {
+	// make sure committer is started
+	w.once.Do(w.start)
+
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// check if closed
+	if w.closed {
+		req.done <- ErrWALClosed
+		return req.done
+	}
+
+	// queue request
+	w.queue = append(w.queue, req)
+	w.signal()
+
+	return req.done
+}
+
+func (w *WAL) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *WAL) start() {
+	// set default batch
+	if w.MaxBatch <= 0 {
+		w.MaxBatch = 1000
+	}
+
+	// run committer
+	go w.committer()
+}
+
+func (w *WAL) committer() {
+	defer close(w.stopped)
+
+	for {
+		// wait for requests
+		<-w.wake
+
+		// collect more records
+		if w.MaxDelay > 0 {
+			time.Sleep(w.MaxDelay)
+		}
+
+		// process all queued requests
+		for {
+			// get next batch
+			batch, compaction, closed := w.next()
+			if batch == nil && compaction == nil {
+				if closed {
+					return
+				}
+
+				break
+			}
+
+			// write batch
+			if batch != nil {
+				err := w.write(batch)
+				for _, req := range batch {
+					req.done <- err
+				}
+			}
+
+			// perform compaction
+			if compaction != nil {
+				compaction.done <- w.compact(compaction.snapshot)
+			}
+		}
+	}
+}
+
+func (w *WAL) next() ([]*walRequest, *walRequest, bool) {
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// take requests up to the batch size or the next compaction
+	var batch []*walRequest
+	records := 0
+	for len(w.queue) > 0 && records < w.MaxBatch {
+		req := w.queue[0]
+
+		// return compaction once all previous records have been written
+		if req.snapshot != nil {
+			if batch != nil {
+				break
+			}
+
+			w.queue = w.queue[1:]
+			return nil, req, w.closed
+		}
+
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		batch = append(batch, req)
+		records += len(req.records)
+	}
+
+	return batch, nil, w.closed
+}
+
+func (w *WAL) write(batch []*walRequest) error {
+	// encode records
+	var buf []byte
+	for _, req := range batch {
+		buf = appendRecords(buf, req.records)
+	}
+
+	// write records
+	_, err := w.file.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+func (w *WAL) compact(snapshot func() ([][]byte, error)) error {
+	// get records
+	records, err := snapshot()
+	if err != nil {
+		return err
+	}
+
+	// write temporary file
+	tmp := w.path + ".tmp"
+	err = writeFile(tmp, appendRecords(nil, records))
+	if err != nil {
+		return err
+	}
+
+	// replace log
+	err = os.Rename(tmp, w.path)
+	if err != nil {
+		return err
+	}
+
+	// sync directory to persist the rename
+	err = syncDir(filepath.Dir(w.path))
+	if err != nil {
+		return err
+	}
+
+	// open new log
+	file, err := os.OpenFile(w.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// replace file
+	_ = w.file.Close()
+	w.file = file
+
+	return nil
+}
+
+func appendRecords(buf []byte, records [][]byte) []byte {
+	for _, record := range records {
+		var header [walHeaderLen]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(record)))
+		binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(record))
+		buf = append(buf, header[:]...)
+		buf = append(buf, record...)
+	}
+
+	return buf
+}
+
+func splitRecords(data []byte) ([][]byte, error) {
+	var records [][]byte
+	for len(data) > 0 {
+		// check header
+		if len(data) < walHeaderLen {
+			return nil, ErrCorruptRecord
+		}
+
+		// check length
+		length := int(binary.BigEndian.Uint32(data))
+		if len(data) < walHeaderLen+length {
+			return nil, ErrCorruptRecord
+		}
+
+		// verify checksum
+		record := data[walHeaderLen : walHeaderLen+length]
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(data[4:]) {
+			return nil, ErrCorruptRecord
+		}
+
+		records = append(records, record)
+		data = data[walHeaderLen+length:]
+	}
+
+	return records, nil
+}
+
+func writeFile(path string, data []byte) error {
+	// create file
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// write and sync data
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	// close file
+	err2 := file.Close()
+	if err != nil {
+		return err
+	}
+
+	return err2
+}
+
+func syncDir(path string) error {
+	// open directory
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	// sync directory
+	err = dir.Sync()
+
+	// close directory
+	err2 := dir.Close()
+	if err != nil {
+		return err
+	}
+
+	return err2
+}
@@ -0,0 +1,597 @@
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInvalidRecord is returned by OpenWALStore if a record cannot be decoded.
+var ErrInvalidRecord = errors.New("invalid record")
+
+const (
+	walCreate byte = iota + 1
+	walSave
+	walDelete
+	walReset
+	walRemove
+	walEnqueue
+	walAck
+	walClaim
+	walNext
+)
+
+// A QueuedMessage is a message in the queue of a WALSession.
+type QueuedMessage struct {
+	// The sequence of the message in the queue.
+	Seq uint64
+
+	// The queued message.
+	Message *packet.Message
+}
+
+// A WALStore manages sessions whose mutations are persisted in a shared WAL.
+// Mutations of concurrently used sessions are synced in group commits. The
+// state is kept in memory and restored from the log when the store is opened.
+type WALStore struct {
+	// The underlying log that may be configured before the store is used.
+	WAL *WAL
+
+	sessions map[string]*WALSession
+	mutex    sync.Mutex
+}
+
+// OpenWALStore opens or creates the store at the specified path and restores
+// all persisted sessions.
+func OpenWALStore(path string) (*WALStore, error) {
+	// prepare store
+	store := &WALStore{
+		sessions: make(map[string]*WALSession),
+	}
+
+	// open log
+	wal, err := OpenWAL(path, store.replay)
+	if err != nil {
+		return nil, err
+	}
+
+	// set log
+	store.WAL = wal
+
+	return store, nil
+}
+
+// Session returns the session with the specified id. A new session is created
+// if none exists.
+func (s *WALStore) Session(id string) (*WALSession, error) {
+	// acquire mutex
+	s.mutex.Lock()
+
+	// get existing session
+	sess, ok := s.sessions[id]
+	if ok {
+		s.mutex.Unlock()
+		return sess, nil
+	}
+
+	// create session
+	sess = newWALSession(s, id)
+	s.sessions[id] = sess
+
+	// submit record
+	done := s.WAL.Submit(encodeRecord(walCreate, id, nil))
+
+	// release mutex
+	s.mutex.Unlock()
+
+	// await commit
+	err := <-done
+	if err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Lookup returns the session with the specified id or nil if none exists.
+func (s *WALStore) Lookup(id string) *WALSession {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sessions[id]
+}
+
+// IDs returns the ids of all stored sessions.
+func (s *WALStore) IDs() []string {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// collect ids
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+
+	// sort ids
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Delete will remove the session with the specified id.
+func (s *WALStore) Delete(id string) error {
+	// acquire mutex
+	s.mutex.Lock()
+
+	// remove session
+	delete(s.sessions, id)
+
+	// submit record
+	done := s.WAL.Submit(encodeRecord(walRemove, id, nil))
+
+	// release mutex
+	s.mutex.Unlock()
+
+	return <-done
+}
+
+// Compact will replace the log with a snapshot of all sessions.
+func (s *WALStore) Compact() error {
+	return s.WAL.Compact(s.snapshot)
+}
+
+// Close will close the log.
+func (s *WALStore) Close() error {
+	return s.WAL.Close()
+}
+
+func (s *WALStore) snapshot() ([][]byte, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// encode sessions
+	var records [][]byte
+	for id, sess := range s.sessions {
+		list, err := sess.snapshot()
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, encodeRecord(walCreate, id, nil))
+		records = append(records, list...)
+	}
+
+	return records, nil
+}
+
+func (s *WALStore) replay(record []byte) error {
+	// decode record
+	op, id, data, err := decodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	// handle removal
+	if op == walRemove {
+		delete(s.sessions, id)
+		return nil
+	}
+
+	// get or create session
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = newWALSession(s, id)
+		s.sessions[id] = sess
+	}
+
+	return sess.apply(op, data)
+}
+
+// A WALSession is a session whose mutations are persisted in the WAL of a
+// WALStore before the calls return. Besides the packets, the session manages
+// a queue of messages.
+type WALSession struct {
+	*MemorySession
+
+	id    string
+	store *WALStore
+	queue []QueuedMessage
+	seq   uint64
+	mutex sync.Mutex
+}
+
+func newWALSession(store *WALStore, id string) *WALSession {
+	return &WALSession{
+		MemorySession: NewMemorySession(),
+		id:            id,
+		store:         store,
+	}
+}
+
+// ID returns the id of the session.
+func (s *WALSession) ID() string {
+	return s.id
+}
+
+// SavePacket will store a packet in the session. An eventual existing
+// packet with the same id gets quietly overwritten.
+func (s *WALSession) SavePacket(dir Direction, pkt packet.Generic) error {
+	// encode packet
+	data, err := packet.EncodeTo([]byte{byte(dir)}, pkt)
+	if err != nil {
+		return err
+	}
+
+	return s.mutate(walSave, data, func() {
+		_ = s.MemorySession.SavePacket(dir, pkt)
+	})
+}
+
+// DeletePacket will remove a packet from the session. The method must not
+// return an error if no packet with the specified id does exists. Deleting an
+// outgoing packet will also release its id.
+func (s *WALSession) DeletePacket(dir Direction, id packet.ID) error {
+	// encode id
+	data := []byte{byte(dir), 0, 0}
+	binary.BigEndian.PutUint16(data[1:], uint16(id))
+
+	return s.mutate(walDelete, data, func() {
+		_ = s.MemorySession.DeletePacket(dir, id)
+	})
+}
+
+// Reset will completely reset the session.
+func (s *WALSession) Reset() error {
+	return s.mutate(walReset, nil, func() {
+		_ = s.MemorySession.Reset()
+		s.queue = nil
+	})
+}
+
+// Enqueue will add the message to the queue and return its sequence.
+func (s *WALSession) Enqueue(msg *packet.Message) (uint64, error) {
+	// encode message
+	data, err := encodeMessage(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+
+	// add message
+	s.seq++
+	seq := s.seq
+	s.queue = append(s.queue, QueuedMessage{
+		Seq:     seq,
+		Message: msg,
+	})
+
+	// submit record
+	done := s.store.WAL.Submit(encodeRecord(walEnqueue, s.id, encodeSeq(seq, data)))
+
+	// release mutex
+	s.mutex.Unlock()
+
+	// await commit
+	err = <-done
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// Queued returns all queued messages in order.
+func (s *WALSession) Queued() []QueuedMessage {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]QueuedMessage(nil), s.queue...)
+}
+
+// Ack will remove the message with the specified sequence from the queue.
+func (s *WALSession) Ack(seq uint64) error {
+	return s.mutate(walAck, encodeSeq(seq, nil), func() {
+		s.remove(seq)
+	})
+}
+
+// Serialize will encode the packets, the state of the id allocator and the
+// queued messages of the session. The data can be restored with Deserialize
+// on another session, e.g. to migrate the session to another broker.
+func (s *WALSession) Serialize() ([]byte, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// get records
+	records, err := s.MemorySession.records()
+	if err != nil {
+		return nil, err
+	}
+
+	// encode queue
+	for _, qm := range s.queue {
+		data, err := encodeMessage(qm.Message)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, encodeRecord(walEnqueue, "", encodeSeq(qm.Seq, data)))
+	}
+
+	return appendRecords(nil, records), nil
+}
+
+// Deserialize will replace the state of the session with the state encoded
+// by Serialize. The restored state is persisted before the call returns.
+func (s *WALSession) Deserialize(data []byte) error {
+	// split records
+	records, err := splitRecords(data)
+	if err != nil {
+		return err
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+
+	// reset session
+	_ = s.MemorySession.Reset()
+	s.queue = nil
+	s.seq = 0
+
+	// apply records
+	log := [][]byte{encodeRecord(walReset, s.id, nil)}
+	for _, record := range records {
+		// decode record
+		op, _, data, err := decodeRecord(record)
+		if err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+
+		// check op
+		switch op {
+		case walSave, walClaim, walNext, walEnqueue:
+		default:
+			s.mutex.Unlock()
+			return ErrInvalidRecord
+		}
+
+		// apply record
+		err = s.apply(op, data)
+		if err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+
+		log = append(log, encodeRecord(op, s.id, data))
+	}
+
+	// submit records
+	done := s.store.WAL.Submit(log...)
+
+	// release mutex
+	s.mutex.Unlock()
+
+	return <-done
+}
+
+func (s *WALSession) mutate(op byte, data []byte, fn func()) error {
+	// acquire mutex
+	s.mutex.Lock()
+
+	// apply mutation before submitting the record, so that a concurrent
+	// compaction does not miss it
+	fn()
+
+	// submit record
+	done := s.store.WAL.Submit(encodeRecord(op, s.id, data))
+
+	// release mutex
+	s.mutex.Unlock()
+
+	return <-done
+}
+
+func (s *WALSession) remove(seq uint64) {
+	// find message
+	i := sort.Search(len(s.queue), func(i int) bool {
+		return s.queue[i].Seq >= seq
+	})
+
+	// remove message
+	if i < len(s.queue) && s.queue[i].Seq == seq {
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	}
+}
+
+func (s *WALSession) apply(op byte, data []byte) error {
+	switch op {
+	case walCreate:
+		return nil
+	case walSave, walClaim, walNext:
+		return s.MemorySession.restore(op, data)
+	case walDelete:
+		// check data
+		if len(data) != 3 {
+			return ErrInvalidRecord
+		}
+
+		// delete packet
+		id := packet.ID(binary.BigEndian.Uint16(data[1:]))
+		_ = s.MemorySession.DeletePacket(Direction(data[0]), id)
+	case walReset:
+		_ = s.MemorySession.Reset()
+		s.queue = nil
+	case walEnqueue:
+		// decode sequence
+		seq, data, err := decodeSeq(data)
+		if err != nil {
+			return err
+		}
+
+		// decode message
+		msg, err := decodeMessage(data)
+		if err != nil {
+			return err
+		}
+
+		// add or replace message, a message may be written twice if it has
+		// been enqueued during a compaction
+		s.remove(seq)
+		s.queue = append(s.queue, QueuedMessage{
+			Seq:     seq,
+			Message: msg,
+		})
+		sort.Slice(s.queue, func(i, j int) bool {
+			return s.queue[i].Seq < s.queue[j].Seq
+		})
+
+		// update sequence
+		if seq > s.seq {
+			s.seq = seq
+		}
+	case walAck:
+		// decode sequence
+		seq, _, err := decodeSeq(data)
+		if err != nil {
+			return err
+		}
+
+		s.remove(seq)
+	default:
+		return ErrInvalidRecord
+	}
+
+	return nil
+}
+
+func (s *WALSession) snapshot() ([][]byte, error) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// encode packets
+	var records [][]byte
+	for _, dir := range []Direction{Incoming, Outgoing} {
+		for _, pkt := range s.storeForDirection(dir).All() {
+			data, err := packet.EncodeTo([]byte{byte(dir)}, pkt)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, encodeRecord(walSave, s.id, data))
+		}
+	}
+
+	// encode queue
+	for _, qm := range s.queue {
+		data, err := encodeMessage(qm.Message)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, encodeRecord(walEnqueue, s.id, encodeSeq(qm.Seq, data)))
+	}
+
+	return records, nil
+}
+
+func encodeRecord(op byte, id string, data []byte) []byte {
+	// prepare buffer
+	buf := make([]byte, 3, 3+len(id)+len(data))
+
+	// write op and id
+	buf[0] = op
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(id)))
+	buf = append(buf, id...)
+
+	return append(buf, data...)
+}
+
+func decodeRecord(record []byte) (byte, string, []byte, error) {
+	// check header
+	if len(record) < 3 {
+		return 0, "", nil, ErrInvalidRecord
+	}
+
+	// check id
+	n := int(binary.BigEndian.Uint16(record[1:]))
+	if len(record) < 3+n {
+		return 0, "", nil, ErrInvalidRecord
+	}
+
+	return record[0], string(record[3 : 3+n]), record[3+n:], nil
+}
+
+func encodeSeq(seq uint64, data []byte) []byte {
+	buf := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(buf, seq)
+	return append(buf, data...)
+}
+
+func decodeSeq(data []byte) (uint64, []byte, error) {
+	if len(data) < 8 {
+		return 0, nil, ErrInvalidRecord
+	}
+
+	return binary.BigEndian.Uint64(data), data[8:], nil
+}
+
+func encodeMessage(msg *packet.Message) ([]byte, error) {
+	// prepare publish
+	publish := packet.NewPublish()
+	publish.Message = *msg
+	if msg.QOS > 0 {
+		publish.ID = 1
+	}
+
+	return publish.EncodeTo(nil)
+}
+
+func decodeMessage(data []byte) (*packet.Message, error) {
+	// decode packet
+	pkt, err := decodePacket(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// check type
+	publish, ok := pkt.(*packet.Publish)
+	if !ok {
+		return nil, ErrInvalidRecord
+	}
+
+	return &publish.Message, nil
+}
+
+func decodePacket(data []byte) (packet.Generic, error) {
+	// detect packet
+	_, typ, err := packet.Detect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// create packet
+	pkt, err := typ.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// decode packet
+	_, err = pkt.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALStore(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	store, err := OpenWALStore(path)
+	require.NoError(t, err)
+
+	sess, err := store.Session("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", sess.ID())
+
+	id := sess.NextID()
+	publish := packet.NewPublish()
+	publish.ID = id
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+	assert.NoError(t, sess.SavePacket(Outgoing, publish))
+
+	pubrec := packet.NewPubrec()
+	pubrec.ID = 5
+	assert.NoError(t, sess.SavePacket(Incoming, pubrec))
+	assert.NoError(t, sess.DeletePacket(Incoming, 5))
+
+	seq1, err := sess.Enqueue(&packet.Message{Topic: "a", Payload: []byte("1"), QOS: 1})
+	assert.NoError(t, err)
+	seq2, err := sess.Enqueue(&packet.Message{Topic: "b", Payload: []byte("2")})
+	assert.NoError(t, err)
+	assert.NoError(t, sess.Ack(seq1))
+
+	_, err = store.Session("bar")
+	require.NoError(t, err)
+	assert.NoError(t, store.Delete("bar"))
+
+	assert.NoError(t, store.Close())
+
+	for i := 0; i < 2; i++ {
+		store, err = OpenWALStore(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, store.IDs())
+		assert.Nil(t, store.Lookup("bar"))
+
+		sess = store.Lookup("foo")
+		require.NotNil(t, sess)
+
+		pkt, err := sess.LookupPacket(Outgoing, id)
+		assert.NoError(t, err)
+		assert.Equal(t, publish, pkt)
+
+		pkt, err = sess.LookupPacket(Incoming, 5)
+		assert.NoError(t, err)
+		assert.Nil(t, pkt)
+
+		assert.Equal(t, []QueuedMessage{
+			{Seq: seq2, Message: &packet.Message{Topic: "b", Payload: []byte("2")}},
+		}, sess.Queued())
+
+		assert.True(t, sess.Allocator.InUse(id))
+		assert.NotEqual(t, id, sess.NextID())
+
+		seq3, err := sess.Enqueue(&packet.Message{Topic: "c", Payload: []byte("3")})
+		assert.NoError(t, err)
+		assert.True(t, seq3 > seq2)
+		assert.NoError(t, sess.Ack(seq3))
+
+		assert.NoError(t, store.Compact())
+		assert.NoError(t, store.Close())
+	}
+
+	store, err = OpenWALStore(path)
+	require.NoError(t, err)
+
+	sess = store.Lookup("foo")
+	require.NotNil(t, sess)
+	assert.NoError(t, sess.Reset())
+	assert.NoError(t, store.Close())
+
+	store, err = OpenWALStore(path)
+	require.NoError(t, err)
+
+	sess = store.Lookup("foo")
+	require.NotNil(t, sess)
+	assert.Empty(t, sess.Queued())
+
+	pkts, err := sess.AllPackets(Outgoing)
+	assert.NoError(t, err)
+	assert.Empty(t, pkts)
+	assert.NoError(t, store.Close())
+}
+
+func TestWALSessionSerialize(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	store, err := OpenWALStore(path)
+	require.NoError(t, err)
+
+	sess, err := store.Session("foo")
+	require.NoError(t, err)
+
+	id := sess.NextID()
+	publish := packet.NewPublish()
+	publish.ID = id
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+	assert.NoError(t, sess.SavePacket(Outgoing, publish))
+
+	_, err = sess.Enqueue(&packet.Message{Topic: "a", Payload: []byte("1")})
+	assert.NoError(t, err)
+	seq, err := sess.Enqueue(&packet.Message{Topic: "b", Payload: []byte("2"), QOS: 1})
+	assert.NoError(t, err)
+
+	data, err := sess.Serialize()
+	assert.NoError(t, err)
+
+	bar, err := store.Session("bar")
+	require.NoError(t, err)
+	assert.NoError(t, bar.Deserialize(data))
+	assert.NoError(t, store.Close())
+
+	store, err = OpenWALStore(path)
+	require.NoError(t, err)
+
+	bar = store.Lookup("bar")
+	require.NotNil(t, bar)
+
+	pkt, err := bar.LookupPacket(Outgoing, id)
+	assert.NoError(t, err)
+	assert.Equal(t, publish, pkt)
+	assert.Equal(t, store.Lookup("foo").Queued(), bar.Queued())
+
+	next, err := bar.Enqueue(&packet.Message{Topic: "c", Payload: []byte("3")})
+	assert.NoError(t, err)
+	assert.True(t, next > seq)
+	assert.NoError(t, store.Close())
+
+	memory := NewMemorySession()
+	assert.NoError(t, memory.Deserialize(data))
+
+	pkt, err = memory.LookupPacket(Outgoing, id)
+	assert.NoError(t, err)
+	assert.Equal(t, publish, pkt)
+}
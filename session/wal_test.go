@@ -0,0 +1,159 @@
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "wal"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func collect(list *[]string) func([]byte) error {
+	return func(record []byte) error {
+		*list = append(*list, string(record))
+		return nil
+	}
+}
+
+func TestWAL(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	wal, err := OpenWAL(path, collect(nil))
+	require.NoError(t, err)
+
+	wal.MaxDelay = time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, wal.Append([]byte(fmt.Sprintf("r%d", i))))
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.NoError(t, wal.Append([]byte("a"), []byte("b")))
+	assert.NoError(t, wal.Close())
+	assert.Equal(t, ErrWALClosed, wal.Append([]byte("c")))
+
+	var records []string
+	wal, err = OpenWAL(path, collect(&records))
+	require.NoError(t, err)
+	assert.Len(t, records, 102)
+	assert.Equal(t, []string{"a", "b"}, records[100:])
+	assert.NoError(t, wal.Close())
+}
+
+func TestWALTornWrite(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	wal, err := OpenWAL(path, collect(nil))
+	require.NoError(t, err)
+	assert.NoError(t, wal.Append([]byte("foo"), []byte("bar")))
+	assert.NoError(t, wal.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-1))
+
+	var records []string
+	wal, err = OpenWAL(path, collect(&records))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, records)
+	assert.NoError(t, wal.Append([]byte("baz")))
+	assert.NoError(t, wal.Close())
+
+	records = nil
+	wal, err = OpenWAL(path, collect(&records))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo", "baz"}, records)
+	assert.NoError(t, wal.Close())
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	wal, err := OpenWAL(path, collect(nil))
+	require.NoError(t, err)
+	assert.NoError(t, wal.Append([]byte("foo"), []byte("bar")))
+	assert.NoError(t, wal.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	data[walHeaderLen] = 'x'
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+	_, err = OpenWAL(path, collect(nil))
+	assert.Equal(t, ErrCorruptRecord, err)
+}
+
+func TestWALCompact(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	wal, err := OpenWAL(path, collect(nil))
+	require.NoError(t, err)
+	assert.NoError(t, wal.Append([]byte("foo"), []byte("bar")))
+
+	err = wal.Compact(func() ([][]byte, error) {
+		return [][]byte{[]byte("baz")}, nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, wal.Append([]byte("qux")))
+	assert.NoError(t, wal.Close())
+
+	var records []string
+	wal, err = OpenWAL(path, collect(&records))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"baz", "qux"}, records)
+	assert.NoError(t, wal.Close())
+}
+
+func BenchmarkWAL(b *testing.B) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(filepath.Join(dir, "wal"), nil)
+	if err != nil {
+		panic(err)
+	}
+	defer wal.Close()
+
+	record := make([]byte, 256)
+
+	b.ReportAllocs()
+	b.SetParallelism(64)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			err := wal.Append(record)
+			if err != nil {
+				panic(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package sparkplug
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInvalidMessage is returned by Validate if a message does not conform to
+// the Sparkplug B specification.
+var ErrInvalidMessage = errors.New("invalid sparkplug message")
+
+// ErrUnexpectedSequence is returned by the Backend if a message of an edge
+// node does not have the expected sequence number.
+var ErrUnexpectedSequence = errors.New("unexpected sequence number")
+
+// Validate will check if a message that is published in the Sparkplug B
+// namespace is valid. Messages outside the namespace are ignored.
+func Validate(msg *packet.Message) error {
+	// ignore other topics
+	if !strings.HasPrefix(msg.Topic, Namespace+"/") && !strings.HasPrefix(msg.Topic, string(STATE)+"/") {
+		return nil
+	}
+
+	// parse topic
+	topic, err := ParseTopic(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	// state messages are json and must be retained
+	if topic.Type == STATE {
+		if !msg.Retain {
+			return ErrInvalidMessage
+		}
+
+		return nil
+	}
+
+	// other messages must not be retained
+	if msg.Retain {
+		return ErrInvalidMessage
+	}
+
+	// decode payload
+	payload, err := DecodePayload(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	// check birth and death certificates
+	switch topic.Type {
+	case NBIRTH, NDEATH:
+		if m := payload.Metric(BirthDeathSequence); m == nil || m.Type != UInt64 {
+			return ErrInvalidMessage
+		}
+	}
+
+	// check sequence number
+	if payload.Seq > 255 {
+		return ErrInvalidMessage
+	}
+
+	return nil
+}
+
+// A Backend wraps another backend and validates all messages published in the
+// Sparkplug B namespace. It also tracks the sequence numbers of all edge
+// nodes and rejects messages that are out of order.
+type Backend struct {
+	broker.Backend
+
+	// The callback that is called with invalid messages. If it returns nil,
+	// the message is dropped, otherwise the client is closed with the
+	// returned error.
+	//
+	// Will default to closing the client with the validation error.
+	InvalidCallback func(*broker.Client, *packet.Message, error) error
+
+	sequences map[string]uint64
+	mutex     sync.Mutex
+}
+
+// NewBackend returns a new Backend that wraps the specified backend.
+func NewBackend(backend broker.Backend) *Backend {
+	return &Backend{
+		Backend:   backend,
+		sequences: make(map[string]uint64),
+	}
+}
+
+// Publish will validate the message and forward it to the wrapped backend.
+func (b *Backend) Publish(client *broker.Client, msg *packet.Message, ack broker.Ack) error {
+	// validate message
+	err := Validate(msg)
+	if err == nil {
+		err = b.sequence(msg)
+	}
+
+	// handle invalid messages
+	if err != nil {
+		if b.InvalidCallback != nil {
+			err = b.InvalidCallback(client, msg, err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// acknowledge dropped message
+		if ack != nil {
+			ack()
+		}
+
+		return nil
+	}
+
+	return b.Backend.Publish(client, msg, ack)
+}
+
+func (b *Backend) sequence(msg *packet.Message) error {
+	// parse topic
+	topic, err := ParseTopic(msg.Topic)
+	if err != nil || topic.Type == STATE || topic.Type == NCMD || topic.Type == DCMD {
+		return nil
+	}
+
+	// decode payload
+	payload, err := DecodePayload(msg.Payload)
+	if err != nil {
+		return nil
+	}
+
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// get key
+	key := topic.Group + "/" + topic.Node
+
+	switch topic.Type {
+	case NBIRTH:
+		// start sequence
+		b.sequences[key] = payload.Seq
+	case NDEATH:
+		// end sequence
+		delete(b.sequences, key)
+	default:
+		// check sequence
+		last, ok := b.sequences[key]
+		if !ok || payload.Seq != (last+1)%256 {
+			return ErrUnexpectedSequence
+		}
+
+		b.sequences[key] = payload.Seq
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package sparkplug
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/testutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(&packet.Message{Topic: "foo/bar"}))
+
+	assert.Equal(t, ErrInvalidTopic, Validate(&packet.Message{Topic: "spBv1.0/g/FOO/n"}))
+
+	assert.Equal(t, ErrInvalidMessage, Validate(&packet.Message{Topic: "spBv1.0/STATE/h"}))
+
+	data, _ := (&Payload{}).Encode()
+	assert.Equal(t, ErrInvalidMessage, Validate(&packet.Message{Topic: "spBv1.0/g/NDATA/n", Payload: data, Retain: true}))
+	assert.Equal(t, ErrInvalidMessage, Validate(&packet.Message{Topic: "spBv1.0/g/NBIRTH/n", Payload: data}))
+	assert.NoError(t, Validate(&packet.Message{Topic: "spBv1.0/g/NDATA/n", Payload: data}))
+
+	assert.Equal(t, ErrInvalidPayload, Validate(&packet.Message{Topic: "spBv1.0/g/NDATA/n", Payload: []byte{0x08}}))
+}
+
+func TestBackend(t *testing.T) {
+	var invalid []error
+
+	backend := NewBackend(broker.NewMemoryBackend())
+	backend.InvalidCallback = func(client *broker.Client, msg *packet.Message, err error) error {
+		invalid = append(invalid, err)
+		return nil
+	}
+
+	b := testutil.NewBroker(backend, nil)
+	defer b.Close()
+
+	received := make(chan *packet.Message, 10)
+
+	subscriber, err := b.Connect(b.Config("subscriber"))
+	assert.NoError(t, err)
+
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		if msg != nil {
+			received <- msg
+		}
+		return nil
+	}
+
+	sf, err := subscriber.Subscribe("spBv1.0/#", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+
+	node := NewEdgeNode("g", "n")
+
+	publisher, err := b.Connect(b.Config("publisher"))
+	assert.NoError(t, err)
+
+	publish := func(msg *packet.Message) {
+		msg.QOS = 1
+		pf, err := publisher.PublishMessage(msg)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(time.Second))
+	}
+
+	// data before birth
+	data, err := node.Data()
+	assert.NoError(t, err)
+	publish(data)
+
+	birth, err := node.Birth()
+	assert.NoError(t, err)
+	publish(birth)
+
+	data, err = node.Data()
+	assert.NoError(t, err)
+	publish(data)
+
+	// skipped sequence
+	_, err = node.Data()
+	assert.NoError(t, err)
+	data, err = node.Data()
+	assert.NoError(t, err)
+	publish(data)
+
+	assert.Equal(t, birth.Topic, (<-received).Topic)
+	msg := <-received
+	assert.Equal(t, "spBv1.0/g/NDATA/n", msg.Topic)
+
+	assert.Equal(t, []error{ErrUnexpectedSequence, ErrUnexpectedSequence}, invalid)
+
+	select {
+	case <-received:
+		t.Fatal("unexpected message")
+	default:
+	}
+}
+
+func TestBackendCloseClient(t *testing.T) {
+	b := testutil.NewBroker(NewBackend(broker.NewMemoryBackend()), nil)
+	defer b.Close()
+
+	done := make(chan error, 1)
+
+	publisher, err := b.Connect(b.Config("publisher"))
+	assert.NoError(t, err)
+
+	publisher.Callback = func(msg *packet.Message, err error) error {
+		done <- err
+		return nil
+	}
+
+	_, err = publisher.Publish("spBv1.0/g/FOO/n", nil, 0, false)
+	assert.NoError(t, err)
+
+	assert.Error(t, <-done)
+}
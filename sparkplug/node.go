@@ -0,0 +1,159 @@
+package sparkplug
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// BirthDeathSequence is the name of the metric that links the birth and death
+// certificates of an edge node session.
+const BirthDeathSequence = "bdSeq"
+
+// An EdgeNode manages the session state of an edge node. It creates the birth
+// and death certificates and numbers all messages with a sequence number.
+//
+// Will must be called before every connection attempt and the returned
+// message must be registered as the will message of the connection. Once
+// connected, Birth must be published before any other message.
+type EdgeNode struct {
+	// The group and edge node ids.
+	Group string
+	Node  string
+
+	bdSeq  uint64
+	seq    uint64
+	online bool
+	mutex  sync.Mutex
+}
+
+// NewEdgeNode returns a new EdgeNode.
+func NewEdgeNode(group, node string) *EdgeNode {
+	return &EdgeNode{
+		Group: group,
+		Node:  node,
+	}
+}
+
+// Will returns a new NDEATH message that should be used as the will message
+// of the next connection.
+func (n *EdgeNode) Will() (*packet.Message, error) {
+	// acquire mutex
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// begin new session
+	if n.online {
+		n.bdSeq = (n.bdSeq + 1) % 256
+		n.online = false
+	}
+
+	return n.message(NDEATH, "", 1, &Payload{
+		Timestamp: now(),
+		Metrics:   []Metric{n.bdSeqMetric()},
+	})
+}
+
+// Birth returns the NBIRTH message for the current session that resets the
+// sequence number.
+func (n *EdgeNode) Birth(metrics ...Metric) (*packet.Message, error) {
+	// acquire mutex
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// mark online and reset sequence
+	n.online = true
+	n.seq = 0
+
+	return n.message(NBIRTH, "", 0, &Payload{
+		Timestamp: now(),
+		Metrics:   append([]Metric{n.bdSeqMetric()}, metrics...),
+		Seq:       n.next(),
+	})
+}
+
+// Data returns a new NDATA message.
+func (n *EdgeNode) Data(metrics ...Metric) (*packet.Message, error) {
+	return n.sequenced(NDATA, "", metrics)
+}
+
+// DeviceBirth returns a new DBIRTH message for the specified device.
+func (n *EdgeNode) DeviceBirth(device string, metrics ...Metric) (*packet.Message, error) {
+	return n.sequenced(DBIRTH, device, metrics)
+}
+
+// DeviceData returns a new DDATA message for the specified device.
+func (n *EdgeNode) DeviceData(device string, metrics ...Metric) (*packet.Message, error) {
+	return n.sequenced(DDATA, device, metrics)
+}
+
+// DeviceDeath returns a new DDEATH message for the specified device.
+func (n *EdgeNode) DeviceDeath(device string) (*packet.Message, error) {
+	return n.sequenced(DDEATH, device, nil)
+}
+
+func (n *EdgeNode) sequenced(typ MessageType, device string, metrics []Metric) (*packet.Message, error) {
+	// acquire mutex
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.message(typ, device, 0, &Payload{
+		Timestamp: now(),
+		Metrics:   metrics,
+		Seq:       n.next(),
+	})
+}
+
+func (n *EdgeNode) message(typ MessageType, device string, qos packet.QOS, payload *Payload) (*packet.Message, error) {
+	// encode payload
+	data, err := payload.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &packet.Message{
+		Topic: Topic{
+			Group:  n.Group,
+			Type:   typ,
+			Node:   n.Node,
+			Device: device,
+		}.String(),
+		Payload: data,
+		QOS:     qos,
+	}, nil
+}
+
+func (n *EdgeNode) bdSeqMetric() Metric {
+	return Metric{
+		Name:  BirthDeathSequence,
+		Type:  UInt64,
+		Value: n.bdSeq,
+	}
+}
+
+func (n *EdgeNode) next() uint64 {
+	seq := n.seq
+	n.seq = (n.seq + 1) % 256
+	return seq
+}
+
+// State returns the retained STATE message of a host application.
+func State(host string, online bool) *packet.Message {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"online":    online,
+		"timestamp": now(),
+	})
+
+	return &packet.Message{
+		Topic:   Topic{Type: STATE, Host: host}.String(),
+		Payload: payload,
+		QOS:     1,
+		Retain:  true,
+	}
+}
+
+func now() uint64 {
+	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+}
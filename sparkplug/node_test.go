@@ -0,0 +1,90 @@
+package sparkplug
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, msg *packet.Message) (Topic, *Payload) {
+	topic, err := ParseTopic(msg.Topic)
+	assert.NoError(t, err)
+
+	payload, err := DecodePayload(msg.Payload)
+	assert.NoError(t, err)
+
+	return topic, payload
+}
+
+func TestEdgeNode(t *testing.T) {
+	node := NewEdgeNode("g", "n")
+
+	for session := uint64(0); session < 2; session++ {
+		will, err := node.Will()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.QOS(1), will.QOS)
+		assert.NoError(t, Validate(will))
+
+		topic, payload := decode(t, will)
+		assert.Equal(t, NDEATH, topic.Type)
+		assert.Equal(t, session, payload.Metric(BirthDeathSequence).Value)
+
+		birth, err := node.Birth(Metric{Name: "foo", Type: Int32, Value: int32(1)})
+		assert.NoError(t, err)
+		assert.NoError(t, Validate(birth))
+
+		topic, payload = decode(t, birth)
+		assert.Equal(t, NBIRTH, topic.Type)
+		assert.Equal(t, uint64(0), payload.Seq)
+		assert.Equal(t, session, payload.Metric(BirthDeathSequence).Value)
+		assert.NotNil(t, payload.Metric("foo"))
+
+		data, err := node.Data()
+		assert.NoError(t, err)
+		_, payload = decode(t, data)
+		assert.Equal(t, uint64(1), payload.Seq)
+
+		dbirth, err := node.DeviceBirth("d")
+		assert.NoError(t, err)
+		topic, payload = decode(t, dbirth)
+		assert.Equal(t, Topic{Group: "g", Type: DBIRTH, Node: "n", Device: "d"}, topic)
+		assert.Equal(t, uint64(2), payload.Seq)
+
+		ddata, err := node.DeviceData("d")
+		assert.NoError(t, err)
+		_, payload = decode(t, ddata)
+		assert.Equal(t, uint64(3), payload.Seq)
+
+		ddeath, err := node.DeviceDeath("d")
+		assert.NoError(t, err)
+		topic, payload = decode(t, ddeath)
+		assert.Equal(t, DDEATH, topic.Type)
+		assert.Equal(t, uint64(4), payload.Seq)
+	}
+}
+
+func TestEdgeNodeSequenceWrap(t *testing.T) {
+	node := NewEdgeNode("g", "n")
+
+	_, err := node.Birth()
+	assert.NoError(t, err)
+
+	var msg *packet.Message
+	for i := 0; i < 256; i++ {
+		msg, err = node.Data()
+		assert.NoError(t, err)
+	}
+
+	_, payload := decode(t, msg)
+	assert.Equal(t, uint64(0), payload.Seq)
+}
+
+func TestState(t *testing.T) {
+	msg := State("h", true)
+	assert.Equal(t, "spBv1.0/STATE/h", msg.Topic)
+	assert.True(t, msg.Retain)
+	assert.Contains(t, string(msg.Payload), `"online":true`)
+	assert.NoError(t, Validate(msg))
+}
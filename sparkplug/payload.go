@@ -0,0 +1,331 @@
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidPayload is returned if a payload cannot be decoded.
+var ErrInvalidPayload = errors.New("invalid sparkplug payload")
+
+// DataType represents the Sparkplug B metric data types.
+type DataType uint32
+
+// All supported data types. Data sets, templates, property sets and metadata
+// are not supported and ignored when decoding.
+const (
+	Int8     DataType = 1
+	Int16    DataType = 2
+	Int32    DataType = 3
+	Int64    DataType = 4
+	UInt8    DataType = 5
+	UInt16   DataType = 6
+	UInt32   DataType = 7
+	UInt64   DataType = 8
+	Float    DataType = 9
+	Double   DataType = 10
+	Boolean  DataType = 11
+	String   DataType = 12
+	DateTime DataType = 13
+	Text     DataType = 14
+	UUID     DataType = 15
+	Bytes    DataType = 17
+	File     DataType = 18
+)
+
+// A Metric is a single value of a payload.
+//
+// The value must have the Go type that corresponds to the data type: int8,
+// int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, bool,
+// string for String, Text and UUID, time.Time for DateTime and []byte for
+// Bytes and File. Null values are represented by a nil value.
+type Metric struct {
+	// The name of the metric. May be omitted in data messages if an alias
+	// has been defined in the birth certificate.
+	Name string
+
+	// The alias of the metric. A zero alias is not encoded.
+	Alias uint64
+
+	// The timestamp of the value in milliseconds since the epoch.
+	Timestamp uint64
+
+	// The data type.
+	Type DataType
+
+	// Whether the value is historical or transient.
+	Historical bool
+	Transient  bool
+
+	// The value.
+	Value interface{}
+}
+
+// A Payload is a Sparkplug B payload.
+type Payload struct {
+	// The timestamp of the payload in milliseconds since the epoch.
+	Timestamp uint64
+
+	// The metrics.
+	Metrics []Metric
+
+	// The sequence number (0-255) of node and device messages.
+	Seq uint64
+
+	// An optional UUID and body.
+	UUID string
+	Body []byte
+}
+
+// Metric returns the first metric with the specified name or nil.
+func (p *Payload) Metric(name string) *Metric {
+	for i := range p.Metrics {
+		if p.Metrics[i].Name == name {
+			return &p.Metrics[i]
+		}
+	}
+
+	return nil
+}
+
+// Encode will encode the payload using the protocol buffers wire format.
+func (p *Payload) Encode() ([]byte, error) {
+	w := &protoWriter{}
+
+	// write timestamp
+	w.varint(1, p.Timestamp)
+
+	// write metrics
+	for i := range p.Metrics {
+		data, err := p.Metrics[i].encode()
+		if err != nil {
+			return nil, err
+		}
+
+		w.bytes(2, data)
+	}
+
+	// write sequence
+	w.varint(3, p.Seq)
+
+	// write uuid and body
+	if p.UUID != "" {
+		w.bytes(4, []byte(p.UUID))
+	}
+	if p.Body != nil {
+		w.bytes(5, p.Body)
+	}
+
+	return w.buf, nil
+}
+
+func (m *Metric) encode() ([]byte, error) {
+	w := &protoWriter{}
+
+	// write fields
+	if m.Name != "" {
+		w.bytes(1, []byte(m.Name))
+	}
+	if m.Alias != 0 {
+		w.varint(2, m.Alias)
+	}
+	if m.Timestamp != 0 {
+		w.varint(3, m.Timestamp)
+	}
+	w.varint(4, uint64(m.Type))
+	if m.Historical {
+		w.bool(5, true)
+	}
+	if m.Transient {
+		w.bool(6, true)
+	}
+
+	// write null
+	if m.Value == nil {
+		w.bool(7, true)
+		return w.buf, nil
+	}
+
+	// write value
+	ok := true
+	switch m.Type {
+	case Int8:
+		var v int8
+		v, ok = m.Value.(int8)
+		w.varint(10, uint64(uint32(v)))
+	case Int16:
+		var v int16
+		v, ok = m.Value.(int16)
+		w.varint(10, uint64(uint32(v)))
+	case Int32:
+		var v int32
+		v, ok = m.Value.(int32)
+		w.varint(10, uint64(uint32(v)))
+	case UInt8:
+		var v uint8
+		v, ok = m.Value.(uint8)
+		w.varint(10, uint64(v))
+	case UInt16:
+		var v uint16
+		v, ok = m.Value.(uint16)
+		w.varint(10, uint64(v))
+	case UInt32:
+		var v uint32
+		v, ok = m.Value.(uint32)
+		w.varint(10, uint64(v))
+	case Int64:
+		var v int64
+		v, ok = m.Value.(int64)
+		w.varint(11, uint64(v))
+	case UInt64:
+		var v uint64
+		v, ok = m.Value.(uint64)
+		w.varint(11, v)
+	case DateTime:
+		var v time.Time
+		v, ok = m.Value.(time.Time)
+		w.varint(11, uint64(v.UnixNano()/int64(time.Millisecond)))
+	case Float:
+		var v float32
+		v, ok = m.Value.(float32)
+		w.fixed32(12, math.Float32bits(v))
+	case Double:
+		var v float64
+		v, ok = m.Value.(float64)
+		w.fixed64(13, math.Float64bits(v))
+	case Boolean:
+		var v bool
+		v, ok = m.Value.(bool)
+		w.bool(14, v)
+	case String, Text, UUID:
+		var v string
+		v, ok = m.Value.(string)
+		w.bytes(15, []byte(v))
+	case Bytes, File:
+		var v []byte
+		v, ok = m.Value.([]byte)
+		w.bytes(16, v)
+	default:
+		return nil, fmt.Errorf("unsupported data type %d", m.Type)
+	}
+
+	// check value
+	if !ok {
+		return nil, fmt.Errorf("invalid value %T for data type %d", m.Value, m.Type)
+	}
+
+	return w.buf, nil
+}
+
+// DecodePayload will decode a payload. Unknown fields are ignored.
+func DecodePayload(data []byte) (*Payload, error) {
+	p := &Payload{}
+	r := &protoReader{buf: data}
+
+	for len(r.buf) > 0 {
+		field, wire, num, data, err := r.next()
+		if err != nil {
+			return nil, ErrInvalidPayload
+		}
+
+		switch {
+		case field == 1 && wire == wireVarint:
+			p.Timestamp = num
+		case field == 2 && wire == wireBytes:
+			m, err := decodeMetric(data)
+			if err != nil {
+				return nil, err
+			}
+			p.Metrics = append(p.Metrics, m)
+		case field == 3 && wire == wireVarint:
+			p.Seq = num
+		case field == 4 && wire == wireBytes:
+			p.UUID = string(data)
+		case field == 5 && wire == wireBytes:
+			p.Body = append([]byte(nil), data...)
+		}
+	}
+
+	return p, nil
+}
+
+func decodeMetric(data []byte) (Metric, error) {
+	var m Metric
+	var null bool
+	var value uint64
+	var bytes []byte
+	var hasValue bool
+
+	// read fields
+	r := &protoReader{buf: data}
+	for len(r.buf) > 0 {
+		field, wire, num, data, err := r.next()
+		if err != nil {
+			return m, ErrInvalidPayload
+		}
+
+		switch {
+		case field == 1 && wire == wireBytes:
+			m.Name = string(data)
+		case field == 2 && wire == wireVarint:
+			m.Alias = num
+		case field == 3 && wire == wireVarint:
+			m.Timestamp = num
+		case field == 4 && wire == wireVarint:
+			m.Type = DataType(num)
+		case field == 5 && wire == wireVarint:
+			m.Historical = num != 0
+		case field == 6 && wire == wireVarint:
+			m.Transient = num != 0
+		case field == 7 && wire == wireVarint:
+			null = num != 0
+		case field >= 10 && field <= 14 && wire != wireBytes:
+			value = num
+			hasValue = true
+		case field >= 15 && field <= 16 && wire == wireBytes:
+			bytes = data
+			hasValue = true
+		}
+	}
+
+	// check null
+	if null || !hasValue {
+		return m, nil
+	}
+
+	// convert value
+	switch m.Type {
+	case Int8:
+		m.Value = int8(uint32(value))
+	case Int16:
+		m.Value = int16(uint32(value))
+	case Int32:
+		m.Value = int32(uint32(value))
+	case UInt8:
+		m.Value = uint8(value)
+	case UInt16:
+		m.Value = uint16(value)
+	case UInt32:
+		m.Value = uint32(value)
+	case Int64:
+		m.Value = int64(value)
+	case UInt64:
+		m.Value = value
+	case DateTime:
+		m.Value = time.Unix(0, int64(value)*int64(time.Millisecond))
+	case Float:
+		m.Value = math.Float32frombits(uint32(value))
+	case Double:
+		m.Value = math.Float64frombits(value)
+	case Boolean:
+		m.Value = value != 0
+	case String, Text, UUID:
+		m.Value = string(bytes)
+	case Bytes, File:
+		m.Value = append([]byte(nil), bytes...)
+	}
+
+	return m, nil
+}
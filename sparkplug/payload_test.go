@@ -0,0 +1,60 @@
+package sparkplug
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadEncodeDecode(t *testing.T) {
+	payload := &Payload{
+		Timestamp: 1234,
+		Seq:       42,
+		UUID:      "foo",
+		Body:      []byte("bar"),
+		Metrics: []Metric{
+			{Name: "i8", Type: Int8, Value: int8(-8)},
+			{Name: "i16", Type: Int16, Value: int16(-16)},
+			{Name: "i32", Type: Int32, Value: int32(-32)},
+			{Name: "i64", Type: Int64, Value: int64(-64)},
+			{Name: "u8", Type: UInt8, Value: uint8(8)},
+			{Name: "u16", Type: UInt16, Value: uint16(16)},
+			{Name: "u32", Type: UInt32, Value: uint32(32)},
+			{Name: "u64", Type: UInt64, Value: uint64(64), Alias: 7, Timestamp: 5},
+			{Name: "f", Type: Float, Value: float32(1.5)},
+			{Name: "d", Type: Double, Value: float64(2.5)},
+			{Name: "b", Type: Boolean, Value: true, Historical: true, Transient: true},
+			{Name: "s", Type: String, Value: "str"},
+			{Name: "t", Type: DateTime, Value: time.Unix(10, 0)},
+			{Name: "y", Type: Bytes, Value: []byte("bytes")},
+			{Name: "n", Type: Int32},
+		},
+	}
+
+	data, err := payload.Encode()
+	assert.NoError(t, err)
+
+	decoded, err := DecodePayload(data)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+
+	assert.Equal(t, &payload.Metrics[2], decoded.Metric("i32"))
+	assert.Nil(t, decoded.Metric("foo"))
+}
+
+func TestPayloadEncodeErrors(t *testing.T) {
+	_, err := (&Payload{Metrics: []Metric{{Type: Int8, Value: 1}}}).Encode()
+	assert.Error(t, err)
+
+	_, err = (&Payload{Metrics: []Metric{{Type: 16, Value: 1}}}).Encode()
+	assert.Error(t, err)
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	_, err := DecodePayload([]byte{0x08})
+	assert.Equal(t, ErrInvalidPayload, err)
+
+	_, err = DecodePayload([]byte{0x12, 0x05, 0x00})
+	assert.Equal(t, ErrInvalidPayload, err)
+}
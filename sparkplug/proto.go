@@ -0,0 +1,114 @@
+package sparkplug
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// This file implements the subset of the protocol buffers wire format needed
+// to encode and decode Sparkplug B payloads.
+
+var errMalformed = errors.New("malformed protobuf")
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) key(field int, wire int) {
+	w.buf = appendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	w.key(field, wireVarint)
+	w.buf = appendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) bool(field int, v bool) {
+	if v {
+		w.varint(field, 1)
+	} else {
+		w.varint(field, 0)
+	}
+}
+
+func (w *protoWriter) fixed32(field int, v uint32) {
+	w.key(field, wireFixed32)
+	w.buf = append(w.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (w *protoWriter) fixed64(field int, v uint64) {
+	w.key(field, wireFixed64)
+	w.buf = append(w.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func (w *protoWriter) bytes(field int, v []byte) {
+	w.key(field, wireBytes)
+	w.buf = appendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+type protoReader struct {
+	buf []byte
+}
+
+// next reads the next field and returns its number, wire type and value. The
+// value of varint and fixed fields is returned as num, the value of length
+// delimited fields as data.
+func (r *protoReader) next() (field int, wire int, num uint64, data []byte, err error) {
+	// read key
+	key, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return 0, 0, 0, nil, errMalformed
+	}
+	r.buf = r.buf[n:]
+
+	field = int(key >> 3)
+	wire = int(key & 7)
+
+	switch wire {
+	case wireVarint:
+		num, n = binary.Uvarint(r.buf)
+		if n <= 0 {
+			return 0, 0, 0, nil, errMalformed
+		}
+		r.buf = r.buf[n:]
+	case wireFixed64:
+		if len(r.buf) < 8 {
+			return 0, 0, 0, nil, errMalformed
+		}
+		num = binary.LittleEndian.Uint64(r.buf)
+		r.buf = r.buf[8:]
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			return 0, 0, 0, nil, errMalformed
+		}
+		num = uint64(binary.LittleEndian.Uint32(r.buf))
+		r.buf = r.buf[4:]
+	case wireBytes:
+		var l uint64
+		l, n = binary.Uvarint(r.buf)
+		if n <= 0 || uint64(len(r.buf)-n) < l {
+			return 0, 0, 0, nil, errMalformed
+		}
+		data = r.buf[n : n+int(l)]
+		r.buf = r.buf[n+int(l):]
+	default:
+		return 0, 0, 0, nil, errMalformed
+	}
+
+	return field, wire, num, data, nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
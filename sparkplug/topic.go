@@ -0,0 +1,139 @@
+// Package sparkplug implements helpers for the Sparkplug B specification that
+// defines a topic namespace, payload encoding and session state management
+// for industrial MQTT applications.
+package sparkplug
+
+import (
+	"errors"
+	"strings"
+)
+
+// Namespace is the first topic level of all Sparkplug B topics.
+const Namespace = "spBv1.0"
+
+// ErrInvalidTopic is returned if a topic is not a valid Sparkplug B topic.
+var ErrInvalidTopic = errors.New("invalid sparkplug topic")
+
+// MessageType represents the Sparkplug B message types.
+type MessageType string
+
+// All available message types.
+const (
+	NBIRTH MessageType = "NBIRTH"
+	NDEATH MessageType = "NDEATH"
+	DBIRTH MessageType = "DBIRTH"
+	DDEATH MessageType = "DDEATH"
+	NDATA  MessageType = "NDATA"
+	DDATA  MessageType = "DDATA"
+	NCMD   MessageType = "NCMD"
+	DCMD   MessageType = "DCMD"
+	STATE  MessageType = "STATE"
+)
+
+// Valid returns whether the message type is known.
+func (t MessageType) Valid() bool {
+	switch t {
+	case NBIRTH, NDEATH, DBIRTH, DDEATH, NDATA, DDATA, NCMD, DCMD, STATE:
+		return true
+	}
+
+	return false
+}
+
+// Device returns whether the message type requires a device id.
+func (t MessageType) Device() bool {
+	return t == DBIRTH || t == DDEATH || t == DDATA || t == DCMD
+}
+
+// A Topic is a parsed Sparkplug B topic.
+type Topic struct {
+	// The group id of edge node messages.
+	Group string
+
+	// The message type.
+	Type MessageType
+
+	// The edge node id of edge node messages.
+	Node string
+
+	// The device id of device messages.
+	Device string
+
+	// The host id of STATE messages.
+	Host string
+}
+
+// String returns the topic in the form of
+// "spBv1.0/group/type/node[/device]" or "spBv1.0/STATE/host".
+func (t Topic) String() string {
+	// handle state
+	if t.Type == STATE {
+		return Namespace + "/" + string(STATE) + "/" + t.Host
+	}
+
+	// handle device messages
+	if t.Type.Device() {
+		return Namespace + "/" + t.Group + "/" + string(t.Type) + "/" + t.Node + "/" + t.Device
+	}
+
+	return Namespace + "/" + t.Group + "/" + string(t.Type) + "/" + t.Node
+}
+
+// ParseTopic will parse a Sparkplug B topic. The legacy "STATE/host" topic
+// used by earlier versions of the specification is also supported.
+func ParseTopic(topic string) (Topic, error) {
+	segments := strings.Split(topic, "/")
+
+	// handle legacy state
+	if len(segments) == 2 && segments[0] == string(STATE) && validID(segments[1]) {
+		return Topic{Type: STATE, Host: segments[1]}, nil
+	}
+
+	// check namespace
+	if len(segments) < 3 || segments[0] != Namespace {
+		return Topic{}, ErrInvalidTopic
+	}
+
+	// handle state
+	if segments[1] == string(STATE) {
+		if len(segments) != 3 || !validID(segments[2]) {
+			return Topic{}, ErrInvalidTopic
+		}
+
+		return Topic{Type: STATE, Host: segments[2]}, nil
+	}
+
+	// check message type
+	typ := MessageType(segments[2])
+	if !typ.Valid() || typ == STATE {
+		return Topic{}, ErrInvalidTopic
+	}
+
+	// check length
+	if (typ.Device() && len(segments) != 5) || (!typ.Device() && len(segments) != 4) {
+		return Topic{}, ErrInvalidTopic
+	}
+
+	// prepare topic
+	t := Topic{
+		Group: segments[1],
+		Type:  typ,
+		Node:  segments[3],
+	}
+	if typ.Device() {
+		t.Device = segments[4]
+	}
+
+	// validate ids
+	if !validID(t.Group) || !validID(t.Node) || (typ.Device() && !validID(t.Device)) {
+		return Topic{}, ErrInvalidTopic
+	}
+
+	return t, nil
+}
+
+// validID returns whether the id is non empty and does not contain the
+// reserved characters "/", "+" and "#".
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, "/+#")
+}
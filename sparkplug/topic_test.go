@@ -0,0 +1,44 @@
+package sparkplug
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopic(t *testing.T) {
+	matrix := map[string]Topic{
+		"spBv1.0/g/NBIRTH/n":    {Group: "g", Type: NBIRTH, Node: "n"},
+		"spBv1.0/g/NDATA/n":     {Group: "g", Type: NDATA, Node: "n"},
+		"spBv1.0/g/DDATA/n/d":   {Group: "g", Type: DDATA, Node: "n", Device: "d"},
+		"spBv1.0/g/DCMD/n/d":    {Group: "g", Type: DCMD, Node: "n", Device: "d"},
+		"spBv1.0/STATE/h":       {Type: STATE, Host: "h"},
+		"STATE/h":               {Type: STATE, Host: "h"},
+		"spBv1.0/g/FOO/n":       {},
+		"spBv1.0/g/NDATA/n/d":   {},
+		"spBv1.0/g/DDATA/n":     {},
+		"spBv1.0/g/NDATA/+":     {},
+		"spBv1.0//NDATA/n":      {},
+		"spBv1.0/STATE/h/x":     {},
+		"spAv1.0/g/NDATA/n":     {},
+		"foo":                   {},
+		"spBv1.0/g/STATE/n":     {},
+		"spBv1.0/g/NDEATH/n/d/": {},
+	}
+
+	for str, topic := range matrix {
+		res, err := ParseTopic(str)
+		if topic.Type == "" {
+			assert.Equal(t, ErrInvalidTopic, err, str)
+		} else {
+			assert.NoError(t, err, str)
+			assert.Equal(t, topic, res, str)
+		}
+	}
+}
+
+func TestTopicString(t *testing.T) {
+	assert.Equal(t, "spBv1.0/g/NBIRTH/n", Topic{Group: "g", Type: NBIRTH, Node: "n"}.String())
+	assert.Equal(t, "spBv1.0/g/DBIRTH/n/d", Topic{Group: "g", Type: DBIRTH, Node: "n", Device: "d"}.String())
+	assert.Equal(t, "spBv1.0/STATE/h", Topic{Type: STATE, Host: "h"}.String())
+}
@@ -12,6 +12,8 @@ import (
 
 // AuthenticationTest tests the broker for valid and invalid authentication.
 func AuthenticationTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	deniedClient := client.New()
 	deniedClient.Callback = func(msg *packet.Message, err error) error {
 		assert.Equal(t, client.ErrClientConnectionDenied, err)
@@ -38,6 +40,8 @@ func AuthenticationTest(t *testing.T, config *Config) {
 
 // UniqueClientIDUncleanTest tests the broker for enforcing unique client ids.
 func UniqueClientIDUncleanTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -75,6 +79,8 @@ func UniqueClientIDUncleanTest(t *testing.T, config *Config) {
 
 // UniqueClientIDCleanTest tests the broker for enforcing unique client ids.
 func UniqueClientIDCleanTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -111,6 +117,8 @@ func UniqueClientIDCleanTest(t *testing.T, config *Config) {
 // RootSlashDistinctionTest tests the broker for supporting the root slash
 // distinction.
 func RootSlashDistinctionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -16,6 +16,8 @@ import (
 
 // PublishSubscribeTest tests the broker for basic pub sub support.
 func PublishSubscribeTest(t *testing.T, config *Config, pub, sub string, subQOS, pubQOS, recQOS packet.QOS) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -55,6 +57,8 @@ func PublishSubscribeTest(t *testing.T, config *Config, pub, sub string, subQOS,
 
 // UnsubscribeTest tests the broker for unsubscribe support.
 func UnsubscribeTest(t *testing.T, config *Config, topic string, qos packet.QOS) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -108,6 +112,8 @@ func UnsubscribeTest(t *testing.T, config *Config, topic string, qos packet.QOS)
 // UnsubscribeNotExistingSubscriptionTest tests the broker for allowing
 // unsubscribing not existing topics.
 func UnsubscribeNotExistingSubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	c := client.New()
 
 	c.Callback = func(msg *packet.Message, err error) error {
@@ -182,6 +188,8 @@ func UnsubscribeOverlappingSubscriptions(t *testing.T, config *Config, topic str
 
 // SubscriptionUpgradeTest tests the broker for properly upgrading subscriptions,
 func SubscriptionUpgradeTest(t *testing.T, config *Config, topic string, from, to packet.QOS) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -225,6 +233,8 @@ func SubscriptionUpgradeTest(t *testing.T, config *Config, topic string, from, t
 // OverlappingSubscriptionsTest tests the broker for properly handling overlapping
 // subscriptions.
 func OverlappingSubscriptionsTest(t *testing.T, config *Config, pub, sub string) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -270,6 +280,8 @@ func OverlappingSubscriptionsTest(t *testing.T, config *Config, pub, sub string)
 // MultipleSubscriptionTest tests the broker for properly handling multiple
 // subscriptions.
 func MultipleSubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -316,6 +328,8 @@ func MultipleSubscriptionTest(t *testing.T, config *Config, topic string) {
 // DuplicateSubscriptionTest tests the broker for properly handling duplicate
 // subscriptions.
 func DuplicateSubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -360,6 +374,8 @@ func DuplicateSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 // IsolatedSubscriptionTest tests the broker for properly isolating subscriptions.
 func IsolatedSubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	c := client.New()
 	wait := make(chan struct{})
 
@@ -409,8 +425,68 @@ func IsolatedSubscriptionTest(t *testing.T, config *Config, topic string) {
 	assert.NoError(t, err)
 }
 
+// MessageRoundTripTest tests the broker for delivering empty and binary
+// payloads as well as UTF-8 topics unchanged.
+func MessageRoundTripTest(t *testing.T, config *Config, topic string, qos packet.QOS) {
+	config.report(t)
+
+	topic += "/ü/€"
+
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+
+	payloads := [][]byte{nil, binary}
+
+	c := client.New()
+	wait := make(chan struct{})
+
+	var received int
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		assert.Equal(t, topic, msg.Topic)
+		assert.Equal(t, string(payloads[received]), string(msg.Payload))
+		assert.Equal(t, qos, msg.QOS)
+		assert.False(t, msg.Retain)
+
+		received++
+		if received == len(payloads) {
+			close(wait)
+		}
+
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	sf, err := c.Subscribe(topic, qos)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
+
+	for _, payload := range payloads {
+		pf, err := c.Publish(topic, payload, qos, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	safeReceive(wait)
+
+	time.Sleep(config.NoMessageWait)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+}
+
 // WillTest tests the broker for supporting will messages.
 func WillTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS) {
+	config.report(t)
+
 	clientWithWill := client.New()
 
 	opts := client.NewConfig(config.URL)
@@ -465,6 +541,8 @@ func WillTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS) {
 // CleanWillTest tests the broker for properly handling will messages on a clean
 // disconnect.
 func CleanWillTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	clientWithWill := client.New()
 
 	opts := client.NewConfig(config.URL)
@@ -509,6 +587,8 @@ func CleanWillTest(t *testing.T, config *Config, topic string) {
 
 // KeepAliveTest tests the broker for proper keep alive support.
 func KeepAliveTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	opts := client.NewConfig(config.URL)
 	opts.KeepAlive = "2s" // mosquitto fails with a keep alive of 1s
 
@@ -543,6 +623,8 @@ func KeepAliveTest(t *testing.T, config *Config) {
 // KeepAliveTimeoutTest tests the broker for proper keep alive timeout detection
 // support.
 func KeepAliveTimeoutTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	username, password := config.usernamePassword()
 
 	connect := packet.NewConnect()
@@ -568,6 +650,8 @@ func KeepAliveTimeoutTest(t *testing.T, config *Config) {
 // UnexpectedPubrelTest tests the broker for proper handling of unexpected pubrel
 // packets.
 func UnexpectedPubrelTest(t *testing.T, config *Config) {
+	config.report(t)
+
 	username, password := config.usernamePassword()
 
 	connect := packet.NewConnect()
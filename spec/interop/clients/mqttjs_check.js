@@ -0,0 +1,76 @@
+// Runs basic scenarios with the mqtt.js client against BROKER_URL and prints
+// one json line per scenario.
+
+const mqtt = require('mqtt');
+const crypto = require('crypto');
+
+const url = (process.env.BROKER_URL || 'tcp://localhost:1883').replace(/^tcp:/, 'mqtt:');
+
+function connect(prefix) {
+  return new Promise((resolve, reject) => {
+    const client = mqtt.connect(url, {
+      clientId: prefix + crypto.randomBytes(4).toString('hex'),
+      protocolVersion: 4,
+      reconnectPeriod: 0,
+    });
+    client.once('connect', () => resolve(client));
+    client.once('error', reject);
+  });
+}
+
+function timeout(ms) {
+  return new Promise((_, reject) => setTimeout(() => reject(new Error('timeout')), ms));
+}
+
+async function pubsub(qos, retain) {
+  const topic = 'interop/mqttjs/' + crypto.randomBytes(8).toString('hex');
+
+  const sub = await connect('mqttjs-sub-');
+  const pub = await connect('mqttjs-pub-');
+
+  try {
+    const received = new Promise((resolve) => {
+      sub.on('message', (t, payload) => resolve(payload.toString()));
+    });
+
+    if (retain) {
+      await pub.publishAsync(topic, 'test', { qos, retain: true });
+      await new Promise((resolve) => setTimeout(resolve, 500));
+      await sub.subscribeAsync(topic, { qos });
+    } else {
+      await sub.subscribeAsync(topic, { qos });
+      await pub.publishAsync(topic, 'test', { qos });
+    }
+
+    const payload = await Promise.race([received, timeout(5000)]);
+
+    if (retain) {
+      await pub.publishAsync(topic, '', { qos, retain: true });
+    }
+
+    return payload === 'test';
+  } finally {
+    await sub.endAsync();
+    await pub.endAsync();
+  }
+}
+
+const scenarios = [
+  ['PublishSubscribeQOS0', () => pubsub(0, false)],
+  ['PublishSubscribeQOS1', () => pubsub(1, false)],
+  ['PublishSubscribeQOS2', () => pubsub(2, false)],
+  ['RetainedMessage', () => pubsub(1, true)],
+];
+
+(async () => {
+  for (const [name, fn] of scenarios) {
+    let ok = false;
+    try {
+      ok = await fn();
+    } catch (err) {
+      ok = false;
+    }
+    console.log(JSON.stringify({ scenario: name, ok }));
+  }
+  process.exit(0);
+})();
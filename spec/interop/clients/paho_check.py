@@ -0,0 +1,72 @@
+# Runs basic scenarios with the paho client against BROKER_URL and prints
+# one json line per scenario.
+
+import json
+import os
+import threading
+import time
+import uuid
+from urllib.parse import urlparse
+
+import paho.mqtt.client as mqtt
+
+url = urlparse(os.environ.get("BROKER_URL", "tcp://localhost:1883"))
+
+
+def connect(client_id):
+    client = mqtt.Client(client_id=client_id, clean_session=True)
+    client.connect(url.hostname, url.port or 1883)
+    client.loop_start()
+    return client
+
+
+def pubsub(qos, retain):
+    topic = "interop/paho/" + uuid.uuid4().hex
+    received = threading.Event()
+    result = {}
+
+    sub = connect("paho-sub-" + uuid.uuid4().hex[:8])
+    pub = connect("paho-pub-" + uuid.uuid4().hex[:8])
+
+    def on_message(client, userdata, msg):
+        result["payload"] = msg.payload
+        received.set()
+
+    sub.on_message = on_message
+
+    if retain:
+        pub.publish(topic, b"test", qos=qos, retain=True).wait_for_publish()
+        time.sleep(0.5)
+        sub.subscribe(topic, qos=qos)
+    else:
+        subscribed = threading.Event()
+        sub.on_subscribe = lambda *args: subscribed.set()
+        sub.subscribe(topic, qos=qos)
+        subscribed.wait(5)
+        pub.publish(topic, b"test", qos=qos).wait_for_publish()
+
+    ok = received.wait(5) and result.get("payload") == b"test"
+
+    if retain:
+        pub.publish(topic, b"", qos=qos, retain=True).wait_for_publish()
+
+    for client in (sub, pub):
+        client.disconnect()
+        client.loop_stop()
+
+    return ok
+
+
+scenarios = [
+    ("PublishSubscribeQOS0", lambda: pubsub(0, False)),
+    ("PublishSubscribeQOS1", lambda: pubsub(1, False)),
+    ("PublishSubscribeQOS2", lambda: pubsub(2, False)),
+    ("RetainedMessage", lambda: pubsub(1, True)),
+]
+
+for name, fn in scenarios:
+    try:
+        ok = fn()
+    except Exception:
+        ok = False
+    print(json.dumps({"scenario": name, "ok": bool(ok)}), flush=True)
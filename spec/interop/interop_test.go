@@ -0,0 +1,107 @@
+//go:build interop
+// +build interop
+
+package interop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/spec"
+)
+
+var matrix = NewMatrix()
+
+var brokers = []struct {
+	name string
+	env  string
+	url  string
+}{
+	{"mosquitto", "MOSQUITTO_URL", "tcp://localhost:21883"},
+	{"emqx", "EMQX_URL", "tcp://localhost:21884"},
+	{"hivemq", "HIVEMQ_URL", "tcp://localhost:21885"},
+}
+
+var clients = []string{"paho", "mqttjs"}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	// write matrix
+	if path := os.Getenv("INTEROP_MATRIX"); path != "" {
+		var buf bytes.Buffer
+		_ = matrix.Write(&buf)
+		_ = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	} else {
+		_ = matrix.Write(os.Stdout)
+	}
+
+	os.Exit(code)
+}
+
+func TestBrokers(t *testing.T) {
+	for _, b := range brokers {
+		url := b.url
+		if env := os.Getenv(b.env); env != "" {
+			url = env
+		}
+
+		config := spec.AllFeatures()
+		config.URL = url
+		config.Authentication = false
+		config.ProcessWait = 200 * time.Millisecond
+		config.NoMessageWait = 500 * time.Millisecond
+		config.MessageRetainWait = 500 * time.Millisecond
+		config.Report = matrix.Reporter(b.name)
+
+		t.Run(b.name, func(t *testing.T) {
+			spec.Run(t, config)
+		})
+	}
+}
+
+func TestClients(t *testing.T) {
+	// run broker
+	port, quit, done := broker.Run(broker.NewEngine(broker.NewMemoryBackend()), "tcp")
+	defer func() {
+		close(quit)
+		<-done
+	}()
+
+	for _, name := range clients {
+		t.Run(name, func(t *testing.T) {
+			// run client container
+			cmd := exec.Command("docker", "compose", "-f", "docker-compose.yml", "run", "--rm", "-e", "BROKER_URL=tcp://localhost:"+port, name)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// parse results
+			scanner := bufio.NewScanner(bytes.NewReader(out))
+			for scanner.Scan() {
+				var result struct {
+					Scenario string `json:"scenario"`
+					OK       bool   `json:"ok"`
+				}
+
+				if json.Unmarshal(scanner.Bytes(), &result) != nil || result.Scenario == "" {
+					continue
+				}
+
+				matrix.Add(name, result.Scenario, result.OK)
+				if !result.OK {
+					t.Errorf("scenario %s failed", result.Scenario)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Package interop runs the spec and client checks against third party
+// brokers and clients to produce a compatibility matrix.
+//
+// The tests require docker and are only built with the "interop" build tag:
+//
+//	docker compose -f spec/interop/docker-compose.yml up -d mosquitto emqx hivemq
+//	go test -tags interop ./spec/interop
+//
+// The brokers are expected on the ports configured in docker-compose.yml.
+// The MOSQUITTO_URL, EMQX_URL and HIVEMQ_URL environment variables can be
+// used to test other instances. If INTEROP_MATRIX is set, the resulting
+// matrix is written as markdown to the specified file.
+package interop
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Matrix collects the results of tests run against different targets.
+type Matrix struct {
+	targets []string
+	tests   []string
+	results map[string]map[string]bool
+	mutex   sync.Mutex
+}
+
+// NewMatrix returns a new Matrix.
+func NewMatrix() *Matrix {
+	return &Matrix{
+		results: make(map[string]map[string]bool),
+	}
+}
+
+// Add will add the result of a test run against the specified target.
+func (m *Matrix) Add(target, test string, passed bool) {
+	// acquire mutex
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// add target
+	results, ok := m.results[target]
+	if !ok {
+		results = make(map[string]bool)
+		m.results[target] = results
+		m.targets = append(m.targets, target)
+	}
+
+	// add test
+	if !contains(m.tests, test) {
+		m.tests = append(m.tests, test)
+	}
+
+	results[test] = passed
+}
+
+// Reporter returns a function that can be used as spec.Config.Report for
+// the specified target.
+func (m *Matrix) Reporter(target string) func(string, bool) {
+	return func(test string, passed bool) {
+		m.Add(target, test, passed)
+	}
+}
+
+// Write will write the matrix as a markdown table. Tests that have not been
+// run against a target are marked with a dash.
+func (m *Matrix) Write(w io.Writer) error {
+	// acquire mutex
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// sort tests
+	tests := append([]string(nil), m.tests...)
+	sort.Strings(tests)
+
+	// write header
+	_, err := fmt.Fprintf(w, "| Test | %s |\n|---|%s\n", strings.Join(m.targets, " | "), strings.Repeat("---|", len(m.targets)))
+	if err != nil {
+		return err
+	}
+
+	// write rows
+	for _, test := range tests {
+		cells := make([]string, 0, len(m.targets))
+		for _, target := range m.targets {
+			passed, ok := m.results[target][test]
+			if !ok {
+				cells = append(cells, "-")
+			} else if passed {
+				cells = append(cells, "pass")
+			} else {
+				cells = append(cells, "FAIL")
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "| %s | %s |\n", test, strings.Join(cells, " | "))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+
+	return false
+}
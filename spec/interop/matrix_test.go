@@ -0,0 +1,25 @@
+package interop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrix(t *testing.T) {
+	matrix := NewMatrix()
+
+	report := matrix.Reporter("foo")
+	report("B", true)
+	report("A", false)
+
+	matrix.Add("bar", "B", false)
+
+	var buf bytes.Buffer
+	assert.NoError(t, matrix.Write(&buf))
+	assert.Equal(t, "| Test | foo | bar |\n"+
+		"|---|---|---|\n"+
+		"| A | FAIL | - |\n"+
+		"| B | pass | FAIL |\n", buf.String())
+}
@@ -13,6 +13,8 @@ import (
 // OfflineSubscriptionTest tests the broker for properly handling offline
 // subscriptions.
 func OfflineSubscriptionTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS, await bool) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -84,6 +86,8 @@ func OfflineSubscriptionTest(t *testing.T, config *Config, topic string, sub, pu
 // OfflineSubscriptionRetainedTest tests the broker for properly handling
 // retained messages and offline subscriptions.
 func OfflineSubscriptionRetainedTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS, await bool) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -12,6 +12,8 @@ import (
 
 // RetainedMessageTest tests the broker for properly handling retained messages.
 func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub packet.QOS) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), out, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -70,6 +72,8 @@ func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub
 // RetainedMessageReplaceTest tests the broker for replacing existing retained
 // messages.
 func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -133,6 +137,8 @@ func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
 
 // ClearRetainedMessageTest tests the broker for clearing retained messages.
 func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -224,6 +230,8 @@ func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
 // DirectRetainedMessageTest tests the broker for properly handling subscriptions
 // with retained messages.
 func DirectRetainedMessageTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -270,6 +278,8 @@ func DirectRetainedMessageTest(t *testing.T, config *Config, topic string) {
 // DirectClearRetainedMessageTest tests the broker for properly dispatching a
 // messages intended to clear a retained message.
 func DirectClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -315,6 +325,8 @@ func DirectClearRetainedMessageTest(t *testing.T, config *Config, topic string)
 
 // RetainedWillTest tests the broker for support of retained will messages.
 func RetainedWillTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -376,6 +388,8 @@ func RetainedWillTest(t *testing.T, config *Config, topic string) {
 // RetainedMessageResubscriptionTest tests the broker for properly dispatching
 // retained messages on resubscription.
 func RetainedMessageResubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
 
 	time.Sleep(config.MessageRetainWait)
@@ -0,0 +1,143 @@
+package spec
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SharedSubscriptionTest tests the broker for distributing messages of a shared
+// subscription among the members of a group.
+func SharedSubscriptionTest(t *testing.T, config *Config, topic string, qos packet.QOS) {
+	config.report(t)
+
+	const messages = 10
+
+	var mutex sync.Mutex
+	counts := make(map[int]int)
+	wait := make(chan struct{})
+	total := 0
+
+	var members []*client.Client
+	for i := 0; i < 2; i++ {
+		i := i
+
+		member := client.New()
+		member.Callback = func(msg *packet.Message, err error) error {
+			assert.NoError(t, err)
+			assert.Equal(t, topic, msg.Topic)
+			assert.Equal(t, testPayload, msg.Payload)
+			assert.Equal(t, qos, msg.QOS)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			counts[i]++
+			total++
+			if total == messages {
+				close(wait)
+			}
+
+			return nil
+		}
+
+		cf, err := member.Connect(client.NewConfig(config.URL))
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		sf, err := member.Subscribe("$share/group/"+topic, qos)
+		assert.NoError(t, err)
+		assert.NoError(t, sf.Wait(10*time.Second))
+		assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
+
+		members = append(members, member)
+	}
+
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for i := 0; i < messages; i++ {
+		pf, err := publisher.Publish(topic, testPayload, qos, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	safeReceive(wait)
+
+	time.Sleep(config.NoMessageWait)
+
+	mutex.Lock()
+	assert.Equal(t, messages, total)
+	assert.Len(t, counts, 2)
+	mutex.Unlock()
+
+	for _, c := range append(members, publisher) {
+		err = c.Disconnect()
+		assert.NoError(t, err)
+	}
+}
+
+// SharedSubscriptionGroupsTest tests the broker for delivering a message to one
+// member of every group and to regular subscribers.
+func SharedSubscriptionGroupsTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
+	var wg sync.WaitGroup
+
+	var subscribers []*client.Client
+	for _, filter := range []string{"$share/group1/" + topic, "$share/group2/" + topic, topic} {
+		wg.Add(1)
+
+		subscriber := client.New()
+		subscriber.Callback = func(msg *packet.Message, err error) error {
+			assert.NoError(t, err)
+			assert.Equal(t, topic, msg.Topic)
+			assert.Equal(t, testPayload, msg.Payload)
+
+			wg.Done()
+
+			return nil
+		}
+
+		cf, err := subscriber.Connect(client.NewConfig(config.URL))
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		sf, err := subscriber.Subscribe(filter, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, sf.Wait(10*time.Second))
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err := publisher.Publish(topic, testPayload, 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	safeReceive(done)
+
+	for _, c := range append(subscribers, publisher) {
+		err = c.Disconnect()
+		assert.NoError(t, err)
+	}
+}
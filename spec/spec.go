@@ -4,6 +4,7 @@ package spec
 import (
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,6 +25,16 @@ type Config struct {
 	UniqueClientIDs      bool
 	RootSlashDistinction bool
 
+	// SharedSubscriptions enables tests for shared subscriptions in the form
+	// of "$share/group/filter". Other MQTT 5 features like properties, session
+	// expiry and reason codes are not covered as the packet package only
+	// implements MQTT 3.1.1.
+	SharedSubscriptions bool
+
+	// Report is called with the name and outcome of every executed test and
+	// can be used to build a compatibility matrix.
+	Report func(name string, passed bool)
+
 	// ProcessWait defines the time some tests should wait and let the broker
 	// finish processing (e.g. properly terminating a connection)
 	ProcessWait time.Duration
@@ -39,7 +50,8 @@ type Config struct {
 	counter int
 }
 
-// AllFeatures returns a config that enables all features.
+// AllFeatures returns a config that enables all MQTT 3.1.1 features. Shared
+// subscriptions are not part of MQTT 3.1.1 and must be enabled explicitly.
 func AllFeatures() *Config {
 	return &Config{
 		RetainedMessages:     true,
@@ -72,6 +84,23 @@ func (c *Config) clientID() string {
 	return fmt.Sprintf("c%d", c.counter)
 }
 
+func (c *Config) report(t *testing.T) {
+	// check callback
+	if c.Report == nil {
+		return
+	}
+
+	// report result when the test finished
+	t.Cleanup(func() {
+		name := t.Name()
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+
+		c.Report(name, !t.Failed())
+	})
+}
+
 // Run will fully test a to support all specified features in the matrix.
 func Run(t *testing.T, config *Config) {
 	t.Run("PublishSubscribeQOS0", func(t *testing.T) {
@@ -162,6 +191,18 @@ func Run(t *testing.T, config *Config) {
 		IsolatedSubscriptionTest(t, config, "islsub")
 	})
 
+	t.Run("MessageRoundTripQOS0", func(t *testing.T) {
+		MessageRoundTripTest(t, config, "roundtrip/1", 0)
+	})
+
+	t.Run("MessageRoundTripQOS1", func(t *testing.T) {
+		MessageRoundTripTest(t, config, "roundtrip/2", 1)
+	})
+
+	t.Run("MessageRoundTripQOS2", func(t *testing.T) {
+		MessageRoundTripTest(t, config, "roundtrip/3", 2)
+	})
+
 	t.Run("WillQOS0", func(t *testing.T) {
 		WillTest(t, config, "will/1", 0, 0)
 	})
@@ -260,6 +301,10 @@ func Run(t *testing.T, config *Config) {
 		t.Run("PubrelResendQOS2", func(t *testing.T) {
 			PubrelResendQOS2Test(t, config, "pubres/3")
 		})
+
+		t.Run("PublishResendOrder", func(t *testing.T) {
+			PublishResendOrderTest(t, config, "pubres/4")
+		})
 	}
 
 	if config.StoredSubscriptions {
@@ -282,6 +327,10 @@ func Run(t *testing.T, config *Config) {
 		t.Run("RemoveStoredSubscription", func(t *testing.T) {
 			RemoveStoredSubscriptionTest(t, config, "strdsub/5")
 		})
+
+		t.Run("CleanSessionDiscard", func(t *testing.T) {
+			CleanSessionDiscardTest(t, config, "strdsub/6")
+		})
 	}
 
 	if config.OfflineSubscriptions {
@@ -344,6 +393,20 @@ func Run(t *testing.T, config *Config) {
 		})
 	}
 
+	if config.SharedSubscriptions {
+		t.Run("SharedSubscriptionQOS0", func(t *testing.T) {
+			SharedSubscriptionTest(t, config, "shared/1", 0)
+		})
+
+		t.Run("SharedSubscriptionQOS1", func(t *testing.T) {
+			SharedSubscriptionTest(t, config, "shared/2", 1)
+		})
+
+		t.Run("SharedSubscriptionGroups", func(t *testing.T) {
+			SharedSubscriptionGroupsTest(t, config, "shared/3")
+		})
+	}
+
 	if config.RootSlashDistinction {
 		t.Run("RootSlashDistinction", func(t *testing.T) {
 			RootSlashDistinctionTest(t, config, "rootslash")
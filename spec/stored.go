@@ -15,6 +15,8 @@ import (
 // PublishResendQOS1Test tests the broker for properly retrying QOS1 publish
 // packets.
 func PublishResendQOS1Test(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	id := config.clientID()
 
 	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
@@ -86,6 +88,8 @@ func PublishResendQOS1Test(t *testing.T, config *Config, topic string) {
 // PublishResendQOS2Test tests the broker for properly retrying QOS2 Publish
 // packets.
 func PublishResendQOS2Test(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	id := config.clientID()
 
 	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
@@ -169,6 +173,8 @@ func PublishResendQOS2Test(t *testing.T, config *Config, topic string) {
 // PubrelResendQOS2Test tests the broker for properly retrying QOS2 Pubrel
 // packets.
 func PubrelResendQOS2Test(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	id := config.clientID()
 
 	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
@@ -251,9 +257,162 @@ func PubrelResendQOS2Test(t *testing.T, config *Config, topic string) {
 	assert.NoError(t, err)
 }
 
+// PublishResendOrderTest tests the broker for redelivering unacknowledged
+// packets in their original order before new messages. Messages queued while
+// the client is offline are only tested if offline subscriptions are enabled.
+func PublishResendOrderTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
+	id := config.clientID()
+
+	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
+
+	username, password := config.usernamePassword()
+
+	connect := packet.NewConnect()
+	connect.CleanSession = false
+	connect.ClientID = id
+	connect.Username = username
+	connect.Password = password
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: topic, QOS: 2},
+	}
+
+	publishOut1 := packet.NewPublish()
+	publishOut1.ID = 2
+	publishOut1.Message.Topic = topic
+	publishOut1.Message.Payload = []byte("1")
+	publishOut1.Message.QOS = 1
+
+	pubackOut1 := packet.NewPuback()
+	pubackOut1.ID = 2
+
+	publishOut2 := packet.NewPublish()
+	publishOut2.ID = 3
+	publishOut2.Message.Topic = topic
+	publishOut2.Message.Payload = []byte("2")
+	publishOut2.Message.QOS = 2
+
+	pubrelOut2 := packet.NewPubrel()
+	pubrelOut2.ID = 3
+
+	pubcompOut2 := packet.NewPubcomp()
+	pubcompOut2.ID = 3
+
+	publishOut3 := packet.NewPublish()
+	publishOut3.ID = 4
+	publishOut3.Message.Topic = topic
+	publishOut3.Message.Payload = []byte("3")
+	publishOut3.Message.QOS = 1
+
+	pubackOut3 := packet.NewPuback()
+	pubackOut3.ID = 4
+
+	publishIn1 := packet.NewPublish()
+	publishIn1.ID = 1
+	publishIn1.Message.Topic = topic
+	publishIn1.Message.Payload = []byte("1")
+	publishIn1.Message.QOS = 1
+
+	publishIn2 := packet.NewPublish()
+	publishIn2.ID = 2
+	publishIn2.Message.Topic = topic
+	publishIn2.Message.Payload = []byte("2")
+	publishIn2.Message.QOS = 2
+
+	pubrecIn2 := packet.NewPubrec()
+	pubrecIn2.ID = 2
+
+	pubrelIn2 := packet.NewPubrel()
+	pubrelIn2.ID = 2
+
+	publishIn3 := packet.NewPublish()
+	publishIn3.ID = 3
+	publishIn3.Message.Topic = topic
+	publishIn3.Message.Payload = []byte("3")
+	publishIn3.Message.QOS = 1
+
+	publishIn4 := packet.NewPublish()
+	publishIn4.ID = 4
+	publishIn4.Message.Topic = topic
+	publishIn4.Message.Payload = []byte("4")
+	publishIn4.Message.QOS = 1
+
+	disconnect := packet.NewDisconnect()
+
+	conn1, err := transport.Dial(config.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn1)
+
+	err = flow.New().
+		Send(connect).
+		Skip(&packet.Connack{}).
+		Send(subscribe).
+		Skip(&packet.Suback{}).
+		Send(publishOut1).
+		Receive(pubackOut1, publishIn1).
+		Send(publishOut2).
+		Skip(&packet.Pubrec{}).
+		Send(pubrelOut2).
+		Receive(pubcompOut2, publishIn2).
+		Send(pubrecIn2).
+		Receive(pubrelIn2).
+		Send(publishOut3).
+		Receive(pubackOut3, publishIn3).
+		Close().
+		Test(conn1)
+	assert.NoError(t, err)
+
+	time.Sleep(config.ProcessWait)
+
+	// queue new message
+	if config.OfflineSubscriptions {
+		publisher := client.New()
+
+		cf, err := publisher.Connect(client.NewConfig(config.URL))
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		pf, err := publisher.Publish(topic, []byte("4"), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+
+		err = publisher.Disconnect()
+		assert.NoError(t, err)
+	}
+
+	conn2, err := transport.Dial(config.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn2)
+
+	publishIn1.Dup = true
+	publishIn3.Dup = true
+
+	f := flow.New().
+		Send(connect).
+		Skip(&packet.Connack{}).
+		Receive(publishIn1).
+		Receive(pubrelIn2).
+		Receive(publishIn3)
+
+	if config.OfflineSubscriptions {
+		f.Receive(publishIn4)
+	}
+
+	err = f.Send(disconnect).
+		Close().
+		Test(conn2)
+	assert.NoError(t, err)
+}
+
 // StoredSubscriptionsTest tests the broker for properly handling stored
 // subscriptions.
 func StoredSubscriptionsTest(t *testing.T, config *Config, topic string, qos packet.QOS) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -313,6 +472,8 @@ func StoredSubscriptionsTest(t *testing.T, config *Config, topic string, qos pac
 // CleanStoredSubscriptionsTest tests the broker for properly clearing stored
 // subscriptions.
 func CleanStoredSubscriptionsTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
@@ -360,9 +521,88 @@ func CleanStoredSubscriptionsTest(t *testing.T, config *Config, topic string) {
 	assert.NoError(t, err)
 }
 
+// CleanSessionDiscardTest tests the broker for discarding a stored session
+// once a clean session with the same client id has ended.
+func CleanSessionDiscardTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
+	id := config.clientID()
+
+	options := client.NewConfigWithClientID(config.URL, id)
+	options.CleanSession = false
+
+	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+
+	subscriber := client.New()
+
+	cf, err := subscriber.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	sf, err := subscriber.Subscribe(topic, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.Equal(t, []packet.QOS{1}, sf.ReturnCodes())
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+
+	options.CleanSession = true
+
+	cleaner := client.New()
+
+	cf, err = cleaner.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	err = cleaner.Disconnect()
+	assert.NoError(t, err)
+
+	time.Sleep(config.ProcessWait)
+
+	publisher := client.New()
+
+	cf, err = publisher.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	pf, err := publisher.Publish(topic, testPayload, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	err = publisher.Disconnect()
+	assert.NoError(t, err)
+
+	nonReceiver := client.New()
+	nonReceiver.Callback = func(msg *packet.Message, err error) error {
+		assert.Fail(t, "should not be called")
+		return nil
+	}
+
+	options.CleanSession = false
+
+	cf, err = nonReceiver.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	time.Sleep(config.NoMessageWait)
+
+	err = nonReceiver.Disconnect()
+	assert.NoError(t, err)
+}
+
 // RemoveStoredSubscriptionTest tests the broker for properly removing stored
 // subscriptions.
 func RemoveStoredSubscriptionTest(t *testing.T, config *Config, topic string) {
+	config.report(t)
+
 	id := config.clientID()
 
 	options := client.NewConfigWithClientID(config.URL, id)
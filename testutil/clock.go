@@ -0,0 +1,122 @@
+package testutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock is a fake clock that only advances when Advance is called.
+type Clock struct {
+	now    time.Time
+	timers []*timer
+	mutex  sync.Mutex
+}
+
+type timer struct {
+	at time.Time
+	fn func()
+}
+
+// NewClock returns a new Clock that starts at the specified time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now: now,
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Advance will move the clock forward by the specified duration and fire all
+// timers that expire in the meantime in order.
+func (c *Clock) Advance(d time.Duration) {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// advance time
+	c.now = c.now.Add(d)
+
+	// collect expired timers
+	var expired []*timer
+	var pending []*timer
+	for _, t := range c.timers {
+		if !t.at.After(c.now) {
+			expired = append(expired, t)
+		} else {
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+
+	// release mutex
+	c.mutex.Unlock()
+
+	// sort timers
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].at.Before(expired[j].at)
+	})
+
+	// fire timers
+	for _, t := range expired {
+		t.fn()
+	}
+}
+
+// After returns a channel that receives the current time once the clock has
+// been advanced by the specified duration.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+
+	c.afterFunc(d, func() {
+		ch <- c.Now()
+	})
+
+	return ch
+}
+
+func (c *Clock) afterFunc(d time.Duration, fn func()) *timer {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// prepare timer
+	t := &timer{
+		at: c.now.Add(d),
+		fn: fn,
+	}
+
+	// fire immediately if expired
+	if d <= 0 {
+		c.mutex.Unlock()
+		fn()
+		return t
+	}
+
+	// add timer
+	c.timers = append(c.timers, t)
+
+	// release mutex
+	c.mutex.Unlock()
+
+	return t
+}
+
+func (c *Clock) stop(t *timer) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// remove timer
+	for i, tt := range c.timers {
+		if tt == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package testutil wires brokers and clients over in-memory connections to
+// test MQTT flows hermetically.
+package testutil
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// ErrBrokerClosed is returned by Dial if the broker has been closed.
+var ErrBrokerClosed = errors.New("broker closed")
+
+// A carrier is an in-memory stream that evaluates read deadlines against an
+// optional fake clock.
+type carrier struct {
+	net.Conn
+
+	clock *Clock
+	timer *timer
+	mutex sync.Mutex
+}
+
+// SetReadDeadline implements the transport.Carrier interface. If a clock is
+// set, the deadline is converted to a duration relative to the current time
+// and expires once the clock has been advanced by that duration.
+func (c *carrier) SetReadDeadline(t time.Time) error {
+	// use real deadlines without a clock
+	if c.clock == nil {
+		return c.Conn.SetReadDeadline(t)
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// stop existing timer
+	if c.timer != nil {
+		c.clock.stop(c.timer)
+		c.timer = nil
+	}
+
+	// clear deadline
+	err := c.Conn.SetReadDeadline(time.Time{})
+	if err != nil || t.IsZero() {
+		return err
+	}
+
+	// expire deadline on the clock
+	c.timer = c.clock.afterFunc(time.Until(t), func() {
+		_ = c.Conn.SetReadDeadline(time.Now())
+	})
+
+	return nil
+}
+
+// A Conn is an in-memory connection returned by Pipe.
+type Conn struct {
+	*transport.BaseConn
+
+	conn net.Conn
+}
+
+// LocalAddr returns the local address of the pipe.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the pipe.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Pipe returns two connected in-memory connections. If a clock is provided,
+// read timeouts expire when the clock is advanced instead of in real time.
+func Pipe(clock *Clock) (*Conn, *Conn) {
+	a, b := net.Pipe()
+
+	return newConn(a, clock), newConn(b, clock)
+}
+
+func newConn(conn net.Conn, clock *Clock) *Conn {
+	return &Conn{
+		BaseConn: transport.NewBaseConn(&carrier{
+			Conn:  conn,
+			clock: clock,
+		}, 0),
+		conn: conn,
+	}
+}
+
+// A Broker runs an engine that accepts in-memory connections.
+type Broker struct {
+	// The engine handling the connections.
+	Engine *broker.Engine
+
+	// The backend used by the engine.
+	Backend broker.Backend
+
+	// The clock used for read timeouts or nil.
+	Clock *Clock
+
+	closed bool
+	mutex  sync.Mutex
+}
+
+// NewBroker returns a new Broker that uses the specified backend. A new
+// MemoryBackend is used if the backend is nil. The clock is optional.
+func NewBroker(backend broker.Backend, clock *Clock) *Broker {
+	// create default backend
+	if backend == nil {
+		backend = broker.NewMemoryBackend()
+	}
+
+	return &Broker{
+		Engine:  broker.NewEngine(backend),
+		Backend: backend,
+		Clock:   clock,
+	}
+}
+
+// Dial implements the client.Dialer interface and returns a new in-memory
+// connection to the broker. The url is ignored.
+func (b *Broker) Dial(_ string) (transport.Conn, error) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// check if closed
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	// create pipe
+	local, remote := Pipe(b.Clock)
+
+	// handle remote end
+	if !b.Engine.Handle(remote) {
+		return nil, ErrBrokerClosed
+	}
+
+	return local, nil
+}
+
+// Config returns a client config that connects to the broker.
+func (b *Broker) Config(clientID string) *client.Config {
+	config := client.NewConfigWithClientID("tcp://testutil", clientID)
+	config.Dialer = b
+
+	return config
+}
+
+// Connect returns a new client that is connected to the broker using the
+// specified config.
+func (b *Broker) Connect(config *client.Config) (*client.Client, error) {
+	// create client
+	c := client.New()
+
+	// connect client
+	cf, err := c.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for acknowledgement
+	err = cf.Wait(10 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close will close the engine and all connected clients.
+func (b *Broker) Close() {
+	// acquire mutex
+	b.mutex.Lock()
+	b.closed = true
+	b.mutex.Unlock()
+
+	// close backend if possible
+	if closer, ok := b.Backend.(broker.Closer); ok {
+		closer.Close(10 * time.Second)
+	}
+
+	// close engine
+	b.Engine.Close()
+}
@@ -0,0 +1,114 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Now()
+	clock := NewClock(start)
+
+	ch := clock.After(time.Second)
+
+	clock.Advance(500 * time.Millisecond)
+
+	select {
+	case <-ch:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+
+	assert.Equal(t, start.Add(time.Second), <-ch)
+	assert.Equal(t, start.Add(time.Second), clock.Now())
+}
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe(nil)
+
+	go func() {
+		_ = a.Send(packet.NewPingreq(), false)
+	}()
+
+	pkt, err := b.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PINGREQ, pkt.Type())
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, b.Close())
+}
+
+func TestBrokerPublishSubscribe(t *testing.T) {
+	broker := NewBroker(nil, nil)
+	defer broker.Close()
+
+	received := make(chan *packet.Message, 1)
+
+	subscriber, err := broker.Connect(broker.Config("subscriber"))
+	assert.NoError(t, err)
+
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	sf, err := subscriber.Subscribe("foo", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(time.Second))
+
+	publisher, err := broker.Connect(broker.Config("publisher"))
+	assert.NoError(t, err)
+
+	pf, err := publisher.Publish("foo", []byte("bar"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(time.Second))
+
+	msg := <-received
+	assert.Equal(t, "foo", msg.Topic)
+	assert.Equal(t, []byte("bar"), msg.Payload)
+
+	assert.NoError(t, publisher.Disconnect())
+	assert.NoError(t, subscriber.Disconnect())
+}
+
+func TestBrokerKeepAliveTimeout(t *testing.T) {
+	clock := NewClock(time.Now())
+
+	broker := NewBroker(nil, clock)
+	defer broker.Close()
+
+	conn, err := broker.Dial("")
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.KeepAlive = 1
+
+	err = conn.Send(connect, false)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNACK, pkt.Type())
+
+	clock.Advance(2 * time.Second)
+
+	pkt, err = conn.Receive()
+	assert.Error(t, err)
+	assert.Nil(t, pkt)
+}
+
+func TestBrokerClosed(t *testing.T) {
+	broker := NewBroker(nil, nil)
+	broker.Close()
+
+	conn, err := broker.Dial("")
+	assert.Equal(t, ErrBrokerClosed, err)
+	assert.Nil(t, conn)
+}
@@ -0,0 +1,177 @@
+package topic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type renderNode struct {
+	name     string
+	values   int
+	total    int
+	children []*renderNode
+}
+
+// Render will write the tree as indented text to the supplied writer. Every
+// line lists a segment followed by the number of values stored at the topic
+// and the number of values stored in the whole subtree, e.g. "bar [1/3]". If
+// a prefix is given only the subtree of the topic is written. Segments are
+// sorted which makes the output stable for equal trees.
+func (t *Tree) Render(w io.Writer, prefix string) error {
+	// render roots
+	for _, root := range t.collectRender(prefix) {
+		err := renderText(w, root, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RenderDOT will write the tree as a Graphviz DOT graph to the supplied
+// writer. Nodes are labeled like the lines written by Render.
+func (t *Tree) RenderDOT(w io.Writer, prefix string) error {
+	// write header
+	_, err := io.WriteString(w, "digraph topics {\n")
+	if err != nil {
+		return err
+	}
+
+	// render roots
+	id := 0
+	for _, root := range t.collectRender(prefix) {
+		_, err = renderDOT(w, root, &id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write footer
+	_, err = io.WriteString(w, "}\n")
+
+	return err
+}
+
+func (t *Tree) collectRender(prefix string) []*renderNode {
+	// split prefix
+	var segments []string
+	if prefix != "" {
+		segments = strings.Split(prefix, t.Separator)
+	}
+
+	// collect roots
+	var roots []*renderNode
+	for segment, s := range t.load() {
+		// check first segment
+		if len(segments) > 0 && segment != segments[0] {
+			continue
+		}
+
+		// collect shard
+		s.mutex.RLock()
+		root := t.collectPrefix(segment, s.node, segments)
+		s.mutex.RUnlock()
+
+		// add root
+		if root != nil {
+			roots = append(roots, root)
+		}
+	}
+
+	// sort roots
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].name < roots[j].name
+	})
+
+	return roots
+}
+
+func (t *Tree) collectPrefix(segment string, node *node, segments []string) *renderNode {
+	// walk prefix
+	name := segment
+	for i := 1; i < len(segments); i++ {
+		child, ok := node.children[segments[i]]
+		if !ok {
+			return nil
+		}
+
+		node = child
+		name += t.Separator + segments[i]
+	}
+
+	return collectNode(name, node)
+}
+
+func collectNode(name string, node *node) *renderNode {
+	// prepare node
+	rn := &renderNode{
+		name:   name,
+		values: len(node.values),
+		total:  len(node.values),
+	}
+
+	// collect children
+	for segment, child := range node.children {
+		rc := collectNode(segment, child)
+		rn.children = append(rn.children, rc)
+		rn.total += rc.total
+	}
+
+	// sort children
+	sort.Slice(rn.children, func(i, j int) bool {
+		return rn.children[i].name < rn.children[j].name
+	})
+
+	return rn
+}
+
+func (n *renderNode) label() string {
+	return fmt.Sprintf("%s [%d/%d]", n.name, n.values, n.total)
+}
+
+func renderText(w io.Writer, node *renderNode, depth int) error {
+	// write line
+	_, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), node.label())
+	if err != nil {
+		return err
+	}
+
+	// render children
+	for _, child := range node.children {
+		err = renderText(w, child, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renderDOT(w io.Writer, node *renderNode, id *int) (int, error) {
+	// write node
+	self := *id
+	*id++
+	_, err := fmt.Fprintf(w, "  n%d [label=%q];\n", self, node.label())
+	if err != nil {
+		return 0, err
+	}
+
+	// render children
+	for _, child := range node.children {
+		cid, err := renderDOT(w, child, id)
+		if err != nil {
+			return 0, err
+		}
+
+		// write edge
+		_, err = fmt.Fprintf(w, "  n%d -> n%d;\n", self, cid)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return self, nil
+}
@@ -0,0 +1,62 @@
+package topic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeRender(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo/bar", 1)
+	tree.Add("foo/bar", 2)
+	tree.Add("foo/+/qux", 3)
+	tree.Add("#", 4)
+
+	var buf bytes.Buffer
+	err := tree.Render(&buf, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "# [1/1]\n"+
+		"foo [0/3]\n"+
+		"  + [0/1]\n"+
+		"    qux [1/1]\n"+
+		"  bar [2/2]\n", buf.String())
+
+	buf.Reset()
+	err = tree.Render(&buf, "foo/+")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo/+ [0/1]\n"+
+		"  qux [1/1]\n", buf.String())
+
+	buf.Reset()
+	err = tree.Render(&buf, "foo/baz")
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestTreeRenderDOT(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo/bar", 1)
+	tree.Add("foo/baz", 2)
+	tree.Add("qux", 3)
+
+	var buf bytes.Buffer
+	err := tree.RenderDOT(&buf, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "digraph topics {\n"+
+		"  n0 [label=\"foo [0/2]\"];\n"+
+		"  n1 [label=\"bar [1/1]\"];\n"+
+		"  n0 -> n1;\n"+
+		"  n2 [label=\"baz [1/1]\"];\n"+
+		"  n0 -> n2;\n"+
+		"  n3 [label=\"qux [1/1]\"];\n"+
+		"}\n", buf.String())
+
+	buf.Reset()
+	err = tree.RenderDOT(&buf, "foo/bar")
+	assert.NoError(t, err)
+	assert.Equal(t, "digraph topics {\n"+
+		"  n0 [label=\"foo/bar [1/1]\"];\n"+
+		"}\n", buf.String())
+}
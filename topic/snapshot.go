@@ -0,0 +1,127 @@
+package topic
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrUnsupportedSnapshot is returned by Import if the snapshot has been written
+// in an unknown format version.
+var ErrUnsupportedSnapshot = errors.New("unsupported snapshot version")
+
+// snapshotVersion is the current version of the snapshot format.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int             `json:"version"`
+	Entries []snapshotEntry `json:"entries"`
+}
+
+type snapshotEntry struct {
+	Topic  string   `json:"topic"`
+	Values [][]byte `json:"values"`
+}
+
+// Export will write a JSON snapshot of all topics and their values to the
+// supplied writer. The supplied function is used to serialize the values.
+// Entries are sorted by topic and values keep their order, which makes the
+// output stable for equal trees.
+func (t *Tree) Export(w io.Writer, encode func(interface{}) ([]byte, error)) error {
+	// prepare snapshot
+	snap := snapshot{
+		Version: snapshotVersion,
+		Entries: []snapshotEntry{},
+	}
+
+	// collect entries
+	for segment, s := range t.load() {
+		s.mutex.RLock()
+		err := t.export(&snap, []string{segment}, s.node, encode)
+		s.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	// sort entries
+	sort.Slice(snap.Entries, func(i, j int) bool {
+		return snap.Entries[i].Topic < snap.Entries[j].Topic
+	})
+
+	return json.NewEncoder(w).Encode(snap)
+}
+
+func (t *Tree) export(snap *snapshot, segments []string, node *node, encode func(interface{}) ([]byte, error)) error {
+	// add entry for values
+	if len(node.values) > 0 {
+		entry := snapshotEntry{
+			Topic:  strings.Join(segments, t.Separator),
+			Values: make([][]byte, 0, len(node.values)),
+		}
+
+		// encode values
+		for _, value := range node.values {
+			data, err := encode(value)
+			if err != nil {
+				return err
+			}
+
+			entry.Values = append(entry.Values, data)
+		}
+
+		snap.Entries = append(snap.Entries, entry)
+	}
+
+	// export children
+	for segment, child := range node.children {
+		err := t.export(snap, append(segments[:len(segments):len(segments)], segment), child, encode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import will read a snapshot written by Export from the supplied reader and
+// add all values to the tree. The supplied function is used to deserialize the
+// values. The tree is not changed if the snapshot cannot be read. Existing
+// values are retained, call Reset beforehand to fully restore a snapshot.
+func (t *Tree) Import(r io.Reader, decode func([]byte) (interface{}, error)) error {
+	// read snapshot
+	var snap snapshot
+	err := json.NewDecoder(r).Decode(&snap)
+	if err != nil {
+		return err
+	}
+
+	// check version
+	if snap.Version != snapshotVersion {
+		return ErrUnsupportedSnapshot
+	}
+
+	// decode all values
+	values := make([][]interface{}, len(snap.Entries))
+	for i, entry := range snap.Entries {
+		for _, data := range entry.Values {
+			value, err := decode(data)
+			if err != nil {
+				return err
+			}
+
+			values[i] = append(values[i], value)
+		}
+	}
+
+	// add values
+	for i, entry := range snap.Entries {
+		for _, value := range values[i] {
+			t.Add(entry.Topic, value)
+		}
+	}
+
+	return nil
+}
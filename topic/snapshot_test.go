@@ -0,0 +1,71 @@
+package topic
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeString(value interface{}) ([]byte, error) {
+	return []byte(value.(string)), nil
+}
+
+func decodeString(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func TestTreeExportImport(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo/bar", "a")
+	tree.Add("foo/bar", "b")
+	tree.Add("foo/#", "c")
+	tree.Add("baz", "d")
+
+	var buf bytes.Buffer
+	err := tree.Export(&buf, encodeString)
+	assert.NoError(t, err)
+
+	// stable output
+	var buf2 bytes.Buffer
+	err = tree.Export(&buf2, encodeString)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String(), buf2.String())
+
+	restored := NewTree()
+	err = restored.Import(&buf, decodeString)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, restored.Count())
+	assert.Equal(t, []interface{}{"a", "b"}, restored.Get("foo/bar"))
+	assert.Equal(t, []interface{}{"c"}, restored.Get("foo/#"))
+	assert.Equal(t, []interface{}{"d"}, restored.Get("baz"))
+}
+
+func TestTreeExportError(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo", "a")
+
+	err := tree.Export(&bytes.Buffer{}, func(interface{}) ([]byte, error) {
+		return nil, errors.New("foo")
+	})
+	assert.Error(t, err)
+}
+
+func TestTreeImportErrors(t *testing.T) {
+	tree := NewTree()
+
+	err := tree.Import(strings.NewReader(`{"version":2,"entries":[]}`), decodeString)
+	assert.Equal(t, ErrUnsupportedSnapshot, err)
+
+	err = tree.Import(strings.NewReader(`{`), decodeString)
+	assert.Error(t, err)
+
+	err = tree.Import(strings.NewReader(`{"version":1,"entries":[{"topic":"foo","values":["YQ=="]}]}`), func([]byte) (interface{}, error) {
+		return nil, errors.New("foo")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, tree.Count())
+}
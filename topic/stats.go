@@ -0,0 +1,131 @@
+package topic
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelStats describes a single level of the tree.
+type LevelStats struct {
+	// The number of nodes on this level.
+	Nodes int
+
+	// The number of values stored on this level.
+	Values int
+}
+
+// Stats describes the shape and usage of a tree.
+type Stats struct {
+	// The number of first level shards.
+	Shards int
+
+	// The total number of nodes.
+	Nodes int
+
+	// The total number of stored values.
+	Values int
+
+	// The nodes and values per level. The first entry describes the first
+	// segment of the stored topics.
+	Levels []LevelStats
+
+	// The number of calls to Match since the tree has been created.
+	Matches uint64
+}
+
+// FilterStats describes the usage of a single stored topic.
+type FilterStats struct {
+	// The stored topic.
+	Topic string
+
+	// The number of values stored for the topic.
+	Values int
+
+	// The number of times the topic has been matched.
+	Hits uint64
+}
+
+// Stats will return statistics about the current shape of the tree.
+func (t *Tree) Stats() Stats {
+	// prepare stats
+	stats := Stats{
+		Matches: atomic.LoadUint64(&t.matches),
+	}
+
+	// collect stats from all shards
+	for _, s := range t.load() {
+		s.mutex.RLock()
+		t.stats(&stats, 0, s.node)
+		s.mutex.RUnlock()
+
+		stats.Shards++
+	}
+
+	return stats
+}
+
+func (t *Tree) stats(stats *Stats, level int, node *node) {
+	// grow levels
+	if len(stats.Levels) <= level {
+		stats.Levels = append(stats.Levels, LevelStats{})
+	}
+
+	// count node
+	stats.Nodes++
+	stats.Values += len(node.values)
+	stats.Levels[level].Nodes++
+	stats.Levels[level].Values += len(node.values)
+
+	// count children
+	for _, child := range node.children {
+		t.stats(stats, level+1, child)
+	}
+}
+
+// Hot will return the stored topics that have been matched most often, sorted
+// by descending hits. At most n topics are returned, a negative value returns
+// all topics that have been matched at least once.
+func (t *Tree) Hot(n int) []FilterStats {
+	// collect filters
+	var list []FilterStats
+	for segment, s := range t.load() {
+		s.mutex.RLock()
+		list = t.hot(list, []string{segment}, s.node)
+		s.mutex.RUnlock()
+	}
+
+	// sort by hits and topic
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Hits != list[j].Hits {
+			return list[i].Hits > list[j].Hits
+		}
+
+		return list[i].Topic < list[j].Topic
+	})
+
+	// limit list
+	if n >= 0 && len(list) > n {
+		list = list[:n]
+	}
+
+	return list
+}
+
+func (t *Tree) hot(list []FilterStats, segments []string, node *node) []FilterStats {
+	// add node if matched
+	if hits := atomic.LoadUint64(&node.hits); hits > 0 && len(node.values) > 0 {
+		list = append(list, FilterStats{
+			Topic:  strings.Join(segments, t.Separator),
+			Values: len(node.values),
+			Hits:   hits,
+		})
+	}
+
+	// check children
+	for segment, child := range node.children {
+		list = t.hot(list, append(segments[:len(segments):len(segments)], segment), child)
+	}
+
+	return list
+}
@@ -0,0 +1,49 @@
+package topic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeStats(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo/bar", 1)
+	tree.Add("foo/bar", 2)
+	tree.Add("foo/baz/qux", 3)
+	tree.Add("#", 4)
+
+	tree.Match("foo/bar")
+	tree.Match("foo/baz")
+
+	assert.Equal(t, Stats{
+		Shards: 2,
+		Nodes:  5,
+		Values: 4,
+		Levels: []LevelStats{
+			{Nodes: 2, Values: 1},
+			{Nodes: 2, Values: 2},
+			{Nodes: 1, Values: 1},
+		},
+		Matches: 2,
+	}, tree.Stats())
+}
+
+func TestTreeHot(t *testing.T) {
+	tree := NewTree()
+	tree.Add("foo/bar", 1)
+	tree.Add("foo/+", 2)
+	tree.Add("foo/#", 3)
+	tree.Add("baz", 4)
+
+	tree.Match("foo/bar")
+	tree.Match("foo/baz")
+	tree.Match("foo/bar")
+
+	assert.Equal(t, []FilterStats{
+		{Topic: "foo/#", Values: 1, Hits: 3},
+		{Topic: "foo/+", Values: 1, Hits: 3},
+	}, tree.Hot(2))
+
+	assert.Len(t, tree.Hot(-1), 3)
+}
@@ -63,3 +63,43 @@ func Parse(topic string, allowWildcards bool) (string, error) {
 func ContainsWildcards(topic string) bool {
 	return strings.Contains(topic, "+") || strings.Contains(topic, "#")
 }
+
+// Covers tests if all topics that match the filter are also matched by the
+// covering filter. Plain topics are treated as filters without wildcards. As
+// with subscriptions, wildcards in the first level of the covering filter do
+// not match topics that begin with a "$".
+func Covers(covering, filter string) bool {
+	// check system topics
+	if strings.HasPrefix(filter, "$") && (strings.HasPrefix(covering, "+") || strings.HasPrefix(covering, "#")) {
+		return false
+	}
+
+	// split to segments
+	a := strings.Split(covering, "/")
+	b := strings.Split(filter, "/")
+
+	// compare segments
+	for i, s := range a {
+		// multi level wildcards cover all remaining levels
+		if s == "#" {
+			return true
+		}
+
+		// check length
+		if i >= len(b) {
+			return false
+		}
+
+		// single level wildcards cover everything but multi level wildcards
+		if s == "+" && b[i] != "#" {
+			continue
+		}
+
+		// otherwise segments must be equal
+		if s != b[i] {
+			return false
+		}
+	}
+
+	return len(a) == len(b)
+}
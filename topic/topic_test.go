@@ -98,3 +98,33 @@ func TestTopicContainsWildcards(t *testing.T) {
 	assert.True(t, ContainsWildcards("topic/#"))
 	assert.False(t, ContainsWildcards("topic/hello"))
 }
+
+func TestCovers(t *testing.T) {
+	table := []struct {
+		covering string
+		filter   string
+		result   bool
+	}{
+		{"foo/bar", "foo/bar", true},
+		{"foo/bar", "foo/baz", false},
+		{"foo/bar", "foo", false},
+		{"foo", "foo/bar", false},
+		{"foo/+", "foo/bar", true},
+		{"foo/+", "foo/+", true},
+		{"foo/+", "foo/#", false},
+		{"foo/+", "foo/bar/baz", false},
+		{"foo/bar", "foo/+", false},
+		{"foo/#", "foo", true},
+		{"foo/#", "foo/bar/baz", true},
+		{"foo/#", "foo/+/#", true},
+		{"foo/+/#", "foo/#", false},
+		{"#", "foo/bar", true},
+		{"#", "$SYS/foo", false},
+		{"+/foo", "$SYS/foo", false},
+		{"$SYS/#", "$SYS/foo", true},
+	}
+
+	for _, item := range table {
+		assert.Equal(t, item.result, Covers(item.covering, item.filter), item.covering+" "+item.filter)
+	}
+}
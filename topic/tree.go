@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type node struct {
+	hits     uint64
 	children map[string]*node
 	values   []interface{}
 }
@@ -17,6 +19,12 @@ func newNode() *node {
 	}
 }
 
+func (n *node) hit() {
+	if len(n.values) > 0 {
+		atomic.AddUint64(&n.hits, 1)
+	}
+}
+
 func (n *node) removeValue(value interface{}) {
 	for i, v := range n.values {
 		if v == value {
@@ -46,8 +54,22 @@ func (n *node) string(i int) string {
 	return str
 }
 
+// A shard holds the subtree of a single first level segment.
+type shard struct {
+	node  *node
+	dead  bool
+	mutex sync.RWMutex
+}
+
 // A Tree implements a thread-safe topic tree.
+//
+// The tree is sharded by the first segment of a topic. Every shard is guarded
+// by its own lock so that operations on topics with different first segments
+// do not contend. The shard directory itself is replaced copy-on-write and read
+// without any locking.
 type Tree struct {
+	matches uint64
+
 	// The separator character. Default: "/"
 	Separator string
 
@@ -57,29 +79,136 @@ type Tree struct {
 	// The multi level wildcard character. Default "#"
 	WildcardSome string
 
-	root  *node
-	mutex sync.RWMutex
+	shards atomic.Value
+	mutex  sync.Mutex
 }
 
 // NewTree returns a new Tree.
 func NewTree() *Tree {
-	return &Tree{
+	t := &Tree{
 		Separator:    "/",
 		WildcardOne:  "+",
 		WildcardSome: "#",
+	}
+
+	t.shards.Store(map[string]*shard{})
+
+	return t
+}
+
+// load returns the current shard directory. The returned map must not be
+// modified.
+func (t *Tree) load() map[string]*shard {
+	return t.shards.Load().(map[string]*shard)
+}
+
+// shard returns the shard for the supplied segment and optionally creates it.
+func (t *Tree) shard(segment string, create bool) *shard {
+	// try to get existing shard
+	s, ok := t.load()[segment]
+	if ok || !create {
+		return s
+	}
+
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// check again
+	shards := t.load()
+	if s, ok := shards[segment]; ok {
+		return s
+	}
+
+	// copy directory
+	copied := make(map[string]*shard, len(shards)+1)
+	for k, v := range shards {
+		copied[k] = v
+	}
+
+	// add shard
+	s = &shard{node: newNode()}
+	copied[segment] = s
+
+	// publish directory
+	t.shards.Store(copied)
+
+	return s
+}
+
+// update runs the supplied function with the locked node of the shard for the
+// supplied segment. Shards that become empty are removed afterwards.
+func (t *Tree) update(segment string, create bool, fn func(*node)) {
+	for {
+		// get shard
+		s := t.shard(segment, create)
+		if s == nil {
+			return
+		}
+
+		// acquire mutex
+		s.mutex.Lock()
+
+		// retry if the shard has been removed concurrently
+		if s.dead {
+			s.mutex.Unlock()
+			continue
+		}
+
+		// run function
+		fn(s.node)
+		empty := len(s.node.values) == 0 && len(s.node.children) == 0
+
+		// release mutex
+		s.mutex.Unlock()
+
+		// remove empty shard
+		if empty {
+			t.collect(segment, s)
+		}
+
+		return
+	}
+}
+
+// collect removes the supplied shard from the directory if it is still empty.
+func (t *Tree) collect(segment string, s *shard) {
+	// acquire mutexes
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check shard
+	if s.dead || len(s.node.values) > 0 || len(s.node.children) > 0 {
+		return
+	}
 
-		root: newNode(),
+	// mark shard
+	s.dead = true
+
+	// copy directory without shard
+	shards := t.load()
+	copied := make(map[string]*shard, len(shards))
+	for k, v := range shards {
+		if k != segment {
+			copied[k] = v
+		}
 	}
+
+	// publish directory
+	t.shards.Store(copied)
 }
 
 // Add registers the value for the supplied topic. This function will
 // automatically grow the tree. If value already exists for the given topic it
 // will not be added again.
 func (t *Tree) Add(topic string, value interface{}) {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	segments := strings.Split(topic, t.Separator)
 
-	t.add(value, 0, strings.Split(topic, t.Separator), t.root)
+	t.update(segments[0], true, func(node *node) {
+		t.add(value, 1, segments, node)
+	})
 }
 
 func (t *Tree) add(value interface{}, i int, segments []string, node *node) {
@@ -110,10 +239,11 @@ func (t *Tree) add(value interface{}, i int, segments []string, node *node) {
 // Set sets the supplied value as the only value for the supplied topic. This
 // function will automatically grow the tree.
 func (t *Tree) Set(topic string, value interface{}) {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	segments := strings.Split(topic, t.Separator)
 
-	t.set(value, 0, strings.Split(topic, t.Separator), t.root)
+	t.update(segments[0], true, func(node *node) {
+		t.set(value, 1, segments, node)
+	})
 }
 
 func (t *Tree) set(value interface{}, i int, segments []string, node *node) {
@@ -137,10 +267,19 @@ func (t *Tree) set(value interface{}, i int, segments []string, node *node) {
 
 // Get gets the values from the topic that exactly matches the supplied topics.
 func (t *Tree) Get(topic string) []interface{} {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	segments := strings.Split(topic, t.Separator)
 
-	return t.get(0, strings.Split(topic, t.Separator), t.root)
+	// get shard
+	s := t.shard(segments[0], false)
+	if s == nil {
+		return nil
+	}
+
+	// acquire mutex
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return t.get(1, segments, s.node)
 }
 
 func (t *Tree) get(i int, segments []string, node *node) []interface{} {
@@ -162,19 +301,21 @@ func (t *Tree) get(i int, segments []string, node *node) []interface{} {
 // Remove un-registers the value from the supplied topic. This function will
 // automatically shrink the tree.
 func (t *Tree) Remove(topic string, value interface{}) {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	segments := strings.Split(topic, t.Separator)
 
-	t.remove(value, 0, strings.Split(topic, t.Separator), t.root)
+	t.update(segments[0], false, func(node *node) {
+		t.remove(value, 1, segments, node)
+	})
 }
 
 // Empty will unregister all values from the supplied topic. This function will
 // automatically shrink the tree.
 func (t *Tree) Empty(topic string) {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	segments := strings.Split(topic, t.Separator)
 
-	t.remove(nil, 0, strings.Split(topic, t.Separator), t.root)
+	t.update(segments[0], false, func(node *node) {
+		t.remove(nil, 1, segments, node)
+	})
 }
 
 func (t *Tree) remove(value interface{}, i int, segments []string, node *node) bool {
@@ -207,10 +348,11 @@ func (t *Tree) remove(value interface{}, i int, segments []string, node *node) b
 // Clear will unregister the supplied value from all topics. This function will
 // automatically shrink the tree.
 func (t *Tree) Clear(value interface{}) {
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
-
-	t.clear(value, t.root)
+	for segment := range t.load() {
+		t.update(segment, false, func(node *node) {
+			t.clear(value, node)
+		})
+	}
 }
 
 func (t *Tree) clear(value interface{}, node *node) bool {
@@ -232,11 +374,35 @@ func (t *Tree) clear(value interface{}, node *node) bool {
 // Note: In contrast to Search, Match does not respect wildcards in the query but
 // in the stored tree.
 func (t *Tree) Match(topic string) []interface{} {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	atomic.AddUint64(&t.matches, 1)
 
 	segments := strings.Split(topic, t.Separator)
-	values := t.match([]interface{}{}, 0, segments, t.root)
+	shards := t.load()
+	values := []interface{}{}
+
+	// add all values that match multiple levels
+	if s, ok := shards[t.WildcardSome]; ok {
+		s.mutex.RLock()
+		s.node.hit()
+		values = append(values, s.node.values...)
+		s.mutex.RUnlock()
+	}
+
+	// advance shard that matches a single level
+	if s, ok := shards[t.WildcardOne]; ok {
+		s.mutex.RLock()
+		values = t.match(values, 1, segments, s.node)
+		s.mutex.RUnlock()
+	}
+
+	// match first segment
+	if segments[0] != t.WildcardOne && segments[0] != t.WildcardSome {
+		if s, ok := shards[segments[0]]; ok {
+			s.mutex.RLock()
+			values = t.match(values, 1, segments, s.node)
+			s.mutex.RUnlock()
+		}
+	}
 
 	return t.clean(values)
 }
@@ -244,11 +410,13 @@ func (t *Tree) Match(topic string) []interface{} {
 func (t *Tree) match(result []interface{}, i int, segments []string, node *node) []interface{} {
 	// add all values to the result set that match multiple levels
 	if child, ok := node.children[t.WildcardSome]; ok {
+		child.hit()
 		result = append(result, child.values...)
 	}
 
 	// when finished add all values to the result set
 	if i == len(segments) {
+		node.hit()
 		return append(result, node.values...)
 	}
 
@@ -286,11 +454,32 @@ func (t *Tree) MatchFirst(topic string) interface{} {
 // Note: In contrast to Match, Search respects wildcards in the query but not in
 // the stored tree.
 func (t *Tree) Search(topic string) []interface{} {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
-
 	segments := strings.Split(topic, t.Separator)
-	values := t.search([]interface{}{}, 0, segments, t.root)
+	values := []interface{}{}
+
+	switch segments[0] {
+	case t.WildcardSome:
+		// search all shards
+		for _, s := range t.load() {
+			s.mutex.RLock()
+			values = t.search(values, 0, segments, s.node)
+			s.mutex.RUnlock()
+		}
+	case t.WildcardOne:
+		// advance all shards
+		for _, s := range t.load() {
+			s.mutex.RLock()
+			values = t.search(values, 1, segments, s.node)
+			s.mutex.RUnlock()
+		}
+	default:
+		// search matching shard
+		if s, ok := t.load()[segments[0]]; ok {
+			s.mutex.RLock()
+			values = t.search(values, 1, segments, s.node)
+			s.mutex.RUnlock()
+		}
+	}
 
 	return t.clean(values)
 }
@@ -361,10 +550,15 @@ func (t *Tree) clean(values []interface{}) []interface{} {
 // Count will count all stored values in the tree. It will not filter out
 // duplicate values and thus might return a different result to `len(All())`.
 func (t *Tree) Count() int {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	total := 0
+
+	for _, s := range t.load() {
+		s.mutex.RLock()
+		total += t.count(s.node)
+		s.mutex.RUnlock()
+	}
 
-	return t.count(t.root)
+	return total
 }
 
 func (t *Tree) count(node *node) int {
@@ -382,10 +576,15 @@ func (t *Tree) count(node *node) int {
 
 // All will return all stored values in the tree.
 func (t *Tree) All() []interface{} {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	values := []interface{}{}
+
+	for _, s := range t.load() {
+		s.mutex.RLock()
+		values = t.all(values, s.node)
+		s.mutex.RUnlock()
+	}
 
-	return t.clean(t.all([]interface{}{}, t.root))
+	return t.clean(values)
 }
 
 func (t *Tree) all(result []interface{}, node *node) []interface{} {
@@ -400,18 +599,32 @@ func (t *Tree) all(result []interface{}, node *node) []interface{} {
 
 // Reset will completely clear the tree.
 func (t *Tree) Reset() {
+	// acquire mutex
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	t.root = newNode()
+	// retire all shards
+	for _, s := range t.load() {
+		s.mutex.Lock()
+		s.dead = true
+		s.mutex.Unlock()
+	}
+
+	// publish empty directory
+	t.shards.Store(map[string]*shard{})
 }
 
 // String will return a string representation of the tree.
 func (t *Tree) String() string {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	str := ""
+
+	for segment, s := range t.load() {
+		s.mutex.RLock()
+		str += fmt.Sprintf("\n| '%s' => %s", segment, s.node.string(1))
+		s.mutex.RUnlock()
+	}
 
-	return fmt.Sprintf("topic.Tree:%s", t.root.string(0))
+	return fmt.Sprintf("topic.Tree:%s", str)
 }
 
 func contains(list []interface{}, value interface{}) bool {
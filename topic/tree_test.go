@@ -2,6 +2,7 @@ package topic
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,7 +13,7 @@ func TestTreeAdd(t *testing.T) {
 
 	tree.Add("foo/bar", 1)
 
-	assert.Equal(t, 1, tree.root.children["foo"].children["bar"].values[0])
+	assert.Equal(t, 1, tree.load()["foo"].node.children["bar"].values[0])
 }
 
 func TestTreeAddDuplicate(t *testing.T) {
@@ -21,7 +22,7 @@ func TestTreeAddDuplicate(t *testing.T) {
 	tree.Add("foo/bar", 1)
 	tree.Add("foo/bar", 1)
 
-	assert.Equal(t, 1, len(tree.root.children["foo"].children["bar"].values))
+	assert.Equal(t, 1, len(tree.load()["foo"].node.children["bar"].values))
 }
 
 func TestTreeSet(t *testing.T) {
@@ -29,7 +30,7 @@ func TestTreeSet(t *testing.T) {
 
 	tree.Set("foo/bar", 1)
 
-	assert.Equal(t, 1, tree.root.children["foo"].children["bar"].values[0])
+	assert.Equal(t, 1, tree.load()["foo"].node.children["bar"].values[0])
 }
 
 func TestTreeSetReplace(t *testing.T) {
@@ -38,7 +39,7 @@ func TestTreeSetReplace(t *testing.T) {
 	tree.Set("foo/bar", 1)
 	tree.Set("foo/bar", 2)
 
-	assert.Equal(t, 2, tree.root.children["foo"].children["bar"].values[0])
+	assert.Equal(t, 2, tree.load()["foo"].node.children["bar"].values[0])
 }
 
 func TestTreeGet(t *testing.T) {
@@ -55,7 +56,7 @@ func TestTreeRemove(t *testing.T) {
 	tree.Add("foo/bar", 1)
 	tree.Remove("foo/bar", 1)
 
-	assert.Equal(t, 0, len(tree.root.children))
+	assert.Equal(t, 0, len(tree.load()))
 }
 
 func TestTreeRemoveMissing(t *testing.T) {
@@ -64,7 +65,7 @@ func TestTreeRemoveMissing(t *testing.T) {
 	tree.Add("foo/bar", 1)
 	tree.Remove("bar/baz", 1)
 
-	assert.Equal(t, 1, len(tree.root.children))
+	assert.Equal(t, 1, len(tree.load()))
 }
 
 func TestTreeEmpty(t *testing.T) {
@@ -74,7 +75,7 @@ func TestTreeEmpty(t *testing.T) {
 	tree.Add("foo/bar", 2)
 	tree.Empty("foo/bar")
 
-	assert.Equal(t, 0, len(tree.root.children))
+	assert.Equal(t, 0, len(tree.load()))
 }
 
 func TestTreeClear(t *testing.T) {
@@ -84,7 +85,7 @@ func TestTreeClear(t *testing.T) {
 	tree.Add("foo/bar/baz", 1)
 	tree.Clear(1)
 
-	assert.Equal(t, 0, len(tree.root.children))
+	assert.Equal(t, 0, len(tree.load()))
 }
 
 func TestTreeMatchExact(t *testing.T) {
@@ -293,7 +294,7 @@ func TestTreeReset(t *testing.T) {
 	tree.Add("foo/bar", 1)
 	tree.Reset()
 
-	assert.Equal(t, 0, len(tree.root.children))
+	assert.Equal(t, 0, len(tree.load()))
 }
 
 func TestTreeString(t *testing.T) {
@@ -304,6 +305,52 @@ func TestTreeString(t *testing.T) {
 	assert.Equal(t, "topic.Tree:\n| 'foo' => 0\n|   'bar' => 1", tree.String())
 }
 
+func TestTreeShards(t *testing.T) {
+	tree := NewTree()
+
+	tree.Add("foo/bar", 1)
+	tree.Add("bar/foo", 2)
+	tree.Add("+/bar", 3)
+	tree.Add("#", 4)
+
+	assert.Equal(t, 4, len(tree.load()))
+	assert.Equal(t, []interface{}{4, 3, 1}, tree.Match("foo/bar"))
+	assert.Equal(t, []interface{}{4, 2}, tree.Match("bar/foo"))
+	assert.Equal(t, 4, tree.Count())
+
+	tree.Clear(4)
+	tree.Remove("bar/foo", 2)
+
+	assert.Equal(t, 2, len(tree.load()))
+}
+
+func TestTreeConcurrency(t *testing.T) {
+	tree := NewTree()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			topic := fmt.Sprintf("%d/bar", i%3)
+
+			for j := 0; j < 1000; j++ {
+				tree.Add(topic, i)
+				assert.Contains(t, tree.Match(topic), i)
+				tree.Remove(topic, i)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 0, tree.Count())
+	assert.Equal(t, 0, len(tree.load()))
+}
+
 func BenchmarkTreeAddSame(b *testing.B) {
 	tree := NewTree()
 
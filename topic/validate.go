@@ -0,0 +1,157 @@
+package topic
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// A Rule identifies a topic or filter validation rule.
+type Rule int
+
+// All available validation rules.
+const (
+	// The topic or filter must not be empty.
+	RuleZeroLength Rule = iota
+
+	// The topic or filter must not exceed 65535 bytes.
+	RuleTooLong
+
+	// The topic or filter must be valid UTF-8.
+	RuleInvalidUTF8
+
+	// The topic or filter must not contain the null character.
+	RuleNullCharacter
+
+	// The topic or filter must not contain empty segments.
+	RuleEmptySegment
+
+	// The topic must not contain any wildcards.
+	RuleWildcardInTopic
+
+	// The single level wildcard must occupy a whole segment.
+	RuleWildcardOneMidSegment
+
+	// The multi level wildcard must occupy a whole segment.
+	RuleWildcardSomeMidSegment
+
+	// The multi level wildcard must be the last segment.
+	RuleWildcardSomeNotLast
+)
+
+// String returns a description of the rule.
+func (r Rule) String() string {
+	switch r {
+	case RuleZeroLength:
+		return "zero length"
+	case RuleTooLong:
+		return "too long"
+	case RuleInvalidUTF8:
+		return "invalid utf-8"
+	case RuleNullCharacter:
+		return "null character"
+	case RuleEmptySegment:
+		return "empty segment"
+	case RuleWildcardInTopic:
+		return "wildcard in topic"
+	case RuleWildcardOneMidSegment:
+		return "'+' not occupying whole segment"
+	case RuleWildcardSomeMidSegment:
+		return "'#' not occupying whole segment"
+	case RuleWildcardSomeNotLast:
+		return "'#' not last segment"
+	}
+
+	return "unknown rule"
+}
+
+// A ValidationError is returned by ValidateTopic and ValidateFilter and
+// describes the violated rule and the byte offset at which it was detected.
+type ValidationError struct {
+	Rule   Rule
+	Offset int
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid topic: %s at offset %d", e.Rule.String(), e.Offset)
+}
+
+// ValidateTopic checks whether the supplied string is a valid topic name to
+// publish to. It will return a ValidationError describing the first violated
+// rule or nil.
+func ValidateTopic(topic string) error {
+	return validate(topic, false)
+}
+
+// ValidateFilter checks whether the supplied string is a valid topic filter to
+// subscribe to. It will return a ValidationError describing the first violated
+// rule or nil.
+func ValidateFilter(filter string) error {
+	return validate(filter, true)
+}
+
+func validate(str string, allowWildcards bool) error {
+	// check length
+	if len(str) == 0 {
+		return &ValidationError{Rule: RuleZeroLength}
+	} else if len(str) > 65535 {
+		return &ValidationError{Rule: RuleTooLong, Offset: 65535}
+	}
+
+	// check utf-8
+	if !utf8.ValidString(str) {
+		offset := 0
+		for offset < len(str) {
+			r, size := utf8.DecodeRuneInString(str[offset:])
+			if r == utf8.RuneError && size == 1 {
+				break
+			}
+
+			offset += size
+		}
+
+		return &ValidationError{Rule: RuleInvalidUTF8, Offset: offset}
+	}
+
+	// check all characters
+	start := 0
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case 0:
+			return &ValidationError{Rule: RuleNullCharacter, Offset: i}
+		case '/':
+			// check for empty segment
+			if i == start {
+				return &ValidationError{Rule: RuleEmptySegment, Offset: i}
+			}
+
+			start = i + 1
+		case '+', '#':
+			// check if wildcards are allowed
+			if !allowWildcards {
+				return &ValidationError{Rule: RuleWildcardInTopic, Offset: i}
+			}
+
+			// check if wildcard occupies the whole segment
+			if i != start || (i+1 < len(str) && str[i+1] != '/') {
+				if str[i] == '+' {
+					return &ValidationError{Rule: RuleWildcardOneMidSegment, Offset: i}
+				}
+
+				return &ValidationError{Rule: RuleWildcardSomeMidSegment, Offset: i}
+			}
+
+			// check if multi level wildcard is last
+			if str[i] == '#' && i != len(str)-1 {
+				return &ValidationError{Rule: RuleWildcardSomeNotLast, Offset: i}
+			}
+		}
+	}
+
+	// check for trailing empty segment
+	if start == len(str) {
+		return &ValidationError{Rule: RuleEmptySegment, Offset: len(str)}
+	}
+
+	return nil
+}
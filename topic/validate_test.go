@@ -0,0 +1,55 @@
+package topic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTopic(t *testing.T) {
+	assert.NoError(t, ValidateTopic("foo"))
+	assert.NoError(t, ValidateTopic("foo/bar/baz"))
+	assert.NoError(t, ValidateTopic("$SYS/foo"))
+
+	table := map[string]*ValidationError{
+		"":                         {Rule: RuleZeroLength},
+		strings.Repeat("a", 65536): {Rule: RuleTooLong, Offset: 65535},
+		"foo/\xff":                 {Rule: RuleInvalidUTF8, Offset: 4},
+		"foo\x00":                  {Rule: RuleNullCharacter, Offset: 3},
+		"/foo":                     {Rule: RuleEmptySegment, Offset: 0},
+		"foo//bar":                 {Rule: RuleEmptySegment, Offset: 4},
+		"foo/":                     {Rule: RuleEmptySegment, Offset: 4},
+		"foo/+":                    {Rule: RuleWildcardInTopic, Offset: 4},
+		"foo/#":                    {Rule: RuleWildcardInTopic, Offset: 4},
+	}
+
+	for topic, err := range table {
+		assert.Equal(t, err, ValidateTopic(topic), topic)
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	assert.NoError(t, ValidateFilter("foo"))
+	assert.NoError(t, ValidateFilter("#"))
+	assert.NoError(t, ValidateFilter("+"))
+	assert.NoError(t, ValidateFilter("foo/+/bar/#"))
+
+	table := map[string]*ValidationError{
+		"":          {Rule: RuleZeroLength},
+		"foo/b+":    {Rule: RuleWildcardOneMidSegment, Offset: 5},
+		"foo/+b":    {Rule: RuleWildcardOneMidSegment, Offset: 4},
+		"foo/b#":    {Rule: RuleWildcardSomeMidSegment, Offset: 5},
+		"foo/#/bar": {Rule: RuleWildcardSomeNotLast, Offset: 4},
+		"+//":       {Rule: RuleEmptySegment, Offset: 2},
+	}
+
+	for filter, err := range table {
+		assert.Equal(t, err, ValidateFilter(filter), filter)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := ValidateFilter("foo/#/bar")
+	assert.Equal(t, "invalid topic: '#' not last segment at offset 4", err.Error())
+}
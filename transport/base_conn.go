@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"errors"
 	"io"
 	"sync"
 	"time"
@@ -8,6 +9,10 @@ import (
 	"github.com/256dpi/gomqtt/packet"
 )
 
+// ErrClosed is returned by Receive if the connection has been closed while
+// the packet was delayed to respect the receive rate.
+var ErrClosed = errors.New("connection closed")
+
 // A Carrier is a generalized stream that can be used with BaseConn.
 type Carrier interface {
 	io.ReadWriteCloser
@@ -26,6 +31,15 @@ type BaseConn struct {
 	rMutex sync.Mutex
 
 	readTimeout time.Duration
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	lMutex sync.Mutex
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // NewBaseConn creates a new BaseConn using the specified Carrier.
@@ -33,6 +47,7 @@ func NewBaseConn(c Carrier, maxWriteDelay time.Duration) *BaseConn {
 	return &BaseConn{
 		carrier: c,
 		stream:  packet.NewStream(c, c, maxWriteDelay),
+		closed:  make(chan struct{}),
 	}
 }
 
@@ -76,6 +91,12 @@ func (c *BaseConn) Receive() (packet.Generic, error) {
 		return nil, err
 	}
 
+	// delay packet if rate is exceeded
+	err = c.limit()
+	if err != nil {
+		return nil, err
+	}
+
 	// reset timeout
 	err = c.resetTimeout()
 	if err != nil {
@@ -89,6 +110,11 @@ func (c *BaseConn) Receive() (packet.Generic, error) {
 // return an Error if there was an error while closing the underlying
 // connection.
 func (c *BaseConn) Close() error {
+	// stop waiting receives
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
@@ -115,6 +141,17 @@ func (c *BaseConn) SetReadLimit(limit int64) {
 	c.stream.Decoder.Limit = limit
 }
 
+// SetZeroCopy enables or disables zero copy decoding of publish payloads. If
+// enabled, payloads of received publish packets reference pooled buffers that
+// are owned by the packets until they are released or recycled. See
+// packet.Decoder.ZeroCopy for details.
+func (c *BaseConn) SetZeroCopy(enabled bool) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.ZeroCopy = enabled
+}
+
 // SetReadTimeout sets the maximum time that can pass between reads.
 // If no data is received in the set duration the connection will be closed
 // and Read returns an error.
@@ -125,6 +162,70 @@ func (c *BaseConn) SetReadTimeout(timeout time.Duration) {
 	_ = c.resetTimeout()
 }
 
+// SetReceiveRate sets the maximum number of packets per second that can be
+// received. If the rate is greater than zero, Receive will delay packets
+// that exceed the rate, which in turn slows down the sender. The burst
+// defines the number of packets that can be received without delay.
+func (c *BaseConn) SetReceiveRate(rate float64, burst int) {
+	c.lMutex.Lock()
+	defer c.lMutex.Unlock()
+
+	// ensure burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	// set limit and fill bucket
+	c.rate = rate
+	c.burst = float64(burst)
+	c.tokens = c.burst
+	c.last = time.Now()
+}
+
+func (c *BaseConn) limit() error {
+	c.lMutex.Lock()
+
+	// check rate
+	if c.rate <= 0 {
+		c.lMutex.Unlock()
+		return nil
+	}
+
+	// refill bucket
+	now := time.Now()
+	c.tokens += now.Sub(c.last).Seconds() * c.rate
+	if c.tokens > c.burst {
+		c.tokens = c.burst
+	}
+	c.last = now
+
+	// take token
+	c.tokens--
+
+	// get delay
+	var delay time.Duration
+	if c.tokens < 0 {
+		delay = time.Duration(-c.tokens / c.rate * float64(time.Second))
+	}
+
+	c.lMutex.Unlock()
+
+	// return immediately if no delay is required
+	if delay <= 0 {
+		return nil
+	}
+
+	// wait for token or close
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
 func (c *BaseConn) resetTimeout() error {
 	if c.readTimeout > 0 {
 		return c.carrier.SetReadDeadline(time.Now().Add(c.readTimeout))
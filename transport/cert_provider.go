@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrMissingCertificate is returned by a RotatingCertProvider if the fetch
+// function did not return a certificate.
+var ErrMissingCertificate = errors.New("missing certificate")
+
+// A CertProvider provides TLS material that may change over time, e.g. short
+// lived certificates issued by HashiCorp Vault or SPIFFE identity documents.
+// The methods are called for every handshake and should therefore return
+// cached values.
+type CertProvider interface {
+	// Certificate should return the current certificate.
+	Certificate() (*tls.Certificate, error)
+
+	// RootCAs should return the current pool of trusted certificate
+	// authorities or nil to use the system pool.
+	RootCAs() (*x509.CertPool, error)
+}
+
+// A RotatingCertProvider caches the TLS material returned by a fetch function
+// and fetches new material once a configured fraction of the certificates
+// lifetime has elapsed. If a fetch fails, the cached material is used until
+// the certificate expires.
+type RotatingCertProvider struct {
+	// The function called to fetch the certificate and an optional pool of
+	// trusted certificate authorities.
+	Fetch func() (*tls.Certificate, *x509.CertPool, error)
+
+	// The fraction of the certificate lifetime after which new material is
+	// fetched.
+	//
+	// Will default to 2/3.
+	RenewAfter float64
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	renew   time.Time
+	expires time.Time
+	mutex   sync.Mutex
+}
+
+// NewRotatingCertProvider returns a new RotatingCertProvider that uses the
+// specified fetch function.
+func NewRotatingCertProvider(fetch func() (*tls.Certificate, *x509.CertPool, error)) *RotatingCertProvider {
+	return &RotatingCertProvider{
+		Fetch:      fetch,
+		RenewAfter: 2.0 / 3.0,
+		Now:        time.Now,
+	}
+}
+
+// Certificate implements the CertProvider interface.
+func (p *RotatingCertProvider) Certificate() (*tls.Certificate, error) {
+	// acquire mutex
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// refresh material
+	err := p.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.cert, nil
+}
+
+// RootCAs implements the CertProvider interface.
+func (p *RotatingCertProvider) RootCAs() (*x509.CertPool, error) {
+	// acquire mutex
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// refresh material
+	err := p.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.pool, nil
+}
+
+func (p *RotatingCertProvider) refresh() error {
+	// check renewal
+	now := p.Now()
+	if p.cert != nil && now.Before(p.renew) {
+		return nil
+	}
+
+	// fetch material
+	cert, pool, err := p.Fetch()
+	if err == nil && cert == nil {
+		err = ErrMissingCertificate
+	}
+
+	// get leaf
+	var leaf *x509.Certificate
+	if err == nil {
+		leaf, err = parseLeaf(cert)
+	}
+
+	// keep cached material until it expires
+	if err != nil {
+		if p.cert != nil && now.Before(p.expires) {
+			return nil
+		}
+
+		return err
+	}
+
+	// compute renewal
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	p.renew = leaf.NotBefore.Add(time.Duration(float64(lifetime) * p.RenewAfter))
+	p.expires = leaf.NotAfter
+
+	// set material
+	p.cert = cert
+	p.pool = pool
+
+	return nil
+}
+
+func parseLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	// use parsed leaf
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+
+	// check chain
+	if len(cert.Certificate) == 0 {
+		return nil, ErrMissingCertificate
+	}
+
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// serverConfig returns a server config that uses the certificates of the
+// provider and verifies client certificates against its pool if requested.
+func serverConfig(template *tls.Config, provider CertProvider) *tls.Config {
+	// prepare config
+	config := &tls.Config{}
+	if template != nil {
+		config = template.Clone()
+	}
+
+	// get certificates from provider
+	config.Certificates = nil
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return provider.Certificate()
+	}
+
+	// get client authorities from provider
+	if config.ClientAuth >= tls.VerifyClientCertIfGiven {
+		base := config.Clone()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			pool, err := provider.RootCAs()
+			if err != nil {
+				return nil, err
+			}
+
+			client := base.Clone()
+			client.ClientCAs = pool
+
+			return client, nil
+		}
+	}
+
+	return config
+}
+
+// clientConfig returns a client config that presents the certificate of the
+// provider and verifies servers against its pool.
+func clientConfig(template *tls.Config, provider CertProvider) (*tls.Config, error) {
+	// prepare config
+	config := &tls.Config{}
+	if template != nil {
+		config = template.Clone()
+	}
+
+	// get authorities
+	pool, err := provider.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	// set authorities
+	if pool != nil {
+		config.RootCAs = pool
+	}
+
+	// get certificates from provider
+	config.Certificates = nil
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return provider.Certificate()
+	}
+
+	return config, nil
+}
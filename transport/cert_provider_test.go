@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueCert(parent *tls.Certificate, name string, notBefore, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	// self sign without parent
+	parentCert, parentKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+func TestRotatingCertProvider(t *testing.T) {
+	start := time.Now()
+	now := start
+
+	var fetches int
+	var fail bool
+
+	provider := NewRotatingCertProvider(func() (*tls.Certificate, *x509.CertPool, error) {
+		fetches++
+		if fail {
+			return nil, nil, errors.New("failed")
+		}
+
+		return issueCert(nil, "localhost", now, now.Add(3*time.Hour)), x509.NewCertPool(), nil
+	})
+	provider.Now = func() time.Time {
+		return now
+	}
+
+	cert1, err := provider.Certificate()
+	assert.NoError(t, err)
+	assert.NotNil(t, cert1)
+	assert.Equal(t, 1, fetches)
+
+	pool, err := provider.RootCAs()
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+	assert.Equal(t, 1, fetches)
+
+	// cached until renewal
+	now = start.Add(time.Hour)
+	cert2, err := provider.Certificate()
+	assert.NoError(t, err)
+	assert.Equal(t, cert1, cert2)
+	assert.Equal(t, 1, fetches)
+
+	// renewed after two thirds
+	now = start.Add(2*time.Hour + time.Second)
+	cert2, err = provider.Certificate()
+	assert.NoError(t, err)
+	assert.NotEqual(t, cert1, cert2)
+	assert.Equal(t, 2, fetches)
+
+	// failed renewals keep the cached certificate
+	fail = true
+	now = now.Add(2*time.Hour + time.Second)
+	cert3, err := provider.Certificate()
+	assert.NoError(t, err)
+	assert.Equal(t, cert2, cert3)
+	assert.Equal(t, 3, fetches)
+
+	// until it expires
+	now = now.Add(time.Hour)
+	cert3, err = provider.Certificate()
+	assert.Error(t, err)
+	assert.Nil(t, cert3)
+}
+
+type staticCertProvider struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+func (p *staticCertProvider) Certificate() (*tls.Certificate, error) {
+	return p.cert, nil
+}
+
+func (p *staticCertProvider) RootCAs() (*x509.CertPool, error) {
+	return p.pool, nil
+}
+
+func TestCertProviderMutualTLS(t *testing.T) {
+	now := time.Now()
+
+	ca := issueCert(nil, "ca", now.Add(-time.Hour), now.Add(time.Hour))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	launcher := NewLauncher()
+	launcher.TLSConfig = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	launcher.CertProvider = &staticCertProvider{
+		cert: issueCert(ca, "localhost", now.Add(-time.Hour), now.Add(time.Hour)),
+		pool: pool,
+	}
+
+	server, err := launcher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			// skip failed handshakes
+			pkt, err := conn.Receive()
+			_ = conn.Close()
+			if err == nil {
+				assert.Equal(t, packet.PINGREQ, pkt.Type())
+				return
+			}
+		}
+	}()
+
+	// missing client certificate
+	dialer := NewDialer()
+	dialer.CertProvider = &staticCertProvider{
+		cert: &tls.Certificate{},
+		pool: pool,
+	}
+
+	conn, err := dialer.Dial("tls://localhost:" + getPort(server))
+	if err == nil {
+		_, err = conn.Receive()
+		_ = conn.Close()
+	}
+	assert.Error(t, err)
+
+	// valid client certificate
+	dialer.CertProvider = &staticCertProvider{
+		cert: issueCert(ca, "client", now.Add(-time.Hour), now.Add(time.Hour)),
+		pool: pool,
+	}
+
+	conn, err = dialer.Dial("tls://localhost:" + getPort(server))
+	require.NoError(t, err)
+	assert.NoError(t, conn.Send(packet.NewPingreq(), false))
+
+	safeReceive(done)
+
+	assert.NoError(t, server.Close())
+}
@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInjectedFault is returned by ChaosConn and ChaosCarrier if a fault has
+// been injected.
+var ErrInjectedFault = errors.New("injected fault")
+
+// A ChaosConfig defines the faults injected by a ChaosConn or ChaosCarrier.
+// All rates are probabilities between 0 and 1 that are evaluated on every
+// operation.
+type ChaosConfig struct {
+	// The seed for the random number generators. Sending and receiving use
+	// separate generators so that both directions are reproducible on their
+	// own.
+	Seed int64
+
+	// The rate and maximum duration of random delays.
+	DelayRate float64
+	MaxDelay  time.Duration
+
+	// The rate at which packets are silently dropped.
+	DropRate float64
+
+	// The rate at which the connection is abruptly closed.
+	ResetRate float64
+
+	// The rate at which only a part of the written data is sent before the
+	// connection is closed. Only used by ChaosCarrier.
+	PartialWriteRate float64
+
+	// The rate at which reads return fewer bytes than requested. Only used by
+	// ChaosCarrier.
+	ShortReadRate float64
+}
+
+type chaos struct {
+	config ChaosConfig
+	rand   *rand.Rand
+	mutex  sync.Mutex
+}
+
+func newChaos(config ChaosConfig, offset int64) *chaos {
+	return &chaos{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed + offset)),
+	}
+}
+
+func (c *chaos) roll(rate float64) bool {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return rate > 0 && c.rand.Float64() < rate
+}
+
+func (c *chaos) intn(n int) int {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.rand.Intn(n)
+}
+
+func (c *chaos) delay() {
+	// check rate
+	if c.config.MaxDelay <= 0 || !c.roll(c.config.DelayRate) {
+		return
+	}
+
+	// get duration
+	c.mutex.Lock()
+	d := time.Duration(c.rand.Int63n(int64(c.config.MaxDelay)))
+	c.mutex.Unlock()
+
+	time.Sleep(d)
+}
+
+// A ChaosConn wraps a Conn and injects delays, dropped packets and resets.
+type ChaosConn struct {
+	Conn
+
+	send    *chaos
+	receive *chaos
+}
+
+// NewChaosConn returns a new ChaosConn that wraps the specified Conn.
+func NewChaosConn(conn Conn, config ChaosConfig) *ChaosConn {
+	return &ChaosConn{
+		Conn:    conn,
+		send:    newChaos(config, 0),
+		receive: newChaos(config, 1),
+	}
+}
+
+// Send will send the packet using the underlying Conn after injecting faults.
+func (c *ChaosConn) Send(pkt packet.Generic, async bool) error {
+	// delay packet
+	c.send.delay()
+
+	// reset connection
+	if c.send.roll(c.send.config.ResetRate) {
+		_ = c.Conn.Close()
+		return ErrInjectedFault
+	}
+
+	// drop packet
+	if c.send.roll(c.send.config.DropRate) {
+		return nil
+	}
+
+	return c.Conn.Send(pkt, async)
+}
+
+// Receive will receive the next packet from the underlying Conn after
+// injecting faults.
+func (c *ChaosConn) Receive() (packet.Generic, error) {
+	for {
+		// receive packet
+		pkt, err := c.Conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		// delay packet
+		c.receive.delay()
+
+		// reset connection
+		if c.receive.roll(c.receive.config.ResetRate) {
+			_ = c.Conn.Close()
+			return nil, ErrInjectedFault
+		}
+
+		// drop packet
+		if c.receive.roll(c.receive.config.DropRate) {
+			continue
+		}
+
+		return pkt, nil
+	}
+}
+
+// A ChaosCarrier wraps a Carrier and injects delays, short reads, partial
+// writes and resets on the byte level. It can be used with NewBaseConn to test
+// the handling of incomplete packets.
+type ChaosCarrier struct {
+	Carrier
+
+	read  *chaos
+	write *chaos
+}
+
+// NewChaosCarrier returns a new ChaosCarrier that wraps the specified Carrier.
+func NewChaosCarrier(carrier Carrier, config ChaosConfig) *ChaosCarrier {
+	return &ChaosCarrier{
+		Carrier: carrier,
+		read:    newChaos(config, 1),
+		write:   newChaos(config, 0),
+	}
+}
+
+// Read will read from the underlying Carrier after injecting faults. Reads are
+// randomly shortened to exercise partial packet handling.
+func (c *ChaosCarrier) Read(p []byte) (int, error) {
+	// delay read
+	c.read.delay()
+
+	// reset connection
+	if c.read.roll(c.read.config.ResetRate) {
+		_ = c.Carrier.Close()
+		return 0, ErrInjectedFault
+	}
+
+	// shorten read
+	if len(p) > 1 && c.read.roll(c.read.config.ShortReadRate) {
+		p = p[:1+c.read.intn(len(p)-1)]
+	}
+
+	return c.Carrier.Read(p)
+}
+
+// Write will write to the underlying Carrier after injecting faults.
+func (c *ChaosCarrier) Write(p []byte) (int, error) {
+	// delay write
+	c.write.delay()
+
+	// reset connection
+	if c.write.roll(c.write.config.ResetRate) {
+		_ = c.Carrier.Close()
+		return 0, ErrInjectedFault
+	}
+
+	// write partially and close
+	if len(p) > 1 && c.write.roll(c.write.config.PartialWriteRate) {
+		n, _ := c.Carrier.Write(p[:1+c.write.intn(len(p)-1)])
+		_ = c.Carrier.Close()
+		return n, ErrInjectedFault
+	}
+
+	return c.Carrier.Write(p)
+}
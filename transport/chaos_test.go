@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chaosDrops(seed int64) []packet.ID {
+	a, b := net.Pipe()
+	sender := NewNetConn(a, 0)
+	receiver := NewNetConn(b, 0)
+
+	conn := NewChaosConn(sender, ChaosConfig{
+		Seed:     seed,
+		DropRate: 0.5,
+	})
+
+	go func() {
+		for i := 1; i <= 20; i++ {
+			pkt := packet.NewPuback()
+			pkt.ID = packet.ID(i)
+			_ = conn.Send(pkt, false)
+		}
+
+		_ = sender.Send(packet.NewDisconnect(), false)
+	}()
+
+	var ids []packet.ID
+	for {
+		pkt, err := receiver.Receive()
+		if err != nil {
+			panic(err)
+		}
+
+		if puback, ok := pkt.(*packet.Puback); ok {
+			ids = append(ids, puback.ID)
+			continue
+		}
+
+		_ = receiver.Close()
+		_ = sender.Close()
+
+		return ids
+	}
+}
+
+func TestChaosConnDrop(t *testing.T) {
+	ids := chaosDrops(1)
+	assert.True(t, len(ids) > 0 && len(ids) < 20)
+	assert.Equal(t, ids, chaosDrops(1))
+}
+
+func TestChaosConnReset(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	conn := NewChaosConn(NewNetConn(a, 0), ChaosConfig{
+		ResetRate: 1,
+	})
+
+	err := conn.Send(packet.NewPingreq(), false)
+	assert.Equal(t, ErrInjectedFault, err)
+
+	err = conn.Send(packet.NewPingreq(), false)
+	assert.Error(t, err)
+}
+
+func TestChaosConnDelay(t *testing.T) {
+	a, b := net.Pipe()
+	sender := NewNetConn(a, 0)
+	receiver := NewNetConn(b, 0)
+
+	conn := NewChaosConn(sender, ChaosConfig{
+		DelayRate: 1,
+		MaxDelay:  50 * time.Millisecond,
+	})
+
+	go func() {
+		_ = conn.Send(packet.NewPingreq(), false)
+	}()
+
+	pkt, err := receiver.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PINGREQ, pkt.Type())
+
+	_ = sender.Close()
+	_ = receiver.Close()
+}
+
+func TestChaosCarrierShortRead(t *testing.T) {
+	a, b := net.Pipe()
+	sender := NewNetConn(a, 0)
+	receiver := NewBaseConn(NewChaosCarrier(b, ChaosConfig{
+		ShortReadRate: 1,
+	}), 0)
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "foo/bar/baz"
+	publish.Message.Payload = []byte("hello world")
+	publish.Message.QOS = 1
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			_ = sender.Send(publish, false)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		pkt, err := receiver.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, publish.String(), pkt.String())
+	}
+
+	_ = sender.Close()
+	_ = receiver.Close()
+}
+
+func TestChaosCarrierPartialWrite(t *testing.T) {
+	a, b := net.Pipe()
+	sender := NewBaseConn(NewChaosCarrier(a, ChaosConfig{
+		Seed:             1,
+		PartialWriteRate: 1,
+	}), 0)
+	receiver := NewNetConn(b, 0)
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- sender.Send(publish, false)
+	}()
+
+	pkt, err := receiver.Receive()
+	assert.Error(t, err)
+	assert.Nil(t, pkt)
+	assert.Error(t, <-errs)
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"crypto/tls"
 	"net"
 	"time"
 
@@ -46,3 +47,49 @@ type Conn interface {
 	// RemoteAddr will return the underlying connection's remote net address.
 	RemoteAddr() net.Addr
 }
+
+// A RateLimitedConn is a connection that can limit the rate of received
+// packets.
+type RateLimitedConn interface {
+	Conn
+
+	// SetReceiveRate sets the maximum number of packets per second that can be
+	// received. If the rate is greater than zero, Receive will delay packets
+	// that exceed the rate, which in turn slows down the sender. The burst
+	// defines the number of packets that can be received without delay.
+	SetReceiveRate(rate float64, burst int)
+}
+
+// A ZeroCopyConn is a connection that supports zero copy decoding of publish
+// payloads.
+type ZeroCopyConn interface {
+	Conn
+
+	// SetZeroCopy enables or disables zero copy decoding of publish payloads.
+	// If enabled, payloads of received publish packets reference pooled
+	// buffers that are owned by the packets until they are released or
+	// recycled.
+	SetZeroCopy(enabled bool)
+}
+
+// ConnectionState returns the TLS connection state of the connection. It
+// returns false if the connection is not a NetConn or WebSocketConn that is
+// secured using TLS.
+func ConnectionState(conn Conn) (tls.ConnectionState, bool) {
+	// get underlying connection
+	var underlying net.Conn
+	switch c := conn.(type) {
+	case *NetConn:
+		underlying = c.UnderlyingConn()
+	case *WebSocketConn:
+		underlying = c.UnderlyingConn().UnderlyingConn()
+	}
+
+	// check tls connection
+	tlsConn, ok := underlying.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+
+	return tlsConn.ConnectionState(), true
+}
@@ -348,3 +348,60 @@ func abstractConnBigAsyncSendAfterCloseTest(t *testing.T, protocol string) {
 
 	safeReceive(done)
 }
+
+func abstractConnReceiveRateTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.(RateLimitedConn).SetReceiveRate(100, 2)
+
+		start := time.Now()
+
+		for i := 0; i < 7; i++ {
+			pkt, err := conn1.Receive()
+			assert.NotNil(t, pkt)
+			assert.NoError(t, err)
+		}
+
+		// two packets are received immediately, the others are delayed
+		assert.True(t, time.Since(start) >= 45*time.Millisecond)
+
+		err := conn1.Close()
+		assert.NoError(t, err)
+	})
+
+	for i := 0; i < 7; i++ {
+		err := conn2.Send(packet.NewPingreq(), false)
+		assert.NoError(t, err)
+	}
+
+	safeReceive(done)
+}
+
+func abstractConnReceiveRateCloseTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.(RateLimitedConn).SetReceiveRate(1, 1)
+
+		pkt, err := conn1.Receive()
+		assert.NotNil(t, pkt)
+		assert.NoError(t, err)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = conn1.Close()
+		}()
+
+		start := time.Now()
+
+		// the delayed receive is interrupted by the close
+		pkt, err = conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, ErrClosed, err)
+		assert.True(t, time.Since(start) < 500*time.Millisecond)
+	})
+
+	for i := 0; i < 2; i++ {
+		err := conn2.Send(packet.NewPingreq(), false)
+		assert.NoError(t, err)
+	}
+
+	safeReceive(done)
+}
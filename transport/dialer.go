@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,12 +18,51 @@ type Dialer struct {
 	RequestHeader http.Header
 	MaxWriteDelay time.Duration
 
+	// PingInterval may be set to send WebSocket ping frames to the server in
+	// the specified interval. The pings are independent of the MQTT keep alive
+	// and prevent proxies from closing WebSocket connections they consider
+	// idle.
+	PingInterval time.Duration
+
+	// PongTimeout may be set together with the PingInterval to close the
+	// connection if the server does not respond to a ping within the
+	// specified timeout.
+	PongTimeout time.Duration
+
+	// CertProvider may be set to obtain the client certificate and the
+	// authorities used to verify servers from a provider. The TLSConfig is
+	// used as a template if set.
+	CertProvider CertProvider
+
+	// TLSPolicy may be set to restrict the versions, cipher suites and curves
+	// negotiated with secure servers. Options set in the query of the URL
+	// passed to Dial override the fields of the policy.
+	TLSPolicy *TLSPolicy
+
+	// ClientSessionCache may be set to resume TLS sessions when reconnecting,
+	// which avoids full handshakes if many clients reconnect at once, e.g.
+	// tls.NewLRUClientSessionCache(0). It overrides the cache of the TLSConfig.
+	ClientSessionCache tls.ClientSessionCache
+
 	DefaultTCPPort string
 	DefaultTLSPort string
 	DefaultWSPort  string
 	DefaultWSSPort string
 
+	// RotateAddresses may be set to rotate among the addresses a host name
+	// resolves to. The addresses are tried in order starting with a different
+	// address on every dial, which spreads reconnects across the records of a
+	// DNS based failover. Without rotation the first reachable address is
+	// used. In both cases the host name is resolved on every dial.
+	RotateAddresses bool
+
+	// LookupHost is used to resolve host names if addresses are rotated.
+	//
+	// Will default to net.LookupHost.
+	LookupHost func(host string) ([]string, error)
+
 	webSocketDialer *websocket.Dialer
+	rotation        uint32
 }
 
 // NewDialer returns a new Dialer.
@@ -74,7 +114,7 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 			port = d.DefaultTCPPort
 		}
 
-		conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		conn, err := d.dial(host, port)
 		if err != nil {
 			return nil, err
 		}
@@ -85,7 +125,12 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 			port = d.DefaultTLSPort
 		}
 
-		conn, err := tls.Dial("tcp", net.JoinHostPort(host, port), d.TLSConfig)
+		config, err := d.tlsConfig(urlParts.Query())
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := d.dialTLS(host, port, config)
 		if err != nil {
 			return nil, err
 		}
@@ -98,12 +143,13 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 
 		wsURL := fmt.Sprintf("ws://%s:%s%s", host, port, urlParts.Path)
 
+		d.webSocketDialer.NetDial = d.netDial()
 		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
 		if err != nil {
 			return nil, err
 		}
 
-		return NewWebSocketConn(conn, d.MaxWriteDelay), nil
+		return d.webSocketConn(conn), nil
 	case "wss":
 		if port == "" {
 			port = d.DefaultWSSPort
@@ -111,14 +157,148 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 
 		wsURL := fmt.Sprintf("wss://%s:%s%s", host, port, urlParts.Path)
 
-		d.webSocketDialer.TLSClientConfig = d.TLSConfig
+		config, err := d.tlsConfig(urlParts.Query())
+		if err != nil {
+			return nil, err
+		}
+
+		d.webSocketDialer.TLSClientConfig = config
+		d.webSocketDialer.NetDial = d.netDial()
 		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
 		if err != nil {
 			return nil, err
 		}
 
-		return NewWebSocketConn(conn, d.MaxWriteDelay), nil
+		return d.webSocketConn(conn), nil
 	}
 
 	return nil, ErrUnsupportedProtocol
 }
+
+func (d *Dialer) webSocketConn(conn *websocket.Conn) *WebSocketConn {
+	// create connection
+	webSocketConn := NewWebSocketConn(conn, d.MaxWriteDelay)
+
+	// start keep alive
+	if d.PingInterval > 0 {
+		webSocketConn.keepAlive(d.PingInterval, d.PongTimeout)
+	}
+
+	return webSocketConn
+}
+
+func (d *Dialer) dial(host, port string) (net.Conn, error) {
+	// dial directly without rotation
+	if !d.RotateAddresses {
+		return net.Dial("tcp", net.JoinHostPort(host, port))
+	}
+
+	// get lookup
+	lookup := d.LookupHost
+	if lookup == nil {
+		lookup = net.LookupHost
+	}
+
+	// resolve host
+	addrs, err := lookup(host)
+	if err != nil {
+		return nil, err
+	} else if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	// get offset
+	offset := int(atomic.AddUint32(&d.rotation, 1)-1) % len(addrs)
+
+	// try addresses in rotated order
+	for i := range addrs {
+		var conn net.Conn
+		conn, err = net.Dial("tcp", net.JoinHostPort(addrs[(offset+i)%len(addrs)], port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+func (d *Dialer) dialTLS(host, port string, config *tls.Config) (net.Conn, error) {
+	// dial directly without rotation
+	if !d.RotateAddresses {
+		return tls.Dial("tcp", net.JoinHostPort(host, port), config)
+	}
+
+	// dial address
+	conn, err := d.dial(host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare config
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	// perform handshake
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.Handshake()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (d *Dialer) netDial() func(network, addr string) (net.Conn, error) {
+	// use default dialer without rotation
+	if !d.RotateAddresses {
+		return nil
+	}
+
+	return func(_, addr string) (net.Conn, error) {
+		// split address
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.dial(host, port)
+	}
+}
+
+func (d *Dialer) tlsConfig(query url.Values) (*tls.Config, error) {
+	// get policy
+	policy, err := ParseTLSPolicy(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// use static config without a provider
+	config := d.TLSPolicy.merge(policy).apply(d.TLSConfig)
+	if d.CertProvider != nil {
+		config, err = clientConfig(config, d.CertProvider)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check cache
+	if d.ClientSessionCache == nil {
+		return config, nil
+	}
+
+	// set cache on copy of config
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.ClientSessionCache = d.ClientSessionCache
+
+	return config, nil
+}
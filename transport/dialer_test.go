@@ -2,6 +2,7 @@ package transport
 
 import (
 	"io"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -123,3 +124,54 @@ func TestWSDefaultPort(t *testing.T) {
 func TestWSSDefaultPort(t *testing.T) {
 	abstractDefaultPortTest(t, "wss")
 }
+
+func TestDialerRotateAddresses(t *testing.T) {
+	server1, err := testLauncher.Launch("tcp://127.0.0.1:0")
+	require.NoError(t, err)
+
+	_, port, _ := net.SplitHostPort(server1.Addr().String())
+
+	server2, err := testLauncher.Launch("tcp://127.0.0.2:" + port)
+	require.NoError(t, err)
+
+	accepted := make(chan string, 3)
+
+	for _, server := range []Server{server1, server2} {
+		go func(server Server) {
+			for {
+				conn, err := server.Accept()
+				if err != nil {
+					return
+				}
+
+				accepted <- server.Addr().String()
+				_ = conn.Close()
+			}
+		}(server)
+	}
+
+	dialer := NewDialer()
+	dialer.RotateAddresses = true
+	dialer.LookupHost = func(host string) ([]string, error) {
+		assert.Equal(t, "broker", host)
+		return []string{"127.0.0.3", "127.0.0.1", "127.0.0.2"}, nil
+	}
+
+	for _, addr := range []string{server1.Addr().String(), server1.Addr().String(), server2.Addr().String()} {
+		conn, err := dialer.Dial("tcp://broker:" + port)
+		require.NoError(t, err)
+		assert.Equal(t, addr, <-accepted)
+		_ = conn.Close()
+	}
+
+	dialer.LookupHost = func(string) ([]string, error) {
+		return nil, nil
+	}
+
+	conn, err := dialer.Dial("tcp://broker:" + port)
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+
+	assert.NoError(t, server1.Close())
+	assert.NoError(t, server2.Close())
+}
@@ -66,6 +66,8 @@ const (
 	actionRun
 	actionClose
 	actionEnd
+	actionDelay
+	actionDuplicate
 )
 
 // An Action is a step in a flow.
@@ -136,6 +138,34 @@ func (f *Flow) Run(fn func()) *Flow {
 	return f
 }
 
+// Delay will pause the flow for the specified duration. It can be used to
+// delay acknowledgements.
+func (f *Flow) Delay(duration time.Duration) *Flow {
+	f.add(action{
+		kind:     actionDelay,
+		duration: duration,
+	})
+
+	return f
+}
+
+// Duplicate will send the specified packets twice. The second copy of a publish
+// packet is sent with the dup flag set to simulate a redelivery.
+func (f *Flow) Duplicate(pkts ...packet.Generic) *Flow {
+	f.add(action{
+		kind:    actionDuplicate,
+		packets: pkts,
+	})
+
+	return f
+}
+
+// SendRaw will send the specified bytes as is. It can be used to inject
+// malformed packets into the stream.
+func (f *Flow) SendRaw(data []byte) *Flow {
+	return f.Send(&Raw{Data: data})
+}
+
 // Close will immediately close the connection.
 func (f *Flow) Close() *Flow {
 	f.add(action{
@@ -182,6 +212,35 @@ func (f *Flow) test(conn Conn, action action) error {
 				return fmt.Errorf("error sending packet: %v", err)
 			}
 		}
+	case actionDuplicate:
+		// send all saved packets twice
+		for _, pkt := range action.packets {
+			for i := 0; i < 2; i++ {
+				// set dup flag on second publish
+				if publish, ok := pkt.(*packet.Publish); ok && i == 1 {
+					dup := *publish
+					dup.Dup = true
+					pkt = &dup
+				}
+
+				if f.debug {
+					fmt.Printf("sending packet: %s...\n", pkt.String())
+				}
+
+				// send a single packet
+				err := conn.Send(pkt, false)
+				if err != nil {
+					return fmt.Errorf("error sending packet: %v", err)
+				}
+			}
+		}
+	case actionDelay:
+		if f.debug {
+			fmt.Printf("delaying...\n")
+		}
+
+		// wait for duration
+		time.Sleep(action.duration)
 	case actionReceive:
 		// initialize store
 		store := make(map[int]string)
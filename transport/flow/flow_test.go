@@ -69,3 +69,56 @@ func TestAlreadyClosedError(t *testing.T) {
 	err := pipe.Send(nil, false)
 	assert.Error(t, err)
 }
+
+func TestFlowDelayAndDuplicate(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "test"
+	publish.Message.QOS = 1
+
+	dup := packet.NewPublish()
+	dup.ID = 1
+	dup.Dup = true
+	dup.Message.Topic = "test"
+	dup.Message.QOS = 1
+
+	pipe := NewPipe()
+
+	errCh := New().
+		Receive(publish).
+		Receive(dup).
+		TestAsync(pipe, time.Second)
+
+	start := time.Now()
+
+	err := New().
+		Delay(10 * time.Millisecond).
+		Duplicate(publish).
+		Test(pipe)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	assert.False(t, publish.Dup)
+}
+
+func TestFlowSendRaw(t *testing.T) {
+	a, b := netPipe()
+
+	errCh := New().
+		SendRaw([]byte{0xF0, 0x00}).
+		TestAsync(a, time.Second)
+
+	pkt, err := b.Receive()
+	assert.Error(t, err)
+	assert.Nil(t, pkt)
+	assert.NoError(t, <-errCh)
+}
+
+func TestFlowRawEncodeFailure(t *testing.T) {
+	a, _ := netPipe()
+
+	err := New().
+		Send(&Raw{Fail: true}).
+		Test(a)
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrRawEncode is returned by a Raw packet if it should fail encoding.
+var ErrRawEncode = errors.New("raw encode failure")
+
+// A Raw packet writes arbitrary bytes to the stream. It can be used to inject
+// malformed packets or encoding failures into a flow.
+type Raw struct {
+	// The bytes that are written as is.
+	Data []byte
+
+	// Fail can be set to return ErrRawEncode when encoded.
+	Fail bool
+}
+
+// Type returns the type of the first byte or zero.
+func (r *Raw) Type() packet.Type {
+	if len(r.Data) == 0 {
+		return 0
+	}
+
+	return packet.Type(r.Data[0] >> 4)
+}
+
+// Len returns the length of the data.
+func (r *Raw) Len() int {
+	return len(r.Data)
+}
+
+// Decode is not supported and will return an error.
+func (r *Raw) Decode(src []byte) (int, error) {
+	return 0, errors.New("raw packets cannot be decoded")
+}
+
+// Encode will copy the data into the destination.
+func (r *Raw) Encode(dst []byte) (int, error) {
+	// check failure
+	if r.Fail {
+		return 0, ErrRawEncode
+	}
+
+	// check length
+	if len(dst) < len(r.Data) {
+		return 0, errors.New("insufficient buffer length")
+	}
+
+	return copy(dst, r.Data), nil
+}
+
+// EncodeTo will append the data to the buffer.
+func (r *Raw) EncodeTo(buf []byte) ([]byte, error) {
+	// check failure
+	if r.Fail {
+		return buf, ErrRawEncode
+	}
+
+	return append(buf, r.Data...), nil
+}
+
+// String returns a string representation of the data.
+func (r *Raw) String() string {
+	return fmt.Sprintf("<Raw Data=%x Fail=%t>", r.Data, r.Fail)
+}
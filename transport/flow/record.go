@@ -0,0 +1,209 @@
+package flow
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// ErrInvalidRecording is returned by ReadRecords if the data is not a valid
+// recording.
+var ErrInvalidRecording = errors.New("invalid recording")
+
+var recordingMagic = []byte("GMQR\x01")
+
+// A Record is a single packet of a recorded packet stream.
+type Record struct {
+	// The time since the recording has been started.
+	Time time.Duration
+
+	// Whether the packet has been received or sent by the recorded side.
+	Incoming bool
+
+	// The recorded packet.
+	Packet packet.Generic
+}
+
+// A Recorder wraps a transport.Conn and records all successfully sent and
+// received packets to a writer.
+type Recorder struct {
+	transport.Conn
+
+	writer io.Writer
+	start  time.Time
+	header bool
+	err    error
+	mutex  sync.Mutex
+}
+
+// NewRecorder returns a new Recorder that records the packets of the specified
+// connection to the writer.
+func NewRecorder(conn transport.Conn, w io.Writer) *Recorder {
+	return &Recorder{
+		Conn:   conn,
+		writer: w,
+		start:  time.Now(),
+	}
+}
+
+// Send will send and record the packet.
+func (r *Recorder) Send(pkt packet.Generic, async bool) error {
+	err := r.Conn.Send(pkt, async)
+	if err != nil {
+		return err
+	}
+
+	r.record(false, pkt)
+
+	return nil
+}
+
+// Receive will receive and record the next packet.
+func (r *Recorder) Receive() (packet.Generic, error) {
+	pkt, err := r.Conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(true, pkt)
+
+	return pkt, nil
+}
+
+// Err returns the first error that occurred while writing the recording.
+// Recording stops after an error.
+func (r *Recorder) Err() error {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(incoming bool, pkt packet.Generic) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// skip if failed
+	if r.err != nil {
+		return
+	}
+
+	// write header
+	if !r.header {
+		_, r.err = r.writer.Write(recordingMagic)
+		if r.err != nil {
+			return
+		}
+
+		r.header = true
+	}
+
+	// encode packet
+	data, err := packet.EncodeTo(make([]byte, 13, 13+pkt.Len()), pkt)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	// write record header
+	if incoming {
+		data[0] = 1
+	}
+	binary.BigEndian.PutUint64(data[1:], uint64(time.Since(r.start)))
+	binary.BigEndian.PutUint32(data[9:], uint32(len(data)-13))
+
+	// write record
+	_, r.err = r.writer.Write(data)
+}
+
+// ReadRecords will read all records from a recording written by a Recorder.
+func ReadRecords(reader io.Reader) ([]Record, error) {
+	// prepare reader
+	br := bufio.NewReader(reader)
+
+	// read magic
+	magic := make([]byte, len(recordingMagic))
+	_, err := io.ReadFull(br, magic)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil || string(magic) != string(recordingMagic) {
+		return nil, ErrInvalidRecording
+	}
+
+	// read records
+	var records []Record
+	header := make([]byte, 13)
+	for {
+		// read record header
+		_, err = io.ReadFull(br, header)
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, ErrInvalidRecording
+		}
+
+		// read packet
+		data := make([]byte, binary.BigEndian.Uint32(header[9:]))
+		_, err = io.ReadFull(br, data)
+		if err != nil {
+			return nil, ErrInvalidRecording
+		}
+
+		// detect packet
+		_, typ := packet.DetectPacket(data)
+		pkt, err := typ.New()
+		if err != nil {
+			return nil, err
+		}
+
+		// decode packet
+		_, err = pkt.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// add record
+		records = append(records, Record{
+			Time:     time.Duration(binary.BigEndian.Uint64(header[1:])),
+			Incoming: header[0] == 1,
+			Packet:   pkt,
+		})
+	}
+}
+
+// Replay returns a flow that plays the role of the recorded side. Recorded
+// outgoing packets are sent and recorded incoming packets are expected to be
+// received. Consecutive incoming packets are matched out of order.
+func Replay(records []Record) *Flow {
+	f := New()
+
+	// add actions
+	for i := 0; i < len(records); {
+		// collect consecutive packets of the same direction
+		j := i
+		var pkts []packet.Generic
+		for j < len(records) && records[j].Incoming == records[i].Incoming {
+			pkts = append(pkts, records[j].Packet)
+			j++
+		}
+
+		// add action
+		if records[i].Incoming {
+			f.Receive(pkts...)
+		} else {
+			f.Send(pkts...)
+		}
+
+		i = j
+	}
+
+	return f
+}
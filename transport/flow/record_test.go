@@ -0,0 +1,87 @@
+package flow
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func netPipe() (transport.Conn, transport.Conn) {
+	a, b := net.Pipe()
+	return transport.NewNetConn(a, 0), transport.NewNetConn(b, 0)
+}
+
+func TestRecordReplay(t *testing.T) {
+	connect := packet.NewConnect()
+	connack := packet.NewConnack()
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("payload")
+	publish.Message.QOS = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	server := func() *Flow {
+		return New().
+			Receive(connect).
+			Send(connack).
+			Receive(publish).
+			Send(puback).
+			Close()
+	}
+
+	client, remote := netPipe()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(client, &buf)
+
+	errCh := server().TestAsync(remote, time.Second)
+
+	err := New().
+		Send(connect).
+		Receive(connack).
+		Send(publish).
+		Receive(puback).
+		End().
+		Test(recorder)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+	assert.NoError(t, recorder.Err())
+
+	records, err := ReadRecords(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.False(t, records[0].Incoming)
+	assert.True(t, records[1].Incoming)
+	assert.Equal(t, publish.String(), records[2].Packet.String())
+	assert.True(t, records[3].Time >= records[0].Time)
+
+	client, remote = netPipe()
+
+	errCh = server().TestAsync(remote, time.Second)
+
+	err = Replay(records).End().Test(client)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+}
+
+func TestReadRecordsInvalid(t *testing.T) {
+	records, err := ReadRecords(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	_, err = ReadRecords(bytes.NewReader([]byte("foo")))
+	assert.Equal(t, ErrInvalidRecording, err)
+
+	_, err = ReadRecords(bytes.NewReader(append(recordingMagic, 1, 2)))
+	assert.Equal(t, ErrInvalidRecording, err)
+}
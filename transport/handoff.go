@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrHandoffUnsupported is returned if the listening socket of a server cannot
+// be passed to another process.
+var ErrHandoffUnsupported = errors.New("handoff unsupported")
+
+// HandoffEnv is the environment variable used to pass the descriptors and URLs
+// of inherited listening sockets to a replacement process.
+const HandoffEnv = "GOMQTT_HANDOFF"
+
+// A FileServer is a server that can provide its listening socket.
+type FileServer interface {
+	Server
+
+	// File should return a duplicate of the listening socket.
+	File() (*os.File, error)
+}
+
+var inherited struct {
+	fds   map[string]int
+	once  sync.Once
+	mutex sync.Mutex
+}
+
+// Handoff prepares the command to inherit the listening sockets of the
+// servers that have been launched from the specified URLs. The replacement
+// process takes over the sockets using LaunchOrInherit with the same URLs.
+// Connections that arrive while both processes are running are accepted by
+// either process. Once the replacement process is running, the servers may
+// be closed without refusing any connections. The added extra files of the
+// command should be closed after it has been started.
+func Handoff(cmd *exec.Cmd, urls []string, servers []Server) error {
+	// check arguments
+	if len(urls) != len(servers) {
+		return fmt.Errorf("handoff: got %d urls for %d servers", len(urls), len(servers))
+	}
+
+	// collect files
+	var entries []string
+	for i, server := range servers {
+		// get file server
+		fs, ok := server.(FileServer)
+		if !ok {
+			return ErrHandoffUnsupported
+		}
+
+		// get file
+		file, err := fs.File()
+		if err != nil {
+			return err
+		}
+
+		// add file, the first extra file becomes descriptor 3
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+		entries = append(entries, strconv.Itoa(2+len(cmd.ExtraFiles))+" "+urls[i])
+	}
+
+	// prepare environment
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	// set environment
+	cmd.Env = append(cmd.Env, HandoffEnv+"="+strings.Join(entries, "\n"))
+
+	return nil
+}
+
+// LaunchOrInherit is a shorthand function.
+func LaunchOrInherit(urlString string) (Server, error) {
+	return sharedLauncher.LaunchOrInherit(urlString)
+}
+
+// LaunchOrInherit will take over the listening socket that has been passed by
+// the parent process for the specified URL using Handoff. A new server is
+// launched if no socket has been passed. Every inherited socket can only be
+// taken over once.
+func (l *Launcher) LaunchOrInherit(urlString string) (Server, error) {
+	// get inherited file
+	file := inheritedFile(urlString)
+	if file == nil {
+		return l.Launch(urlString)
+	}
+
+	return l.Inherit(urlString, file)
+}
+
+// Inherit will create a server from the listening socket file using the
+// protocol and settings of the specified URL. The file is closed after the
+// socket has been taken over.
+func (l *Launcher) Inherit(urlString string, file *os.File) (Server, error) {
+	// parse url
+	urlParts, err := url.ParseRequestURI(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	// create listener
+	listener, err := net.FileListener(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// get secure config
+	var config *tls.Config
+	switch urlParts.Scheme {
+	case "tls", "mqtts", "wss":
+		config, err = l.secureConfig(urlParts.Query())
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+
+	// create server
+	switch urlParts.Scheme {
+	case "tcp", "mqtt":
+		return NewNetServer(listener), nil
+	case "tls", "mqtts":
+		return newSecureNetServer(listener, config), nil
+	case "ws":
+		return NewWebSocketServer(listener), nil
+	case "wss":
+		return newSecureWebSocketServer(listener, config), nil
+	}
+
+	// close listener
+	_ = listener.Close()
+
+	return nil, ErrUnsupportedProtocol
+}
+
+func inheritedFile(urlString string) *os.File {
+	// parse environment once
+	inherited.once.Do(func() {
+		inherited.fds = parseHandoff(os.Getenv(HandoffEnv))
+		_ = os.Unsetenv(HandoffEnv)
+	})
+
+	// acquire mutex
+	inherited.mutex.Lock()
+	defer inherited.mutex.Unlock()
+
+	// take descriptor
+	fd, ok := inherited.fds[urlString]
+	if !ok {
+		return nil
+	}
+	delete(inherited.fds, urlString)
+
+	return os.NewFile(uintptr(fd), urlString)
+}
+
+func parseHandoff(value string) map[string]int {
+	// prepare map
+	fds := make(map[string]int)
+
+	// parse entries
+	for _, entry := range strings.Split(value, "\n") {
+		// split entry
+		fd, urlString, ok := strings.Cut(entry, " ")
+		if !ok {
+			continue
+		}
+
+		// parse descriptor
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 3 {
+			continue
+		}
+
+		fds[urlString] = n
+	}
+
+	return fds
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandoff(t *testing.T) {
+	server1, err := Launch("tcp://localhost:0")
+	require.NoError(t, err)
+
+	cmd := exec.Command("true")
+	cmd.Env = []string{"FOO=bar"}
+
+	err = Handoff(cmd, []string{"tcp://localhost:1883"}, []Server{server1})
+	assert.NoError(t, err)
+	assert.Len(t, cmd.ExtraFiles, 1)
+	assert.Equal(t, []string{"FOO=bar", HandoffEnv + "=3 tcp://localhost:1883"}, cmd.Env)
+
+	err = Handoff(cmd, []string{"tcp://localhost:1883"}, nil)
+	assert.Error(t, err)
+
+	server2, err := NewLauncher().Inherit("tcp://localhost:1883", cmd.ExtraFiles[0])
+	require.NoError(t, err)
+	assert.Equal(t, server1.Addr().String(), server2.Addr().String())
+
+	assert.NoError(t, server1.Close())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, err := server2.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.PINGREQ, pkt.Type())
+		assert.NoError(t, conn.Close())
+	}()
+
+	conn, err := Dial("tcp://" + server2.Addr().String())
+	require.NoError(t, err)
+	assert.NoError(t, conn.Send(packet.NewPingreq(), false))
+
+	safeReceive(done)
+
+	assert.NoError(t, server2.Close())
+}
+
+func TestHandoffParse(t *testing.T) {
+	fds := parseHandoff("3 tcp://0.0.0.0:1883\n4 ws://0.0.0.0:8080\nfoo\n1 tcp://bar")
+	assert.Equal(t, map[string]int{
+		"tcp://0.0.0.0:1883": 3,
+		"ws://0.0.0.0:8080":  4,
+	}, fds)
+}
+
+func TestLaunchOrInherit(t *testing.T) {
+	server, err := LaunchOrInherit("tcp://localhost:0")
+	require.NoError(t, err)
+	assert.NoError(t, server.Close())
+
+	file, err := os.CreateTemp("", "gomqtt")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	server, err = NewLauncher().Inherit("tcp://localhost:0", file)
+	assert.Error(t, err)
+	assert.Nil(t, server)
+}
@@ -2,12 +2,75 @@ package transport
 
 import (
 	"crypto/tls"
+	"net"
+	"net/http"
 	"net/url"
+	"sync"
+	"time"
 )
 
+// ACMEProtocol is the ALPN protocol negotiated by ACME servers to perform
+// TLS-ALPN-01 challenges.
+const ACMEProtocol = "acme-tls/1"
+
+// A CertManager obtains and renews certificates automatically. It is
+// implemented by the Manager from golang.org/x/crypto/acme/autocert, which
+// also answers TLS-ALPN-01 challenges in GetCertificate and stores the
+// certificates in the configured cache, e.g. autocert.DirCache("certs").
+type CertManager interface {
+	// GetCertificate should return the certificate for the handshake.
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// HTTPHandler should return a handler that answers HTTP-01 challenges and
+	// passes other requests to the fallback.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
 // The Launcher helps with launching a server and accepting connections.
 type Launcher struct {
 	TLSConfig *tls.Config
+
+	// CertManager may be set to obtain the certificates for secure servers
+	// automatically. The TLSConfig is used as a template if set. The manager
+	// takes precedence over the provider.
+	CertManager CertManager
+
+	// CertProvider may be set to obtain the certificates for secure servers and
+	// the authorities used to verify client certificates from a provider. The
+	// TLSConfig is used as a template if set.
+	CertProvider CertProvider
+
+	// ChallengeAddress may be set together with the CertManager to serve
+	// HTTP-01 challenges on the specified address, e.g. ":80". The server is
+	// started with the first secure server. Other requests are handled by
+	// the default handler of the manager which usually redirects to HTTPS.
+	ChallengeAddress string
+
+	// RevocationChecker may be set to check whether the certificates presented
+	// by clients of secure servers have been revoked. The TLSConfig should
+	// request and verify client certificates for the checks to apply.
+	RevocationChecker RevocationChecker
+
+	// TLSPolicy may be set to restrict the versions, cipher suites and curves
+	// negotiated by secure servers. Options set in the query of the URL passed
+	// to Launch override the fields of the policy.
+	TLSPolicy *TLSPolicy
+
+	// SessionTicketKeys may be set to encrypt the session tickets of secure
+	// servers using the specified keys. The first key encrypts new tickets
+	// while all keys are used to decrypt them. Sharing the keys among brokers
+	// allows clients to resume sessions with any of them. The keys are shared
+	// among all servers launched by the launcher.
+	SessionTicketKeys [][32]byte
+
+	// SessionTicketRotation may be set to generate a new session ticket key
+	// in the specified interval. The two previous keys are retained to
+	// resume sessions with recently issued tickets.
+	SessionTicketRotation time.Duration
+
+	challengeListener net.Listener
+	tickets           *ticketKeys
+	mutex             sync.Mutex
 }
 
 // NewLauncher returns a new Launcher.
@@ -37,12 +100,182 @@ func (l *Launcher) Launch(urlString string) (Server, error) {
 	case "tcp", "mqtt":
 		return CreateNetServer(urlParts.Host)
 	case "tls", "mqtts":
-		return CreateSecureNetServer(urlParts.Host, l.TLSConfig)
+		config, err := l.secureConfig(urlParts.Query())
+		if err != nil {
+			return nil, err
+		}
+
+		return CreateSecureNetServer(urlParts.Host, config)
 	case "ws":
 		return CreateWebSocketServer(urlParts.Host)
 	case "wss":
-		return CreateSecureWebSocketServer(urlParts.Host, l.TLSConfig)
+		config, err := l.secureConfig(urlParts.Query())
+		if err != nil {
+			return nil, err
+		}
+
+		return CreateSecureWebSocketServer(urlParts.Host, config)
 	}
 
 	return nil, ErrUnsupportedProtocol
 }
+
+// Close will close the challenge server if it has been started and stop the
+// rotation of session ticket keys.
+func (l *Launcher) Close() error {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// stop rotation
+	if l.tickets != nil {
+		l.tickets.close()
+		l.tickets = nil
+	}
+
+	// check listener
+	if l.challengeListener == nil {
+		return nil
+	}
+
+	// close listener
+	err := l.challengeListener.Close()
+	l.challengeListener = nil
+
+	return err
+}
+
+func (l *Launcher) secureConfig(query url.Values) (*tls.Config, error) {
+	// get policy
+	policy, err := ParseTLSPolicy(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// get config
+	config, err := l.baseConfig(l.TLSPolicy.merge(policy))
+	if err != nil || config == nil {
+		return config, err
+	}
+
+	// check ticket settings
+	if len(l.SessionTicketKeys) == 0 && l.SessionTicketRotation <= 0 {
+		return config, nil
+	}
+
+	// get tickets
+	tickets, err := l.ticketKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// manage copy of config
+	config = config.Clone()
+	tickets.manage(config)
+
+	return config, nil
+}
+
+func (l *Launcher) ticketKeys() (*ticketKeys, error) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// check tickets
+	if l.tickets != nil {
+		return l.tickets, nil
+	}
+
+	// create tickets
+	tickets, err := newTicketKeys(l.SessionTicketKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	// start rotation
+	if l.SessionTicketRotation > 0 {
+		tickets.start(l.SessionTicketRotation)
+	}
+
+	// save tickets
+	l.tickets = tickets
+
+	return tickets, nil
+}
+
+func (l *Launcher) baseConfig(policy *TLSPolicy) (*tls.Config, error) {
+	// get template
+	template := policy.apply(l.TLSConfig)
+	if l.RevocationChecker != nil {
+		template = revocationConfig(template, l.RevocationChecker)
+	}
+
+	// use provider without a manager
+	if l.CertManager == nil && l.CertProvider != nil {
+		return serverConfig(template, l.CertProvider), nil
+	}
+
+	// use static config without a manager
+	if l.CertManager == nil {
+		return template, nil
+	}
+
+	// start challenge server
+	err := l.startChallengeServer()
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare config
+	config := &tls.Config{}
+	if template != nil {
+		config = template.Clone()
+	}
+
+	// get certificates from manager
+	config.Certificates = nil
+	config.GetCertificate = l.CertManager.GetCertificate
+
+	// negotiate the acme protocol only for challenges to not interfere with
+	// the protocols negotiated by regular clients
+	acmeConfig := config.Clone()
+	acmeConfig.NextProtos = []string{ACMEProtocol}
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		for _, proto := range hello.SupportedProtos {
+			if proto == ACMEProtocol {
+				return acmeConfig, nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	return config, nil
+}
+
+func (l *Launcher) startChallengeServer() error {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// check address and listener
+	if l.ChallengeAddress == "" || l.challengeListener != nil {
+		return nil
+	}
+
+	// create listener
+	listener, err := net.Listen("tcp", l.ChallengeAddress)
+	if err != nil {
+		return err
+	}
+
+	// serve challenges
+	go func() {
+		_ = http.Serve(listener, l.CertManager.HTTPHandler(nil))
+	}()
+
+	// save listener
+	l.challengeListener = listener
+
+	return nil
+}
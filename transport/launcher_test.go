@@ -1,7 +1,13 @@
 package transport
 
 import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,3 +32,189 @@ func TestLauncherUnsupportedProtocol(t *testing.T) {
 	assert.Nil(t, conn)
 	assert.Equal(t, ErrUnsupportedProtocol, err)
 }
+
+type testCertManager struct {
+	names []string
+}
+
+func (m *testCertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.names = append(m.names, hello.ServerName)
+	return &serverTLSConfig.Certificates[0], nil
+}
+
+func (m *testCertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("challenge"))
+	})
+}
+
+func TestLauncherCertManager(t *testing.T) {
+	manager := &testCertManager{}
+
+	launcher := NewLauncher()
+	launcher.CertManager = manager
+	launcher.ChallengeAddress = "localhost:0"
+
+	for _, scheme := range []string{"tls", "wss"} {
+		server, err := launcher.Launch(scheme + "://localhost:0")
+		require.NoError(t, err)
+
+		// accept connections to complete handshakes
+		go func() {
+			for {
+				conn, err := server.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					_, _ = conn.Receive()
+				}()
+			}
+		}()
+
+		// regular client
+		conn, err := tls.Dial("tcp", server.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         []string{"mqtt"},
+			InsecureSkipVerify: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "", conn.ConnectionState().NegotiatedProtocol)
+		assert.NoError(t, conn.Close())
+
+		// acme client
+		conn, err = tls.Dial("tcp", server.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         []string{ACMEProtocol},
+			InsecureSkipVerify: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ACMEProtocol, conn.ConnectionState().NegotiatedProtocol)
+		assert.NoError(t, conn.Close())
+
+		assert.NoError(t, server.Close())
+	}
+
+	assert.Equal(t, []string{"example.com", "example.com", "example.com", "example.com"}, manager.names)
+
+	// challenge server
+	res, err := http.Get("http://" + launcher.challengeListener.Addr().String() + "/.well-known/acme-challenge/foo")
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "challenge", string(body))
+	assert.NoError(t, res.Body.Close())
+
+	assert.NoError(t, launcher.Close())
+	assert.Nil(t, launcher.challengeListener)
+}
+
+func TestLauncherSessionTicketKeys(t *testing.T) {
+	key, err := newTicketKey()
+	require.NoError(t, err)
+
+	dialer := NewDialer()
+	dialer.TLSConfig = &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+	}
+	dialer.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+
+	for i, resumed := range []bool{false, true} {
+		launcher := NewLauncher()
+		launcher.TLSConfig = serverTLSConfig
+		launcher.SessionTicketKeys = [][32]byte{key}
+		launcher.SessionTicketRotation = time.Minute
+
+		server, err := launcher.Launch("tls://localhost:0")
+		require.NoError(t, err)
+
+		go func() {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			pkt, err := conn.Receive()
+			assert.NoError(t, err)
+			assert.NoError(t, conn.Send(pkt, false))
+		}()
+
+		conn, err := dialer.Dial(getURL(server, "tls"))
+		require.NoError(t, err)
+
+		// exchange packets to receive the session ticket
+		err = conn.Send(packet.NewPingreq(), false)
+		assert.NoError(t, err)
+		_, err = conn.Receive()
+		assert.NoError(t, err)
+
+		state, ok := ConnectionState(conn)
+		assert.True(t, ok)
+		assert.Equal(t, resumed, state.DidResume, i)
+
+		assert.NoError(t, conn.Close())
+		assert.NoError(t, server.Close())
+		assert.NoError(t, launcher.Close())
+		assert.Nil(t, launcher.tickets)
+	}
+}
+
+func TestLauncherTLSPolicy(t *testing.T) {
+	launcher := NewLauncher()
+	launcher.TLSConfig = serverTLSConfig
+	launcher.TLSPolicy = &TLSPolicy{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	server, err := launcher.Launch("tls://localhost:0?min-version=1.3")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			pkt, err := conn.Receive()
+			if err == nil {
+				_ = conn.Send(pkt, false)
+			}
+		}
+	}()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+	}
+
+	conn, err := dialer.Dial(getURL(server, "tls") + "?max-version=1.2")
+	if err == nil {
+		_, err = conn.Receive()
+	}
+	assert.Error(t, err)
+
+	conn, err = dialer.Dial(getURL(server, "tls") + "?min-version=1.3&curves=X25519")
+	require.NoError(t, err)
+
+	err = conn.Send(packet.NewPingreq(), false)
+	assert.NoError(t, err)
+	_, err = conn.Receive()
+	assert.NoError(t, err)
+
+	state, ok := ConnectionState(conn)
+	assert.True(t, ok)
+	assert.Equal(t, uint16(tls.VersionTLS13), state.Version)
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+
+	_, err = launcher.Launch("tls://localhost:0?min-version=2.0")
+	assert.Equal(t, ErrInvalidTLSPolicy, err)
+
+	_, err = dialer.Dial("tls://localhost:1234?curves=foo")
+	assert.Equal(t, ErrInvalidTLSPolicy, err)
+}
@@ -45,6 +45,14 @@ func TestNetConnReadTimeout(t *testing.T) {
 	abstractConnReadTimeoutTest(t, "tcp")
 }
 
+func TestNetConnReceiveRate(t *testing.T) {
+	abstractConnReceiveRateTest(t, "tcp")
+}
+
+func TestNetConnReceiveRateClose(t *testing.T) {
+	abstractConnReceiveRateCloseTest(t, "tcp")
+}
+
 func TestNetConnCloseAfterClose(t *testing.T) {
 	abstractConnCloseAfterCloseTest(t, "tcp")
 }
@@ -3,6 +3,7 @@ package transport
 import (
 	"crypto/tls"
 	"net"
+	"os"
 	"time"
 )
 
@@ -10,13 +11,29 @@ import (
 type NetServer struct {
 	MaxWriteDelay time.Duration
 
-	listener net.Listener
+	listener  net.Listener
+	deadliner deadliner
+	filer     filer
+}
+
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+type filer interface {
+	File() (*os.File, error)
 }
 
 // NewNetServer wraps the provided listener.
 func NewNetServer(listener net.Listener) *NetServer {
+	// get deadliner and filer
+	d, _ := listener.(deadliner)
+	f, _ := listener.(filer)
+
 	return &NetServer{
-		listener: listener,
+		listener:  listener,
+		deadliner: d,
+		filer:     f,
 	}
 }
 
@@ -32,12 +49,21 @@ func CreateNetServer(address string) (*NetServer, error) {
 
 // CreateSecureNetServer creates a new TLS server that listens on the provided address.
 func CreateSecureNetServer(address string, config *tls.Config) (*NetServer, error) {
-	listener, err := tls.Listen("tcp", address, config)
+	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewNetServer(listener), nil
+	return newSecureNetServer(listener, config), nil
+}
+
+func newSecureNetServer(listener net.Listener, config *tls.Config) *NetServer {
+	// wrap listener and keep the tcp listener to set deadlines and get files
+	server := NewNetServer(tls.NewListener(listener, config))
+	server.deadliner, _ = listener.(deadliner)
+	server.filer, _ = listener.(filer)
+
+	return server
 }
 
 // Accept will return the next available connection or block until a
@@ -67,6 +93,29 @@ func (s *NetServer) Close() error {
 	return nil
 }
 
+// SetDeadline will set the deadline for pending and future calls to Accept. An
+// ErrDeadlineUnsupported is returned if the listener does not support deadlines.
+func (s *NetServer) SetDeadline(t time.Time) error {
+	// check deadliner
+	if s.deadliner == nil {
+		return ErrDeadlineUnsupported
+	}
+
+	return s.deadliner.SetDeadline(t)
+}
+
+// File returns a duplicate of the underlying listening socket that can be
+// passed to another process. An ErrHandoffUnsupported is returned if the
+// listener does not provide a file.
+func (s *NetServer) File() (*os.File, error) {
+	// check filer
+	if s.filer == nil {
+		return nil, ErrHandoffUnsupported
+	}
+
+	return s.filer.File()
+}
+
 // Addr returns the server's network address.
 func (s *NetServer) Addr() net.Addr {
 	return s.listener.Addr()
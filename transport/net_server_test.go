@@ -31,3 +31,11 @@ func TestNetServerCloseAfterClose(t *testing.T) {
 func TestNetServerAddr(t *testing.T) {
 	abstractServerAddrTest(t, "tcp")
 }
+
+func TestTCPServerDeadline(t *testing.T) {
+	abstractServerDeadlineTest(t, "tcp")
+}
+
+func TestTLSServerDeadline(t *testing.T) {
+	abstractServerDeadlineTest(t, "tls")
+}
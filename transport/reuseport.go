@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"runtime"
+)
+
+// ErrReusePortUnsupported is returned if SO_REUSEPORT is not supported by the
+// platform or protocol.
+var ErrReusePortUnsupported = errors.New("reuse port unsupported")
+
+// ListenReusePort creates a TCP listener with the SO_REUSEPORT option set.
+// Multiple listeners may be created on the same address and the kernel will
+// distribute incoming connections between them.
+func ListenReusePort(address string) (net.Listener, error) {
+	// check support
+	if reusePort == nil {
+		return nil, ErrReusePortUnsupported
+	}
+
+	// prepare config
+	config := net.ListenConfig{
+		Control: reusePort,
+	}
+
+	return config.Listen(context.Background(), "tcp", address)
+}
+
+// LaunchShards is a shorthand function.
+func LaunchShards(urlString string, count int) ([]Server, error) {
+	return sharedLauncher.LaunchShards(urlString, count)
+}
+
+// LaunchShards will launch the specified number of servers that listen on the
+// same address using SO_REUSEPORT. Accepting connections from every server in
+// a separate goroutine removes the single accept loop as a bottleneck when
+// many clients connect at once. A random port that is requested using the
+// port zero is shared by all servers.
+//
+// The count will default to the number of CPUs.
+func (l *Launcher) LaunchShards(urlString string, count int) ([]Server, error) {
+	urlParts, err := url.ParseRequestURI(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	// set default count
+	if count <= 0 {
+		count = runtime.NumCPU()
+	}
+
+	// get secure config
+	var config *tls.Config
+	switch urlParts.Scheme {
+	case "tcp", "mqtt", "ws":
+	case "tls", "mqtts", "wss":
+		config, err = l.secureConfig(urlParts.Query())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+
+	// launch servers
+	address := urlParts.Host
+	servers := make([]Server, 0, count)
+	for i := 0; i < count; i++ {
+		// create listener
+		listener, err := ListenReusePort(address)
+		if err != nil {
+			closeServers(servers)
+			return nil, err
+		}
+
+		// use the address of the first listener for the other listeners
+		address = listener.Addr().String()
+
+		// wrap secure listener
+		if config != nil {
+			listener = tls.NewListener(listener, config)
+		}
+
+		// create server
+		switch urlParts.Scheme {
+		case "tcp", "mqtt", "tls", "mqtts":
+			servers = append(servers, NewNetServer(listener))
+		case "ws", "wss":
+			servers = append(servers, NewWebSocketServer(listener))
+		}
+	}
+
+	return servers, nil
+}
+
+func closeServers(servers []Server) {
+	for _, server := range servers {
+		_ = server.Close()
+	}
+}
@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package transport
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,8 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package transport
+
+// the syscall package does not define the option on linux
+const soReusePort = 0x200
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunchShards(t *testing.T) {
+	if reusePort == nil {
+		t.Skip("reuse port unsupported")
+	}
+
+	servers, err := LaunchShards("tcp://localhost:0", 4)
+	require.NoError(t, err)
+	require.Len(t, servers, 4)
+
+	addr := servers[0].Addr().String()
+	for _, server := range servers {
+		assert.Equal(t, addr, server.Addr().String())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(20)
+
+	for _, server := range servers {
+		go func(server Server) {
+			for {
+				conn, err := server.Accept()
+				if err != nil {
+					return
+				}
+
+				pkt, err := conn.Receive()
+				assert.NoError(t, err)
+				assert.Equal(t, packet.PINGREQ, pkt.Type())
+				assert.NoError(t, conn.Close())
+				wg.Done()
+			}
+		}(server)
+	}
+
+	for i := 0; i < 20; i++ {
+		conn, err := Dial("tcp://" + addr)
+		require.NoError(t, err)
+		assert.NoError(t, conn.Send(packet.NewPingreq(), false))
+		_, _ = conn.Receive()
+	}
+
+	wg.Wait()
+
+	for _, server := range servers {
+		assert.NoError(t, server.Close())
+	}
+}
+
+func TestLaunchShardsUnsupportedProtocol(t *testing.T) {
+	servers, err := LaunchShards("foo://localhost", 2)
+	assert.Nil(t, servers)
+	assert.Equal(t, ErrUnsupportedProtocol, err)
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package transport
+
+import "syscall"
+
+var reusePort = func(network, address string, conn syscall.RawConn) error {
+	// set option
+	var err error
+	err2 := conn.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err2 != nil {
+		return err2
+	}
+
+	return err
+}
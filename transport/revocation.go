@@ -0,0 +1,237 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrCertificateRevoked is returned by a RevocationChecker if a certificate
+// has been revoked.
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// ErrRevocationListExpired is returned by a CRLChecker that rejects expired
+// lists if the list of an issuer is past its next update.
+var ErrRevocationListExpired = errors.New("revocation list expired")
+
+// ErrMissingRevocationList is returned by NewCRLChecker if no revocation list
+// has been found in the provided data.
+var ErrMissingRevocationList = errors.New("missing revocation list")
+
+// A RevocationChecker checks whether the certificates presented by clients of
+// secure servers have been revoked. It is called for every certificate of the
+// verified chains except for the root.
+type RevocationChecker interface {
+	// Check should return an error if the certificate issued by the issuer
+	// has been revoked or its status cannot be determined.
+	Check(cert, issuer *x509.Certificate) error
+}
+
+// RevocationCheckerFunc allows ordinary functions to be used as revocation
+// checkers, e.g. to query an OCSP responder using golang.org/x/crypto/ocsp.
+type RevocationCheckerFunc func(cert, issuer *x509.Certificate) error
+
+// Check implements the RevocationChecker interface.
+func (fn RevocationCheckerFunc) Check(cert, issuer *x509.Certificate) error {
+	return fn(cert, issuer)
+}
+
+// A CRLChecker checks certificates against a set of certificate revocation
+// lists. Lists are only used for certificates of the issuer that signed them.
+// Certificates of issuers without a list are accepted.
+type CRLChecker struct {
+	// RejectExpired may be set to reject certificates of issuers whose list
+	// is past its next update.
+	RejectExpired bool
+
+	// The function used to get the current time.
+	//
+	// Will default to time.Now.
+	Now func() time.Time
+
+	lists []*x509.RevocationList
+	mutex sync.RWMutex
+}
+
+// NewCRLChecker returns a new CRLChecker that uses the revocation lists in the
+// provided PEM or DER encoded data.
+func NewCRLChecker(data []byte) (*CRLChecker, error) {
+	// create checker
+	checker := &CRLChecker{
+		Now: time.Now,
+	}
+
+	// load lists
+	err := checker.Update(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return checker, nil
+}
+
+// LoadCRLChecker returns a new CRLChecker that uses the revocation lists in
+// the specified file.
+func LoadCRLChecker(path string) (*CRLChecker, error) {
+	// read file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCRLChecker(data)
+}
+
+// Update will replace the revocation lists with the lists in the provided PEM
+// or DER encoded data. It may be called concurrently with Check to reload the
+// lists when they have been renewed.
+func (c *CRLChecker) Update(data []byte) error {
+	// parse lists
+	lists, err := parseRevocationLists(data)
+	if err != nil {
+		return err
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// set lists
+	c.lists = lists
+
+	return nil
+}
+
+// Check implements the RevocationChecker interface.
+func (c *CRLChecker) Check(cert, issuer *x509.Certificate) error {
+	// acquire mutex
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// get time
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+
+	for _, list := range c.lists {
+		// skip lists of other issuers
+		if !bytes.Equal(list.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+
+		// skip lists not signed by the issuer
+		if list.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+
+		// check expiry
+		if c.RejectExpired && !list.NextUpdate.IsZero() && now().After(list.NextUpdate) {
+			return ErrRevocationListExpired
+		}
+
+		// check entries
+		for _, entry := range list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return ErrCertificateRevoked
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseRevocationLists(data []byte) ([]*x509.RevocationList, error) {
+	// parse DER encoded list
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*x509.RevocationList{list}, nil
+	}
+
+	// parse PEM encoded lists
+	var lists []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		// skip other blocks
+		if block.Type != "X509 CRL" {
+			continue
+		}
+
+		// parse list
+		list, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, list)
+	}
+
+	// check lists
+	if len(lists) == 0 {
+		return nil, ErrMissingRevocationList
+	}
+
+	return lists, nil
+}
+
+// revocationConfig returns a copy of the config that checks the verified
+// chains of clients using the checker. Connections are accepted if at least
+// one chain passes the checks.
+func revocationConfig(template *tls.Config, checker RevocationChecker) *tls.Config {
+	// prepare config
+	config := &tls.Config{}
+	if template != nil {
+		config = template.Clone()
+	}
+
+	// check chains after verification
+	verify := config.VerifyConnection
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		// call existing function
+		if verify != nil {
+			err := verify(state)
+			if err != nil {
+				return err
+			}
+		}
+
+		// check chains
+		var err error
+		for _, chain := range state.VerifiedChains {
+			err = checkChain(chain, checker)
+			if err == nil {
+				return nil
+			}
+		}
+
+		return err
+	}
+
+	return config
+}
+
+func checkChain(chain []*x509.Certificate, checker RevocationChecker) error {
+	// check all certificates except the root
+	for i := 0; i < len(chain)-1; i++ {
+		err := checker.Check(chain[i], chain[i+1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func revokeCerts(ca *tls.Certificate, nextUpdate time.Time, certs ...*tls.Certificate) []byte {
+	// prepare template
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: nextUpdate,
+	}
+
+	// add entries
+	for _, cert := range certs {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   cert.Leaf.SerialNumber,
+			RevocationTime: time.Now(),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Leaf, ca.PrivateKey.(crypto.Signer))
+	if err != nil {
+		panic(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestCRLChecker(t *testing.T) {
+	now := time.Now()
+	ca := issueCert(nil, "ca", now.Add(-time.Hour), now.Add(time.Hour))
+	other := issueCert(nil, "other", now.Add(-time.Hour), now.Add(time.Hour))
+	revoked := issueCert(ca, "revoked", now.Add(-time.Hour), now.Add(time.Hour))
+	valid := issueCert(ca, "valid", now.Add(-time.Hour), now.Add(time.Hour))
+
+	checker, err := NewCRLChecker(revokeCerts(ca, now.Add(time.Hour), revoked))
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrCertificateRevoked, checker.Check(revoked.Leaf, ca.Leaf))
+	assert.NoError(t, checker.Check(valid.Leaf, ca.Leaf))
+	assert.NoError(t, checker.Check(revoked.Leaf, other.Leaf))
+
+	checker.RejectExpired = true
+	checker.Now = func() time.Time {
+		return now.Add(2 * time.Hour)
+	}
+	assert.Equal(t, ErrRevocationListExpired, checker.Check(valid.Leaf, ca.Leaf))
+
+	err = checker.Update(revokeCerts(ca, now.Add(3*time.Hour)))
+	assert.NoError(t, err)
+	assert.NoError(t, checker.Check(revoked.Leaf, ca.Leaf))
+
+	_, err = NewCRLChecker([]byte("-----BEGIN FOO-----\n-----END FOO-----\n"))
+	assert.Equal(t, ErrMissingRevocationList, err)
+}
+
+func TestLauncherRevocationChecker(t *testing.T) {
+	now := time.Now()
+	ca := issueCert(nil, "ca", now.Add(-time.Hour), now.Add(time.Hour))
+	server := issueCert(ca, "localhost", now.Add(-time.Hour), now.Add(time.Hour))
+	revoked := issueCert(ca, "revoked", now.Add(-time.Hour), now.Add(time.Hour))
+	valid := issueCert(ca, "valid", now.Add(-time.Hour), now.Add(time.Hour))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	checker, err := NewCRLChecker(revokeCerts(ca, now.Add(time.Hour), revoked))
+	require.NoError(t, err)
+
+	launcher := NewLauncher()
+	launcher.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{*server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	launcher.RevocationChecker = checker
+
+	srv, err := launcher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := srv.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				pkt, err := conn.Receive()
+				if err == nil {
+					_ = conn.Send(pkt, false)
+				}
+			}()
+		}
+	}()
+
+	for _, cert := range []*tls.Certificate{revoked, valid} {
+		dialer := NewDialer()
+		dialer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			RootCAs:      pool,
+		}
+
+		conn, err := dialer.Dial(getURL(srv, "tls"))
+		if err == nil {
+			err = conn.Send(packet.NewPingreq(), false)
+		}
+		if err == nil {
+			_, err = conn.Receive()
+		}
+
+		if cert == revoked {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+
+	assert.NoError(t, srv.Close())
+}
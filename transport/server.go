@@ -1,6 +1,9 @@
 package transport
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 // A Server is a local port on which incoming connections can be accepted.
 type Server interface {
@@ -14,4 +17,9 @@ type Server interface {
 
 	// Addr returns the server's network address.
 	Addr() net.Addr
+
+	// SetDeadline will set the deadline for pending and future calls to
+	// Accept, which return an error that wraps os.ErrDeadlineExceeded once it
+	// has been reached. A zero value disables the deadline.
+	SetDeadline(t time.Time) error
 }
@@ -1,9 +1,12 @@
 package transport
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/256dpi/gomqtt/packet"
 
@@ -92,3 +95,40 @@ func abstractServerAddrTest(t *testing.T, protocol string) {
 	err = server.Close()
 	assert.NoError(t, err)
 }
+
+func abstractServerDeadlineTest(t *testing.T, protocol string) {
+	server, err := testLauncher.Launch(protocol + "://localhost:0")
+	require.NoError(t, err)
+
+	err = server.SetDeadline(time.Now().Add(10 * time.Millisecond))
+	assert.NoError(t, err)
+
+	conn, err := server.Accept()
+	assert.Nil(t, conn)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	err = server.SetDeadline(time.Time{})
+	assert.NoError(t, err)
+
+	errs := make(chan error)
+
+	go func() {
+		_, err := server.Accept()
+		errs <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	err = server.SetDeadline(time.Now())
+	assert.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	case <-time.After(time.Second):
+		t.Fatal("accept not interrupted")
+	}
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// retainedTicketKeys is the number of keys retained during rotation. Tickets
+// therefore remain valid for at least two rotation intervals.
+const retainedTicketKeys = 3
+
+// ticketKeys manages the session ticket keys of the configs created by a
+// launcher. All configs share the same keys to allow clients to resume
+// sessions with any of the launched servers.
+type ticketKeys struct {
+	keys    [][32]byte
+	configs []*tls.Config
+	stop    chan struct{}
+	mutex   sync.Mutex
+}
+
+func newTicketKeys(keys [][32]byte) (*ticketKeys, error) {
+	// generate initial key if missing
+	if len(keys) == 0 {
+		key, err := newTicketKey()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = [][32]byte{key}
+	}
+
+	return &ticketKeys{
+		keys: keys,
+	}, nil
+}
+
+func newTicketKey() ([32]byte, error) {
+	var key [32]byte
+	_, err := rand.Read(key[:])
+	return key, err
+}
+
+// manage will set the current keys on the config and update them on rotation.
+// Configs returned by GetConfigForClient are updated before every handshake.
+func (t *ticketKeys) manage(config *tls.Config) {
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// set keys
+	config.SetSessionTicketKeys(t.keys)
+
+	// update configs for clients
+	if fn := config.GetConfigForClient; fn != nil {
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg, err := fn(hello)
+			if cfg != nil {
+				cfg.SetSessionTicketKeys(t.current())
+			}
+
+			return cfg, err
+		}
+	}
+
+	// add config
+	t.configs = append(t.configs, config)
+}
+
+func (t *ticketKeys) current() [][32]byte {
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.keys
+}
+
+// start will rotate the keys in the specified interval until stopped.
+func (t *ticketKeys) start(interval time.Duration) {
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// check state
+	if t.stop != nil {
+		return
+	}
+
+	// prepare channel
+	stop := make(chan struct{})
+	t.stop = stop
+
+	go func() {
+		// create ticker
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// generate key, a failed rotation is retried on the next tick
+				key, err := newTicketKey()
+				if err == nil {
+					t.rotate(key)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (t *ticketKeys) rotate(key [32]byte) {
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// prepend key and drop expired keys
+	keys := append([][32]byte{key}, t.keys...)
+	if len(keys) > retainedTicketKeys {
+		keys = keys[:retainedTicketKeys]
+	}
+
+	// update configs
+	for _, config := range t.configs {
+		config.SetSessionTicketKeys(keys)
+	}
+
+	t.keys = keys
+}
+
+// close will stop the rotation.
+func (t *ticketKeys) close() {
+	// acquire mutex
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// stop rotation
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
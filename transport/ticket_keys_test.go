@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketKeysRotation(t *testing.T) {
+	tickets, err := newTicketKeys(nil)
+	require.NoError(t, err)
+	assert.Len(t, tickets.current(), 1)
+
+	config := &tls.Config{}
+	tickets.manage(config)
+
+	first := tickets.current()[0]
+
+	for i := 0; i < 5; i++ {
+		key, err := newTicketKey()
+		require.NoError(t, err)
+		tickets.rotate(key)
+	}
+
+	keys := tickets.current()
+	assert.Len(t, keys, retainedTicketKeys)
+	assert.NotContains(t, keys, first)
+
+	tickets.start(time.Millisecond)
+	tickets.close()
+	assert.Nil(t, tickets.stop)
+}
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidTLSPolicy is returned by ParseTLSPolicy, Launch and Dial if the
+// URL contains an unknown TLS version, cipher suite or curve.
+var ErrInvalidTLSPolicy = errors.New("invalid tls policy")
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519":         tls.X25519,
+	"P256":           tls.CurveP256,
+	"P384":           tls.CurveP384,
+	"P521":           tls.CurveP521,
+	"X25519MLKEM768": tls.X25519MLKEM768,
+}
+
+// A TLSPolicy restricts the protocol versions, cipher suites and curves that
+// are negotiated by secure servers and dialers. Zero fields keep the settings
+// of the TLS config or the defaults of the crypto/tls package.
+type TLSPolicy struct {
+	// The minimum and maximum TLS versions, e.g. tls.VersionTLS12.
+	MinVersion uint16
+	MaxVersion uint16
+
+	// The enabled TLS 1.0-1.2 cipher suites. TLS 1.3 suites are not
+	// configurable.
+	CipherSuites []uint16
+
+	// The curves used for key exchanges in preference order.
+	CurvePreferences []tls.CurveID
+}
+
+// ParseTLSPolicy parses a policy from the query of a URL. The following
+// options are supported:
+//
+//	min-version=1.2
+//	max-version=1.3
+//	cipher-suites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,...
+//	curves=X25519,P256,P384,P521,X25519MLKEM768
+//
+// Cipher suites are specified using the names returned by tls.CipherSuiteName.
+// Other options are ignored. The returned policy is nil if no option is set.
+func ParseTLSPolicy(query url.Values) (*TLSPolicy, error) {
+	// prepare policy
+	var policy TLSPolicy
+	var found bool
+
+	// parse versions
+	for key, version := range map[string]*uint16{
+		"min-version": &policy.MinVersion,
+		"max-version": &policy.MaxVersion,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+
+		v, ok := tlsVersions[value]
+		if !ok {
+			return nil, ErrInvalidTLSPolicy
+		}
+
+		*version = v
+		found = true
+	}
+
+	// parse cipher suites
+	if value := query.Get("cipher-suites"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			id, ok := cipherSuite(strings.TrimSpace(name))
+			if !ok {
+				return nil, ErrInvalidTLSPolicy
+			}
+
+			policy.CipherSuites = append(policy.CipherSuites, id)
+		}
+
+		found = true
+	}
+
+	// parse curves
+	if value := query.Get("curves"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			id, ok := tlsCurves[strings.TrimSpace(name)]
+			if !ok {
+				return nil, ErrInvalidTLSPolicy
+			}
+
+			policy.CurvePreferences = append(policy.CurvePreferences, id)
+		}
+
+		found = true
+	}
+
+	// check options
+	if !found {
+		return nil, nil
+	}
+
+	return &policy, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	// check secure and insecure suites
+	for _, list := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range list {
+			if suite.Name == name {
+				return suite.ID, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// merge returns a policy with the set fields of the other policy overriding
+// the fields of this policy.
+func (p *TLSPolicy) merge(other *TLSPolicy) *TLSPolicy {
+	// check policies
+	if p == nil {
+		return other
+	} else if other == nil {
+		return p
+	}
+
+	// copy policy
+	policy := *p
+
+	// override fields
+	if other.MinVersion != 0 {
+		policy.MinVersion = other.MinVersion
+	}
+	if other.MaxVersion != 0 {
+		policy.MaxVersion = other.MaxVersion
+	}
+	if other.CipherSuites != nil {
+		policy.CipherSuites = other.CipherSuites
+	}
+	if other.CurvePreferences != nil {
+		policy.CurvePreferences = other.CurvePreferences
+	}
+
+	return &policy
+}
+
+// apply returns a copy of the config with the policy applied. The config is
+// returned unchanged if the policy is nil.
+func (p *TLSPolicy) apply(config *tls.Config) *tls.Config {
+	// check policy
+	if p == nil {
+		return config
+	}
+
+	// prepare config
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	// set fields
+	if p.MinVersion != 0 {
+		config.MinVersion = p.MinVersion
+	}
+	if p.MaxVersion != 0 {
+		config.MaxVersion = p.MaxVersion
+	}
+	if p.CipherSuites != nil {
+		config.CipherSuites = p.CipherSuites
+	}
+	if p.CurvePreferences != nil {
+		config.CurvePreferences = p.CurvePreferences
+	}
+
+	return config
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLSPolicy(t *testing.T) {
+	policy, err := ParseTLSPolicy(url.Values{"foo": {"bar"}})
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = ParseTLSPolicy(url.Values{
+		"min-version":   {"1.2"},
+		"max-version":   {"1.3"},
+		"cipher-suites": {"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		"curves":        {"X25519,P256"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &TLSPolicy{
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}, policy)
+
+	for _, query := range []url.Values{
+		{"min-version": {"1.4"}},
+		{"max-version": {"foo"}},
+		{"cipher-suites": {"TLS_FOO"}},
+		{"curves": {"P128"}},
+	} {
+		policy, err = ParseTLSPolicy(query)
+		assert.Equal(t, ErrInvalidTLSPolicy, err)
+		assert.Nil(t, policy)
+	}
+}
+
+func TestTLSPolicyApply(t *testing.T) {
+	var policy *TLSPolicy
+	assert.Nil(t, policy.apply(nil))
+
+	policy = (&TLSPolicy{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519},
+	}).merge(&TLSPolicy{
+		MinVersion: tls.VersionTLS13,
+	})
+
+	config := &tls.Config{
+		ServerName: "example.com",
+		MaxVersion: tls.VersionTLS13,
+	}
+
+	applied := policy.apply(config)
+	assert.Equal(t, "example.com", applied.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), applied.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), applied.MaxVersion)
+	assert.Equal(t, []tls.CurveID{tls.X25519}, applied.CurvePreferences)
+	assert.Equal(t, uint16(0), config.MinVersion)
+}
@@ -12,3 +12,7 @@ var ErrUnsupportedProtocol = errors.New("unsupported protocol")
 //
 // Note: this error is wrapped in an Error with NetworkError code.
 var ErrAcceptAfterClose = errors.New("accept after close")
+
+// ErrDeadlineUnsupported is returned by a NetServer if the wrapped listener
+// does not support deadlines.
+var ErrDeadlineUnsupported = errors.New("deadline unsupported")
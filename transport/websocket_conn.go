@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,6 +17,8 @@ var ErrNotBinary = errors.New("received web socket message is not binary")
 type wsStream struct {
 	conn   *websocket.Conn
 	reader io.Reader
+	done   chan struct{}
+	once   sync.Once
 }
 
 func (s *wsStream) Read(p []byte) (int, error) {
@@ -86,6 +89,11 @@ func (s *wsStream) Close() error {
 	// connection, therefore we don't have to really care about announcing a
 	// server-side connection close.
 
+	// stop keep alive
+	s.once.Do(func() {
+		close(s.done)
+	})
+
 	return s.conn.Close()
 }
 
@@ -99,17 +107,89 @@ func (s *wsStream) SetReadDeadline(t time.Time) error {
 type WebSocketConn struct {
 	*BaseConn
 
-	conn *websocket.Conn
+	conn   *websocket.Conn
+	stream *wsStream
+	path   string
 }
 
 // NewWebSocketConn returns a new WebSocketConn.
 func NewWebSocketConn(conn *websocket.Conn, maxWriteDelay time.Duration) *WebSocketConn {
+	// create stream
+	stream := &wsStream{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+
 	return &WebSocketConn{
-		BaseConn: NewBaseConn(&wsStream{conn: conn}, maxWriteDelay),
+		BaseConn: NewBaseConn(stream, maxWriteDelay),
 		conn:     conn,
+		stream:   stream,
 	}
 }
 
+// keepAlive will send ping control frames in the specified interval and close
+// the connection if a pong has not been received within the timeout. Pongs are
+// only handled while the connection is receiving packets.
+func (c *WebSocketConn) keepAlive(interval, timeout time.Duration) {
+	// prepare timer
+	var timer *time.Timer
+	var mutex sync.Mutex
+
+	// stop timer on pongs
+	c.conn.SetPongHandler(func(string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+
+		return nil
+	})
+
+	go func() {
+		// create ticker
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// stop timer on return
+		defer func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-c.stream.done:
+				return
+			}
+
+			// send ping, control frames may be written concurrently
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval))
+			if err != nil {
+				return
+			}
+
+			// await pong
+			if timeout > 0 {
+				mutex.Lock()
+				if timer == nil {
+					timer = time.AfterFunc(timeout, func() {
+						_ = c.conn.Close()
+					})
+				}
+				mutex.Unlock()
+			}
+		}
+	}()
+}
+
 // LocalAddr returns the local network address.
 func (c *WebSocketConn) LocalAddr() net.Addr {
 	return c.conn.LocalAddr()
@@ -120,6 +200,11 @@ func (c *WebSocketConn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// Path returns the request path of a connection accepted by a WebSocketServer.
+func (c *WebSocketConn) Path() string {
+	return c.path
+}
+
 // UnderlyingConn returns the underlying websocket.Conn.
 func (c *WebSocketConn) UnderlyingConn() *websocket.Conn {
 	return c.conn
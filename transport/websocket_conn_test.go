@@ -3,11 +3,13 @@ package transport
 import (
 	"io"
 	"testing"
+	"time"
 
 	"github.com/256dpi/gomqtt/packet"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWebSocketConnConnection(t *testing.T) {
@@ -46,6 +48,14 @@ func TestWebSocketConnReadTimeout(t *testing.T) {
 	abstractConnReadTimeoutTest(t, "ws")
 }
 
+func TestWebSocketConnReceiveRate(t *testing.T) {
+	abstractConnReceiveRateTest(t, "ws")
+}
+
+func TestWebSocketConnReceiveRateClose(t *testing.T) {
+	abstractConnReceiveRateCloseTest(t, "ws")
+}
+
 func TestWebSocketConnCloseAfterClose(t *testing.T) {
 	abstractConnCloseAfterCloseTest(t, "ws")
 }
@@ -220,3 +230,80 @@ func BenchmarkWebSocketConnAsync(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestWebSocketConnServerPings(t *testing.T) {
+	server, err := CreateWebSocketServer("localhost:0")
+	require.NoError(t, err)
+	server.PingInterval = 10 * time.Millisecond
+
+	go func() {
+		conn, err := server.Accept()
+		if err == nil {
+			_, _ = conn.Receive()
+		}
+	}()
+
+	conn, err := testDialer.Dial(getURL(server, "ws"))
+	require.NoError(t, err)
+
+	pings := make(chan struct{}, 10)
+	ws := conn.(*WebSocketConn).UnderlyingConn()
+	ws.SetPingHandler(func(data string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	go func() {
+		_, _ = conn.Receive()
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("ping not received")
+		}
+	}
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestWebSocketConnClientPongTimeout(t *testing.T) {
+	server, err := CreateWebSocketServer("localhost:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		// ignore pings
+		conn.(*WebSocketConn).UnderlyingConn().SetPingHandler(func(string) error {
+			return nil
+		})
+
+		_, _ = conn.Receive()
+		close(done)
+	}()
+
+	dialer := NewDialer()
+	dialer.PingInterval = 10 * time.Millisecond
+	dialer.PongTimeout = 10 * time.Millisecond
+
+	conn, err := dialer.Dial(getURL(server, "ws"))
+	require.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	safeReceive(done)
+
+	assert.NoError(t, server.Close())
+}
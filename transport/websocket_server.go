@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -13,30 +15,69 @@ import (
 
 var errManualClose = errors.New("internal: manual close")
 
+// A WebSocketEndpoint configures the upgrade of requests to a specific path.
+// Unset fields default to the settings of the server.
+type WebSocketEndpoint struct {
+	// The subprotocols negotiated with clients.
+	Subprotocols []string
+
+	// The function used to check the request origin.
+	OriginChecker func(r *http.Request) bool
+
+	// The settings of accepted connections.
+	MaxWriteDelay time.Duration
+	PingInterval  time.Duration
+	PongTimeout   time.Duration
+
+	upgrader *websocket.Upgrader
+}
+
 // The WebSocketServer accepts websocket.Conn based connections.
 type WebSocketServer struct {
 	MaxWriteDelay time.Duration
 
+	// PingInterval may be set to send WebSocket ping frames to clients in the
+	// specified interval. The pings are independent of the MQTT keep alive and
+	// prevent proxies from closing WebSocket connections they consider idle.
+	PingInterval time.Duration
+
+	// PongTimeout may be set together with the PingInterval to close
+	// connections that do not respond to a ping within the specified timeout.
+	PongTimeout time.Duration
+
 	listener      net.Listener
+	filer         filer
 	mux           *http.ServeMux
 	fallback      http.Handler
 	upgrader      *websocket.Upgrader
 	incoming      chan *WebSocketConn
 	originChecker func(r *http.Request) bool
 
+	endpoints      map[string]*WebSocketEndpoint
+	endpointsMutex sync.RWMutex
+
+	deadline        time.Time
+	deadlineChanged chan struct{}
+	deadlineMutex   sync.Mutex
+
 	tomb tomb.Tomb
 }
 
 // NewWebSocketServer wraps the provided listener.
 func NewWebSocketServer(listener net.Listener) *WebSocketServer {
+	// get filer
+	f, _ := listener.(filer)
+
 	// create server
 	ws := &WebSocketServer{
 		listener: listener,
+		filer:    f,
 		upgrader: &websocket.Upgrader{
 			HandshakeTimeout: 60 * time.Second,
 			Subprotocols:     []string{"mqtt", "mqttv3.1"},
 		},
-		incoming: make(chan *WebSocketConn),
+		incoming:        make(chan *WebSocketConn),
+		deadlineChanged: make(chan struct{}),
 	}
 
 	// add check origin method that uses the optional check origin function
@@ -74,12 +115,20 @@ func CreateWebSocketServer(address string) (*WebSocketServer, error) {
 // CreateSecureWebSocketServer creates a new WSS server that listens on the
 // provided address.
 func CreateSecureWebSocketServer(address string, config *tls.Config) (*WebSocketServer, error) {
-	listener, err := tls.Listen("tcp", address, config)
+	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewWebSocketServer(listener), nil
+	return newSecureWebSocketServer(listener, config), nil
+}
+
+func newSecureWebSocketServer(listener net.Listener, config *tls.Config) *WebSocketServer {
+	// wrap listener and keep the tcp listener to get files
+	server := NewWebSocketServer(tls.NewListener(listener, config))
+	server.filer, _ = listener.(filer)
+
+	return server
 }
 
 // SetFallback will register a http.Handler that gets called if a request is not
@@ -94,6 +143,69 @@ func (s *WebSocketServer) SetOriginChecker(fn func(r *http.Request) bool) {
 	s.originChecker = fn
 }
 
+// AddEndpoint will register an endpoint that upgrades requests to the
+// specified path using the endpoint specific settings. Once an endpoint has
+// been added, upgrade requests to other paths are passed to the fallback or
+// rejected.
+func (s *WebSocketServer) AddEndpoint(path string, endpoint WebSocketEndpoint) {
+	// prepare upgrader
+	endpoint.upgrader = &websocket.Upgrader{
+		HandshakeTimeout: s.upgrader.HandshakeTimeout,
+		Subprotocols:     s.upgrader.Subprotocols,
+		CheckOrigin:      s.upgrader.CheckOrigin,
+	}
+	if endpoint.Subprotocols != nil {
+		endpoint.upgrader.Subprotocols = endpoint.Subprotocols
+	}
+	if endpoint.OriginChecker != nil {
+		endpoint.upgrader.CheckOrigin = endpoint.OriginChecker
+	}
+
+	// acquire mutex
+	s.endpointsMutex.Lock()
+	defer s.endpointsMutex.Unlock()
+
+	// add endpoint
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]*WebSocketEndpoint)
+	}
+	s.endpoints[path] = &endpoint
+}
+
+func (s *WebSocketServer) endpoint(path string) (*WebSocketEndpoint, bool) {
+	// acquire mutex
+	s.endpointsMutex.RLock()
+	defer s.endpointsMutex.RUnlock()
+
+	// use server settings without endpoints
+	if len(s.endpoints) == 0 {
+		return &WebSocketEndpoint{
+			MaxWriteDelay: s.MaxWriteDelay,
+			PingInterval:  s.PingInterval,
+			PongTimeout:   s.PongTimeout,
+			upgrader:      s.upgrader,
+		}, true
+	}
+
+	// get endpoint
+	endpoint, ok := s.endpoints[path]
+	if !ok {
+		return nil, false
+	}
+
+	// apply server settings
+	settings := *endpoint
+	if settings.MaxWriteDelay == 0 {
+		settings.MaxWriteDelay = s.MaxWriteDelay
+	}
+	if settings.PingInterval == 0 {
+		settings.PingInterval = s.PingInterval
+		settings.PongTimeout = s.PongTimeout
+	}
+
+	return &settings, true
+}
+
 func (s *WebSocketServer) requestHandler(w http.ResponseWriter, r *http.Request) {
 	// ensure write delay default
 	if s.MaxWriteDelay == 0 {
@@ -106,15 +218,31 @@ func (s *WebSocketServer) requestHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// get endpoint
+	endpoint, ok := s.endpoint(r.URL.Path)
+	if !ok && s.fallback != nil {
+		s.fallback.ServeHTTP(w, r)
+		return
+	} else if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
 	// run WebSocket upgrader
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	conn, err := endpoint.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		// upgrader already responded to request
 		return
 	}
 
 	// create connection
-	webSocketConn := NewWebSocketConn(conn, s.MaxWriteDelay)
+	webSocketConn := NewWebSocketConn(conn, endpoint.MaxWriteDelay)
+	webSocketConn.path = r.URL.Path
+
+	// start keep alive
+	if endpoint.PingInterval > 0 {
+		webSocketConn.keepAlive(endpoint.PingInterval, endpoint.PongTimeout)
+	}
 
 	select {
 	case s.incoming <- webSocketConn:
@@ -126,20 +254,66 @@ func (s *WebSocketServer) requestHandler(w http.ResponseWriter, r *http.Request)
 // Accept will return the next available connection or block until a
 // connection becomes available, otherwise returns an Error.
 func (s *WebSocketServer) Accept() (Conn, error) {
-	select {
-	case <-s.tomb.Dying():
-		if s.tomb.Err() == errManualClose {
-			// server has been closed manually
-			return nil, ErrAcceptAfterClose
+	for {
+		// get deadline
+		s.deadlineMutex.Lock()
+		deadline := s.deadline
+		changed := s.deadlineChanged
+		s.deadlineMutex.Unlock()
+
+		// prepare timer
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
 		}
 
-		// return the previously caught error
-		return nil, s.tomb.Err()
-	case conn := <-s.incoming:
-		return conn, nil
+		select {
+		case <-s.tomb.Dying():
+			if timer != nil {
+				timer.Stop()
+			}
+
+			if s.tomb.Err() == errManualClose {
+				// server has been closed manually
+				return nil, ErrAcceptAfterClose
+			}
+
+			// return the previously caught error
+			return nil, s.tomb.Err()
+		case conn := <-s.incoming:
+			if timer != nil {
+				timer.Stop()
+			}
+
+			return conn, nil
+		case <-timeout:
+			return nil, os.ErrDeadlineExceeded
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
 	}
 }
 
+// SetDeadline will set the deadline for pending and future calls to Accept.
+func (s *WebSocketServer) SetDeadline(t time.Time) error {
+	// acquire mutex
+	s.deadlineMutex.Lock()
+	defer s.deadlineMutex.Unlock()
+
+	// set deadline
+	s.deadline = t
+
+	// notify pending calls
+	close(s.deadlineChanged)
+	s.deadlineChanged = make(chan struct{})
+
+	return nil
+}
+
 // Close will close the underlying listener and cleanup resources. It will
 // return an Error if the underlying listener didn't close cleanly.
 func (s *WebSocketServer) Close() error {
@@ -155,6 +329,18 @@ func (s *WebSocketServer) Close() error {
 	return nil
 }
 
+// File returns a duplicate of the underlying listening socket that can be
+// passed to another process. An ErrHandoffUnsupported is returned if the
+// listener does not provide a file.
+func (s *WebSocketServer) File() (*os.File, error) {
+	// check filer
+	if s.filer == nil {
+		return nil, ErrHandoffUnsupported
+	}
+
+	return s.filer.File()
+}
+
 // Addr returns the server's network address.
 func (s *WebSocketServer) Addr() net.Addr {
 	return s.listener.Addr()
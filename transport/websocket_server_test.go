@@ -139,3 +139,52 @@ func TestWebSocketOriginChecker(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, conn)
 }
+
+func TestWebSocketServerEndpoints(t *testing.T) {
+	server, err := testLauncher.Launch("ws://localhost:0")
+	require.NoError(t, err)
+
+	ws := server.(*WebSocketServer)
+	ws.AddEndpoint("/mqtt", WebSocketEndpoint{})
+	ws.AddEndpoint("/v5/mqtt", WebSocketEndpoint{
+		Subprotocols: []string{"mqtt"},
+		OriginChecker: func(r *http.Request) bool {
+			return false
+		},
+	})
+
+	resp, err := http.Get(getURL(server, "http") + "/mqtt")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(getURL(server, "http") + "/other")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	conn, err := testDialer.Dial(getURL(server, "ws") + "/other")
+	assert.Error(t, err)
+	assert.Nil(t, conn)
+
+	conn, err = testDialer.Dial(getURL(server, "ws") + "/v5/mqtt")
+	assert.Error(t, err)
+	assert.Nil(t, conn)
+
+	conn, err = testDialer.Dial(getURL(server, "ws") + "/mqtt")
+	require.NoError(t, err)
+
+	accepted, err := server.Accept()
+	require.NoError(t, err)
+	assert.Equal(t, "/mqtt", accepted.(*WebSocketConn).Path())
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, accepted.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestWSServerDeadline(t *testing.T) {
+	abstractServerDeadlineTest(t, "ws")
+}
+
+func TestWSSServerDeadline(t *testing.T) {
+	abstractServerDeadlineTest(t, "wss")
+}